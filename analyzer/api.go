@@ -26,10 +26,11 @@ type AnalysisResponse struct {
 }
 
 type AnalysisCallback struct {
-	RequestId uuid.UUID       `json:"requestId"`
-	Error     string          `json:"error,omitempty"`
-	Result    []FlatFeeWeight `json:"result"`
-	RepoId    uuid.UUID       `json:"repoid"`
+	RequestId    uuid.UUID       `json:"requestId"`
+	Error        string          `json:"error,omitempty"`
+	Result       []FlatFeeWeight `json:"result"`
+	RepoId       uuid.UUID       `json:"repoid"`
+	Dependencies []Dependency    `json:"dependencies,omitempty"`
 }
 
 type FlatFeeWeight struct {
@@ -73,10 +74,23 @@ func analyzeBackground(request AnalysisRequest) {
 		return
 	}
 
+	//the dependencies are optional, the weights are still useful without them
+	var deps []Dependency
+	p, err := pathName(request.GitUrl)
+	if err == nil {
+		deps, err = findDependencies(p)
+	}
+	if err != nil {
+		slog.Warn("Could not read the dependencies",
+			slog.String("gitUrl", request.GitUrl),
+			slog.Any("error", err))
+	}
+
 	callbackToWebhook(AnalysisCallback{
-		RequestId: request.Id,
-		Result:    weightsMap,
-		RepoId:    request.RepoId,
+		RequestId:    request.Id,
+		Result:       weightsMap,
+		RepoId:       request.RepoId,
+		Dependencies: deps,
 	}, cfg.BackendCallbackUrl)
 
 	slog.Debug("Finished request %s\n", request.Id)
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	EcosystemGo    = "go"
+	EcosystemNpm   = "npm"
+	EcosystemCargo = "cargo"
+	EcosystemPypi  = "pypi"
+)
+
+type Dependency struct {
+	Ecosystem string `json:"ecosystem"`
+	Name      string `json:"name"`
+}
+
+var (
+	// the name of a python requirement ends at the first version specifier, extra or marker
+	requirementNameRegexp = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)`)
+	manifestParsers       = map[string]func([]byte) ([]string, error){
+		"go.mod":           parseGoMod,
+		"package.json":     parsePackageJson,
+		"Cargo.toml":       parseCargoToml,
+		"requirements.txt": parseRequirementsTxt,
+	}
+	manifestEcosystems = map[string]string{
+		"go.mod":           EcosystemGo,
+		"package.json":     EcosystemNpm,
+		"Cargo.toml":       EcosystemCargo,
+		"requirements.txt": EcosystemPypi,
+	}
+)
+
+// findDependencies reads the manifest files in the root of the checked out repository. Only direct
+// dependencies are returned, the backend builds the graph from the dependencies of every repo.
+func findDependencies(dir string) ([]Dependency, error) {
+	var deps []Dependency
+	for file, parser := range manifestParsers {
+		content, err := os.ReadFile(filepath.Join(dir, file))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		names, err := parser(content)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			deps = append(deps, Dependency{Ecosystem: manifestEcosystems[file], Name: name})
+		}
+	}
+
+	sort.Slice(deps, func(i, j int) bool {
+		if deps[i].Ecosystem != deps[j].Ecosystem {
+			return deps[i].Ecosystem < deps[j].Ecosystem
+		}
+		return deps[i].Name < deps[j].Name
+	})
+	return deps, nil
+}
+
+func parseGoMod(content []byte) ([]string, error) {
+	var names []string
+	inBlock := false
+	scanner := bufio.NewScanner(strings.NewReader(string(content)))
+	for scanner.Scan() {
+		//indirect dependencies are dependencies of our dependencies
+		if strings.Contains(scanner.Text(), "// indirect") {
+			continue
+		}
+		line := stripComment(scanner.Text(), "//")
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "require ("):
+			inBlock = true
+		case inBlock && line == ")":
+			inBlock = false
+		case inBlock:
+			names = appendField(names, line)
+		case strings.HasPrefix(line, "require "):
+			names = appendField(names, strings.TrimPrefix(line, "require "))
+		}
+	}
+	return names, scanner.Err()
+}
+
+func parsePackageJson(content []byte) ([]string, error) {
+	var p struct {
+		Dependencies map[string]string `json:"dependencies"`
+	}
+	err := json.Unmarshal(content, &p)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for name := range p.Dependencies {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// parseCargoToml only looks at the [dependencies] table, dev and build dependencies are not shipped
+func parseCargoToml(content []byte) ([]string, error) {
+	var names []string
+	inDeps := false
+	scanner := bufio.NewScanner(strings.NewReader(string(content)))
+	for scanner.Scan() {
+		line := stripComment(scanner.Text(), "#")
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			table := strings.Trim(line, "[] ")
+			inDeps = table == "dependencies"
+			//[dependencies.serde] style
+			if strings.HasPrefix(table, "dependencies.") {
+				names = append(names, strings.TrimPrefix(table, "dependencies."))
+			}
+			continue
+		}
+		if !inDeps {
+			continue
+		}
+		i := strings.IndexByte(line, '=')
+		if i <= 0 {
+			continue
+		}
+		names = append(names, strings.Trim(strings.TrimSpace(line[:i]), `"`))
+	}
+	return names, scanner.Err()
+}
+
+func parseRequirementsTxt(content []byte) ([]string, error) {
+	var names []string
+	scanner := bufio.NewScanner(strings.NewReader(string(content)))
+	for scanner.Scan() {
+		line := stripComment(scanner.Text(), "#")
+		//options like -r other.txt or -e git+https://...
+		if line == "" || strings.HasPrefix(line, "-") {
+			continue
+		}
+		name := requirementNameRegexp.FindString(line)
+		if name != "" {
+			names = append(names, strings.ToLower(name))
+		}
+	}
+	return names, scanner.Err()
+}
+
+func stripComment(line string, marker string) string {
+	if i := strings.Index(line, marker); i >= 0 {
+		line = line[:i]
+	}
+	return strings.TrimSpace(line)
+}
+
+func appendField(names []string, line string) []string {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return names
+	}
+	return append(names, fields[0])
+}
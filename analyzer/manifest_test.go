@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGoMod(t *testing.T) {
+	names, err := parseGoMod([]byte(`module example.com/test
+
+go 1.23
+
+require github.com/google/uuid v1.6.0
+
+require (
+	github.com/stretchr/testify v1.10.0 // a comment
+	golang.org/x/text v0.21.0
+)
+
+require (
+	github.com/kr/text v0.2.0 // indirect
+)
+`))
+	require.Nil(t, err)
+	assert.Equal(t, []string{"github.com/google/uuid", "github.com/stretchr/testify", "golang.org/x/text"}, names)
+}
+
+func TestParsePackageJson(t *testing.T) {
+	names, err := parsePackageJson([]byte(`{"name": "test", "dependencies": {"svelte": "^4.0.0"}, "devDependencies": {"vite": "^5.0.0"}}`))
+	require.Nil(t, err)
+	assert.Equal(t, []string{"svelte"}, names)
+}
+
+func TestParseCargoToml(t *testing.T) {
+	names, err := parseCargoToml([]byte(`[package]
+name = "test"
+version = "0.1.0"
+
+[dependencies]
+serde = { version = "1.0", features = ["derive"] }
+"tokio" = "1" # runtime
+
+[dev-dependencies]
+criterion = "0.5"
+
+[dependencies.rand]
+version = "0.8"
+`))
+	require.Nil(t, err)
+	assert.Equal(t, []string{"serde", "tokio", "rand"}, names)
+}
+
+func TestParseRequirementsTxt(t *testing.T) {
+	names, err := parseRequirementsTxt([]byte(`# comment
+requests>=2.0
+Flask[async]==3.0.0
+-r other.txt
+numpy ; python_version >= "3.9"
+`))
+	require.Nil(t, err)
+	assert.Equal(t, []string{"requests", "flask", "numpy"}, names)
+}
+
+func TestFindDependencies(t *testing.T) {
+	dir := t.TempDir()
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "requirements.txt"), []byte("requests\n"), 0644))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module x\n\nrequire github.com/google/uuid v1.6.0\n"), 0644))
+
+	deps, err := findDependencies(dir)
+	require.Nil(t, err)
+	assert.Equal(t, []Dependency{
+		{Ecosystem: EcosystemGo, Name: "github.com/google/uuid"},
+		{Ecosystem: EcosystemPypi, Name: "requests"},
+	}, deps)
+}
@@ -54,10 +54,16 @@ type GitUrl struct {
 }
 
 type WebhookCallback struct {
-	RequestId string          `json:"requestId"`
-	Error     *string         `json:"error"`
-	Result    []FlatFeeWeight `json:"result"`
-	RepoId    uuid.UUID       `json:"repoid"`
+	RequestId    string          `json:"requestId"`
+	Error        *string         `json:"error"`
+	Result       []FlatFeeWeight `json:"result"`
+	RepoId       uuid.UUID       `json:"repoid"`
+	Dependencies []Dependency    `json:"dependencies"`
+}
+
+type Dependency struct {
+	Ecosystem string `json:"ecosystem"`
+	Name      string `json:"name"`
 }
 
 type FakeRepoMapping struct {
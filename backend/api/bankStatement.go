@@ -0,0 +1,243 @@
+package api
+
+import (
+	"backend/db"
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lineIdMax is the longest line id of the bank that is stored as is, longer ones are hashed
+const lineIdMax = 100
+
+// camtDocument is the part of a CAMT.053 statement that is needed to match the credits, the elements
+// match any namespace version
+type camtDocument struct {
+	Statements []camtStatement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtStatement struct {
+	Entries []camtEntry `xml:"Ntry"`
+}
+
+type camtEntry struct {
+	Amount          camtAmount `xml:"Amt"`
+	CdtDbtInd       string     `xml:"CdtDbtInd"`
+	BookingDate     string     `xml:"BookgDt>Dt"`
+	BookingDateTime string     `xml:"BookgDt>DtTm"`
+	AcctSvcrRef     string     `xml:"AcctSvcrRef"`
+	Info            string     `xml:"AddtlNtryInf"`
+	Details         []camtTx   `xml:"NtryDtls>TxDtls"`
+}
+
+type camtAmount struct {
+	Value    string `xml:",chardata"`
+	Currency string `xml:"Ccy,attr"`
+}
+
+type camtTx struct {
+	Amount       *camtAmount `xml:"Amt"`
+	TxAmount     *camtAmount `xml:"AmtDtls>TxAmt>Amt"`
+	AcctSvcrRef  string      `xml:"Refs>AcctSvcrRef"`
+	Unstructured []string    `xml:"RmtInf>Ustrd"`
+	Structured   []string    `xml:"RmtInf>Strd>CdtrRefInf>Ref"`
+	Debtor       string      `xml:"RltdPties>Dbtr>Nm"`
+	DebtorParty  string      `xml:"RltdPties>Dbtr>Pty>Nm"`
+}
+
+// parseStatement reads the credits of a CAMT.053 statement, or of a CSV export if it is no XML
+func parseStatement(data []byte) ([]db.BankStatementLine, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")) {
+		return parseCamt053(data)
+	}
+	return parseStatementCsv(data)
+}
+
+// parseCamt053 returns a line per credited transaction, a batch booking has a line per transaction
+func parseCamt053(data []byte) ([]db.BankStatementLine, error) {
+	var d camtDocument
+	err := xml.Unmarshal(data, &d)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse camt.053: %w", err)
+	}
+
+	var ls []db.BankStatementLine
+	seen := map[string]int{}
+	for _, s := range d.Statements {
+		for _, e := range s.Entries {
+			if e.CdtDbtInd != "CRDT" {
+				continue
+			}
+			day := e.BookingDate
+			if day == "" && len(e.BookingDateTime) >= 10 {
+				day = e.BookingDateTime[:10]
+			}
+			bookedAt, err := time.Parse(time.DateOnly, day)
+			if err != nil {
+				return nil, fmt.Errorf("invalid booking date %v: %w", day, err)
+			}
+
+			txs := e.Details
+			if len(txs) == 0 {
+				txs = []camtTx{{Unstructured: []string{e.Info}}}
+			}
+			for i, tx := range txs {
+				a := e.Amount
+				if tx.Amount != nil {
+					a = *tx.Amount
+				} else if tx.TxAmount != nil {
+					a = *tx.TxAmount
+				}
+				cents, err := parseCents(a.Value)
+				if err != nil {
+					return nil, err
+				}
+
+				l := db.BankStatementLine{
+					BookedAt:   bookedAt,
+					Cents:      cents,
+					Currency:   strings.ToUpper(a.Currency),
+					Remittance: strings.TrimSpace(strings.Join(append(tx.Unstructured, tx.Structured...), " ")),
+					Debtor:     strings.TrimSpace(tx.Debtor + tx.DebtorParty),
+				}
+				switch {
+				case tx.AcctSvcrRef != "":
+					l.LineId = tx.AcctSvcrRef
+				case e.AcctSvcrRef != "" && len(txs) == 1:
+					l.LineId = e.AcctSvcrRef
+				case e.AcctSvcrRef != "":
+					l.LineId = e.AcctSvcrRef + "/" + strconv.Itoa(i)
+				}
+				l.LineId = lineId(l, seen)
+				ls = append(ls, l)
+			}
+		}
+	}
+	return ls, nil
+}
+
+// parseStatementCsv reads a CSV export with a header of the columns date, amount, currency, reference
+// and optionally name and id. Columns are separated by comma or semicolon, debits are skipped.
+func parseStatementCsv(data []byte) ([]db.BankStatementLine, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	header, _, _ := bytes.Cut(data, []byte("\n"))
+	if bytes.Count(header, []byte(";")) > bytes.Count(header, []byte(",")) {
+		r.Comma = ';'
+	}
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("could not parse csv: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("empty csv")
+	}
+
+	cols := map[string]int{}
+	for i, h := range records[0] {
+		cols[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	for _, c := range []string{"date", "amount", "currency", "reference"} {
+		if _, ok := cols[c]; !ok {
+			return nil, fmt.Errorf("csv misses the column %v", c)
+		}
+	}
+	col := func(rec []string, c string) string {
+		i, ok := cols[c]
+		if !ok || i >= len(rec) {
+			return ""
+		}
+		return strings.TrimSpace(rec[i])
+	}
+
+	var ls []db.BankStatementLine
+	seen := map[string]int{}
+	for n, rec := range records[1:] {
+		cents, err := parseCents(col(rec, "amount"))
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %w", n+2, err)
+		}
+		if cents <= 0 {
+			continue
+		}
+		bookedAt, err := parseStatementDate(col(rec, "date"))
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %w", n+2, err)
+		}
+		l := db.BankStatementLine{
+			LineId:     col(rec, "id"),
+			BookedAt:   bookedAt,
+			Cents:      cents,
+			Currency:   strings.ToUpper(col(rec, "currency")),
+			Remittance: col(rec, "reference"),
+			Debtor:     col(rec, "name"),
+		}
+		l.LineId = lineId(l, seen)
+		ls = append(ls, l)
+	}
+	return ls, nil
+}
+
+// lineId identifies a line, so a statement can be imported again. If the bank gives no id, the line is
+// hashed, and the n-th equal line of the statement gets n as suffix.
+func lineId(l db.BankStatementLine, seen map[string]int) string {
+	if l.LineId != "" && len(l.LineId) <= lineIdMax {
+		return l.LineId
+	}
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%d|%s|%s|%s", l.LineId, l.BookedAt.Format(time.DateOnly), l.Cents,
+		l.Currency, l.Remittance, l.Debtor)))
+	id := "sha256:" + hex.EncodeToString(h[:])
+	seen[id]++
+	if seen[id] > 1 {
+		id += "#" + strconv.Itoa(seen[id])
+	}
+	return id
+}
+
+// parseCents parses an amount with at most two decimals, with decimal point or comma, e.g. 1'204.51 or
+// 1.204,51
+func parseCents(s string) (int64, error) {
+	s = strings.NewReplacer(" ", "", "'", "", "\u00a0", "").Replace(s)
+	sign := int64(1)
+	if strings.HasPrefix(s, "-") {
+		sign = -1
+		s = s[1:]
+	} else if strings.HasPrefix(s, "+") {
+		s = s[1:]
+	}
+
+	whole, frac := s, ""
+	if i := strings.LastIndexAny(s, ".,"); i >= 0 && len(s)-i-1 <= 2 {
+		whole, frac = s[:i], s[i+1:]
+	}
+	whole = strings.NewReplacer(".", "", ",", "").Replace(whole)
+	for len(frac) < 2 {
+		frac += "0"
+	}
+
+	w, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %v: %w", s, err)
+	}
+	f, err := strconv.ParseInt(frac, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %v: %w", s, err)
+	}
+	return sign * (w*100 + f), nil
+}
+
+func parseStatementDate(s string) (time.Time, error) {
+	for _, layout := range []string{time.DateOnly, "02.01.2006", "02/01/2006"} {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %v", s)
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const camt053 = `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.04">
+  <BkToCstmrStmt>
+    <Stmt>
+      <Ntry>
+        <Amt Ccy="USD">120.00</Amt>
+        <CdtDbtInd>CRDT</CdtDbtInd>
+        <BookgDt><Dt>2026-10-19</Dt></BookgDt>
+        <AcctSvcrRef>20261019-0001</AcctSvcrRef>
+        <NtryDtls>
+          <TxDtls>
+            <RltdPties><Dbtr><Nm>ACME AG</Nm></Dbtr></RltdPties>
+            <RmtInf><Ustrd>Sponsoring FF7K 2M9Q XA4B</Ustrd></RmtInf>
+          </TxDtls>
+        </NtryDtls>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="USD">50.00</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <BookgDt><Dt>2026-10-19</Dt></BookgDt>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="USD">30.00</Amt>
+        <CdtDbtInd>CRDT</CdtDbtInd>
+        <BookgDt><DtTm>2026-10-20T08:00:00</DtTm></BookgDt>
+        <AcctSvcrRef>20261020-0001</AcctSvcrRef>
+        <NtryDtls>
+          <TxDtls>
+            <Amt Ccy="USD">10.00</Amt>
+            <RmtInf><Strd><CdtrRefInf><Ref>FFAAAAAAAAAA</Ref></CdtrRefInf></Strd></RmtInf>
+          </TxDtls>
+          <TxDtls>
+            <Amt Ccy="USD">20.00</Amt>
+            <RltdPties><Dbtr><Pty><Nm>Jane</Nm></Pty></Dbtr></RltdPties>
+          </TxDtls>
+        </NtryDtls>
+      </Ntry>
+    </Stmt>
+  </BkToCstmrStmt>
+</Document>`
+
+func TestParseCamt053(t *testing.T) {
+	ls, err := parseStatement([]byte(camt053))
+	require.Nil(t, err)
+	require.Len(t, ls, 3)
+
+	assert.Equal(t, "20261019-0001", ls[0].LineId)
+	assert.Equal(t, int64(12000), ls[0].Cents)
+	assert.Equal(t, "USD", ls[0].Currency)
+	assert.Equal(t, "Sponsoring FF7K 2M9Q XA4B", ls[0].Remittance)
+	assert.Equal(t, "ACME AG", ls[0].Debtor)
+	assert.Equal(t, time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC), ls[0].BookedAt)
+
+	//a batch booking has a line per transaction
+	assert.Equal(t, "20261020-0001/0", ls[1].LineId)
+	assert.Equal(t, int64(1000), ls[1].Cents)
+	assert.Equal(t, "FFAAAAAAAAAA", ls[1].Remittance)
+	assert.Equal(t, "20261020-0001/1", ls[2].LineId)
+	assert.Equal(t, int64(2000), ls[2].Cents)
+	assert.Equal(t, "Jane", ls[2].Debtor)
+}
+
+func TestParseStatementCsv(t *testing.T) {
+	csv := "Date;Amount;Currency;Reference;Name\n" +
+		"19.10.2026;1.204,51;usd;FF7K2M9QXA4B;ACME AG\n" +
+		"19.10.2026;-10,00;USD;fee;Bank\n" +
+		"19.10.2026;1.204,51;USD;FF7K2M9QXA4B;ACME AG\n"
+	ls, err := parseStatement([]byte(csv))
+	require.Nil(t, err)
+	require.Len(t, ls, 2)
+	assert.Equal(t, int64(120451), ls[0].Cents)
+	assert.Equal(t, "USD", ls[0].Currency)
+	assert.Equal(t, "ACME AG", ls[0].Debtor)
+
+	//two equal transfers on the same day are two lines, importing them again gives the same ids
+	assert.NotEqual(t, ls[0].LineId, ls[1].LineId)
+	again, err := parseStatement([]byte(csv))
+	require.Nil(t, err)
+	assert.Equal(t, ls[0].LineId, again[0].LineId)
+	assert.Equal(t, ls[1].LineId, again[1].LineId)
+
+	_, err = parseStatement([]byte("date,amount\n2026-10-19,10\n"))
+	assert.NotNil(t, err)
+}
+
+func TestParseCents(t *testing.T) {
+	for s, cents := range map[string]int64{
+		"120.00":   12000,
+		"1'204.51": 120451,
+		"1.204,51": 120451,
+		"1,204.5":  120450,
+		"1.204":    120400,
+		"12":       1200,
+		"-3,10":    -310,
+	} {
+		c, err := parseCents(s)
+		require.Nil(t, err, s)
+		assert.Equal(t, cents, c, s)
+	}
+	_, err := parseCents("abc")
+	assert.NotNil(t, err)
+}
+
+func TestBankReference(t *testing.T) {
+	r, err := newBankReference()
+	require.Nil(t, err)
+	assert.Len(t, r, 12)
+	assert.True(t, bankReference.MatchString(r))
+}
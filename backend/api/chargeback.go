@@ -0,0 +1,287 @@
+package api
+
+import (
+	"backend/client"
+	"backend/db"
+	"backend/util"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ChargebackError = "Oops something went wrong with the chargebacks. Please try again."
+	chargebackDays  = 30
+)
+
+// ChargebackPolicy decides what is taken back from the allocations of a sponsor whose payment was
+// refunded or disputed and who spent more than is left. PARKED takes back what is parked for repos
+// without contributors, UNCLAIMED takes what contributors did not claim yet as well. What cannot be
+// taken back stays as negative balance of the sponsor, which stops the distribution.
+type ChargebackPolicy struct {
+	clawback string
+	admins   []string
+}
+
+func NewChargebackPolicy(clawback string, admins []string) *ChargebackPolicy {
+	return &ChargebackPolicy{clawback: clawback, admins: admins}
+}
+
+// Clawback takes the amount from the parked funds first, then from the unclaimed contributions if the
+// policy allows it. It returns what is taken from each source and the rest that could not be taken.
+func (cp *ChargebackPolicy) Clawback(amount *big.Int, parked []db.ClawbackSource, unclaimed []db.ClawbackSource) ([]db.ClawbackSource, *big.Int) {
+	rest := new(big.Int).Set(amount)
+	var sources []db.ClawbackSource
+	switch cp.clawback {
+	case db.ClawbackParked:
+		sources = parked
+	case db.ClawbackUnclaimed:
+		sources = append(append(sources, parked...), unclaimed...)
+	}
+
+	var taken []db.ClawbackSource
+	for _, s := range sources {
+		if rest.Sign() <= 0 {
+			break
+		}
+		b := s.Balance
+		if b.Cmp(rest) > 0 {
+			b = rest
+		}
+		taken = append(taken, db.ClawbackSource{UserContributorId: s.UserContributorId, RepoId: s.RepoId, Balance: new(big.Int).Set(b)})
+		rest = new(big.Int).Sub(rest, b)
+	}
+	return taken, rest
+}
+
+// reversedAmount is the share of the net payment that was reversed. The providers report the gross amount in
+// cents, the fee of the payment is reversed in the same proportion.
+func reversedAmount(cents int64, gross *big.Int, net *big.Int) *big.Int {
+	r := new(big.Int).Mul(big.NewInt(util.UsdCentToBase(cents)), net)
+	r = r.Div(r, gross)
+	if r.Cmp(net) > 0 {
+		return new(big.Int).Set(net)
+	}
+	return r
+}
+
+// reverse books a refund or dispute of the payment with the externalId as negative pay-in. The providers report
+// the refunded amount in total, so only what was not booked yet is reversed. The subscription is canceled,
+// and if the sponsor spent more than is left, the policy claws back the allocations.
+func reverse(e *client.EmailClient, cp *ChargebackPolicy, externalId uuid.UUID, kind string, cents int64, in *db.Inbox) error {
+	request, err := db.FindPayInExternal(externalId, db.PayInRequest)
+	if err != nil {
+		return err
+	}
+	success, err := db.FindPayInExternal(externalId, db.PayInSuccess)
+	if err != nil {
+		return err
+	}
+	if request == nil || success == nil {
+		slog.Info("Payment was not successful, nothing to reverse",
+			slog.String("externalId", externalId.String()))
+		return nil
+	}
+
+	status := db.PayInRefund
+	if kind == db.ChargebackDispute {
+		status = db.PayInDispute
+	}
+	booked, err := db.FindPayInExternal(externalId, status)
+	if err != nil {
+		return err
+	}
+	if booked != nil && kind == db.ChargebackDispute {
+		return nil
+	}
+
+	total := reversedAmount(cents, request.Balance, success.Balance)
+	amount := new(big.Int).Set(total)
+	if booked != nil {
+		amount = amount.Add(amount, booked.Balance)
+	}
+	if amount.Sign() <= 0 {
+		return nil
+	}
+
+	now := util.TimeNow()
+	clawbacks, day, unrecovered, err := cp.clawbackBalance(success.UserId, success.Currency, amount)
+	if err != nil {
+		return err
+	}
+	clawedBack := new(big.Int)
+	for _, t := range clawbacks {
+		clawedBack = clawedBack.Add(clawedBack, t.Balance)
+	}
+
+	c := db.Chargeback{
+		Id:          uuid.New(),
+		ExternalId:  externalId,
+		UserId:      success.UserId,
+		Kind:        kind,
+		Balance:     new(big.Int).Neg(amount),
+		ClawedBack:  clawedBack,
+		Unrecovered: unrecovered,
+		Currency:    success.Currency,
+		CreatedAt:   now,
+	}
+	err = db.BookChargeback(db.ChargebackBooking{
+		PayIn: db.PayInEvent{
+			Id:         uuid.New(),
+			ExternalId: externalId,
+			UserId:     success.UserId,
+			Balance:    new(big.Int).Neg(total),
+			Currency:   success.Currency,
+			Status:     status,
+			Seats:      success.Seats,
+			Freq:       success.Freq,
+			CreatedAt:  now,
+		},
+		Clawbacks:  clawbacks,
+		Day:        day,
+		Chargeback: c,
+		Inbox:      in,
+	})
+	if err != nil {
+		return err
+	}
+	slog.Info("Payment reversed",
+		slog.String("externalId", externalId.String()),
+		slog.String("kind", kind),
+		slog.String("balance", c.Balance.String()),
+		slog.String("clawedBack", clawedBack.String()),
+		slog.String("unrecovered", unrecovered.String()))
+
+	notifyChargeback(e, cp, c)
+	return nil
+}
+
+// clawbackBalance returns what is taken back because the sponsor spent more than is left once the amount is
+// reversed, at most the amount. It is booked on the last distributed day, so the daily runner does not skip
+// a day it has yet to book. The rest that cannot be taken back is unrecovered.
+func (cp *ChargebackPolicy) clawbackBalance(userId uuid.UUID, currency string, amount *big.Int) ([]db.ClawbackSource, *time.Time, *big.Int, error) {
+	mAdd, err := db.FindPayInBalanceByCurrency(userId)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	mFut, err := db.FindSumFutureSponsors(userId)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	mSub, err := db.FindSumDailySponsors(userId)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	balance := new(big.Int).Neg(amount)
+	for _, m := range []map[string]*big.Int{mSub, mFut} {
+		if m[currency] != nil {
+			balance = balance.Sub(balance, m[currency])
+		}
+	}
+	if mAdd[currency] != nil {
+		balance = balance.Add(balance, mAdd[currency])
+	}
+	if balance.Sign() >= 0 {
+		return nil, nil, big.NewInt(0), nil
+	}
+
+	need := new(big.Int).Neg(balance)
+	if need.Cmp(amount) > 0 {
+		need = new(big.Int).Set(amount)
+	}
+
+	day, err := db.FindLatestBookedDay()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if day == nil {
+		return nil, nil, need, nil
+	}
+	parked, unclaimed, err := db.FindClawbackSources(userId, currency)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	taken, rest := cp.Clawback(need, parked, unclaimed)
+	return taken, day, rest, nil
+}
+
+// reinstate books a won dispute, the disputed amount is given back to the sponsor
+func reinstate(externalId uuid.UUID, in *db.Inbox) error {
+	dispute, err := db.FindPayInExternal(externalId, db.PayInDispute)
+	if err != nil {
+		return err
+	}
+	won, err := db.FindPayInExternal(externalId, db.PayInDisputeWon)
+	if err != nil {
+		return err
+	}
+	if dispute == nil || won != nil {
+		return nil
+	}
+
+	dispute.Id = uuid.New()
+	dispute.Status = db.PayInDisputeWon
+	dispute.Balance = new(big.Int).Neg(dispute.Balance)
+	dispute.CreatedAt = util.TimeNow()
+	err = db.BookPayInEvent(*dispute, in)
+	if err != nil {
+		return err
+	}
+	slog.Info("Dispute won",
+		slog.String("externalId", externalId.String()),
+		slog.String("balance", dispute.Balance.String()))
+	return nil
+}
+
+func notifyChargeback(e *client.EmailClient, cp *ChargebackPolicy, c db.Chargeback) {
+	u, err := db.FindUserById(c.UserId)
+	if err != nil || u == nil {
+		slog.Warn("Could not find user of chargeback",
+			slog.String("userId", c.UserId.String()),
+			slog.Any("error", err))
+		return
+	}
+	err = e.SendChargeback(*u, c)
+	if err != nil {
+		slog.Warn("Could not send chargeback email",
+			slog.String("userId", c.UserId.String()),
+			slog.Any("error", err))
+	}
+	for _, a := range cp.admins {
+		err = e.SendChargebackAdmin(a, *u, c)
+		if err != nil {
+			slog.Warn("Could not send chargeback email to admin",
+				slog.String("email", a),
+				slog.Any("error", err))
+		}
+	}
+}
+
+// Chargebacks returns the refunds and disputes of the last days, ?days= sets the number of days
+func Chargebacks(w http.ResponseWriter, r *http.Request, _ *db.UserDetail) {
+	days := chargebackDays
+	if d := r.URL.Query().Get("days"); d != "" {
+		var err error
+		days, err = strconv.Atoi(d)
+		if err != nil || days <= 0 {
+			slog.Error("Invalid days",
+				slog.String("days", d))
+			util.WriteErrorf(w, http.StatusBadRequest, ChargebackError)
+			return
+		}
+	}
+	cs, err := db.FindChargebacks(util.TimeNow().AddDate(0, 0, -days))
+	if err != nil {
+		slog.Error("Could not find chargebacks",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, ChargebackError)
+		return
+	}
+	util.WriteJson(w, cs)
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"backend/db"
+	"math/big"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChargebackClawback(t *testing.T) {
+	c := uuid.New()
+	parked := []db.ClawbackSource{{RepoId: uuid.New(), Balance: big.NewInt(300)}}
+	unclaimed := []db.ClawbackSource{{UserContributorId: &c, RepoId: uuid.New(), Balance: big.NewInt(500)}}
+
+	taken, rest := NewChargebackPolicy(db.ClawbackNone, nil).Clawback(big.NewInt(400), parked, unclaimed)
+	assert.Len(t, taken, 0)
+	assert.Equal(t, "400", rest.String())
+
+	taken, rest = NewChargebackPolicy(db.ClawbackParked, nil).Clawback(big.NewInt(400), parked, unclaimed)
+	require.Len(t, taken, 1)
+	assert.Nil(t, taken[0].UserContributorId)
+	assert.Equal(t, "300", taken[0].Balance.String())
+	assert.Equal(t, "100", rest.String())
+
+	//parked funds are taken first
+	taken, rest = NewChargebackPolicy(db.ClawbackUnclaimed, nil).Clawback(big.NewInt(400), parked, unclaimed)
+	require.Len(t, taken, 2)
+	assert.Equal(t, "300", taken[0].Balance.String())
+	assert.Equal(t, c, *taken[1].UserContributorId)
+	assert.Equal(t, "100", taken[1].Balance.String())
+	assert.Equal(t, "0", rest.String())
+	assert.Equal(t, "500", unclaimed[0].Balance.String())
+}
+
+func TestReversedAmount(t *testing.T) {
+	//$10 paid, 4% fee
+	const usd10 = 10_000_000
+	gross := big.NewInt(usd10)
+	net := big.NewInt(usd10 * 96 / 100)
+
+	assert.Equal(t, net.String(), reversedAmount(1000, gross, net).String())
+	assert.Equal(t, big.NewInt(usd10*48/100).String(), reversedAmount(500, gross, net).String())
+	//never more than was paid in
+	assert.Equal(t, net.String(), reversedAmount(2000, gross, net).String())
+}
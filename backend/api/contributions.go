@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"log/slog"
 	"net/http"
+	"sort"
 	"time"
 
 	"github.com/google/uuid"
@@ -34,9 +35,57 @@ func ContributionsRcv(w http.ResponseWriter, _ *http.Request, user *db.UserDetai
 		util.WriteErrorf(w, http.StatusBadRequest, ContributionsError)
 		return
 	}
+
+	//forwarded in and out amounts are part of the received contributions
+	fcs, err := db.FindForwardContributions(user.Id)
+	if err != nil {
+		slog.Error("Could not find forward contributions",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, ContributionsError)
+		return
+	}
+	cs = append(cs, fcs...)
+	sort.SliceStable(cs, func(i, j int) bool {
+		return cs[i].Day.Before(cs[j].Day)
+	})
 	util.WriteJson(w, cs)
 }
 
+// ContributionMonthsSend returns the monthly sums of what the user sponsored, including archived months
+func ContributionMonthsSend(w http.ResponseWriter, _ *http.Request, user *db.UserDetail) {
+	cms, err := db.FindContributionMonths(user.Id, false)
+	if err != nil {
+		slog.Error("Could not find contribution months",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, ContributionsError)
+		return
+	}
+	util.WriteJson(w, cms)
+}
+
+// ContributionMonthsRcv returns the monthly sums of what the user received, including archived months
+func ContributionMonthsRcv(w http.ResponseWriter, _ *http.Request, user *db.UserDetail) {
+	cms, err := db.FindContributionMonths(user.Id, true)
+	if err != nil {
+		slog.Error("Could not find contribution months",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, ContributionsError)
+		return
+	}
+	util.WriteJson(w, cms)
+}
+
+func ContributionArchives(w http.ResponseWriter, _ *http.Request, _ *db.UserDetail) {
+	as, err := db.FindContributionArchives()
+	if err != nil {
+		slog.Error("Could not find contribution archives",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, ContributionsError)
+		return
+	}
+	util.WriteJson(w, as)
+}
+
 func ContributionsSum2(w http.ResponseWriter, r *http.Request) {
 	u := r.PathValue("uuid")
 	if u == "" {
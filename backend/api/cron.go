@@ -0,0 +1,51 @@
+package api
+
+import (
+	"backend/db"
+	"backend/util"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+const (
+	CronError   = "Oops something went wrong with retrieving the scheduled jobs. Please try again."
+	cronRunsMax = 100
+)
+
+type CronStatusDto struct {
+	Jobs []db.CronJob `json:"jobs"`
+	Runs []db.CronRun `json:"runs"`
+}
+
+// CronStatus shows the next execution of the scheduled jobs and their latest runs, ?limit= sets the
+// number of runs
+func CronStatus(w http.ResponseWriter, r *http.Request, _ *db.UserDetail) {
+	limit := cronRunsMax
+	if l := r.URL.Query().Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit <= 0 || limit > cronRunsMax {
+			slog.Error("Invalid limit",
+				slog.String("limit", l))
+			util.WriteErrorf(w, http.StatusBadRequest, CronError)
+			return
+		}
+	}
+
+	jobs, err := db.FindCronJobs()
+	if err != nil {
+		slog.Error("Could not find cron jobs",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, CronError)
+		return
+	}
+	runs, err := db.FindCronRuns(limit)
+	if err != nil {
+		slog.Error("Could not find cron runs",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, CronError)
+		return
+	}
+	util.WriteJson(w, CronStatusDto{Jobs: jobs, Runs: runs})
+}
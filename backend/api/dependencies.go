@@ -0,0 +1,109 @@
+package api
+
+import (
+	"backend/db"
+	"backend/util"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DependencyError = "Oops something went wrong with retrieving the dependencies. Please try again."
+)
+
+// a go module path with a major version suffix, e.g. github.com/a/b/v2
+var goMajorVersionRegexp = regexp.MustCompile(`/v[0-9]+$`)
+
+func GetRepoDependencies(w http.ResponseWriter, r *http.Request, _ *db.UserDetail) {
+	idStr := r.PathValue("id")
+	repoId, err := uuid.Parse(idStr)
+	if err != nil {
+		slog.Error("Not a valid id",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, GenericErrorMessage)
+		return
+	}
+
+	ds, err := db.FindRepoDependencies(repoId)
+	if err != nil {
+		slog.Error("Could not find repo dependencies",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, DependencyError)
+		return
+	}
+	util.WriteJson(w, ds)
+}
+
+// GetDependencyFlows explains to the sponsor which part of the daily amount went from a sponsored repo
+// down to its dependencies.
+func GetDependencyFlows(w http.ResponseWriter, _ *http.Request, user *db.UserDetail) {
+	fs, err := db.FindDependencyFlowsBySponsor(user.Id)
+	if err != nil {
+		slog.Error("Could not find dependency flows",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, DependencyError)
+		return
+	}
+	util.WriteJson(w, fs)
+}
+
+func storeDependencies(repoId uuid.UUID, deps []Dependency) error {
+	rds := make([]db.RepoDependency, 0, len(deps))
+	for _, d := range deps {
+		depRepoId, err := resolveDependency(d)
+		if err != nil {
+			return err
+		}
+		rds = append(rds, db.RepoDependency{
+			RepoId:    repoId,
+			Ecosystem: d.Ecosystem,
+			Name:      d.Name,
+			DepRepoId: depRepoId,
+		})
+	}
+	return db.ReplaceRepoDependencies(repoId, rds, util.TimeNow())
+}
+
+// resolveDependency maps a dependency to a repo we know. Go modules contain the location of the repo,
+// for the other ecosystems the package name has to match the repo name, and only if the match is unique.
+func resolveDependency(d Dependency) (*uuid.UUID, error) {
+	if d.Ecosystem == "go" {
+		u := goModuleUrl(d.Name)
+		if u == "" {
+			return nil, nil
+		}
+		repo, err := db.FindRepoByUrl(u)
+		if err != nil || repo == nil {
+			return nil, err
+		}
+		return &repo.Id, nil
+	}
+
+	repos, err := db.FindReposByShortName(d.Name)
+	if err != nil {
+		return nil, err
+	}
+	if len(repos) != 1 {
+		return nil, nil
+	}
+	return &repos[0].Id, nil
+}
+
+// goModuleUrl returns the repo url of modules hosted on a known git host. A module can be in a
+// subdirectory of the repo, so only host/owner/name is used.
+func goModuleUrl(module string) string {
+	module = goMajorVersionRegexp.ReplaceAllString(module, "")
+	parts := strings.Split(module, "/")
+	if len(parts) < 3 {
+		return ""
+	}
+	switch parts[0] {
+	case "github.com", "gitlab.com", "bitbucket.org", "codeberg.org":
+		return "https://" + strings.Join(parts[:3], "/")
+	}
+	return ""
+}
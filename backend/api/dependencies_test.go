@@ -0,0 +1,15 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGoModuleUrl(t *testing.T) {
+	assert.Equal(t, "https://github.com/google/uuid", goModuleUrl("github.com/google/uuid"))
+	assert.Equal(t, "https://github.com/libgit2/git2go", goModuleUrl("github.com/libgit2/git2go/v34"))
+	assert.Equal(t, "https://github.com/aws/aws-sdk-go-v2", goModuleUrl("github.com/aws/aws-sdk-go-v2/service/s3"))
+	assert.Equal(t, "", goModuleUrl("golang.org/x/text"))
+	assert.Equal(t, "", goModuleUrl("github.com/google"))
+}
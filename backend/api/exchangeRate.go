@@ -0,0 +1,249 @@
+package api
+
+import (
+	"backend/db"
+	"backend/util"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	ExchangeRateError = "Oops something went wrong with the exchange rates. Please try again."
+	// enough precision for 78 digit amounts
+	ratePrecision = 512
+)
+
+// ExchangeRates looks up the rate between two currencies. If there is no direct rate, the inverse rate
+// is used, and if there is none either, the rate is calculated over the base currency.
+type ExchangeRates struct {
+	base string
+}
+
+type PayoutRequestDto struct {
+	db.PayoutRequest
+	DisplayCurrency string   `json:"displayCurrency,omitempty"`
+	DisplayAmount   *big.Int `json:"displayAmount,omitempty"`
+}
+
+func NewExchangeRates(base string) *ExchangeRates {
+	return &ExchangeRates{base: strings.ToUpper(base)}
+}
+
+// Rate returns how many whole units of currencyTo one whole unit of currencyFrom is worth on the day,
+// or nil if it is not known
+func (e *ExchangeRates) Rate(currencyFrom string, currencyTo string, day time.Time) (*big.Float, error) {
+	currencyFrom = strings.ToUpper(currencyFrom)
+	currencyTo = strings.ToUpper(currencyTo)
+	if currencyFrom == currencyTo {
+		return big.NewFloat(1).SetPrec(ratePrecision), nil
+	}
+
+	rate, err := e.pairRate(currencyFrom, currencyTo, day)
+	if err != nil || rate != nil {
+		return rate, err
+	}
+	if currencyFrom == e.base || currencyTo == e.base || e.base == "" {
+		return nil, nil
+	}
+
+	rateFrom, err := e.pairRate(currencyFrom, e.base, day)
+	if err != nil || rateFrom == nil {
+		return nil, err
+	}
+	rateTo, err := e.pairRate(e.base, currencyTo, day)
+	if err != nil || rateTo == nil {
+		return nil, err
+	}
+	return new(big.Float).SetPrec(ratePrecision).Mul(rateFrom, rateTo), nil
+}
+
+func (e *ExchangeRates) pairRate(currencyFrom string, currencyTo string, day time.Time) (*big.Float, error) {
+	r, err := db.FindExchangeRate(currencyFrom, currencyTo, day)
+	if err != nil {
+		return nil, err
+	}
+	if r != nil {
+		return new(big.Float).SetPrec(ratePrecision).Set(r.Rate), nil
+	}
+
+	r, err = db.FindExchangeRate(currencyTo, currencyFrom, day)
+	if err != nil || r == nil {
+		return nil, err
+	}
+	one := big.NewFloat(1).SetPrec(ratePrecision)
+	return one.Quo(one, r.Rate), nil
+}
+
+// Convert converts an amount in the smallest unit of currencyFrom to the smallest unit of currencyTo.
+// It returns nil if the rate is not known.
+func (e *ExchangeRates) Convert(amount *big.Int, currencyFrom string, currencyTo string, day time.Time) (*big.Int, *big.Float, error) {
+	rate, err := e.Rate(currencyFrom, currencyTo, day)
+	if err != nil || rate == nil {
+		return nil, nil, err
+	}
+	converted, err := convertAmount(amount, currencyFrom, currencyTo, rate)
+	if err != nil {
+		return nil, nil, err
+	}
+	return converted, rate, nil
+}
+
+// ConvertTotal converts the balances of all currencies and adds them up. It returns nil if one of the
+// rates is not known, a partial sum would be misleading.
+func (e *ExchangeRates) ConvertTotal(balances map[string]*big.Int, currencyTo string, day time.Time) (*big.Int, error) {
+	total := big.NewInt(0)
+	for currency, b := range balances {
+		converted, _, err := e.Convert(b, currency, currencyTo, day)
+		if err != nil {
+			return nil, err
+		}
+		if converted == nil {
+			return nil, nil
+		}
+		total = total.Add(total, converted)
+	}
+	return total, nil
+}
+
+func convertAmount(amount *big.Int, currencyFrom string, currencyTo string, rate *big.Float) (*big.Int, error) {
+	factorFrom, err := util.GetFactor(currencyFrom)
+	if err != nil {
+		return nil, err
+	}
+	factorTo, err := util.GetFactor(currencyTo)
+	if err != nil {
+		return nil, err
+	}
+
+	f := new(big.Float).SetPrec(ratePrecision).SetInt(amount)
+	f = f.Mul(f, rate)
+	f = f.Mul(f, new(big.Float).SetPrec(ratePrecision).SetInt(factorTo))
+	f = f.Quo(f, new(big.Float).SetPrec(ratePrecision).SetInt(factorFrom))
+	//round to the nearest unit, an inverse rate is not exact and truncating would lose one unit
+	half := big.NewFloat(0.5)
+	if f.Sign() < 0 {
+		half = half.Neg(half)
+	}
+	converted, _ := f.Add(f, half).Int(nil)
+	return converted, nil
+}
+
+func displayCurrency(user *db.UserDetail, base string) string {
+	if user.DisplayCurrency != nil {
+		return *user.DisplayCurrency
+	}
+	return strings.ToUpper(base)
+}
+
+func GetExchangeRates(w http.ResponseWriter, _ *http.Request, _ *db.UserDetail) {
+	rs, err := db.FindLatestExchangeRates(util.TimeNow())
+	if err != nil {
+		slog.Error("Could not find exchange rates",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, ExchangeRateError)
+		return
+	}
+	util.WriteJson(w, rs)
+}
+
+func UpdateDisplayCurrency(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
+	currencyEsc := r.PathValue("currency")
+	currency, err := url.QueryUnescape(currencyEsc)
+	if err != nil {
+		slog.Error("Query unescape display currency",
+			slog.String("currency", currencyEsc),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, ExchangeRateError)
+		return
+	}
+
+	currency = strings.ToUpper(currency)
+	if _, ok := util.SupportedCurrencies[currency]; !ok {
+		slog.Error("Unknown display currency",
+			slog.String("currency", currency))
+		util.WriteErrorf(w, http.StatusBadRequest, "Unknown currency %v", currency)
+		return
+	}
+
+	err = db.UpdateDisplayCurrency(user.Id, &currency)
+	if err != nil {
+		slog.Error("Could not save display currency",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, ExchangeRateError)
+		return
+	}
+}
+
+func DeleteDisplayCurrency(w http.ResponseWriter, _ *http.Request, user *db.UserDetail) {
+	err := db.UpdateDisplayCurrency(user.Id, nil)
+	if err != nil {
+		slog.Error("Could not reset display currency",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, ExchangeRateError)
+		return
+	}
+}
+
+// PayoutRequests lists the payouts of the user, with the amount converted to the display currency at
+// the rate that was recorded with the payout
+func (h *ResourceHandler) PayoutRequests(w http.ResponseWriter, _ *http.Request, user *db.UserDetail) {
+	ps, err := db.FindPayoutRequestsByUserId(user.Id)
+	if err != nil {
+		slog.Error("Could not find payout requests",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, PayoutError)
+		return
+	}
+
+	e := NewExchangeRates(h.Config.ExchangeRateBase)
+	dc := displayCurrency(user, h.Config.ExchangeRateBase)
+	dtos := make([]PayoutRequestDto, 0, len(ps))
+	for _, p := range ps {
+		dto := PayoutRequestDto{PayoutRequest: p, DisplayCurrency: dc}
+		dto.DisplayAmount, err = payoutDisplayAmount(e, p, dc)
+		if err != nil {
+			slog.Error("Could not convert payout",
+				slog.String("id", p.Id.String()),
+				slog.Any("error", err))
+			util.WriteErrorf(w, http.StatusInternalServerError, PayoutError)
+			return
+		}
+		dtos = append(dtos, dto)
+	}
+	util.WriteJson(w, dtos)
+}
+
+// payoutDisplayAmount uses the recorded rate to the rate currency, so the amount does not change
+// when the rates change. Only the step from the rate currency to the display currency uses the rate
+// of the payout day.
+func payoutDisplayAmount(e *ExchangeRates, p db.PayoutRequest, currencyTo string) (*big.Int, error) {
+	if strings.EqualFold(p.Currency, currencyTo) {
+		return p.Amount, nil
+	}
+	if p.ExchangeRate == nil {
+		return nil, nil
+	}
+	amount, err := convertAmount(p.Amount, p.Currency, p.RateCurrency, p.ExchangeRate)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(p.RateCurrency, currencyTo) {
+		return amount, nil
+	}
+	converted, _, err := e.Convert(amount, p.RateCurrency, currencyTo, p.CreatedAt)
+	return converted, err
+}
+
+// payoutRate returns the rate of the payout currency to the base currency at the time of the payout
+func payoutRate(e *ExchangeRates, currency string, now time.Time) (*big.Float, error) {
+	rate, err := e.Rate(currency, e.base, now)
+	if err != nil {
+		return nil, fmt.Errorf("could not find rate %v/%v: %w", currency, e.base, err)
+	}
+	return rate, nil
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"backend/db"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertAmount(t *testing.T) {
+	rate, _ := new(big.Float).SetString("2500")
+
+	//1 ETH in wei to micro dollars
+	wei, _ := new(big.Int).SetString("1000000000000000000", 10)
+	usd, err := convertAmount(wei, "ETH", "USD", rate)
+	require.NoError(t, err)
+	assert.Equal(t, "2500000000", usd.String())
+
+	//and back with the inverse rate
+	inverse := new(big.Float).SetPrec(ratePrecision).Quo(big.NewFloat(1).SetPrec(ratePrecision), rate)
+	eth, err := convertAmount(big.NewInt(2500000000), "USD", "ETH", inverse)
+	require.NoError(t, err)
+	assert.Equal(t, "1000000000000000000", eth.String())
+
+	//negative amounts round away from zero as well
+	usd, err = convertAmount(big.NewInt(-3), "USD", "USD", big.NewFloat(0.5))
+	require.NoError(t, err)
+	assert.Equal(t, "-2", usd.String())
+
+	_, err = convertAmount(wei, "ETH", "XYZ", rate)
+	assert.Error(t, err)
+}
+
+func TestPayoutDisplayAmount(t *testing.T) {
+	rate, _ := new(big.Float).SetString("4.5")
+	p := db.PayoutRequest{
+		Currency:     "GAS",
+		Amount:       big.NewInt(200000000), // 2 GAS
+		ExchangeRate: rate,
+		RateCurrency: "USD",
+		CreatedAt:    time.Now(),
+	}
+	e := NewExchangeRates("USD")
+
+	a, err := payoutDisplayAmount(e, p, "USD")
+	require.NoError(t, err)
+	assert.Equal(t, "9000000", a.String())
+
+	a, err = payoutDisplayAmount(e, p, "GAS")
+	require.NoError(t, err)
+	assert.Equal(t, "200000000", a.String())
+
+	p.ExchangeRate = nil
+	a, err = payoutDisplayAmount(e, p, "USD")
+	require.NoError(t, err)
+	assert.Nil(t, a)
+}
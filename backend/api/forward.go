@@ -0,0 +1,181 @@
+package api
+
+import (
+	"backend/db"
+	"backend/util"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ForwardRuleError = "Oops something went wrong with the forward rules. Please try again."
+)
+
+type ForwardRuleRequest struct {
+	TargetRepoId    *uuid.UUID `json:"targetRepoId,omitempty"`
+	TargetUserEmail *string    `json:"targetUserEmail,omitempty"`
+	Percent         int64      `json:"percent"`
+}
+
+func GetForwardRules(w http.ResponseWriter, _ *http.Request, user *db.UserDetail) {
+	rules, err := db.FindForwardRulesByUserId(user.Id)
+	if err != nil {
+		slog.Error("Could not find forward rules",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, ForwardRuleError)
+		return
+	}
+	if rules == nil {
+		rules = []db.ForwardRule{}
+	}
+	util.WriteJson(w, rules)
+}
+
+func AddForwardRule(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
+	var req ForwardRuleRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		slog.Error("Error while decoding body",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, GenericErrorMessage)
+		return
+	}
+
+	fr := db.ForwardRule{
+		Id:           uuid.New(),
+		UserId:       user.Id,
+		TargetRepoId: req.TargetRepoId,
+		Percent:      req.Percent,
+		CreatedAt:    util.TimeNow(),
+	}
+
+	if req.TargetUserEmail != nil {
+		target, err := db.FindUserByEmail(*req.TargetUserEmail)
+		if err != nil {
+			slog.Error("Could not find forward target user",
+				slog.Any("error", err))
+			util.WriteErrorf(w, http.StatusInternalServerError, ForwardRuleError)
+			return
+		}
+		if target == nil {
+			util.WriteErrorf(w, http.StatusBadRequest, "Invalid forward rule: user not found")
+			return
+		}
+		fr.TargetUserId = &target.Id
+	}
+
+	if fr.TargetRepoId != nil {
+		repo, err := db.FindRepoById(*fr.TargetRepoId)
+		if err != nil {
+			slog.Error("Could not find forward target repo",
+				slog.Any("error", err))
+			util.WriteErrorf(w, http.StatusInternalServerError, ForwardRuleError)
+			return
+		}
+		if repo == nil {
+			util.WriteErrorf(w, http.StatusBadRequest, "Invalid forward rule: repository not found")
+			return
+		}
+	}
+
+	rules, err := db.FindAllForwardRules()
+	if err != nil {
+		slog.Error("Could not find forward rules",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, ForwardRuleError)
+		return
+	}
+
+	err = validateForwardRule(fr, rules)
+	if err != nil {
+		slog.Error("Invalid forward rule",
+			slog.String("userId", user.Id.String()),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, "Invalid forward rule: %v", err)
+		return
+	}
+
+	err = db.InsertForwardRule(fr)
+	if err != nil {
+		slog.Error("Could not save forward rule",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, ForwardRuleError)
+		return
+	}
+	util.WriteJson(w, fr)
+}
+
+func DeleteForwardRule(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
+	idStr := r.PathValue("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		slog.Error("Not a valid id",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, GenericErrorMessage)
+		return
+	}
+
+	nr, err := db.DeleteForwardRule(id, user.Id)
+	if err != nil {
+		slog.Error("Could not delete forward rule",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, ForwardRuleError)
+		return
+	}
+	if nr == 0 {
+		util.WriteErrorf(w, http.StatusNotFound, ForwardRuleError)
+		return
+	}
+}
+
+// validateForwardRule checks the new rule against the existing rules of all users. A user cannot
+// forward more than 100% in total, and forwarding between users must not end in a cycle. Cycles over
+// the contributors of a repo can only be detected when the money is forwarded.
+func validateForwardRule(fr db.ForwardRule, rules map[uuid.UUID][]db.ForwardRule) error {
+	if (fr.TargetRepoId == nil) == (fr.TargetUserId == nil) {
+		return fmt.Errorf("either a repository or a user is needed as target")
+	}
+	if fr.Percent <= 0 || fr.Percent > db.MaxForwardPercent {
+		return fmt.Errorf("percent must be between 1 and %v", db.MaxForwardPercent)
+	}
+
+	sum := fr.Percent
+	for _, r := range rules[fr.UserId] {
+		sum += r.Percent
+	}
+	if sum > db.MaxForwardPercent {
+		return fmt.Errorf("forwarding %v%% in total, max is %v%%", sum, db.MaxForwardPercent)
+	}
+
+	if fr.TargetUserId == nil {
+		return nil
+	}
+	if *fr.TargetUserId == fr.UserId {
+		return fmt.Errorf("cannot forward to yourself")
+	}
+
+	//follow the user targets, if we reach the user again, this rule would close a cycle
+	visited := map[uuid.UUID]bool{}
+	next := []uuid.UUID{*fr.TargetUserId}
+	for len(next) > 0 {
+		uid := next[0]
+		next = next[1:]
+		if uid == fr.UserId {
+			return fmt.Errorf("forwarding to this user creates a cycle")
+		}
+		if visited[uid] {
+			continue
+		}
+		visited[uid] = true
+		for _, r := range rules[uid] {
+			if r.TargetUserId != nil {
+				next = append(next, *r.TargetUserId)
+			}
+		}
+	}
+	return nil
+}
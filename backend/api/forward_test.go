@@ -0,0 +1,32 @@
+package api
+
+import (
+	"backend/db"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateForwardRule(t *testing.T) {
+	u1, u2, u3 := uuid.New(), uuid.New(), uuid.New()
+	repo := uuid.New()
+
+	rules := map[uuid.UUID][]db.ForwardRule{
+		u2: {{UserId: u2, TargetUserId: &u3, Percent: 50}},
+		u1: {{UserId: u1, TargetRepoId: &repo, Percent: 60}},
+	}
+
+	assert.NoError(t, validateForwardRule(db.ForwardRule{UserId: u1, TargetUserId: &u2, Percent: 40}, rules))
+	assert.NoError(t, validateForwardRule(db.ForwardRule{UserId: u3, TargetRepoId: &repo, Percent: 100}, rules))
+
+	//over 100% in total
+	assert.Error(t, validateForwardRule(db.ForwardRule{UserId: u1, TargetUserId: &u2, Percent: 50}, rules))
+	//no or two targets
+	assert.Error(t, validateForwardRule(db.ForwardRule{UserId: u3, Percent: 10}, rules))
+	assert.Error(t, validateForwardRule(db.ForwardRule{UserId: u3, TargetUserId: &u1, TargetRepoId: &repo, Percent: 10}, rules))
+	//to yourself
+	assert.Error(t, validateForwardRule(db.ForwardRule{UserId: u3, TargetUserId: &u3, Percent: 10}, rules))
+	//u3 -> u2 -> u3
+	assert.Error(t, validateForwardRule(db.ForwardRule{UserId: u3, TargetUserId: &u2, Percent: 10}, rules))
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"backend/db"
+	"backend/util"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	FundPolicyError = "Oops something went wrong with the fund policy. Please try again."
+)
+
+func FundPolicyEvents(w http.ResponseWriter, _ *http.Request, user *db.UserDetail) {
+	es, err := db.FindFundPolicyEventsBySponsor(user.Id)
+	if err != nil {
+		slog.Error("Could not find fund policy events",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, FundPolicyError)
+		return
+	}
+	util.WriteJson(w, es)
+}
+
+func UpdateFundPolicy(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
+	policyEsc := r.PathValue("policy")
+	policy, err := url.QueryUnescape(policyEsc)
+	if err != nil {
+		slog.Error("Query unescape fund policy",
+			slog.String("policy", policyEsc),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, FundPolicyError)
+		return
+	}
+
+	policy = strings.ToUpper(policy)
+	if !db.IsValidFundPolicy(policy) {
+		slog.Error("Unknown fund policy",
+			slog.String("policy", policy))
+		util.WriteErrorf(w, http.StatusBadRequest, "Unknown fund policy, use one of %v", db.FundPolicies)
+		return
+	}
+
+	err = db.UpdateFundPolicy(user.Id, &policy)
+	if err != nil {
+		slog.Error("Could not save fund policy",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, FundPolicyError)
+		return
+	}
+}
+
+func DeleteFundPolicy(w http.ResponseWriter, _ *http.Request, user *db.UserDetail) {
+	err := db.UpdateFundPolicy(user.Id, nil)
+	if err != nil {
+		slog.Error("Could not reset fund policy",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, FundPolicyError)
+		return
+	}
+}
@@ -47,6 +47,14 @@ func AnalysisEngineHook(w http.ResponseWriter, r *http.Request) {
 			slog.Any("error", errA))
 	}
 
+	if data.Error == nil {
+		errD := storeDependencies(data.RepoId, data.Dependencies)
+		if errD != nil {
+			slog.Warn("Could not store dependencies",
+				slog.Any("error", errD))
+		}
+	}
+
 	errHV := manageRepoHealthMetrics(data.Result, data.RepoId)
 	if errHV != nil {
 		slog.Warn("Update problem into trustValueMetrics",
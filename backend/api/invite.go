@@ -114,6 +114,49 @@ func ConfirmInvite(w http.ResponseWriter, r *http.Request, user *db.UserDetail)
 		util.WriteErrorf(w, http.StatusBadRequest, InviteConfirmError)
 		return
 	}
+
+	err = joinSponsorOrganization(sponsor, user)
+	if err != nil {
+		slog.Error("Cannot join organization of sponsor",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, InviteConfirmError)
+		return
+	}
+}
+
+// joinSponsorOrganization adds the invited user as member to the organization of the sponsor, which is
+// created if the sponsor is in none. If the sponsor is a plain member, the sponsor pays through the
+// invite as before, as only owners and billing members decide what the organization spends.
+func joinSponsorOrganization(sponsor *db.UserDetail, user *db.UserDetail) error {
+	m, err := db.FindOrganizationMember(sponsor.Id)
+	if err != nil {
+		return err
+	}
+	if m != nil && m.Role == db.OrgRoleMember {
+		return nil
+	}
+
+	var orgId uuid.UUID
+	if m != nil {
+		orgId = m.OrganizationId
+	} else {
+		name := sponsor.Email
+		if sponsor.Name != "" {
+			name = sponsor.Name
+		}
+		o := db.Organization{
+			Id:        uuid.New(),
+			Name:      name,
+			PayerId:   sponsor.Id,
+			CreatedAt: util.TimeNow(),
+		}
+		err = db.InsertOrganization(o)
+		if err != nil {
+			return err
+		}
+		orgId = o.Id
+	}
+	return db.InsertOrganizationMember(orgId, user.Id, db.OrgRoleMember, util.TimeNow())
 }
 
 func InviteOther(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
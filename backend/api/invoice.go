@@ -0,0 +1,273 @@
+package api
+
+import (
+	"backend/client"
+	"backend/db"
+	"backend/util"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	InvoiceError   = "Oops something went wrong with the invoice. Please try again."
+	BillingError   = "Oops something went wrong with the billing profile. Please try again."
+	InvoiceIssuer  = "FlatFeeStack"
+	maxCompanyLen  = 255
+	maxVatIdLen    = 32
+	maxAddressLen  = 1024
+	countryCodeLen = 2
+)
+
+func GetBillingProfile(w http.ResponseWriter, _ *http.Request, user *db.UserDetail) {
+	b, err := db.FindBillingProfile(user.Id)
+	if err != nil {
+		slog.Error("Could not find billing profile",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, BillingError)
+		return
+	}
+	util.WriteJson(w, b)
+}
+
+func UpdateBillingProfile(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
+	var b db.BillingProfile
+	err := json.NewDecoder(r.Body).Decode(&b)
+	if err != nil {
+		slog.Error("Could not decode json",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, BillingError)
+		return
+	}
+
+	b.Company = trimOrNil(b.Company)
+	b.VatId = trimOrNil(b.VatId)
+	b.Address = trimOrNil(b.Address)
+	b.Country = trimOrNil(b.Country)
+	if b.Country != nil {
+		c := strings.ToUpper(*b.Country)
+		b.Country = &c
+	}
+	if (b.Company != nil && len(*b.Company) > maxCompanyLen) || (b.VatId != nil && len(*b.VatId) > maxVatIdLen) ||
+		(b.Address != nil && len(*b.Address) > maxAddressLen) || (b.Country != nil && len(*b.Country) != countryCodeLen) {
+		slog.Error("Invalid billing profile",
+			slog.Any("profile", b))
+		util.WriteErrorf(w, http.StatusBadRequest, "Invalid billing profile, the country is a two letter code")
+		return
+	}
+
+	err = db.UpdateBillingProfile(user.Id, b)
+	if err != nil {
+		slog.Error("Could not save billing profile",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, BillingError)
+		return
+	}
+	util.WriteJson(w, b)
+}
+
+func Invoices(w http.ResponseWriter, _ *http.Request, user *db.UserDetail) {
+	invs, err := db.FindInvoicesByUserId(user.Id)
+	if err != nil {
+		slog.Error("Could not find invoices",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, InvoiceError)
+		return
+	}
+	util.WriteJson(w, invs)
+}
+
+// GetInvoice returns the invoice as json, html or pdf, depending on the format parameter
+func GetInvoice(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		slog.Error("Invalid invoice id",
+			slog.String("id", r.PathValue("id")),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, InvoiceError)
+		return
+	}
+	inv, err := db.FindInvoiceById(id)
+	if err != nil {
+		slog.Error("Could not find invoice",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, InvoiceError)
+		return
+	}
+	if inv == nil || inv.UserId == nil || *inv.UserId != user.Id {
+		util.WriteErrorf(w, http.StatusNotFound, InvoiceError)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	var b bytes.Buffer
+	contentType := ""
+	switch format {
+	case "", "json":
+		util.WriteJson(w, inv)
+		return
+	case "html":
+		contentType = "text/html; charset=utf-8"
+		err = writeInvoiceHtml(&b, inv)
+	case "pdf":
+		contentType = "application/pdf"
+		err = writeInvoicePdf(&b, inv)
+	default:
+		err = fmt.Errorf("unknown invoice format %v", format)
+	}
+	if err != nil {
+		slog.Error("Could not write invoice",
+			slog.String("format", format),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, InvoiceError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if format == "pdf" {
+		w.Header().Set("Content-Disposition", "attachment; filename=\""+invoiceFilename(inv)+"\"")
+	}
+	_, err = w.Write(b.Bytes())
+	if err != nil {
+		slog.Error("Could not send invoice",
+			slog.Any("error", err))
+	}
+}
+
+// invoiceAttachment issues the invoice of the pay-in and returns it as pdf attachment for the success email
+func invoiceAttachment(externalId uuid.UUID, feePrm int64) (*client.EmailAttachment, error) {
+	inv, err := db.CreateInvoice(externalId, feePrm, util.TimeNow())
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	err = writeInvoicePdf(&b, inv)
+	if err != nil {
+		return nil, err
+	}
+	return &client.EmailAttachment{
+		Filename: invoiceFilename(inv),
+		Type:     "application/pdf",
+		Content:  base64.StdEncoding.EncodeToString(b.Bytes()),
+	}, nil
+}
+
+func invoiceFilename(inv *db.Invoice) string {
+	return "invoice-" + inv.Nr + ".pdf"
+}
+
+func trimOrNil(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	t := strings.TrimSpace(*s)
+	if t == "" {
+		return nil
+	}
+	return &t
+}
+
+// invoiceView is what both the html and the pdf invoice show, with the amounts already formatted
+type invoiceView struct {
+	Issuer      string
+	Nr          string
+	Date        string
+	Email       string
+	Recipient   []string
+	VatId       string
+	Description string
+	Currency    string
+	Gross       string
+	Fee         string
+	FeePercent  string
+	Net         string
+}
+
+func newInvoiceView(inv *db.Invoice) invoiceView {
+	v := invoiceView{
+		Issuer:     InvoiceIssuer,
+		Nr:         inv.Nr,
+		Date:       inv.CreatedAt.Format(time.DateOnly),
+		Email:      inv.Email,
+		Currency:   inv.Currency,
+		Gross:      util.FormatAmount(inv.Gross, inv.Currency),
+		Fee:        util.FormatAmount(inv.Fee, inv.Currency),
+		FeePercent: fmt.Sprintf("%d.%d%%", inv.FeePrm/10, inv.FeePrm%10),
+		Net:        util.FormatAmount(inv.Net, inv.Currency),
+	}
+	if inv.Company != nil {
+		v.Recipient = append(v.Recipient, *inv.Company)
+	}
+	if inv.Address != nil {
+		v.Recipient = append(v.Recipient, strings.Split(*inv.Address, "\n")...)
+	}
+	if inv.Country != nil {
+		v.Recipient = append(v.Recipient, *inv.Country)
+	}
+	if inv.VatId != nil {
+		v.VatId = *inv.VatId
+	}
+
+	title := fmt.Sprintf("%d days", inv.Freq)
+	if plan := findPlan(inv.Freq); plan != nil {
+		title = plan.Title
+	}
+	v.Description = fmt.Sprintf("Sponsoring plan %s, %d seat(s)", title, inv.Seats)
+	return v
+}
+
+var invoiceTemplate = template.Must(template.New("invoice").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Invoice {{.Nr}}</title></head>
+<body>
+<h1>{{.Issuer}} invoice {{.Nr}}</h1>
+<p>Date: {{.Date}}</p>
+<p>{{range .Recipient}}{{.}}<br>{{end}}{{.Email}}</p>
+{{if .VatId}}<p>VAT ID: {{.VatId}}</p>{{end}}
+<table>
+<tr><th>Description</th><th>Currency</th><th>Amount</th></tr>
+<tr><td>{{.Description}}</td><td>{{.Currency}}</td><td>{{.Gross}}</td></tr>
+<tr><td>Payment and service fee ({{.FeePercent}}), included</td><td>{{.Currency}}</td><td>{{.Fee}}</td></tr>
+<tr><td>Sponsoring credited to your account</td><td>{{.Currency}}</td><td>{{.Net}}</td></tr>
+<tr><th>Total paid</th><th>{{.Currency}}</th><th>{{.Gross}}</th></tr>
+</table>
+</body>
+</html>
+`))
+
+func writeInvoiceHtml(w io.Writer, inv *db.Invoice) error {
+	return invoiceTemplate.Execute(w, newInvoiceView(inv))
+}
+
+func writeInvoicePdf(w io.Writer, inv *db.Invoice) error {
+	v := newInvoiceView(inv)
+	lines := []string{
+		"Invoice nr: " + v.Nr,
+		"Date:       " + v.Date,
+		"",
+	}
+	lines = append(lines, v.Recipient...)
+	lines = append(lines, v.Email)
+	if v.VatId != "" {
+		lines = append(lines, "VAT ID: "+v.VatId)
+	}
+	lines = append(lines,
+		"",
+		fmt.Sprintf("%-60.60s %-4s %20s", "Description", "Cur", "Amount"),
+		fmt.Sprintf("%-60.60s %-4s %20s", v.Description, v.Currency, v.Gross),
+		fmt.Sprintf("%-60.60s %-4s %20s", "Payment and service fee ("+v.FeePercent+"), included", v.Currency, v.Fee),
+		fmt.Sprintf("%-60.60s %-4s %20s", "Sponsoring credited to your account", v.Currency, v.Net),
+		"",
+		fmt.Sprintf("%-60.60s %-4s %20s", "Total paid", v.Currency, v.Gross),
+	)
+	return util.WritePdf(w, v.Issuer+" invoice "+v.Nr, lines)
+}
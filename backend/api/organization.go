@@ -0,0 +1,383 @@
+package api
+
+import (
+	"backend/db"
+	"backend/util"
+	"encoding/json"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	OrganizationError    = "Oops something went wrong with the organization. Please try again."
+	OrganizationNotFound = "You are not a member of an organization."
+	OrganizationDenied   = "Your role in the organization does not allow this."
+)
+
+type OrganizationRequest struct {
+	Name string `json:"name"`
+}
+
+type OrganizationMemberRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+// OrganizationView is the organization as a member sees it, the balance is shared by all members
+type OrganizationView struct {
+	db.Organization
+	Role    string                  `json:"role"`
+	Members []db.OrganizationMember `json:"members"`
+	Balance map[string]*big.Int     `json:"balance"`
+}
+
+type OrganizationReport struct {
+	Organization db.Organization       `json:"organization"`
+	Balance      map[string]*big.Int   `json:"balance"`
+	Repos        []db.OrganizationRepo `json:"repos"`
+}
+
+func CreateOrganization(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
+	var req OrganizationRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		slog.Error("Could not decode json",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, OrganizationError)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 255 {
+		util.WriteErrorf(w, http.StatusBadRequest, "The name of the organization is missing or too long.")
+		return
+	}
+
+	m, err := db.FindOrganizationMember(user.Id)
+	if err != nil {
+		slog.Error("Could not find organization member",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, OrganizationError)
+		return
+	}
+	if m != nil {
+		util.WriteErrorf(w, http.StatusConflict, "You are already a member of an organization.")
+		return
+	}
+
+	o := db.Organization{
+		Id:        uuid.New(),
+		Name:      req.Name,
+		PayerId:   user.Id,
+		CreatedAt: util.TimeNow(),
+	}
+	err = db.InsertOrganization(o)
+	if err != nil {
+		slog.Error("Could not insert organization",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, OrganizationError)
+		return
+	}
+	util.WriteJson(w, o)
+}
+
+func GetMyOrganization(w http.ResponseWriter, _ *http.Request, user *db.UserDetail) {
+	o, m, ok := findMyOrganization(w, user)
+	if !ok {
+		return
+	}
+	ms, err := db.FindOrganizationMembers(o.Id)
+	if err != nil {
+		slog.Error("Could not find organization members",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, OrganizationError)
+		return
+	}
+	balance, err := organizationBalance(o)
+	if err != nil {
+		slog.Error("Could not find organization balance",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, OrganizationError)
+		return
+	}
+	util.WriteJson(w, OrganizationView{Organization: *o, Role: m.Role, Members: ms, Balance: balance})
+}
+
+// AddOrganizationMember adds a registered user, only owners can add members
+func AddOrganizationMember(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
+	o, _, ok := findMyOrganization(w, user, db.OrgRoleOwner)
+	if !ok {
+		return
+	}
+	var req OrganizationMemberRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		slog.Error("Could not decode json",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, OrganizationError)
+		return
+	}
+	if req.Role == "" {
+		req.Role = db.OrgRoleMember
+	}
+	req.Role = strings.ToUpper(req.Role)
+	if !db.IsValidOrgRole(req.Role) {
+		util.WriteErrorf(w, http.StatusBadRequest, "Unknown role, use one of %v", db.OrgRoles)
+		return
+	}
+
+	u, err := db.FindUserByEmail(req.Email)
+	if err != nil {
+		slog.Error("Could not find user by email",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, OrganizationError)
+		return
+	}
+	if u == nil {
+		util.WriteErrorf(w, http.StatusNotFound, "There is no user with this email, please invite the user first.")
+		return
+	}
+
+	err = db.InsertOrganizationMember(o.Id, u.Id, req.Role, util.TimeNow())
+	if err != nil {
+		slog.Error("Could not add organization member",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusConflict, "The user owns another organization.")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// UpdateOrganizationMemberRole changes the role of a member, only owners can do this. The payer must stay
+// an owner or a billing member, and there must be an owner left.
+func UpdateOrganizationMemberRole(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
+	o, _, ok := findMyOrganization(w, user, db.OrgRoleOwner)
+	if !ok {
+		return
+	}
+	target, ok := findOrganizationTarget(w, r, o)
+	if !ok {
+		return
+	}
+	roleEsc := r.PathValue("role")
+	role, err := url.QueryUnescape(roleEsc)
+	if err != nil {
+		slog.Error("Query unescape role",
+			slog.String("role", roleEsc),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, OrganizationError)
+		return
+	}
+	role = strings.ToUpper(role)
+	if !db.IsValidOrgRole(role) {
+		util.WriteErrorf(w, http.StatusBadRequest, "Unknown role, use one of %v", db.OrgRoles)
+		return
+	}
+	if target.UserId == o.PayerId && role == db.OrgRoleMember {
+		util.WriteErrorf(w, http.StatusConflict, "The payer of the organization must be an owner or a billing member.")
+		return
+	}
+	if !keepsOwner(w, o, target, role) {
+		return
+	}
+
+	err = db.UpdateOrganizationMemberRole(o.Id, target.UserId, role)
+	if err != nil {
+		slog.Error("Could not update organization member",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, OrganizationError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// RemoveOrganizationMember removes a member, owners can remove anyone but the payer, members can leave
+func RemoveOrganizationMember(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
+	o, m, ok := findMyOrganization(w, user)
+	if !ok {
+		return
+	}
+	target, ok := findOrganizationTarget(w, r, o)
+	if !ok {
+		return
+	}
+	if target.UserId != user.Id && m.Role != db.OrgRoleOwner {
+		util.WriteErrorf(w, http.StatusForbidden, OrganizationDenied)
+		return
+	}
+	if target.UserId == o.PayerId {
+		util.WriteErrorf(w, http.StatusConflict, "The payer cannot leave the organization, choose another payer first.")
+		return
+	}
+	if !keepsOwner(w, o, target, "") {
+		return
+	}
+
+	err := db.DeleteOrganizationMember(o.Id, target.UserId)
+	if err != nil {
+		slog.Error("Could not delete organization member",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, OrganizationError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// UpdateOrganizationPayer chooses whose balance the organization spends, only owners can do this
+func UpdateOrganizationPayer(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
+	o, _, ok := findMyOrganization(w, user, db.OrgRoleOwner)
+	if !ok {
+		return
+	}
+	target, ok := findOrganizationTarget(w, r, o)
+	if !ok {
+		return
+	}
+	if target.Role == db.OrgRoleMember {
+		util.WriteErrorf(w, http.StatusConflict, "The payer of the organization must be an owner or a billing member.")
+		return
+	}
+
+	err := db.UpdateOrganizationPayer(o.Id, target.UserId)
+	if err != nil {
+		slog.Error("Could not update organization payer",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, OrganizationError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// GetOrganizationReport returns what the organization spent per repo, for owners and billing members
+func GetOrganizationReport(w http.ResponseWriter, _ *http.Request, user *db.UserDetail) {
+	o, _, ok := findMyOrganization(w, user, db.OrgRoleOwner, db.OrgRoleBilling)
+	if !ok {
+		return
+	}
+	repos, err := db.FindOrganizationRepos(o.Id, util.TimeNow())
+	if err != nil {
+		slog.Error("Could not find organization repos",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, OrganizationError)
+		return
+	}
+	balance, err := organizationBalance(o)
+	if err != nil {
+		slog.Error("Could not find organization balance",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, OrganizationError)
+		return
+	}
+	util.WriteJson(w, OrganizationReport{Organization: *o, Balance: balance, Repos: repos})
+}
+
+// findMyOrganization returns the organization of the user and writes the error if the user is in none,
+// or if the role of the user is not one of the given roles
+func findMyOrganization(w http.ResponseWriter, user *db.UserDetail, roles ...string) (*db.Organization, *db.OrganizationMember, bool) {
+	m, err := db.FindOrganizationMember(user.Id)
+	if err != nil {
+		slog.Error("Could not find organization member",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, OrganizationError)
+		return nil, nil, false
+	}
+	if m == nil {
+		util.WriteErrorf(w, http.StatusNotFound, OrganizationNotFound)
+		return nil, nil, false
+	}
+	if len(roles) > 0 {
+		allowed := false
+		for _, r := range roles {
+			allowed = allowed || m.Role == r
+		}
+		if !allowed {
+			util.WriteErrorf(w, http.StatusForbidden, OrganizationDenied)
+			return nil, nil, false
+		}
+	}
+	o, err := db.FindOrganizationById(m.OrganizationId)
+	if err != nil || o == nil {
+		slog.Error("Could not find organization",
+			slog.String("organizationId", m.OrganizationId.String()),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, OrganizationError)
+		return nil, nil, false
+	}
+	return o, m, true
+}
+
+func findOrganizationTarget(w http.ResponseWriter, r *http.Request, o *db.Organization) (*db.OrganizationMember, bool) {
+	userId, err := uuid.Parse(r.PathValue("userId"))
+	if err != nil {
+		slog.Error("Invalid user id",
+			slog.String("userId", r.PathValue("userId")),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, OrganizationError)
+		return nil, false
+	}
+	m, err := db.FindOrganizationMember(userId)
+	if err != nil {
+		slog.Error("Could not find organization member",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, OrganizationError)
+		return nil, false
+	}
+	if m == nil || m.OrganizationId != o.Id {
+		util.WriteErrorf(w, http.StatusNotFound, "The user is not a member of your organization.")
+		return nil, false
+	}
+	return m, true
+}
+
+// keepsOwner checks that an owner is left if the target gets the new role, an empty role removes the target
+func keepsOwner(w http.ResponseWriter, o *db.Organization, target *db.OrganizationMember, role string) bool {
+	if target.Role != db.OrgRoleOwner || role == db.OrgRoleOwner {
+		return true
+	}
+	ms, err := db.FindOrganizationMembers(o.Id)
+	if err != nil {
+		slog.Error("Could not find organization members",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, OrganizationError)
+		return false
+	}
+	for _, m := range ms {
+		if m.Role == db.OrgRoleOwner && m.UserId != target.UserId {
+			return true
+		}
+	}
+	util.WriteErrorf(w, http.StatusConflict, "The organization needs at least one owner.")
+	return false
+}
+
+// organizationBalance is what is left of the payer's balance, which all members spend
+func organizationBalance(o *db.Organization) (map[string]*big.Int, error) {
+	mAdd, err := db.FindPayInBalanceByCurrency(o.PayerId)
+	if err != nil {
+		return nil, err
+	}
+	mSub, err := db.FindSumDailySponsors(o.PayerId)
+	if err != nil {
+		return nil, err
+	}
+	mFut, err := db.FindSumFutureSponsors(o.PayerId)
+	if err != nil {
+		return nil, err
+	}
+	balance := map[string]*big.Int{}
+	for currency, b := range mAdd {
+		b = new(big.Int).Set(b)
+		if mSub[currency] != nil {
+			b.Sub(b, mSub[currency])
+		}
+		if mFut[currency] != nil {
+			b.Sub(b, mFut[currency])
+		}
+		balance[currency] = b
+	}
+	return balance, nil
+}
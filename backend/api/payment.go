@@ -4,7 +4,6 @@ import (
 	"backend/db"
 	"backend/config"
 	"backend/util"
-	"encoding/hex"
 	"encoding/json"
 	"log/slog"
 	"math/big"
@@ -13,11 +12,7 @@ import (
 	"strconv"
 	"time"
 
-	"github.com/ethereum/go-ethereum/accounts/abi"
-	"github.com/ethereum/go-ethereum/common/hexutil"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/google/uuid"
-	"github.com/nspcc-dev/neo-go/pkg/crypto/keys"
 )
 
 type PayoutInfoDTO struct {
@@ -35,10 +30,14 @@ type UserBalanceDto struct {
 }
 
 type UserBalances struct {
-	PaymentCycle db.PaymentCycle     `json:"paymentCycle"`
-	UserBalances []UserBalanceDto    `json:"userBalances"`
-	Total        map[string]*big.Int `json:"total"`
-	DaysLeft     int64               `json:"daysLeft"`
+	PaymentCycle    db.PaymentCycle      `json:"paymentCycle"`
+	UserBalances    []UserBalanceDto     `json:"userBalances"`
+	Total           map[string]*big.Int  `json:"total"`
+	DaysLeft        int64                `json:"daysLeft"`
+	DisplayCurrency string               `json:"displayCurrency,omitempty"`
+	DisplayTotal    *big.Int             `json:"displayTotal,omitempty"`
+	RunOut          map[string]time.Time `json:"runOut,omitempty"`
+	RunOutAt        *time.Time           `json:"runOutAt,omitempty"`
 }
 
 type TotalUserBalance struct {
@@ -125,7 +124,7 @@ func FakePayment(w http.ResponseWriter, r *http.Request, _ *db.UserDetail) {
 		return
 	}
 
-	err = db.PaymentSuccess(e, big.NewInt(1))
+	err = db.PaymentSuccess(e, big.NewInt(1), nil)
 	if err != nil {
 		slog.Error("Error with payment success",
 			slog.Any("error", err))
@@ -172,6 +171,9 @@ func StrategyDeductMax(userId uuid.UUID, balances map[string]*big.Int, subs map[
 
 func CancelSub(w http.ResponseWriter, _ *http.Request, user *db.UserDetail) {
 	err := db.UpdateSeatsFreq(user.Id, user.Seats, 0)
+	if err == nil {
+		err = db.CancelSubscription(user.Id, util.TimeNow())
+	}
 	if err != nil {
 		slog.Error("Could not cancel subscription",
 			slog.Any("error", err))
@@ -198,40 +200,6 @@ func StatusSponsoredUsers(w http.ResponseWriter, _ *http.Request, user *db.UserD
 	}
 }
 
-func (h *ResourceHandler) RequestPayout(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
-	targetCurrencyEsc := r.PathValue("targetCurrency")
-	targetCurrency, err := url.QueryUnescape(targetCurrencyEsc)
-	if err != nil {
-		slog.Error("Query unescape invite-by email",
-			slog.String("email", targetCurrencyEsc),
-			slog.Any("error", err))
-		util.WriteErrorf(w, http.StatusBadRequest, EmailEscapeError)
-		return
-	}
-
-	ownContributionIds, err := db.FindOwnContributionIds(user.Id, targetCurrency)
-	if err != nil {
-		slog.Error("Error while trying to retrieve own contribution ids",
-			slog.Any("error", err))
-		util.WriteErrorf(w, http.StatusBadRequest, PayoutError)
-		return
-	}
-
-	// notabene: For USDC, 10^6 units are one dollar
-	// See explorer https://etherscan.io/token/0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48
-	// FlatFeeStack already calculates in micro dollars
-	totalEarnedAmount, err := db.SumTotalEarnedAmountForContributionIds(ownContributionIds)
-	if err != nil {
-		slog.Error("Unable to retrieve already earned amount in target currency",
-			slog.Any("error", err))
-		util.WriteErrorf(w, http.StatusBadRequest, PayoutError)
-		return
-	}
-
-	signature, err := SignETH(h.Config.ETHPrivateKey, h.Config.ETHContractAddress, user.Id, totalEarnedAmount)
-	util.WriteJson(w, signature)
-}
-
 func PaymentEvent(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
 	payInEvents, err := db.FindPayInUser(user.Id)
 	if err != nil {
@@ -357,60 +325,3 @@ func calculateAndRespondBalances(w http.ResponseWriter, mAdd map[string]*db.Paym
 		return
 	}
 }
-
-func SignNeo(privateKeyHex string, userId uuid.UUID, amount *big.Int) (string, error) {
-	privateKey, err := keys.NewPrivateKeyFromWIF(privateKeyHex)
-	if err != nil {
-		return "", err
-	}
-
-	ownerIdBytes, _ := userId.MarshalBinary()
-	teaArray := amount.Bytes()
-	for i := 0; i < len(teaArray)/2; i++ {
-		opp := len(teaArray) - 1 - i
-		teaArray[i], teaArray[opp] = teaArray[opp], teaArray[i]
-	}
-	message := append(ownerIdBytes, teaArray...)
-	signature := privateKey.Sign(message)
-
-	return hex.EncodeToString(signature), nil
-}
-
-func SignETH(privateKeyHex string, contractAddress string, userId uuid.UUID, amount *big.Int) (string, error) {
-	var arguments abi.Arguments
-	arguments = append(arguments, abi.Argument{
-		Type: abi.Type{T: abi.AddressTy},
-	})
-	arguments = append(arguments, abi.Argument{
-		Type: abi.Type{T: abi.StringTy},
-	})
-	arguments = append(arguments, abi.Argument{
-		Type: abi.Type{T: abi.UintTy, Size: 256},
-	})
-	arguments = append(arguments, abi.Argument{
-		Type: abi.Type{T: abi.StringTy},
-	})
-	arguments = append(arguments, abi.Argument{
-		Type: abi.Type{T: abi.UintTy, Size: 256},
-	})
-
-	privateKey, err := crypto.HexToECDSA(privateKeyHex)
-	if err != nil {
-		return "", err
-	}
-
-	encodedUserId := [32]byte(crypto.Keccak256([]byte(userId.String())))
-	packed, err := arguments.Pack(contractAddress, "calculateWithdraw", encodedUserId, "#", amount)
-	hashRaw := crypto.Keccak256(packed)
-
-	// Add Ethereum Signed Message prefix to hash
-	prefix := []byte("\x19Ethereum Signed Message:\n32")
-	prefixedHash := crypto.Keccak256(append(prefix, hashRaw[:]...))
-
-	signature, err := crypto.Sign(prefixedHash[:], privateKey)
-	if err != nil {
-		return "", err
-	}
-
-	return hexutil.Encode(signature), nil
-}
@@ -0,0 +1,383 @@
+package api
+
+import (
+	"backend/client"
+	"backend/db"
+	"backend/util"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	BankError = "Oops something went wrong with the bank statements. Please try again."
+	// the references leave out I, L, O and U, so they are not misread when typed
+	bankReferenceChars = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	bankReferenceLen   = 10
+	bankLineMax        = 100
+)
+
+var bankReference = regexp.MustCompile("FF[0-9A-HJKMNP-TV-Z]{10}")
+
+// BankCredit is the event of a statement line that pays a bank transfer
+type BankCredit struct {
+	ExternalId uuid.UUID `json:"externalId"`
+	LineId     uuid.UUID `json:"lineId"`
+}
+
+// BankImport is the outcome of a statement import, the unmatched lines wait for review
+type BankImport struct {
+	Lines      int `json:"lines"`
+	Matched    int `json:"matched"`
+	Unmatched  int `json:"unmatched"`
+	Duplicates int `json:"duplicates"`
+}
+
+// PaymentBankHandler takes payments by bank transfer. The sponsor transfers the amount with the reference
+// of the payment, an admin imports the bank statements and the credits are matched to the payments.
+type PaymentBankHandler struct {
+	e             *client.EmailClient
+	sp            *SubscriptionPolicy
+	iban          string
+	bic           string
+	accountHolder string
+}
+
+func NewPaymentBankHandler(e *client.EmailClient, sp *SubscriptionPolicy, iban string, bic string, accountHolder string) *PaymentBankHandler {
+	return &PaymentBankHandler{e, sp, iban, bic, accountHolder}
+}
+
+func (b *PaymentBankHandler) Name() string {
+	return db.WebhookBank
+}
+
+// Checkout returns the account and a new reference, the sponsor needs to put it in the remittance
+// information of the transfer
+func (b *PaymentBankHandler) Checkout(user *db.UserDetail, request db.PayInEvent, _ *Plan, _ string) (*Checkout, error) {
+	reference, err := newBankReference()
+	if err != nil {
+		return nil, err
+	}
+	err = db.InsertBankTransfer(db.BankTransfer{
+		Reference:  reference,
+		ExternalId: request.ExternalId,
+		UserId:     user.Id,
+		Balance:    request.Balance,
+		Currency:   request.Currency,
+		CreatedAt:  request.CreatedAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Checkout{
+		ExternalId:    request.ExternalId,
+		PayAmount:     request.Balance,
+		PayCurrency:   request.Currency,
+		Reference:     reference,
+		Iban:          b.iban,
+		Bic:           b.bic,
+		AccountHolder: b.accountHolder,
+	}, nil
+}
+
+// Charge is not supported, a bank transfer is always made by the sponsor
+func (b *PaymentBankHandler) Charge(_ db.UserDetail, request db.PayInEvent, _ *Plan) error {
+	return fmt.Errorf("bank transfers cannot charge %v without the sponsor", request.ExternalId)
+}
+
+// ParseWebhook is not supported, the credits come from the imported bank statements
+func (b *PaymentBankHandler) ParseWebhook(_ *http.Request, _ []byte) (*WebhookDelivery, error) {
+	return nil, fmt.Errorf("bank transfers have no webhook")
+}
+
+// Refund is not supported, the transfer is paid back from the bank account
+func (b *PaymentBankHandler) Refund(externalId uuid.UUID, _ int64) error {
+	return fmt.Errorf("bank transfer %v needs to be paid back from the bank account", externalId)
+}
+
+// ProcessEvent books a matched statement line with the fee of the plan, like a card payment
+func (b *PaymentBankHandler) ProcessEvent(payload json.RawMessage, in *db.Inbox) error {
+	var c BankCredit
+	err := json.Unmarshal(payload, &c)
+	if err != nil {
+		return fmt.Errorf("could not parse bank credit: %w", err)
+	}
+
+	success, err := db.FindPayInExternal(c.ExternalId, db.PayInSuccess)
+	if err != nil {
+		return err
+	}
+	if success != nil {
+		slog.Info("Bank transfer was booked already",
+			slog.String("externalId", c.ExternalId.String()))
+		return nil
+	}
+
+	payInEvent, err := db.FindPayInExternal(c.ExternalId, db.PayInRequest)
+	if err != nil || payInEvent == nil {
+		return fmt.Errorf("payin %v does not exist: %v", c.ExternalId, err)
+	}
+	plan := findPlan(payInEvent.Freq)
+	if plan == nil {
+		return fmt.Errorf("no plan with freq %v", payInEvent.Freq)
+	}
+	return bookPaymentSuccess(b.e, b.sp, c.ExternalId, plan.FeePrm, in)
+}
+
+func newBankReference() (string, error) {
+	r := make([]byte, bankReferenceLen)
+	_, err := rand.Read(r)
+	if err != nil {
+		return "", err
+	}
+	for i := range r {
+		r[i] = bankReferenceChars[int(r[i])%len(bankReferenceChars)]
+	}
+	return "FF" + string(r), nil
+}
+
+// findBankTransfer returns the transfer of the reference in the remittance information, banks may break
+// the reference with spaces or dashes
+func findBankTransfer(remittance string) (*db.BankTransfer, error) {
+	s := strings.NewReplacer(" ", "", "-", "", "\n", "").Replace(strings.ToUpper(remittance))
+	for _, reference := range bankReference.FindAllString(s, -1) {
+		t, err := db.FindBankTransfer(reference)
+		if err != nil || t != nil {
+			return t, err
+		}
+	}
+	return nil, nil
+}
+
+// openBankTransfer returns true if the payment is neither booked nor matched to another line
+func openBankTransfer(externalId uuid.UUID) (bool, error) {
+	success, err := db.FindPayInExternal(externalId, db.PayInSuccess)
+	if err != nil || success != nil {
+		return false, err
+	}
+	matched, err := db.IsBankTransferMatched(externalId)
+	return !matched, err
+}
+
+// matchStatementLine matches the line to the open transfer with its reference and amount. A matched
+// line is booked by the webhook runner, so the booking is retried if it fails.
+func matchStatementLine(l db.BankStatementLine) (bool, error) {
+	t, err := findBankTransfer(l.Remittance)
+	if err != nil || t == nil {
+		return false, err
+	}
+	if l.Currency != t.Currency || l.Cents != util.UsdBaseToCent(t.Balance.Int64()) {
+		slog.Info("Bank transfer amount does not match",
+			slog.String("reference", t.Reference),
+			slog.Int64("cents", l.Cents),
+			slog.String("balance", t.Balance.String()))
+		return false, nil
+	}
+	open, err := openBankTransfer(t.ExternalId)
+	if err != nil || !open {
+		return false, err
+	}
+	return bookBankStatementLine(l.Id, t.ExternalId)
+}
+
+// bookBankStatementLine matches the line and stores the credit for the webhook runner in one transaction,
+// a line is never matched without being booked
+func bookBankStatementLine(id uuid.UUID, externalId uuid.UUID) (bool, error) {
+	payload, err := json.Marshal(BankCredit{ExternalId: externalId, LineId: id})
+	if err != nil {
+		return false, err
+	}
+	now := util.TimeNow()
+	return db.MatchBankStatementLine(id, externalId, db.WebhookEvent{
+		Id:            uuid.New(),
+		Provider:      db.WebhookBank,
+		EventId:       id.String(),
+		EventType:     "credit",
+		Payload:       payload,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}, now)
+}
+
+// ImportBankStatement imports the credits of a CAMT.053 or CSV statement and matches them to the open
+// bank transfers. A statement can be imported again, the lines imported before are skipped.
+func ImportBankStatement(w http.ResponseWriter, r *http.Request, _ *db.UserDetail) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.Error("Error reading request body",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, BankError)
+		return
+	}
+	ls, err := parseStatement(data)
+	if err != nil {
+		slog.Error("Could not parse bank statement",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, "Could not read the bank statement: %v", err)
+		return
+	}
+
+	bi := BankImport{Lines: len(ls)}
+	now := util.TimeNow()
+	for _, l := range ls {
+		l.Id = uuid.New()
+		l.CreatedAt = now
+		ok, err := db.InsertBankStatementLine(l)
+		if err != nil {
+			slog.Error("Could not insert bank statement line",
+				slog.String("lineId", l.LineId),
+				slog.Any("error", err))
+			util.WriteErrorf(w, http.StatusInternalServerError, BankError)
+			return
+		}
+		if !ok {
+			bi.Duplicates++
+			continue
+		}
+
+		ok, err = matchStatementLine(l)
+		if err != nil {
+			slog.Error("Could not match bank statement line",
+				slog.String("lineId", l.LineId),
+				slog.Any("error", err))
+		}
+		if ok {
+			bi.Matched++
+		} else {
+			bi.Unmatched++
+		}
+	}
+
+	slog.Info("Bank statement imported",
+		slog.Int("lines", bi.Lines),
+		slog.Int("matched", bi.Matched),
+		slog.Int("unmatched", bi.Unmatched),
+		slog.Int("duplicates", bi.Duplicates))
+	util.WriteJson(w, bi)
+}
+
+// BankStatementLines returns the latest statement lines, the unmatched ones by default, ?status= filters
+// them and ?limit= sets the number of lines
+func BankStatementLines(w http.ResponseWriter, r *http.Request, _ *db.UserDetail) {
+	status := db.BankLineUnmatched
+	if s, ok := r.URL.Query()["status"]; ok {
+		status = s[0]
+	}
+	if status != "" && status != db.BankLineMatched && status != db.BankLineUnmatched && status != db.BankLineIgnored {
+		slog.Error("Invalid status",
+			slog.String("status", status))
+		util.WriteErrorf(w, http.StatusBadRequest, BankError)
+		return
+	}
+	limit := bankLineMax
+	if l := r.URL.Query().Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit <= 0 || limit > bankLineMax {
+			slog.Error("Invalid limit",
+				slog.String("limit", l))
+			util.WriteErrorf(w, http.StatusBadRequest, BankError)
+			return
+		}
+	}
+
+	ls, err := db.FindBankStatementLines(status, limit)
+	if err != nil {
+		slog.Error("Could not find bank statement lines",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, BankError)
+		return
+	}
+	util.WriteJson(w, ls)
+}
+
+// MatchBankStatementLine matches an unmatched line to an open bank transfer by hand, e.g. if the sponsor
+// forgot the reference or paid in another currency. The whole transfer is booked.
+func MatchBankStatementLine(w http.ResponseWriter, r *http.Request, _ *db.UserDetail) {
+	l := findUnmatchedLine(w, r)
+	if l == nil {
+		return
+	}
+	externalId, err := uuid.Parse(r.PathValue("externalId"))
+	if err != nil {
+		slog.Error("Invalid external id",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, BankError)
+		return
+	}
+
+	request, err := db.FindPayInExternal(externalId, db.PayInRequest)
+	if err != nil || request == nil {
+		slog.Error("Payin does not exist",
+			slog.String("externalId", externalId.String()),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusNotFound, "Payment not found.")
+		return
+	}
+	open, err := openBankTransfer(externalId)
+	if err == nil && open {
+		open, err = bookBankStatementLine(l.Id, externalId)
+	}
+	if err != nil {
+		slog.Error("Could not match bank statement line",
+			slog.String("id", l.Id.String()),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, BankError)
+		return
+	}
+	if !open {
+		util.WriteErrorf(w, http.StatusConflict, "The payment is paid already.")
+		return
+	}
+}
+
+// IgnoreBankStatementLine removes a line from the review queue without booking it
+func IgnoreBankStatementLine(w http.ResponseWriter, r *http.Request, _ *db.UserDetail) {
+	l := findUnmatchedLine(w, r)
+	if l == nil {
+		return
+	}
+	_, err := db.IgnoreBankStatementLine(l.Id, util.TimeNow())
+	if err != nil {
+		slog.Error("Could not ignore bank statement line",
+			slog.String("id", l.Id.String()),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, BankError)
+		return
+	}
+}
+
+func findUnmatchedLine(w http.ResponseWriter, r *http.Request) *db.BankStatementLine {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		slog.Error("Invalid bank statement line id",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, BankError)
+		return nil
+	}
+	l, err := db.FindBankStatementLine(id)
+	if err != nil {
+		slog.Error("Could not find bank statement line",
+			slog.String("id", id.String()),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, BankError)
+		return nil
+	}
+	if l == nil {
+		util.WriteErrorf(w, http.StatusNotFound, "Bank statement line not found.")
+		return nil
+	}
+	if l.Status != db.BankLineUnmatched {
+		util.WriteErrorf(w, http.StatusConflict, "Only unmatched lines can be resolved.")
+		return nil
+	}
+	return l
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"backend/client"
+	"backend/db"
+	"backend/util"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+const (
+	MockSucceeded = "succeeded"
+	MockAction    = "action"
+	MockFailed    = "failed"
+	MockRefunded  = "refunded"
+	MockDisputed  = "disputed"
+)
+
+var MockEventTypes = []string{MockSucceeded, MockAction, MockFailed, MockRefunded, MockDisputed}
+
+// MockEvent is the webhook of the mock provider, cents is the refunded or disputed amount in total, as
+// stripe reports it
+type MockEvent struct {
+	Id         string    `json:"id"`
+	Type       string    `json:"type"`
+	ExternalId uuid.UUID `json:"externalId"`
+	Cents      int64     `json:"cents,omitempty"`
+}
+
+// PaymentMockHandler is a provider that takes no money, so the pay-in flow runs locally without stripe
+// or NOWPayments. The outcome of a payment is simulated, its webhook is processed like any other.
+type PaymentMockHandler struct {
+	e  *client.EmailClient
+	sp *SubscriptionPolicy
+	cp *ChargebackPolicy
+}
+
+func NewPaymentMockHandler(e *client.EmailClient, sp *SubscriptionPolicy, cp *ChargebackPolicy) *PaymentMockHandler {
+	return &PaymentMockHandler{e, sp, cp}
+}
+
+func (m *PaymentMockHandler) Name() string {
+	return db.WebhookMock
+}
+
+// Checkout returns a fake client secret, the payment stays requested until its outcome is simulated
+func (m *PaymentMockHandler) Checkout(_ *db.UserDetail, request db.PayInEvent, _ *Plan, _ string) (*Checkout, error) {
+	return &Checkout{ExternalId: request.ExternalId, ClientSecret: "mock_" + request.ExternalId.String()}, nil
+}
+
+// Charge always succeeds, the webhook of the payment is delivered right away
+func (m *PaymentMockHandler) Charge(_ db.UserDetail, request db.PayInEvent, _ *Plan) error {
+	return m.simulate(MockEvent{Type: MockSucceeded, ExternalId: request.ExternalId})
+}
+
+// ParseWebhook accepts unsigned events, the mock is only routed in local and dev deployments
+func (m *PaymentMockHandler) ParseWebhook(_ *http.Request, body []byte) (*WebhookDelivery, error) {
+	var me MockEvent
+	err := json.Unmarshal(body, &me)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse mock event: %w", err)
+	}
+	if me.Id == "" || me.ExternalId == uuid.Nil {
+		return nil, fmt.Errorf("mock event needs an id and an externalId")
+	}
+	return &WebhookDelivery{EventId: me.Id, EventType: me.Type, Payload: body}, nil
+}
+
+// Refund reports the cents as refunded total, a second partial refund needs to add the first one
+func (m *PaymentMockHandler) Refund(externalId uuid.UUID, cents int64) error {
+	return m.simulate(MockEvent{Type: MockRefunded, ExternalId: externalId, Cents: cents})
+}
+
+// ProcessEvent books a mock event of the webhook inbox the way stripe events are booked
+func (m *PaymentMockHandler) ProcessEvent(payload json.RawMessage, in *db.Inbox) error {
+	var me MockEvent
+	err := json.Unmarshal(payload, &me)
+	if err != nil {
+		return fmt.Errorf("could not parse mock event: %w", err)
+	}
+
+	switch me.Type {
+	case MockSucceeded:
+		payInEvent, err := db.FindPayInExternal(me.ExternalId, db.PayInRequest)
+		if err != nil || payInEvent == nil {
+			return fmt.Errorf("payin %v does not exist: %v", me.ExternalId, err)
+		}
+		plan := findPlan(payInEvent.Freq)
+		if plan == nil {
+			return fmt.Errorf("no plan with freq %v", payInEvent.Freq)
+		}
+		return bookPaymentSuccess(m.e, m.sp, me.ExternalId, plan.FeePrm, in)
+	case MockAction:
+		payInEvent, err := bookPaymentStatus(me.ExternalId, db.PayInAction, in)
+		if err != nil {
+			return err
+		}
+		m.e.SendStripeAction(payInEvent.UserId, me.ExternalId)
+	case MockFailed:
+		payInEvent, err := bookPaymentStatus(me.ExternalId, db.PayInMethod, in)
+		if err != nil {
+			return err
+		}
+		paymentFailed(m.e, m.sp, payInEvent.UserId, me.ExternalId)
+	case MockRefunded:
+		return reverse(m.e, m.cp, me.ExternalId, db.ChargebackRefund, me.Cents, in)
+	case MockDisputed:
+		return reverse(m.e, m.cp, me.ExternalId, db.ChargebackDispute, me.Cents, in)
+	default:
+		slog.Error("Unhandled event type",
+			slog.String("type", me.Type))
+	}
+	return nil
+}
+
+func (m *PaymentMockHandler) simulate(me MockEvent) error {
+	me.Id = "mock_" + uuid.NewString()
+	payload, err := json.Marshal(me)
+	if err != nil {
+		return err
+	}
+	return storeWebhookEvent(m.Name(), me.Id, me.Type, payload)
+}
+
+// Simulate delivers the webhook of an outcome of a mock payment of the user, e.g.
+// /users/me/mock/{externalId}/succeeded, ?cents= sets the refunded or disputed amount
+func (m *PaymentMockHandler) Simulate(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
+	externalId, err := uuid.Parse(r.PathValue("externalId"))
+	if err != nil {
+		slog.Error("Invalid external id",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, GenericErrorMessage)
+		return
+	}
+	outcome := r.PathValue("outcome")
+	if !slices.Contains(MockEventTypes, outcome) {
+		util.WriteErrorf(w, http.StatusBadRequest, "Unknown outcome %v.", outcome)
+		return
+	}
+
+	request, err := db.FindPayInExternal(externalId, db.PayInRequest)
+	if err != nil || request == nil || request.UserId != user.Id {
+		slog.Error("Payin does not exist",
+			slog.String("externalId", externalId.String()),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusNotFound, "Payment not found.")
+		return
+	}
+
+	cents := util.UsdBaseToCent(request.Balance.Int64())
+	if c := r.URL.Query().Get("cents"); c != "" {
+		cents, err = strconv.ParseInt(c, 10, 64)
+		if err != nil || cents <= 0 {
+			util.WriteErrorf(w, http.StatusBadRequest, "Invalid amount.")
+			return
+		}
+	}
+
+	err = m.simulate(MockEvent{Type: outcome, ExternalId: externalId, Cents: cents})
+	if err != nil {
+		slog.Error("Could not simulate mock payment",
+			slog.String("externalId", externalId.String()),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, GenericErrorMessage)
+		return
+	}
+}
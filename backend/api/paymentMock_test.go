@@ -0,0 +1,91 @@
+package api
+
+import (
+	"backend/client"
+	"backend/db"
+	"backend/util"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	m = NewPaymentMockHandler(client.NewEmailClient("", "", "", "", "", "", ""), NewSubscriptionPolicy("1,3,5", 7), NewChargebackPolicy(db.ClawbackParked, nil))
+)
+
+func TestMockParseWebhook(t *testing.T) {
+	_, err := m.ParseWebhook(nil, []byte(`{"type":"succeeded"}`))
+	assert.NotNil(t, err)
+
+	e := uuid.New()
+	d, err := m.ParseWebhook(nil, []byte(`{"id":"mock_1","type":"succeeded","externalId":"`+e.String()+`"}`))
+	require.Nil(t, err)
+	assert.Equal(t, "mock_1", d.EventId)
+	assert.Equal(t, MockSucceeded, d.EventType)
+}
+
+func TestMockChargeAndRefund(t *testing.T) {
+	db.SetupTestData()
+	defer db.TeardownTestData()
+
+	userDetail := insertTestUser(t, "hello@world.com")
+	payInEvent := insertPayInEvent(t, uuid.New(), userDetail.Id, db.PayInRequest, "USD", Plans[1].PriceBase, 1, Plans[1].Freq)
+	require.Nil(t, m.Charge(*userDetail, *payInEvent, &Plans[1]))
+	processMockInbox(t)
+
+	successPayIn, err := db.FindPayInExternal(payInEvent.ExternalId, db.PayInSuccess)
+	require.Nil(t, err)
+	require.NotNil(t, successPayIn)
+	feePayIn, err := db.FindPayInExternal(payInEvent.ExternalId, db.PayInFee)
+	require.Nil(t, err)
+	assert.NotNil(t, feePayIn)
+
+	pp := NewPaymentProviders(m)
+	r, _ := http.NewRequest(http.MethodPost, "/admin/payments/mock/"+payInEvent.ExternalId.String()+"/refund", nil)
+	r.SetPathValue("provider", "mock")
+	r.SetPathValue("externalId", payInEvent.ExternalId.String())
+	response := httptest.NewRecorder()
+	pp.Refund(response, r, nil)
+	assert.Equal(t, 200, response.Code)
+	processMockInbox(t)
+
+	refundPayIn, err := db.FindPayInExternal(payInEvent.ExternalId, db.PayInRefund)
+	require.Nil(t, err)
+	require.NotNil(t, refundPayIn)
+	assert.Equal(t, successPayIn.Balance.Int64(), -refundPayIn.Balance.Int64())
+}
+
+func TestMockSimulateOtherUser(t *testing.T) {
+	db.SetupTestData()
+	defer db.TeardownTestData()
+
+	userDetail := insertTestUser(t, "hello@world.com")
+	other := insertTestUser(t, "other@world.com")
+	payInEvent := insertPayInEvent(t, uuid.New(), userDetail.Id, db.PayInRequest, "USD", Plans[1].PriceBase, 1, Plans[1].Freq)
+
+	r, _ := http.NewRequest(http.MethodPost, "/users/me/mock/"+payInEvent.ExternalId.String()+"/succeeded", bytes.NewReader(nil))
+	r.SetPathValue("externalId", payInEvent.ExternalId.String())
+	r.SetPathValue("outcome", MockSucceeded)
+	response := httptest.NewRecorder()
+	m.Simulate(response, r, other)
+	assert.Equal(t, 404, response.Code)
+
+	es, err := db.FindWebhookEvents("", 10)
+	require.Nil(t, err)
+	assert.Len(t, es, 0)
+}
+
+// processMockInbox processes the stored events as the webhook runner does
+func processMockInbox(t *testing.T) {
+	es, err := db.FindDueWebhookEvents(util.TimeNow(), 100)
+	require.Nil(t, err)
+	for _, e := range es {
+		require.Nil(t, m.ProcessEvent(e.Payload, nil))
+		require.Nil(t, db.WebhookEventProcessed(e.Id, util.TimeNow()))
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"backend/client"
 	"backend/db"
 	"backend/util"
-	"bytes"
 	"crypto/hmac"
 	"crypto/sha512"
 	"encoding/hex"
@@ -77,68 +76,55 @@ func NewPaymentNowHandler(e *client.EmailClient, nowpaymentsApiUrl0 string, nowp
 		nowpaymentsIpnKey0}
 }
 
-func NowPayment(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
-	freq, seats, plan, err := paymentInformation(r)
-	if err != nil {
-		slog.Error("Cannot get payment information for now payments",
-			slog.Any("error", err))
-		util.WriteErrorf(w, http.StatusInternalServerError, "Oops something went wrong with retrieving the payment information. Please try again.")
-		return
-	}
-
-	var data map[string]string
-	err = json.NewDecoder(r.Body).Decode(&data)
-
-	e := uuid.New()
-	payInEvent := db.PayInEvent{
-		Id:         uuid.New(),
-		ExternalId: e,
-		UserId:     user.Id,
-		Balance:    big.NewInt(plan.PriceBase * seats),
-		Currency:   "USD",
-		Status:     db.PayInRequest,
-		Seats:      seats,
-		Freq:       freq,
-		CreatedAt:  util.TimeNow(),
-	}
+func (p *PaymentNowHandler) Name() string {
+	return db.WebhookNow
+}
 
-	err = db.InsertPayInEvent(payInEvent)
+// Checkout creates the crypto payment of the request, the sponsor sends the amount to the address
+func (p *PaymentNowHandler) Checkout(user *db.UserDetail, request db.PayInEvent, plan *Plan, payCurrency string) (*Checkout, error) {
+	price := plan.Price * float64(request.Seats)
+	paymentResponse, err := createNowPayment(price, payCurrency, &request.ExternalId, &user.Id)
 	if err != nil {
-		slog.Error("Cannot insert payment",
-			slog.String("userId", user.Id.String()),
-			slog.Any("error", err))
-		w.WriteHeader(http.StatusBadRequest)
-		return
+		return nil, err
 	}
 
-	price := plan.Price * float64(seats)
-
-	payCurrency := data["currency"]
-	paymentResponse, err := createNowPayment(price, payCurrency, &e, &user.Id)
-
+	amount, err := minCrypto(paymentResponse.PayCurrency, paymentResponse.PayAmount)
 	if err != nil {
-		slog.Error("could not create payment",
-			slog.Any("error", err))
-		util.WriteErrorf(w, http.StatusInternalServerError, "Oops something went wrong with creating the payment. Please try again.")
-		return
+		return nil, fmt.Errorf("could not convert pay amount of %v: %w", paymentResponse.PayCurrency, err)
+	}
+
+	now := util.TimeNow()
+	err = db.InsertCryptoPayment(db.CryptoPayment{
+		ExternalId:   request.ExternalId,
+		UserId:       user.Id,
+		PaymentId:    paymentResponse.PaymentId,
+		PayAddress:   paymentResponse.PayAddress,
+		PayCurrency:  paymentResponse.PayCurrency,
+		PayAmount:    amount,
+		ActuallyPaid: big.NewInt(0),
+		UpdatedAt:    now,
+		CreatedAt:    now,
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	amount, err := minCrypto(paymentResponse.PayCurrency, paymentResponse.PayAmount)
-
-	paymentResponse2 := PaymentResponse2{
+	return &Checkout{
+		ExternalId:  request.ExternalId,
 		PayAddress:  paymentResponse.PayAddress,
 		PayAmount:   amount,
 		PayCurrency: paymentResponse.PayCurrency,
-	}
+	}, nil
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(paymentResponse2)
-	if err != nil {
-		slog.Error("Could not encode json",
-			slog.Any("error", err))
-		util.WriteErrorf(w, http.StatusInternalServerError, GenericErrorMessage)
-		return
-	}
+// Charge is not supported, a crypto payment is always sent by the sponsor
+func (p *PaymentNowHandler) Charge(_ db.UserDetail, request db.PayInEvent, _ *Plan) error {
+	return fmt.Errorf("nowpayments cannot charge %v without the sponsor", request.ExternalId)
+}
+
+// Refund is not supported, NOWPayments refunds are made in their dashboard and reported as refunded
+func (p *PaymentNowHandler) Refund(externalId uuid.UUID, _ int64) error {
+	return fmt.Errorf("nowpayments cannot refund %v, use the dashboard", externalId)
 }
 
 func createNowPayment(price float64, payCurrency string, externId *uuid.UUID, uid *uuid.UUID) (*PaymentResponse, error) {
@@ -203,89 +189,144 @@ func createNowPayment(price float64, payCurrency string, externId *uuid.UUID, ui
 	return data, nil
 }
 
-func (p *PaymentNowHandler) NowWebhook(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(r.Body)
+// ParseWebhook verifies the signature of the notification. NOWPayments has no event id, a notification
+// is identified by the payment, its status and the amount paid so far.
+func (p *PaymentNowHandler) ParseWebhook(r *http.Request, body []byte) (*WebhookDelivery, error) {
+	err := verifyNowWebhook(body, r.Header.Get("x-nowpayments-sig"))
 	if err != nil {
-		slog.Error("Could not read body",
-			slog.Any("error", err))
-		util.WriteErrorf(w, http.StatusInternalServerError, GenericErrorMessage)
-		return
+		return nil, err
 	}
 
-	r.Body = io.NopCloser(bytes.NewBuffer(body))
-	nowSignature := r.Header.Get("x-nowpayments-sig")
-	err = verifyNowWebhook(body, nowSignature)
+	var data client.WebhookResponse
+	err = json.Unmarshal(body, &data)
 	if err != nil {
-		slog.Error("Wrong signature",
-			slog.Any("error", err))
-		util.WriteErrorf(w, http.StatusInternalServerError, GenericErrorMessage)
-		return
+		return nil, fmt.Errorf("could not parse webhook data: %w", err)
 	}
 
+	eventId := fmt.Sprintf("%d-%s-%v", data.PaymentId, data.PaymentStatus, data.ActuallyPaid)
+	return &WebhookDelivery{EventId: eventId, EventType: data.PaymentStatus, Payload: body}, nil
+}
+
+// ProcessEvent books a NOWPayments notification of the webhook inbox, an error retries it later
+func (p *PaymentNowHandler) ProcessEvent(payload json.RawMessage, in *db.Inbox) error {
 	var data client.WebhookResponse
-	err = json.NewDecoder(r.Body).Decode(&data)
+	err := json.Unmarshal(payload, &data)
 	if err != nil {
-		slog.Error("Could not parse webhook data",
-			slog.Any("error", err))
-		util.WriteErrorf(w, http.StatusInternalServerError, GenericErrorMessage)
-		return
+		return fmt.Errorf("could not parse webhook data: %w", err)
 	}
 
 	if data.OrderId == nil {
-		slog.Error("No orderId set for WebhookResponse")
-		util.WriteErrorf(w, http.StatusInternalServerError, GenericErrorMessage)
-		return
+		return fmt.Errorf("no orderId set for WebhookResponse")
 	}
 
 	externalId := *data.OrderId
 	payInEvent, err := db.FindPayInExternal(externalId, db.PayInRequest)
-
-	if err != nil {
-		slog.Error("Error while finding pay in external",
-			slog.Any("error", err))
-		util.WriteErrorf(w, http.StatusInternalServerError, GenericErrorMessage)
-		return
+	if err != nil || payInEvent == nil {
+		return fmt.Errorf("payin %v does not exist: %v", externalId, err)
 	}
 
 	switch data.PaymentStatus {
 	case "finished":
-		err = db.PaymentSuccess(externalId, big.NewInt(0))
+		err = db.PaymentSuccess(externalId, big.NewInt(0), in)
 		if err != nil {
-			slog.Error("Could not process now payment success",
-				slog.Any("error", err))
-			util.WriteErrorf(w, http.StatusInternalServerError, GenericErrorMessage)
-			return
+			return fmt.Errorf("could not process now payment success: %w", err)
 		}
 		p.e.SendPaymentNowFinished(payInEvent.UserId, data)
 	case "partially_paid":
-		payInEvent.Id = uuid.New()
-		payInEvent.Status = db.PayInPartially
-		payInEvent.CreatedAt = util.TimeNow()
-		db.InsertPayInEvent(*payInEvent)
+		//what was paid so far is credited at its value, the rest can be paid to the same address
+		currency := strings.ToUpper(data.PayCurrency)
+		actuallyPaid, err := minCrypto(currency, data.ActuallyPaid)
+		if err != nil {
+			return fmt.Errorf("could not convert actually paid: %w", err)
+		}
+		payAmount, err := minCrypto(currency, data.PayAmount)
+		if err != nil {
+			return fmt.Errorf("could not convert pay amount: %w", err)
+		}
+		credited := nowCredited(payInEvent.Balance, actuallyPaid, payAmount)
+		ok, err := db.PaymentPartial(externalId, credited, actuallyPaid, util.TimeNow(), in)
+		if err != nil {
+			return fmt.Errorf("could not process now payment partially paid: %w", err)
+		}
+		if !ok {
+			return nil
+		}
 		p.e.SendPaymentNowPartially(payInEvent.UserId, data)
 	case "expired":
 		payInEvent.Id = uuid.New()
 		payInEvent.Status = db.PayInExpired
 		payInEvent.CreatedAt = util.TimeNow()
-		db.InsertPayInEvent(*payInEvent)
+		err = db.BookPayInEvent(*payInEvent, in)
+		if err != nil {
+			return fmt.Errorf("could not process now payment expired: %w", err)
+		}
 		p.e.SendPaymentNowRefunded(payInEvent.UserId, "expired", externalId)
 	case "failed":
 		payInEvent.Id = uuid.New()
 		payInEvent.Status = db.PayInFailed
 		payInEvent.CreatedAt = util.TimeNow()
-		db.InsertPayInEvent(*payInEvent)
+		err = db.BookPayInEvent(*payInEvent, in)
+		if err != nil {
+			return fmt.Errorf("could not process now payment failed: %w", err)
+		}
 		p.e.SendPaymentNowRefunded(payInEvent.UserId, "failed", externalId)
 	case "refunded":
 		payInEvent.Id = uuid.New()
 		payInEvent.Status = db.PayInRefunded
 		payInEvent.CreatedAt = util.TimeNow()
-		db.InsertPayInEvent(*payInEvent)
+		err = db.BookPayInEvent(*payInEvent, in)
+		if err != nil {
+			return fmt.Errorf("could not process now payment refunded: %w", err)
+		}
 		p.e.SendPaymentNowRefunded(payInEvent.UserId, "refunded", externalId)
 	default:
 		slog.Error("Unhandled event type",
 			slog.String("status", data.PaymentStatus))
-		w.WriteHeader(http.StatusOK)
 	}
+	return nil
+}
+
+// nowCredited is the value of the crypto paid so far, in the currency of the payment request
+func nowCredited(balance *big.Int, actuallyPaid *big.Int, payAmount *big.Int) *big.Int {
+	if payAmount.Sign() <= 0 || actuallyPaid.Cmp(payAmount) >= 0 {
+		return new(big.Int).Set(balance)
+	}
+	c := new(big.Int).Mul(balance, actuallyPaid)
+	return c.Div(c, payAmount)
+}
+
+// NowPaymentRemainder returns the address and the amount to complete a partially paid crypto payment
+func NowPaymentRemainder(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
+	externalId, err := uuid.Parse(r.PathValue("externalId"))
+	if err != nil {
+		slog.Error("Invalid external id",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, GenericErrorMessage)
+		return
+	}
+
+	c, err := db.FindCryptoPayment(externalId)
+	if err != nil {
+		slog.Error("Could not find crypto payment",
+			slog.String("externalId", externalId.String()),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, GenericErrorMessage)
+		return
+	}
+	if c == nil || c.UserId != user.Id {
+		util.WriteErrorf(w, http.StatusNotFound, "Payment not found.")
+		return
+	}
+
+	rest := new(big.Int).Sub(c.PayAmount, c.ActuallyPaid)
+	if rest.Sign() < 0 {
+		rest = big.NewInt(0)
+	}
+	util.WriteJson(w, PaymentResponse2{
+		PayAddress:  c.PayAddress,
+		PayAmount:   rest,
+		PayCurrency: c.PayCurrency,
+	})
 }
 
 func minCrypto(currency string, balance float64) (*big.Int, error) {
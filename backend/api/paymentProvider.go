@@ -0,0 +1,326 @@
+package api
+
+import (
+	"backend/client"
+	"backend/db"
+	"backend/util"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// PaymentProvider takes the payments of the sponsors. The adapters book the pay-in events the same way,
+// what differs is how a payment is started, charged, reported and refunded.
+type PaymentProvider interface {
+	// Name is the provider of the webhook events, e.g. STRIPE
+	Name() string
+	// Checkout starts the payment of the request, the sponsor completes it, e.g. with the card form or by
+	// sending crypto to the address
+	Checkout(user *db.UserDetail, request db.PayInEvent, plan *Plan, payCurrency string) (*Checkout, error)
+	// Charge pays the request with the saved payment method of the sponsor, without the sponsor
+	Charge(user db.UserDetail, request db.PayInEvent, plan *Plan) error
+	// ParseWebhook verifies a delivery and returns what is stored in the webhook inbox
+	ParseWebhook(r *http.Request, body []byte) (*WebhookDelivery, error)
+	// ProcessEvent books an event of the webhook inbox, an error retries it later. The booking marks the
+	// inbox event processed in its transaction, a nil inbox books without one.
+	ProcessEvent(payload json.RawMessage, in *db.Inbox) error
+	// Refund gives the amount in cents of the payment back, the provider reports it with a webhook
+	Refund(externalId uuid.UUID, cents int64) error
+}
+
+// Checkout is what the client needs to complete the payment, depending on the provider
+type Checkout struct {
+	ExternalId    uuid.UUID `json:"externalId"`
+	ClientSecret  string    `json:"clientSecret,omitempty"`
+	PayAddress    string    `json:"payAddress,omitempty"`
+	PayAmount     *big.Int  `json:"payAmount,omitempty"`
+	PayCurrency   string    `json:"payCurrency,omitempty"`
+	Reference     string    `json:"reference,omitempty"`
+	Iban          string    `json:"iban,omitempty"`
+	Bic           string    `json:"bic,omitempty"`
+	AccountHolder string    `json:"accountHolder,omitempty"`
+}
+
+// WebhookDelivery is a verified delivery of a provider, the event id identifies redeliveries
+type WebhookDelivery struct {
+	EventId   string
+	EventType string
+	Payload   []byte
+}
+
+// PaymentProviders are the providers of the deployment by name
+type PaymentProviders map[string]PaymentProvider
+
+func NewPaymentProviders(ps ...PaymentProvider) PaymentProviders {
+	pp := PaymentProviders{}
+	for _, p := range ps {
+		pp[p.Name()] = p
+	}
+	return pp
+}
+
+// newPayInRequest is the payment request of a plan, the providers report its outcome with the externalId
+func newPayInRequest(userId uuid.UUID, externalId uuid.UUID, plan *Plan, freq int64, seats int64) db.PayInEvent {
+	return db.PayInEvent{
+		Id:         uuid.New(),
+		ExternalId: externalId,
+		UserId:     userId,
+		Balance:    big.NewInt(plan.PriceBase * seats),
+		Currency:   "USD",
+		Status:     db.PayInRequest,
+		Seats:      seats,
+		Freq:       freq,
+		CreatedAt:  util.TimeNow(),
+	}
+}
+
+// Checkout starts a payment with the provider of the path, e.g. /users/me/payment/stripe/365/1
+func (pp PaymentProviders) Checkout(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
+	pp.CheckoutWith(strings.ToUpper(r.PathValue("provider")))(w, r, user)
+}
+
+// CheckoutWith starts a payment with the named provider, the body may set the currency to pay with
+func (pp PaymentProviders) CheckoutWith(name string) func(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
+	return func(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
+		p := pp[name]
+		if p == nil {
+			util.WriteErrorf(w, http.StatusNotFound, "Unknown payment provider.")
+			return
+		}
+
+		freq, seats, plan, err := paymentInformation(r)
+		if err != nil {
+			slog.Error("Cannot get payment information",
+				slog.String("provider", name),
+				slog.Any("error", err))
+			util.WriteErrorf(w, http.StatusInternalServerError, "Oops something went wrong with retrieving the payment information. Please try again.")
+			return
+		}
+
+		var data map[string]string
+		err = json.NewDecoder(r.Body).Decode(&data)
+		if err != nil && err != io.EOF {
+			slog.Error("Could not parse checkout",
+				slog.Any("error", err))
+			util.WriteErrorf(w, http.StatusBadRequest, GenericErrorMessage)
+			return
+		}
+
+		request := newPayInRequest(user.Id, uuid.New(), plan, freq, seats)
+		err = db.InsertPayInEvent(request)
+		if err != nil {
+			slog.Error("Cannot insert payment",
+				slog.String("userId", user.Id.String()),
+				slog.Any("error", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		c, err := p.Checkout(user, request, plan, data["currency"])
+		if err != nil {
+			slog.Error("Could not create payment",
+				slog.String("provider", name),
+				slog.Any("error", err))
+			util.WriteErrorf(w, http.StatusInternalServerError, "Oops something went wrong with creating the payment. Please try again.")
+			return
+		}
+		util.WriteJson(w, c)
+	}
+}
+
+// Charge renews the balance of the sponsor with the saved payment method, the request gets the
+// externalId so a subscription can be marked pending before the provider reports the outcome
+func Charge(p PaymentProvider, user db.UserDetail, externalId uuid.UUID) error {
+	_, seats, freq, _, err := db.FindLatestDailyPayment(user.Id, "USD")
+	if err != nil {
+		return err
+	}
+	plan := findPlan(freq)
+	if plan == nil {
+		return fmt.Errorf("no plan with freq %v", freq)
+	}
+
+	request := newPayInRequest(user.Id, externalId, plan, plan.Freq, seats)
+	err = db.InsertPayInEvent(request)
+	if err != nil {
+		return err
+	}
+	return p.Charge(user, request, plan)
+}
+
+// Webhook stores the verified deliveries of the named provider in the webhook inbox, they are processed
+// by the webhook runner
+func (pp PaymentProviders) Webhook(name string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := pp[name]
+		if p == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			slog.Error("Error reading request body",
+				slog.Any("error", err))
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		d, err := p.ParseWebhook(r, body)
+		if err != nil {
+			slog.Error("Error evaluating signed webhook request",
+				slog.String("provider", name),
+				slog.Any("error", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		err = storeWebhookEvent(name, d.EventId, d.EventType, d.Payload)
+		if err != nil {
+			slog.Error("Could not store webhook event",
+				slog.String("provider", name),
+				slog.String("eventId", d.EventId),
+				slog.Any("error", err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// ProcessEvent books an event of the webhook inbox with its provider
+func (pp PaymentProviders) ProcessEvent(name string, payload json.RawMessage, in *db.Inbox) error {
+	p := pp[name]
+	if p == nil {
+		return fmt.Errorf("unknown webhook provider %v", name)
+	}
+	return p.ProcessEvent(payload, in)
+}
+
+// Refund gives a payment back in full or in part, ?cents= sets the amount, the whole payment by default.
+// The provider reports the refund with a webhook, which books it as chargeback.
+func (pp PaymentProviders) Refund(w http.ResponseWriter, r *http.Request, _ *db.UserDetail) {
+	p := pp[strings.ToUpper(r.PathValue("provider"))]
+	if p == nil {
+		util.WriteErrorf(w, http.StatusNotFound, "Unknown payment provider.")
+		return
+	}
+	externalId, err := uuid.Parse(r.PathValue("externalId"))
+	if err != nil {
+		slog.Error("Invalid external id",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, GenericErrorMessage)
+		return
+	}
+
+	request, err := db.FindPayInExternal(externalId, db.PayInRequest)
+	if err != nil || request == nil {
+		slog.Error("Payin does not exist",
+			slog.String("externalId", externalId.String()),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusNotFound, "Payment not found.")
+		return
+	}
+
+	cents := util.UsdBaseToCent(request.Balance.Int64())
+	if c := r.URL.Query().Get("cents"); c != "" {
+		cents, err = strconv.ParseInt(c, 10, 64)
+		if err != nil || cents <= 0 {
+			util.WriteErrorf(w, http.StatusBadRequest, "Invalid amount.")
+			return
+		}
+	}
+
+	err = p.Refund(externalId, cents)
+	if err != nil {
+		slog.Error("Could not refund payment",
+			slog.String("externalId", externalId.String()),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, GenericErrorMessage)
+		return
+	}
+}
+
+// bookPaymentSuccess books the payment of the request minus the fee in promill, renews the subscription
+// and sends the invoice
+func bookPaymentSuccess(e *client.EmailClient, sp *SubscriptionPolicy, externalId uuid.UUID, feePrm int64, in *db.Inbox) error {
+	payInEvent, err := db.FindPayInExternal(externalId, db.PayInRequest)
+	if err != nil || payInEvent == nil {
+		return fmt.Errorf("payin %v does not exist: %v", externalId, err)
+	}
+
+	//Fee calculation
+	fee := new(big.Int).Mul(payInEvent.Balance, big.NewInt(feePrm))
+	fee = new(big.Int).Div(fee, big.NewInt(1000)) //we have promill
+	fee = new(big.Int).Add(fee, big.NewInt(1))    //round up
+
+	err = db.PaymentSuccess(externalId, fee, in)
+	if err != nil {
+		return fmt.Errorf("user sum balance cannot run for %v: %w", externalId, err)
+	}
+
+	//the payment is booked, neither the subscription nor a missing invoice must retry the event
+	err = subscriptionRenewed(sp, payInEvent.UserId, externalId)
+	if err != nil {
+		slog.Error("Could not renew subscription",
+			slog.String("externalId", externalId.String()), slog.Any("error", err))
+	}
+
+	invoice, err := invoiceAttachment(externalId, feePrm)
+	if err != nil {
+		slog.Error("Could not create invoice",
+			slog.String("externalId", externalId.String()), slog.Any("error", err))
+		e.SendStripeSuccess(payInEvent.UserId, externalId)
+	} else {
+		e.SendStripeSuccess(payInEvent.UserId, externalId, *invoice)
+	}
+	return nil
+}
+
+// bookPaymentStatus books that the payment of the request needs an action or a new payment method
+func bookPaymentStatus(externalId uuid.UUID, status string, in *db.Inbox) (*db.PayInEvent, error) {
+	payInEvent, err := db.FindPayInExternal(externalId, db.PayInRequest)
+	if err != nil || payInEvent == nil {
+		return nil, fmt.Errorf("payin %v does not exist: %v", externalId, err)
+	}
+
+	payInEvent.Id = uuid.New()
+	payInEvent.Status = status
+	payInEvent.CreatedAt = util.TimeNow()
+	err = db.BookPayInEvent(*payInEvent, in)
+	if err != nil {
+		return nil, fmt.Errorf("insert payin %v failed: %w", externalId, err)
+	}
+	return payInEvent, nil
+}
+
+// paymentFailed moves a pending renewal to the next dunning step, other payments just report the failure.
+// A renewal that failed already when it was charged is not reported twice.
+func paymentFailed(e *client.EmailClient, sp *SubscriptionPolicy, userId uuid.UUID, externalId uuid.UUID) {
+	s, err := db.FindSubscription(userId)
+	if err != nil {
+		slog.Error("Could not find subscription",
+			slog.String("externalId", externalId.String()), slog.Any("error", err))
+	}
+	if s == nil || s.ExternalId == nil || *s.ExternalId != externalId {
+		e.SendStripeFailed(userId, externalId)
+		return
+	}
+	if !s.Pending(externalId) {
+		return
+	}
+
+	u, err := db.FindUserById(userId)
+	if err == nil {
+		err = SubscriptionFailed(e, sp, *s, *u, util.TimeNow())
+	}
+	if err != nil {
+		slog.Error("Could not update subscription",
+			slog.String("externalId", externalId.String()), slog.Any("error", err))
+	}
+}
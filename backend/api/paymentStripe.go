@@ -6,7 +6,6 @@ import (
 	"backend/util"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log/slog"
 	"math/big"
 	"net/http"
@@ -16,6 +15,7 @@ import (
 	"github.com/stripe/stripe-go/v76"
 	"github.com/stripe/stripe-go/v76/customer"
 	"github.com/stripe/stripe-go/v76/paymentintent"
+	"github.com/stripe/stripe-go/v76/refund"
 	"github.com/stripe/stripe-go/v76/setupintent"
 	"github.com/stripe/stripe-go/v76/webhook"
 )
@@ -28,10 +28,17 @@ type PaymentStripeHandler struct {
 	e                      *client.EmailClient
 	stripeAPISecretKey     string
 	stripeWebhookSecretKey string
+	sp                     *SubscriptionPolicy
+	cp                     *ChargebackPolicy
 }
 
-func NewPaymentHandler(e *client.EmailClient, stripeAPISecretKey0 string, stripeWebhookSecretKey string) *PaymentStripeHandler {
-	return &PaymentStripeHandler{e, stripeAPISecretKey0, stripeWebhookSecretKey}
+// stripePaymentIntent looks up the payment intent of a charge or dispute whose metadata misses the externalId
+var stripePaymentIntent = func(id string) (*stripe.PaymentIntent, error) {
+	return paymentintent.Get(id, nil)
+}
+
+func NewPaymentHandler(e *client.EmailClient, stripeAPISecretKey0 string, stripeWebhookSecretKey string, sp *SubscriptionPolicy, cp *ChargebackPolicy) *PaymentStripeHandler {
+	return &PaymentStripeHandler{e, stripeAPISecretKey0, stripeWebhookSecretKey, sp, cp}
 }
 
 func (p *PaymentStripeHandler) SetupStripe(w http.ResponseWriter, _ *http.Request, user *db.UserDetail) {
@@ -81,218 +88,118 @@ func (p *PaymentStripeHandler) SetupStripe(w http.ResponseWriter, _ *http.Reques
 	}
 }
 
-func StripePaymentInitial(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
-	if user.PaymentMethod == nil {
-		slog.Error("No payment method defined for user",
-			slog.String("user", user.Id.String()))
-		util.WriteErrorf(w, http.StatusInternalServerError, "Oops something went wrong, no payment method set. Please try again.")
-		return
-	}
+func (p *PaymentStripeHandler) Name() string {
+	return db.WebhookStripe
+}
 
-	freq, seats, plan, err := paymentInformation(r)
-	if err != nil {
-		slog.Error("Cannot get payment informations for stripe payments",
-			slog.Any("error", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+// Checkout creates the payment intent of the request, the client confirms it with the card of the sponsor
+func (p *PaymentStripeHandler) Checkout(user *db.UserDetail, request db.PayInEvent, plan *Plan, _ string) (*Checkout, error) {
+	if user.PaymentMethod == nil {
+		return nil, fmt.Errorf("no payment method defined for user %v", user.Id)
 	}
 
-	cents := util.UsdBaseToCent(plan.PriceBase) * seats
-
+	stripe.Key = p.stripeAPISecretKey
 	params := &stripe.PaymentIntentParams{
-		Amount:           stripe.Int64(int64(cents)),
+		Amount:           stripe.Int64(util.UsdBaseToCent(request.Balance.Int64())),
 		Currency:         stripe.String(string(stripe.CurrencyUSD)),
 		Customer:         user.StripeId,
 		PaymentMethod:    user.PaymentMethod,
 		SetupFutureUsage: stripe.String(string(stripe.PaymentIntentSetupFutureUsageOffSession)),
 	}
-
-	e := uuid.New()
-	payInEvent := db.PayInEvent{
-		Id:         uuid.New(),
-		ExternalId: e,
-		UserId:     user.Id,
-		Balance:    big.NewInt(plan.PriceBase * seats),
-		Currency:   "USD",
-		Status:     db.PayInRequest,
-		Seats:      seats,
-		Freq:       freq,
-		CreatedAt:  util.TimeNow(),
-	}
-
-	err = db.InsertPayInEvent(payInEvent)
-	if err != nil {
-		slog.Error("Cannot insert payment",
-			slog.String("userId", user.Id.String()),
-			slog.Any("error", err))
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
-
-	params.Metadata = map[string]string{
-		"userId":     user.Id.String(),
-		"externalId": e.String(),
-		"fee":        strconv.FormatInt(plan.FeePrm, 10),
-		"freq":       strconv.FormatInt(freq, 10),
-		"seats":      strconv.FormatInt(seats, 10),
-	}
+	params.Metadata = stripeMetadata(request, plan)
 
 	intent, err := paymentintent.New(params)
 	if err != nil {
-		slog.Error("Error while creating new Payment intent",
-			slog.Any("error", err))
-		util.WriteErrorf(w, http.StatusInternalServerError, GenericErrorMessage)
-		return
+		return nil, err
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	cs := ClientSecretBody{ClientSecret: intent.ClientSecret}
-	db.UpdateClientSecret(user.Id, intent.ClientSecret)
-	err = json.NewEncoder(w).Encode(cs)
+	err = db.UpdateClientSecret(user.Id, intent.ClientSecret)
 	if err != nil {
-		slog.Error("Could not encode json",
-			slog.Any("error", err))
-		util.WriteErrorf(w, http.StatusInternalServerError, GenericErrorMessage)
-		return
+		return nil, err
 	}
+	return &Checkout{ExternalId: request.ExternalId, ClientSecret: intent.ClientSecret}, nil
 }
 
-func StripePaymentRecurring(user db.UserDetail) error {
-
-	_, seats, freq, _, err := db.FindLatestDailyPayment(user.Id, "USD")
-	if err != nil {
-		return err
-	}
-
-	plan := findPlan(freq)
-	cents := util.UsdBaseToCent(plan.PriceBase) * seats
-
+// Charge charges the stored card off-session, stripe reports the outcome with a webhook
+func (p *PaymentStripeHandler) Charge(user db.UserDetail, request db.PayInEvent, plan *Plan) error {
+	stripe.Key = p.stripeAPISecretKey
 	params := &stripe.PaymentIntentParams{
-		Amount:        stripe.Int64(cents),
+		Amount:        stripe.Int64(util.UsdBaseToCent(request.Balance.Int64())),
 		Currency:      stripe.String(string(stripe.CurrencyUSD)),
 		Customer:      user.StripeId,
 		PaymentMethod: user.PaymentMethod,
 		ClientSecret:  user.StripeClientSecret,
+		Confirm:       stripe.Bool(true),
+		OffSession:    stripe.Bool(true),
 	}
+	params.Metadata = stripeMetadata(request, plan)
 
-	e := uuid.New()
-	payInEvent := db.PayInEvent{
-		Id:         uuid.New(),
-		ExternalId: e,
-		UserId:     user.Id,
-		Balance:    big.NewInt(plan.PriceBase * int64(user.Seats)),
-		Currency:   "USD",
-		Status:     db.PayInRequest,
-		Seats:      seats,
-		Freq:       freq,
-		CreatedAt:  util.TimeNow(),
-	}
-
-	err = db.InsertPayInEvent(payInEvent)
-	if err != nil {
-		return err
-	}
-
-	params.Params.Metadata = map[string]string{}
-	params.Params.Metadata["userId"] = user.Id.String()
-	params.Params.Metadata["externalId"] = e.String()
-	params.Params.Metadata["fee"] = strconv.FormatInt(plan.FeePrm, 10)
-	params.Params.Metadata["freq"] = strconv.FormatInt(plan.Freq, 10)
-	params.Params.Metadata["seats"] = strconv.Itoa(user.Seats)
-
-	_, err = paymentintent.New(params)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	_, err := paymentintent.New(params)
+	return err
 }
 
-func (p *PaymentStripeHandler) StripeWebhook(w http.ResponseWriter, req *http.Request) {
+// ParseWebhook verifies the signature of the event. Stripe delivers an event more than once, the event id
+// makes sure it is processed only once.
+func (p *PaymentStripeHandler) ParseWebhook(r *http.Request, body []byte) (*WebhookDelivery, error) {
 	// https://stripe.com/docs/testing#cards
 	// regular card for testing: 4242 4242 4242 4242
 	// 3d secure with auth required: 4000 0027 6000 3184
 	// trigger 3d secure: 4000 0000 0000 3063
 	// failed: 4000 0000 0000 0341 (checked)
 	// insufficient funds: 4000 0000 0000 9995 (checked)
-	payload, err := io.ReadAll(req.Body)
+	event, err := webhook.ConstructEvent(body, r.Header.Get("Stripe-Signature"), p.stripeWebhookSecretKey)
 	if err != nil {
-		slog.Error("Error reading request body",
-			slog.Any("error", err))
-		w.WriteHeader(http.StatusServiceUnavailable)
-		return
+		return nil, err
+	}
+	return &WebhookDelivery{EventId: event.ID, EventType: string(event.Type), Payload: body}, nil
+}
+
+// Refund refunds the payment intent of the externalId, stripe reports it with charge.refunded
+func (p *PaymentStripeHandler) Refund(externalId uuid.UUID, cents int64) error {
+	stripe.Key = p.stripeAPISecretKey
+	params := &stripe.PaymentIntentSearchParams{}
+	params.Query = fmt.Sprintf("metadata['externalId']:'%s'", externalId)
+	it := paymentintent.Search(params)
+	if !it.Next() {
+		if it.Err() != nil {
+			return it.Err()
+		}
+		return fmt.Errorf("no payment intent for %v", externalId)
 	}
 
-	event, err := webhook.ConstructEvent(payload, req.Header.Get("Stripe-Signature"), p.stripeWebhookSecretKey)
+	_, err := refund.New(&stripe.RefundParams{
+		PaymentIntent: stripe.String(it.PaymentIntent().ID),
+		Amount:        stripe.Int64(cents),
+	})
+	return err
+}
+
+// ProcessEvent books a stripe event of the webhook inbox, an error retries it later
+func (p *PaymentStripeHandler) ProcessEvent(payload json.RawMessage, in *db.Inbox) error {
+	var event stripe.Event
+	err := json.Unmarshal(payload, &event)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest) // Return a 400 error on a bad signature
-		slog.Error("Error evaluating signed webhook request",
-			slog.Any("error", err))
-		return
+		return fmt.Errorf("could not parse event: %w", err)
 	}
 	// Unmarshal the event data into an appropriate struct depending on its Type
 	switch event.Type {
 	case "payment_intent.succeeded":
 		externalId, feePrm, err := parseStripeData(event.Data.Raw)
 		if err != nil {
-			slog.Error("Parser err from stripe",
-				slog.Any("error", err))
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-
-		payInEvent, err := db.FindPayInExternal(externalId, db.PayInRequest)
-		if err != nil {
-			slog.Error("Payin does not exist",
-				slog.String("externalId", externalId.String()), slog.Any("error", err))
-			w.WriteHeader(http.StatusBadRequest)
-			return
+			return fmt.Errorf("parser err from stripe: %w", err)
 		}
-
-		//Fee calculation
-		fee := new(big.Int).Mul(payInEvent.Balance, big.NewInt(feePrm))
-		fee = new(big.Int).Div(fee, big.NewInt(1000)) //we have promill
-		fee = new(big.Int).Add(fee, big.NewInt(1))    //round up
-
-		err = db.PaymentSuccess(externalId, fee)
-		if err != nil {
-			slog.Error("User sum balance cannot run",
-				slog.String("externalId", externalId.String()), slog.Any("error", err))
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-
-		p.e.SendStripeSuccess(payInEvent.UserId, externalId)
+		return bookPaymentSuccess(p.e, p.sp, externalId, feePrm, in)
 	// ... handle other event types
 	case "payment_intent.requires_action":
 		//again
 		externalId, _, err := parseStripeData(event.Data.Raw)
 		if err != nil {
-			slog.Error("Parser err from stripe",
-				slog.Any("error", err))
-			w.WriteHeader(http.StatusBadRequest)
-			return
+			return fmt.Errorf("parser err from stripe: %w", err)
 		}
-
-		payInEvent, err := db.FindPayInExternal(externalId, db.PayInRequest)
+		payInEvent, err := bookPaymentStatus(externalId, db.PayInAction, in)
 		if err != nil {
-			slog.Error("payin does not exist",
-				slog.String("externalId", externalId.String()), slog.Any("error", err))
-			w.WriteHeader(http.StatusBadRequest)
-			return
+			return err
 		}
-
-		payInEvent.Id = uuid.New()
-		payInEvent.Status = db.PayInAction
-		payInEvent.CreatedAt = util.TimeNow()
-		err = db.InsertPayInEvent(*payInEvent)
-		if err != nil {
-			slog.Error("Insert payin does not exist",
-				slog.String("externalId", externalId.String()), slog.Any("error", err))
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-
 		p.e.SendStripeAction(payInEvent.UserId, externalId)
 	//case "payment_intent.requires_action":
 	//3d secure - this is handled by strip, we just get notified
@@ -301,44 +208,93 @@ func (p *PaymentStripeHandler) StripeWebhook(w http.ResponseWriter, req *http.Re
 		if event.Data.Object["status"] == "requires_payment_method" {
 			slog.Info("Payment failed due to requires_payment_method",
 				slog.Any("data", event.Data.Object))
-			w.WriteHeader(http.StatusOK)
-			return
+			return nil
 		}
 		externalId, _, err := parseStripeData(event.Data.Raw)
 		if err != nil {
-			slog.Error("Parser err from stripe",
-				slog.Any("error", err))
-			w.WriteHeader(http.StatusBadRequest)
-			return
+			return fmt.Errorf("parser err from stripe: %w", err)
 		}
-
-		payInEvent, err := db.FindPayInExternal(externalId, db.PayInRequest)
+		payInEvent, err := bookPaymentStatus(externalId, db.PayInMethod, in)
 		if err != nil {
-			slog.Error("Payin does not exist",
-				slog.String("externalId", externalId.String()),
-				slog.Any("error", err))
-			w.WriteHeader(http.StatusBadRequest)
-			return
+			return err
 		}
-
-		payInEvent.Id = uuid.New()
-		payInEvent.Status = db.PayInMethod
-		payInEvent.CreatedAt = util.TimeNow()
-		err = db.InsertPayInEvent(*payInEvent)
+		paymentFailed(p.e, p.sp, payInEvent.UserId, externalId)
+	case "charge.refunded":
+		var ch stripe.Charge
+		err = json.Unmarshal(event.Data.Raw, &ch)
 		if err != nil {
-			slog.Error("Insert payin does not exist",
-				slog.String("externalId", externalId.String()),
-				slog.Any("error", err))
-			w.WriteHeader(http.StatusBadRequest)
-			return
+			return fmt.Errorf("parser err from stripe: %w", err)
+		}
+		externalId, err := p.chargeExternalId(ch.Metadata, ch.PaymentIntent)
+		if err != nil {
+			return fmt.Errorf("could not find payment of refund %v: %w", ch.ID, err)
+		}
+		err = reverse(p.e, p.cp, externalId, db.ChargebackRefund, ch.AmountRefunded, in)
+		if err != nil {
+			return fmt.Errorf("could not book refund of %v: %w", externalId, err)
+		}
+	case "charge.dispute.created", "charge.dispute.closed":
+		var d stripe.Dispute
+		err = json.Unmarshal(event.Data.Raw, &d)
+		if err != nil {
+			return fmt.Errorf("parser err from stripe: %w", err)
+		}
+		var metadata map[string]string
+		if d.Charge != nil {
+			metadata = d.Charge.Metadata
+		}
+		externalId, err := p.chargeExternalId(metadata, d.PaymentIntent)
+		if err != nil {
+			return fmt.Errorf("could not find payment of dispute %v: %w", d.ID, err)
+		}
+		//the disputed amount is withdrawn when the dispute is opened, a lost dispute keeps it withdrawn
+		if event.Type == "charge.dispute.created" {
+			err = reverse(p.e, p.cp, externalId, db.ChargebackDispute, d.Amount, in)
+		} else if d.Status == stripe.DisputeStatusWon {
+			err = reinstate(externalId, in)
+		} else {
+			slog.Info("Dispute closed",
+				slog.String("externalId", externalId.String()), slog.String("status", string(d.Status)))
+		}
+		if err != nil {
+			return fmt.Errorf("could not book dispute of %v: %w", externalId, err)
 		}
-
-		p.e.SendStripeFailed(payInEvent.UserId, externalId)
 	default:
 		slog.Error("Unhandled event type",
 			slog.String("type", string(event.Type)))
-		w.WriteHeader(http.StatusOK)
 	}
+	return nil
+}
+
+// stripeMetadata is copied to the payment intent and its charges, the webhook checks it against the request
+func stripeMetadata(request db.PayInEvent, plan *Plan) map[string]string {
+	return map[string]string{
+		"userId":     request.UserId.String(),
+		"externalId": request.ExternalId.String(),
+		"fee":        strconv.FormatInt(plan.FeePrm, 10),
+		"freq":       strconv.FormatInt(request.Freq, 10),
+		"seats":      strconv.FormatInt(request.Seats, 10),
+	}
+}
+
+// chargeExternalId returns the externalId of the payment a charge or dispute belongs to. The metadata
+// of the payment intent is copied to its charge, otherwise the payment intent is looked up.
+func (p *PaymentStripeHandler) chargeExternalId(metadata map[string]string, pi *stripe.PaymentIntent) (uuid.UUID, error) {
+	if e, ok := metadata["externalId"]; ok {
+		return uuid.Parse(e)
+	}
+	if pi == nil {
+		return uuid.Nil, fmt.Errorf("no payment intent")
+	}
+	if pi.Metadata == nil {
+		stripe.Key = p.stripeAPISecretKey
+		var err error
+		pi, err = stripePaymentIntent(pi.ID)
+		if err != nil {
+			return uuid.Nil, err
+		}
+	}
+	return uuid.Parse(pi.Metadata["externalId"])
 }
 
 func parseStripeData(data json.RawMessage) (uuid.UUID, int64, error) {
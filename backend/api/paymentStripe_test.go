@@ -21,7 +21,7 @@ import (
 )
 
 var (
-	p = NewPaymentHandler(client.NewEmailClient("", "", "", "", "", "", ""), "webhooksecret", "webhooksecret")
+	p = NewPaymentHandler(client.NewEmailClient("", "", "", "", "", "", ""), "webhooksecret", "webhooksecret", NewSubscriptionPolicy("1,3,5", 7), NewChargebackPolicy(db.ClawbackParked, nil))
 )
 
 func TestStripeConfirmsSuccessfulPayment(t *testing.T) {
@@ -43,9 +43,10 @@ func TestStripeConfirmsSuccessfulPayment(t *testing.T) {
 	request.Header.Set("Stripe-Signature", getStripeSignatureHeaderContent(&timestamp, &hmacString))
 	response := httptest.NewRecorder()
 
-	p.StripeWebhook(response, request)
+	NewPaymentProviders(p).Webhook(db.WebhookStripe)(response, request)
 
 	assert.Equal(t, 200, response.Code)
+	processStripeInbox(t)
 
 	// this should create two events now
 	// one that confirms the pay in
@@ -80,9 +81,10 @@ func TestStripeRequiresActionToContinuePayment(t *testing.T) {
 	request.Header.Set("Stripe-Signature", getStripeSignatureHeaderContent(&timestamp, &hmacString))
 	response := httptest.NewRecorder()
 
-	p.StripeWebhook(response, request)
+	NewPaymentProviders(p).Webhook(db.WebhookStripe)(response, request)
 
 	assert.Equal(t, 200, response.Code)
+	processStripeInbox(t)
 
 	// this should create a pay in action event
 	actionPayIn, err := db.FindPayInExternal(payInEvent.ExternalId, db.PayInAction)
@@ -113,9 +115,10 @@ func TestStripeMissesPaymentMethod(t *testing.T) {
 	request.Header.Set("Stripe-Signature", getStripeSignatureHeaderContent(&timestamp, &hmacString))
 	response := httptest.NewRecorder()
 
-	p.StripeWebhook(response, request)
+	NewPaymentProviders(p).Webhook(db.WebhookStripe)(response, request)
 
 	assert.Equal(t, 200, response.Code)
+	processStripeInbox(t)
 }
 
 func TestStripeHasIssue(t *testing.T) {
@@ -137,9 +140,10 @@ func TestStripeHasIssue(t *testing.T) {
 	request.Header.Set("Stripe-Signature", getStripeSignatureHeaderContent(&timestamp, &hmacString))
 	response := httptest.NewRecorder()
 
-	p.StripeWebhook(response, request)
+	NewPaymentProviders(p).Webhook(db.WebhookStripe)(response, request)
 
 	assert.Equal(t, 200, response.Code)
+	processStripeInbox(t)
 
 	// this should create a pay in method event
 	actionPayIn, err := db.FindPayInExternal(payInEvent.ExternalId, db.PayInMethod)
@@ -148,6 +152,53 @@ func TestStripeHasIssue(t *testing.T) {
 	assert.Equal(t, Plans[1].PriceBase, actionPayIn.Balance.Int64())
 }
 
+func TestStripeProcessesRedeliveredEventOnce(t *testing.T) {
+	db.SetupTestData()
+	defer db.TeardownTestData()
+
+	userDetail := insertTestUser(t, "hello@world.com")
+	payInEvent := insertPayInEvent(t, uuid.New(), userDetail.Id, db.PayInRequest, "USD", Plans[1].PriceBase, 1, Plans[1].Freq)
+	event, err := generateWebhookPayload(userDetail.Id.String(), payInEvent.ExternalId.String(), "payment_intent.succeeded")
+	require.Nil(t, err)
+
+	body, err := json.Marshal(event)
+	require.Nil(t, err)
+
+	//stripe retries the delivery, with a new signature
+	for i := 0; i < 2; i++ {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		hmacString := generateStripeSignature(&timestamp, &body)
+		request, _ := http.NewRequest(http.MethodPost, "/hooks/stripe", bytes.NewReader(body))
+		request.Header.Set("Stripe-Signature", getStripeSignatureHeaderContent(&timestamp, &hmacString))
+		response := httptest.NewRecorder()
+		NewPaymentProviders(p).Webhook(db.WebhookStripe)(response, request)
+		assert.Equal(t, 200, response.Code)
+	}
+
+	es, err := db.FindWebhookEvents("", 10)
+	require.Nil(t, err)
+	require.Len(t, es, 1)
+	assert.Equal(t, event.ID, es[0].EventId)
+	processStripeInbox(t)
+
+	es, err = db.FindWebhookEvents(db.WebhookProcessed, 10)
+	require.Nil(t, err)
+	assert.Len(t, es, 1)
+	successPayIn, err := db.FindPayInExternal(payInEvent.ExternalId, db.PayInSuccess)
+	assert.Nil(t, err)
+	assert.NotNil(t, successPayIn)
+}
+
+// processStripeInbox processes the stored events as the webhook runner does
+func processStripeInbox(t *testing.T) {
+	es, err := db.FindDueWebhookEvents(util.TimeNow(), 100)
+	require.Nil(t, err)
+	for _, e := range es {
+		require.Nil(t, p.ProcessEvent(e.Payload, nil))
+		require.Nil(t, db.WebhookEventProcessed(e.Id, util.TimeNow()))
+	}
+}
+
 func generateStripeSignature(timestamp *string, body *[]byte) string {
 	hasher := hmac.New(sha256.New, []byte("webhooksecret"))
 	hasher.Write(append([]byte(*timestamp+"."), *body...))
@@ -181,6 +232,7 @@ func generateWebhookPayload(userId string, externalId string, eventType stripe.E
 		Raw: json.RawMessage(jsonBytes),
 	}
 	return stripe.Event{
+		ID:         "evt_" + uuid.NewString(),
 		APIVersion: "2023-10-16",
 		Data:       &eventData,
 		Type:       eventType,
@@ -246,3 +246,11 @@ func TestGetFoundationBalance(t *testing.T) {
 		assert.Equal(t, expected, string(body))
 	})
 }
+
+func TestNowCredited(t *testing.T) {
+	balance := big.NewInt(120000000)
+	assert.Equal(t, big.NewInt(30000000), nowCredited(balance, big.NewInt(250), big.NewInt(1000)))
+	//overpaid is credited with the price
+	assert.Equal(t, balance, nowCredited(balance, big.NewInt(1200), big.NewInt(1000)))
+	assert.Equal(t, balance, nowCredited(balance, big.NewInt(1), big.NewInt(0)))
+}
@@ -0,0 +1,454 @@
+package api
+
+import (
+	"backend/db"
+	"backend/util"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	payoutRequestMax = 100
+	payoutBatchMax   = 100
+)
+
+// PayoutHandler queues the payout requests of the users, batches the requests of a currency, signs them
+// with the signer of its chain and tracks the batch until its transaction is confirmed. The signatures on
+// Ethereum expire after signatureTtl.
+type PayoutHandler struct {
+	exchangeRateBase string
+	signatureTtl     time.Duration
+	signers          map[string]PayoutSigner
+}
+
+func NewPayoutHandler(exchangeRateBase string, signatureTtl time.Duration, ss ...PayoutSigner) *PayoutHandler {
+	signers := map[string]PayoutSigner{}
+	for _, s := range ss {
+		signers[s.Chain()] = s
+	}
+	return &PayoutHandler{exchangeRateBase, signatureTtl, signers}
+}
+
+// Signer returns the signer of the chain the currency is paid out on, nil if the chain has no key
+func (h *PayoutHandler) Signer(currency string) PayoutSigner {
+	return h.signers[payoutChains[currency]]
+}
+
+// RequestPayout queues a payout of what the user earned in the currency since the last request, the body
+// may set the address to pay out to, the default address of the currency otherwise. Only registered
+// addresses past their cooldown are paid out to. The payout is signed and sent with the next batch of the
+// currency.
+func (h *PayoutHandler) RequestPayout(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
+	targetCurrencyEsc := r.PathValue("targetCurrency")
+	targetCurrency, err := url.QueryUnescape(targetCurrencyEsc)
+	if err != nil {
+		slog.Error("Query unescape invite-by email",
+			slog.String("email", targetCurrencyEsc),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, EmailEscapeError)
+		return
+	}
+	targetCurrency = strings.ToUpper(targetCurrency)
+	if _, ok := util.SupportedCurrencies[targetCurrency]; !ok {
+		util.WriteErrorf(w, http.StatusBadRequest, "Unsupported currency %v.", targetCurrency)
+		return
+	}
+	s := h.Signer(targetCurrency)
+	if s == nil {
+		util.WriteErrorf(w, http.StatusBadRequest, "Payouts in %v are not available.", targetCurrency)
+		return
+	}
+
+	var data map[string]string
+	err = json.NewDecoder(r.Body).Decode(&data)
+	if err != nil && err != io.EOF {
+		slog.Error("Could not parse payout request",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, PayoutError)
+		return
+	}
+	if data["address"] != "" && !s.ValidAddress(data["address"]) {
+		util.WriteErrorf(w, http.StatusBadRequest, "Invalid %v address.", s.Chain())
+		return
+	}
+	a, err := payoutAddress(user.Id, targetCurrency, s.Chain(), data["address"])
+	if err != nil {
+		slog.Error("Could not find payout address",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, PayoutError)
+		return
+	}
+	if a == nil || a.ConfirmedAt == nil {
+		util.WriteErrorf(w, http.StatusBadRequest, "Please register and confirm a %v address first.", s.Chain())
+		return
+	}
+
+	// notabene: For USDC, 10^6 units are one dollar
+	// See explorer https://etherscan.io/token/0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48
+	// FlatFeeStack already calculates in micro dollars
+	// the monthly rollups contain the archived contributions as well
+	mEarned, err := db.FindSumDailyContributors(user.Id)
+	if err != nil {
+		slog.Error("Unable to retrieve already earned amount in target currency",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, PayoutError)
+		return
+	}
+	totalEarnedAmount := big.NewInt(0)
+	if mEarned[targetCurrency] != nil {
+		totalEarnedAmount = mEarned[targetCurrency]
+	}
+
+	mFwd, err := db.FindSumForwardBalance(user.Id)
+	if err != nil {
+		slog.Error("Unable to retrieve forwarded amount in target currency",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, PayoutError)
+		return
+	}
+	if mFwd[targetCurrency] != nil {
+		totalEarnedAmount = new(big.Int).Add(totalEarnedAmount, mFwd[targetCurrency])
+	}
+
+	now := util.TimeNow()
+	if !a.Active(now) {
+		util.WriteErrorf(w, http.StatusBadRequest, "The address %v can be paid out to from %v.", a.Address,
+			a.ActiveAt.Format(time.RFC3339))
+		return
+	}
+
+	e := NewExchangeRates(h.exchangeRateBase)
+	rate, err := payoutRate(e, targetCurrency, now)
+	if err != nil {
+		slog.Error("Unable to retrieve exchange rate of payout",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, PayoutError)
+		return
+	}
+	if rate == nil {
+		slog.Warn("No exchange rate for payout, recording it without rate",
+			slog.String("currency", targetCurrency))
+	}
+
+	p, err := db.RequestPayout(db.PayoutRequest{
+		Id:           uuid.New(),
+		UserId:       user.Id,
+		Currency:     targetCurrency,
+		ExchangeRate: rate,
+		RateCurrency: e.base,
+		Address:      a.Address,
+	}, totalEarnedAmount, now)
+	if err != nil {
+		slog.Error("Unable to record payout",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, PayoutError)
+		return
+	}
+	if p == nil {
+		util.WriteErrorf(w, http.StatusBadRequest, "Nothing to pay out in %v.", targetCurrency)
+		return
+	}
+	util.WriteJson(w, p)
+}
+
+// payoutAddress returns the registered address of the user, the default of the currency if the address
+// is empty. It returns nil if there is none.
+func payoutAddress(userId uuid.UUID, currency string, chain string, address string) (*db.PayoutAddress, error) {
+	if address == "" {
+		return db.FindDefaultPayoutAddress(userId, currency)
+	}
+	return db.FindPayoutAddressByAddress(userId, chain, normalizePayoutAddress(chain, address))
+}
+
+// CreateBatch signs the oldest requested payouts of the currency and puts them in a new batch. The
+// signature covers the total the user requested up to the request, as the contract pays out the
+// difference to what it paid out before. The nonce is the request id, so every signature can be used once,
+// and an expired signature is superseded by the one of the next request. It returns nil if nothing is
+// requested.
+func (h *PayoutHandler) CreateBatch(currency string, now time.Time) (*db.PayoutBatch, error) {
+	ps, err := db.FindPayoutRequests(db.PayoutRequested, currency, payoutBatchMax)
+	if err != nil {
+		return nil, err
+	}
+	if len(ps) == 0 {
+		return nil, nil
+	}
+
+	s := h.Signer(currency)
+	if s == nil {
+		return nil, fmt.Errorf("no payout signer for %v", currency)
+	}
+	b := db.PayoutBatch{
+		Id:        uuid.New(),
+		Currency:  currency,
+		Chain:     s.Chain(),
+		Status:    db.PayoutSigned,
+		Total:     big.NewInt(0),
+		Requests:  len(ps),
+		CreatedAt: now,
+	}
+	for i, p := range ps {
+		total, err := db.FindPayoutTotal(p.UserId, p.Currency, p.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		c := PayoutClaim{
+			UserId:   p.UserId,
+			Currency: p.Currency,
+			Payee:    p.Address,
+			Total:    total,
+			Nonce:    new(big.Int).SetBytes(p.Id[:]),
+			Deadline: now.Add(h.signatureTtl),
+		}
+		ps[i].OwnerId = s.OwnerId(p.UserId)
+		ps[i].Signature, err = s.Sign(c)
+		if err != nil {
+			return nil, err
+		}
+		if s.Chain() == ChainEth {
+			ps[i].Nonce = c.Nonce
+			ps[i].ExpiresAt = &c.Deadline
+		}
+		b.Total = new(big.Int).Add(b.Total, p.Amount)
+	}
+
+	err = db.InsertPayoutBatch(b, ps)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// PayoutRequests returns the oldest payout requests, the requested ones by default, ?status= and
+// ?currency= filter them
+func PayoutRequests(w http.ResponseWriter, r *http.Request, _ *db.UserDetail) {
+	status := db.PayoutRequested
+	if s := r.URL.Query().Get("status"); s != "" {
+		status = strings.ToUpper(s)
+	}
+	if status != db.PayoutRequested && status != db.PayoutSigned && status != db.PayoutSubmitted &&
+		status != db.PayoutConfirmed {
+		slog.Error("Invalid status",
+			slog.String("status", status))
+		util.WriteErrorf(w, http.StatusBadRequest, PayoutError)
+		return
+	}
+	currency := strings.ToUpper(r.URL.Query().Get("currency"))
+
+	ps, err := db.FindPayoutRequests(status, currency, payoutRequestMax)
+	if err != nil {
+		slog.Error("Could not find payout requests",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, PayoutError)
+		return
+	}
+	util.WriteJson(w, ps)
+}
+
+// CreatePayoutBatch batches the requested payouts of the currency now, instead of waiting for the cron job
+func (h *PayoutHandler) CreatePayoutBatch(w http.ResponseWriter, r *http.Request, _ *db.UserDetail) {
+	currency := strings.ToUpper(r.PathValue("currency"))
+	if _, ok := util.SupportedCurrencies[currency]; !ok {
+		util.WriteErrorf(w, http.StatusBadRequest, "Unsupported currency %v.", currency)
+		return
+	}
+	if h.Signer(currency) == nil {
+		util.WriteErrorf(w, http.StatusBadRequest, "Payouts in %v are not available.", currency)
+		return
+	}
+
+	b, err := h.CreateBatch(currency, util.TimeNow())
+	if err != nil {
+		slog.Error("Could not create payout batch",
+			slog.String("currency", currency),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, PayoutError)
+		return
+	}
+	if b == nil {
+		util.WriteErrorf(w, http.StatusNotFound, "No payouts requested in %v.", currency)
+		return
+	}
+	util.WriteJson(w, b)
+}
+
+// PayoutBatches returns the latest payout batches
+func PayoutBatches(w http.ResponseWriter, _ *http.Request, _ *db.UserDetail) {
+	bs, err := db.FindPayoutBatches(payoutBatchMax)
+	if err != nil {
+		slog.Error("Could not find payout batches",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, PayoutError)
+		return
+	}
+	util.WriteJson(w, bs)
+}
+
+// ExportPayoutBatch returns the signed requests of the batch as CSV, to build the payout transaction from.
+// The owner id is how the contract of the chain identifies the user, nonce and deadline are empty on chains
+// whose signatures have none.
+func (h *PayoutHandler) ExportPayoutBatch(w http.ResponseWriter, r *http.Request, _ *db.UserDetail) {
+	b := findPayoutBatch(w, r)
+	if b == nil {
+		return
+	}
+	ps, err := db.FindPayoutRequestsByBatch(b.Id)
+	if err != nil {
+		slog.Error("Could not find payout requests of batch",
+			slog.String("id", b.Id.String()),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, PayoutError)
+		return
+	}
+
+	s := h.signers[b.Chain]
+	if s == nil {
+		slog.Error("No payout signer for chain",
+			slog.String("chain", b.Chain))
+		util.WriteErrorf(w, http.StatusInternalServerError, PayoutError)
+		return
+	}
+
+	records := [][]string{{"id", "userId", "ownerId", "address", "currency", "amount", "total", "nonce", "deadline",
+		"signature"}}
+	for _, p := range ps {
+		total, err := db.FindPayoutTotal(p.UserId, p.Currency, p.CreatedAt)
+		if err != nil {
+			slog.Error("Could not find payout total",
+				slog.String("id", p.Id.String()),
+				slog.Any("error", err))
+			util.WriteErrorf(w, http.StatusInternalServerError, PayoutError)
+			return
+		}
+		nonce, deadline := "", ""
+		if p.Nonce != nil && p.ExpiresAt != nil {
+			nonce = p.Nonce.String()
+			deadline = strconv.FormatInt(p.ExpiresAt.Unix(), 10)
+		}
+		records = append(records, []string{p.Id.String(), p.UserId.String(), s.OwnerId(p.UserId), p.Address,
+			p.Currency,
+			p.Amount.String(), total.String(), nonce, deadline, p.Signature})
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", "attachment; filename=payout-"+b.Id.String()+".csv")
+	err = csv.NewWriter(w).WriteAll(records)
+	if err != nil {
+		slog.Error("Could not write payout batch",
+			slog.String("id", b.Id.String()),
+			slog.Any("error", err))
+	}
+}
+
+// SubmitPayoutBatch records the transaction a signed batch was sent with
+func SubmitPayoutBatch(w http.ResponseWriter, r *http.Request, _ *db.UserDetail) {
+	b := findPayoutBatch(w, r)
+	if b == nil {
+		return
+	}
+	var data map[string]string
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil || data["txHash"] == "" {
+		slog.Error("Could not parse transaction hash",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, PayoutError)
+		return
+	}
+	txHash := data["txHash"]
+	updatePayoutBatch(w, b, db.PayoutSigned, db.PayoutSubmitted, &txHash)
+}
+
+// ConfirmPayoutBatch marks a submitted batch and its requests as paid out
+func ConfirmPayoutBatch(w http.ResponseWriter, r *http.Request, _ *db.UserDetail) {
+	b := findPayoutBatch(w, r)
+	if b == nil {
+		return
+	}
+	updatePayoutBatch(w, b, db.PayoutSubmitted, db.PayoutConfirmed, nil)
+}
+
+func updatePayoutBatch(w http.ResponseWriter, b *db.PayoutBatch, from string, to string, txHash *string) {
+	now := util.TimeNow()
+	ok, err := db.UpdatePayoutBatchStatus(b.Id, from, to, txHash, now)
+	if err != nil {
+		slog.Error("Could not update payout batch",
+			slog.String("id", b.Id.String()),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, PayoutError)
+		return
+	}
+	if !ok {
+		util.WriteErrorf(w, http.StatusConflict, "Only %v payout batches can be %v.", strings.ToLower(from),
+			strings.ToLower(to))
+		return
+	}
+
+	b.Status = to
+	switch to {
+	case db.PayoutSubmitted:
+		b.TxHash = txHash
+		b.SubmittedAt = &now
+	case db.PayoutConfirmed:
+		b.ConfirmedAt = &now
+	}
+	util.WriteJson(w, b)
+}
+
+func findPayoutBatch(w http.ResponseWriter, r *http.Request) *db.PayoutBatch {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		slog.Error("Invalid payout batch id",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, PayoutError)
+		return nil
+	}
+	b, err := db.FindPayoutBatch(id)
+	if err != nil {
+		slog.Error("Could not find payout batch",
+			slog.String("id", id.String()),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, PayoutError)
+		return nil
+	}
+	if b == nil {
+		util.WriteErrorf(w, http.StatusNotFound, "Payout batch not found.")
+		return nil
+	}
+	return b
+}
+
+// PayoutWithdrawals returns what the user withdrew from the payout contracts
+func PayoutWithdrawals(w http.ResponseWriter, _ *http.Request, user *db.UserDetail) {
+	ws, err := db.FindPayoutWithdrawalsByUserId(user.Id)
+	if err != nil {
+		slog.Error("Could not find payout withdrawals",
+			slog.String("userId", user.Id.String()),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, PayoutError)
+		return
+	}
+	util.WriteJson(w, ws)
+}
+
+// UnreconciledPayoutWithdrawals returns the latest withdrawals that match no signed payout request
+func UnreconciledPayoutWithdrawals(w http.ResponseWriter, _ *http.Request, _ *db.UserDetail) {
+	ws, err := db.FindUnreconciledPayoutWithdrawals(payoutRequestMax)
+	if err != nil {
+		slog.Error("Could not find unreconciled payout withdrawals",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, PayoutError)
+		return
+	}
+	util.WriteJson(w, ws)
+}
@@ -0,0 +1,375 @@
+package api
+
+import (
+	"backend/client"
+	"backend/db"
+	"backend/util"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/google/uuid"
+	"github.com/nspcc-dev/neo-go/pkg/crypto/keys"
+)
+
+const (
+	payoutAddressChallengeTtl = 15 * time.Minute
+	PayoutAddressError        = "Oops something went wrong with the payout address. Please try again."
+)
+
+// PayoutAddressHandler registers the payout addresses of the users. The user signs a challenge with the key
+// of the address, a Sign-In with Ethereum message on Ethereum, and confirms the address by email. An
+// address added after a confirmed one, and a changed default, can be paid out to after the cooldown.
+type PayoutAddressHandler struct {
+	e          *client.EmailClient
+	linkPrefix string
+	chainId    int64
+	cooldown   time.Duration
+}
+
+func NewPayoutAddressHandler(e *client.EmailClient, linkPrefix string, chainId int64, cooldown time.Duration) *PayoutAddressHandler {
+	return &PayoutAddressHandler{e, linkPrefix, chainId, cooldown}
+}
+
+type PayoutAddressProof struct {
+	Signature string `json:"signature"`
+	// PublicKey is the hex of the compressed public key, NEO addresses are hashes of it
+	PublicKey string `json:"publicKey,omitempty"`
+}
+
+type PayoutAddressToken struct {
+	Id    uuid.UUID `json:"id"`
+	Token string    `json:"token"`
+}
+
+// PayoutAddresses returns the payout addresses of the user
+func PayoutAddresses(w http.ResponseWriter, _ *http.Request, user *db.UserDetail) {
+	as, err := db.FindPayoutAddressesByUserId(user.Id)
+	if err != nil {
+		slog.Error("Could not find payout addresses",
+			slog.String("userId", user.Id.String()),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, PayoutAddressError)
+		return
+	}
+	util.WriteJson(w, as)
+}
+
+// PayoutAddressChallenge returns the message the user signs with the key of the address in the body
+func (h *PayoutAddressHandler) PayoutAddressChallenge(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
+	chain := strings.ToUpper(r.PathValue("chain"))
+	var data map[string]string
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		slog.Error("Could not parse payout address",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, PayoutAddressError)
+		return
+	}
+	if !validPayoutAddress(chain, data["address"]) {
+		util.WriteErrorf(w, http.StatusBadRequest, "Invalid %v address.", chain)
+		return
+	}
+
+	rnd, err := util.GenRnd(16)
+	if err != nil {
+		slog.Error("Random number error",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, PayoutAddressError)
+		return
+	}
+	now := util.TimeNow()
+	address := normalizePayoutAddress(chain, data["address"])
+	a, err := db.InsertPayoutAddressChallenge(db.PayoutAddress{
+		Id:        uuid.New(),
+		UserId:    user.Id,
+		Chain:     chain,
+		Address:   address,
+		Message:   h.challenge(chain, address, hex.EncodeToString(rnd), now),
+		CreatedAt: now,
+	})
+	if err != nil {
+		slog.Error("Could not store payout address challenge",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, PayoutAddressError)
+		return
+	}
+	if a == nil {
+		util.WriteErrorf(w, http.StatusConflict, "The address is registered already.")
+		return
+	}
+	util.WriteJson(w, a)
+}
+
+// VerifyPayoutAddress checks the signature of the challenge and sends the confirmation email
+func (h *PayoutAddressHandler) VerifyPayoutAddress(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
+	a := findPayoutAddress(w, r, user)
+	if a == nil {
+		return
+	}
+	if a.VerifiedAt != nil {
+		util.WriteErrorf(w, http.StatusConflict, "The address is verified already.")
+		return
+	}
+	now := util.TimeNow()
+	if now.After(a.CreatedAt.Add(payoutAddressChallengeTtl)) {
+		util.WriteErrorf(w, http.StatusBadRequest, "The challenge expired, please request a new one.")
+		return
+	}
+
+	var p PayoutAddressProof
+	err := json.NewDecoder(r.Body).Decode(&p)
+	if err != nil {
+		slog.Error("Could not parse payout address proof",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, PayoutAddressError)
+		return
+	}
+	if !verifyPayoutAddress(a.Chain, a.Address, a.Message, p) {
+		util.WriteErrorf(w, http.StatusBadRequest, "The signature does not match the address.")
+		return
+	}
+
+	rnd, err := util.GenRnd(20)
+	if err != nil {
+		slog.Error("Random number error",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, PayoutAddressError)
+		return
+	}
+	token := base32.StdEncoding.EncodeToString(rnd)
+	ok, err := db.VerifyPayoutAddress(a.Id, token, now)
+	if err != nil {
+		slog.Error("Could not verify payout address",
+			slog.String("id", a.Id.String()),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, PayoutAddressError)
+		return
+	}
+	if !ok {
+		util.WriteErrorf(w, http.StatusConflict, "The address is verified already.")
+		return
+	}
+	a.VerifiedAt = &now
+
+	err = h.e.SendPayoutAddress(*user, *a, token, lang(r))
+	if err != nil {
+		slog.Error("Could not send payout address email",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, "Oops something went wrong with sending the email. Please try again.")
+		return
+	}
+	util.WriteJson(w, a)
+}
+
+// ConfirmPayoutAddress confirms a verified address with the token of the email. It becomes the default of
+// the currencies of its chain that have none.
+func (h *PayoutAddressHandler) ConfirmPayoutAddress(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
+	var t PayoutAddressToken
+	err := json.NewDecoder(r.Body).Decode(&t)
+	if err != nil {
+		slog.Error("Could not decode json",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, GenericErrorMessage)
+		return
+	}
+	a, err := db.FindPayoutAddress(t.Id)
+	if err != nil {
+		slog.Error("Could not find payout address",
+			slog.String("id", t.Id.String()),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, PayoutAddressError)
+		return
+	}
+	if a == nil || a.UserId != user.Id {
+		util.WriteErrorf(w, http.StatusNotFound, "Payout address not found.")
+		return
+	}
+
+	activeAt, err := db.ConfirmPayoutAddress(user.Id, a.Id, t.Token, payoutCurrencies(a.Chain), h.cooldown,
+		util.TimeNow())
+	if err != nil {
+		slog.Error("Could not confirm payout address",
+			slog.String("id", a.Id.String()),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, PayoutAddressError)
+		return
+	}
+	if activeAt == nil {
+		util.WriteErrorf(w, http.StatusBadRequest, "Oops something went wrong with confirming the payout address. Please try again.")
+		return
+	}
+
+	a, err = db.FindPayoutAddress(a.Id)
+	if err != nil {
+		slog.Error("Could not find payout address",
+			slog.String("id", t.Id.String()),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, PayoutAddressError)
+		return
+	}
+	util.WriteJson(w, a)
+}
+
+// UpdatePayoutAddressDefault makes a confirmed address the default of a currency of its chain. The payouts
+// go to the address after the cooldown, and the user is notified by email.
+func (h *PayoutAddressHandler) UpdatePayoutAddressDefault(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
+	a := findPayoutAddress(w, r, user)
+	if a == nil {
+		return
+	}
+	currency := strings.ToUpper(r.PathValue("currency"))
+	if payoutChains[currency] != a.Chain {
+		util.WriteErrorf(w, http.StatusBadRequest, "%v is not paid out on %v.", currency, a.Chain)
+		return
+	}
+	if a.ConfirmedAt == nil {
+		util.WriteErrorf(w, http.StatusBadRequest, "The address is not confirmed yet.")
+		return
+	}
+
+	activeAt, err := db.UpdatePayoutAddressDefault(user.Id, currency, a.Id, h.cooldown, util.TimeNow())
+	if err != nil {
+		slog.Error("Could not update default payout address",
+			slog.String("id", a.Id.String()),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, PayoutAddressError)
+		return
+	}
+	if activeAt == nil {
+		return
+	}
+
+	//the default is changed already, a missing email must not fail it
+	err = h.e.SendPayoutAddressDefault(*user, *a, currency, *activeAt, lang(r))
+	if err != nil {
+		slog.Error("Could not send payout address default email",
+			slog.String("id", a.Id.String()),
+			slog.Any("error", err))
+	}
+}
+
+func DeletePayoutAddress(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
+	a := findPayoutAddress(w, r, user)
+	if a == nil {
+		return
+	}
+	_, err := db.DeletePayoutAddress(user.Id, a.Id)
+	if err != nil {
+		slog.Error("Could not delete payout address",
+			slog.String("id", a.Id.String()),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, PayoutAddressError)
+		return
+	}
+}
+
+func findPayoutAddress(w http.ResponseWriter, r *http.Request, user *db.UserDetail) *db.PayoutAddress {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		slog.Error("Invalid payout address id",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, PayoutAddressError)
+		return nil
+	}
+	a, err := db.FindPayoutAddress(id)
+	if err != nil {
+		slog.Error("Could not find payout address",
+			slog.String("id", id.String()),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, PayoutAddressError)
+		return nil
+	}
+	if a == nil || a.UserId != user.Id {
+		util.WriteErrorf(w, http.StatusNotFound, "Payout address not found.")
+		return nil
+	}
+	return a
+}
+
+// challenge is the message the user signs. On Ethereum it follows EIP-4361, so wallets show it as a sign-in
+// to the site.
+func (h *PayoutAddressHandler) challenge(chain string, address string, nonce string, now time.Time) string {
+	issuedAt := now.UTC().Format(time.RFC3339)
+	expiresAt := now.Add(payoutAddressChallengeTtl).UTC().Format(time.RFC3339)
+	if chain == ChainEth {
+		domain := h.linkPrefix
+		if u, err := url.Parse(h.linkPrefix); err == nil && u.Host != "" {
+			domain = u.Host
+		}
+		return fmt.Sprintf("%v wants you to sign in with your Ethereum account:\n%v\n\n"+
+			"Register this address for the payouts of your FlatFeeStack account.\n\n"+
+			"URI: %v\nVersion: 1\nChain ID: %v\nNonce: %v\nIssued At: %v\nExpiration Time: %v",
+			domain, address, h.linkPrefix, h.chainId, nonce, issuedAt, expiresAt)
+	}
+	return fmt.Sprintf("Register this %v address for the payouts of your FlatFeeStack account.\n\n"+
+		"Address: %v\nNonce: %v\nIssued At: %v\nExpiration Time: %v",
+		chain, address, nonce, issuedAt, expiresAt)
+}
+
+// normalizePayoutAddress returns the checksummed form of an Ethereum address, so the address is found
+// in any case
+func normalizePayoutAddress(chain string, a string) string {
+	if chain == ChainEth {
+		return common.HexToAddress(a).Hex()
+	}
+	return a
+}
+
+// payoutCurrencies returns the currencies paid out on the chain
+func payoutCurrencies(chain string) []string {
+	var cs []string
+	for currency, c := range payoutChains {
+		if c == chain {
+			cs = append(cs, currency)
+		}
+	}
+	sort.Strings(cs)
+	return cs
+}
+
+// verifyPayoutAddress checks that the key of the address signed the message. On Ethereum it is a
+// personal_sign signature, on NEO a secp256r1 signature over the SHA-256 of the message with the public
+// key of the address.
+func verifyPayoutAddress(chain string, address string, message string, p PayoutAddressProof) bool {
+	switch chain {
+	case ChainEth:
+		sig, err := hexutil.Decode(p.Signature)
+		if err != nil || len(sig) != crypto.SignatureLength {
+			return false
+		}
+		if sig[crypto.RecoveryIDOffset] >= 27 {
+			sig[crypto.RecoveryIDOffset] -= 27
+		}
+		pub, err := crypto.SigToPub(accounts.TextHash([]byte(message)), sig)
+		if err != nil {
+			return false
+		}
+		return crypto.PubkeyToAddress(*pub) == common.HexToAddress(address)
+	case ChainNeo:
+		sig, err := hex.DecodeString(strings.TrimPrefix(p.Signature, "0x"))
+		if err != nil {
+			return false
+		}
+		pub, err := keys.NewPublicKeyFromString(p.PublicKey)
+		if err != nil || pub.Address() != address {
+			return false
+		}
+		h := sha256.Sum256([]byte(message))
+		return pub.Verify(sig, h[:])
+	default:
+		return false
+	}
+}
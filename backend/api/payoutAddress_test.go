@@ -0,0 +1,77 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/nspcc-dev/neo-go/pkg/crypto/keys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPayoutAddressChallenge(t *testing.T) {
+	h := NewPayoutAddressHandler(nil, "https://flatfeestack.io", 1, time.Hour)
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	//EIP-4361, the wallet shows it as a sign-in to the domain
+	m := h.challenge(ChainEth, "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", "3f2a9c", now)
+	assert.Equal(t, "flatfeestack.io wants you to sign in with your Ethereum account:\n"+
+		"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed\n\n"+
+		"Register this address for the payouts of your FlatFeeStack account.\n\n"+
+		"URI: https://flatfeestack.io\nVersion: 1\nChain ID: 1\nNonce: 3f2a9c\n"+
+		"Issued At: 2026-10-19T12:00:00Z\nExpiration Time: 2026-10-19T12:15:00Z", m)
+
+	m = h.challenge(ChainNeo, "NUVPACMnKFhpuHjsRjhUvXz1XhqfGZYVtY", "3f2a9c", now)
+	assert.True(t, strings.HasPrefix(m, "Register this NEO address"))
+	assert.Contains(t, m, "Address: NUVPACMnKFhpuHjsRjhUvXz1XhqfGZYVtY\n")
+
+	assert.Equal(t, []string{"ETH", "USD"}, payoutCurrencies(ChainEth))
+	assert.Equal(t, []string{"GAS"}, payoutCurrencies(ChainNeo))
+	assert.Equal(t, "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+		normalizePayoutAddress(ChainEth, "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed"))
+}
+
+func TestVerifyPayoutAddressEth(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	address := crypto.PubkeyToAddress(key.PublicKey).Hex()
+	message := "flatfeestack.io wants you to sign in with your Ethereum account:\n" + address
+
+	//personal_sign with v 27 or 28, as wallets return it
+	sig, err := crypto.Sign(accounts.TextHash([]byte(message)), key)
+	require.Nil(t, err)
+	sig[crypto.RecoveryIDOffset] += 27
+	p := PayoutAddressProof{Signature: hexutil.Encode(sig)}
+	assert.True(t, verifyPayoutAddress(ChainEth, address, message, p))
+	assert.True(t, verifyPayoutAddress(ChainEth, strings.ToLower(address), message, p))
+
+	assert.False(t, verifyPayoutAddress(ChainEth, address, message+".", p))
+	assert.False(t, verifyPayoutAddress(ChainEth, "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", message, p))
+	assert.False(t, verifyPayoutAddress(ChainNeo, address, message, p))
+	assert.False(t, verifyPayoutAddress(ChainEth, address, message, PayoutAddressProof{Signature: "0x01"}))
+}
+
+func TestVerifyPayoutAddressNeo(t *testing.T) {
+	k, err := keys.NewPrivateKey()
+	require.Nil(t, err)
+	message := "Register this NEO address for the payouts of your FlatFeeStack account."
+
+	sig := k.Sign([]byte(message))
+	p := PayoutAddressProof{Signature: hex.EncodeToString(sig), PublicKey: hex.EncodeToString(k.PublicKey().Bytes())}
+	assert.True(t, verifyPayoutAddress(ChainNeo, k.Address(), message, p))
+	assert.False(t, verifyPayoutAddress(ChainNeo, k.Address(), message+".", p))
+
+	//the public key has to be the one of the address
+	k2, err := keys.NewPrivateKey()
+	require.Nil(t, err)
+	assert.False(t, verifyPayoutAddress(ChainNeo, k2.Address(), message, p))
+	h := sha256.Sum256([]byte(message))
+	p2 := PayoutAddressProof{Signature: hex.EncodeToString(k2.SignHash(h)), PublicKey: p.PublicKey}
+	assert.False(t, verifyPayoutAddress(ChainNeo, k.Address(), message, p2))
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/google/uuid"
+	"github.com/nspcc-dev/neo-go/pkg/crypto/keys"
+	"github.com/nspcc-dev/neo-go/pkg/encoding/address"
+	"github.com/nspcc-dev/neo-go/pkg/encoding/bigint"
+)
+
+const (
+	ChainEth = "ETH"
+	ChainNeo = "NEO"
+
+	payoutDomainName    = "FlatFeeStack Payout"
+	payoutDomainVersion = "1"
+)
+
+// payoutChains maps the payout currencies to the chain their contract runs on, USD is paid out as USDC on
+// Ethereum
+var payoutChains = map[string]string{
+	"ETH": ChainEth,
+	"USD": ChainEth,
+	"GAS": ChainNeo,
+}
+
+// PayoutSigner signs the total a user earned in the format the payout contract of its chain verifies. The
+// contract pays out the difference of the signed total to what it paid out before.
+type PayoutSigner interface {
+	Chain() string
+	// OwnerId is how the contract identifies the user
+	OwnerId(userId uuid.UUID) string
+	Sign(c PayoutClaim) (string, error)
+	ValidAddress(address string) bool
+}
+
+// PayoutClaim is what a signature allows the user to withdraw, to the payee address only. The NEO contract
+// verifies neither payee, nonce nor deadline.
+type PayoutClaim struct {
+	UserId   uuid.UUID
+	Currency string
+	Payee    string
+	Total    *big.Int
+	Nonce    *big.Int
+	Deadline time.Time
+}
+
+// EthSigner signs the payouts of the Payout contracts on Ethereum as EIP-712 typed data, the domain binds
+// the signature to the chain and the contract of the currency
+type EthSigner struct {
+	privateKey string
+	chainId    int64
+	contracts  map[string]string
+}
+
+func NewEthSigner(privateKey string, chainId int64, contracts map[string]string) *EthSigner {
+	return &EthSigner{privateKey, chainId, contracts}
+}
+
+func (s *EthSigner) Chain() string {
+	return ChainEth
+}
+
+func (s *EthSigner) OwnerId(userId uuid.UUID) string {
+	return hexutil.Encode(crypto.Keccak256([]byte(userId.String())))
+}
+
+func (s *EthSigner) Sign(c PayoutClaim) (string, error) {
+	contract := s.contracts[c.Currency]
+	if contract == "" {
+		return "", fmt.Errorf("no payout contract for %v", c.Currency)
+	}
+	return SignETH(s.privateKey, s.chainId, contract, c)
+}
+
+func (s *EthSigner) ValidAddress(address string) bool {
+	return validPayoutAddress(ChainEth, address)
+}
+
+type NeoSigner struct {
+	privateKey string
+}
+
+func NewNeoSigner(privateKeyWif string) *NeoSigner {
+	return &NeoSigner{privateKeyWif}
+}
+
+func (s *NeoSigner) Chain() string {
+	return ChainNeo
+}
+
+func (s *NeoSigner) OwnerId(userId uuid.UUID) string {
+	return neoOwnerId(userId).String()
+}
+
+func (s *NeoSigner) Sign(c PayoutClaim) (string, error) {
+	return SignNeo(s.privateKey, c.UserId, c.Total)
+}
+
+func (s *NeoSigner) ValidAddress(a string) bool {
+	return validPayoutAddress(ChainNeo, a)
+}
+
+// validPayoutAddress accepts a hex address on Ethereum and a base58 N3 address with a valid checksum on NEO
+func validPayoutAddress(chain string, a string) bool {
+	switch chain {
+	case ChainEth:
+		return common.IsHexAddress(a)
+	case ChainNeo:
+		_, err := address.StringToUint160(a)
+		return err == nil
+	default:
+		return false
+	}
+}
+
+// neoOwnerId is the integer of the user id bytes as the NEO VM reads them, little-endian two's complement
+func neoOwnerId(userId uuid.UUID) *big.Int {
+	return bigint.FromBytes(userId[:])
+}
+
+// neoPayoutMessage is the message the withdraw of the NEO contract verifies, the concatenation of the
+// owner id and the total as NEO VM integers
+func neoPayoutMessage(userId uuid.UUID, total *big.Int) []byte {
+	return append(bigint.ToBytes(neoOwnerId(userId)), bigint.ToBytes(total)...)
+}
+
+// SignNeo signs the payout message with secp256r1 over its SHA-256 hash, which is what CryptoLib.verifyWithECDsa
+// of the contract checks
+func SignNeo(privateKeyWif string, userId uuid.UUID, amount *big.Int) (string, error) {
+	privateKey, err := keys.NewPrivateKeyFromWIF(privateKeyWif)
+	if err != nil {
+		return "", err
+	}
+	signature := privateKey.Sign(neoPayoutMessage(userId, amount))
+	return hex.EncodeToString(signature), nil
+}
+
+// payoutTypedData is the typed data the Payout contract hashes with _hashTypedDataV4, the user id of the
+// contract is the Keccak-256 of the user id. The contract pays out to the payee only.
+func payoutTypedData(chainId int64, contractAddress string, c PayoutClaim) apitypes.TypedData {
+	return apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": {
+				{Name: "name", Type: "string"},
+				{Name: "version", Type: "string"},
+				{Name: "chainId", Type: "uint256"},
+				{Name: "verifyingContract", Type: "address"},
+			},
+			"Payout": {
+				{Name: "userId", Type: "uint256"},
+				{Name: "payee", Type: "address"},
+				{Name: "totalPayOut", Type: "uint256"},
+				{Name: "nonce", Type: "uint256"},
+				{Name: "deadline", Type: "uint256"},
+			},
+		},
+		PrimaryType: "Payout",
+		Domain: apitypes.TypedDataDomain{
+			Name:              payoutDomainName,
+			Version:           payoutDomainVersion,
+			ChainId:           math.NewHexOrDecimal256(chainId),
+			VerifyingContract: common.HexToAddress(contractAddress).Hex(),
+		},
+		Message: apitypes.TypedDataMessage{
+			"userId":      new(big.Int).SetBytes(crypto.Keccak256([]byte(c.UserId.String()))),
+			"payee":       common.HexToAddress(c.Payee).Hex(),
+			"totalPayOut": c.Total,
+			"nonce":       c.Nonce,
+			"deadline":    big.NewInt(c.Deadline.Unix()),
+		},
+	}
+}
+
+// SignETH signs the claim as EIP-712 typed data, so wallets show the fields of the payout. The signature is
+// r, s and v, with v 27 or 28 as ECDSA.recover expects it.
+func SignETH(privateKeyHex string, chainId int64, contractAddress string, c PayoutClaim) (string, error) {
+	privateKey, err := crypto.HexToECDSA(privateKeyHex)
+	if err != nil {
+		return "", err
+	}
+	hash, _, err := apitypes.TypedDataAndHash(payoutTypedData(chainId, contractAddress, c))
+	if err != nil {
+		return "", err
+	}
+	signature, err := crypto.Sign(hash, privateKey)
+	if err != nil {
+		return "", err
+	}
+	signature[crypto.RecoveryIDOffset] += 27
+	return hexutil.Encode(signature), nil
+}
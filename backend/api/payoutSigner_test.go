@@ -0,0 +1,275 @@
+package api
+
+import (
+	"backend/chain"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/google/uuid"
+	"github.com/nspcc-dev/neo-go/pkg/crypto/keys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNeoPayoutMessage(t *testing.T) {
+	userId := uuid.MustParse("0102030405060708090a0b0c0d0e0f10")
+
+	//the contract concatenates the owner id and the tea as NEO VM integers, little-endian two's complement
+	m := neoPayoutMessage(userId, big.NewInt(0x0201))
+	assert.Equal(t, "0102030405060708090a0b0c0d0e0f10"+"0102", hex.EncodeToString(m))
+
+	//a tea with the highest bit set needs a sign byte, otherwise the contract reads a negative number
+	m = neoPayoutMessage(userId, big.NewInt(0x80))
+	assert.Equal(t, "0102030405060708090a0b0c0d0e0f10"+"8000", hex.EncodeToString(m))
+
+	//a user id with trailing zero bytes is the smaller integer
+	userId = uuid.MustParse("01020304050607080900000000000000")
+	assert.Equal(t, "010203040506070809", hex.EncodeToString(neoPayoutMessage(userId, big.NewInt(0))))
+	ownerId, _ := new(big.Int).SetString("090807060504030201", 16)
+	assert.Equal(t, 0, ownerId.Cmp(neoOwnerId(userId)))
+}
+
+func TestSignNeo(t *testing.T) {
+	k, err := keys.NewPrivateKey()
+	require.Nil(t, err)
+	s := NewNeoSigner(k.WIF())
+	userId := uuid.New()
+	total := big.NewInt(1234567890)
+
+	sig, err := s.Sign(PayoutClaim{UserId: userId, Currency: "GAS", Total: total})
+	require.Nil(t, err)
+	b, err := hex.DecodeString(sig)
+	require.Nil(t, err)
+
+	//CryptoLib.verifyWithECDsa with secp256r1 checks the signature over the SHA-256 of the message
+	h := sha256.Sum256(neoPayoutMessage(userId, total))
+	assert.True(t, k.PublicKey().Verify(b, h[:]))
+	h = sha256.Sum256(neoPayoutMessage(userId, big.NewInt(1234567891)))
+	assert.False(t, k.PublicKey().Verify(b, h[:]))
+
+	_, err = NewNeoSigner("not a wif").Sign(PayoutClaim{UserId: userId, Currency: "GAS", Total: total})
+	assert.NotNil(t, err)
+}
+
+func TestPayoutAddress(t *testing.T) {
+	k, err := keys.NewPrivateKey()
+	require.Nil(t, err)
+	neo := NewNeoSigner(k.WIF())
+	eth := NewEthSigner("", 1, nil)
+
+	assert.True(t, neo.ValidAddress(k.Address()))
+	assert.False(t, neo.ValidAddress(k.Address()[:len(k.Address())-1]+"x"))
+	assert.False(t, neo.ValidAddress("0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"))
+
+	assert.True(t, eth.ValidAddress("0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"))
+	assert.False(t, eth.ValidAddress("0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeA"))
+	assert.False(t, eth.ValidAddress(k.Address()))
+}
+
+func TestPayoutSigner(t *testing.T) {
+	k, err := keys.NewPrivateKey()
+	require.Nil(t, err)
+	h := NewPayoutHandler("USD", time.Hour, NewNeoSigner(k.WIF()))
+
+	assert.Equal(t, ChainNeo, h.Signer("GAS").Chain())
+	assert.Nil(t, h.Signer("ETH"))
+	assert.Nil(t, h.Signer("USD"))
+}
+
+// payoutDigest is the digest of the Payout contract, _hashTypedDataV4 of the struct hash
+func payoutDigest(chainId int64, contract common.Address, c PayoutClaim) []byte {
+	word := func(b *big.Int) []byte {
+		return common.LeftPadBytes(b.Bytes(), 32)
+	}
+	domain := crypto.Keccak256(
+		crypto.Keccak256([]byte("EIP712Domain(string name,string version,uint256 chainId,address verifyingContract)")),
+		crypto.Keccak256([]byte("FlatFeeStack Payout")),
+		crypto.Keccak256([]byte("1")),
+		word(big.NewInt(chainId)),
+		common.LeftPadBytes(contract.Bytes(), 32))
+	payout := crypto.Keccak256(
+		crypto.Keccak256([]byte("Payout(uint256 userId,address payee,uint256 totalPayOut,uint256 nonce,uint256 deadline)")),
+		crypto.Keccak256([]byte(c.UserId.String())),
+		common.LeftPadBytes(common.HexToAddress(c.Payee).Bytes(), 32),
+		word(c.Total),
+		word(c.Nonce),
+		word(big.NewInt(c.Deadline.Unix())))
+	return crypto.Keccak256([]byte{0x19, 0x01}, domain, payout)
+}
+
+func TestSignETH(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	signer := crypto.PubkeyToAddress(key.PublicKey)
+	contract := common.HexToAddress("0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed")
+	s := NewEthSigner(hex.EncodeToString(crypto.FromECDSA(key)), 1337, map[string]string{"ETH": contract.Hex()})
+	c := PayoutClaim{
+		UserId:   uuid.New(),
+		Currency: "ETH",
+		Payee:    "0x01",
+		Total:    big.NewInt(1234567890),
+		Nonce:    big.NewInt(42),
+		Deadline: time.Unix(1900000000, 0),
+	}
+
+	sig, err := s.Sign(c)
+	require.Nil(t, err)
+	b, err := hexutil.Decode(sig)
+	require.Nil(t, err)
+	require.Len(t, b, 65)
+	//ECDSA.recover of the contract expects v 27 or 28
+	assert.Contains(t, []byte{27, 28}, b[64])
+
+	digest := payoutDigest(1337, contract, c)
+	recover := func(digest []byte) common.Address {
+		rsv := append([]byte{}, b...)
+		rsv[64] -= 27
+		pub, err := crypto.SigToPub(digest, rsv)
+		require.Nil(t, err)
+		return crypto.PubkeyToAddress(*pub)
+	}
+	assert.Equal(t, signer, recover(digest))
+
+	//the domain binds the signature to the chain and the contract, the struct to the payee, nonce and deadline
+	assert.NotEqual(t, signer, recover(payoutDigest(1, contract, c)))
+	assert.NotEqual(t, signer, recover(payoutDigest(1337, common.HexToAddress("0x01"), c)))
+	c1 := c
+	c1.Payee = "0x02"
+	assert.NotEqual(t, signer, recover(payoutDigest(1337, contract, c1)))
+	c1 = c
+	c1.Nonce = big.NewInt(43)
+	assert.NotEqual(t, signer, recover(payoutDigest(1337, contract, c1)))
+	c1 = c
+	c1.Deadline = c.Deadline.Add(time.Second)
+	assert.NotEqual(t, signer, recover(payoutDigest(1337, contract, c1)))
+
+	_, err = s.Sign(PayoutClaim{UserId: c.UserId, Currency: "USD", Total: c.Total, Nonce: c.Nonce})
+	assert.NotNil(t, err)
+}
+
+// TestSignETHOnChain recovers the signer with the ecrecover precompile the contract calls through
+// ECDSA.recover, on a simulated chain
+func TestSignETHOnChain(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	signer := crypto.PubkeyToAddress(key.PublicKey)
+	b := simulated.NewBackend(types.GenesisAlloc{signer: {Balance: big.NewInt(1e18)}})
+	t.Cleanup(func() { b.Close() })
+	chainId, err := b.Client().ChainID(context.Background())
+	require.Nil(t, err)
+
+	contract := common.HexToAddress("0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed")
+	s := NewEthSigner(hex.EncodeToString(crypto.FromECDSA(key)), chainId.Int64(),
+		map[string]string{"USD": contract.Hex()})
+	c := PayoutClaim{
+		UserId:   uuid.New(),
+		Currency: "USD",
+		Payee:    signer.Hex(),
+		Total:    big.NewInt(5000000),
+		Nonce:    big.NewInt(7),
+		Deadline: time.Now().Add(time.Hour),
+	}
+	sig, err := s.Sign(c)
+	require.Nil(t, err)
+	rsv, err := hexutil.Decode(sig)
+	require.Nil(t, err)
+
+	//ecrecover takes the digest, v, r and s as words
+	ecrecover := common.BytesToAddress([]byte{1})
+	in := append(payoutDigest(chainId.Int64(), contract, c), common.LeftPadBytes(rsv[64:], 32)...)
+	in = append(in, rsv[:64]...)
+	out, err := b.Client().CallContract(context.Background(), ethereum.CallMsg{To: &ecrecover, Data: in}, nil)
+	require.Nil(t, err)
+	assert.Equal(t, signer, common.BytesToAddress(out))
+}
+
+// payoutEthBin is the bytecode of the PayoutEth contract next to its ABI, npm run export:bin in
+// smart-contracts-eth writes it
+const payoutEthBin = "../chain/Payout.bin"
+
+// TestSignETHWithdraw deploys the compiled PayoutEth contract on a simulated chain and withdraws with a
+// signature of the signer, so the typed data of the server is checked against the one of the contract
+func TestSignETHWithdraw(t *testing.T) {
+	bin, err := os.ReadFile(payoutEthBin)
+	if err != nil {
+		t.Skip("run npm run export:bin in smart-contracts-eth first:", err)
+	}
+
+	key, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	owner := crypto.PubkeyToAddress(key.PublicKey)
+	b := simulated.NewBackend(types.GenesisAlloc{owner: {Balance: big.NewInt(1e18)}})
+	t.Cleanup(func() { b.Close() })
+	ctx := context.Background()
+	chainId, err := b.Client().ChainID(ctx)
+	require.Nil(t, err)
+	opts, err := bind.NewKeyedTransactorWithChainID(key, chainId)
+	require.Nil(t, err)
+
+	a, err := chain.PayoutMetaData.GetAbi()
+	require.Nil(t, err)
+	contract, _, _, err := bind.DeployContract(opts, *a, common.FromHex(strings.TrimSpace(string(bin))), b.Client())
+	require.Nil(t, err)
+	b.Commit()
+	p, err := chain.NewPayout(contract, b.Client())
+	require.Nil(t, err)
+	opts.Value = big.NewInt(1e15)
+	_, err = p.Receive(opts)
+	require.Nil(t, err)
+	opts.Value = nil
+	b.Commit()
+
+	dev := common.HexToAddress("0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed")
+	s := NewEthSigner(hex.EncodeToString(crypto.FromECDSA(key)), chainId.Int64(),
+		map[string]string{"ETH": contract.Hex()})
+	c := PayoutClaim{
+		UserId:   uuid.New(),
+		Currency: "ETH",
+		Payee:    dev.Hex(),
+		Total:    big.NewInt(1e12),
+		Nonce:    big.NewInt(7),
+		Deadline: time.Now().Add(time.Hour),
+	}
+	sig, err := s.Sign(c)
+	require.Nil(t, err)
+	signature, err := hexutil.Decode(sig)
+	require.Nil(t, err)
+	userId, ok := new(big.Int).SetString(s.OwnerId(c.UserId)[2:], 16)
+	require.True(t, ok)
+	deadline := big.NewInt(c.Deadline.Unix())
+
+	//the signature pays out to the payee only
+	_, err = p.Withdraw(opts, owner, userId, dev, c.Total, c.Nonce, deadline, signature)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Payee mismatch")
+	_, err = p.Withdraw(opts, owner, userId, owner, c.Total, c.Nonce, deadline, signature)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Signature mismatch")
+
+	_, err = p.Withdraw(opts, dev, userId, dev, c.Total, c.Nonce, deadline, signature)
+	require.Nil(t, err)
+	b.Commit()
+	balance, err := b.Client().BalanceAt(ctx, dev, nil)
+	require.Nil(t, err)
+	assert.Equal(t, c.Total.String(), balance.String())
+	payedOut, err := p.PayedOut(&bind.CallOpts{}, userId)
+	require.Nil(t, err)
+	assert.Equal(t, c.Total.String(), payedOut.String())
+
+	_, err = p.Withdraw(opts, dev, userId, dev, c.Total, c.Nonce, deadline, signature)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Nothing to withdraw")
+}
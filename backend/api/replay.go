@@ -0,0 +1,146 @@
+package api
+
+import (
+	"backend/db"
+	"backend/util"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ReplayError = "Oops something went wrong with the replay of the distribution. Please try again."
+	// a replay runs in the request, so it cannot be arbitrarily long
+	replayMaxDays = 366
+)
+
+// ReplayResult is what happened, or with a dry run what would happen, to one day
+type ReplayResult struct {
+	Day        time.Time            `json:"day"`
+	Action     string               `json:"action"`
+	DryRun     bool                 `json:"dryRun"`
+	Generation int                  `json:"generation"`
+	Sums       *db.DistributionSums `json:"sums,omitempty"`
+}
+
+// Replayer books the distribution of past days again, it is implemented by the daily runner
+type Replayer interface {
+	Replay(from time.Time, to time.Time, dryRun bool, userId *uuid.UUID) ([]ReplayResult, error)
+	Reverse(day time.Time, dryRun bool, userId *uuid.UUID) (*ReplayResult, error)
+	Rebook(day time.Time, dryRun bool, userId *uuid.UUID) ([]ReplayResult, error)
+}
+
+type ReplayHandler struct {
+	r Replayer
+}
+
+type DistributionStatusDto struct {
+	Days   []db.DistributionDay   `json:"days"`
+	Events []db.DistributionEvent `json:"events"`
+}
+
+func NewReplayHandler(r Replayer) *ReplayHandler {
+	return &ReplayHandler{r}
+}
+
+// ParseDay parses a day like 2026-10-19
+func ParseDay(s string) (time.Time, error) {
+	return time.ParseInLocation(time.DateOnly, s, time.UTC)
+}
+
+func parseDayRange(r *http.Request) (time.Time, time.Time, bool) {
+	from, err := ParseDay(r.URL.Query().Get("from"))
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	to, err := ParseDay(r.URL.Query().Get("to"))
+	if err != nil || to.Before(from) || to.Sub(from) > replayMaxDays*24*time.Hour {
+		return time.Time{}, time.Time{}, false
+	}
+	return from, to, true
+}
+
+func DistributionStatus(w http.ResponseWriter, r *http.Request, _ *db.UserDetail) {
+	from, to, ok := parseDayRange(r)
+	if !ok {
+		util.WriteErrorf(w, http.StatusBadRequest, "Use ?from=YYYY-MM-DD&to=YYYY-MM-DD, at most %v days", replayMaxDays)
+		return
+	}
+
+	ds, err := db.FindDistributionDays(from, to)
+	if err != nil {
+		slog.Error("Could not find distribution days",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, ReplayError)
+		return
+	}
+	es, err := db.FindDistributionEvents(from, to)
+	if err != nil {
+		slog.Error("Could not find distribution events",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, ReplayError)
+		return
+	}
+	util.WriteJson(w, DistributionStatusDto{Days: ds, Events: es})
+}
+
+// Replay books the days from..to in order, days that are booked already are skipped. With ?dryRun=true
+// nothing is booked.
+func (h *ReplayHandler) Replay(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
+	from, to, ok := parseDayRange(r)
+	if !ok {
+		util.WriteErrorf(w, http.StatusBadRequest, "Use ?from=YYYY-MM-DD&to=YYYY-MM-DD, at most %v days", replayMaxDays)
+		return
+	}
+
+	rs, err := h.r.Replay(from, to, r.URL.Query().Get("dryRun") == "true", &user.Id)
+	if err != nil {
+		slog.Error("Replay failed",
+			slog.Any("from", from),
+			slog.Any("to", to),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, "%v: %v", ReplayError, err)
+		return
+	}
+	util.WriteJson(w, rs)
+}
+
+// Reverse books compensating entries for everything that was booked on the day
+func (h *ReplayHandler) Reverse(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
+	day, err := ParseDay(r.PathValue("day"))
+	if err != nil {
+		util.WriteErrorf(w, http.StatusBadRequest, "Not a day %v, use YYYY-MM-DD", r.PathValue("day"))
+		return
+	}
+
+	rs, err := h.r.Reverse(day, r.URL.Query().Get("dryRun") == "true", &user.Id)
+	if err != nil {
+		slog.Error("Reverse failed",
+			slog.Any("day", day),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, "%v: %v", ReplayError, err)
+		return
+	}
+	util.WriteJson(w, rs)
+}
+
+// Rebook reverses the day and books it again, e.g. after an analysis was corrected
+func (h *ReplayHandler) Rebook(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
+	day, err := ParseDay(r.PathValue("day"))
+	if err != nil {
+		util.WriteErrorf(w, http.StatusBadRequest, "Not a day %v, use YYYY-MM-DD", r.PathValue("day"))
+		return
+	}
+
+	rs, err := h.r.Rebook(day, r.URL.Query().Get("dryRun") == "true", &user.Id)
+	if err != nil {
+		slog.Error("Rebook failed",
+			slog.Any("day", day),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, "%v: %v", ReplayError, err)
+		return
+	}
+	util.WriteJson(w, rs)
+}
@@ -0,0 +1,264 @@
+package api
+
+import (
+	"backend/db"
+	"backend/util"
+	"encoding/json"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SpendingCapError = "Oops something went wrong with the spending caps. Please try again."
+	//how far the run-out date is projected, balances that last longer never run out
+	maxProjectionDays = 3650
+)
+
+type SpendingCaps struct {
+	Caps   []db.SpendingCap `json:"caps"`
+	StopAt *time.Time       `json:"stopAt"`
+}
+
+// CapSpending limits what is spent per repo on one day. Every repo is limited to what is left of its
+// monthly limit, then all repos are scaled down to what is left of the daily and the monthly limit.
+func CapSpending(amounts map[uuid.UUID]*big.Int, c *db.SpendingCap, spent *big.Int, spentRepo map[uuid.UUID]*big.Int) map[uuid.UUID]*big.Int {
+	capped := map[uuid.UUID]*big.Int{}
+	total := new(big.Int)
+	for rid, a := range amounts {
+		a = new(big.Int).Set(a)
+		if c.RepoMonthly != nil {
+			left := new(big.Int).Set(c.RepoMonthly)
+			if spentRepo[rid] != nil {
+				left.Sub(left, spentRepo[rid])
+			}
+			a = minPositive(a, left)
+		}
+		capped[rid] = a
+		total.Add(total, a)
+	}
+
+	limit := c.Daily
+	if c.Monthly != nil {
+		left := new(big.Int).Set(c.Monthly)
+		if spent != nil {
+			left.Sub(left, spent)
+		}
+		if limit == nil || left.Cmp(limit) < 0 {
+			limit = left
+		}
+	}
+	if limit == nil || total.Cmp(limit) <= 0 {
+		return capped
+	}
+	if limit.Sign() <= 0 {
+		for rid := range capped {
+			capped[rid] = new(big.Int)
+		}
+		return capped
+	}
+	for rid, a := range capped {
+		capped[rid] = new(big.Int).Div(new(big.Int).Mul(a, limit), total)
+	}
+	return capped
+}
+
+// projectRunOut returns the day the balance is spent, when spending the daily amount under the caps.
+// The hard stop ends the spending before. Nil is returned if the balance lasts longer than the projection.
+func projectRunOut(now time.Time, balance *big.Int, daily *big.Int, c *db.SpendingCap, spentThisMonth *big.Int, stopAt *time.Time) *time.Time {
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	b := new(big.Int).Set(balance)
+	monthSpent := new(big.Int)
+	if spentThisMonth != nil {
+		monthSpent.Set(spentThisMonth)
+	}
+	if daily == nil || daily.Sign() <= 0 {
+		return nil
+	}
+
+	for i := 0; i < maxProjectionDays; i++ {
+		if stopAt != nil && !day.Before(*stopAt) {
+			return stopAt
+		}
+		if i > 0 && day.Day() == 1 {
+			monthSpent.SetInt64(0)
+		}
+		d := daily
+		if c != nil {
+			if c.Daily != nil {
+				d = minPositive(d, c.Daily)
+			}
+			if c.Monthly != nil {
+				d = minPositive(d, new(big.Int).Sub(c.Monthly, monthSpent))
+			}
+		}
+		if d.Cmp(b) >= 0 {
+			return &day
+		}
+		b.Sub(b, d)
+		monthSpent.Add(monthSpent, d)
+		day = day.AddDate(0, 0, 1)
+	}
+	return nil
+}
+
+func minPositive(a *big.Int, b *big.Int) *big.Int {
+	if b.Sign() <= 0 {
+		return new(big.Int)
+	}
+	if b.Cmp(a) < 0 {
+		return new(big.Int).Set(b)
+	}
+	return a
+}
+
+// runOutDates projects for every currency when it runs out, as if it were the only currency spent
+func runOutDates(user *db.UserDetail, total map[string]*big.Int, now time.Time) (map[string]time.Time, *time.Time, error) {
+	caps, err := db.FindSpendingCaps(user.Id)
+	if err != nil {
+		return nil, nil, err
+	}
+	m := map[string]time.Time{}
+	var last *time.Time
+	for currency, b := range total {
+		if b.Sign() <= 0 {
+			continue
+		}
+		daily, _, _, _, err := db.FindLatestDailyPayment(user.Id, currency)
+		if err != nil {
+			return nil, nil, err
+		}
+		var c *db.SpendingCap
+		var spent *big.Int
+		if sc, ok := caps[currency]; ok {
+			c = &sc
+			spent, _, err = db.FindSpentInMonth(user.Id, currency, now)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		t := projectRunOut(now, b, daily, c, spent, user.SpendingStopAt)
+		if t == nil {
+			continue
+		}
+		m[currency] = *t
+		if last == nil || t.After(*last) {
+			last = t
+		}
+	}
+	return m, last, nil
+}
+
+func GetSpendingCaps(w http.ResponseWriter, _ *http.Request, user *db.UserDetail) {
+	caps, err := db.FindSpendingCaps(user.Id)
+	if err != nil {
+		slog.Error("Could not find spending caps",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, SpendingCapError)
+		return
+	}
+	sc := SpendingCaps{Caps: []db.SpendingCap{}, StopAt: user.SpendingStopAt}
+	for _, c := range caps {
+		sc.Caps = append(sc.Caps, c)
+	}
+	util.WriteJson(w, sc)
+}
+
+// UpdateSpendingCap sets the caps of one currency, the amounts are in the smallest unit of the currency
+func UpdateSpendingCap(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
+	currency, ok := spendingCapCurrency(w, r)
+	if !ok {
+		return
+	}
+	var c db.SpendingCap
+	err := json.NewDecoder(r.Body).Decode(&c)
+	if err != nil {
+		slog.Error("Could not decode json",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, SpendingCapError)
+		return
+	}
+	for _, l := range []*big.Int{c.Daily, c.Monthly, c.RepoMonthly} {
+		if l != nil && l.Sign() < 0 {
+			util.WriteErrorf(w, http.StatusBadRequest, "A spending cap cannot be negative.")
+			return
+		}
+	}
+	c.Currency = currency
+	c.UpdatedAt = util.TimeNow()
+
+	err = db.UpsertSpendingCap(user.Id, c)
+	if err != nil {
+		slog.Error("Could not save spending cap",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, SpendingCapError)
+		return
+	}
+	util.WriteJson(w, c)
+}
+
+func DeleteSpendingCap(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
+	currency, ok := spendingCapCurrency(w, r)
+	if !ok {
+		return
+	}
+	err := db.DeleteSpendingCap(user.Id, currency)
+	if err != nil {
+		slog.Error("Could not delete spending cap",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, SpendingCapError)
+		return
+	}
+}
+
+// UpdateSpendingStop sets the day from which nothing is spent anymore, as 2006-01-02
+func UpdateSpendingStop(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
+	stopAt, err := time.Parse(time.DateOnly, r.PathValue("date"))
+	if err != nil {
+		slog.Error("Invalid stop date",
+			slog.String("date", r.PathValue("date")),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, "Invalid date, use YYYY-MM-DD")
+		return
+	}
+	err = db.UpdateSpendingStopAt(user.Id, &stopAt)
+	if err != nil {
+		slog.Error("Could not save spending stop",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, SpendingCapError)
+		return
+	}
+}
+
+func DeleteSpendingStop(w http.ResponseWriter, _ *http.Request, user *db.UserDetail) {
+	err := db.UpdateSpendingStopAt(user.Id, nil)
+	if err != nil {
+		slog.Error("Could not reset spending stop",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, SpendingCapError)
+		return
+	}
+}
+
+func spendingCapCurrency(w http.ResponseWriter, r *http.Request) (string, bool) {
+	currencyEsc := r.PathValue("currency")
+	currency, err := url.QueryUnescape(currencyEsc)
+	if err != nil {
+		slog.Error("Query unescape currency",
+			slog.String("currency", currencyEsc),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, SpendingCapError)
+		return "", false
+	}
+	currency = strings.ToUpper(currency)
+	if _, ok := util.SupportedCurrencies[currency]; !ok {
+		util.WriteErrorf(w, http.StatusBadRequest, "Unsupported currency %v", currency)
+		return "", false
+	}
+	return currency, true
+}
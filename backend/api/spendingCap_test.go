@@ -0,0 +1,75 @@
+package api
+
+import (
+	"backend/db"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCapSpending(t *testing.T) {
+	r1, r2 := uuid.New(), uuid.New()
+	amounts := map[uuid.UUID]*big.Int{r1: big.NewInt(60), r2: big.NewInt(40)}
+
+	//no limits, nothing changes
+	capped := CapSpending(amounts, &db.SpendingCap{}, nil, nil)
+	assert.Equal(t, big.NewInt(60), capped[r1])
+	assert.Equal(t, big.NewInt(40), capped[r2])
+
+	//the daily limit scales all repos down
+	capped = CapSpending(amounts, &db.SpendingCap{Daily: big.NewInt(50)}, nil, nil)
+	assert.Equal(t, big.NewInt(30), capped[r1])
+	assert.Equal(t, big.NewInt(20), capped[r2])
+
+	//what is left of the month is lower than the daily limit
+	capped = CapSpending(amounts, &db.SpendingCap{Daily: big.NewInt(50), Monthly: big.NewInt(1010)}, big.NewInt(1000), nil)
+	assert.Equal(t, big.NewInt(6), capped[r1])
+	assert.Equal(t, big.NewInt(4), capped[r2])
+
+	//the month is used up
+	capped = CapSpending(amounts, &db.SpendingCap{Monthly: big.NewInt(1000)}, big.NewInt(1200), nil)
+	assert.Equal(t, big.NewInt(0), capped[r1])
+	assert.Equal(t, big.NewInt(0), capped[r2])
+
+	//one repo reached its monthly limit
+	capped = CapSpending(amounts, &db.SpendingCap{RepoMonthly: big.NewInt(500)}, nil,
+		map[uuid.UUID]*big.Int{r1: big.NewInt(490)})
+	assert.Equal(t, big.NewInt(10), capped[r1])
+	assert.Equal(t, big.NewInt(40), capped[r2])
+
+	//the input is not changed
+	assert.Equal(t, big.NewInt(60), amounts[r1])
+}
+
+func TestProjectRunOut(t *testing.T) {
+	now := time.Date(2026, 10, 19, 15, 0, 0, 0, time.UTC)
+	day := func(m time.Month, d int) time.Time { return time.Date(2026, m, d, 0, 0, 0, 0, time.UTC) }
+
+	//10 days without caps, the last day is spent on the 28th
+	r := projectRunOut(now, big.NewInt(1000), big.NewInt(100), nil, nil, nil)
+	require.NotNil(t, r)
+	assert.Equal(t, day(time.October, 28), *r)
+
+	//a daily cap of 50 doubles the days
+	r = projectRunOut(now, big.NewInt(1000), big.NewInt(100), &db.SpendingCap{Daily: big.NewInt(50)}, nil, nil)
+	require.NotNil(t, r)
+	assert.Equal(t, day(time.November, 7), *r)
+
+	//the monthly cap is reached, nothing is spent until november and half of the balance in november
+	r = projectRunOut(now, big.NewInt(1000), big.NewInt(100), &db.SpendingCap{Monthly: big.NewInt(500)}, big.NewInt(500), nil)
+	require.NotNil(t, r)
+	assert.Equal(t, day(time.December, 5), *r)
+
+	//the hard stop comes first
+	stop := day(time.October, 25)
+	r = projectRunOut(now, big.NewInt(1000), big.NewInt(100), nil, nil, &stop)
+	require.NotNil(t, r)
+	assert.Equal(t, stop, *r)
+
+	//nothing is spent
+	assert.Nil(t, projectRunOut(now, big.NewInt(1000), big.NewInt(0), nil, nil, nil))
+}
@@ -0,0 +1,293 @@
+package api
+
+import (
+	"backend/db"
+	"backend/util"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SpendingStrategyError = "Oops something went wrong with the spending strategy. Please try again."
+)
+
+// Spending is what is spent from one currency on one day
+type Spending struct {
+	Currency string
+	Amount   *big.Int
+}
+
+type SpendingStrategy struct {
+	strategy  string
+	costOrder []string
+}
+
+type currencyBalance struct {
+	currency string
+	balance  *big.Int
+	daily    *big.Int
+	days     int64
+}
+
+// NewSpendingStrategy creates the default strategy of the deployment. The cost order lists the
+// currencies from the cheapest to the most expensive one to process.
+func NewSpendingStrategy(strategy string, costOrder string) *SpendingStrategy {
+	if !db.IsValidSpendingStrategy(strategy) {
+		strategy = db.SpendingMax
+	}
+	return &SpendingStrategy{strategy: strategy, costOrder: parseCurrencyOrder(costOrder)}
+}
+
+// For returns the strategy and the currency order for the user, the user can override the default
+func (s *SpendingStrategy) For(u *db.UserDetail) (string, []string) {
+	if u.SpendingStrategy == nil || !db.IsValidSpendingStrategy(*u.SpendingStrategy) {
+		return s.strategy, s.costOrder
+	}
+	switch *u.SpendingStrategy {
+	case db.SpendingPreferred:
+		if u.SpendingOrder != nil {
+			return db.SpendingPreferred, parseCurrencyOrder(*u.SpendingOrder)
+		}
+		return db.SpendingPreferred, nil
+	default:
+		return *u.SpendingStrategy, s.costOrder
+	}
+}
+
+// Spend returns what is spent per currency on one day, and the number of days the balances last. The
+// MAX strategy spends only the currency that lasts the longest, PROPORTIONAL spends from all
+// currencies so they run out at the same time, and CHEAPEST and PREFERRED spend one currency after
+// the other in the given order.
+func (s *SpendingStrategy) Spend(u *db.UserDetail, balances map[string]*big.Int, subs map[string]*big.Int, futSub map[string]*big.Int) ([]Spending, int64, error) {
+	strategy, order := s.For(u)
+	if strategy == db.SpendingMax {
+		currency, freq, amount, err := StrategyDeductMax(u.Id, balances, subs, futSub)
+		if err != nil || amount == nil {
+			return nil, freq, err
+		}
+		return []Spending{{Currency: currency, Amount: amount}}, freq, nil
+	}
+
+	cbs, err := remainingBalances(u.Id, balances, subs, futSub)
+	if err != nil {
+		return nil, 0, err
+	}
+	if strategy == db.SpendingProportional {
+		ss, days := spendProportional(cbs)
+		return ss, days, nil
+	}
+	ss, days := spendOrdered(cbs, order)
+	return ss, days, nil
+}
+
+func remainingBalances(userId uuid.UUID, balances map[string]*big.Int, subs map[string]*big.Int, futSub map[string]*big.Int) ([]currencyBalance, error) {
+	var cbs []currencyBalance
+	for currency, newBalance := range balances {
+		if subs[currency] != nil {
+			newBalance = new(big.Int).Sub(newBalance, subs[currency])
+		}
+		if futSub[currency] != nil {
+			newBalance = new(big.Int).Sub(newBalance, futSub[currency])
+		}
+
+		ds, _, _, _, err := db.FindLatestDailyPayment(userId, currency)
+		if err != nil {
+			return nil, err
+		}
+		if ds == nil || ds.Sign() <= 0 {
+			continue
+		}
+		days := new(big.Int).Div(newBalance, ds).Int64()
+		if days > 0 {
+			cbs = append(cbs, currencyBalance{currency: currency, balance: newBalance, daily: ds, days: days})
+		}
+	}
+	sort.Slice(cbs, func(i, j int) bool {
+		return cbs[i].currency < cbs[j].currency
+	})
+	return cbs, nil
+}
+
+// spendProportional spends from every currency the balance divided by the total days left, so all
+// balances run out on the same day
+func spendProportional(cbs []currencyBalance) ([]Spending, int64) {
+	total := int64(0)
+	for _, cb := range cbs {
+		total += cb.days
+	}
+	if total == 0 {
+		return nil, 0
+	}
+
+	var ss []Spending
+	for _, cb := range cbs {
+		amount := new(big.Int).Div(cb.balance, big.NewInt(total))
+		if amount.Sign() > 0 {
+			ss = append(ss, Spending{Currency: cb.currency, Amount: amount})
+		}
+	}
+	return ss, total
+}
+
+// spendOrdered spends the daily amount of the first currency in the order that has funds left.
+// Currencies that are not in the order come last, the one that lasts longest first.
+func spendOrdered(cbs []currencyBalance, order []string) ([]Spending, int64) {
+	if len(cbs) == 0 {
+		return nil, 0
+	}
+	sorted := slices.Clone(cbs)
+	rank := func(currency string) int {
+		i := slices.Index(order, currency)
+		if i < 0 {
+			return len(order)
+		}
+		return i
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ri, rj := rank(sorted[i].currency), rank(sorted[j].currency)
+		if ri != rj {
+			return ri < rj
+		}
+		return sorted[i].days > sorted[j].days
+	})
+
+	total := int64(0)
+	for _, cb := range sorted {
+		total += cb.days
+	}
+	return []Spending{{Currency: sorted[0].currency, Amount: sorted[0].daily}}, total
+}
+
+func parseCurrencyOrder(order string) []string {
+	var currencies []string
+	for _, c := range strings.Split(order, ",") {
+		c = strings.ToUpper(strings.TrimSpace(c))
+		if c != "" && !slices.Contains(currencies, c) {
+			currencies = append(currencies, c)
+		}
+	}
+	return currencies
+}
+
+func UpdateSpendingStrategy(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
+	strategyEsc := r.PathValue("strategy")
+	strategy, err := url.QueryUnescape(strategyEsc)
+	if err != nil {
+		slog.Error("Query unescape spending strategy",
+			slog.String("strategy", strategyEsc),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, SpendingStrategyError)
+		return
+	}
+
+	strategy = strings.ToUpper(strategy)
+	if !db.IsValidSpendingStrategy(strategy) {
+		slog.Error("Unknown spending strategy",
+			slog.String("strategy", strategy))
+		util.WriteErrorf(w, http.StatusBadRequest, "Unknown spending strategy, use one of %v", db.SpendingStrategies)
+		return
+	}
+
+	var order *string
+	if strategy == db.SpendingPreferred {
+		currencies := parseCurrencyOrder(r.URL.Query().Get("order"))
+		if len(currencies) == 0 {
+			util.WriteErrorf(w, http.StatusBadRequest, "The preferred strategy needs an order, e.g. ?order=USD,GAS")
+			return
+		}
+		o := strings.Join(currencies, ",")
+		order = &o
+	}
+
+	err = db.UpdateSpendingStrategy(user.Id, &strategy, order)
+	if err != nil {
+		slog.Error("Could not save spending strategy",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, SpendingStrategyError)
+		return
+	}
+}
+
+func DeleteSpendingStrategy(w http.ResponseWriter, _ *http.Request, user *db.UserDetail) {
+	err := db.UpdateSpendingStrategy(user.Id, nil, nil)
+	if err != nil {
+		slog.Error("Could not reset spending strategy",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, SpendingStrategyError)
+		return
+	}
+}
+
+// UserBalanceSummary returns what is left per currency and how many days it lasts with the spending
+// strategy of the user
+func (h *ResourceHandler) UserBalanceSummary(w http.ResponseWriter, _ *http.Request, user *db.UserDetail) {
+	mAdd, err := db.FindPayInBalanceByCurrency(user.Id)
+	if err != nil {
+		slog.Error("Error while finding sum payments by currency", slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, UserBalancesError)
+		return
+	}
+	mFut, err := db.FindSumFutureSponsors(user.Id)
+	if err != nil {
+		slog.Error("Error while finding sum future sponsors", slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, UserBalancesError)
+		return
+	}
+	mSub, err := db.FindSumDailySponsors(user.Id)
+	if err != nil {
+		slog.Error("Error while finding sum daily sponsors", slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, UserBalancesError)
+		return
+	}
+
+	total := map[string]*big.Int{}
+	for currency, b := range mAdd {
+		total[currency] = new(big.Int).Set(b)
+		if mSub[currency] != nil {
+			total[currency] = new(big.Int).Sub(total[currency], mSub[currency])
+		}
+		if mFut[currency] != nil {
+			total[currency] = new(big.Int).Sub(total[currency], mFut[currency])
+		}
+	}
+
+	s := NewSpendingStrategy(h.Config.SpendingStrategy, h.Config.SpendingCostOrder)
+	_, daysLeft, err := s.Spend(user, mAdd, mSub, mFut)
+	if err != nil {
+		slog.Error("Error while calculating days left", slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, UserBalancesError)
+		return
+	}
+
+	runOut, runOutAt, err := runOutDates(user, total, util.TimeNow())
+	if err != nil {
+		slog.Error("Error while projecting the run-out date", slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, UserBalancesError)
+		return
+	}
+
+	dc := displayCurrency(user, h.Config.ExchangeRateBase)
+	displayTotal, err := NewExchangeRates(h.Config.ExchangeRateBase).ConvertTotal(total, dc, util.TimeNow())
+	if err != nil {
+		slog.Error("Error while converting to the display currency", slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, UserBalancesError)
+		return
+	}
+
+	util.WriteJson(w, UserBalances{
+		UserBalances:    []UserBalanceDto{},
+		Total:           total,
+		DaysLeft:        daysLeft,
+		DisplayCurrency: dc,
+		DisplayTotal:    displayTotal,
+		RunOut:          runOut,
+		RunOutAt:        runOutAt,
+	})
+}
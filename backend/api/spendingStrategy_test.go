@@ -0,0 +1,59 @@
+package api
+
+import (
+	"backend/db"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpendProportional(t *testing.T) {
+	cbs := []currencyBalance{
+		{currency: "GAS", balance: big.NewInt(3000), daily: big.NewInt(100), days: 30},
+		{currency: "USD", balance: big.NewInt(1000), daily: big.NewInt(100), days: 10},
+	}
+	ss, days := spendProportional(cbs)
+	assert.Equal(t, int64(40), days)
+	require.Len(t, ss, 2)
+	assert.Equal(t, Spending{Currency: "GAS", Amount: big.NewInt(75)}, ss[0])
+	assert.Equal(t, Spending{Currency: "USD", Amount: big.NewInt(25)}, ss[1])
+
+	ss, days = spendProportional(nil)
+	assert.Equal(t, int64(0), days)
+	assert.Len(t, ss, 0)
+}
+
+func TestSpendOrdered(t *testing.T) {
+	cbs := []currencyBalance{
+		{currency: "ETH", balance: big.NewInt(500), daily: big.NewInt(50), days: 10},
+		{currency: "GAS", balance: big.NewInt(3000), daily: big.NewInt(100), days: 30},
+		{currency: "USD", balance: big.NewInt(1000), daily: big.NewInt(100), days: 10},
+	}
+
+	ss, days := spendOrdered(cbs, []string{"USD", "GAS"})
+	assert.Equal(t, int64(50), days)
+	assert.Equal(t, []Spending{{Currency: "USD", Amount: big.NewInt(100)}}, ss)
+
+	//not in the order, the one that lasts longest first
+	ss, _ = spendOrdered(cbs, []string{"NEO"})
+	assert.Equal(t, []Spending{{Currency: "GAS", Amount: big.NewInt(100)}}, ss)
+}
+
+func TestSpendingStrategyFor(t *testing.T) {
+	s := NewSpendingStrategy("unknown", "usd, gas,USD")
+	u := &db.UserDetail{}
+
+	strategy, order := s.For(u)
+	assert.Equal(t, db.SpendingMax, strategy)
+	assert.Equal(t, []string{"USD", "GAS"}, order)
+
+	preferred := db.SpendingPreferred
+	o := "GAS"
+	u.SpendingStrategy = &preferred
+	u.SpendingOrder = &o
+	strategy, order = s.For(u)
+	assert.Equal(t, db.SpendingPreferred, strategy)
+	assert.Equal(t, []string{"GAS"}, order)
+}
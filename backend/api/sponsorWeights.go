@@ -0,0 +1,112 @@
+package api
+
+import (
+	"backend/db"
+	"backend/util"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SponsorWeightError = "Oops something went wrong with the repository weights. Please try again."
+)
+
+func GetSponsorWeights(w http.ResponseWriter, _ *http.Request, user *db.UserDetail) {
+	sws, err := db.FindSponsorWeightsByUserId(user.Id)
+	if err != nil {
+		slog.Error("Could not find sponsor weights",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, SponsorWeightError)
+		return
+	}
+	util.WriteJson(w, sws)
+}
+
+// UpdateSponsorWeights replaces all weights of the user. Weights are percentages of the daily
+// amount, repos without a weight share the rest equally.
+func UpdateSponsorWeights(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
+	var sws []db.SponsorWeight
+	err := json.NewDecoder(r.Body).Decode(&sws)
+	if err != nil {
+		slog.Error("Error while decoding body",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, GenericErrorMessage)
+		return
+	}
+
+	repos, err := db.FindSponsoredReposByUserId(user.Id)
+	if err != nil {
+		slog.Error("Could not find sponsored repos by user",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, RepositoryNotFoundErrorMessage)
+		return
+	}
+	rids := make([]uuid.UUID, len(repos))
+	for i, v := range repos {
+		rids[i] = v.Id
+	}
+
+	err = validateSponsorWeights(sws, rids)
+	if err != nil {
+		slog.Error("Invalid sponsor weights",
+			slog.String("userId", user.Id.String()),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, "Invalid repository weights: %v", err)
+		return
+	}
+
+	err = db.ReplaceSponsorWeights(user.Id, sws, util.TimeNow())
+	if err != nil {
+		slog.Error("Could not save sponsor weights",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, SponsorWeightError)
+		return
+	}
+}
+
+func DeleteSponsorWeights(w http.ResponseWriter, _ *http.Request, user *db.UserDetail) {
+	err := db.ReplaceSponsorWeights(user.Id, nil, util.TimeNow())
+	if err != nil {
+		slog.Error("Could not reset sponsor weights",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, SponsorWeightError)
+		return
+	}
+}
+
+// validateSponsorWeights checks that every weight belongs to a sponsored repo and that the
+// weights add up to at most 100%. If every sponsored repo has a weight, it has to be exactly 100%.
+func validateSponsorWeights(sws []db.SponsorWeight, rids []uuid.UUID) error {
+	sponsored := map[uuid.UUID]bool{}
+	for _, rid := range rids {
+		sponsored[rid] = true
+	}
+
+	seen := map[uuid.UUID]bool{}
+	sum := int64(0)
+	for _, sw := range sws {
+		if sw.Weight <= 0 || sw.Weight > db.MaxSponsorWeight {
+			return fmt.Errorf("weight of %v must be between 1 and %v", sw.RepoId, db.MaxSponsorWeight)
+		}
+		if !sponsored[sw.RepoId] {
+			return fmt.Errorf("repository %v is not sponsored", sw.RepoId)
+		}
+		if seen[sw.RepoId] {
+			return fmt.Errorf("repository %v is listed twice", sw.RepoId)
+		}
+		seen[sw.RepoId] = true
+		sum += sw.Weight
+	}
+
+	if sum > db.MaxSponsorWeight {
+		return fmt.Errorf("weights sum up to %v, max is %v", sum, db.MaxSponsorWeight)
+	}
+	if len(sws) > 0 && len(seen) == len(sponsored) && sum != db.MaxSponsorWeight {
+		return fmt.Errorf("all repositories have a weight, they must sum up to %v, but are %v", db.MaxSponsorWeight, sum)
+	}
+	return nil
+}
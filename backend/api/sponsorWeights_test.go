@@ -0,0 +1,24 @@
+package api
+
+import (
+	"backend/db"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateSponsorWeights(t *testing.T) {
+	r1, r2 := uuid.New(), uuid.New()
+	rids := []uuid.UUID{r1, r2}
+
+	assert.NoError(t, validateSponsorWeights(nil, rids))
+	assert.NoError(t, validateSponsorWeights([]db.SponsorWeight{{RepoId: r1, Weight: 50}}, rids))
+	assert.NoError(t, validateSponsorWeights([]db.SponsorWeight{{RepoId: r1, Weight: 70}, {RepoId: r2, Weight: 30}}, rids))
+
+	assert.Error(t, validateSponsorWeights([]db.SponsorWeight{{RepoId: r1, Weight: 0}}, rids))
+	assert.Error(t, validateSponsorWeights([]db.SponsorWeight{{RepoId: uuid.New(), Weight: 10}}, rids))
+	assert.Error(t, validateSponsorWeights([]db.SponsorWeight{{RepoId: r1, Weight: 10}, {RepoId: r1, Weight: 10}}, rids))
+	assert.Error(t, validateSponsorWeights([]db.SponsorWeight{{RepoId: r1, Weight: 70}, {RepoId: r2, Weight: 20}}, rids))
+	assert.Error(t, validateSponsorWeights([]db.SponsorWeight{{RepoId: r1, Weight: 70}, {RepoId: r2, Weight: 40}}, rids))
+}
@@ -0,0 +1,305 @@
+package api
+
+import (
+	"backend/client"
+	"backend/db"
+	"backend/util"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	StatementError = "Oops something went wrong with the statement. Please try again."
+)
+
+type StatementHandler struct {
+	e *client.EmailClient
+}
+
+func NewStatementHandler(e *client.EmailClient) *StatementHandler {
+	return &StatementHandler{e}
+}
+
+// Statement is what a contributor earned in a month or a year, with the payouts requested in that time
+type Statement struct {
+	UserId    string                    `json:"userId"`
+	Email     string                    `json:"email"`
+	Period    string                    `json:"period"`
+	From      time.Time                 `json:"from"`
+	To        time.Time                 `json:"to"`
+	Lines     []db.StatementLine        `json:"lines"`
+	Totals    map[string]StatementTotal `json:"totals"`
+	Payouts   []db.PayoutRequest        `json:"payouts"`
+	CreatedAt time.Time                 `json:"createdAt"`
+}
+
+type StatementTotal struct {
+	Earned    *big.Int `json:"earned"`
+	Claimed   *big.Int `json:"claimed"`
+	Unclaimed *big.Int `json:"unclaimed"`
+}
+
+type StatementPeriod struct {
+	Period string `json:"period"`
+	Year   bool   `json:"year"`
+}
+
+// Statements lists the months and years a statement can be downloaded for, newest first
+func Statements(w http.ResponseWriter, _ *http.Request, user *db.UserDetail) {
+	cms, err := db.FindContributionMonths(user.Id, true)
+	if err != nil {
+		slog.Error("Could not find contribution months",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, StatementError)
+		return
+	}
+
+	seen := map[string]bool{}
+	ps := []StatementPeriod{}
+	for i := len(cms) - 1; i >= 0; i-- {
+		m := cms[i].Month.Format("2006-01")
+		y := cms[i].Month.Format("2006")
+		if !seen[y] {
+			seen[y] = true
+			ps = append(ps, StatementPeriod{Period: y, Year: true})
+		}
+		if !seen[m] {
+			seen[m] = true
+			ps = append(ps, StatementPeriod{Period: m})
+		}
+	}
+	util.WriteJson(w, ps)
+}
+
+// GetStatement returns the statement of the period as json, csv or pdf, depending on the format parameter
+func GetStatement(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
+	s, err := buildStatement(user, r.PathValue("period"))
+	if err != nil {
+		slog.Error("Could not build statement",
+			slog.String("period", r.PathValue("period")),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, StatementError)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" || format == "json" {
+		util.WriteJson(w, s)
+		return
+	}
+
+	var b bytes.Buffer
+	contentType, err := writeStatement(&b, s, format)
+	if err != nil {
+		slog.Error("Could not write statement",
+			slog.String("format", format),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, StatementError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+statementFilename(s, format)+"\"")
+	_, err = w.Write(b.Bytes())
+	if err != nil {
+		slog.Error("Could not send statement",
+			slog.Any("error", err))
+	}
+}
+
+// EmailStatement sends the statement of the period to the user, as pdf unless the format parameter says csv
+func (sh *StatementHandler) EmailStatement(w http.ResponseWriter, r *http.Request, user *db.UserDetail) {
+	s, err := buildStatement(user, r.PathValue("period"))
+	if err != nil {
+		slog.Error("Could not build statement",
+			slog.String("period", r.PathValue("period")),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, StatementError)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "pdf"
+	}
+	var b bytes.Buffer
+	contentType, err := writeStatement(&b, s, format)
+	if err != nil {
+		slog.Error("Could not write statement",
+			slog.String("format", format),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, StatementError)
+		return
+	}
+
+	err = sh.e.SendStatement(*user, s.Period, statementFilename(s, format), contentType, b.Bytes())
+	if err != nil {
+		slog.Error("Could not send statement",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, StatementError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// parsePeriod accepts a month as 2006-01 or a year as 2006 and returns the start and the exclusive end
+func parsePeriod(period string) (time.Time, time.Time, error) {
+	if t, err := time.Parse("2006-01", period); err == nil {
+		return t, t.AddDate(0, 1, 0), nil
+	}
+	if len(period) == 4 {
+		if t, err := time.Parse("2006", period); err == nil {
+			return t, t.AddDate(1, 0, 0), nil
+		}
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("period %v is neither a month (YYYY-MM) nor a year (YYYY)", period)
+}
+
+func buildStatement(user *db.UserDetail, period string) (*Statement, error) {
+	from, to, err := parsePeriod(period)
+	if err != nil {
+		return nil, err
+	}
+
+	ls, err := db.FindStatementLines(user.Id, from, to)
+	if err != nil {
+		return nil, err
+	}
+	totals := map[string]StatementTotal{}
+	for _, l := range ls {
+		t, ok := totals[l.Currency]
+		if !ok {
+			t = StatementTotal{Earned: new(big.Int), Claimed: new(big.Int), Unclaimed: new(big.Int)}
+			totals[l.Currency] = t
+		}
+		t.Earned.Add(t.Earned, l.Earned)
+		t.Claimed.Add(t.Claimed, l.Claimed)
+		t.Unclaimed.Add(t.Unclaimed, l.Unclaimed)
+	}
+
+	prs, err := db.FindPayoutRequestsByUserId(user.Id)
+	if err != nil {
+		return nil, err
+	}
+	ps := []db.PayoutRequest{}
+	for _, p := range prs {
+		if !p.CreatedAt.Before(from) && p.CreatedAt.Before(to) {
+			ps = append(ps, p)
+		}
+	}
+
+	return &Statement{
+		UserId:    user.Id.String(),
+		Email:     user.Email,
+		Period:    period,
+		From:      from,
+		To:        to,
+		Lines:     ls,
+		Totals:    totals,
+		Payouts:   ps,
+		CreatedAt: util.TimeNow(),
+	}, nil
+}
+
+func statementFilename(s *Statement, format string) string {
+	return "statement-" + s.Period + "." + format
+}
+
+func writeStatement(w io.Writer, s *Statement, format string) (string, error) {
+	switch format {
+	case "csv":
+		return "text/csv", writeStatementCsv(w, s)
+	case "pdf":
+		return "application/pdf", writeStatementPdf(w, s)
+	default:
+		return "", fmt.Errorf("unknown statement format %v", format)
+	}
+}
+
+func sortedCurrencies(totals map[string]StatementTotal) []string {
+	cs := make([]string, 0, len(totals))
+	for c := range totals {
+		cs = append(cs, c)
+	}
+	sort.Strings(cs)
+	return cs
+}
+
+// writeStatementCsv writes one row per line, followed by the totals per currency and the payouts. The
+// amounts are written as decimals of the currency.
+func writeStatementCsv(w io.Writer, s *Statement) error {
+	cw := csv.NewWriter(w)
+	records := [][]string{
+		{"type", "repo", "sponsor", "foundation", "currency", "earned", "claimed", "unclaimed", "days", "date", "address", "signature"},
+	}
+	for _, l := range s.Lines {
+		records = append(records, []string{"contribution", l.RepoName, l.SponsorName, strconv.FormatBool(l.Foundation),
+			l.Currency, util.FormatAmount(l.Earned, l.Currency), util.FormatAmount(l.Claimed, l.Currency),
+			util.FormatAmount(l.Unclaimed, l.Currency), strconv.Itoa(l.Days), "", "", ""})
+	}
+	for _, c := range sortedCurrencies(s.Totals) {
+		t := s.Totals[c]
+		records = append(records, []string{"total", "", "", "", c, util.FormatAmount(t.Earned, c),
+			util.FormatAmount(t.Claimed, c), util.FormatAmount(t.Unclaimed, c), "", "", "", ""})
+	}
+	for _, p := range s.Payouts {
+		records = append(records, []string{"payout", "", "", "", p.Currency, util.FormatAmount(p.Amount, p.Currency),
+			"", "", "", p.CreatedAt.Format(time.DateOnly), p.Address, p.Signature})
+	}
+	err := cw.WriteAll(records)
+	if err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+func writeStatementPdf(w io.Writer, s *Statement) error {
+	lines := []string{
+		"Contributor: " + s.Email,
+		"Period:      " + s.From.Format(time.DateOnly) + " - " + s.To.AddDate(0, 0, -1).Format(time.DateOnly),
+		"Created:     " + s.CreatedAt.Format(time.DateTime),
+		"",
+		fmt.Sprintf("%-24.24s %-20.20s %-4s %20s %20s %20s", "Repository", "Sponsor", "Cur", "Earned", "Claimed", "Unclaimed"),
+	}
+	for _, l := range s.Lines {
+		sponsor := l.SponsorName
+		if l.Foundation {
+			sponsor += " (foundation)"
+		}
+		lines = append(lines, fmt.Sprintf("%-24.24s %-20.20s %-4s %20s %20s %20s", l.RepoName, sponsor, l.Currency,
+			util.FormatAmount(l.Earned, l.Currency), util.FormatAmount(l.Claimed, l.Currency),
+			util.FormatAmount(l.Unclaimed, l.Currency)))
+	}
+
+	lines = append(lines, "", "Totals")
+	for _, c := range sortedCurrencies(s.Totals) {
+		t := s.Totals[c]
+		lines = append(lines, fmt.Sprintf("%-24.24s %-20.20s %-4s %20s %20s %20s", "", "", c,
+			util.FormatAmount(t.Earned, c), util.FormatAmount(t.Claimed, c), util.FormatAmount(t.Unclaimed, c)))
+	}
+
+	if len(s.Payouts) > 0 {
+		lines = append(lines, "", "Payouts")
+		for _, p := range s.Payouts {
+			lines = append(lines, fmt.Sprintf("%-10s %-4s %20s  %s", p.CreatedAt.Format(time.DateOnly), p.Currency,
+				util.FormatAmount(p.Amount, p.Currency), p.Address))
+			//signatures are longer than a line, so they are wrapped
+			for i := 0; i < len(p.Signature); i += 64 {
+				prefix := "           "
+				if i == 0 {
+					prefix = "signature: "
+				}
+				lines = append(lines, prefix+p.Signature[i:min(i+64, len(p.Signature))])
+			}
+		}
+	}
+
+	return util.WritePdf(w, "Earnings statement "+s.Period, lines)
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"backend/client"
+	"backend/db"
+	"backend/util"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SubscriptionError = "Oops something went wrong with the subscription. Please try again."
+)
+
+// SubscriptionPolicy is the dunning of the deployment. A failed renewal is retried after each of the
+// retry days, when the last retry failed the subscription is in grace for the grace days and canceled
+// afterwards. Distribution continues while a renewal is past due or in grace.
+type SubscriptionPolicy struct {
+	retryDays []int
+	graceDays int
+}
+
+// NewSubscriptionPolicy takes the retry days as comma separated list, e.g. 1,3,5
+func NewSubscriptionPolicy(retryDays string, graceDays int) *SubscriptionPolicy {
+	var rds []int
+	for _, d := range strings.Split(retryDays, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(d))
+		if err != nil || n <= 0 {
+			continue
+		}
+		rds = append(rds, n)
+	}
+	return &SubscriptionPolicy{retryDays: rds, graceDays: graceDays}
+}
+
+// Charged marks the renewal with the externalId as pending, until stripe reports the outcome
+func (sp *SubscriptionPolicy) Charged(s db.Subscription, externalId uuid.UUID, now time.Time) db.Subscription {
+	s.ExternalId = &externalId
+	s.RenewAt = nil
+	s.UpdatedAt = now
+	return s
+}
+
+// Failed moves the subscription to the next dunning step, a retry as long as there are retries left,
+// the grace period afterwards
+func (sp *SubscriptionPolicy) Failed(s db.Subscription, now time.Time) db.Subscription {
+	s.UpdatedAt = now
+	if s.Retries < len(sp.retryDays) {
+		retryAt := now.AddDate(0, 0, sp.retryDays[s.Retries])
+		s.Status = db.SubscriptionPastDue
+		s.Retries++
+		s.RenewAt = &retryAt
+		return s
+	}
+	graceUntil := now.AddDate(0, 0, sp.graceDays)
+	s.Status = db.SubscriptionGrace
+	s.RenewAt = nil
+	s.GraceUntil = &graceUntil
+	return s
+}
+
+// Renewed activates the subscription after a successful payment, a new subscription is started for a
+// sponsor without one
+func (sp *SubscriptionPolicy) Renewed(s *db.Subscription, userId uuid.UUID, now time.Time) db.Subscription {
+	if s == nil {
+		s = &db.Subscription{UserId: userId, CreatedAt: now}
+	}
+	return db.Subscription{
+		UserId:    s.UserId,
+		Status:    db.SubscriptionActive,
+		UpdatedAt: now,
+		CreatedAt: s.CreatedAt,
+	}
+}
+
+// SubscriptionFailed stores the next dunning step of the failed renewal and sends the dunning email
+func SubscriptionFailed(e *client.EmailClient, sp *SubscriptionPolicy, s db.Subscription, u db.UserDetail, now time.Time) error {
+	s = sp.Failed(s, now)
+	err := db.UpsertSubscription(s)
+	if err != nil {
+		return err
+	}
+	slog.Info("Subscription renewal failed",
+		slog.String("userId", u.Id.String()),
+		slog.String("status", s.Status),
+		slog.Int("retries", s.Retries))
+
+	if s.Status == db.SubscriptionPastDue {
+		err = e.SendSubscriptionPastDue(u, *s.RenewAt, s.Retries)
+	} else {
+		err = e.SendSubscriptionGrace(u, *s.GraceUntil)
+	}
+	if err != nil {
+		slog.Warn("Could not send dunning email",
+			slog.String("userId", u.Id.String()),
+			slog.Any("error", err))
+	}
+	return nil
+}
+
+// subscriptionRenewed activates the subscription of the user after the pay-in with the externalId
+// succeeded. A renewal that was charged before the user canceled does not activate it again.
+func subscriptionRenewed(sp *SubscriptionPolicy, userId uuid.UUID, externalId uuid.UUID) error {
+	s, err := db.FindSubscription(userId)
+	if err != nil {
+		return err
+	}
+	if s != nil && s.Status == db.SubscriptionCanceled && s.ExternalId != nil && *s.ExternalId == externalId {
+		return nil
+	}
+	return db.UpsertSubscription(sp.Renewed(s, userId, util.TimeNow()))
+}
+
+// CancelSubscription stops the renewals, the balance is still spent until it runs out
+func CancelSubscription(w http.ResponseWriter, _ *http.Request, user *db.UserDetail) {
+	s, err := db.FindSubscription(user.Id)
+	if err != nil {
+		slog.Error("Could not find subscription",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, SubscriptionError)
+		return
+	}
+	if s == nil {
+		util.WriteErrorf(w, http.StatusNotFound, "No subscription found.")
+		return
+	}
+	err = db.CancelSubscription(user.Id, util.TimeNow())
+	if err != nil {
+		slog.Error("Could not cancel subscription",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, SubscriptionError)
+		return
+	}
+}
+
+// ResumeSubscription starts the renewals with the stored card again. A subscription that is past due
+// or in grace is retried right away, e.g. after the card was changed.
+func (sp *SubscriptionPolicy) ResumeSubscription(w http.ResponseWriter, _ *http.Request, user *db.UserDetail) {
+	if user.StripeId == nil || user.PaymentMethod == nil {
+		util.WriteErrorf(w, http.StatusBadRequest, "Please add a credit card first.")
+		return
+	}
+	s, err := db.FindSubscription(user.Id)
+	if err != nil {
+		slog.Error("Could not find subscription",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, SubscriptionError)
+		return
+	}
+
+	now := util.TimeNow()
+	var r db.Subscription
+	if s == nil || s.Status == db.SubscriptionCanceled {
+		r = sp.Renewed(s, user.Id, now)
+	} else {
+		r = *s
+		if r.Status != db.SubscriptionActive {
+			r.Status = db.SubscriptionPastDue
+			r.RenewAt = &now
+			r.UpdatedAt = now
+		}
+	}
+	err = db.UpsertSubscription(r)
+	if err != nil {
+		slog.Error("Could not resume subscription",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, SubscriptionError)
+		return
+	}
+	util.WriteJson(w, r)
+}
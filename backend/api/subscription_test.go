@@ -0,0 +1,56 @@
+package api
+
+import (
+	"backend/db"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriptionDunning(t *testing.T) {
+	sp := NewSubscriptionPolicy("1, 3,x", 7)
+	now := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	uid := uuid.New()
+
+	s := sp.Renewed(nil, uid, now)
+	assert.Equal(t, uid, s.UserId)
+	assert.Equal(t, db.SubscriptionActive, s.Status)
+
+	e := uuid.New()
+	s = sp.Charged(s, e, now)
+	assert.True(t, s.Pending(e))
+	assert.False(t, s.Pending(uuid.New()))
+
+	//first retry after 1 day
+	s = sp.Failed(s, now)
+	assert.Equal(t, db.SubscriptionPastDue, s.Status)
+	assert.Equal(t, 1, s.Retries)
+	require.NotNil(t, s.RenewAt)
+	assert.Equal(t, now.AddDate(0, 0, 1), *s.RenewAt)
+	assert.False(t, s.Pending(e))
+
+	//second retry after 3 days
+	s = sp.Failed(s, now)
+	assert.Equal(t, db.SubscriptionPastDue, s.Status)
+	assert.Equal(t, 2, s.Retries)
+	assert.Equal(t, now.AddDate(0, 0, 3), *s.RenewAt)
+
+	//no retries left, grace for 7 days
+	s = sp.Failed(s, now)
+	assert.Equal(t, db.SubscriptionGrace, s.Status)
+	assert.Nil(t, s.RenewAt)
+	require.NotNil(t, s.GraceUntil)
+	assert.Equal(t, now.AddDate(0, 0, 7), *s.GraceUntil)
+
+	//a payment ends the dunning
+	created := s.CreatedAt
+	s = sp.Renewed(&s, uid, now.AddDate(0, 0, 2))
+	assert.Equal(t, db.SubscriptionActive, s.Status)
+	assert.Equal(t, 0, s.Retries)
+	assert.Nil(t, s.GraceUntil)
+	assert.Nil(t, s.ExternalId)
+	assert.Equal(t, created, s.CreatedAt)
+}
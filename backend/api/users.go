@@ -41,8 +41,21 @@ func GetUserById(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+// MyUser is the user with the state of the subscription, which is nil if the user never subscribed
+type MyUser struct {
+	*db.UserDetail
+	Subscription *db.Subscription `json:"subscription"`
+}
+
 func GetMyUser(w http.ResponseWriter, _ *http.Request, user *db.UserDetail) {
-	util.WriteJson(w, user)
+	s, err := db.FindSubscription(user.Id)
+	if err != nil {
+		slog.Error("Could not find subscription",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, GenericErrorMessage)
+		return
+	}
+	util.WriteJson(w, MyUser{UserDetail: user, Subscription: s})
 }
 
 func DeleteMethod(w http.ResponseWriter, _ *http.Request, user *db.UserDetail) {
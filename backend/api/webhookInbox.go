@@ -0,0 +1,114 @@
+package api
+
+import (
+	"backend/db"
+	"backend/util"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+const (
+	WebhookError    = "Oops something went wrong with the webhook events. Please try again."
+	webhookEventMax = 100
+)
+
+// storeWebhookEvent puts a verified delivery in the inbox, a delivery that was stored before is ignored
+func storeWebhookEvent(provider string, eventId string, eventType string, payload []byte) error {
+	now := util.TimeNow()
+	ok, err := db.InsertWebhookEvent(db.WebhookEvent{
+		Id:            uuid.New(),
+		Provider:      provider,
+		EventId:       eventId,
+		EventType:     eventType,
+		Payload:       payload,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		slog.Info("Webhook event delivered again",
+			slog.String("provider", provider),
+			slog.String("eventId", eventId))
+	}
+	return nil
+}
+
+// WebhookEvents returns the latest webhook events, ?status= filters them, e.g. FAILED, ?limit= sets the
+// number of events
+func WebhookEvents(w http.ResponseWriter, r *http.Request, _ *db.UserDetail) {
+	status := r.URL.Query().Get("status")
+	if status != "" && status != db.WebhookPending && status != db.WebhookProcessed && status != db.WebhookFailed {
+		slog.Error("Invalid status",
+			slog.String("status", status))
+		util.WriteErrorf(w, http.StatusBadRequest, WebhookError)
+		return
+	}
+	limit := webhookEventMax
+	if l := r.URL.Query().Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit <= 0 || limit > webhookEventMax {
+			slog.Error("Invalid limit",
+				slog.String("limit", l))
+			util.WriteErrorf(w, http.StatusBadRequest, WebhookError)
+			return
+		}
+	}
+
+	es, err := db.FindWebhookEvents(status, limit)
+	if err != nil {
+		slog.Error("Could not find webhook events",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, WebhookError)
+		return
+	}
+	util.WriteJson(w, es)
+}
+
+// ReplayWebhookEvent processes a failed event again with the next run of the webhook runner
+func ReplayWebhookEvent(w http.ResponseWriter, r *http.Request, _ *db.UserDetail) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		slog.Error("Invalid webhook event id",
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusBadRequest, WebhookError)
+		return
+	}
+
+	e, err := db.FindWebhookEvent(id)
+	if err != nil {
+		slog.Error("Could not find webhook event",
+			slog.String("id", id.String()),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, WebhookError)
+		return
+	}
+	if e == nil {
+		util.WriteErrorf(w, http.StatusNotFound, "Webhook event not found.")
+		return
+	}
+
+	now := util.TimeNow()
+	ok, err := db.ReplayWebhookEvent(id, now)
+	if err != nil {
+		slog.Error("Could not replay webhook event",
+			slog.String("id", id.String()),
+			slog.Any("error", err))
+		util.WriteErrorf(w, http.StatusInternalServerError, WebhookError)
+		return
+	}
+	if !ok {
+		util.WriteErrorf(w, http.StatusConflict, "Only failed webhook events can be replayed.")
+		return
+	}
+
+	e.Status = db.WebhookPending
+	e.Attempts = 0
+	e.NextAttemptAt = now
+	util.WriteJson(w, e)
+}
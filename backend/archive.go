@@ -0,0 +1,37 @@
+package main
+
+import (
+	"backend/db"
+	"backend/util"
+	"log/slog"
+	"time"
+)
+
+type ArchiveHandler struct {
+	months int
+}
+
+func NewArchiveHandler(months int) *ArchiveHandler {
+	return &ArchiveHandler{months}
+}
+
+// ArchiveRunner moves the per-day contributions of the months that are older than the policy to the
+// archive. The summaries read the monthly rollups and do not change.
+func (a *ArchiveHandler) ArchiveRunner(now time.Time) error {
+	before := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -a.months, 0)
+	months, err := db.FindArchivableMonths(before)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range months {
+		nr, err := db.ArchiveContributionMonth(m, util.TimeNow())
+		if err != nil {
+			return err
+		}
+		slog.Info("Archived contributions",
+			slog.String("month", m.Format("2006-01")),
+			slog.Int64("nr", nr))
+	}
+	return nil
+}
@@ -3,23 +3,34 @@ package main
 import (
 	api2 "backend/api"
 	"backend/client"
+	"backend/config"
 	"backend/db"
 	"backend/util"
 	"fmt"
 	"log/slog"
 	"math/big"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type CalcHandler struct {
-	ac *client.AnalysisClient
-	ec *client.EmailClient
+	ac       *client.AnalysisClient
+	ec       *client.EmailClient
+	cfg      *config.Config
+	spending *api2.SpendingStrategy
 }
 
-func NewCalcHandler(ac *client.AnalysisClient, ec *client.EmailClient) *CalcHandler {
-	return &CalcHandler{ac, ec}
+type currencyShare struct {
+	currency                 string
+	distributeDeduct         map[uuid.UUID]*big.Int
+	distributeAdd            map[uuid.UUID]*big.Int
+	deductFutureContribution map[uuid.UUID]*big.Int
+}
+
+func NewCalcHandler(ac *client.AnalysisClient, ec *client.EmailClient, cfg *config.Config) *CalcHandler {
+	return &CalcHandler{ac, ec, cfg, api2.NewSpendingStrategy(cfg.SpendingStrategy, cfg.SpendingCostOrder)}
 }
 
 func (c *CalcHandler) HourlyRunner(now time.Time) error {
@@ -55,58 +66,224 @@ func (c *CalcHandler) DailyRunner(now time.Time) error {
 		slog.Any("time-start", yesterdayStart),
 		slog.Any("time-stop", yesterdayStop))
 
+	action, err := c.bookDay(yesterdayStart, nil)
+	if err != nil {
+		return err
+	}
+	if action == ActionSkip {
+		return fmt.Errorf("day %v is already booked", yesterdayStart.Format(time.DateOnly))
+	}
+
+	//aggregate marketing emails
+	ms, err := db.FindMarketingEmails()
+	for _, v := range ms {
+		if err != nil {
+			return err
+		}
+		repoNames := []string{}
+		//TODO: fetch repo names
+		err = c.ec.SendMarketingEmail(v.Email, v.Balances, repoNames)
+	}
+
+	return nil
+}
+
+// bookDay distributes the sponsoring of one day exactly once. A day that is booked already is skipped,
+// and a day where a previous run failed halfway is reversed first, so it is not booked twice. The
+// userId is the admin who replayed the day, nil for the daily runner.
+func (c *CalcHandler) bookDay(yesterdayStart time.Time, userId *uuid.UUID) (string, error) {
+	action := ActionBook
+	d, err := db.FindDistributionDay(yesterdayStart)
+	if err != nil {
+		return "", err
+	}
+	if d == nil {
+		booked, err := db.HasDistribution(yesterdayStart)
+		if err != nil {
+			return "", err
+		}
+		if booked {
+			return ActionSkip, db.MarkDistributionDayBooked(yesterdayStart, util.TimeNow())
+		}
+	} else {
+		switch d.Status {
+		case db.DistributionBooked:
+			return ActionSkip, nil
+		case db.DistributionBooking:
+			slog.Warn("Previous booking of the day failed, reversing it",
+				slog.Any("day", yesterdayStart))
+			generation, err := db.ReverseDistributionDay(yesterdayStart, util.TimeNow())
+			if err != nil {
+				return "", err
+			}
+			err = insertDistributionEvent(yesterdayStart, ActionReverse, generation, userId)
+			if err != nil {
+				return "", err
+			}
+			action = ActionRepair
+		}
+	}
+
+	generation, err := db.StartDistributionDay(yesterdayStart, util.TimeNow())
+	if err != nil {
+		return "", err
+	}
+	err = c.distribute(yesterdayStart)
+	if err != nil {
+		return "", err
+	}
+	err = db.FinishDistributionDay(yesterdayStart, util.TimeNow())
+	if err != nil {
+		return "", err
+	}
+	return action, insertDistributionEvent(yesterdayStart, action, generation, userId)
+}
+
+// distribute books the sponsoring of all sponsors of the day. The weights of the repos are resolved once
+// for the whole run, and the sponsors are booked by several workers. Sponsors who are paid by the same
+// user are booked by the same worker one after the other, as each of them spends from the same balance.
+// The foundations match the sponsors afterwards one by one, as they check their limits on what is booked.
+func (c *CalcHandler) distribute(yesterdayStart time.Time) error {
+	yesterdayStop := yesterdayStart.AddDate(0, 0, 1)
 	sponsorResults, err := db.FindSponsorsBetween(yesterdayStart, yesterdayStop)
 	if err != nil {
 		return err
 	}
 
-	nr := 0
-	for key, _ := range sponsorResults {
-		if len(sponsorResults[key].RepoIds) > 0 {
-			err = c.calcContribution(sponsorResults[key].UserId, sponsorResults[key].RepoIds, yesterdayStart)
-			nr++
+	wc := newWeightCache()
+	var rids []uuid.UUID
+	var uids []uuid.UUID
+	for _, s := range sponsorResults {
+		rids = append(rids, s.RepoIds...)
+		uids = append(uids, s.UserId)
+	}
+	err = wc.load(rids)
+	if err != nil {
+		return err
+	}
+
+	payerIds, err := db.FindPayerIds(uids)
+	if err != nil {
+		return err
+	}
+	groups := groupByPayer(sponsorResults, payerIds)
+	var payers []uuid.UUID
+	for _, g := range groups {
+		payers = append(payers, payerIds[g[0].UserId])
+	}
+	orgIds, err := db.FindOrganizationPayers(payers)
+	if err != nil {
+		return err
+	}
+
+	var nr atomic.Int64
+	err = runWorkers(c.cfg.DailyWorkers, groups, func(g []db.SponsorResult) error {
+		payerId := payerIds[g[0].UserId]
+		if orgId, ok := orgIds[payerId]; ok {
+			err := c.calcOrganization(orgId, payerId, g, yesterdayStart, wc)
 			if err != nil {
 				return err
 			}
-			allFoundationsPerUser, parts, err := db.GetAllFoundationsSupportingRepos(sponsorResults[key].RepoIds)
+			nr.Add(int64(len(g)))
+			return nil
+		}
+		for _, s := range g {
+			err := c.calcContribution(s.UserId, s.RepoIds, yesterdayStart, wc)
 			if err != nil {
 				return err
 			}
-			slog.Info("Parts for Multiplier",
-				slog.Int("parts", parts))
-			if len(allFoundationsPerUser) > 0 {
-				err = c.calcMultiplier(sponsorResults[key].UserId, parts, yesterdayStart)
-				if err != nil {
-					return err
-				}
-			}
+			nr.Add(1)
 		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	slog.Info("Daily runner inserted",
-		slog.Int("nr", nr))
-
-	//aggregate marketing emails
-	ms, err := db.FindMarketingEmails()
-	for _, v := range ms {
+	for _, s := range sponsorResults {
+		if len(s.RepoIds) == 0 {
+			continue
+		}
+		allFoundationsPerUser, parts, err := db.GetAllFoundationsSupportingRepos(s.RepoIds)
 		if err != nil {
 			return err
 		}
-		repoNames := []string{}
-		//TODO: fetch repo names
-		err = c.ec.SendMarketingEmail(v.Email, v.Balances, repoNames)
+		slog.Info("Parts for Multiplier",
+			slog.Int("parts", parts))
+		if len(allFoundationsPerUser) > 0 {
+			err = c.calcMultiplier(s.UserId, parts, yesterdayStart, wc)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
+	slog.Info("Daily runner inserted",
+		slog.Int64("nr", nr.Load()))
 	return nil
 }
 
-func (c *CalcHandler) calcMultiplier(uid uuid.UUID, parts int, yesterdayStart time.Time) error {
+// groupByPayer groups the sponsors by the user whose balance they spend, keeping the order of the sponsors
+func groupByPayer(sponsorResults []db.SponsorResult, payerIds map[uuid.UUID]uuid.UUID) [][]db.SponsorResult {
+	var groups [][]db.SponsorResult
+	index := map[uuid.UUID]int{}
+	for _, s := range sponsorResults {
+		if len(s.RepoIds) == 0 {
+			continue
+		}
+		payerId, ok := payerIds[s.UserId]
+		if !ok {
+			payerId = s.UserId
+		}
+		i, ok := index[payerId]
+		if !ok {
+			i = len(groups)
+			index[payerId] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], s)
+	}
+	return groups
+}
+
+// rollUpSelections merges the repos the members of an organization selected. A repo is weighted by the
+// number of members that selected it.
+func rollUpSelections(g []db.SponsorResult) ([]uuid.UUID, map[uuid.UUID]int64) {
+	var rids []uuid.UUID
+	weights := map[uuid.UUID]int64{}
+	for _, s := range g {
+		for _, rid := range s.RepoIds {
+			if weights[rid] == 0 {
+				rids = append(rids, rid)
+			}
+			weights[rid]++
+		}
+	}
+	return rids, weights
+}
+
+// calcOrganization books one distribution for all members of the organization, paid by its payer
+func (c *CalcHandler) calcOrganization(orgId uuid.UUID, payerId uuid.UUID, g []db.SponsorResult, yesterdayStart time.Time, wc *weightCache) error {
+	u, err := db.FindUserById(payerId)
+	if err != nil {
+		return fmt.Errorf("cannot find payer of organization %v: %v", orgId, err)
+	}
+	rids, weights := rollUpSelections(g)
+	slog.Info("Organization supports repos",
+		slog.String("organizationId", orgId.String()),
+		slog.String("email", u.Email),
+		slog.Int("members", len(g)),
+		slog.Int("len(rids)", len(rids)))
+	return c.deduct(u, rids, weights, yesterdayStart, nil, wc)
+}
+
+func (c *CalcHandler) calcMultiplier(uid uuid.UUID, parts int, yesterdayStart time.Time, wc *weightCache) error {
 	currentSponsorDonations, err := db.GetUserDonationRepos(uid, yesterdayStart, false)
 	if err != nil {
 		return err
 	}
 
-	err = calcAndDeductFoundation(currentSponsorDonations, parts, yesterdayStart, false)
+	err = calcAndDeductFoundation(currentSponsorDonations, parts, yesterdayStart, false, wc)
 	if err != nil {
 		return err
 	}
@@ -116,7 +293,7 @@ func (c *CalcHandler) calcMultiplier(uid uuid.UUID, parts int, yesterdayStart ti
 		return err
 	}
 
-	err = calcAndDeductFoundation(futureSponsorDonations, parts, yesterdayStart, true)
+	err = calcAndDeductFoundation(futureSponsorDonations, parts, yesterdayStart, true, wc)
 	if err != nil {
 		return err
 	}
@@ -124,7 +301,7 @@ func (c *CalcHandler) calcMultiplier(uid uuid.UUID, parts int, yesterdayStart ti
 	return nil
 }
 
-func calcAndDeductFoundation(sponsorDonations map[uuid.UUID][]db.UserDonationRepo, parts int, yesterdayStart time.Time, futureContribution bool) error {
+func calcAndDeductFoundation(sponsorDonations map[uuid.UUID][]db.UserDonationRepo, parts int, yesterdayStart time.Time, futureContribution bool, wc *weightCache) error {
 	for _, currencyBlock := range sponsorDonations {
 		for _, block := range currencyBlock {
 			if len(block.TrustedRepoSelected) > 0 {
@@ -142,7 +319,7 @@ func calcAndDeductFoundation(sponsorDonations map[uuid.UUID][]db.UserDonationRep
 				}
 				amountPerPart := new(big.Int).Quo(pool, big.NewInt(int64(parts)))
 
-				err := doDeductFoundation(allRepos, yesterdayStart, block.Currency, amountPerPart, payoutlimit, futureContribution)
+				err := doDeductFoundation(allRepos, yesterdayStart, block.Currency, amountPerPart, payoutlimit, futureContribution, wc)
 				return err
 			}
 		}
@@ -150,7 +327,7 @@ func calcAndDeductFoundation(sponsorDonations map[uuid.UUID][]db.UserDonationRep
 	return nil
 }
 
-func (c *CalcHandler) calcContribution(uid uuid.UUID, rids []uuid.UUID, yesterdayStart time.Time) error {
+func (c *CalcHandler) calcContribution(uid uuid.UUID, rids []uuid.UUID, yesterdayStart time.Time, wc *weightCache) error {
 	u, err := db.FindUserById(uid)
 	if err != nil {
 		return fmt.Errorf("cannot find user %v", err)
@@ -165,22 +342,66 @@ func (c *CalcHandler) calcContribution(uid uuid.UUID, rids []uuid.UUID, yesterda
 			slog.String("email", u.Email),
 			slog.String("email", u1.Email),
 			slog.Int("len(rids)", len(rids)))
-		return c.calcAndDeduct(u1, rids, yesterdayStart, u)
+		return c.calcAndDeduct(u1, rids, yesterdayStart, u, wc)
 	}
 	//TODO: also notify the not only the parent of insufficient funds
 	slog.Debug("User supports repos",
 		slog.String("email", u.Email),
 		slog.Int("len(rids)", len(rids)))
-	return c.calcAndDeduct(u, rids, yesterdayStart, nil)
+	return c.calcAndDeduct(u, rids, yesterdayStart, nil, wc)
 }
 
-func (c *CalcHandler) calcAndDeduct(u *db.UserDetail, rids []uuid.UUID, yesterdayStart time.Time, uOrig *db.UserDetail) error {
-	currency, freq, distributeDeduct, distributeAdd, deductFutureContribution, err := calcShare(u.Id, int64(len(rids)))
+func (c *CalcHandler) calcAndDeduct(u *db.UserDetail, rids []uuid.UUID, yesterdayStart time.Time, uOrig *db.UserDetail, wc *weightCache) error {
+	//the weights are chosen by the user who picked the repos, the invitee if there is one
+	weightUserId := u.Id
+	if uOrig != nil {
+		weightUserId = uOrig.Id
+	}
+	weights, err := db.FindSponsorWeights(weightUserId)
+	if err != nil {
+		return fmt.Errorf("cannot find sponsor weights %v", err)
+	}
+	return c.deduct(u, rids, weights, yesterdayStart, uOrig, wc)
+}
+
+func (c *CalcHandler) deduct(u *db.UserDetail, rids []uuid.UUID, weights map[uuid.UUID]int64, yesterdayStart time.Time, uOrig *db.UserDetail, wc *weightCache) error {
+	if u.SpendingStopAt != nil && !yesterdayStart.Before(*u.SpendingStopAt) {
+		slog.Info("Sponsor stopped spending",
+			slog.String("userId", u.Id.String()),
+			slog.Time("stopAt", *u.SpendingStopAt))
+		return nil
+	}
+
+	freq, shares, err := c.calcShare(u, rids, weights)
 	if err != nil {
 		return fmt.Errorf("cannot calc share %v", err)
 	}
+	//the caps come first, a capped sponsor spends less and the balance lasts longer
+	freq, shares, err = capShares(u, freq, shares, yesterdayStart)
+	if err != nil {
+		return fmt.Errorf("cannot cap share %v", err)
+	}
+
+	sub, err := db.FindSubscription(u.Id)
+	if err != nil {
+		return fmt.Errorf("cannot find subscription %v", err)
+	}
+	renews, err := c.scheduleRenewal(sub, freq, yesterdayStart)
+	if err != nil {
+		return fmt.Errorf("cannot schedule renewal %v", err)
+	}
+	if freq == 0 && sub != nil && (sub.Status == db.SubscriptionPastDue || sub.Status == db.SubscriptionGrace) {
+		freq, shares, err = creditShare(u, rids, weights)
+		if err != nil {
+			return fmt.Errorf("cannot calc credit share %v", err)
+		}
+		freq, shares, err = capShares(u, freq, shares, yesterdayStart)
+		if err != nil {
+			return fmt.Errorf("cannot cap credit share %v", err)
+		}
+	}
 
-	if freq <= 1 {
+	if freq <= 1 && !renews {
 		slog.Info("1 day or less left, top up!",
 			slog.String("email", u.Email),
 			slog.String("userId", u.Id.String()))
@@ -192,8 +413,23 @@ func (c *CalcHandler) calcAndDeduct(u *db.UserDetail, rids []uuid.UUID, yesterda
 			slog.String("email", u.Email),
 			slog.String("userId", u.Id.String()),
 			slog.Any("rids", rids))
-		err = doDeduct(u.Id, rids, yesterdayStart, currency, distributeDeduct, distributeAdd, deductFutureContribution)
-		return err
+		//the rows of all currencies are inserted at once, before the next sponsor of the payer is booked
+		b := &db.ContributionBatch{}
+		for _, cs := range shares {
+			allRids, distributeDeduct, distributeAdd, deductFutureContribution, flows, err := c.flowToDependencies(rids, cs.distributeDeduct, cs.distributeAdd, cs.deductFutureContribution)
+			if err != nil {
+				return fmt.Errorf("cannot flow to dependencies %v", err)
+			}
+			err = doDeduct(b, wc, u.Id, allRids, yesterdayStart, cs.currency, distributeDeduct, distributeAdd, deductFutureContribution)
+			if err != nil {
+				return err
+			}
+			addDependencyFlows(b, u.Id, cs.currency, yesterdayStart, flows)
+		}
+		err = db.InsertContributionBatch(b)
+		if err != nil {
+			return err
+		}
 	} else {
 		slog.Debug("User is out of funds",
 			slog.String("userId", u.Id.String()))
@@ -201,10 +437,10 @@ func (c *CalcHandler) calcAndDeduct(u *db.UserDetail, rids []uuid.UUID, yesterda
 	return nil
 }
 
-func doDeductFoundation(rids []uuid.UUID, yesterdayStart time.Time, currency string, amountPerPart *big.Int, payoutlimit *big.Float, futureContribution bool) error {
+func doDeductFoundation(rids []uuid.UUID, yesterdayStart time.Time, currency string, amountPerPart *big.Int, payoutlimit *big.Float, futureContribution bool, wc *weightCache) error {
 	for _, rid := range rids {
 		// Get contributor weights
-		uidInMap, uidNotInMap, total, err := getContributorWeights(rid)
+		uidInMap, uidNotInMap, total, err := wc.get(rid)
 		if err != nil {
 			return err
 		}
@@ -332,10 +568,19 @@ func doDeductFoundation(rids []uuid.UUID, yesterdayStart time.Time, currency str
 	return nil
 }
 
-func doDeduct(uid uuid.UUID, rids []uuid.UUID, yesterdayStart time.Time, currency string, distributeDeduct *big.Int, distributeAdd *big.Int, deductFutureContribution *big.Int) error {
+// doDeduct adds the contributions of the sponsor to the batch, the weights come from the cache of the run
+func doDeduct(b *db.ContributionBatch, wc *weightCache, uid uuid.UUID, rids []uuid.UUID, yesterdayStart time.Time, currency string, distributeDeducts map[uuid.UUID]*big.Int, distributeAdds map[uuid.UUID]*big.Int, deductFutureContributions map[uuid.UUID]*big.Int) error {
+	err := wc.load(rids)
+	if err != nil {
+		return err
+	}
 	for _, rid := range rids {
+		distributeDeduct := distributeDeducts[rid]
+		distributeAdd := distributeAdds[rid]
+		deductFutureContribution := deductFutureContributions[rid]
+
 		// Get contributor weights
-		uidInMap, uidNotInMap, total, err := getContributorWeights(rid)
+		uidInMap, uidNotInMap, total, err := wc.get(rid)
 		if err != nil {
 			return err
 		}
@@ -354,13 +599,9 @@ func doDeduct(uid uuid.UUID, rids []uuid.UUID, yesterdayStart time.Time, currenc
 				slog.Float64("weight", w),
 				slog.Float64("total", newTotal),
 				slog.String("amount", amount.String()))
-			id := uuid.New()
-			err = db.InsertUnclaimed(id, email, rid, amount, currency, yesterdayStart, util.TimeNow())
-			if err != nil {
-				slog.Error("insertUnclaimed failed: %v, %v\n",
-					slog.String("email", email),
-					slog.Any("error", err))
-			}
+			b.Unclaimed = append(b.Unclaimed, db.BatchUnclaimed{
+				UserSponsorId: uid, Email: email, RepoId: rid, Balance: amount, Currency: currency, Day: yesterdayStart, CreatedAt: util.TimeNow(),
+			})
 		}
 
 		if len(uidInMap) == 0 {
@@ -370,18 +611,16 @@ func doDeduct(uid uuid.UUID, rids []uuid.UUID, yesterdayStart time.Time, currenc
 				slog.String("add", distributeAdd.String()),
 				slog.Float64("total", total),
 				slog.String("deduct", distributeDeduct.String()))
-			err = db.InsertFutureContribution(uid, rid, distributeDeduct, currency, yesterdayStart, util.TimeNow(), false)
-			if err != nil {
-				return err
-			}
+			b.FutureContributions = append(b.FutureContributions, db.BatchFutureContribution{
+				UserSponsorId: uid, RepoId: rid, Balance: distributeDeduct, Currency: currency, Day: yesterdayStart, CreatedAt: util.TimeNow(),
+			})
 		} else {
 			var distributable *big.Int
 
 			if deductFutureContribution != nil {
-				err = db.InsertFutureContribution(uid, rid, deductFutureContribution, currency, yesterdayStart, util.TimeNow(), false)
-				if err != nil {
-					return err
-				}
+				b.FutureContributions = append(b.FutureContributions, db.BatchFutureContribution{
+					UserSponsorId: uid, RepoId: rid, Balance: deductFutureContribution, Currency: currency, Day: yesterdayStart, CreatedAt: util.TimeNow(),
+				})
 
 				distributable = new(big.Int).Add(distributeAdd, distributeDeduct)
 			} else {
@@ -397,50 +636,15 @@ func doDeduct(uid uuid.UUID, rids []uuid.UUID, yesterdayStart time.Time, currenc
 					slog.Float64("weight", w),
 					slog.Float64("total", total),
 					slog.String("amount", amount.String()))
-				err = db.InsertContribution(uid, contributorUserId, rid, amount, currency, yesterdayStart, util.TimeNow(), false)
-				if err != nil {
-					return err
-				}
+				b.Contributions = append(b.Contributions, db.BatchContribution{
+					UserSponsorId: uid, UserContributorId: contributorUserId, RepoId: rid, Balance: amount, Currency: currency, Day: yesterdayStart, CreatedAt: util.TimeNow(),
+				})
 			}
 		}
 	}
 	return nil
 }
 
-func getContributorWeights(rid uuid.UUID) (map[uuid.UUID]float64, map[string]float64, float64, error) {
-	a, err := db.FindLatestAnalysisRequest(rid)
-	if err != nil {
-		return nil, nil, 0, err
-	}
-	if a == nil {
-		return nil, nil, 0, nil
-	}
-
-	ars, err := db.FindAnalysisResults(a.Id)
-	if err != nil {
-		return nil, nil, 0, err
-	}
-
-	uidInMap := map[uuid.UUID]float64{}
-	uidNotInMap := map[string]float64{}
-	total := 0.0
-
-	for _, ar := range ars {
-		uidGit, err := db.FindUserByGitEmail(ar.GitEmail)
-		if err != nil {
-			return nil, nil, 0, err
-		}
-		if uidGit != nil {
-			uidInMap[*uidGit] += ar.Weight
-			total += ar.Weight
-		} else {
-			uidNotInMap[ar.GitEmail] += ar.Weight
-		}
-	}
-
-	return uidInMap, uidNotInMap, total, nil
-}
-
 func calcSharePerUser(distributeAdd *big.Int, v float64, total float64) *big.Int {
 	distributeAddF := new(big.Float).SetInt(distributeAdd)
 	amountF := new(big.Float).Mul(big.NewFloat(v), distributeAddF)
@@ -450,80 +654,211 @@ func calcSharePerUser(distributeAdd *big.Int, v float64, total float64) *big.Int
 	return amount
 }
 
-func calcShare(userId uuid.UUID, repoLen int64) (string, int64, *big.Int, *big.Int, *big.Int, error) {
-	//mAdd is what the user paid in the current cycle
-	mAdd, err := db.FindSumPaymentByCurrency(userId, db.PayInSuccess)
+func (c *CalcHandler) calcShare(u *db.UserDetail, rids []uuid.UUID, weights map[uuid.UUID]int64) (int64, []currencyShare, error) {
+	//mAdd is what the user paid in the current cycle, less refunds and disputes
+	mAdd, err := db.FindPayInBalanceByCurrency(u.Id)
 	if err != nil {
-		return "", 0, nil, nil, nil, fmt.Errorf("cannot find sum user balance %v", err)
+		return 0, nil, fmt.Errorf("cannot find sum user balance %v", err)
 	}
 
 	//either the user spent it on a repo that does not have any devs who can claim
-	mFut, err := db.FindSumFutureSponsors(userId)
+	mFut, err := db.FindSumFutureSponsors(u.Id)
 	if err != nil {
-		return "", 0, nil, nil, nil, fmt.Errorf("cannot find sum user balance %v", err)
+		return 0, nil, fmt.Errorf("cannot find sum user balance %v", err)
 	}
 
 	//or the user spent it on for a repo with a dev who can claim
-	mSub, err := db.FindSumDailySponsors(userId)
+	mSub, err := db.FindSumDailySponsors(u.Id)
+	if err != nil {
+		return 0, nil, fmt.Errorf("cannot find sum daily balance %v", err)
+	}
+
+	ss, freq, err := c.spending.Spend(u, mAdd, mSub, mFut)
 	if err != nil {
-		return "", 0, nil, nil, nil, fmt.Errorf("cannot find sum daily balance %v", err)
-	}
-
-	currency, freq, s, err := api2.StrategyDeductMax(userId, mAdd, mSub, mFut)
-
-	if s == nil {
-		return currency, freq, nil, nil, nil, nil
-	}
-	//split the contribution among the repos
-	distributeDeduct := new(big.Int).Div(s, big.NewInt(repoLen))
-	distributeFutureAdd := distributeDeduct
-	var deductFutureContribution *big.Int
-	if mFut[currency] != nil {
-		distributeFutureAdd = new(big.Int).Div(mFut[currency], big.NewInt(repoLen))
-		//if we distribute more, we need to deduct this from the future balances
-		deductFutureContribution = new(big.Int).Neg(distributeFutureAdd)
-	}
-	slog.Info("Calculation",
-		slog.String("currency", currency),
-		slog.Int64("frey", freq),
-		slog.String("deduct", distributeDeduct.String()),
-		slog.String("add", distributeFutureAdd.String()),
-		slog.String("deduct-future", deductFutureContribution.String()))
-	return currency, freq, distributeDeduct, distributeFutureAdd, deductFutureContribution, nil
+		return 0, nil, err
+	}
+
+	var shares []currencyShare
+	for _, s := range ss {
+		//split the contribution among the repos
+		distributeDeduct := splitShare(s.Amount, rids, weights)
+		distributeFutureAdd := distributeDeduct
+		var deductFutureContribution map[uuid.UUID]*big.Int
+		if mFut[s.Currency] != nil {
+			distributeFutureAdd = splitShare(mFut[s.Currency], rids, weights)
+			//if we distribute more, we need to deduct this from the future balances
+			deductFutureContribution = map[uuid.UUID]*big.Int{}
+			for rid, v := range distributeFutureAdd {
+				deductFutureContribution[rid] = new(big.Int).Neg(v)
+			}
+		}
+		slog.Info("Calculation",
+			slog.String("currency", s.Currency),
+			slog.Int64("frey", freq),
+			slog.String("deduct", s.Amount.String()),
+			slog.Int("weights", len(weights)))
+		shares = append(shares, currencyShare{s.Currency, distributeDeduct, distributeFutureAdd, deductFutureContribution})
+	}
+	return freq, shares, nil
 }
 
-func (c *CalcHandler) reminderTopUp(u db.UserDetail, uOrig *db.UserDetail) error {
+// scheduleRenewal schedules the renewal of the subscription for today, once the balance lasts the renew
+// days or less. It returns false if the sponsor has no subscription that renews the balance.
+func (c *CalcHandler) scheduleRenewal(sub *db.Subscription, freq int64, yesterdayStart time.Time) (bool, error) {
+	if sub == nil || sub.Status == db.SubscriptionCanceled {
+		return false, nil
+	}
+	if freq > int64(c.cfg.SubscriptionRenewDays) {
+		return true, nil
+	}
+	return true, db.ScheduleRenewal(sub.UserId, yesterdayStart.AddDate(0, 0, 1), util.TimeNow())
+}
 
-	//check if user has stripe
-	if u.StripeId != nil && u.PaymentMethod != nil {
-		err := api2.StripePaymentRecurring(u)
+// creditShare spends the daily amount of the last plan while the renewal of the subscription is past
+// due or in grace. The balance goes negative, and the renewal pays it back. The renewal charges the
+// currency of the last pay-in, so the credit is spent in that currency.
+func creditShare(u *db.UserDetail, rids []uuid.UUID, weights map[uuid.UUID]int64) (int64, []currencyShare, error) {
+	currency, err := db.FindLatestPayInCurrency(u.Id)
+	if err != nil || currency == nil {
+		return 0, nil, err
+	}
+	daily, _, _, _, err := db.FindLatestDailyPayment(u.Id, *currency)
+	if err != nil || daily == nil || daily.Sign() <= 0 {
+		return 0, nil, err
+	}
+	slog.Info("Renewal is collected, spend on credit",
+		slog.String("userId", u.Id.String()),
+		slog.String("currency", *currency),
+		slog.String("daily", daily.String()))
+	distribute := splitShare(daily, rids, weights)
+	return 1, []currencyShare{{*currency, distribute, distribute, nil}}, nil
+}
+
+// capShares applies the spending caps of the sponsor to the new spending. What is moved from parked
+// funds to the contributors is not new spending and is not capped. Currencies the caps leave nothing
+// to spend of are dropped. It returns the days the balances last at the capped spending.
+func capShares(u *db.UserDetail, freq int64, shares []currencyShare, yesterdayStart time.Time) (int64, []currencyShare, error) {
+	caps, err := db.FindSpendingCaps(u.Id)
+	if err != nil || len(caps) == 0 {
+		return freq, shares, err
+	}
+
+	cappedFreq := freq
+	var capped []currencyShare
+	for _, cs := range shares {
+		sc, ok := caps[cs.currency]
+		if !ok {
+			capped = append(capped, cs)
+			continue
+		}
+		spent, spentRepo, err := db.FindSpentInMonth(u.Id, cs.currency, yesterdayStart)
 		if err != nil {
-			return err
+			return 0, nil, err
+		}
+		deduct := api2.CapSpending(cs.distributeDeduct, &sc, spent, spentRepo)
+		total := new(big.Int)
+		for _, v := range deduct {
+			total.Add(total, v)
+		}
+		uncapped := new(big.Int)
+		for _, v := range cs.distributeDeduct {
+			uncapped.Add(uncapped, v)
+		}
+		cappedFreq = max(cappedFreq, capFreq(freq, uncapped, total))
+		if cs.deductFutureContribution == nil {
+			if total.Sign() == 0 {
+				slog.Info("Spending cap reached",
+					slog.String("userId", u.Id.String()),
+					slog.String("currency", cs.currency))
+				continue
+			}
+			cs.distributeAdd = deduct
+		}
+		cs.distributeDeduct = deduct
+		capped = append(capped, cs)
+	}
+	return cappedFreq, capped, nil
+}
+
+// capFreq stretches the days a balance lasts by the ratio of the uncapped to the capped spending. A
+// currency the caps leave nothing to spend of resumes with the uncapped spending later, so its days stay.
+func capFreq(freq int64, uncapped *big.Int, capped *big.Int) int64 {
+	if capped.Sign() <= 0 || capped.Cmp(uncapped) >= 0 {
+		return freq
+	}
+	f := new(big.Int).Mul(big.NewInt(freq), uncapped)
+	return f.Div(f, capped).Int64()
+}
+
+// splitShare splits the amount among the repos. Without weights every repo gets the same share. With
+// weights, a repo with a weight gets its percentage and the repos without a weight share the remaining
+// percentage equally. Weights of repos that are not sponsored anymore are ignored, and if the remaining
+// weights do not cover 100% while every repo has a weight, they are scaled up.
+func splitShare(amount *big.Int, rids []uuid.UUID, weights map[uuid.UUID]int64) map[uuid.UUID]*big.Int {
+	m := map[uuid.UUID]*big.Int{}
+	if len(rids) == 0 {
+		return m
+	}
+
+	sum := int64(0)
+	unweighted := int64(0)
+	for _, rid := range rids {
+		if weights[rid] > 0 {
+			sum += weights[rid]
+		} else {
+			unweighted++
+		}
+	}
+
+	if sum == 0 {
+		equal := new(big.Int).Div(amount, big.NewInt(int64(len(rids))))
+		for _, rid := range rids {
+			m[rid] = equal
 		}
+		return m
+	}
 
-		err = c.ec.SendStripeTopUp(u)
+	//to stay with integers, an explicit weight counts unweighted times, and every unweighted repo
+	//gets the rest. The total is then 100 * unweighted, or the sum of the weights if all have one
+	rest := int64(0)
+	if unweighted > 0 && sum < db.MaxSponsorWeight {
+		rest = db.MaxSponsorWeight - sum
+	}
+	factor := unweighted
+	if factor == 0 {
+		factor = 1
+	}
+	total := big.NewInt(sum*factor + rest*unweighted)
+
+	for _, rid := range rids {
+		w := rest
+		if weights[rid] > 0 {
+			w = weights[rid] * factor
+		}
+		share := new(big.Int).Mul(amount, big.NewInt(w))
+		m[rid] = share.Div(share, total)
+	}
+	return m
+}
+
+// reminderTopUp asks the sponsor to top up, the stored card is only charged by the subscription
+func (c *CalcHandler) reminderTopUp(u db.UserDetail, uOrig *db.UserDetail) error {
+	isSponsor := uOrig != nil
+	if isSponsor {
+		err := c.ec.SendTopUpSponsor(u)
 		if err != nil {
 			return err
 		}
 	} else {
-		//No stripe, just send email
-		isSponsor := uOrig != nil
-		if isSponsor {
-			err := c.ec.SendTopUpSponsor(u)
+		if u.InvitedId != nil {
+			err := c.ec.SendTopUpInvited(u)
 			if err != nil {
 				return err
 			}
 		} else {
-			if u.InvitedId != nil {
-				err := c.ec.SendTopUpInvited(u)
-				if err != nil {
-					return err
-				}
-			} else {
-				err := c.ec.SendTopUpOther(u)
-				if err != nil {
-					return err
-				}
+			err := c.ec.SendTopUpOther(u)
+			if err != nil {
+				return err
 			}
 		}
 	}
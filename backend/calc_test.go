@@ -3,6 +3,7 @@ package main
 import (
 	"backend/api"
 	"backend/client"
+	"backend/config"
 	"backend/db"
 	"backend/util"
 	"encoding/json"
@@ -32,7 +33,7 @@ var (
 	day3  = time.Time{}.Add(time.Duration(2*24) * time.Hour)
 	day4  = time.Time{}.Add(time.Duration(3*24) * time.Hour)
 	day5  = time.Time{}.Add(time.Duration(4*24) * time.Hour)
-	c     = NewCalcHandler(client.NewAnalysisClient("", "", ""), client.NewEmailClient("", "", "", "", "", "", ""))
+	c     = NewCalcHandler(client.NewAnalysisClient("", "", ""), client.NewEmailClient("", "", "", "", "", "", ""), &config.Config{})
 )
 
 func SetupAnalysisTestServer(t *testing.T) *httptest.Server {
@@ -528,6 +529,50 @@ func TestOneContributorLowFunds(t *testing.T) {
 	assert.Equal(t, 2, client.EmailNotifications) //we send out unclaimed marketing and low funds email
 }
 
+func TestSubscriptionGraceSpendsOnCredit(t *testing.T) {
+	db.SetupTestData()
+	defer db.TeardownTestData()
+	client.EmailNotifications = 0
+
+	sponsors := setupUsers(t, "tom@tom.tom s1")
+	setupFunds(t, *sponsors[0], "USD", 1, 1, api.Plans[1].PriceBase, day1)
+	setupUsers(t, "ste@ste.ste c1")
+	repos := setupRepos(t, "tomp2p r1")
+	setupContributor(t, *repos[0], day1, day3, []string{"ste@ste.ste"}, []float64{0.5})
+	err := setupSponsor(t, sponsors[0], repos[0], day11)
+	require.Nil(t, err)
+
+	//the renewal failed, the sponsoring continues in grace
+	err = db.UpsertSubscription(db.Subscription{UserId: *sponsors[0], Status: db.SubscriptionGrace, UpdatedAt: day1, CreatedAt: day1})
+	require.Nil(t, err)
+
+	err = c.DailyRunner(day3)
+	require.Nil(t, err)
+	spent1 := sumSpent(t, *sponsors[0])
+	assert.True(t, spent1.Sign() > 0)
+
+	//the balance is used up, the next day is spent on credit
+	err = c.DailyRunner(day4)
+	require.Nil(t, err)
+	assert.Equal(t, new(big.Int).Mul(spent1, big.NewInt(2)), sumSpent(t, *sponsors[0]))
+	//no top up reminder, the subscription renews
+	assert.Equal(t, 1, client.EmailNotifications)
+}
+
+func sumSpent(t *testing.T, uid uuid.UUID) *big.Int {
+	daily, err := db.FindSumDailySponsors(uid)
+	require.Nil(t, err)
+	fut, err := db.FindSumFutureSponsors(uid)
+	require.Nil(t, err)
+	sum := new(big.Int)
+	for _, m := range []map[string]*big.Int{daily, fut} {
+		if m["USD"] != nil {
+			sum.Add(sum, m["USD"])
+		}
+	}
+	return sum
+}
+
 func TestMultipleFutures(t *testing.T) {
 	db.SetupTestData()
 	defer db.TeardownTestData()
@@ -876,6 +921,159 @@ func TestSponsor(t *testing.T) {
 	assert.Empty(t, m3)
 }
 
+func TestSponsorWeights(t *testing.T) {
+	db.SetupTestData()
+	defer db.TeardownTestData()
+
+	sponsors := setupUsers(t, "tom@tom.tom s1")
+	setupFunds(t, *sponsors[0], "USD", 1, 365, api.Plans[1].PriceBase, day1)
+
+	contributors := setupUsers(t, "ste@ste.ste c1", "pea@pea.pea c2")
+	setupGitEmail(t, *contributors[0], "ste@ste.ste")
+	setupGitEmail(t, *contributors[1], "pea@pea.pea")
+
+	repos := setupRepos(t, "tomp2p r1", "neow3j r2")
+	setupContributor(t, *repos[0], day1, day2, []string{"ste@ste.ste"}, []float64{0.5})
+	setupContributor(t, *repos[1], day1, day2, []string{"pea@pea.pea"}, []float64{0.5})
+
+	err := setupSponsor(t, sponsors[0], repos[0], day1)
+	assert.Nil(t, err)
+	err = setupSponsor(t, sponsors[0], repos[1], day1)
+	assert.Nil(t, err)
+
+	err = db.ReplaceSponsorWeights(*sponsors[0], []db.SponsorWeight{{RepoId: *repos[0], Weight: 75}}, day1)
+	require.Nil(t, err)
+
+	err = c.DailyRunner(day3)
+	assert.Nil(t, err)
+
+	//tomp2p gets 75%, neow3j as the only repo without a weight the remaining 25%
+	m1, err := db.FindSumDailyContributors(*contributors[0])
+	assert.Nil(t, err)
+	m2, err := db.FindSumDailyContributors(*contributors[1])
+	assert.Nil(t, err)
+	assert.Equal(t, new(big.Int).Mul(m2["USD"], big.NewInt(3)), m1["USD"])
+
+	m3, err := db.FindSumDailySponsors(*sponsors[0])
+	assert.Nil(t, err)
+	assert.Equal(t, new(big.Int).Add(m1["USD"], m2["USD"]), m3["USD"])
+}
+
+func TestSplitShare(t *testing.T) {
+	r1, r2, r3 := uuid.New(), uuid.New(), uuid.New()
+	rids := []uuid.UUID{r1, r2, r3}
+
+	t.Run("equal without weights", func(t *testing.T) {
+		m := splitShare(big.NewInt(1000), rids, nil)
+		assert.Equal(t, big.NewInt(333), m[r1])
+		assert.Equal(t, big.NewInt(333), m[r2])
+		assert.Equal(t, big.NewInt(333), m[r3])
+	})
+
+	t.Run("rest is shared by repos without a weight", func(t *testing.T) {
+		m := splitShare(big.NewInt(1000), rids, map[uuid.UUID]int64{r1: 50})
+		assert.Equal(t, big.NewInt(500), m[r1])
+		assert.Equal(t, big.NewInt(250), m[r2])
+		assert.Equal(t, big.NewInt(250), m[r3])
+	})
+
+	t.Run("all repos with a weight", func(t *testing.T) {
+		m := splitShare(big.NewInt(1000), rids, map[uuid.UUID]int64{r1: 50, r2: 30, r3: 20})
+		assert.Equal(t, big.NewInt(500), m[r1])
+		assert.Equal(t, big.NewInt(300), m[r2])
+		assert.Equal(t, big.NewInt(200), m[r3])
+	})
+
+	t.Run("weights of unsponsored repos are ignored", func(t *testing.T) {
+		m := splitShare(big.NewInt(1000), []uuid.UUID{r1, r2}, map[uuid.UUID]int64{r1: 40, r3: 60})
+		assert.Equal(t, big.NewInt(400), m[r1])
+		assert.Equal(t, big.NewInt(600), m[r2])
+		_, ok := m[r3]
+		assert.False(t, ok)
+	})
+
+	t.Run("weights are scaled if all repos have one", func(t *testing.T) {
+		m := splitShare(big.NewInt(1000), []uuid.UUID{r1, r2}, map[uuid.UUID]int64{r1: 30, r2: 20, r3: 50})
+		assert.Equal(t, big.NewInt(600), m[r1])
+		assert.Equal(t, big.NewInt(400), m[r2])
+	})
+}
+
+func TestCapFreq(t *testing.T) {
+	//not capped
+	assert.Equal(t, int64(10), capFreq(10, big.NewInt(100), big.NewInt(100)))
+	//a quarter of the spending, the balance lasts four times longer
+	assert.Equal(t, int64(40), capFreq(10, big.NewInt(100), big.NewInt(25)))
+	//nothing spent today, the spending resumes later
+	assert.Equal(t, int64(10), capFreq(10, big.NewInt(100), big.NewInt(0)))
+	//no balance left
+	assert.Equal(t, int64(0), capFreq(0, big.NewInt(100), big.NewInt(25)))
+}
+
+func TestSpendingProportional(t *testing.T) {
+	db.SetupTestData()
+	defer db.TeardownTestData()
+
+	sponsors := setupUsers(t, "tom@tom.tom s1")
+	setupFunds(t, *sponsors[0], "USD", 1, 365, api.Plans[1].PriceBase, day1)
+	setupFunds(t, *sponsors[0], "GAS", 1, 365, api.Plans[1].PriceBase, day1)
+	strategy := db.SpendingProportional
+	err := db.UpdateSpendingStrategy(*sponsors[0], &strategy, nil)
+	require.Nil(t, err)
+
+	repos := setupRepos(t, "tomp2p r1")
+	contributors := setupUsers(t, "ste@ste.ste c1")
+	setupGitEmail(t, *contributors[0], "ste@ste.ste")
+	setupContributor(t, *repos[0], day1, day4, []string{"ste@ste.ste"}, []float64{0.4})
+
+	err = setupSponsor(t, sponsors[0], repos[0], day1)
+	assert.Nil(t, err)
+
+	err = c.DailyRunner(day3)
+	assert.Nil(t, err)
+
+	//both currencies have the same balance, so half of the daily amount is spent from each
+	m, err := db.FindSumDailySponsors(*sponsors[0])
+	assert.Nil(t, err)
+	require.NotNil(t, m["USD"])
+	require.NotNil(t, m["GAS"])
+	assert.Equal(t, m["USD"], m["GAS"])
+	assert.True(t, new(big.Int).Add(m["USD"], m["GAS"]).Cmp(big.NewInt(330003)) <= 0)
+}
+
+func TestSpendingPreferred(t *testing.T) {
+	db.SetupTestData()
+	defer db.TeardownTestData()
+
+	sponsors := setupUsers(t, "tom@tom.tom s1")
+	setupFunds(t, *sponsors[0], "USD", 1, 365, api.Plans[1].PriceBase, day1)
+	setupFunds(t, *sponsors[0], "GAS", 1, 365, api.Plans[1].PriceBase, day1)
+	strategy := db.SpendingPreferred
+	order := "GAS,USD"
+	err := db.UpdateSpendingStrategy(*sponsors[0], &strategy, &order)
+	require.Nil(t, err)
+
+	repos := setupRepos(t, "tomp2p r1")
+	contributors := setupUsers(t, "ste@ste.ste c1")
+	setupGitEmail(t, *contributors[0], "ste@ste.ste")
+	setupContributor(t, *repos[0], day1, day4, []string{"ste@ste.ste"}, []float64{0.4})
+
+	err = setupSponsor(t, sponsors[0], repos[0], day1)
+	assert.Nil(t, err)
+
+	err = c.DailyRunner(day3)
+	assert.Nil(t, err)
+	err = c.DailyRunner(day4)
+	assert.Nil(t, err)
+
+	//GAS is spent first, USD is untouched until GAS runs out
+	m, err := db.FindSumDailySponsors(*sponsors[0])
+	assert.Nil(t, err)
+	require.NotNil(t, m["GAS"])
+	assert.Equal(t, 1, m["GAS"].Sign())
+	assert.Nil(t, m["USD"])
+}
+
 func setupSponsorUser(t *testing.T, uid1 uuid.UUID, uid2 uuid.UUID) {
 	err := db.UpdateUserInviteId(uid2, uid1)
 	assert.Nil(t, err)
@@ -921,7 +1119,7 @@ func setupFunds(t *testing.T, uid uuid.UUID, currency string, seats int64, freq
 
 	err := db.InsertPayInEvent(payInEvent)
 	assert.Nil(t, err)
-	err = db.PaymentSuccess(payInEvent.ExternalId, big.NewInt(13750*freq))
+	err = db.PaymentSuccess(payInEvent.ExternalId, big.NewInt(13750*freq), nil)
 	assert.Nil(t, err)
 	return &payInEvent
 }
@@ -0,0 +1,942 @@
+// Code generated - DO NOT EDIT.
+// This file is a generated binding and any manual changes will be lost.
+
+package chain
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var (
+	_ = errors.New
+	_ = big.NewInt
+	_ = strings.NewReader
+	_ = ethereum.NotFound
+	_ = bind.Bind
+	_ = common.Big1
+	_ = types.BloomLookup
+	_ = event.NewSubscription
+	_ = abi.ConvertType
+)
+
+// PayoutMetaData contains all meta data concerning the Payout contract.
+var PayoutMetaData = &bind.MetaData{
+	ABI: "[{\"inputs\":[],\"stateMutability\":\"nonpayable\",\"type\":\"constructor\"},{\"inputs\":[],\"name\":\"ECDSAInvalidSignature\",\"type\":\"error\"},{\"inputs\":[{\"internalType\":\"uint256\",\"name\":\"length\",\"type\":\"uint256\"}],\"name\":\"ECDSAInvalidSignatureLength\",\"type\":\"error\"},{\"inputs\":[{\"internalType\":\"bytes32\",\"name\":\"s\",\"type\":\"bytes32\"}],\"name\":\"ECDSAInvalidSignatureS\",\"type\":\"error\"},{\"inputs\":[],\"name\":\"InvalidShortString\",\"type\":\"error\"},{\"inputs\":[{\"internalType\":\"address\",\"name\":\"owner\",\"type\":\"address\"}],\"name\":\"OwnableInvalidOwner\",\"type\":\"error\"},{\"inputs\":[{\"internalType\":\"address\",\"name\":\"account\",\"type\":\"address\"}],\"name\":\"OwnableUnauthorizedAccount\",\"type\":\"error\"},{\"inputs\":[{\"internalType\":\"string\",\"name\":\"str\",\"type\":\"string\"}],\"name\":\"StringTooLong\",\"type\":\"error\"},{\"anonymous\":false,\"inputs\":[],\"name\":\"EIP712DomainChanged\",\"type\":\"event\"},{\"anonymous\":false,\"inputs\":[{\"indexed\":true,\"internalType\":\"address\",\"name\":\"previousOwner\",\"type\":\"address\"},{\"indexed\":true,\"internalType\":\"address\",\"name\":\"newOwner\",\"type\":\"address\"}],\"name\":\"OwnershipTransferred\",\"type\":\"event\"},{\"inputs\":[],\"name\":\"PAYOUT_TYPEHASH\",\"outputs\":[{\"internalType\":\"bytes32\",\"name\":\"\",\"type\":\"bytes32\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[],\"name\":\"domainSeparator\",\"outputs\":[{\"internalType\":\"bytes32\",\"name\":\"\",\"type\":\"bytes32\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[],\"name\":\"eip712Domain\",\"outputs\":[{\"internalType\":\"bytes1\",\"name\":\"fields\",\"type\":\"bytes1\"},{\"internalType\":\"string\",\"name\":\"name\",\"type\":\"string\"},{\"internalType\":\"string\",\"name\":\"version\",\"type\":\"string\"},{\"internalType\":\"uint256\",\"name\":\"chainId\",\"type\":\"uint256\"},{\"internalType\":\"address\",\"name\":\"verifyingContract\",\"type\":\"address\"},{\"internalType\":\"bytes32\",\"name\":\"salt\",\"type\":\"bytes32\"},{\"internalType\":\"uint256[]\",\"name\":\"extensions\",\"type\":\"uint256[]\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[{\"internalType\":\"address\",\"name\":\"addr\",\"type\":\"address\"}],\"name\":\"getBalance\",\"outputs\":[{\"internalType\":\"uint256\",\"name\":\"amount\",\"type\":\"uint256\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[{\"internalType\":\"uint256\",\"name\":\"userId\",\"type\":\"uint256\"},{\"internalType\":\"uint256\",\"name\":\"totalPayOut\",\"type\":\"uint256\"}],\"name\":\"getClaimableAmount\",\"outputs\":[{\"internalType\":\"uint256\",\"name\":\"amount\",\"type\":\"uint256\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[{\"internalType\":\"uint256\",\"name\":\"userId\",\"type\":\"uint256\"}],\"name\":\"getPayedAmount\",\"outputs\":[{\"internalType\":\"uint256\",\"name\":\"amount\",\"type\":\"uint256\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[],\"name\":\"owner\",\"outputs\":[{\"internalType\":\"address\",\"name\":\"\",\"type\":\"address\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[{\"internalType\":\"uint256\",\"name\":\"\",\"type\":\"uint256\"}],\"name\":\"payedOut\",\"outputs\":[{\"internalType\":\"uint256\",\"name\":\"\",\"type\":\"uint256\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[],\"name\":\"renounceOwnership\",\"outputs\":[],\"stateMutability\":\"nonpayable\",\"type\":\"function\"},{\"inputs\":[{\"internalType\":\"address\",\"name\":\"to\",\"type\":\"address\"},{\"internalType\":\"uint256\",\"name\":\"amount\",\"type\":\"uint256\"}],\"name\":\"sendRecover\",\"outputs\":[],\"stateMutability\":\"nonpayable\",\"type\":\"function\"},{\"inputs\":[{\"internalType\":\"address\",\"name\":\"token\",\"type\":\"address\"},{\"internalType\":\"address\",\"name\":\"to\",\"type\":\"address\"},{\"internalType\":\"uint256\",\"name\":\"amount\",\"type\":\"uint256\"}],\"name\":\"sendRecoverToken\",\"outputs\":[],\"stateMutability\":\"nonpayable\",\"type\":\"function\"},{\"inputs\":[],\"name\":\"symbol\",\"outputs\":[{\"internalType\":\"string\",\"name\":\"\",\"type\":\"string\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[{\"internalType\":\"address\",\"name\":\"newOwner\",\"type\":\"address\"}],\"name\":\"transferOwnership\",\"outputs\":[],\"stateMutability\":\"nonpayable\",\"type\":\"function\"},{\"inputs\":[{\"internalType\":\"uint256\",\"name\":\"\",\"type\":\"uint256\"},{\"internalType\":\"uint256\",\"name\":\"\",\"type\":\"uint256\"}],\"name\":\"usedNonces\",\"outputs\":[{\"internalType\":\"bool\",\"name\":\"\",\"type\":\"bool\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[{\"internalType\":\"address\",\"name\":\"dev\",\"type\":\"address\"},{\"internalType\":\"uint256\",\"name\":\"userId\",\"type\":\"uint256\"},{\"internalType\":\"address\",\"name\":\"payee\",\"type\":\"address\"},{\"internalType\":\"uint256\",\"name\":\"totalPayOut\",\"type\":\"uint256\"},{\"internalType\":\"uint256\",\"name\":\"nonce\",\"type\":\"uint256\"},{\"internalType\":\"uint256\",\"name\":\"deadline\",\"type\":\"uint256\"},{\"internalType\":\"bytes\",\"name\":\"signature\",\"type\":\"bytes\"}],\"name\":\"withdraw\",\"outputs\":[],\"stateMutability\":\"nonpayable\",\"type\":\"function\"},{\"stateMutability\":\"payable\",\"type\":\"receive\"}]",
+}
+
+// PayoutABI is the input ABI used to generate the binding from.
+// Deprecated: Use PayoutMetaData.ABI instead.
+var PayoutABI = PayoutMetaData.ABI
+
+// Payout is an auto generated Go binding around an Ethereum contract.
+type Payout struct {
+	PayoutCaller     // Read-only binding to the contract
+	PayoutTransactor // Write-only binding to the contract
+	PayoutFilterer   // Log filterer for contract events
+}
+
+// PayoutCaller is an auto generated read-only Go binding around an Ethereum contract.
+type PayoutCaller struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// PayoutTransactor is an auto generated write-only Go binding around an Ethereum contract.
+type PayoutTransactor struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// PayoutFilterer is an auto generated log filtering Go binding around an Ethereum contract events.
+type PayoutFilterer struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// PayoutSession is an auto generated Go binding around an Ethereum contract,
+// with pre-set call and transact options.
+type PayoutSession struct {
+	Contract     *Payout           // Generic contract binding to set the session for
+	CallOpts     bind.CallOpts     // Call options to use throughout this session
+	TransactOpts bind.TransactOpts // Transaction auth options to use throughout this session
+}
+
+// PayoutCallerSession is an auto generated read-only Go binding around an Ethereum contract,
+// with pre-set call options.
+type PayoutCallerSession struct {
+	Contract *PayoutCaller // Generic contract caller binding to set the session for
+	CallOpts bind.CallOpts // Call options to use throughout this session
+}
+
+// PayoutTransactorSession is an auto generated write-only Go binding around an Ethereum contract,
+// with pre-set transact options.
+type PayoutTransactorSession struct {
+	Contract     *PayoutTransactor // Generic contract transactor binding to set the session for
+	TransactOpts bind.TransactOpts // Transaction auth options to use throughout this session
+}
+
+// PayoutRaw is an auto generated low-level Go binding around an Ethereum contract.
+type PayoutRaw struct {
+	Contract *Payout // Generic contract binding to access the raw methods on
+}
+
+// PayoutCallerRaw is an auto generated low-level read-only Go binding around an Ethereum contract.
+type PayoutCallerRaw struct {
+	Contract *PayoutCaller // Generic read-only contract binding to access the raw methods on
+}
+
+// PayoutTransactorRaw is an auto generated low-level write-only Go binding around an Ethereum contract.
+type PayoutTransactorRaw struct {
+	Contract *PayoutTransactor // Generic write-only contract binding to access the raw methods on
+}
+
+// NewPayout creates a new instance of Payout, bound to a specific deployed contract.
+func NewPayout(address common.Address, backend bind.ContractBackend) (*Payout, error) {
+	contract, err := bindPayout(address, backend, backend, backend)
+	if err != nil {
+		return nil, err
+	}
+	return &Payout{PayoutCaller: PayoutCaller{contract: contract}, PayoutTransactor: PayoutTransactor{contract: contract}, PayoutFilterer: PayoutFilterer{contract: contract}}, nil
+}
+
+// NewPayoutCaller creates a new read-only instance of Payout, bound to a specific deployed contract.
+func NewPayoutCaller(address common.Address, caller bind.ContractCaller) (*PayoutCaller, error) {
+	contract, err := bindPayout(address, caller, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &PayoutCaller{contract: contract}, nil
+}
+
+// NewPayoutTransactor creates a new write-only instance of Payout, bound to a specific deployed contract.
+func NewPayoutTransactor(address common.Address, transactor bind.ContractTransactor) (*PayoutTransactor, error) {
+	contract, err := bindPayout(address, nil, transactor, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &PayoutTransactor{contract: contract}, nil
+}
+
+// NewPayoutFilterer creates a new log filterer instance of Payout, bound to a specific deployed contract.
+func NewPayoutFilterer(address common.Address, filterer bind.ContractFilterer) (*PayoutFilterer, error) {
+	contract, err := bindPayout(address, nil, nil, filterer)
+	if err != nil {
+		return nil, err
+	}
+	return &PayoutFilterer{contract: contract}, nil
+}
+
+// bindPayout binds a generic wrapper to an already deployed contract.
+func bindPayout(address common.Address, caller bind.ContractCaller, transactor bind.ContractTransactor, filterer bind.ContractFilterer) (*bind.BoundContract, error) {
+	parsed, err := PayoutMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	return bind.NewBoundContract(address, *parsed, caller, transactor, filterer), nil
+}
+
+// Call invokes the (constant) contract method with params as input values and
+// sets the output to result. The result type might be a single field for simple
+// returns, a slice of interfaces for anonymous returns and a struct for named
+// returns.
+func (_Payout *PayoutRaw) Call(opts *bind.CallOpts, result *[]interface{}, method string, params ...interface{}) error {
+	return _Payout.Contract.PayoutCaller.contract.Call(opts, result, method, params...)
+}
+
+// Transfer initiates a plain transaction to move funds to the contract, calling
+// its default method if one is available.
+func (_Payout *PayoutRaw) Transfer(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _Payout.Contract.PayoutTransactor.contract.Transfer(opts)
+}
+
+// Transact invokes the (paid) contract method with params as input values.
+func (_Payout *PayoutRaw) Transact(opts *bind.TransactOpts, method string, params ...interface{}) (*types.Transaction, error) {
+	return _Payout.Contract.PayoutTransactor.contract.Transact(opts, method, params...)
+}
+
+// Call invokes the (constant) contract method with params as input values and
+// sets the output to result. The result type might be a single field for simple
+// returns, a slice of interfaces for anonymous returns and a struct for named
+// returns.
+func (_Payout *PayoutCallerRaw) Call(opts *bind.CallOpts, result *[]interface{}, method string, params ...interface{}) error {
+	return _Payout.Contract.contract.Call(opts, result, method, params...)
+}
+
+// Transfer initiates a plain transaction to move funds to the contract, calling
+// its default method if one is available.
+func (_Payout *PayoutTransactorRaw) Transfer(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _Payout.Contract.contract.Transfer(opts)
+}
+
+// Transact invokes the (paid) contract method with params as input values.
+func (_Payout *PayoutTransactorRaw) Transact(opts *bind.TransactOpts, method string, params ...interface{}) (*types.Transaction, error) {
+	return _Payout.Contract.contract.Transact(opts, method, params...)
+}
+
+// PAYOUTTYPEHASH is a free data retrieval call binding the contract method 0x2204b909.
+//
+// Solidity: function PAYOUT_TYPEHASH() view returns(bytes32)
+func (_Payout *PayoutCaller) PAYOUTTYPEHASH(opts *bind.CallOpts) ([32]byte, error) {
+	var out []interface{}
+	err := _Payout.contract.Call(opts, &out, "PAYOUT_TYPEHASH")
+
+	if err != nil {
+		return *new([32]byte), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new([32]byte)).(*[32]byte)
+
+	return out0, err
+
+}
+
+// PAYOUTTYPEHASH is a free data retrieval call binding the contract method 0x2204b909.
+//
+// Solidity: function PAYOUT_TYPEHASH() view returns(bytes32)
+func (_Payout *PayoutSession) PAYOUTTYPEHASH() ([32]byte, error) {
+	return _Payout.Contract.PAYOUTTYPEHASH(&_Payout.CallOpts)
+}
+
+// PAYOUTTYPEHASH is a free data retrieval call binding the contract method 0x2204b909.
+//
+// Solidity: function PAYOUT_TYPEHASH() view returns(bytes32)
+func (_Payout *PayoutCallerSession) PAYOUTTYPEHASH() ([32]byte, error) {
+	return _Payout.Contract.PAYOUTTYPEHASH(&_Payout.CallOpts)
+}
+
+// DomainSeparator is a free data retrieval call binding the contract method 0xf698da25.
+//
+// Solidity: function domainSeparator() view returns(bytes32)
+func (_Payout *PayoutCaller) DomainSeparator(opts *bind.CallOpts) ([32]byte, error) {
+	var out []interface{}
+	err := _Payout.contract.Call(opts, &out, "domainSeparator")
+
+	if err != nil {
+		return *new([32]byte), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new([32]byte)).(*[32]byte)
+
+	return out0, err
+
+}
+
+// DomainSeparator is a free data retrieval call binding the contract method 0xf698da25.
+//
+// Solidity: function domainSeparator() view returns(bytes32)
+func (_Payout *PayoutSession) DomainSeparator() ([32]byte, error) {
+	return _Payout.Contract.DomainSeparator(&_Payout.CallOpts)
+}
+
+// DomainSeparator is a free data retrieval call binding the contract method 0xf698da25.
+//
+// Solidity: function domainSeparator() view returns(bytes32)
+func (_Payout *PayoutCallerSession) DomainSeparator() ([32]byte, error) {
+	return _Payout.Contract.DomainSeparator(&_Payout.CallOpts)
+}
+
+// Eip712Domain is a free data retrieval call binding the contract method 0x84b0196e.
+//
+// Solidity: function eip712Domain() view returns(bytes1 fields, string name, string version, uint256 chainId, address verifyingContract, bytes32 salt, uint256[] extensions)
+func (_Payout *PayoutCaller) Eip712Domain(opts *bind.CallOpts) (struct {
+	Fields            [1]byte
+	Name              string
+	Version           string
+	ChainId           *big.Int
+	VerifyingContract common.Address
+	Salt              [32]byte
+	Extensions        []*big.Int
+}, error) {
+	var out []interface{}
+	err := _Payout.contract.Call(opts, &out, "eip712Domain")
+
+	outstruct := new(struct {
+		Fields            [1]byte
+		Name              string
+		Version           string
+		ChainId           *big.Int
+		VerifyingContract common.Address
+		Salt              [32]byte
+		Extensions        []*big.Int
+	})
+	if err != nil {
+		return *outstruct, err
+	}
+
+	outstruct.Fields = *abi.ConvertType(out[0], new([1]byte)).(*[1]byte)
+	outstruct.Name = *abi.ConvertType(out[1], new(string)).(*string)
+	outstruct.Version = *abi.ConvertType(out[2], new(string)).(*string)
+	outstruct.ChainId = *abi.ConvertType(out[3], new(*big.Int)).(**big.Int)
+	outstruct.VerifyingContract = *abi.ConvertType(out[4], new(common.Address)).(*common.Address)
+	outstruct.Salt = *abi.ConvertType(out[5], new([32]byte)).(*[32]byte)
+	outstruct.Extensions = *abi.ConvertType(out[6], new([]*big.Int)).(*[]*big.Int)
+
+	return *outstruct, err
+
+}
+
+// Eip712Domain is a free data retrieval call binding the contract method 0x84b0196e.
+//
+// Solidity: function eip712Domain() view returns(bytes1 fields, string name, string version, uint256 chainId, address verifyingContract, bytes32 salt, uint256[] extensions)
+func (_Payout *PayoutSession) Eip712Domain() (struct {
+	Fields            [1]byte
+	Name              string
+	Version           string
+	ChainId           *big.Int
+	VerifyingContract common.Address
+	Salt              [32]byte
+	Extensions        []*big.Int
+}, error) {
+	return _Payout.Contract.Eip712Domain(&_Payout.CallOpts)
+}
+
+// Eip712Domain is a free data retrieval call binding the contract method 0x84b0196e.
+//
+// Solidity: function eip712Domain() view returns(bytes1 fields, string name, string version, uint256 chainId, address verifyingContract, bytes32 salt, uint256[] extensions)
+func (_Payout *PayoutCallerSession) Eip712Domain() (struct {
+	Fields            [1]byte
+	Name              string
+	Version           string
+	ChainId           *big.Int
+	VerifyingContract common.Address
+	Salt              [32]byte
+	Extensions        []*big.Int
+}, error) {
+	return _Payout.Contract.Eip712Domain(&_Payout.CallOpts)
+}
+
+// GetBalance is a free data retrieval call binding the contract method 0xf8b2cb4f.
+//
+// Solidity: function getBalance(address addr) view returns(uint256 amount)
+func (_Payout *PayoutCaller) GetBalance(opts *bind.CallOpts, addr common.Address) (*big.Int, error) {
+	var out []interface{}
+	err := _Payout.contract.Call(opts, &out, "getBalance", addr)
+
+	if err != nil {
+		return *new(*big.Int), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new(*big.Int)).(**big.Int)
+
+	return out0, err
+
+}
+
+// GetBalance is a free data retrieval call binding the contract method 0xf8b2cb4f.
+//
+// Solidity: function getBalance(address addr) view returns(uint256 amount)
+func (_Payout *PayoutSession) GetBalance(addr common.Address) (*big.Int, error) {
+	return _Payout.Contract.GetBalance(&_Payout.CallOpts, addr)
+}
+
+// GetBalance is a free data retrieval call binding the contract method 0xf8b2cb4f.
+//
+// Solidity: function getBalance(address addr) view returns(uint256 amount)
+func (_Payout *PayoutCallerSession) GetBalance(addr common.Address) (*big.Int, error) {
+	return _Payout.Contract.GetBalance(&_Payout.CallOpts, addr)
+}
+
+// GetClaimableAmount is a free data retrieval call binding the contract method 0x9edf24d0.
+//
+// Solidity: function getClaimableAmount(uint256 userId, uint256 totalPayOut) view returns(uint256 amount)
+func (_Payout *PayoutCaller) GetClaimableAmount(opts *bind.CallOpts, userId *big.Int, totalPayOut *big.Int) (*big.Int, error) {
+	var out []interface{}
+	err := _Payout.contract.Call(opts, &out, "getClaimableAmount", userId, totalPayOut)
+
+	if err != nil {
+		return *new(*big.Int), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new(*big.Int)).(**big.Int)
+
+	return out0, err
+
+}
+
+// GetClaimableAmount is a free data retrieval call binding the contract method 0x9edf24d0.
+//
+// Solidity: function getClaimableAmount(uint256 userId, uint256 totalPayOut) view returns(uint256 amount)
+func (_Payout *PayoutSession) GetClaimableAmount(userId *big.Int, totalPayOut *big.Int) (*big.Int, error) {
+	return _Payout.Contract.GetClaimableAmount(&_Payout.CallOpts, userId, totalPayOut)
+}
+
+// GetClaimableAmount is a free data retrieval call binding the contract method 0x9edf24d0.
+//
+// Solidity: function getClaimableAmount(uint256 userId, uint256 totalPayOut) view returns(uint256 amount)
+func (_Payout *PayoutCallerSession) GetClaimableAmount(userId *big.Int, totalPayOut *big.Int) (*big.Int, error) {
+	return _Payout.Contract.GetClaimableAmount(&_Payout.CallOpts, userId, totalPayOut)
+}
+
+// GetPayedAmount is a free data retrieval call binding the contract method 0x12d11500.
+//
+// Solidity: function getPayedAmount(uint256 userId) view returns(uint256 amount)
+func (_Payout *PayoutCaller) GetPayedAmount(opts *bind.CallOpts, userId *big.Int) (*big.Int, error) {
+	var out []interface{}
+	err := _Payout.contract.Call(opts, &out, "getPayedAmount", userId)
+
+	if err != nil {
+		return *new(*big.Int), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new(*big.Int)).(**big.Int)
+
+	return out0, err
+
+}
+
+// GetPayedAmount is a free data retrieval call binding the contract method 0x12d11500.
+//
+// Solidity: function getPayedAmount(uint256 userId) view returns(uint256 amount)
+func (_Payout *PayoutSession) GetPayedAmount(userId *big.Int) (*big.Int, error) {
+	return _Payout.Contract.GetPayedAmount(&_Payout.CallOpts, userId)
+}
+
+// GetPayedAmount is a free data retrieval call binding the contract method 0x12d11500.
+//
+// Solidity: function getPayedAmount(uint256 userId) view returns(uint256 amount)
+func (_Payout *PayoutCallerSession) GetPayedAmount(userId *big.Int) (*big.Int, error) {
+	return _Payout.Contract.GetPayedAmount(&_Payout.CallOpts, userId)
+}
+
+// Owner is a free data retrieval call binding the contract method 0x8da5cb5b.
+//
+// Solidity: function owner() view returns(address)
+func (_Payout *PayoutCaller) Owner(opts *bind.CallOpts) (common.Address, error) {
+	var out []interface{}
+	err := _Payout.contract.Call(opts, &out, "owner")
+
+	if err != nil {
+		return *new(common.Address), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new(common.Address)).(*common.Address)
+
+	return out0, err
+
+}
+
+// Owner is a free data retrieval call binding the contract method 0x8da5cb5b.
+//
+// Solidity: function owner() view returns(address)
+func (_Payout *PayoutSession) Owner() (common.Address, error) {
+	return _Payout.Contract.Owner(&_Payout.CallOpts)
+}
+
+// Owner is a free data retrieval call binding the contract method 0x8da5cb5b.
+//
+// Solidity: function owner() view returns(address)
+func (_Payout *PayoutCallerSession) Owner() (common.Address, error) {
+	return _Payout.Contract.Owner(&_Payout.CallOpts)
+}
+
+// PayedOut is a free data retrieval call binding the contract method 0x68123c33.
+//
+// Solidity: function payedOut(uint256 ) view returns(uint256)
+func (_Payout *PayoutCaller) PayedOut(opts *bind.CallOpts, arg0 *big.Int) (*big.Int, error) {
+	var out []interface{}
+	err := _Payout.contract.Call(opts, &out, "payedOut", arg0)
+
+	if err != nil {
+		return *new(*big.Int), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new(*big.Int)).(**big.Int)
+
+	return out0, err
+
+}
+
+// PayedOut is a free data retrieval call binding the contract method 0x68123c33.
+//
+// Solidity: function payedOut(uint256 ) view returns(uint256)
+func (_Payout *PayoutSession) PayedOut(arg0 *big.Int) (*big.Int, error) {
+	return _Payout.Contract.PayedOut(&_Payout.CallOpts, arg0)
+}
+
+// PayedOut is a free data retrieval call binding the contract method 0x68123c33.
+//
+// Solidity: function payedOut(uint256 ) view returns(uint256)
+func (_Payout *PayoutCallerSession) PayedOut(arg0 *big.Int) (*big.Int, error) {
+	return _Payout.Contract.PayedOut(&_Payout.CallOpts, arg0)
+}
+
+// Symbol is a free data retrieval call binding the contract method 0x95d89b41.
+//
+// Solidity: function symbol() view returns(string)
+func (_Payout *PayoutCaller) Symbol(opts *bind.CallOpts) (string, error) {
+	var out []interface{}
+	err := _Payout.contract.Call(opts, &out, "symbol")
+
+	if err != nil {
+		return *new(string), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new(string)).(*string)
+
+	return out0, err
+
+}
+
+// Symbol is a free data retrieval call binding the contract method 0x95d89b41.
+//
+// Solidity: function symbol() view returns(string)
+func (_Payout *PayoutSession) Symbol() (string, error) {
+	return _Payout.Contract.Symbol(&_Payout.CallOpts)
+}
+
+// Symbol is a free data retrieval call binding the contract method 0x95d89b41.
+//
+// Solidity: function symbol() view returns(string)
+func (_Payout *PayoutCallerSession) Symbol() (string, error) {
+	return _Payout.Contract.Symbol(&_Payout.CallOpts)
+}
+
+// UsedNonces is a free data retrieval call binding the contract method 0x4774be9f.
+//
+// Solidity: function usedNonces(uint256 , uint256 ) view returns(bool)
+func (_Payout *PayoutCaller) UsedNonces(opts *bind.CallOpts, arg0 *big.Int, arg1 *big.Int) (bool, error) {
+	var out []interface{}
+	err := _Payout.contract.Call(opts, &out, "usedNonces", arg0, arg1)
+
+	if err != nil {
+		return *new(bool), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new(bool)).(*bool)
+
+	return out0, err
+
+}
+
+// UsedNonces is a free data retrieval call binding the contract method 0x4774be9f.
+//
+// Solidity: function usedNonces(uint256 , uint256 ) view returns(bool)
+func (_Payout *PayoutSession) UsedNonces(arg0 *big.Int, arg1 *big.Int) (bool, error) {
+	return _Payout.Contract.UsedNonces(&_Payout.CallOpts, arg0, arg1)
+}
+
+// UsedNonces is a free data retrieval call binding the contract method 0x4774be9f.
+//
+// Solidity: function usedNonces(uint256 , uint256 ) view returns(bool)
+func (_Payout *PayoutCallerSession) UsedNonces(arg0 *big.Int, arg1 *big.Int) (bool, error) {
+	return _Payout.Contract.UsedNonces(&_Payout.CallOpts, arg0, arg1)
+}
+
+// RenounceOwnership is a paid mutator transaction binding the contract method 0x715018a6.
+//
+// Solidity: function renounceOwnership() returns()
+func (_Payout *PayoutTransactor) RenounceOwnership(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _Payout.contract.Transact(opts, "renounceOwnership")
+}
+
+// RenounceOwnership is a paid mutator transaction binding the contract method 0x715018a6.
+//
+// Solidity: function renounceOwnership() returns()
+func (_Payout *PayoutSession) RenounceOwnership() (*types.Transaction, error) {
+	return _Payout.Contract.RenounceOwnership(&_Payout.TransactOpts)
+}
+
+// RenounceOwnership is a paid mutator transaction binding the contract method 0x715018a6.
+//
+// Solidity: function renounceOwnership() returns()
+func (_Payout *PayoutTransactorSession) RenounceOwnership() (*types.Transaction, error) {
+	return _Payout.Contract.RenounceOwnership(&_Payout.TransactOpts)
+}
+
+// SendRecover is a paid mutator transaction binding the contract method 0xd2fc98ea.
+//
+// Solidity: function sendRecover(address to, uint256 amount) returns()
+func (_Payout *PayoutTransactor) SendRecover(opts *bind.TransactOpts, to common.Address, amount *big.Int) (*types.Transaction, error) {
+	return _Payout.contract.Transact(opts, "sendRecover", to, amount)
+}
+
+// SendRecover is a paid mutator transaction binding the contract method 0xd2fc98ea.
+//
+// Solidity: function sendRecover(address to, uint256 amount) returns()
+func (_Payout *PayoutSession) SendRecover(to common.Address, amount *big.Int) (*types.Transaction, error) {
+	return _Payout.Contract.SendRecover(&_Payout.TransactOpts, to, amount)
+}
+
+// SendRecover is a paid mutator transaction binding the contract method 0xd2fc98ea.
+//
+// Solidity: function sendRecover(address to, uint256 amount) returns()
+func (_Payout *PayoutTransactorSession) SendRecover(to common.Address, amount *big.Int) (*types.Transaction, error) {
+	return _Payout.Contract.SendRecover(&_Payout.TransactOpts, to, amount)
+}
+
+// SendRecoverToken is a paid mutator transaction binding the contract method 0xb97c254c.
+//
+// Solidity: function sendRecoverToken(address token, address to, uint256 amount) returns()
+func (_Payout *PayoutTransactor) SendRecoverToken(opts *bind.TransactOpts, token common.Address, to common.Address, amount *big.Int) (*types.Transaction, error) {
+	return _Payout.contract.Transact(opts, "sendRecoverToken", token, to, amount)
+}
+
+// SendRecoverToken is a paid mutator transaction binding the contract method 0xb97c254c.
+//
+// Solidity: function sendRecoverToken(address token, address to, uint256 amount) returns()
+func (_Payout *PayoutSession) SendRecoverToken(token common.Address, to common.Address, amount *big.Int) (*types.Transaction, error) {
+	return _Payout.Contract.SendRecoverToken(&_Payout.TransactOpts, token, to, amount)
+}
+
+// SendRecoverToken is a paid mutator transaction binding the contract method 0xb97c254c.
+//
+// Solidity: function sendRecoverToken(address token, address to, uint256 amount) returns()
+func (_Payout *PayoutTransactorSession) SendRecoverToken(token common.Address, to common.Address, amount *big.Int) (*types.Transaction, error) {
+	return _Payout.Contract.SendRecoverToken(&_Payout.TransactOpts, token, to, amount)
+}
+
+// TransferOwnership is a paid mutator transaction binding the contract method 0xf2fde38b.
+//
+// Solidity: function transferOwnership(address newOwner) returns()
+func (_Payout *PayoutTransactor) TransferOwnership(opts *bind.TransactOpts, newOwner common.Address) (*types.Transaction, error) {
+	return _Payout.contract.Transact(opts, "transferOwnership", newOwner)
+}
+
+// TransferOwnership is a paid mutator transaction binding the contract method 0xf2fde38b.
+//
+// Solidity: function transferOwnership(address newOwner) returns()
+func (_Payout *PayoutSession) TransferOwnership(newOwner common.Address) (*types.Transaction, error) {
+	return _Payout.Contract.TransferOwnership(&_Payout.TransactOpts, newOwner)
+}
+
+// TransferOwnership is a paid mutator transaction binding the contract method 0xf2fde38b.
+//
+// Solidity: function transferOwnership(address newOwner) returns()
+func (_Payout *PayoutTransactorSession) TransferOwnership(newOwner common.Address) (*types.Transaction, error) {
+	return _Payout.Contract.TransferOwnership(&_Payout.TransactOpts, newOwner)
+}
+
+// Withdraw is a paid mutator transaction binding the contract method 0xd86a3851.
+//
+// Solidity: function withdraw(address dev, uint256 userId, address payee, uint256 totalPayOut, uint256 nonce, uint256 deadline, bytes signature) returns()
+func (_Payout *PayoutTransactor) Withdraw(opts *bind.TransactOpts, dev common.Address, userId *big.Int, payee common.Address, totalPayOut *big.Int, nonce *big.Int, deadline *big.Int, signature []byte) (*types.Transaction, error) {
+	return _Payout.contract.Transact(opts, "withdraw", dev, userId, payee, totalPayOut, nonce, deadline, signature)
+}
+
+// Withdraw is a paid mutator transaction binding the contract method 0xd86a3851.
+//
+// Solidity: function withdraw(address dev, uint256 userId, address payee, uint256 totalPayOut, uint256 nonce, uint256 deadline, bytes signature) returns()
+func (_Payout *PayoutSession) Withdraw(dev common.Address, userId *big.Int, payee common.Address, totalPayOut *big.Int, nonce *big.Int, deadline *big.Int, signature []byte) (*types.Transaction, error) {
+	return _Payout.Contract.Withdraw(&_Payout.TransactOpts, dev, userId, payee, totalPayOut, nonce, deadline, signature)
+}
+
+// Withdraw is a paid mutator transaction binding the contract method 0xd86a3851.
+//
+// Solidity: function withdraw(address dev, uint256 userId, address payee, uint256 totalPayOut, uint256 nonce, uint256 deadline, bytes signature) returns()
+func (_Payout *PayoutTransactorSession) Withdraw(dev common.Address, userId *big.Int, payee common.Address, totalPayOut *big.Int, nonce *big.Int, deadline *big.Int, signature []byte) (*types.Transaction, error) {
+	return _Payout.Contract.Withdraw(&_Payout.TransactOpts, dev, userId, payee, totalPayOut, nonce, deadline, signature)
+}
+
+// Receive is a paid mutator transaction binding the contract receive function.
+//
+// Solidity: receive() payable returns()
+func (_Payout *PayoutTransactor) Receive(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _Payout.contract.RawTransact(opts, nil) // calldata is disallowed for receive function
+}
+
+// Receive is a paid mutator transaction binding the contract receive function.
+//
+// Solidity: receive() payable returns()
+func (_Payout *PayoutSession) Receive() (*types.Transaction, error) {
+	return _Payout.Contract.Receive(&_Payout.TransactOpts)
+}
+
+// Receive is a paid mutator transaction binding the contract receive function.
+//
+// Solidity: receive() payable returns()
+func (_Payout *PayoutTransactorSession) Receive() (*types.Transaction, error) {
+	return _Payout.Contract.Receive(&_Payout.TransactOpts)
+}
+
+// PayoutEIP712DomainChangedIterator is returned from FilterEIP712DomainChanged and is used to iterate over the raw logs and unpacked data for EIP712DomainChanged events raised by the Payout contract.
+type PayoutEIP712DomainChangedIterator struct {
+	Event *PayoutEIP712DomainChanged // Event containing the contract specifics and raw log
+
+	contract *bind.BoundContract // Generic contract to use for unpacking event data
+	event    string              // Event name to use for unpacking event data
+
+	logs chan types.Log        // Log channel receiving the found contract events
+	sub  ethereum.Subscription // Subscription for errors, completion and termination
+	done bool                  // Whether the subscription completed delivering logs
+	fail error                 // Occurred error to stop iteration
+}
+
+// Next advances the iterator to the subsequent event, returning whether there
+// are any more events found. In case of a retrieval or parsing error, false is
+// returned and Error() can be queried for the exact failure.
+func (it *PayoutEIP712DomainChangedIterator) Next() bool {
+	// If the iterator failed, stop iterating
+	if it.fail != nil {
+		return false
+	}
+	// If the iterator completed, deliver directly whatever's available
+	if it.done {
+		select {
+		case log := <-it.logs:
+			it.Event = new(PayoutEIP712DomainChanged)
+			if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+				it.fail = err
+				return false
+			}
+			it.Event.Raw = log
+			return true
+
+		default:
+			return false
+		}
+	}
+	// Iterator still in progress, wait for either a data or an error event
+	select {
+	case log := <-it.logs:
+		it.Event = new(PayoutEIP712DomainChanged)
+		if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+			it.fail = err
+			return false
+		}
+		it.Event.Raw = log
+		return true
+
+	case err := <-it.sub.Err():
+		it.done = true
+		it.fail = err
+		return it.Next()
+	}
+}
+
+// Error returns any retrieval or parsing error occurred during filtering.
+func (it *PayoutEIP712DomainChangedIterator) Error() error {
+	return it.fail
+}
+
+// Close terminates the iteration process, releasing any pending underlying
+// resources.
+func (it *PayoutEIP712DomainChangedIterator) Close() error {
+	it.sub.Unsubscribe()
+	return nil
+}
+
+// PayoutEIP712DomainChanged represents a EIP712DomainChanged event raised by the Payout contract.
+type PayoutEIP712DomainChanged struct {
+	Raw types.Log // Blockchain specific contextual infos
+}
+
+// FilterEIP712DomainChanged is a free log retrieval operation binding the contract event 0x0a6387c9ea3628b88a633bb4f3b151770f70085117a15f9bf3787cda53f13d31.
+//
+// Solidity: event EIP712DomainChanged()
+func (_Payout *PayoutFilterer) FilterEIP712DomainChanged(opts *bind.FilterOpts) (*PayoutEIP712DomainChangedIterator, error) {
+
+	logs, sub, err := _Payout.contract.FilterLogs(opts, "EIP712DomainChanged")
+	if err != nil {
+		return nil, err
+	}
+	return &PayoutEIP712DomainChangedIterator{contract: _Payout.contract, event: "EIP712DomainChanged", logs: logs, sub: sub}, nil
+}
+
+// WatchEIP712DomainChanged is a free log subscription operation binding the contract event 0x0a6387c9ea3628b88a633bb4f3b151770f70085117a15f9bf3787cda53f13d31.
+//
+// Solidity: event EIP712DomainChanged()
+func (_Payout *PayoutFilterer) WatchEIP712DomainChanged(opts *bind.WatchOpts, sink chan<- *PayoutEIP712DomainChanged) (event.Subscription, error) {
+
+	logs, sub, err := _Payout.contract.WatchLogs(opts, "EIP712DomainChanged")
+	if err != nil {
+		return nil, err
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case log := <-logs:
+				// New log arrived, parse the event and forward to the user
+				event := new(PayoutEIP712DomainChanged)
+				if err := _Payout.contract.UnpackLog(event, "EIP712DomainChanged", log); err != nil {
+					return err
+				}
+				event.Raw = log
+
+				select {
+				case sink <- event:
+				case err := <-sub.Err():
+					return err
+				case <-quit:
+					return nil
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
+// ParseEIP712DomainChanged is a log parse operation binding the contract event 0x0a6387c9ea3628b88a633bb4f3b151770f70085117a15f9bf3787cda53f13d31.
+//
+// Solidity: event EIP712DomainChanged()
+func (_Payout *PayoutFilterer) ParseEIP712DomainChanged(log types.Log) (*PayoutEIP712DomainChanged, error) {
+	event := new(PayoutEIP712DomainChanged)
+	if err := _Payout.contract.UnpackLog(event, "EIP712DomainChanged", log); err != nil {
+		return nil, err
+	}
+	event.Raw = log
+	return event, nil
+}
+
+// PayoutOwnershipTransferredIterator is returned from FilterOwnershipTransferred and is used to iterate over the raw logs and unpacked data for OwnershipTransferred events raised by the Payout contract.
+type PayoutOwnershipTransferredIterator struct {
+	Event *PayoutOwnershipTransferred // Event containing the contract specifics and raw log
+
+	contract *bind.BoundContract // Generic contract to use for unpacking event data
+	event    string              // Event name to use for unpacking event data
+
+	logs chan types.Log        // Log channel receiving the found contract events
+	sub  ethereum.Subscription // Subscription for errors, completion and termination
+	done bool                  // Whether the subscription completed delivering logs
+	fail error                 // Occurred error to stop iteration
+}
+
+// Next advances the iterator to the subsequent event, returning whether there
+// are any more events found. In case of a retrieval or parsing error, false is
+// returned and Error() can be queried for the exact failure.
+func (it *PayoutOwnershipTransferredIterator) Next() bool {
+	// If the iterator failed, stop iterating
+	if it.fail != nil {
+		return false
+	}
+	// If the iterator completed, deliver directly whatever's available
+	if it.done {
+		select {
+		case log := <-it.logs:
+			it.Event = new(PayoutOwnershipTransferred)
+			if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+				it.fail = err
+				return false
+			}
+			it.Event.Raw = log
+			return true
+
+		default:
+			return false
+		}
+	}
+	// Iterator still in progress, wait for either a data or an error event
+	select {
+	case log := <-it.logs:
+		it.Event = new(PayoutOwnershipTransferred)
+		if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+			it.fail = err
+			return false
+		}
+		it.Event.Raw = log
+		return true
+
+	case err := <-it.sub.Err():
+		it.done = true
+		it.fail = err
+		return it.Next()
+	}
+}
+
+// Error returns any retrieval or parsing error occurred during filtering.
+func (it *PayoutOwnershipTransferredIterator) Error() error {
+	return it.fail
+}
+
+// Close terminates the iteration process, releasing any pending underlying
+// resources.
+func (it *PayoutOwnershipTransferredIterator) Close() error {
+	it.sub.Unsubscribe()
+	return nil
+}
+
+// PayoutOwnershipTransferred represents a OwnershipTransferred event raised by the Payout contract.
+type PayoutOwnershipTransferred struct {
+	PreviousOwner common.Address
+	NewOwner      common.Address
+	Raw           types.Log // Blockchain specific contextual infos
+}
+
+// FilterOwnershipTransferred is a free log retrieval operation binding the contract event 0x8be0079c531659141344cd1fd0a4f28419497f9722a3daafe3b4186f6b6457e0.
+//
+// Solidity: event OwnershipTransferred(address indexed previousOwner, address indexed newOwner)
+func (_Payout *PayoutFilterer) FilterOwnershipTransferred(opts *bind.FilterOpts, previousOwner []common.Address, newOwner []common.Address) (*PayoutOwnershipTransferredIterator, error) {
+
+	var previousOwnerRule []interface{}
+	for _, previousOwnerItem := range previousOwner {
+		previousOwnerRule = append(previousOwnerRule, previousOwnerItem)
+	}
+	var newOwnerRule []interface{}
+	for _, newOwnerItem := range newOwner {
+		newOwnerRule = append(newOwnerRule, newOwnerItem)
+	}
+
+	logs, sub, err := _Payout.contract.FilterLogs(opts, "OwnershipTransferred", previousOwnerRule, newOwnerRule)
+	if err != nil {
+		return nil, err
+	}
+	return &PayoutOwnershipTransferredIterator{contract: _Payout.contract, event: "OwnershipTransferred", logs: logs, sub: sub}, nil
+}
+
+// WatchOwnershipTransferred is a free log subscription operation binding the contract event 0x8be0079c531659141344cd1fd0a4f28419497f9722a3daafe3b4186f6b6457e0.
+//
+// Solidity: event OwnershipTransferred(address indexed previousOwner, address indexed newOwner)
+func (_Payout *PayoutFilterer) WatchOwnershipTransferred(opts *bind.WatchOpts, sink chan<- *PayoutOwnershipTransferred, previousOwner []common.Address, newOwner []common.Address) (event.Subscription, error) {
+
+	var previousOwnerRule []interface{}
+	for _, previousOwnerItem := range previousOwner {
+		previousOwnerRule = append(previousOwnerRule, previousOwnerItem)
+	}
+	var newOwnerRule []interface{}
+	for _, newOwnerItem := range newOwner {
+		newOwnerRule = append(newOwnerRule, newOwnerItem)
+	}
+
+	logs, sub, err := _Payout.contract.WatchLogs(opts, "OwnershipTransferred", previousOwnerRule, newOwnerRule)
+	if err != nil {
+		return nil, err
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case log := <-logs:
+				// New log arrived, parse the event and forward to the user
+				event := new(PayoutOwnershipTransferred)
+				if err := _Payout.contract.UnpackLog(event, "OwnershipTransferred", log); err != nil {
+					return err
+				}
+				event.Raw = log
+
+				select {
+				case sink <- event:
+				case err := <-sub.Err():
+					return err
+				case <-quit:
+					return nil
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
+// ParseOwnershipTransferred is a log parse operation binding the contract event 0x8be0079c531659141344cd1fd0a4f28419497f9722a3daafe3b4186f6b6457e0.
+//
+// Solidity: event OwnershipTransferred(address indexed previousOwner, address indexed newOwner)
+func (_Payout *PayoutFilterer) ParseOwnershipTransferred(log types.Log) (*PayoutOwnershipTransferred, error) {
+	event := new(PayoutOwnershipTransferred)
+	if err := _Payout.contract.UnpackLog(event, "OwnershipTransferred", log); err != nil {
+		return nil, err
+	}
+	event.Raw = log
+	return event, nil
+}
@@ -0,0 +1,118 @@
+package chain
+
+//go:generate go run github.com/ethereum/go-ethereum/cmd/abigen --abi Payout.abi --pkg chain --type Payout --out payout.go
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Backend is the part of an Ethereum client the watcher reads the chain with, the ethclient and the
+// simulated backend implement it
+type Backend interface {
+	BlockNumber(ctx context.Context) (uint64, error)
+	BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error)
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+}
+
+// Withdrawal is a successful withdraw of a Payout contract. The contract pays out the difference of the
+// total to what it paid out to the user id before.
+type Withdrawal struct {
+	TxHash      common.Hash
+	Block       uint64
+	Time        time.Time
+	Dev         common.Address
+	UserId      *big.Int
+	TotalPayOut *big.Int
+}
+
+// OwnerId is the user id of the contract in the format the signer returns it
+func (w Withdrawal) OwnerId() string {
+	return common.BigToHash(w.UserId).Hex()
+}
+
+// PayoutWatcher reads the withdrawals of a Payout contract from the blocks. The contract emits no event on
+// a withdrawal, so the transactions to the contract are decoded, and a withdrawal through another
+// contract is not seen.
+type PayoutWatcher struct {
+	backend       Backend
+	contract      common.Address
+	withdraw      abi.Method
+	confirmations uint64
+}
+
+func NewPayoutWatcher(backend Backend, contract common.Address, confirmations uint64) (*PayoutWatcher, error) {
+	a, err := PayoutMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	return &PayoutWatcher{backend, contract, a.Methods["withdraw"], confirmations}, nil
+}
+
+// Head returns the latest block with enough confirmations, false if the chain is not that long yet
+func (p *PayoutWatcher) Head(ctx context.Context) (uint64, bool, error) {
+	n, err := p.backend.BlockNumber(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	if n < p.confirmations {
+		return 0, false, nil
+	}
+	return n - p.confirmations, true, nil
+}
+
+// Withdrawals returns the successful withdrawals in the blocks from to, both included, in the order of
+// the chain
+func (p *PayoutWatcher) Withdrawals(ctx context.Context, from uint64, to uint64) ([]Withdrawal, error) {
+	var ws []Withdrawal
+	for n := from; n <= to; n++ {
+		b, err := p.backend.BlockByNumber(ctx, new(big.Int).SetUint64(n))
+		if err != nil {
+			return nil, fmt.Errorf("could not read block %v: %w", n, err)
+		}
+		for _, tx := range b.Transactions() {
+			w, ok := p.decode(tx)
+			if !ok {
+				continue
+			}
+			r, err := p.backend.TransactionReceipt(ctx, tx.Hash())
+			if err != nil {
+				return nil, fmt.Errorf("could not read receipt %v: %w", tx.Hash().Hex(), err)
+			}
+			if r.Status != types.ReceiptStatusSuccessful {
+				continue
+			}
+			w.Block = n
+			w.Time = time.Unix(int64(b.Time()), 0).UTC()
+			ws = append(ws, w)
+		}
+	}
+	return ws, nil
+}
+
+// decode returns the withdrawal of a transaction that calls withdraw of the contract
+func (p *PayoutWatcher) decode(tx *types.Transaction) (Withdrawal, bool) {
+	data := tx.Data()
+	if tx.To() == nil || *tx.To() != p.contract || len(data) < 4 ||
+		!bytes.Equal(data[:4], p.withdraw.ID) {
+		return Withdrawal{}, false
+	}
+	args, err := p.withdraw.Inputs.Unpack(data[4:])
+	if err != nil || len(args) != 7 {
+		return Withdrawal{}, false
+	}
+	dev, ok1 := args[0].(common.Address)
+	userId, ok2 := args[1].(*big.Int)
+	total, ok3 := args[3].(*big.Int)
+	if !ok1 || !ok2 || !ok3 {
+		return Withdrawal{}, false
+	}
+	return Withdrawal{TxHash: tx.Hash(), Dev: dev, UserId: userId, TotalPayOut: total}, true
+}
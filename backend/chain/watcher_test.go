@@ -0,0 +1,103 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	// the contracts are stubs, the watcher only reads the calldata and the status of the transactions
+	payoutContract = common.HexToAddress("0x00000000000000000000000000000000000000f1")
+	revertContract = common.HexToAddress("0x00000000000000000000000000000000000000f2")
+	// STOP
+	stopCode = []byte{0x00}
+	// PUSH1 0 PUSH1 0 REVERT
+	revertCode = []byte{0x60, 0x00, 0x60, 0x00, 0xfd}
+)
+
+func newSimulatedBackend(t *testing.T) (*simulated.Backend, *bind.TransactOpts) {
+	key, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	b := simulated.NewBackend(types.GenesisAlloc{
+		from:           {Balance: big.NewInt(1e18)},
+		payoutContract: {Code: stopCode},
+		revertContract: {Code: revertCode},
+	})
+	t.Cleanup(func() { b.Close() })
+
+	chainId, err := b.Client().ChainID(context.Background())
+	require.Nil(t, err)
+	opts, err := bind.NewKeyedTransactorWithChainID(key, chainId)
+	require.Nil(t, err)
+	return b, opts
+}
+
+func TestPayoutWatcherWithdrawals(t *testing.T) {
+	b, opts := newSimulatedBackend(t)
+	ctx := context.Background()
+	dev := common.HexToAddress("0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed")
+	userId := new(big.Int).SetBytes(crypto.Keccak256([]byte("3a5ec3b1-2d6c-4d2b-9d3e-0a6f6b0c1d2e")))
+	deadline := big.NewInt(1 << 40)
+
+	p, err := NewPayout(payoutContract, b.Client())
+	require.Nil(t, err)
+	tx1, err := p.Withdraw(opts, dev, userId, dev, big.NewInt(100), big.NewInt(1), deadline, []byte{1})
+	require.Nil(t, err)
+	b.Commit()
+
+	//a failed withdraw and a withdraw of another contract are not seen
+	r, err := NewPayout(revertContract, b.Client())
+	require.Nil(t, err)
+	opts.GasLimit = 100000
+	_, err = r.Withdraw(opts, dev, userId, dev, big.NewInt(200), big.NewInt(1), deadline, []byte{1})
+	require.Nil(t, err)
+	opts.GasLimit = 0
+	b.Commit()
+
+	//a plain transfer to the contract is no withdrawal
+	opts.Value = big.NewInt(1)
+	_, err = p.Receive(opts)
+	require.Nil(t, err)
+	opts.Value = nil
+	tx2, err := p.Withdraw(opts, dev, userId, dev, big.NewInt(300), big.NewInt(1), deadline, []byte{1})
+	require.Nil(t, err)
+	b.Commit()
+
+	w, err := NewPayoutWatcher(b.Client(), payoutContract, 1)
+	require.Nil(t, err)
+	head, ok, err := w.Head(ctx)
+	require.Nil(t, err)
+	require.True(t, ok)
+	assert.Equal(t, uint64(2), head)
+
+	//the last block has not enough confirmations yet
+	ws, err := w.Withdrawals(ctx, 1, head)
+	require.Nil(t, err)
+	require.Len(t, ws, 1)
+	assert.Equal(t, tx1.Hash(), ws[0].TxHash)
+	assert.Equal(t, uint64(1), ws[0].Block)
+	assert.Equal(t, dev, ws[0].Dev)
+	assert.Equal(t, "100", ws[0].TotalPayOut.String())
+	assert.Equal(t, common.BytesToHash(crypto.Keccak256([]byte("3a5ec3b1-2d6c-4d2b-9d3e-0a6f6b0c1d2e"))).Hex(),
+		ws[0].OwnerId())
+
+	//the watcher resumes after the last block it read
+	b.Commit()
+	head, _, err = w.Head(ctx)
+	require.Nil(t, err)
+	ws, err = w.Withdrawals(ctx, 3, head)
+	require.Nil(t, err)
+	require.Len(t, ws, 1)
+	assert.Equal(t, tx2.Hash(), ws[0].TxHash)
+	assert.Equal(t, "300", ws[0].TotalPayOut.String())
+}
@@ -4,6 +4,7 @@ import (
 	"backend/db"
 	"backend/util"
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"github.com/alecthomas/template"
@@ -18,19 +19,28 @@ import (
 )
 
 const (
-	KeyTopUpStripe         = "topup-stripe"
-	KeyTopUpOther          = "topup-other"
-	KeyTopUpUser1          = "topup-user1"
-	KeyTopUpUser2          = "topup-user2"
-	KeyMarketing           = "marketing"
-	KeyStripeFailed        = "stripe-failed"
-	KeyStripeAction        = "stripe-action"
-	KeyStripeSuccess       = "stripe-success"
-	KeyAddGit              = "add-git"
-	KeyPaymentNowFinished  = "paymentnow-finished"
-	KeyPaymentNowPartially = "paymentnow-partially"
-	KeyPaymentNowRefunded  = "paymentnow-refunded"
-	WaitToSendEmail        = 60 * 60 * 24 // for testing, the make it 7 days
+	KeyTopUpStripe          = "topup-stripe"
+	KeyTopUpOther           = "topup-other"
+	KeyTopUpUser1           = "topup-user1"
+	KeyTopUpUser2           = "topup-user2"
+	KeyMarketing            = "marketing"
+	KeyStripeFailed         = "stripe-failed"
+	KeyStripeAction         = "stripe-action"
+	KeyStripeSuccess        = "stripe-success"
+	KeyAddGit               = "add-git"
+	KeyPaymentNowFinished   = "paymentnow-finished"
+	KeyPaymentNowPartially  = "paymentnow-partially"
+	KeyPaymentNowRefunded   = "paymentnow-refunded"
+	KeyFundPolicy           = "fund-policy"
+	KeyStatement            = "statement"
+	KeySubscriptionPastDue  = "subscription-past-due"
+	KeySubscriptionGrace    = "subscription-grace"
+	KeySubscriptionCancel   = "subscription-canceled"
+	KeyChargeback           = "chargeback"
+	KeyChargebackAdmin      = "chargeback-admin"
+	KeyPayoutAddress        = "payout-address"
+	KeyPayoutAddressDefault = "payout-address-default"
+	WaitToSendEmail         = 60 * 60 * 24 // for testing, the make it 7 days
 )
 
 var (
@@ -137,9 +147,11 @@ func (e *EmailClient) prepareSendEmail(
 	templateKey string,
 	defaultSubject string,
 	defaultText string,
-	lang string) error {
+	lang string,
+	attachments ...EmailAttachment) error {
 
 	sendgridRequest := PrepareEmail(data["mailTo"], data, templateKey, defaultSubject, defaultText, lang)
+	sendgridRequest.Attachments = attachments
 
 	shouldSend, err := shouldSendEmail(uid, data["email"], data["key"])
 	if err != nil {
@@ -323,6 +335,54 @@ func (e *EmailClient) SendAddGit(userId uuid.UUID, email string, addGitEmailToke
 		params["lang"])
 }
 
+// SendPayoutAddress asks the user to confirm a payout address it proved to own, so an address added by
+// someone else with access to the account is noticed
+func (e *EmailClient) SendPayoutAddress(u db.UserDetail, a db.PayoutAddress, token string, lang string) error {
+	email := u.Email
+	var params = map[string]string{}
+	params["mailTo"] = email
+	params["email"] = email
+	params["address"] = a.Address
+	params["chain"] = a.Chain
+	params["url"] = e.emailLinkPrefix + "/confirm/payout-address/" + a.Id.String() + "/" + token
+	params["lang"] = lang
+	params["key"] = KeyPayoutAddress + a.Id.String()
+
+	return e.prepareSendEmail(
+		&u.Id,
+		params,
+		KeyPayoutAddress,
+		"Confirm your payout address",
+		"The "+params["chain"]+" address "+params["address"]+" was added to your payout addresses. "+
+			"If you added it, please confirm: "+params["url"],
+		params["lang"])
+}
+
+// SendPayoutAddressDefault tells the user that the payouts of the currency go to another address from
+// activeAt, so a default changed by someone else with access to the account is noticed before it is paid
+func (e *EmailClient) SendPayoutAddressDefault(u db.UserDetail, a db.PayoutAddress, currency string, activeAt time.Time, lang string) error {
+	email := u.Email
+	var params = map[string]string{}
+	params["mailTo"] = email
+	params["email"] = email
+	params["address"] = a.Address
+	params["chain"] = a.Chain
+	params["currency"] = currency
+	params["date"] = activeAt.UTC().Format(time.RFC1123)
+	params["url"] = e.emailLinkPrefix + "/user/income"
+	params["lang"] = lang
+	params["key"] = KeyPayoutAddressDefault + currency + a.Id.String() + activeAt.UTC().Format(time.RFC3339)
+
+	return e.prepareSendEmail(
+		&u.Id,
+		params,
+		KeyPayoutAddressDefault,
+		"Your payout address was changed",
+		"Your "+params["currency"]+" payouts go to the "+params["chain"]+" address "+params["address"]+
+			" from "+params["date"]+". If you did not change it, please check your payout addresses: "+params["url"],
+		params["lang"])
+}
+
 func (e *EmailClient) SendPaymentNowFinished(userId uuid.UUID, data WebhookResponse) error {
 	user, err := db.FindUserById(userId)
 	if err != nil {
@@ -356,9 +416,15 @@ func (e *EmailClient) SendPaymentNowPartially(userId uuid.UUID, data WebhookResp
 	params["email"] = email
 	params["url"] = e.emailLinkPrefix + "/user/payments"
 	params["lang"] = "en"
-	params["key"] = KeyPaymentNowPartially + data.OrderId.String()
-
-	defaultMessage := fmt.Sprintf("Only partial payment received (%v) of (%v), please send the rest (%v) to: ", data.ActuallyPaid, data.PayAmount, data.PayAmount-data.ActuallyPaid)
+	params["actual"] = fmt.Sprintf("%v %v", data.ActuallyPaid, strings.ToUpper(data.PayCurrency))
+	params["total"] = fmt.Sprintf("%v %v", data.PayAmount, strings.ToUpper(data.PayCurrency))
+	params["rest"] = fmt.Sprintf("%v %v", data.PayAmount-data.ActuallyPaid, strings.ToUpper(data.PayCurrency))
+	params["address"] = data.PayAddress
+	//every further partial payment is reported as well
+	params["key"] = KeyPaymentNowPartially + data.OrderId.String() + fmt.Sprint(data.ActuallyPaid)
+
+	defaultMessage := fmt.Sprintf("Only partial payment received (%v) of (%v), it is credited to your balance. "+
+		"Please send the rest (%v) to: %v", params["actual"], params["total"], params["rest"], params["address"])
 	return e.prepareSendEmail(
 		&user.Id,
 		params,
@@ -391,7 +457,8 @@ func (e *EmailClient) SendPaymentNowRefunded(userId uuid.UUID, status string, ex
 		params["lang"])
 }
 
-func (e *EmailClient) SendStripeSuccess(userId uuid.UUID, externalId uuid.UUID) error {
+// SendStripeSuccess confirms the payment, the invoice is attached if there is one
+func (e *EmailClient) SendStripeSuccess(userId uuid.UUID, externalId uuid.UUID, invoice ...EmailAttachment) error {
 	user, err := db.FindUserById(userId)
 	if err != nil {
 		return err
@@ -410,7 +477,8 @@ func (e *EmailClient) SendStripeSuccess(userId uuid.UUID, externalId uuid.UUID)
 		KeyStripeSuccess,
 		"Payment successful",
 		"Payment successful. See your payment here: "+params["url"],
-		params["lang"])
+		params["lang"],
+		invoice...)
 }
 
 func (e *EmailClient) SendStripeAction(userId uuid.UUID, externalId uuid.UUID) error {
@@ -457,6 +525,163 @@ func (e *EmailClient) SendStripeFailed(userId uuid.UUID, externalId uuid.UUID) e
 		params["lang"])
 }
 
+// SendFundPolicyNotice tells the sponsor what expires on runAt, unclaimedMap is the part of it that are
+// shares of invited contributors who did not register
+func (e *EmailClient) SendFundPolicyNotice(u db.UserDetail, policy string, balanceMap map[string]*big.Int,
+	unclaimedMap map[string]*big.Int, runAt time.Time) error {
+	email := u.Email
+	var params = map[string]string{}
+	params["mailTo"] = email
+	params["email"] = email
+	params["url"] = e.emailLinkPrefix + "/user/payments"
+	params["lang"] = "en"
+	params["policy"] = strings.ToLower(policy)
+	params["balance"] = util.PrintMap(balanceMap)
+	params["unclaimed"] = util.PrintMap(unclaimedMap)
+	params["date"] = runAt.Format("2006-01-02")
+	params["key"] = KeyFundPolicy + params["date"]
+
+	return e.prepareSendEmail(
+		&u.Id,
+		params,
+		KeyFundPolicy,
+		"Your unclaimed sponsoring is about to expire",
+		"Nobody claimed "+params["balance"]+" of your sponsoring yet. On "+params["date"]+
+			" the policy '"+params["policy"]+"' will be applied. You can change it here: "+params["url"],
+		params["lang"])
+}
+
+// SendStatement sends the earnings statement of the period as attachment. The same statement is sent at
+// most once a day, a user can request it again the next day.
+func (e *EmailClient) SendStatement(u db.UserDetail, period string, filename string, contentType string, content []byte) error {
+	email := u.Email
+	var params = map[string]string{}
+	params["mailTo"] = email
+	params["email"] = email
+	params["url"] = e.emailLinkPrefix + "/user/income"
+	params["lang"] = "en"
+	params["period"] = period
+	params["key"] = KeyStatement + period + "-" + util.TimeNow().Format("2006-01-02")
+
+	return e.prepareSendEmail(
+		&u.Id,
+		params,
+		KeyStatement,
+		"Your earnings statement for "+period,
+		"Attached is your earnings statement for "+period+". You can find all your statements here: "+params["url"],
+		params["lang"],
+		EmailAttachment{
+			Filename: filename,
+			Type:     contentType,
+			Content:  base64.StdEncoding.EncodeToString(content),
+		})
+}
+
+// SendSubscriptionPastDue tells the sponsor that the renewal failed and when it is retried
+func (e *EmailClient) SendSubscriptionPastDue(u db.UserDetail, retryAt time.Time, retry int) error {
+	email := u.Email
+	var params = map[string]string{}
+	params["mailTo"] = email
+	params["email"] = email
+	params["url"] = e.emailLinkPrefix + "/user/payments"
+	params["lang"] = "en"
+	params["date"] = retryAt.Format("2006-01-02")
+	params["retry"] = strconv.Itoa(retry)
+	params["key"] = KeySubscriptionPastDue + params["date"]
+
+	return e.prepareSendEmail(
+		&u.Id,
+		params,
+		KeySubscriptionPastDue,
+		"Your subscription could not be renewed",
+		"We could not charge your credit card to renew your subscription. We will try again on "+params["date"]+
+			". To update your credit card, please go to: "+params["url"],
+		params["lang"])
+}
+
+// SendSubscriptionGrace tells the sponsor that all retries failed and the subscription ends after the grace period
+func (e *EmailClient) SendSubscriptionGrace(u db.UserDetail, graceUntil time.Time) error {
+	email := u.Email
+	var params = map[string]string{}
+	params["mailTo"] = email
+	params["email"] = email
+	params["url"] = e.emailLinkPrefix + "/user/payments"
+	params["lang"] = "en"
+	params["date"] = graceUntil.Format("2006-01-02")
+	params["key"] = KeySubscriptionGrace + params["date"]
+
+	return e.prepareSendEmail(
+		&u.Id,
+		params,
+		KeySubscriptionGrace,
+		"Your subscription ends on "+params["date"],
+		"We could not renew your subscription. Your sponsoring continues until "+params["date"]+
+			", after that your subscription is canceled. To update your credit card, please go to: "+params["url"],
+		params["lang"])
+}
+
+func (e *EmailClient) SendSubscriptionCanceled(u db.UserDetail) error {
+	email := u.Email
+	var params = map[string]string{}
+	params["mailTo"] = email
+	params["email"] = email
+	params["url"] = e.emailLinkPrefix + "/user/payments"
+	params["lang"] = "en"
+	params["key"] = KeySubscriptionCancel + util.TimeNow().Format("2006-01-02")
+
+	return e.prepareSendEmail(
+		&u.Id,
+		params,
+		KeySubscriptionCancel,
+		"Your subscription was canceled",
+		"We could not renew your subscription and canceled it. To sponsor again, please go to: "+params["url"],
+		params["lang"])
+}
+
+func (e *EmailClient) SendChargeback(u db.UserDetail, c db.Chargeback) error {
+	email := u.Email
+	var params = map[string]string{}
+	params["mailTo"] = email
+	params["email"] = email
+	params["url"] = e.emailLinkPrefix + "/user/payments"
+	params["lang"] = "en"
+	params["kind"] = strings.ToLower(c.Kind)
+	params["balance"] = util.PrintMap(map[string]*big.Int{c.Currency: new(big.Int).Neg(c.Balance)})
+	params["key"] = KeyChargeback + c.Id.String()
+
+	return e.prepareSendEmail(
+		&u.Id,
+		params,
+		KeyChargeback,
+		"Your payment was reversed",
+		"A "+params["kind"]+" of "+params["balance"]+" was booked on your account. Your sponsoring is paused "+
+			"as long as your balance is negative. To top up, please go to: "+params["url"],
+		params["lang"])
+}
+
+func (e *EmailClient) SendChargebackAdmin(email string, u db.UserDetail, c db.Chargeback) error {
+	var params = map[string]string{}
+	params["mailTo"] = email
+	params["email"] = email
+	params["user"] = u.Email
+	params["lang"] = "en"
+	params["kind"] = strings.ToLower(c.Kind)
+	params["balance"] = util.PrintMap(map[string]*big.Int{c.Currency: new(big.Int).Neg(c.Balance)})
+	params["clawedBack"] = util.PrintMap(map[string]*big.Int{c.Currency: c.ClawedBack})
+	params["unrecovered"] = util.PrintMap(map[string]*big.Int{c.Currency: c.Unrecovered})
+	params["externalId"] = c.ExternalId.String()
+	params["key"] = KeyChargebackAdmin + c.Id.String()
+
+	return e.prepareSendEmail(
+		nil,
+		params,
+		KeyChargebackAdmin,
+		"[Admin] "+params["kind"]+" of "+params["user"],
+		"A "+params["kind"]+" of "+params["balance"]+" for the payment "+params["externalId"]+" of "+params["user"]+
+			" was booked. Clawed back: "+params["clawedBack"]+", unrecovered: "+params["unrecovered"]+".",
+		params["lang"])
+}
+
 type SendEmailRequest struct {
 	SendgridRequest SendgridRequest
 	Url             string
@@ -466,10 +691,18 @@ type SendEmailRequest struct {
 }
 
 type SendgridRequest struct {
-	MailTo      string `json:"mail_to,omitempty"`
-	Subject     string `json:"subject"`
-	TextMessage string `json:"text_message"`
-	HtmlMessage string `json:"html_message"`
+	MailTo      string            `json:"mail_to,omitempty"`
+	Subject     string            `json:"subject"`
+	TextMessage string            `json:"text_message"`
+	HtmlMessage string            `json:"html_message"`
+	Attachments []EmailAttachment `json:"attachments,omitempty"`
+}
+
+// EmailAttachment is a file sent with the email, the content is base64 encoded
+type EmailAttachment struct {
+	Filename string `json:"filename"`
+	Type     string `json:"type"`
+	Content  string `json:"content"`
 }
 
 func SendEmail(sendEmailRequest SendEmailRequest) error {
@@ -486,6 +719,13 @@ func SendEmail(sendEmailRequest SendEmailRequest) error {
 			mail.NewEmail("", sendEmailRequest.SendgridRequest.MailTo),
 			sendEmailRequest.SendgridRequest.TextMessage,
 			sendEmailRequest.SendgridRequest.HtmlMessage)
+		for _, a := range sendEmailRequest.SendgridRequest.Attachments {
+			sendGridReq.AddAttachment(mail.NewAttachment().
+				SetContent(a.Content).
+				SetType(a.Type).
+				SetFilename(a.Filename).
+				SetDisposition("attachment"))
+		}
 		jsonData, err = json.Marshal(sendGridReq)
 	} else {
 		jsonData, err = json.Marshal(sendEmailRequest.SendgridRequest)
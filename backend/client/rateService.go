@@ -0,0 +1,86 @@
+package client
+
+import (
+	"backend/db"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// RateProvider returns the exchange rates of a day. A rate says how many whole units of CurrencyTo one
+// whole unit of CurrencyFrom is worth.
+type RateProvider interface {
+	Rates(day time.Time) ([]db.ExchangeRate, error)
+}
+
+type fileRate struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Rate string `json:"rate"`
+	Day  string `json:"day"`
+}
+
+// FileRateProvider reads the rates from a JSON file, used for tests and local development. An entry
+// without a day is valid for every day, an entry with a day is valid from that day on until the next
+// entry of the same pair.
+type FileRateProvider struct {
+	path string
+}
+
+func NewFileRateProvider(path string) *FileRateProvider {
+	return &FileRateProvider{path: path}
+}
+
+func (f *FileRateProvider) Rates(day time.Time) ([]db.ExchangeRate, error) {
+	content, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, err
+	}
+	var frs []fileRate
+	err = json.Unmarshal(content, &frs)
+	if err != nil {
+		return nil, err
+	}
+
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	latest := map[string]fileRate{}
+	var order []string
+	for _, fr := range frs {
+		if fr.Day != "" {
+			d, err := time.Parse(time.DateOnly, fr.Day)
+			if err != nil {
+				return nil, err
+			}
+			if d.After(day) {
+				continue
+			}
+		}
+		key := strings.ToUpper(fr.From) + "/" + strings.ToUpper(fr.To)
+		prev, ok := latest[key]
+		if !ok {
+			order = append(order, key)
+		}
+		if !ok || prev.Day <= fr.Day {
+			latest[key] = fr
+		}
+	}
+
+	rs := make([]db.ExchangeRate, 0, len(order))
+	for _, key := range order {
+		fr := latest[key]
+		rate, ok := new(big.Float).SetString(fr.Rate)
+		if !ok || rate.Sign() <= 0 {
+			return nil, fmt.Errorf("not a valid rate %v for %v", fr.Rate, key)
+		}
+		rs = append(rs, db.ExchangeRate{
+			CurrencyFrom: strings.ToUpper(fr.From),
+			CurrencyTo:   strings.ToUpper(fr.To),
+			Rate:         rate,
+			Day:          day,
+		})
+	}
+	return rs, nil
+}
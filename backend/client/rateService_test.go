@@ -0,0 +1,51 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileRateProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+	err := os.WriteFile(path, []byte(`[
+		{"from": "gas", "to": "usd", "rate": "4.5"},
+		{"from": "ETH", "to": "USD", "rate": "2500", "day": "2026-10-01"},
+		{"from": "ETH", "to": "USD", "rate": "2600", "day": "2026-10-03"},
+		{"from": "ETH", "to": "USD", "rate": "2400", "day": "2026-10-02"}
+	]`), 0600)
+	require.NoError(t, err)
+	p := NewFileRateProvider(path)
+
+	rs, err := p.Rates(time.Date(2026, 10, 2, 12, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Len(t, rs, 2)
+	assert.Equal(t, "GAS", rs[0].CurrencyFrom)
+	assert.Equal(t, "USD", rs[0].CurrencyTo)
+	assert.Equal(t, "4.5", rs[0].Rate.Text('f', 1))
+	assert.Equal(t, "ETH", rs[1].CurrencyFrom)
+	assert.Equal(t, "2400", rs[1].Rate.Text('f', 0))
+	assert.Equal(t, time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC), rs[1].Day)
+
+	//before the first dated entry only the undated rate is known
+	rs, err = p.Rates(time.Date(2026, 9, 30, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Len(t, rs, 1)
+	assert.Equal(t, "GAS", rs[0].CurrencyFrom)
+}
+
+func TestFileRateProviderInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+	err := os.WriteFile(path, []byte(`[{"from": "ETH", "to": "USD", "rate": "-1"}]`), 0600)
+	require.NoError(t, err)
+
+	_, err = NewFileRateProvider(path).Rates(time.Now())
+	assert.Error(t, err)
+
+	_, err = NewFileRateProvider(filepath.Join(t.TempDir(), "missing.json")).Rates(time.Now())
+	assert.Error(t, err)
+}
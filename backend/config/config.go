@@ -28,7 +28,42 @@ type Config struct {
 	NEOPrivateKey             string
 	ETHPrivateKey             string
 	ETHContractAddress        string
+	USDCContractAddress       string
+	EthChainId                int
+	PayoutSignatureDays       int
+	PayoutAddressCooldownDays int
+	EthRpcUrl                 string
+	EthStartBlock             int
+	PayoutConfirmations       int
 	AnalyzerUrl               string
 	AnalyzerUsername          string
 	AnalyzerPassword          string
+	FundPolicy                string
+	FundPolicyMonths          int
+	FundPolicyNoticeDays      int
+	FundPolicyPoolEmail       string
+	ForwardMaxDepth           int
+	DependencyShare           int
+	DependencyDecay           int
+	DependencyMaxDepth        int
+	SpendingStrategy          string
+	SpendingCostOrder         string
+	ExchangeRateFile          string
+	ExchangeRateBase          string
+	CronDaily                 string
+	CronHourly                string
+	DailyWorkers              int
+	ArchiveMonths             int
+	SubscriptionRenewDays     int
+	SubscriptionRetryDays     string
+	SubscriptionGraceDays     int
+	ChargebackClawback        string
+	CronWebhook               string
+	WebhookMaxAttempts        int
+	CronPayoutBatch           string
+	CronPayoutWatch           string
+	PaymentProvider           string
+	BankIban                  string
+	BankBic                   string
+	BankAccountHolder         string
 }
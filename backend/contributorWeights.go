@@ -0,0 +1,135 @@
+package main
+
+import (
+	"backend/db"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// contributorWeights are the weights of the latest analysis of a repo. Users who connected their git
+// email are in uidInMap, the other emails in uidNotInMap, and total is the sum of the users' weights.
+type contributorWeights struct {
+	uidInMap    map[uuid.UUID]float64
+	uidNotInMap map[string]float64
+	total       float64
+}
+
+// weightCache resolves the contributor weights of a repo once per daily run, instead of once per sponsor
+// of the repo. It is safe to use from several workers.
+type weightCache struct {
+	mu sync.Mutex
+	//a nil value is a repo that was never analyzed
+	m map[uuid.UUID]*contributorWeights
+}
+
+func newWeightCache() *weightCache {
+	return &weightCache{m: map[uuid.UUID]*contributorWeights{}}
+}
+
+// load fetches the weights of the repos that are not cached yet with one query
+func (wc *weightCache) load(rids []uuid.UUID) error {
+	wc.mu.Lock()
+	var missing []uuid.UUID
+	for _, rid := range rids {
+		if _, ok := wc.m[rid]; !ok {
+			missing = append(missing, rid)
+		}
+	}
+	wc.mu.Unlock()
+	if len(missing) == 0 {
+		return nil
+	}
+
+	m, err := db.FindContributorWeights(missing)
+	if err != nil {
+		return err
+	}
+
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	for _, rid := range missing {
+		cws, ok := m[rid]
+		if !ok {
+			wc.m[rid] = nil
+			continue
+		}
+		w := &contributorWeights{uidInMap: map[uuid.UUID]float64{}, uidNotInMap: map[string]float64{}}
+		for _, cw := range cws {
+			if cw.UserId != nil {
+				w.uidInMap[*cw.UserId] += cw.Weight
+				w.total += cw.Weight
+			} else {
+				w.uidNotInMap[cw.GitEmail] += cw.Weight
+			}
+		}
+		wc.m[rid] = w
+	}
+	return nil
+}
+
+// get returns the weights of the repo, the maps are nil if the repo was never analyzed. The maps are
+// shared between the workers and must not be modified.
+func (wc *weightCache) get(rid uuid.UUID) (map[uuid.UUID]float64, map[string]float64, float64, error) {
+	err := wc.load([]uuid.UUID{rid})
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	w := wc.m[rid]
+	if w == nil {
+		return nil, nil, 0, nil
+	}
+	return w.uidInMap, w.uidNotInMap, w.total, nil
+}
+
+func getContributorWeights(rid uuid.UUID) (map[uuid.UUID]float64, map[string]float64, float64, error) {
+	return newWeightCache().get(rid)
+}
+
+// runWorkers calls fn for every job with at most workers goroutines. After the first error no new jobs
+// are started, and the first error is returned once the running jobs are done.
+func runWorkers[T any](workers int, jobs []T, fn func(T) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+	var mu sync.Mutex
+	var firstErr error
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil
+	}
+
+	ch := make(chan T)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range ch {
+				if failed() {
+					continue
+				}
+				err := fn(job)
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, job := range jobs {
+		if failed() {
+			break
+		}
+		ch <- job
+	}
+	close(ch)
+	wg.Wait()
+	return firstErr
+}
@@ -2,28 +2,60 @@
  * We cannot use go-cron or other awesome cron implementations as we want to timewarp. So this is a quick
  * and dirty cron that checks every second if there needs to be done something. Its not efficient, but
  * a very simple solution that works with timewarping.
+ *
+ * Named jobs keep their next execution time and their run history in a Store. With several replicas,
+ * only the instance holding the lease runs jobs, the others wait until the lease expires.
  */
 
 package cron
 
 import (
 	"backend/util"
+	"fmt"
 	"log/slog"
+	"sync"
 	"time"
 )
 
+// the lease is renewed on every check and while a job runs, if an instance stops renewing, another one
+// takes over after the lease time
+const leaseTime = 5 * time.Minute
+
 var (
-	jobs []Job
-	done = make(chan bool)
-	t    *time.Ticker
+	jobs  []Job
+	done  = make(chan bool)
+	t     *time.Ticker
+	store Store
+	owner string
 )
 
 type Job struct {
+	name         string
+	expr         string
 	job          func(now time.Time) error
 	nextExecAt   time.Time
 	nextExecFunc func(now time.Time) time.Time
 }
 
+// Store persists the state of named jobs and elects the instance that runs them
+type Store interface {
+	// AcquireCronLease returns true if owner holds the lease until the given time, that is if the lease
+	// is free, expired or already held by the owner. The returned fencing token changes with every new owner.
+	AcquireCronLease(owner string, now time.Time, until time.Time) (int64, bool, error)
+	// FindCronNextExecAt returns nil for a job that never ran
+	FindCronNextExecAt(name string) (*time.Time, error)
+	// RecordCronRun stores the run and the next execution of the job, it returns false and stores nothing
+	// if owner no longer holds the lease with the token
+	RecordCronRun(name string, schedule string, owner string, token int64, scheduledAt time.Time,
+		startedAt time.Time, finishedAt time.Time, errMsg *string, nextExecAt time.Time) (bool, error)
+}
+
+// SetStore persists the named jobs, owner identifies this instance for the leader lease
+func SetStore(s Store, o string) {
+	store = s
+	owner = o
+}
+
 func init() {
 	go func() {
 		t = time.NewTicker(5 * time.Second)
@@ -39,22 +71,127 @@ func init() {
 }
 
 func check() {
+	var token int64
+	if store != nil {
+		now := util.TimeNow()
+		var leader bool
+		var err error
+		token, leader, err = store.AcquireCronLease(owner, now, now.Add(leaseTime))
+		if err != nil {
+			slog.Error("Could not acquire cron lease",
+				slog.String("owner", owner),
+				slog.Any("error", err))
+			return
+		}
+		if !leader {
+			return
+		}
+	}
+
 	for k, job := range jobs {
+		persistent := store != nil && job.name != ""
+		if persistent {
+			nextExecAt, err := store.FindCronNextExecAt(job.name)
+			if err != nil {
+				slog.Error("Could not find next execution of job",
+					slog.String("name", job.name),
+					slog.Any("error", err))
+				continue
+			}
+			//a job that never ran keeps the time it was registered with
+			if nextExecAt != nil {
+				job.nextExecAt = *nextExecAt
+			}
+		}
+
 		for job.nextExecAt.Before(util.TimeNow()) {
 			slog.Info("About to execute job",
+				slog.String("name", job.name),
 				slog.Any("time", job.nextExecAt))
+			startedAt := util.TimeNow()
+			stop := renewLease(token)
 			err := job.job(job.nextExecAt)
+			stop()
 			if err != nil {
 				slog.Error("Error in job run",
+					slog.String("name", job.name),
 					slog.Any("time", job.nextExecAt),
 					slog.Any("error", err))
 			}
+			scheduledAt := job.nextExecAt
 			job.nextExecAt = job.nextExecFunc(job.nextExecAt)
 			jobs[k].nextExecAt = job.nextExecAt
+
+			if persistent && !persistRun(job, token, scheduledAt, startedAt, err) {
+				//another instance took over, it runs the remaining jobs
+				return
+			}
 		}
 	}
 }
 
+// renewLease keeps the lease while a job runs, so a job that runs longer than the lease time is not
+// run a second time by another instance. The returned func stops the renewal.
+func renewLease(token int64) func() {
+	if store == nil {
+		return func() {}
+	}
+	stop := make(chan bool)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r := time.NewTicker(leaseTime / 3)
+		defer r.Stop()
+		for {
+			select {
+			case <-r.C:
+				now := util.TimeNow()
+				tk, leader, err := store.AcquireCronLease(owner, now, now.Add(leaseTime))
+				if err != nil {
+					slog.Error("Could not renew cron lease",
+						slog.String("owner", owner),
+						slog.Any("error", err))
+					continue
+				}
+				if !leader || tk != token {
+					slog.Warn("Lost cron lease while a job runs",
+						slog.String("owner", owner))
+					return
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		wg.Wait()
+	}
+}
+
+// persistRun returns false if this instance lost the lease, then the run is not recorded
+func persistRun(job Job, token int64, scheduledAt time.Time, startedAt time.Time, jobErr error) bool {
+	var errMsg *string
+	if jobErr != nil {
+		errMsg = util.StringPointer(jobErr.Error())
+	}
+	now := util.TimeNow()
+	ok, err := store.RecordCronRun(job.name, job.expr, owner, token, scheduledAt, startedAt, now, errMsg, job.nextExecAt)
+	if err != nil {
+		slog.Error("Could not store job run",
+			slog.String("name", job.name),
+			slog.Any("error", err))
+		return true
+	}
+	if !ok {
+		slog.Warn("Lost cron lease, job run not recorded",
+			slog.String("name", job.name),
+			slog.String("owner", owner))
+	}
+	return ok
+}
+
 func CheckNow() {
 	check()
 }
@@ -71,6 +208,28 @@ func CronJobDay(job func(now time.Time) error, now time.Time) {
 		nextExecAt:   now}) //run this job at startup
 }
 
+// CronJob schedules a named job with a cron expression like "0 0 * * *" or "@daily". A job that never
+// ran before runs at startup, after that the next execution comes from the store, so a restart does not
+// run the job again.
+func CronJob(name string, expr string, job func(now time.Time) error, now time.Time) error {
+	s, err := ParseSchedule(expr)
+	if err != nil {
+		return err
+	}
+	for _, j := range jobs {
+		if j.name == name {
+			return fmt.Errorf("job %v already scheduled", name)
+		}
+	}
+	jobs = append(jobs, Job{
+		name:         name,
+		expr:         s.String(),
+		job:          job,
+		nextExecFunc: s.Next,
+		nextExecAt:   now})
+	return nil
+}
+
 func timeDayPlusOne(now time.Time) time.Time {
 	return time.Date(now.Year(), now.Month(), now.Day()+1, now.Hour(), now.Minute(), now.Second(), now.Nanosecond(), now.Location())
 }
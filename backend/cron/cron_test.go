@@ -3,6 +3,8 @@ package cron
 import (
 	"backend/util"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
 	"testing"
 	"time"
 )
@@ -210,3 +212,150 @@ func TestTwoHourlyJobs(t *testing.T) {
 	// Reset the time after the test
 	util.ResetTimeNow()
 }
+
+type memStore struct {
+	mu         sync.Mutex
+	leaseOwner string
+	leaseUntil time.Time
+	leaseToken int64
+	nextExecAt map[string]time.Time
+	runs       []string
+}
+
+func newMemStore() *memStore {
+	return &memStore{nextExecAt: map[string]time.Time{}}
+}
+
+func (m *memStore) AcquireCronLease(owner string, now time.Time, until time.Time) (int64, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.leaseOwner != "" && m.leaseOwner != owner && now.Before(m.leaseUntil) {
+		return 0, false, nil
+	}
+	if m.leaseOwner != owner {
+		m.leaseToken++
+	}
+	m.leaseOwner = owner
+	m.leaseUntil = until
+	return m.leaseToken, true, nil
+}
+
+func (m *memStore) FindCronNextExecAt(name string) (*time.Time, error) {
+	n, ok := m.nextExecAt[name]
+	if !ok {
+		return nil, nil
+	}
+	return &n, nil
+}
+
+func (m *memStore) RecordCronRun(name string, _ string, owner string, token int64, _ time.Time,
+	_ time.Time, _ time.Time, _ *string, nextExecAt time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.leaseOwner != owner || m.leaseToken != token {
+		return false, nil
+	}
+	m.nextExecAt[name] = nextExecAt
+	m.runs = append(m.runs, name+"@"+owner)
+	return true, nil
+}
+
+func TestCronJobPersistent(t *testing.T) {
+	jobs = nil
+	s := newMemStore()
+	SetStore(s, "instance1")
+	defer SetStore(nil, "")
+	defer util.ResetTimeNow()
+
+	var executed int
+	testJob := func(now time.Time) error {
+		executed++
+		return nil
+	}
+
+	err := CronJob("daily", "@daily", testJob, util.TimeNow())
+	assert.Nil(t, err)
+	err = CronJob("daily", "@daily", testJob, util.TimeNow())
+	assert.NotNil(t, err)
+
+	//never ran, so it runs at startup
+	util.AddTimeNowSeconds(1)
+	CheckNow()
+	assert.Equal(t, 1, executed)
+	require.Contains(t, s.nextExecAt, "daily")
+	assert.Equal(t, 0, s.nextExecAt["daily"].Hour())
+
+	//a restart does not run the job again
+	jobs = nil
+	err = CronJob("daily", "@daily", testJob, util.TimeNow())
+	assert.Nil(t, err)
+	CheckNow()
+	assert.Equal(t, 1, executed)
+
+	//timewarp by two days catches up both days
+	util.AddTimeNowSeconds(2 * 24 * 60 * 60)
+	CheckNow()
+	assert.Equal(t, 3, executed)
+	assert.Equal(t, []string{"daily@instance1", "daily@instance1", "daily@instance1"}, s.runs)
+}
+
+func TestCronJobLeader(t *testing.T) {
+	jobs = nil
+	s := newMemStore()
+	defer SetStore(nil, "")
+	defer util.ResetTimeNow()
+
+	var executed int
+	testJob := func(now time.Time) error {
+		executed++
+		return nil
+	}
+	err := CronJob("minute", "* * * * *", testJob, util.TimeNow())
+	assert.Nil(t, err)
+
+	//instance1 is the leader, instance2 shares the store but does not run anything
+	SetStore(s, "instance1")
+	util.AddTimeNowSeconds(1)
+	CheckNow()
+	assert.Equal(t, 1, executed)
+
+	SetStore(s, "instance2")
+	util.AddTimeNowSeconds(2 * 60)
+	CheckNow()
+	assert.Equal(t, 1, executed)
+
+	//instance1 is gone, after the lease expired, instance2 takes over and catches up
+	util.AddTimeNowSeconds(int(leaseTime.Seconds()))
+	CheckNow()
+	assert.Equal(t, "instance2", s.leaseOwner)
+	assert.Greater(t, executed, 1)
+	assert.Equal(t, "minute@instance2", s.runs[len(s.runs)-1])
+}
+
+func TestCronJobFenced(t *testing.T) {
+	jobs = nil
+	s := newMemStore()
+	SetStore(s, "instance1")
+	defer SetStore(nil, "")
+	defer util.ResetTimeNow()
+
+	var executed int
+	slowJob := func(now time.Time) error {
+		executed++
+		//the job runs past the lease, instance2 takes over meanwhile
+		util.AddTimeNowSeconds(int(2 * leaseTime.Seconds()))
+		_, ok, err := s.AcquireCronLease("instance2", util.TimeNow(), util.TimeNow().Add(leaseTime))
+		require.Nil(t, err)
+		require.True(t, ok)
+		return nil
+	}
+	err := CronJob("minute", "* * * * *", slowJob, util.TimeNow())
+	assert.Nil(t, err)
+
+	//the run of instance1 is not recorded and it stops catching up
+	util.AddTimeNowSeconds(1)
+	CheckNow()
+	assert.Equal(t, 1, executed)
+	assert.Empty(t, s.runs)
+	assert.NotContains(t, s.nextExecAt, "minute")
+}
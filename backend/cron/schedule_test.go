@@ -0,0 +1,88 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduleNext(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expr     string
+		input    time.Time
+		expected time.Time
+	}{
+		{
+			name:     "Daily at midnight",
+			expr:     "@daily",
+			input:    time.Date(2024, 1, 14, 12, 30, 0, 0, time.UTC),
+			expected: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "Daily exactly at midnight is the next day",
+			expr:     "0 0 * * *",
+			input:    time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC),
+			expected: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "Hourly",
+			expr:     "@hourly",
+			input:    time.Date(2024, 1, 14, 23, 59, 59, 0, time.UTC),
+			expected: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "Every 15 minutes",
+			expr:     "*/15 * * * *",
+			input:    time.Date(2024, 1, 14, 10, 16, 0, 0, time.UTC),
+			expected: time.Date(2024, 1, 14, 10, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "Weekdays at 6:30",
+			expr:     "30 6 * * 1-5",
+			input:    time.Date(2024, 1, 12, 7, 0, 0, 0, time.UTC), // friday
+			expected: time.Date(2024, 1, 15, 6, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "Sunday as 7",
+			expr:     "0 0 * * 7",
+			input:    time.Date(2024, 1, 12, 7, 0, 0, 0, time.UTC),
+			expected: time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "Leap day",
+			expr:     "0 0 29 2 *",
+			input:    time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			expected: time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "Day of month or day of week",
+			expr:     "0 0 1 * 1",
+			input:    time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), // tuesday
+			expected: time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "List",
+			expr:     "0 8,20 * * *",
+			input:    time.Date(2024, 1, 14, 9, 0, 0, 0, time.UTC),
+			expected: time.Date(2024, 1, 14, 20, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := ParseSchedule(tc.expr)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, s.Next(tc.input))
+		})
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "*/0 * * * *", "5-1 * * * *", "a * * * *", "0 0 30 2 *"} {
+		_, err := ParseSchedule(expr)
+		assert.Error(t, err, expr)
+	}
+}
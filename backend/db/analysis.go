@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 type AnalysisRequest struct {
@@ -193,4 +194,55 @@ func (db *DB) FindRepoContributors(repoId uuid.UUID) (int, error) {
 	}
 
 	return c, nil
-}
\ No newline at end of file
+}
+// ContributorWeight is the weight of one git email in the latest analysis of a repo. UserId is set if
+// the email belongs to a user.
+type ContributorWeight struct {
+	GitEmail string
+	Weight   float64
+	UserId   *uuid.UUID
+}
+
+// FindContributorWeights returns the weights of the latest analysis for all the repos with one query.
+// Repos that were never analyzed are not in the map, repos whose analysis found nobody have an empty
+// slice.
+func (db *DB) FindContributorWeights(repoIds []uuid.UUID) (map[uuid.UUID][]ContributorWeight, error) {
+	rows, err := db.Query(`
+		SELECT a.repo_id, m.git_email, m.weight, g.user_id
+		FROM (
+			SELECT id, repo_id,
+			       ROW_NUMBER() OVER (PARTITION BY repo_id ORDER BY date_to DESC, created_at DESC) dest_rank
+			FROM analysis_request
+			WHERE repo_id = ANY($1)
+		) AS a
+		    LEFT JOIN repo_metrics m ON m.analysis_request_id = a.id
+		    LEFT JOIN (
+		        SELECT DISTINCT ON (email) email, user_id
+		        FROM git_email
+		        ORDER BY email, created_at
+		    ) AS g ON g.email = m.git_email
+		WHERE a.dest_rank = 1`, pq.Array(repoIds))
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	m := map[uuid.UUID][]ContributorWeight{}
+	for rows.Next() {
+		var repoId uuid.UUID
+		var gitEmail sql.NullString
+		var weight sql.NullFloat64
+		var userId *uuid.UUID
+		err = rows.Scan(&repoId, &gitEmail, &weight, &userId)
+		if err != nil {
+			return nil, err
+		}
+		if m[repoId] == nil {
+			m[repoId] = []ContributorWeight{}
+		}
+		if gitEmail.Valid {
+			m[repoId] = append(m[repoId], ContributorWeight{GitEmail: gitEmail.String, Weight: weight.Float64, UserId: userId})
+		}
+	}
+	return m, nil
+}
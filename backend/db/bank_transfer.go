@@ -0,0 +1,198 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	BankLineMatched   = "MATCHED"
+	BankLineUnmatched = "UNMATCHED"
+	BankLineIgnored   = "IGNORED"
+)
+
+// BankTransfer is the payment request a sponsor pays by bank transfer, the reference in the remittance
+// information identifies it on the bank statement
+type BankTransfer struct {
+	Reference  string    `json:"reference"`
+	ExternalId uuid.UUID `json:"externalId"`
+	UserId     uuid.UUID `json:"-"`
+	Balance    *big.Int  `json:"balance"`
+	Currency   string    `json:"currency"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// BankStatementLine is a credit of an imported bank statement, the amount is in cents of the currency.
+// A line that matches no open transfer waits for an admin to match or ignore it.
+type BankStatementLine struct {
+	Id         uuid.UUID  `json:"id"`
+	LineId     string     `json:"lineId"`
+	BookedAt   time.Time  `json:"bookedAt"`
+	Cents      int64      `json:"cents"`
+	Currency   string     `json:"currency"`
+	Remittance string     `json:"remittance"`
+	Debtor     string     `json:"debtor"`
+	Status     string     `json:"status"`
+	ExternalId *uuid.UUID `json:"externalId,omitempty"`
+	ResolvedAt *time.Time `json:"resolvedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+func (db *DB) InsertBankTransfer(b BankTransfer) error {
+	_, err := db.Exec(`
+		INSERT INTO bank_transfer(reference, external_id, user_id, balance, currency, created_at)
+		VALUES($1, $2, $3, $4, $5, $6)`,
+		b.Reference, b.ExternalId, b.UserId, b.Balance.String(), b.Currency, b.CreatedAt)
+	return err
+}
+
+func (db *DB) FindBankTransfer(reference string) (*BankTransfer, error) {
+	var b BankTransfer
+	var s string
+	err := db.QueryRow(`
+		SELECT reference, external_id, user_id, balance, currency, created_at
+		FROM bank_transfer
+		WHERE reference = $1`, reference).
+		Scan(&b.Reference, &b.ExternalId, &b.UserId, &s, &b.Currency, &b.CreatedAt)
+
+	switch err {
+	case sql.ErrNoRows:
+		return nil, nil
+	case nil:
+		b1, ok := new(big.Int).SetString(s, 10)
+		if !ok {
+			return nil, fmt.Errorf("not a big.int %v", s)
+		}
+		b.Balance = b1
+		return &b, nil
+	default:
+		return nil, err
+	}
+}
+
+// InsertBankStatementLine stores the line as unmatched, it returns false if the line was imported before
+func (db *DB) InsertBankStatementLine(l BankStatementLine) (bool, error) {
+	res, err := db.Exec(`
+		INSERT INTO bank_statement_line(id, line_id, booked_at, cents, currency, remittance, debtor, status, created_at)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (line_id) DO NOTHING`,
+		l.Id, l.LineId, l.BookedAt, l.Cents, l.Currency, l.Remittance, l.Debtor, BankLineUnmatched, l.CreatedAt)
+	if err != nil {
+		return false, err
+	}
+	nr, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return nr == 1, nil
+}
+
+func (db *DB) FindBankStatementLine(id uuid.UUID) (*BankStatementLine, error) {
+	var l BankStatementLine
+	err := db.QueryRow(`
+		SELECT id, line_id, booked_at, cents, currency, remittance, debtor, status, external_id, resolved_at, created_at
+		FROM bank_statement_line
+		WHERE id = $1`, id).
+		Scan(&l.Id, &l.LineId, &l.BookedAt, &l.Cents, &l.Currency, &l.Remittance, &l.Debtor, &l.Status, &l.ExternalId,
+			&l.ResolvedAt, &l.CreatedAt)
+
+	switch err {
+	case sql.ErrNoRows:
+		return nil, nil
+	case nil:
+		return &l, nil
+	default:
+		return nil, err
+	}
+}
+
+// FindBankStatementLines returns the latest lines with the status, or of all statuses if it is empty
+func (db *DB) FindBankStatementLines(status string, limit int) ([]BankStatementLine, error) {
+	rows, err := db.Query(`
+		SELECT id, line_id, booked_at, cents, currency, remittance, debtor, status, external_id, resolved_at, created_at
+		FROM bank_statement_line
+		WHERE $1 = '' OR status = $1
+		ORDER BY created_at DESC, booked_at DESC
+		LIMIT $2`, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	ls := []BankStatementLine{}
+	for rows.Next() {
+		var l BankStatementLine
+		err = rows.Scan(&l.Id, &l.LineId, &l.BookedAt, &l.Cents, &l.Currency, &l.Remittance, &l.Debtor, &l.Status,
+			&l.ExternalId, &l.ResolvedAt, &l.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		ls = append(ls, l)
+	}
+	return ls, nil
+}
+
+// IsBankTransferMatched returns true if a line is matched to the payment request already
+func (db *DB) IsBankTransferMatched(externalId uuid.UUID) (bool, error) {
+	var nr int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM bank_statement_line
+		WHERE external_id = $1 AND status = $2`, externalId, BankLineMatched).Scan(&nr)
+	return nr > 0, err
+}
+
+// MatchBankStatementLine matches an unmatched line to the payment request and stores the event that books
+// it in the same transaction, so a matched line is always booked. It returns false if the line was
+// matched or ignored before, then the event is not stored.
+func (db *DB) MatchBankStatementLine(id uuid.UUID, externalId uuid.UUID, e WebhookEvent, now time.Time) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		UPDATE bank_statement_line SET status = $2, external_id = $3, resolved_at = $4
+		WHERE id = $1 AND status = $5`, id, BankLineMatched, externalId, now, BankLineUnmatched)
+	if err != nil {
+		return false, err
+	}
+	nr, err := res.RowsAffected()
+	if err != nil || nr != 1 {
+		return false, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO webhook_event(id, provider, event_id, event_type, payload, status, next_attempt_at, created_at)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (provider, event_id) DO NOTHING`,
+		e.Id, e.Provider, e.EventId, e.EventType, []byte(e.Payload), WebhookPending, e.NextAttemptAt, e.CreatedAt)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// IgnoreBankStatementLine takes an unmatched line out of the review queue, e.g. a transfer that was
+// paid back to the sender
+func (db *DB) IgnoreBankStatementLine(id uuid.UUID, now time.Time) (bool, error) {
+	return db.resolveBankStatementLine(id, BankLineIgnored, nil, now)
+}
+
+func (db *DB) resolveBankStatementLine(id uuid.UUID, status string, externalId *uuid.UUID, now time.Time) (bool, error) {
+	res, err := db.Exec(`
+		UPDATE bank_statement_line SET status = $2, external_id = $3, resolved_at = $4
+		WHERE id = $1 AND status = $5`, id, status, externalId, now, BankLineUnmatched)
+	if err != nil {
+		return false, err
+	}
+	nr, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return nr == 1, nil
+}
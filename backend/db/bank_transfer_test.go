@@ -0,0 +1,108 @@
+package db
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBankTransferInsertAndFind(t *testing.T) {
+	TruncateAll(db, t)
+
+	u := createTestUser(t, db, "sponsor@example.com")
+	now := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+
+	b := BankTransfer{
+		Reference:  "FF7K2M9QXA4B",
+		ExternalId: uuid.New(),
+		UserId:     u.Id,
+		Balance:    big.NewInt(120000000),
+		Currency:   "USD",
+		CreatedAt:  now,
+	}
+	require.NoError(t, db.InsertBankTransfer(b))
+
+	r, err := db.FindBankTransfer(b.Reference)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, b.ExternalId, r.ExternalId)
+	assert.Equal(t, "120000000", r.Balance.String())
+
+	r, err = db.FindBankTransfer("FF0000000000")
+	require.NoError(t, err)
+	assert.Nil(t, r)
+}
+
+func TestBankStatementLineMatchOnce(t *testing.T) {
+	TruncateAll(db, t)
+
+	now := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	l := BankStatementLine{
+		Id:         uuid.New(),
+		LineId:     "2026101900001",
+		BookedAt:   now,
+		Cents:      12000,
+		Currency:   "USD",
+		Remittance: "FF7K2M9QXA4B",
+		Debtor:     "ACME AG",
+		CreatedAt:  now,
+	}
+	ok, err := db.InsertBankStatementLine(l)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	//the same statement is imported again
+	l2 := l
+	l2.Id = uuid.New()
+	ok, err = db.InsertBankStatementLine(l2)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ls, err := db.FindBankStatementLines(BankLineUnmatched, 10)
+	require.NoError(t, err)
+	require.Len(t, ls, 1)
+	assert.Equal(t, int64(12000), ls[0].Cents)
+
+	e := uuid.New()
+	matched, err := db.IsBankTransferMatched(e)
+	require.NoError(t, err)
+	assert.False(t, matched)
+
+	we := WebhookEvent{Id: uuid.New(), Provider: WebhookBank, EventId: l.Id.String(), EventType: "credit",
+		Payload: []byte(`{}`), NextAttemptAt: now, CreatedAt: now}
+	ok, err = db.MatchBankStatementLine(l.Id, e, we, now)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = db.IgnoreBankStatementLine(l.Id, now)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	//the booking is stored with the match, a second match stores nothing
+	es, err := db.FindWebhookEvents(WebhookPending, 10)
+	require.NoError(t, err)
+	require.Len(t, es, 1)
+	assert.Equal(t, l.Id.String(), es[0].EventId)
+	ok, err = db.MatchBankStatementLine(l.Id, uuid.New(), WebhookEvent{Id: uuid.New(), Provider: WebhookBank,
+		EventId: uuid.New().String(), EventType: "credit", Payload: []byte(`{}`), NextAttemptAt: now, CreatedAt: now}, now)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	es, err = db.FindWebhookEvents(WebhookPending, 10)
+	require.NoError(t, err)
+	assert.Len(t, es, 1)
+
+	matched, err = db.IsBankTransferMatched(e)
+	require.NoError(t, err)
+	assert.True(t, matched)
+	r, err := db.FindBankStatementLine(l.Id)
+	require.NoError(t, err)
+	assert.Equal(t, BankLineMatched, r.Status)
+	assert.Equal(t, e, *r.ExternalId)
+
+	ls, err = db.FindBankStatementLines(BankLineUnmatched, 10)
+	require.NoError(t, err)
+	assert.Len(t, ls, 0)
+}
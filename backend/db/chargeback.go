@@ -0,0 +1,239 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ClawbackNone      = "NONE"
+	ClawbackParked    = "PARKED"
+	ClawbackUnclaimed = "UNCLAIMED"
+)
+
+const (
+	ChargebackRefund  = "REFUND"
+	ChargebackDispute = "DISPUTE"
+)
+
+var Clawbacks = []string{ClawbackNone, ClawbackParked, ClawbackUnclaimed}
+
+// Chargeback is a refund or dispute of a payment. What the sponsor did not have anymore is clawed back
+// from the allocations, the rest is unrecovered and the balance of the sponsor stays negative.
+type Chargeback struct {
+	Id          uuid.UUID `json:"id"`
+	ExternalId  uuid.UUID `json:"externalId"`
+	UserId      uuid.UUID `json:"userId"`
+	Kind        string    `json:"kind"`
+	Balance     *big.Int  `json:"balance"`
+	ClawedBack  *big.Int  `json:"clawedBack"`
+	Unrecovered *big.Int  `json:"unrecovered"`
+	Currency    string    `json:"currency"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// ClawbackSource is money of the sponsor that is not claimed yet, parked for a repo if the contributor
+// is nil, otherwise allocated to the contributor
+type ClawbackSource struct {
+	UserContributorId *uuid.UUID
+	RepoId            uuid.UUID
+	Balance           *big.Int
+}
+
+func IsValidClawback(clawback string) bool {
+	for _, v := range Clawbacks {
+		if v == clawback {
+			return true
+		}
+	}
+	return false
+}
+
+func (db *DB) InsertChargeback(c Chargeback) error {
+	_, err := db.Exec(`
+		INSERT INTO chargeback(id, external_id, user_id, kind, balance, clawed_back, unrecovered, currency, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		c.Id, c.ExternalId, c.UserId, c.Kind, c.Balance.String(), c.ClawedBack.String(), c.Unrecovered.String(),
+		c.Currency, c.CreatedAt)
+	return err
+}
+
+// ChargebackBooking is what a refund or dispute books at once: the reversed pay-in, what is clawed back
+// from the allocations of the sponsor on the last distributed day, and the chargeback
+type ChargebackBooking struct {
+	PayIn      PayInEvent
+	Clawbacks  []ClawbackSource
+	Day        *time.Time
+	Chargeback Chargeback
+	Inbox      *Inbox
+}
+
+// BookChargeback books the chargeback and cancels the subscription in one transaction, so a retried
+// webhook finds either all of it or nothing. The day was booked by the daily runner already, so the
+// clawbacks are added to its rows.
+func (db *DB) BookChargeback(b ChargebackBooking) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = processInbox(tx, b.Inbox)
+	if err != nil {
+		return err
+	}
+
+	p := b.PayIn
+	_, err = tx.Exec(`
+		INSERT INTO payment_in_event(id, external_id, user_id, balance, currency, status, seats, freq, created_at)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (status, external_id) DO UPDATE SET balance = EXCLUDED.balance, freq = EXCLUDED.freq,
+		                                                created_at = EXCLUDED.created_at`,
+		p.Id, p.ExternalId, p.UserId, p.Balance.String(), p.Currency, p.Status, p.Seats, p.Freq, p.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	c := b.Chargeback
+	_, err = tx.Exec(`
+		UPDATE subscription SET status = $2, renew_at = NULL, grace_until = NULL, updated_at = $3
+		WHERE user_id = $1`, c.UserId, SubscriptionCanceled, c.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	for _, cb := range b.Clawbacks {
+		balance := new(big.Int).Neg(cb.Balance).String()
+		if cb.UserContributorId == nil {
+			_, err = tx.Exec(`
+				INSERT INTO future_contribution(id, user_sponsor_id, repo_id, balance, currency, day, created_at,
+				                                foundation_payment, generation)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, FALSE, day_generation($6))
+				ON CONFLICT (user_sponsor_id, repo_id, currency, day, generation)
+				DO UPDATE SET balance = future_contribution.balance + EXCLUDED.balance, created_at = EXCLUDED.created_at`,
+				uuid.New(), c.UserId, cb.RepoId, balance, c.Currency, *b.Day, c.CreatedAt)
+		} else {
+			_, err = tx.Exec(`
+				INSERT INTO daily_contribution(id, user_sponsor_id, user_contributor_id, repo_id, balance, currency,
+				                               day, created_at, foundation_payment, generation)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, FALSE, day_generation($7))
+				ON CONFLICT (user_sponsor_id, user_contributor_id, repo_id, currency, day, generation)
+				DO UPDATE SET balance = daily_contribution.balance + EXCLUDED.balance, created_at = EXCLUDED.created_at`,
+				uuid.New(), c.UserId, *cb.UserContributorId, cb.RepoId, balance, c.Currency, *b.Day, c.CreatedAt)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO chargeback(id, external_id, user_id, kind, balance, clawed_back, unrecovered, currency, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		c.Id, c.ExternalId, c.UserId, c.Kind, c.Balance.String(), c.ClawedBack.String(), c.Unrecovered.String(),
+		c.Currency, c.CreatedAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (db *DB) FindChargebacks(from time.Time) ([]Chargeback, error) {
+	rows, err := db.Query(`
+		SELECT id, external_id, user_id, kind, balance, clawed_back, unrecovered, currency, created_at
+		FROM chargeback
+		WHERE created_at >= $1
+		ORDER BY created_at DESC`, from)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	cs := []Chargeback{}
+	for rows.Next() {
+		var c Chargeback
+		var b, cb, u string
+		err = rows.Scan(&c.Id, &c.ExternalId, &c.UserId, &c.Kind, &b, &cb, &u, &c.Currency, &c.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range []struct {
+			s string
+			b **big.Int
+		}{{b, &c.Balance}, {cb, &c.ClawedBack}, {u, &c.Unrecovered}} {
+			b1, ok := new(big.Int).SetString(v.s, 10)
+			if !ok {
+				return nil, fmt.Errorf("not a big.int %v", v.s)
+			}
+			*v.b = b1
+		}
+		cs = append(cs, c)
+	}
+	return cs, nil
+}
+
+// FindLatestBookedDay returns the last day the daily runner booked, clawbacks are booked on this day so
+// the runner does not take a day it has yet to book for booked already
+func (db *DB) FindLatestBookedDay() (*time.Time, error) {
+	var day sql.NullTime
+	err := db.QueryRow(`SELECT MAX(day) FROM distribution_day WHERE status = $1`, DistributionBooked).Scan(&day)
+	if err != nil || !day.Valid {
+		return nil, err
+	}
+	return &day.Time, nil
+}
+
+// FindClawbackSources returns what the sponsor parked per repo, and what contributors did not claim yet
+// per repo, each with the largest amount first
+func (db *DB) FindClawbackSources(userSponsorId uuid.UUID, currency string) ([]ClawbackSource, []ClawbackSource, error) {
+	parked, err := db.findClawbackSources(`
+		SELECT NULL::UUID, repo_id, SUM(balance) AS b
+		FROM future_contribution
+		WHERE user_sponsor_id = $1 AND currency = $2 AND foundation_payment = FALSE
+		GROUP BY repo_id
+		HAVING SUM(balance) > 0
+		ORDER BY b DESC, repo_id`, userSponsorId, currency)
+	if err != nil {
+		return nil, nil, err
+	}
+	unclaimed, err := db.findClawbackSources(`
+		SELECT user_contributor_id, repo_id, SUM(balance) AS b
+		FROM daily_contribution
+		WHERE user_sponsor_id = $1 AND currency = $2 AND claimed_at IS NULL
+		  AND COALESCE(foundation_payment, FALSE) = FALSE
+		GROUP BY user_contributor_id, repo_id
+		HAVING SUM(balance) > 0
+		ORDER BY b DESC, user_contributor_id, repo_id`, userSponsorId, currency)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parked, unclaimed, nil
+}
+
+func (db *DB) findClawbackSources(query string, userSponsorId uuid.UUID, currency string) ([]ClawbackSource, error) {
+	rows, err := db.Query(query, userSponsorId, currency)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	var cs []ClawbackSource
+	for rows.Next() {
+		var c ClawbackSource
+		var b string
+		err = rows.Scan(&c.UserContributorId, &c.RepoId, &b)
+		if err != nil {
+			return nil, err
+		}
+		b1, ok := new(big.Int).SetString(b, 10)
+		if !ok {
+			return nil, fmt.Errorf("not a big.int %v", b)
+		}
+		c.Balance = b1
+		cs = append(cs, c)
+	}
+	return cs, nil
+}
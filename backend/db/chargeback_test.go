@@ -0,0 +1,120 @@
+package db
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChargebackInsertAndFind(t *testing.T) {
+	TruncateAll(db, t)
+
+	u := createTestUser(t, db, "sponsor@example.com")
+	now := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+
+	c := Chargeback{
+		Id:          uuid.New(),
+		ExternalId:  uuid.New(),
+		UserId:      u.Id,
+		Kind:        ChargebackDispute,
+		Balance:     big.NewInt(-100),
+		ClawedBack:  big.NewInt(60),
+		Unrecovered: big.NewInt(40),
+		Currency:    "USD",
+		CreatedAt:   now,
+	}
+	require.NoError(t, db.InsertChargeback(c))
+
+	cs, err := db.FindChargebacks(now.AddDate(0, 0, -1))
+	require.NoError(t, err)
+	require.Len(t, cs, 1)
+	assert.Equal(t, c.ExternalId, cs[0].ExternalId)
+	assert.Equal(t, "-100", cs[0].Balance.String())
+	assert.Equal(t, "60", cs[0].ClawedBack.String())
+	assert.Equal(t, "40", cs[0].Unrecovered.String())
+
+	cs, err = db.FindChargebacks(now.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	assert.Len(t, cs, 0)
+}
+
+func TestFindClawbackSources(t *testing.T) {
+	TruncateAll(db, t)
+
+	sponsor := createTestUser(t, db, "sponsor@example.com")
+	contributor := createTestUser(t, db, "contributor@example.com")
+	r1 := createTestRepo(t, db, "https://github.com/flatfeestack/r1")
+	r2 := createTestRepo(t, db, "https://github.com/flatfeestack/r2")
+	day := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	now := day.AddDate(0, 0, 1)
+
+	d, err := db.FindLatestBookedDay()
+	require.NoError(t, err)
+	assert.Nil(t, d)
+	require.NoError(t, db.MarkDistributionDayBooked(day, now))
+	d, err = db.FindLatestBookedDay()
+	require.NoError(t, err)
+	assert.True(t, day.Equal(*d))
+
+	require.NoError(t, db.InsertOrUpdateFutureContribution(sponsor.Id, r1.Id, big.NewInt(300), "USD", day, now, false))
+	require.NoError(t, db.InsertContribution(sponsor.Id, contributor.Id, r2.Id, big.NewInt(200), "USD", day, now, false))
+	require.NoError(t, db.InsertContribution(sponsor.Id, contributor.Id, r1.Id, big.NewInt(500), "USD", day, now, false))
+	//claimed contributions are not clawed back
+	_, err = db.Exec(`UPDATE daily_contribution SET claimed_at = $1 WHERE repo_id = $2`, now, r1.Id)
+	require.NoError(t, err)
+
+	parked, unclaimed, err := db.FindClawbackSources(sponsor.Id, "USD")
+	require.NoError(t, err)
+	require.Len(t, parked, 1)
+	assert.Nil(t, parked[0].UserContributorId)
+	assert.Equal(t, r1.Id, parked[0].RepoId)
+	assert.Equal(t, "300", parked[0].Balance.String())
+	require.Len(t, unclaimed, 1)
+	assert.Equal(t, contributor.Id, *unclaimed[0].UserContributorId)
+	assert.Equal(t, r2.Id, unclaimed[0].RepoId)
+	assert.Equal(t, "200", unclaimed[0].Balance.String())
+
+	//a clawback that takes all of it leaves nothing to claw back, it is added to the rows of the booked day
+	externalId := uuid.New()
+	c := Chargeback{Id: uuid.New(), ExternalId: externalId, UserId: sponsor.Id, Kind: ChargebackRefund,
+		Balance: big.NewInt(-500), ClawedBack: big.NewInt(500), Unrecovered: big.NewInt(0), Currency: "USD", CreatedAt: now}
+	require.NoError(t, db.BookChargeback(ChargebackBooking{
+		PayIn: PayInEvent{Id: uuid.New(), ExternalId: externalId, UserId: sponsor.Id, Balance: big.NewInt(-500),
+			Currency: "USD", Status: PayInRefund, Seats: 1, Freq: 365, CreatedAt: now},
+		Clawbacks:  append(parked, unclaimed...),
+		Day:        &day,
+		Chargeback: c,
+	}))
+	parked, unclaimed, err = db.FindClawbackSources(sponsor.Id, "USD")
+	require.NoError(t, err)
+	assert.Len(t, parked, 0)
+	assert.Len(t, unclaimed, 0)
+
+	m, err := db.FindSumDailySponsors(sponsor.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "500", m["USD"].String())
+	var nr int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM daily_contribution`).Scan(&nr))
+	assert.Equal(t, 2, nr)
+	//the rollup of the contributor follows the clawback, which updated the row of r2
+	cms, err := db.FindContributionMonths(contributor.Id, true)
+	require.NoError(t, err)
+	sum := new(big.Int)
+	for _, cm := range cms {
+		sum.Add(sum, cm.Balance)
+	}
+	assert.Equal(t, "500", sum.String())
+
+	p, err := db.FindPayInExternal(externalId, PayInRefund)
+	require.NoError(t, err)
+	require.NotNil(t, p)
+	assert.Equal(t, "-500", p.Balance.String())
+	cs, err := db.FindChargebacks(day)
+	require.NoError(t, err)
+	require.Len(t, cs, 1)
+	assert.Equal(t, "500", cs[0].ClawedBack.String())
+}
@@ -0,0 +1,200 @@
+package db
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ContributionMonth is the sum of the contributions of one month, from the view of the sponsor or of the
+// contributor
+type ContributionMonth struct {
+	RepoId   uuid.UUID `json:"repoId"`
+	RepoName string    `json:"repoName"`
+	RepoUrl  string    `json:"repoUrl"`
+	Balance  *big.Int  `json:"balance"`
+	Currency string    `json:"currency"`
+	Month    time.Time `json:"month"`
+	Days     int       `json:"days"`
+}
+
+type ContributionArchive struct {
+	Month      time.Time `json:"month"`
+	Nr         int       `json:"nr"`
+	ArchivedAt time.Time `json:"archivedAt"`
+}
+
+// FindContributionMonths returns the monthly sums from the rollups. They contain the archived months,
+// which are not in FindContributions anymore. Days counts the distinct days, not the rows of reversals,
+// rebookings and clawbacks.
+func (db *DB) FindContributionMonths(userId uuid.UUID, myContribution bool) ([]ContributionMonth, error) {
+	s := `SELECT r.id, r.name, r.url, SUM(m.balance), m.currency, m.month, SUM(m.days)
+          FROM contribution_month_sponsor m
+              INNER JOIN repo r ON m.repo_id = r.id
+          WHERE m.user_sponsor_id = $1 AND m.foundation_payment = FALSE
+          GROUP BY r.id, r.name, r.url, m.currency, m.month
+          ORDER BY m.month, r.name, m.currency`
+
+	if myContribution {
+		s = `SELECT r.id, r.name, r.url, m.balance, m.currency, m.month, m.days
+             FROM contribution_month_contributor m
+                 INNER JOIN repo r ON m.repo_id = r.id
+             WHERE m.user_contributor_id = $1
+             ORDER BY m.month, r.name, m.currency`
+	}
+
+	rows, err := db.Query(s, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	cms := []ContributionMonth{}
+	for rows.Next() {
+		var cm ContributionMonth
+		var b string
+		var name, url *string
+		err = rows.Scan(&cm.RepoId, &name, &url, &b, &cm.Currency, &cm.Month, &cm.Days)
+		if err != nil {
+			return nil, err
+		}
+		if name != nil {
+			cm.RepoName = *name
+		}
+		if url != nil {
+			cm.RepoUrl = *url
+		}
+		b1, ok := new(big.Int).SetString(b, 10)
+		if !ok {
+			return nil, fmt.Errorf("not a big.int %v", b)
+		}
+		cm.Balance = b1
+		cms = append(cms, cm)
+	}
+	return cms, nil
+}
+
+// FindArchivableMonths returns the months before the given month that still have rows in daily_contribution
+func (db *DB) FindArchivableMonths(before time.Time) ([]time.Time, error) {
+	rows, err := db.Query(`
+		SELECT DISTINCT date_trunc('month', day)::date AS month
+		FROM daily_contribution
+		WHERE day < date_trunc('month', $1::date)
+		ORDER BY month`, before)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	var months []time.Time
+	for rows.Next() {
+		var m time.Time
+		err = rows.Scan(&m)
+		if err != nil {
+			return nil, err
+		}
+		months = append(months, m)
+	}
+	return months, nil
+}
+
+// ArchiveContributionMonth moves the rows of the month from daily_contribution to its partition of
+// daily_contribution_archive. Before anything is moved, the rows of the month, the live and the already
+// archived ones, must add up to the monthly rollup of every contributor, so the summaries do not change.
+func (db *DB) ArchiveContributionMonth(month time.Time, now time.Time) (int64, error) {
+	month = time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	next := month.AddDate(0, 1, 0)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	//the name is built from the date only, so it is safe to format it into the statement
+	_, err = tx.Exec(fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS daily_contribution_archive_%s PARTITION OF daily_contribution_archive
+		FOR VALUES FROM ('%s') TO ('%s')`,
+		month.Format("200601"), month.Format(time.DateOnly), next.Format(time.DateOnly)))
+	if err != nil {
+		return 0, err
+	}
+
+	var mismatches int
+	err = tx.QueryRow(`
+		SELECT COUNT(*)
+		FROM (
+		    SELECT user_contributor_id, repo_id, currency, SUM(balance) AS balance
+		    FROM (
+		        SELECT user_contributor_id, repo_id, currency, balance
+		        FROM daily_contribution WHERE day >= $1 AND day < $2
+		        UNION ALL
+		        SELECT user_contributor_id, repo_id, currency, balance
+		        FROM daily_contribution_archive WHERE day >= $1 AND day < $2
+		    ) AS x
+		    GROUP BY user_contributor_id, repo_id, currency
+		) AS s
+		FULL JOIN (
+		    SELECT user_contributor_id, repo_id, currency, balance
+		    FROM contribution_month_contributor WHERE month = $1
+		) AS r USING (user_contributor_id, repo_id, currency)
+		WHERE s.balance IS DISTINCT FROM r.balance`, month, next).Scan(&mismatches)
+	if err != nil {
+		return 0, err
+	}
+	if mismatches > 0 {
+		return 0, fmt.Errorf("rollup of %v does not match %v contributors, not archiving", month.Format("2006-01"), mismatches)
+	}
+
+	res, err := tx.Exec(`
+		WITH moved AS (
+		    DELETE FROM daily_contribution WHERE day >= $1 AND day < $2
+		    RETURNING id, user_sponsor_id, user_contributor_id, repo_id, balance, currency, day, created_at,
+		              claimed_at, foundation_payment, generation
+		)
+		INSERT INTO daily_contribution_archive(id, user_sponsor_id, user_contributor_id, repo_id, balance, currency,
+		                                       day, created_at, claimed_at, foundation_payment, generation, archived_at)
+		SELECT id, user_sponsor_id, user_contributor_id, repo_id, balance, currency,
+		       day, created_at, claimed_at, foundation_payment, generation, $3
+		FROM moved`, month, next, now)
+	if err != nil {
+		return 0, err
+	}
+	nr, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO contribution_archive(month, nr, archived_at) VALUES ($1, $2, $3)
+		ON CONFLICT (month) DO UPDATE SET nr = contribution_archive.nr + EXCLUDED.nr, archived_at = EXCLUDED.archived_at`,
+		month, nr, now)
+	if err != nil {
+		return 0, err
+	}
+	return nr, tx.Commit()
+}
+
+func (db *DB) FindContributionArchives() ([]ContributionArchive, error) {
+	rows, err := db.Query(`
+		SELECT month, nr, archived_at
+		FROM contribution_archive
+		ORDER BY month`)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	as := []ContributionArchive{}
+	for rows.Next() {
+		var a ContributionArchive
+		err = rows.Scan(&a.Month, &a.Nr, &a.ArchivedAt)
+		if err != nil {
+			return nil, err
+		}
+		as = append(as, a)
+	}
+	return as, nil
+}
@@ -0,0 +1,157 @@
+package db
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContributionRollup(t *testing.T) {
+	TruncateAll(db, t)
+
+	sponsor := createTestUser(t, db, "sponsor@example.com")
+	contributor := createTestUser(t, db, "contributor@example.com")
+	repo := createTestRepo(t, db, "https://github.com/test/repo")
+
+	day1 := time.Date(2026, 8, 30, 0, 0, 0, 0, time.UTC)
+	day2 := time.Date(2026, 8, 31, 0, 0, 0, 0, time.UTC)
+	day3 := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, db.InsertContribution(sponsor.Id, contributor.Id, repo.Id, big.NewInt(100), "USD", day1, time.Now(), false))
+	require.NoError(t, db.InsertContribution(sponsor.Id, contributor.Id, repo.Id, big.NewInt(200), "USD", day2, time.Now(), false))
+	require.NoError(t, db.InsertContributionBatch(&ContributionBatch{Contributions: []BatchContribution{
+		{UserSponsorId: sponsor.Id, UserContributorId: contributor.Id, RepoId: repo.Id, Balance: big.NewInt(400), Currency: "USD", Day: day3, CreatedAt: time.Now()},
+	}}))
+
+	cms, err := db.FindContributionMonths(contributor.Id, true)
+	require.NoError(t, err)
+	require.Len(t, cms, 2)
+	assert.Equal(t, big.NewInt(300), cms[0].Balance)
+	assert.Equal(t, 2, cms[0].Days)
+	assert.Equal(t, time.August, cms[0].Month.Month())
+	assert.Equal(t, big.NewInt(400), cms[1].Balance)
+
+	cms, err = db.FindContributionMonths(sponsor.Id, false)
+	require.NoError(t, err)
+	require.Len(t, cms, 2)
+
+	m, err := db.FindSumDailyContributors(contributor.Id)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(700), m["USD"])
+	m, err = db.FindSumDailySponsors(sponsor.Id)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(700), m["USD"])
+}
+
+func TestContributionRollupDays(t *testing.T) {
+	TruncateAll(db, t)
+
+	sponsor1 := createTestUser(t, db, "sponsor1@example.com")
+	sponsor2 := createTestUser(t, db, "sponsor2@example.com")
+	contributor := createTestUser(t, db, "contributor@example.com")
+	repo := createTestRepo(t, db, "https://github.com/test/repo")
+	day := time.Date(2026, 8, 30, 0, 0, 0, 0, time.UTC)
+
+	book := func(b int64) {
+		_, err := db.StartDistributionDay(day, time.Now())
+		require.NoError(t, err)
+		//two rows of the same day in one statement
+		require.NoError(t, db.InsertContributionBatch(&ContributionBatch{Contributions: []BatchContribution{
+			{UserSponsorId: sponsor1.Id, UserContributorId: contributor.Id, RepoId: repo.Id, Balance: big.NewInt(b), Currency: "USD", Day: day, CreatedAt: time.Now()},
+			{UserSponsorId: sponsor2.Id, UserContributorId: contributor.Id, RepoId: repo.Id, Balance: big.NewInt(b), Currency: "USD", Day: day, CreatedAt: time.Now()},
+		}}))
+		require.NoError(t, db.FinishDistributionDay(day, time.Now()))
+	}
+	book(100)
+	cms, err := db.FindContributionMonths(contributor.Id, true)
+	require.NoError(t, err)
+	require.Len(t, cms, 1)
+	assert.Equal(t, 1, cms[0].Days)
+
+	//the reversal and the rebooking add rows, but no day
+	_, err = db.ReverseDistributionDay(day, time.Now())
+	require.NoError(t, err)
+	book(150)
+	cms, err = db.FindContributionMonths(contributor.Id, true)
+	require.NoError(t, err)
+	require.Len(t, cms, 1)
+	assert.Equal(t, 1, cms[0].Days)
+	assert.Equal(t, big.NewInt(300), cms[0].Balance)
+
+	cms, err = db.FindContributionMonths(sponsor1.Id, false)
+	require.NoError(t, err)
+	require.Len(t, cms, 1)
+	assert.Equal(t, 1, cms[0].Days)
+	assert.Equal(t, big.NewInt(150), cms[0].Balance)
+}
+
+func TestArchiveContributionMonth(t *testing.T) {
+	TruncateAll(db, t)
+
+	sponsor := createTestUser(t, db, "sponsor@example.com")
+	contributor := createTestUser(t, db, "contributor@example.com")
+	repo := createTestRepo(t, db, "https://github.com/test/repo")
+
+	day1 := time.Date(2026, 8, 30, 0, 0, 0, 0, time.UTC)
+	day2 := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	_, err := db.StartDistributionDay(day1, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, db.InsertContribution(sponsor.Id, contributor.Id, repo.Id, big.NewInt(100), "USD", day1, time.Now(), false))
+	require.NoError(t, db.FinishDistributionDay(day1, time.Now()))
+	require.NoError(t, db.InsertContribution(sponsor.Id, contributor.Id, repo.Id, big.NewInt(200), "USD", day2, time.Now(), false))
+
+	months, err := db.FindArchivableMonths(time.Date(2026, 9, 15, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Len(t, months, 1)
+	assert.Equal(t, time.August, months[0].Month())
+
+	nr, err := db.ArchiveContributionMonth(months[0], time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), nr)
+
+	//the per-day rows of august are gone, the sums are the same
+	cs, err := db.FindContributions(contributor.Id, true)
+	require.NoError(t, err)
+	require.Len(t, cs, 1)
+	m, err := db.FindSumDailyContributors(contributor.Id)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(300), m["USD"])
+
+	var archived int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM daily_contribution_archive WHERE day = $1`, day1).Scan(&archived))
+	assert.Equal(t, 1, archived)
+
+	as, err := db.FindContributionArchives()
+	require.NoError(t, err)
+	require.Len(t, as, 1)
+	assert.Equal(t, 1, as[0].Nr)
+
+	_, err = db.ReverseDistributionDay(day1, time.Now())
+	assert.Error(t, err)
+
+	months, err = db.FindArchivableMonths(time.Date(2026, 9, 15, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Len(t, months, 0)
+}
+
+func TestArchiveContributionMonthMismatch(t *testing.T) {
+	TruncateAll(db, t)
+
+	sponsor := createTestUser(t, db, "sponsor@example.com")
+	contributor := createTestUser(t, db, "contributor@example.com")
+	repo := createTestRepo(t, db, "https://github.com/test/repo")
+
+	day := time.Date(2026, 8, 30, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, db.InsertContribution(sponsor.Id, contributor.Id, repo.Id, big.NewInt(100), "USD", day, time.Now(), false))
+	_, err := db.Exec(`UPDATE contribution_month_contributor SET balance = 99`)
+	require.NoError(t, err)
+
+	_, err = db.ArchiveContributionMonth(day, time.Now())
+	assert.Error(t, err)
+
+	cs, err := db.FindContributions(contributor.Id, true)
+	require.NoError(t, err)
+	assert.Len(t, cs, 1)
+}
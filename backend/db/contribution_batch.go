@@ -0,0 +1,172 @@
+package db
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ContributionBatch collects the rows the daily runner books for one sponsor, so they can be inserted
+// with one statement per table instead of one statement per row
+type ContributionBatch struct {
+	Contributions       []BatchContribution
+	FutureContributions []BatchFutureContribution
+	Unclaimed           []BatchUnclaimed
+	DependencyFlows     []DependencyFlow
+}
+
+type BatchContribution struct {
+	UserSponsorId     uuid.UUID
+	UserContributorId uuid.UUID
+	RepoId            uuid.UUID
+	Balance           *big.Int
+	Currency          string
+	Day               time.Time
+	CreatedAt         time.Time
+	FoundationPayment bool
+}
+
+type BatchFutureContribution struct {
+	UserSponsorId     uuid.UUID
+	RepoId            uuid.UUID
+	Balance           *big.Int
+	Currency          string
+	Day               time.Time
+	CreatedAt         time.Time
+	FoundationPayment bool
+}
+
+type BatchUnclaimed struct {
+	UserSponsorId uuid.UUID
+	Email         string
+	RepoId        uuid.UUID
+	Balance       *big.Int
+	Currency      string
+	Day           time.Time
+	CreatedAt     time.Time
+}
+
+func (b *ContributionBatch) Len() int {
+	return len(b.Contributions) + len(b.FutureContributions) + len(b.Unclaimed) + len(b.DependencyFlows)
+}
+
+// InsertContributionBatch inserts the whole batch in one transaction. Unclaimed rows that exist
+// already are skipped, they are shares of what is parked, not money on their own. The
+// contributions are inserted in a fixed order, so workers update the monthly rollups of the
+// contributors in the same order and do not deadlock.
+func (db *DB) InsertContributionBatch(b *ContributionBatch) error {
+	if b.Len() == 0 {
+		return nil
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if len(b.Contributions) > 0 {
+		n := len(b.Contributions)
+		sponsorIds, contributorIds, repoIds := make([]uuid.UUID, n), make([]uuid.UUID, n), make([]uuid.UUID, n)
+		balances, currencies := make([]string, n), make([]string, n)
+		days, createdAts, foundationPayments := make([]string, n), make([]string, n), make([]bool, n)
+		for i, c := range b.Contributions {
+			sponsorIds[i], contributorIds[i], repoIds[i] = c.UserSponsorId, c.UserContributorId, c.RepoId
+			balances[i], currencies[i] = c.Balance.String(), c.Currency
+			days[i], createdAts[i], foundationPayments[i] = batchDay(c.Day), batchTime(c.CreatedAt), c.FoundationPayment
+		}
+		_, err = tx.Exec(`
+			INSERT INTO daily_contribution(id, user_sponsor_id, user_contributor_id, repo_id, balance, currency,
+			                               day, created_at, foundation_payment, generation)
+			SELECT gen_random_uuid(), t.s, t.c, t.r, t.b, t.cur, t.d, t.ca, t.f, day_generation(t.d)
+			FROM unnest($1::uuid[], $2::uuid[], $3::uuid[], $4::numeric[], $5::varchar[], $6::date[],
+			            $7::timestamptz[], $8::boolean[]) AS t(s, c, r, b, cur, d, ca, f)
+			ORDER BY t.c, t.r, t.cur`,
+			pq.Array(sponsorIds), pq.Array(contributorIds), pq.Array(repoIds), pq.Array(balances),
+			pq.Array(currencies), pq.Array(days), pq.Array(createdAts), pq.Array(foundationPayments))
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(b.FutureContributions) > 0 {
+		n := len(b.FutureContributions)
+		sponsorIds, repoIds := make([]uuid.UUID, n), make([]uuid.UUID, n)
+		balances, currencies := make([]string, n), make([]string, n)
+		days, createdAts, foundationPayments := make([]string, n), make([]string, n), make([]bool, n)
+		for i, f := range b.FutureContributions {
+			sponsorIds[i], repoIds[i] = f.UserSponsorId, f.RepoId
+			balances[i], currencies[i] = f.Balance.String(), f.Currency
+			days[i], createdAts[i], foundationPayments[i] = batchDay(f.Day), batchTime(f.CreatedAt), f.FoundationPayment
+		}
+		_, err = tx.Exec(`
+			INSERT INTO future_contribution(id, user_sponsor_id, repo_id, balance, currency, day, created_at,
+			                                foundation_payment, generation)
+			SELECT gen_random_uuid(), t.s, t.r, t.b, t.cur, t.d, t.ca, t.f, day_generation(t.d)
+			FROM unnest($1::uuid[], $2::uuid[], $3::numeric[], $4::varchar[], $5::date[], $6::timestamptz[],
+			            $7::boolean[]) AS t(s, r, b, cur, d, ca, f)`,
+			pq.Array(sponsorIds), pq.Array(repoIds), pq.Array(balances), pq.Array(currencies),
+			pq.Array(days), pq.Array(createdAts), pq.Array(foundationPayments))
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(b.Unclaimed) > 0 {
+		n := len(b.Unclaimed)
+		sponsorIds, emails, repoIds := make([]uuid.UUID, n), make([]string, n), make([]uuid.UUID, n)
+		balances, currencies := make([]string, n), make([]string, n)
+		days, createdAts := make([]string, n), make([]string, n)
+		for i, u := range b.Unclaimed {
+			sponsorIds[i], emails[i], repoIds[i] = u.UserSponsorId, u.Email, u.RepoId
+			balances[i], currencies[i] = u.Balance.String(), u.Currency
+			days[i], createdAts[i] = batchDay(u.Day), batchTime(u.CreatedAt)
+		}
+		_, err = tx.Exec(`
+			INSERT INTO unclaimed(id, user_sponsor_id, email, repo_id, balance, currency, day, created_at, generation)
+			SELECT gen_random_uuid(), t.s, t.e, t.r, t.b, t.cur, t.d, t.ca, day_generation(t.d)
+			FROM unnest($1::uuid[], $2::varchar[], $3::uuid[], $4::numeric[], $5::varchar[], $6::date[],
+			            $7::timestamptz[]) AS t(s, e, r, b, cur, d, ca)
+			ON CONFLICT DO NOTHING`,
+			pq.Array(sponsorIds), pq.Array(emails), pq.Array(repoIds), pq.Array(balances), pq.Array(currencies),
+			pq.Array(days), pq.Array(createdAts))
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(b.DependencyFlows) > 0 {
+		n := len(b.DependencyFlows)
+		sponsorIds, rootRepoIds, repoIds, depRepoIds := make([]uuid.UUID, n), make([]uuid.UUID, n), make([]uuid.UUID, n), make([]uuid.UUID, n)
+		depths, balances, currencies := make([]int64, n), make([]string, n), make([]string, n)
+		days, createdAts := make([]string, n), make([]string, n)
+		for i, f := range b.DependencyFlows {
+			sponsorIds[i], rootRepoIds[i], repoIds[i], depRepoIds[i] = f.UserSponsorId, f.RootRepoId, f.RepoId, f.DepRepoId
+			depths[i], balances[i], currencies[i] = int64(f.Depth), f.Balance.String(), f.Currency
+			days[i], createdAts[i] = batchDay(f.Day), batchTime(f.CreatedAt)
+		}
+		_, err = tx.Exec(`
+			INSERT INTO dependency_flow(id, user_sponsor_id, root_repo_id, repo_id, dep_repo_id, depth, balance,
+			                            currency, day, created_at, generation)
+			SELECT gen_random_uuid(), t.s, t.rr, t.r, t.dr, t.dp, t.b, t.cur, t.d, t.ca, day_generation(t.d)
+			FROM unnest($1::uuid[], $2::uuid[], $3::uuid[], $4::uuid[], $5::integer[], $6::numeric[],
+			            $7::varchar[], $8::date[], $9::timestamptz[]) AS t(s, rr, r, dr, dp, b, cur, d, ca)`,
+			pq.Array(sponsorIds), pq.Array(rootRepoIds), pq.Array(repoIds), pq.Array(depRepoIds),
+			pq.Array(depths), pq.Array(balances), pq.Array(currencies), pq.Array(days), pq.Array(createdAts))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// the arrays are passed as text, so the day and the time are formatted the way postgres parses them
+func batchDay(t time.Time) string {
+	return t.Format(time.DateOnly)
+}
+
+func batchTime(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
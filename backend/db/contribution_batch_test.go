@@ -0,0 +1,200 @@
+package db
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindContributorWeights(t *testing.T) {
+	TruncateAll(db, t)
+
+	user := createTestUser(t, db, "user@example.com")
+	require.NoError(t, db.InsertGitEmail(uuid.New(), user.Id, "dev@example.com", nil, time.Now()))
+	repo1 := createTestRepo(t, db, "https://github.com/test/repo1")
+	repo2 := createTestRepo(t, db, "https://github.com/test/repo2")
+	repo3 := createTestRepo(t, db, "https://github.com/test/repo3")
+
+	old := AnalysisRequest{Id: uuid.New(), RepoId: repo1.Id, DateFrom: time.Now().AddDate(0, 0, -60), DateTo: time.Now().AddDate(0, 0, -30)}
+	latest := AnalysisRequest{Id: uuid.New(), RepoId: repo1.Id, DateFrom: time.Now().AddDate(0, 0, -30), DateTo: time.Now()}
+	empty := AnalysisRequest{Id: uuid.New(), RepoId: repo2.Id, DateFrom: time.Now().AddDate(0, 0, -30), DateTo: time.Now()}
+	require.NoError(t, db.InsertAnalysisRequest(old, time.Now()))
+	require.NoError(t, db.InsertAnalysisRequest(latest, time.Now()))
+	require.NoError(t, db.InsertAnalysisRequest(empty, time.Now()))
+	require.NoError(t, db.InsertRepoMetric(old.Id, repo1.Id, "old@example.com", nil, 1, time.Now()))
+	require.NoError(t, db.InsertRepoMetric(latest.Id, repo1.Id, "dev@example.com", nil, 0.75, time.Now()))
+	require.NoError(t, db.InsertRepoMetric(latest.Id, repo1.Id, "other@example.com", nil, 0.25, time.Now()))
+
+	m, err := db.FindContributorWeights([]uuid.UUID{repo1.Id, repo2.Id, repo3.Id})
+	require.NoError(t, err)
+
+	require.Len(t, m[repo1.Id], 2)
+	for _, cw := range m[repo1.Id] {
+		if cw.GitEmail == "dev@example.com" {
+			require.NotNil(t, cw.UserId)
+			assert.Equal(t, user.Id, *cw.UserId)
+			assert.Equal(t, 0.75, cw.Weight)
+		} else {
+			assert.Equal(t, "other@example.com", cw.GitEmail)
+			assert.Nil(t, cw.UserId)
+		}
+	}
+	//analyzed without contributors is not the same as never analyzed
+	assert.NotNil(t, m[repo2.Id])
+	assert.Len(t, m[repo2.Id], 0)
+	_, ok := m[repo3.Id]
+	assert.False(t, ok)
+}
+
+func TestInsertContributionBatch(t *testing.T) {
+	TruncateAll(db, t)
+
+	sponsor := createTestUser(t, db, "sponsor@example.com")
+	contributor := createTestUser(t, db, "contributor@example.com")
+	repo := createTestRepo(t, db, "https://github.com/test/repo")
+	dep := createTestRepo(t, db, "https://github.com/test/dep")
+	day := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	b := &ContributionBatch{
+		Contributions: []BatchContribution{
+			{UserSponsorId: sponsor.Id, UserContributorId: contributor.Id, RepoId: repo.Id, Balance: big.NewInt(700), Currency: "USD", Day: day, CreatedAt: time.Now()},
+		},
+		FutureContributions: []BatchFutureContribution{
+			{UserSponsorId: sponsor.Id, RepoId: repo.Id, Balance: big.NewInt(-200), Currency: "USD", Day: day, CreatedAt: time.Now()},
+		},
+		Unclaimed: []BatchUnclaimed{
+			{UserSponsorId: sponsor.Id, Email: "unknown@example.com", RepoId: repo.Id, Balance: big.NewInt(300), Currency: "USD", Day: day, CreatedAt: time.Now()},
+		},
+		DependencyFlows: []DependencyFlow{
+			{UserSponsorId: sponsor.Id, RootRepoId: repo.Id, RepoId: repo.Id, DepRepoId: dep.Id, Depth: 1, Balance: big.NewInt(100), Currency: "USD", Day: day, CreatedAt: time.Now()},
+		},
+	}
+	require.NoError(t, db.InsertContributionBatch(b))
+	fs, err := db.FindDependencyFlowsBySponsor(sponsor.Id)
+	require.NoError(t, err)
+	require.Len(t, fs, 1)
+	assert.Equal(t, dep.Id, fs[0].DepRepoId)
+	assert.Equal(t, "100", fs[0].Balance.String())
+	b.DependencyFlows = nil
+
+	sums, err := db.FindDistributionSums(day)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(700), sums.Contributions["USD"])
+	assert.Equal(t, big.NewInt(-200), sums.FutureContributions["USD"])
+	assert.Equal(t, big.NewInt(300), sums.Unclaimed["USD"])
+
+	//an unclaimed share that is booked again is skipped, a duplicate contribution is not
+	b.Contributions = nil
+	b.FutureContributions = nil
+	require.NoError(t, db.InsertContributionBatch(b))
+	b.Contributions = []BatchContribution{
+		{UserSponsorId: sponsor.Id, UserContributorId: contributor.Id, RepoId: repo.Id, Balance: big.NewInt(700), Currency: "USD", Day: day, CreatedAt: time.Now()},
+	}
+	assert.Error(t, db.InsertContributionBatch(b))
+
+	//the same contributor in another currency on the same day is booked
+	b.Contributions[0].Balance = big.NewInt(500)
+	b.Contributions[0].Currency = "ETH"
+	require.NoError(t, db.InsertContributionBatch(b))
+
+	sums, err = db.FindDistributionSums(day)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(700), sums.Contributions["USD"])
+	assert.Equal(t, big.NewInt(500), sums.Contributions["ETH"])
+	assert.Equal(t, big.NewInt(300), sums.Unclaimed["USD"])
+}
+
+// setupBenchmarkRepos creates repos with an analysis of contributors, half of them connected to a user
+func setupBenchmarkRepos(b *testing.B, nrRepos int, nrContributors int) (*UserDetail, []uuid.UUID, []uuid.UUID) {
+	TruncateAll(db, b)
+	sponsor := createTestUser(b, db, "sponsor@example.com")
+	var userIds []uuid.UUID
+	for i := 0; i < nrContributors; i++ {
+		email := fmt.Sprintf("dev%d@example.com", i)
+		if i%2 == 0 {
+			u := createTestUser(b, db, email)
+			require.NoError(b, db.InsertGitEmail(uuid.New(), u.Id, email, nil, time.Now()))
+			userIds = append(userIds, u.Id)
+		}
+	}
+
+	var rids []uuid.UUID
+	for r := 0; r < nrRepos; r++ {
+		repo := createTestRepo(b, db, fmt.Sprintf("https://github.com/bench/repo%d", r))
+		a := AnalysisRequest{Id: uuid.New(), RepoId: repo.Id, DateFrom: time.Now().AddDate(0, 0, -30), DateTo: time.Now()}
+		require.NoError(b, db.InsertAnalysisRequest(a, time.Now()))
+		for i := 0; i < nrContributors; i++ {
+			require.NoError(b, db.InsertRepoMetric(a.Id, repo.Id, fmt.Sprintf("dev%d@example.com", i), nil, 1, time.Now()))
+		}
+		rids = append(rids, repo.Id)
+	}
+	return sponsor, userIds, rids
+}
+
+// BenchmarkContributorWeights compares resolving the weights of the repos with three queries per repo and
+// contributor, as the daily runner did for every sponsor, to one query for all repos
+func BenchmarkContributorWeights(b *testing.B) {
+	_, _, rids := setupBenchmarkRepos(b, 20, 10)
+
+	b.Run("PerRepo", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, rid := range rids {
+				a, err := db.FindLatestAnalysisRequest(rid)
+				require.NoError(b, err)
+				ars, err := db.FindAnalysisResults(a.Id)
+				require.NoError(b, err)
+				for _, ar := range ars {
+					_, err = db.FindUserByGitEmail(ar.GitEmail)
+					require.NoError(b, err)
+				}
+			}
+		}
+	})
+
+	b.Run("Bulk", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			m, err := db.FindContributorWeights(rids)
+			require.NoError(b, err)
+			require.Len(b, m, len(rids))
+		}
+	})
+}
+
+// BenchmarkInsertContributions compares inserting the contributions of a sponsor row by row to one batch
+func BenchmarkInsertContributions(b *testing.B) {
+	sponsor, userIds, rids := setupBenchmarkRepos(b, 20, 10)
+	//each run books another day, with its own sponsor so the runs do not collide
+	batchSponsor := createTestUser(b, db, "batch@example.com")
+	day := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	b.Run("Single", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			d := day.AddDate(0, 0, i)
+			for _, rid := range rids {
+				for _, uid := range userIds {
+					require.NoError(b, db.InsertContribution(sponsor.Id, uid, rid, big.NewInt(100), "USD", d, time.Now(), false))
+				}
+			}
+		}
+	})
+
+	b.Run("Batch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			d := day.AddDate(0, 0, i)
+			batch := &ContributionBatch{}
+			for _, rid := range rids {
+				for _, uid := range userIds {
+					batch.Contributions = append(batch.Contributions, BatchContribution{
+						UserSponsorId: batchSponsor.Id, UserContributorId: uid, RepoId: rid, Balance: big.NewInt(100), Currency: "USD", Day: d, CreatedAt: time.Now(),
+					})
+				}
+			}
+			require.NoError(b, db.InsertContributionBatch(batch))
+		}
+	})
+}
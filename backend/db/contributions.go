@@ -30,6 +30,7 @@ type Contribution struct {
 	Day               time.Time    `json:"day"`
 	ClaimedAt         JsonNullTime `json:"claimedAt,omitempty"`
 	FoundationPayment bool         `json:"foundationPayment"`
+	Forwarded         bool         `json:"forwarded,omitempty"`
 }
 
 type ContributionDetail struct {
@@ -47,8 +48,8 @@ type UserDonationRepo struct {
 func (db *DB) InsertContribution(userSponsorId uuid.UUID, userContributorId uuid.UUID, repoId uuid.UUID, balance *big.Int, currency string, day time.Time, createdAt time.Time, foundationPayment bool) error {
 	_, err := db.Exec(
 		`INSERT INTO daily_contribution(id, user_sponsor_id, user_contributor_id, repo_id, 
-		                                balance, currency, day, created_at, foundation_payment) 
-		 VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		                                balance, currency, day, created_at, foundation_payment, generation) 
+		 VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, day_generation($7))`,
 		uuid.New(), userSponsorId, userContributorId, repoId, balance.String(), currency, day, createdAt, foundationPayment)
 	return err
 }
@@ -105,8 +106,8 @@ func (db *DB) FindContributions(contributorUserId uuid.UUID, myContribution bool
 func (db *DB) InsertFutureContribution(uid uuid.UUID, repoId uuid.UUID, balance *big.Int,
 	currency string, day time.Time, createdAt time.Time, foundationPayment bool) error {
 	_, err := db.Exec(
-		`INSERT INTO future_contribution(id, user_sponsor_id, repo_id, balance, currency, day, created_at, foundation_payment) 
-		 VALUES($1, $2, $3, $4, $5, $6, $7, $8)`,
+		`INSERT INTO future_contribution(id, user_sponsor_id, repo_id, balance, currency, day, created_at, foundation_payment, generation) 
+		 VALUES($1, $2, $3, $4, $5, $6, $7, $8, day_generation($6))`,
 		uuid.New(), uid, repoId, balance.String(), currency, day, createdAt, foundationPayment)
 	return err
 }
@@ -115,9 +116,9 @@ func (db *DB) InsertOrUpdateFutureContribution(uid uuid.UUID, repoId uuid.UUID,
 	currency string, day time.Time, createdAt time.Time, foundationPayment bool) error {
 	_, err := db.Exec(
 		`INSERT INTO future_contribution(
-		     id, user_sponsor_id, repo_id, balance, currency, day, created_at, foundation_payment
-		 ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		 ON CONFLICT (user_sponsor_id, repo_id, currency, day) 
+		     id, user_sponsor_id, repo_id, balance, currency, day, created_at, foundation_payment, generation
+		 ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, day_generation($6))
+		 ON CONFLICT (user_sponsor_id, repo_id, currency, day, generation) 
 		 DO UPDATE SET 
 		     balance = future_contribution.balance + EXCLUDED.balance,
 		     created_at = EXCLUDED.created_at,
@@ -129,9 +130,9 @@ func (db *DB) InsertOrUpdateFutureContribution(uid uuid.UUID, repoId uuid.UUID,
 func (db *DB) FindSumDailyContributors(userContributorId uuid.UUID) (map[string]*big.Int, error) {
 	rows, err := db.Query(
 		`SELECT currency, COALESCE(sum(balance), 0)
-         FROM daily_contribution 
+         FROM contribution_month_contributor
          WHERE user_contributor_id = $1
-         GROUP BY currency`, 
+         GROUP BY currency`,
 		userContributorId)
 
 	if err != nil {
@@ -163,9 +164,9 @@ func (db *DB) FindSumDailyContributors(userContributorId uuid.UUID) (map[string]
 func (db *DB) FindSumDailySponsors(userSponsorId uuid.UUID) (map[string]*big.Int, error) {
 	rows, err := db.Query(
 		`SELECT currency, COALESCE(sum(balance), 0)
-         FROM daily_contribution 
+         FROM contribution_month_sponsor
          WHERE user_sponsor_id = $1 AND foundation_payment = FALSE
-         GROUP BY currency`, 
+         GROUP BY currency`,
 		userSponsorId)
 
 	if err != nil {
@@ -197,9 +198,9 @@ func (db *DB) FindSumDailySponsors(userSponsorId uuid.UUID) (map[string]*big.Int
 func (db *DB) FindSumDailySponsorsFromFoundation(userSponsorId uuid.UUID) (map[string]*big.Int, error) {
 	rows, err := db.Query(
 		`SELECT currency, COALESCE(sum(balance), 0)
-         FROM daily_contribution 
+         FROM contribution_month_sponsor
          WHERE user_sponsor_id = $1 AND foundation_payment = TRUE
-         GROUP BY currency`, 
+         GROUP BY currency`,
 		userSponsorId)
 
 	if err != nil {
@@ -232,7 +233,7 @@ func (db *DB) FindSumDailySponsorsFromFoundationByCurrency(userId uuid.UUID, cur
 	var balanceStr string
 	err := db.QueryRow(
 		`SELECT COALESCE(sum(balance), 0)
-         FROM daily_contribution 
+         FROM contribution_month_sponsor
          WHERE user_sponsor_id = $1 AND foundation_payment = TRUE AND currency = $2`,
 		userId, currency).Scan(&balanceStr)
 
@@ -255,8 +256,8 @@ func (db *DB) FindContributionsGroupedByCurrencyAndRepo(userSponsorId uuid.UUID)
 	rows, err := db.Query(`
         SELECT currency, repo_id, COALESCE(SUM(balance), 0), MIN(created_at) AS latest_created_at
         FROM (
-            SELECT currency, repo_id, balance, created_at
-            FROM daily_contribution
+            SELECT currency, repo_id, balance, first_created_at AS created_at
+            FROM contribution_month_sponsor
             WHERE user_sponsor_id = $1 AND foundation_payment = FALSE
 
             UNION ALL
@@ -380,8 +381,8 @@ func (db *DB) FindFoundationContributionsGroupedByCurrencyAndRepo(userSponsorId
 	rows, err := db.Query(`
         SELECT currency, repo_id, COALESCE(SUM(balance), 0), MIN(created_at) AS latest_created_at
         FROM (
-            SELECT currency, repo_id, balance, created_at
-            FROM daily_contribution
+            SELECT currency, repo_id, balance, first_created_at AS created_at
+            FROM contribution_month_sponsor
             WHERE user_sponsor_id = $1 AND foundation_payment = TRUE
 
             UNION ALL
@@ -470,9 +471,9 @@ func (db *DB) FindSumFutureBalanceByRepoId(repoId uuid.UUID) (map[string]*big.In
 func (db *DB) FindSumDailyBalanceByRepoId(repoId uuid.UUID) (map[string]*big.Int, error) {
 	rows, err := db.Query(
 		`SELECT currency, COALESCE(sum(balance), 0)
-         FROM daily_contribution 
+         FROM contribution_month_contributor
          WHERE repo_id = $1
-         GROUP BY currency`, 
+         GROUP BY currency`,
 		repoId)
 
 	if err != nil {
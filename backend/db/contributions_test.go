@@ -450,7 +450,7 @@ func TestFilterActiveUsers_EmptyList(t *testing.T) {
 }
 
 // Helper functions
-func createTestUser(t *testing.T, db *DB, email string) *UserDetail {
+func createTestUser(t testing.TB, db *DB, email string) *UserDetail {
 	user := &UserDetail{
 		User: User{
 			Id:        uuid.New(),
@@ -463,7 +463,7 @@ func createTestUser(t *testing.T, db *DB, email string) *UserDetail {
 	return user
 }
 
-func createTestRepo(t *testing.T, db *DB, gitUrl string) *Repo {
+func createTestRepo(t testing.TB, db *DB, gitUrl string) *Repo {
 	t.Helper()
 	
 	name := "test-repo"
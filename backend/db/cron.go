@@ -0,0 +1,149 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// there is one scheduler, so there is one lease
+const cronLeaseName = "scheduler"
+
+type CronJob struct {
+	Name       string    `json:"name"`
+	Schedule   string    `json:"schedule"`
+	NextExecAt time.Time `json:"nextExecAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+type CronRun struct {
+	Id          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	Owner       string    `json:"owner"`
+	ScheduledAt time.Time `json:"scheduledAt"`
+	StartedAt   time.Time `json:"startedAt"`
+	FinishedAt  time.Time `json:"finishedAt"`
+	Error       *string   `json:"error,omitempty"`
+}
+
+// AcquireCronLease takes the lease if it is free or expired, or extends it if the owner holds it
+// already. The row is locked by the upsert, so two instances cannot both get the lease. It returns the
+// fencing token of the lease, which changes with every new owner.
+func (db *DB) AcquireCronLease(owner string, now time.Time, until time.Time) (int64, bool, error) {
+	var token int64
+	err := db.QueryRow(`
+		INSERT INTO cron_lease(name, owner, expires_at, token) VALUES($1, $2, $3, 1)
+		ON CONFLICT (name) DO UPDATE SET owner = EXCLUDED.owner, expires_at = EXCLUDED.expires_at,
+		    token = CASE WHEN cron_lease.owner = EXCLUDED.owner THEN cron_lease.token ELSE cron_lease.token + 1 END
+		WHERE cron_lease.owner = EXCLUDED.owner OR cron_lease.expires_at < $4
+		RETURNING token`,
+		cronLeaseName, owner, until, now).Scan(&token)
+	switch err {
+	case sql.ErrNoRows:
+		return 0, false, nil
+	case nil:
+		return token, true, nil
+	default:
+		return 0, false, err
+	}
+}
+
+func (db *DB) FindCronNextExecAt(name string) (*time.Time, error) {
+	var nextExecAt time.Time
+	err := db.QueryRow(`SELECT next_exec_at FROM cron_job WHERE name = $1`, name).Scan(&nextExecAt)
+	switch err {
+	case sql.ErrNoRows:
+		return nil, nil
+	case nil:
+		return &nextExecAt, nil
+	default:
+		return nil, err
+	}
+}
+
+// RecordCronRun stores the run of the job and its next execution if the owner still holds the lease with
+// the token. It returns false if another instance took the lease over meanwhile, then nothing is stored.
+func (db *DB) RecordCronRun(name string, schedule string, owner string, token int64, scheduledAt time.Time,
+	startedAt time.Time, finishedAt time.Time, errMsg *string, nextExecAt time.Time) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var t int64
+	err = tx.QueryRow(`
+		SELECT token FROM cron_lease WHERE name = $1 AND owner = $2
+		FOR UPDATE`, cronLeaseName, owner).Scan(&t)
+	switch err {
+	case sql.ErrNoRows:
+		return false, nil
+	case nil:
+	default:
+		return false, err
+	}
+	if t != token {
+		return false, nil
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO cron_run(id, name, owner, scheduled_at, started_at, finished_at, error)
+		VALUES($1, $2, $3, $4, $5, $6, $7)`,
+		uuid.New(), name, owner, scheduledAt, startedAt, finishedAt, errMsg)
+	if err != nil {
+		return false, err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO cron_job(name, schedule, next_exec_at, updated_at) VALUES($1, $2, $3, $4)
+		ON CONFLICT (name) DO UPDATE SET schedule = EXCLUDED.schedule, next_exec_at = EXCLUDED.next_exec_at,
+		                                 updated_at = EXCLUDED.updated_at`,
+		name, schedule, nextExecAt, finishedAt)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (db *DB) FindCronJobs() ([]CronJob, error) {
+	rows, err := db.Query(`SELECT name, schedule, next_exec_at, updated_at FROM cron_job ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	cs := []CronJob{}
+	for rows.Next() {
+		var c CronJob
+		err = rows.Scan(&c.Name, &c.Schedule, &c.NextExecAt, &c.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		cs = append(cs, c)
+	}
+	return cs, nil
+}
+
+// FindCronRuns returns the latest runs first
+func (db *DB) FindCronRuns(limit int) ([]CronRun, error) {
+	rows, err := db.Query(`
+		SELECT id, name, owner, scheduled_at, started_at, finished_at, error
+		FROM cron_run
+		ORDER BY started_at DESC
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	rs := []CronRun{}
+	for rows.Next() {
+		var r CronRun
+		err = rows.Scan(&r.Id, &r.Name, &r.Owner, &r.ScheduledAt, &r.StartedAt, &r.FinishedAt, &r.Error)
+		if err != nil {
+			return nil, err
+		}
+		rs = append(rs, r)
+	}
+	return rs, nil
+}
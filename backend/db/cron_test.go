@@ -0,0 +1,108 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcquireCronLease(t *testing.T) {
+	TruncateAll(db, t)
+
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	token, ok, err := db.AcquireCronLease("a", now, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), token)
+
+	//held by a
+	_, ok, err = db.AcquireCronLease("b", now.Add(30*time.Second), now.Add(2*time.Minute))
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	//a extends and keeps its token
+	token, ok, err = db.AcquireCronLease("a", now.Add(30*time.Second), now.Add(2*time.Minute))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), token)
+
+	//expired, b takes over with a new token
+	token, ok, err = db.AcquireCronLease("b", now.Add(3*time.Minute), now.Add(4*time.Minute))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), token)
+	_, ok, err = db.AcquireCronLease("a", now.Add(3*time.Minute), now.Add(4*time.Minute))
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestCronJobState(t *testing.T) {
+	TruncateAll(db, t)
+
+	next, err := db.FindCronNextExecAt("daily")
+	require.NoError(t, err)
+	assert.Nil(t, next)
+
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	token, ok, err := db.AcquireCronLease("a", now, now.Add(time.Minute))
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	msg := "boom"
+	ok, err = db.RecordCronRun("daily", "@daily", "a", token, now, now, now.Add(time.Second), nil, now.Add(12*time.Hour))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = db.RecordCronRun("daily", "@daily", "a", token, now.Add(time.Hour), now.Add(time.Hour), now.Add(time.Hour), &msg, now.Add(36*time.Hour))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	next, err = db.FindCronNextExecAt("daily")
+	require.NoError(t, err)
+	require.NotNil(t, next)
+	assert.True(t, next.Equal(now.Add(36*time.Hour)))
+
+	rs, err := db.FindCronRuns(10)
+	require.NoError(t, err)
+	require.Len(t, rs, 2)
+	assert.Equal(t, "boom", *rs[0].Error)
+	assert.Nil(t, rs[1].Error)
+
+	cs, err := db.FindCronJobs()
+	require.NoError(t, err)
+	require.Len(t, cs, 1)
+	assert.Equal(t, "@daily", cs[0].Schedule)
+}
+
+func TestRecordCronRunFenced(t *testing.T) {
+	TruncateAll(db, t)
+
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	tokenA, ok, err := db.AcquireCronLease("a", now, now.Add(time.Minute))
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	//a runs longer than its lease, b takes over
+	_, ok, err = db.AcquireCronLease("b", now.Add(2*time.Minute), now.Add(3*time.Minute))
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = db.RecordCronRun("daily", "@daily", "a", tokenA, now, now, now.Add(2*time.Minute), nil, now.Add(12*time.Hour))
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	//a gets the lease back, but its old token is fenced
+	_, ok, err = db.AcquireCronLease("a", now.Add(4*time.Minute), now.Add(5*time.Minute))
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = db.RecordCronRun("daily", "@daily", "a", tokenA, now, now, now.Add(4*time.Minute), nil, now.Add(12*time.Hour))
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	next, err := db.FindCronNextExecAt("daily")
+	require.NoError(t, err)
+	assert.Nil(t, next)
+	rs, err := db.FindCronRuns(10)
+	require.NoError(t, err)
+	assert.Len(t, rs, 0)
+}
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CryptoPayment is where and how much crypto the sponsor sends for a payment request, the amounts are in
+// the smallest unit of the pay currency
+type CryptoPayment struct {
+	ExternalId   uuid.UUID `json:"externalId"`
+	UserId       uuid.UUID `json:"-"`
+	PaymentId    string    `json:"paymentId"`
+	PayAddress   string    `json:"payAddress"`
+	PayCurrency  string    `json:"payCurrency"`
+	PayAmount    *big.Int  `json:"payAmount"`
+	ActuallyPaid *big.Int  `json:"actuallyPaid"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+func (db *DB) InsertCryptoPayment(c CryptoPayment) error {
+	_, err := db.Exec(`
+		INSERT INTO crypto_payment(external_id, user_id, payment_id, pay_address, pay_currency, pay_amount,
+		                           actually_paid, updated_at, created_at)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		c.ExternalId, c.UserId, c.PaymentId, c.PayAddress, c.PayCurrency, c.PayAmount.String(),
+		c.ActuallyPaid.String(), c.UpdatedAt, c.CreatedAt)
+	return err
+}
+
+func (db *DB) FindCryptoPayment(externalId uuid.UUID) (*CryptoPayment, error) {
+	var c CryptoPayment
+	var p, a string
+	err := db.QueryRow(`
+		SELECT external_id, user_id, payment_id, pay_address, pay_currency, pay_amount, actually_paid,
+		       updated_at, created_at
+		FROM crypto_payment
+		WHERE external_id = $1`, externalId).
+		Scan(&c.ExternalId, &c.UserId, &c.PaymentId, &c.PayAddress, &c.PayCurrency, &p, &a, &c.UpdatedAt, &c.CreatedAt)
+
+	switch err {
+	case sql.ErrNoRows:
+		return nil, nil
+	case nil:
+		p1, ok := new(big.Int).SetString(p, 10)
+		if !ok {
+			return nil, fmt.Errorf("not a big.int %v", p)
+		}
+		a1, ok := new(big.Int).SetString(a, 10)
+		if !ok {
+			return nil, fmt.Errorf("not a big.int %v", a)
+		}
+		c.PayAmount = p1
+		c.ActuallyPaid = a1
+		return &c, nil
+	default:
+		return nil, err
+	}
+}
@@ -31,13 +31,22 @@ type RepoBalance struct {
 }
 
 type PayoutRequest struct {
-	UserId       uuid.UUID
-	BatchId      uuid.UUID
-	Currency     string
-	ExchangeRate big.Float
-	Tea          int64
-	Address      string
-	CreatedAt    time.Time
+	Id           uuid.UUID  `json:"id"`
+	UserId       uuid.UUID  `json:"userId"`
+	BatchId      *uuid.UUID `json:"batchId,omitempty"`
+	Currency     string     `json:"currency"`
+	Amount       *big.Int   `json:"amount"`
+	ExchangeRate *big.Float `json:"exchangeRate"`
+	RateCurrency string     `json:"rateCurrency"`
+	Tea          int64      `json:"-"`
+	Address      string     `json:"address,omitempty"`
+	Signature    string     `json:"signature,omitempty"`
+	OwnerId      string     `json:"ownerId,omitempty"`
+	Nonce        *big.Int   `json:"nonce,omitempty"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+	Status       string     `json:"status"`
+	UpdatedAt    *time.Time `json:"updatedAt,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
 }
 
 type GitEmail struct {
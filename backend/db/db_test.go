@@ -98,8 +98,11 @@ func (td *TestDb) Close() {
 }
 
 // Helper to truncate all tables between tests (faster than recreating container)
-func TruncateAll(db *DB, t *testing.T) {
+func TruncateAll(db *DB, t testing.TB) {
 	tables := []string{
+		"payout_address_default", "payout_address_confirmed", "payout_address", "payout_withdrawal", "chain_cursor", "payout_batch", "bank_statement_line", "bank_transfer", "crypto_payment", "webhook_event", "chargeback", "subscription", "spending_cap", "organization_member", "organization", "invoice", "invoice_counter", "contribution_archive", "daily_contribution_archive", "contribution_month_sponsor", "contribution_month_contributor",
+		"distribution_event", "distribution_day", "cron_lease", "cron_run", "cron_job", "payout_request", "exchange_rate", "fund_policy_event", "sponsor_weight",
+		"forward_contribution", "forward_rule", "dependency_flow", "repo_dependency",
 		"user_emails_sent", "invite", "future_contribution", "unclaimed",
 		"daily_contribution", "repo_metrics", "analysis_request",
 		"multiplier_event", "trust_event", "sponsor_event", "git_email",
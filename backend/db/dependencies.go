@@ -0,0 +1,194 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type RepoDependency struct {
+	RepoId    uuid.UUID  `json:"repoId"`
+	Ecosystem string     `json:"ecosystem"`
+	Name      string     `json:"name"`
+	DepRepoId *uuid.UUID `json:"depRepoId,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+type DependencyFlow struct {
+	Id            uuid.UUID `json:"id"`
+	UserSponsorId uuid.UUID `json:"userSponsorId"`
+	RootRepoId    uuid.UUID `json:"rootRepoId"`
+	RepoId        uuid.UUID `json:"repoId"`
+	DepRepoId     uuid.UUID `json:"depRepoId"`
+	Depth         int       `json:"depth"`
+	Balance       *big.Int  `json:"balance"`
+	Currency      string    `json:"currency"`
+	Day           time.Time `json:"day"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+type DependencyFlowDetail struct {
+	DependencyFlow
+	RootRepoName string `json:"rootRepoName"`
+	RepoName     string `json:"repoName"`
+	DepRepoName  string `json:"depRepoName"`
+}
+
+// ReplaceRepoDependencies stores the dependencies of the latest analysis of the repo
+func (db *DB) ReplaceRepoDependencies(repoId uuid.UUID, deps []RepoDependency, now time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM repo_dependency WHERE repo_id = $1`, repoId)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range deps {
+		_, err = tx.Exec(`
+			INSERT INTO repo_dependency(id, repo_id, ecosystem, name, dep_repo_id, created_at)
+			VALUES($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (repo_id, ecosystem, name) DO NOTHING`,
+			uuid.New(), repoId, d.Ecosystem, d.Name, d.DepRepoId, now)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (db *DB) FindRepoDependencies(repoId uuid.UUID) ([]RepoDependency, error) {
+	rows, err := db.Query(`
+		SELECT repo_id, ecosystem, name, dep_repo_id, created_at
+		FROM repo_dependency
+		WHERE repo_id = $1
+		ORDER BY ecosystem, name`, repoId)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	ds := []RepoDependency{}
+	for rows.Next() {
+		var d RepoDependency
+		err = rows.Scan(&d.RepoId, &d.Ecosystem, &d.Name, &d.DepRepoId, &d.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		ds = append(ds, d)
+	}
+	return ds, nil
+}
+
+// FindDependencyRepoIds returns for each of the repos the dependencies that are known repos. Repos that
+// were never analyzed cannot pay out anything, so they are left out.
+func (db *DB) FindDependencyRepoIds(repoIds []uuid.UUID) (map[uuid.UUID][]uuid.UUID, error) {
+	rows, err := db.Query(`
+		SELECT DISTINCT d.repo_id, d.dep_repo_id
+		FROM repo_dependency d
+		WHERE d.repo_id = ANY($1)
+		  AND d.dep_repo_id IS NOT NULL
+		  AND d.dep_repo_id <> d.repo_id
+		  AND EXISTS (SELECT 1 FROM analysis_request a WHERE a.repo_id = d.dep_repo_id)
+		ORDER BY d.repo_id, d.dep_repo_id`, pq.Array(repoIds))
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	m := map[uuid.UUID][]uuid.UUID{}
+	for rows.Next() {
+		var repoId, depRepoId uuid.UUID
+		err = rows.Scan(&repoId, &depRepoId)
+		if err != nil {
+			return nil, err
+		}
+		m[repoId] = append(m[repoId], depRepoId)
+	}
+	return m, nil
+}
+
+// FindRepoByUrl finds a repo by its web or its git url, ignoring case and a trailing .git
+func (db *DB) FindRepoByUrl(url string) (*Repo, error) {
+	var r Repo
+	err := db.QueryRow(`
+		SELECT id, url, git_url, name, description, source, created_at
+		FROM repo
+		WHERE LOWER(url) = LOWER($1) OR LOWER(git_url) = LOWER($1) OR LOWER(git_url) = LOWER($1 || '.git')
+		ORDER BY created_at
+		LIMIT 1`, url).
+		Scan(&r.Id, &r.Url, &r.GitUrl, &r.Name, &r.Description, &r.Source, &r.CreatedAt)
+
+	switch err {
+	case sql.ErrNoRows:
+		return nil, nil
+	case nil:
+		return &r, nil
+	default:
+		return nil, err
+	}
+}
+
+// FindReposByShortName finds repos where the last part of the name matches, e.g. svelte for sveltejs/svelte
+func (db *DB) FindReposByShortName(name string) ([]Repo, error) {
+	rows, err := db.Query(`
+		SELECT id, url, git_url, name, description, source, created_at
+		FROM repo
+		WHERE LOWER(regexp_replace(name, '^.*/', '')) = LOWER($1)`, name)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+	return scanRepos(rows)
+}
+
+func (db *DB) InsertDependencyFlow(f DependencyFlow) error {
+	_, err := db.Exec(`
+		INSERT INTO dependency_flow(id, user_sponsor_id, root_repo_id, repo_id, dep_repo_id, depth,
+		                            balance, currency, day, created_at, generation)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, day_generation($9))`,
+		f.Id, f.UserSponsorId, f.RootRepoId, f.RepoId, f.DepRepoId, f.Depth,
+		f.Balance.String(), f.Currency, f.Day, f.CreatedAt)
+	return err
+}
+
+func (db *DB) FindDependencyFlowsBySponsor(userSponsorId uuid.UUID) ([]DependencyFlowDetail, error) {
+	rows, err := db.Query(`
+		SELECT f.id, f.user_sponsor_id, f.root_repo_id, f.repo_id, f.dep_repo_id, f.depth,
+		       f.balance, f.currency, f.day, f.created_at, rr.name, r.name, dr.name
+		FROM dependency_flow f
+		    INNER JOIN repo rr ON f.root_repo_id = rr.id
+		    INNER JOIN repo r ON f.repo_id = r.id
+		    INNER JOIN repo dr ON f.dep_repo_id = dr.id
+		WHERE f.user_sponsor_id = $1
+		ORDER BY f.day, f.root_repo_id, f.depth`, userSponsorId)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	fs := []DependencyFlowDetail{}
+	for rows.Next() {
+		var f DependencyFlowDetail
+		var b string
+		err = rows.Scan(&f.Id, &f.UserSponsorId, &f.RootRepoId, &f.RepoId, &f.DepRepoId, &f.Depth,
+			&b, &f.Currency, &f.Day, &f.CreatedAt, &f.RootRepoName, &f.RepoName, &f.DepRepoName)
+		if err != nil {
+			return nil, err
+		}
+		b1, ok := new(big.Int).SetString(b, 10)
+		if !ok {
+			return nil, fmt.Errorf("not a big.int %v", b)
+		}
+		f.Balance = b1
+		fs = append(fs, f)
+	}
+	return fs, nil
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplaceRepoDependencies(t *testing.T) {
+	TruncateAll(db, t)
+
+	repo := createTestRepo(t, db, "https://github.com/test/repo")
+	dep := createTestRepo(t, db, "https://github.com/test/dep")
+
+	err := db.ReplaceRepoDependencies(repo.Id, []RepoDependency{
+		{Ecosystem: "go", Name: "github.com/test/dep", DepRepoId: &dep.Id},
+		{Ecosystem: "npm", Name: "left-pad"},
+	}, time.Now())
+	require.NoError(t, err)
+
+	ds, err := db.FindRepoDependencies(repo.Id)
+	require.NoError(t, err)
+	require.Len(t, ds, 2)
+	assert.Equal(t, dep.Id, *ds[0].DepRepoId)
+	assert.Nil(t, ds[1].DepRepoId)
+
+	//the dependency was never analyzed
+	m, err := db.FindDependencyRepoIds([]uuid.UUID{repo.Id})
+	require.NoError(t, err)
+	assert.Len(t, m, 0)
+
+	require.NoError(t, db.InsertAnalysisRequest(AnalysisRequest{
+		Id: uuid.New(), RepoId: dep.Id, DateFrom: time.Now(), DateTo: time.Now(), GitUrl: "https://github.com/test/dep",
+	}, time.Now()))
+	m, err = db.FindDependencyRepoIds([]uuid.UUID{repo.Id})
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{dep.Id}, m[repo.Id])
+
+	err = db.ReplaceRepoDependencies(repo.Id, nil, time.Now())
+	require.NoError(t, err)
+	ds, err = db.FindRepoDependencies(repo.Id)
+	require.NoError(t, err)
+	assert.Len(t, ds, 0)
+}
+
+func TestDependencyFlows(t *testing.T) {
+	TruncateAll(db, t)
+
+	sponsor := createTestUser(t, db, "sponsor@example.com")
+	repo := createTestRepo(t, db, "https://github.com/test/repo")
+	dep := createTestRepo(t, db, "https://github.com/test/dep")
+
+	require.NoError(t, db.InsertDependencyFlow(DependencyFlow{
+		Id: uuid.New(), UserSponsorId: sponsor.Id, RootRepoId: repo.Id, RepoId: repo.Id, DepRepoId: dep.Id,
+		Depth: 1, Balance: big.NewInt(200), Currency: "USD", Day: time.Now(), CreatedAt: time.Now(),
+	}))
+
+	fs, err := db.FindDependencyFlowsBySponsor(sponsor.Id)
+	require.NoError(t, err)
+	require.Len(t, fs, 1)
+	assert.Equal(t, big.NewInt(200), fs[0].Balance)
+	assert.Equal(t, dep.Id, fs[0].DepRepoId)
+}
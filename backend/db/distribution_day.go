@@ -0,0 +1,291 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// string mapping
+const (
+	DistributionBooking  = "BOOKING"
+	DistributionBooked   = "BOOKED"
+	DistributionReversed = "REVERSED"
+)
+
+type DistributionDay struct {
+	Day        time.Time `json:"day"`
+	Status     string    `json:"status"`
+	Generation int       `json:"generation"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+type DistributionEvent struct {
+	Id         uuid.UUID  `json:"id"`
+	Day        time.Time  `json:"day"`
+	Action     string     `json:"action"`
+	Generation int        `json:"generation"`
+	UserId     *uuid.UUID `json:"userId,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// DistributionSums is what was booked on a day in the current generation, per currency
+type DistributionSums struct {
+	Contributions       map[string]*big.Int `json:"contributions"`
+	FutureContributions map[string]*big.Int `json:"futureContributions"`
+	Unclaimed           map[string]*big.Int `json:"unclaimed"`
+	Forwarded           map[string]*big.Int `json:"forwarded"`
+}
+
+func (db *DB) FindDistributionDay(day time.Time) (*DistributionDay, error) {
+	var d DistributionDay
+	err := db.QueryRow(`
+		SELECT day, status, generation, updated_at
+		FROM distribution_day
+		WHERE day = $1`, day).
+		Scan(&d.Day, &d.Status, &d.Generation, &d.UpdatedAt)
+
+	switch err {
+	case sql.ErrNoRows:
+		return nil, nil
+	case nil:
+		return &d, nil
+	default:
+		return nil, err
+	}
+}
+
+func (db *DB) FindDistributionDays(from time.Time, to time.Time) ([]DistributionDay, error) {
+	rows, err := db.Query(`
+		SELECT day, status, generation, updated_at
+		FROM distribution_day
+		WHERE day >= $1 AND day <= $2
+		ORDER BY day`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	ds := []DistributionDay{}
+	for rows.Next() {
+		var d DistributionDay
+		err = rows.Scan(&d.Day, &d.Status, &d.Generation, &d.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		ds = append(ds, d)
+	}
+	return ds, nil
+}
+
+// HasDistribution checks if there are bookings for a day, also for days that were booked before the
+// days were tracked
+func (db *DB) HasDistribution(day time.Time) (bool, error) {
+	var exists bool
+	err := db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM daily_contribution WHERE day = $1)
+		    OR EXISTS(SELECT 1 FROM future_contribution WHERE day = $1)`, day).Scan(&exists)
+	return exists, err
+}
+
+// MarkDistributionDayBooked records a day that was booked before the days were tracked
+func (db *DB) MarkDistributionDayBooked(day time.Time, now time.Time) error {
+	_, err := db.Exec(`
+		INSERT INTO distribution_day(day, status, generation, updated_at) VALUES($1, $2, 0, $3)
+		ON CONFLICT (day) DO NOTHING`, day, DistributionBooked, now)
+	return err
+}
+
+// StartDistributionDay marks the day as being booked and returns the generation of the new bookings. A
+// reversed day gets a new generation, so its bookings do not collide with the compensating entries.
+func (db *DB) StartDistributionDay(day time.Time, now time.Time) (int, error) {
+	var generation int
+	err := db.QueryRow(`
+		INSERT INTO distribution_day(day, status, generation, updated_at) VALUES($1, $2, 0, $4)
+		ON CONFLICT (day) DO UPDATE SET status = EXCLUDED.status, generation = distribution_day.generation + 1,
+		                                updated_at = EXCLUDED.updated_at
+		WHERE distribution_day.status = $3
+		RETURNING generation`, day, DistributionBooking, DistributionReversed, now).Scan(&generation)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("day %v is not reversed, cannot book it again", day.Format(time.DateOnly))
+	}
+	return generation, err
+}
+
+func (db *DB) FinishDistributionDay(day time.Time, now time.Time) error {
+	res, err := db.Exec(`
+		UPDATE distribution_day SET status = $2, updated_at = $4
+		WHERE day = $1 AND status = $3`, day, DistributionBooked, DistributionBooking, now)
+	if err != nil {
+		return err
+	}
+	return handleErrMustInsertOne(res)
+}
+
+// ReverseDistributionDay books compensating entries for everything of the current generation of the
+// day, in a new generation. Contributions that were claimed already cannot be reversed.
+func (db *DB) ReverseDistributionDay(day time.Time, now time.Time) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var status string
+	var generation int
+	err = tx.QueryRow(`SELECT status, generation FROM distribution_day WHERE day = $1 FOR UPDATE`, day).
+		Scan(&status, &generation)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("day %v was never booked", day.Format(time.DateOnly))
+	}
+	if err != nil {
+		return 0, err
+	}
+	if status == DistributionReversed {
+		return 0, fmt.Errorf("day %v is already reversed", day.Format(time.DateOnly))
+	}
+
+	var claimed bool
+	err = tx.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM daily_contribution WHERE day = $1 AND generation = $2 AND claimed_at IS NOT NULL)`,
+		day, generation).Scan(&claimed)
+	if err != nil {
+		return 0, err
+	}
+	if claimed {
+		return 0, fmt.Errorf("day %v has claimed contributions, cannot reverse it", day.Format(time.DateOnly))
+	}
+
+	//the contributions of an archived month are not in daily_contribution anymore
+	var archived bool
+	err = tx.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM contribution_archive WHERE month = date_trunc('month', $1::date)::date)`,
+		day).Scan(&archived)
+	if err != nil {
+		return 0, err
+	}
+	if archived {
+		return 0, fmt.Errorf("day %v is archived, cannot reverse it", day.Format(time.DateOnly))
+	}
+
+	next := generation + 1
+	statements := []string{`
+		INSERT INTO daily_contribution(id, user_sponsor_id, user_contributor_id, repo_id, balance, currency,
+		                               day, created_at, foundation_payment, generation)
+		SELECT gen_random_uuid(), user_sponsor_id, user_contributor_id, repo_id, -balance, currency,
+		       day, $3, foundation_payment, $4
+		FROM daily_contribution WHERE day = $1 AND generation = $2`, `
+		INSERT INTO future_contribution(id, user_sponsor_id, repo_id, balance, currency, day, created_at,
+		                                foundation_payment, generation)
+		SELECT gen_random_uuid(), user_sponsor_id, repo_id, -balance, currency, day, $3, foundation_payment, $4
+		FROM future_contribution WHERE day = $1 AND generation = $2`, `
+		INSERT INTO unclaimed(id, user_sponsor_id, email, repo_id, balance, currency, day, created_at, expired_at,
+		                      generation)
+		SELECT gen_random_uuid(), user_sponsor_id, email, repo_id, -balance, currency, day, $3, expired_at, $4
+		FROM unclaimed WHERE day = $1 AND generation = $2`, `
+		INSERT INTO forward_contribution(id, user_from_id, user_to_id, repo_id, target_repo_id, balance,
+		                                 currency, day, depth, created_at, generation)
+		SELECT gen_random_uuid(), user_from_id, user_to_id, repo_id, target_repo_id, -balance,
+		       currency, day, depth, $3, $4
+		FROM forward_contribution WHERE day = $1 AND generation = $2`, `
+		INSERT INTO dependency_flow(id, user_sponsor_id, root_repo_id, repo_id, dep_repo_id, depth, balance,
+		                            currency, day, created_at, generation)
+		SELECT gen_random_uuid(), user_sponsor_id, root_repo_id, repo_id, dep_repo_id, depth, -balance,
+		       currency, day, $3, $4
+		FROM dependency_flow WHERE day = $1 AND generation = $2`,
+	}
+	for _, s := range statements {
+		_, err = tx.Exec(s, day, generation, now, next)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE distribution_day SET status = $2, generation = $3, updated_at = $4
+		WHERE day = $1`, day, DistributionReversed, next, now)
+	if err != nil {
+		return 0, err
+	}
+	return next, tx.Commit()
+}
+
+// FindDistributionSums returns what a reversal of the current generation of the day would compensate
+func (db *DB) FindDistributionSums(day time.Time) (*DistributionSums, error) {
+	sums := make([]map[string]*big.Int, 4)
+	for i, table := range []string{"daily_contribution", "future_contribution", "unclaimed", "forward_contribution"} {
+		m, err := db.findDistributionSum(table, day)
+		if err != nil {
+			return nil, err
+		}
+		sums[i] = m
+	}
+	return &DistributionSums{
+		Contributions:       sums[0],
+		FutureContributions: sums[1],
+		Unclaimed:           sums[2],
+		Forwarded:           sums[3],
+	}, nil
+}
+
+func (db *DB) findDistributionSum(table string, day time.Time) (map[string]*big.Int, error) {
+	//the table name is one of ours, never from the outside
+	rows, err := db.Query(`
+		SELECT currency, COALESCE(SUM(balance), 0)
+		FROM `+table+`
+		WHERE day = $1 AND generation = day_generation($1)
+		GROUP BY currency`, day)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	m := make(map[string]*big.Int)
+	for rows.Next() {
+		var c, b string
+		err = rows.Scan(&c, &b)
+		if err != nil {
+			return nil, err
+		}
+		b1, ok := new(big.Int).SetString(b, 10)
+		if !ok {
+			return nil, fmt.Errorf("not a big.int %v", b)
+		}
+		m[c] = b1
+	}
+	return m, nil
+}
+
+func (db *DB) InsertDistributionEvent(e DistributionEvent) error {
+	_, err := db.Exec(`
+		INSERT INTO distribution_event(id, day, action, generation, user_id, created_at)
+		VALUES($1, $2, $3, $4, $5, $6)`,
+		e.Id, e.Day, e.Action, e.Generation, e.UserId, e.CreatedAt)
+	return err
+}
+
+func (db *DB) FindDistributionEvents(from time.Time, to time.Time) ([]DistributionEvent, error) {
+	rows, err := db.Query(`
+		SELECT id, day, action, generation, user_id, created_at
+		FROM distribution_event
+		WHERE day >= $1 AND day <= $2
+		ORDER BY day, created_at`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	es := []DistributionEvent{}
+	for rows.Next() {
+		var e DistributionEvent
+		err = rows.Scan(&e.Id, &e.Day, &e.Action, &e.Generation, &e.UserId, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		es = append(es, e)
+	}
+	return es, nil
+}
@@ -0,0 +1,107 @@
+package db
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDistributionDay(t *testing.T) {
+	TruncateAll(db, t)
+
+	day := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	d, err := db.FindDistributionDay(day)
+	require.NoError(t, err)
+	assert.Nil(t, d)
+
+	gen, err := db.StartDistributionDay(day, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 0, gen)
+	d, err = db.FindDistributionDay(day)
+	require.NoError(t, err)
+	assert.Equal(t, DistributionBooking, d.Status)
+
+	require.NoError(t, db.FinishDistributionDay(day, time.Now()))
+	d, err = db.FindDistributionDay(day)
+	require.NoError(t, err)
+	assert.Equal(t, DistributionBooked, d.Status)
+
+	//a booked day cannot be booked again
+	_, err = db.StartDistributionDay(day, time.Now())
+	assert.Error(t, err)
+}
+
+func TestReverseDistributionDay(t *testing.T) {
+	TruncateAll(db, t)
+
+	sponsor := createTestUser(t, db, "sponsor@example.com")
+	contributor := createTestUser(t, db, "contributor@example.com")
+	repo := createTestRepo(t, db, "https://github.com/test/repo")
+
+	day := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	_, err := db.StartDistributionDay(day, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, db.InsertContribution(sponsor.Id, contributor.Id, repo.Id, big.NewInt(1000), "USD", day, time.Now(), false))
+	require.NoError(t, db.InsertFutureContribution(sponsor.Id, repo.Id, big.NewInt(300), "USD", day, time.Now(), false))
+	require.NoError(t, db.FinishDistributionDay(day, time.Now()))
+
+	sums, err := db.FindDistributionSums(day)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(1000), sums.Contributions["USD"])
+	assert.Equal(t, big.NewInt(300), sums.FutureContributions["USD"])
+
+	gen, err := db.ReverseDistributionDay(day, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 1, gen)
+
+	//the compensating entries cancel the day out
+	m, err := db.FindSumDailySponsors(sponsor.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 0, m["USD"].Sign())
+	m, err = db.FindSumFutureSponsors(sponsor.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 0, m["USD"].Sign())
+
+	_, err = db.ReverseDistributionDay(day, time.Now())
+	assert.Error(t, err)
+
+	//a reversed day can be booked again in the next generation
+	gen, err = db.StartDistributionDay(day, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 1, gen)
+	require.NoError(t, db.InsertContribution(sponsor.Id, contributor.Id, repo.Id, big.NewInt(800), "USD", day, time.Now(), false))
+	require.NoError(t, db.FinishDistributionDay(day, time.Now()))
+
+	sums, err = db.FindDistributionSums(day)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(800), sums.Contributions["USD"])
+	m, err = db.FindSumDailySponsors(sponsor.Id)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(800), m["USD"])
+}
+
+func TestReverseDistributionDayClaimed(t *testing.T) {
+	TruncateAll(db, t)
+
+	sponsor := createTestUser(t, db, "sponsor@example.com")
+	contributor := createTestUser(t, db, "contributor@example.com")
+	repo := createTestRepo(t, db, "https://github.com/test/repo")
+
+	day := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	_, err := db.StartDistributionDay(day, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, db.InsertContribution(sponsor.Id, contributor.Id, repo.Id, big.NewInt(1000), "USD", day, time.Now(), false))
+	require.NoError(t, db.FinishDistributionDay(day, time.Now()))
+
+	_, err = db.Exec(`UPDATE daily_contribution SET claimed_at = $1`, time.Now())
+	require.NoError(t, err)
+
+	_, err = db.ReverseDistributionDay(day, time.Now())
+	assert.Error(t, err)
+	d, err := db.FindDistributionDay(day)
+	require.NoError(t, err)
+	assert.Equal(t, DistributionBooked, d.Status)
+}
@@ -183,8 +183,8 @@ func (db *DB) CountEmailSentByEmail(email string, emailType string) (int, error)
 func (db *DB) InsertUnclaimed(id uuid.UUID, email string, repoId uuid.UUID, balance *big.Int, currency string,
 	day time.Time, now time.Time) error {
 	_, err := db.Exec(
-		`INSERT INTO unclaimed(id, email, repo_id, balance, currency, day, created_at) 
-		 VALUES($1, $2, $3, $4, $5, $6, $7)`,
+		`INSERT INTO unclaimed(id, email, repo_id, balance, currency, day, created_at, generation) 
+		 VALUES($1, $2, $3, $4, $5, $6, $7, day_generation($6))`,
 		id, email, repoId, balance.String(), currency, day, now)
 	return err
 }
@@ -194,7 +194,7 @@ func (db *DB) FindMarketingEmails() ([]Marketing, error) {
 		SELECT u.email, u.currency, COALESCE(sum(u.balance), 0) as balances
 		FROM unclaimed u
 		LEFT JOIN git_email g ON u.email = g.email 
-		WHERE g.email IS NULL 
+		WHERE g.email IS NULL AND u.expired_at IS NULL
 		GROUP BY u.email, u.currency
 		ORDER BY u.email, u.currency`)
 
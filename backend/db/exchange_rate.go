@@ -0,0 +1,162 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ExchangeRate struct {
+	Id           uuid.UUID  `json:"id"`
+	CurrencyFrom string     `json:"currencyFrom"`
+	CurrencyTo   string     `json:"currencyTo"`
+	Rate         *big.Float `json:"rate"`
+	Day          time.Time  `json:"day"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
+
+// InsertExchangeRate stores the rate of the day, a provider that is asked twice for the same day
+// overwrites the first rate
+func (db *DB) InsertExchangeRate(r ExchangeRate) error {
+	_, err := db.Exec(`
+		INSERT INTO exchange_rate(id, currency_from, currency_to, rate, day, created_at)
+		VALUES($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (currency_from, currency_to, day) DO UPDATE SET rate = EXCLUDED.rate, created_at = EXCLUDED.created_at`,
+		r.Id, r.CurrencyFrom, r.CurrencyTo, r.Rate.Text('f', 18), r.Day, r.CreatedAt)
+	return err
+}
+
+// FindExchangeRate returns the latest rate on or before the day, or nil if there is none
+func (db *DB) FindExchangeRate(currencyFrom string, currencyTo string, day time.Time) (*ExchangeRate, error) {
+	var r ExchangeRate
+	var b string
+	err := db.QueryRow(`
+		SELECT id, currency_from, currency_to, rate, day, created_at
+		FROM exchange_rate
+		WHERE currency_from = $1 AND currency_to = $2 AND day <= $3
+		ORDER BY day DESC
+		LIMIT 1`, currencyFrom, currencyTo, day).
+		Scan(&r.Id, &r.CurrencyFrom, &r.CurrencyTo, &b, &r.Day, &r.CreatedAt)
+
+	switch err {
+	case sql.ErrNoRows:
+		return nil, nil
+	case nil:
+		f, ok := new(big.Float).SetString(b)
+		if !ok {
+			return nil, fmt.Errorf("not a big.float %v", b)
+		}
+		r.Rate = f
+		return &r, nil
+	default:
+		return nil, err
+	}
+}
+
+// FindLatestExchangeRates returns for every currency pair the latest rate on or before the day
+func (db *DB) FindLatestExchangeRates(day time.Time) ([]ExchangeRate, error) {
+	rows, err := db.Query(`
+		SELECT DISTINCT ON (currency_from, currency_to) id, currency_from, currency_to, rate, day, created_at
+		FROM exchange_rate
+		WHERE day <= $1
+		ORDER BY currency_from, currency_to, day DESC`, day)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	rs := []ExchangeRate{}
+	for rows.Next() {
+		var r ExchangeRate
+		var b string
+		err = rows.Scan(&r.Id, &r.CurrencyFrom, &r.CurrencyTo, &b, &r.Day, &r.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		f, ok := new(big.Float).SetString(b)
+		if !ok {
+			return nil, fmt.Errorf("not a big.float %v", b)
+		}
+		r.Rate = f
+		rs = append(rs, r)
+	}
+	return rs, nil
+}
+
+func (db *DB) UpdateDisplayCurrency(uid uuid.UUID, currency *string) error {
+	_, err := db.Exec(`UPDATE users SET display_currency=$1 WHERE id=$2`, currency, uid)
+	return err
+}
+
+func (db *DB) InsertPayoutRequest(p PayoutRequest) error {
+	var rate *string
+	if p.ExchangeRate != nil {
+		r := p.ExchangeRate.Text('f', 18)
+		rate = &r
+	}
+	status := p.Status
+	if status == "" {
+		status = PayoutRequested
+	}
+	_, err := db.Exec(`
+		INSERT INTO payout_request(id, user_id, batch_id, currency, amount, exchange_rate, rate_currency,
+		                           address, signature, status, created_at)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		p.Id, p.UserId, p.BatchId, p.Currency, p.Amount.String(), rate, p.RateCurrency, p.Address,
+		p.Signature, status, p.CreatedAt)
+	return err
+}
+
+func (db *DB) FindPayoutRequestsByUserId(uid uuid.UUID) ([]PayoutRequest, error) {
+	return db.findPayoutRequests(`
+		SELECT id, user_id, batch_id, currency, amount, exchange_rate, rate_currency, COALESCE(address, ''),
+		       COALESCE(signature, ''), COALESCE(owner_id, ''), nonce, expires_at, status, updated_at,
+		       created_at
+		FROM payout_request
+		WHERE user_id = $1
+		ORDER BY created_at`, uid)
+}
+
+func (db *DB) findPayoutRequests(query string, args ...any) ([]PayoutRequest, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	ps := []PayoutRequest{}
+	for rows.Next() {
+		var p PayoutRequest
+		var b string
+		var rate, nonce sql.NullString
+		err = rows.Scan(&p.Id, &p.UserId, &p.BatchId, &p.Currency, &b, &rate, &p.RateCurrency, &p.Address,
+			&p.Signature, &p.OwnerId, &nonce, &p.ExpiresAt, &p.Status, &p.UpdatedAt, &p.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		b1, ok := new(big.Int).SetString(b, 10)
+		if !ok {
+			return nil, fmt.Errorf("not a big.int %v", b)
+		}
+		p.Amount = b1
+		if rate.Valid {
+			f, ok := new(big.Float).SetString(rate.String)
+			if !ok {
+				return nil, fmt.Errorf("not a big.float %v", rate.String)
+			}
+			p.ExchangeRate = f
+		}
+		if nonce.Valid {
+			n, ok := new(big.Int).SetString(nonce.String, 10)
+			if !ok {
+				return nil, fmt.Errorf("not a big.int %v", nonce.String)
+			}
+			p.Nonce = n
+		}
+		ps = append(ps, p)
+	}
+	return ps, nil
+}
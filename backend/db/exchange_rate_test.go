@@ -0,0 +1,110 @@
+package db
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func insertTestRate(t *testing.T, from string, to string, rate string, day time.Time) {
+	f, ok := new(big.Float).SetString(rate)
+	require.True(t, ok)
+	err := db.InsertExchangeRate(ExchangeRate{
+		Id:           uuid.New(),
+		CurrencyFrom: from,
+		CurrencyTo:   to,
+		Rate:         f,
+		Day:          day,
+		CreatedAt:    time.Now(),
+	})
+	require.NoError(t, err)
+}
+
+func TestFindExchangeRate(t *testing.T) {
+	TruncateAll(db, t)
+
+	day1 := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+	day3 := day1.AddDate(0, 0, 2)
+	insertTestRate(t, "ETH", "USD", "2500.5", day1)
+	insertTestRate(t, "ETH", "USD", "2600", day2)
+	//same day again overwrites
+	insertTestRate(t, "ETH", "USD", "2700", day2)
+	insertTestRate(t, "GAS", "USD", "4.25", day1)
+
+	r, err := db.FindExchangeRate("ETH", "USD", day3)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "2700", r.Rate.Text('f', 0))
+	assert.True(t, r.Day.Equal(day2))
+
+	r, err = db.FindExchangeRate("ETH", "USD", day1)
+	require.NoError(t, err)
+	assert.Equal(t, "2500.5", r.Rate.Text('f', 1))
+
+	r, err = db.FindExchangeRate("ETH", "USD", day1.AddDate(0, 0, -1))
+	require.NoError(t, err)
+	assert.Nil(t, r)
+
+	rs, err := db.FindLatestExchangeRates(day3)
+	require.NoError(t, err)
+	require.Len(t, rs, 2)
+	assert.Equal(t, "ETH", rs[0].CurrencyFrom)
+	assert.Equal(t, "2700", rs[0].Rate.Text('f', 0))
+	assert.Equal(t, "GAS", rs[1].CurrencyFrom)
+}
+
+func TestDisplayCurrency(t *testing.T) {
+	TruncateAll(db, t)
+
+	u := createTestUser(t, db, "display@example.com")
+	c := "ETH"
+	require.NoError(t, db.UpdateDisplayCurrency(u.Id, &c))
+
+	u2, err := db.FindUserById(u.Id)
+	require.NoError(t, err)
+	require.NotNil(t, u2.DisplayCurrency)
+	assert.Equal(t, "ETH", *u2.DisplayCurrency)
+
+	require.NoError(t, db.UpdateDisplayCurrency(u.Id, nil))
+	u2, err = db.FindUserById(u.Id)
+	require.NoError(t, err)
+	assert.Nil(t, u2.DisplayCurrency)
+}
+
+func TestInsertPayoutRequest(t *testing.T) {
+	TruncateAll(db, t)
+
+	u := createTestUser(t, db, "payout@example.com")
+	rate, _ := new(big.Float).SetString("2500.5")
+	err := db.InsertPayoutRequest(PayoutRequest{
+		Id:           uuid.New(),
+		UserId:       u.Id,
+		Currency:     "ETH",
+		Amount:       big.NewInt(1000),
+		ExchangeRate: rate,
+		RateCurrency: "USD",
+		CreatedAt:    time.Now(),
+	})
+	require.NoError(t, err)
+	err = db.InsertPayoutRequest(PayoutRequest{
+		Id:           uuid.New(),
+		UserId:       u.Id,
+		Currency:     "GAS",
+		Amount:       big.NewInt(2000),
+		RateCurrency: "USD",
+		CreatedAt:    time.Now().Add(time.Second),
+	})
+	require.NoError(t, err)
+
+	ps, err := db.FindPayoutRequestsByUserId(u.Id)
+	require.NoError(t, err)
+	require.Len(t, ps, 2)
+	assert.Equal(t, big.NewInt(1000), ps[0].Amount)
+	assert.Equal(t, "2500.5", ps[0].ExchangeRate.Text('f', 1))
+	assert.Nil(t, ps[1].ExchangeRate)
+}
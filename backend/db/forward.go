@@ -0,0 +1,251 @@
+package db
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const MaxForwardPercent = 100
+
+type ForwardRule struct {
+	Id           uuid.UUID  `json:"id"`
+	UserId       uuid.UUID  `json:"userId"`
+	TargetRepoId *uuid.UUID `json:"targetRepoId,omitempty"`
+	TargetUserId *uuid.UUID `json:"targetUserId,omitempty"`
+	Percent      int64      `json:"percent"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
+
+type ForwardContribution struct {
+	Id           uuid.UUID
+	UserFromId   uuid.UUID
+	UserToId     uuid.UUID
+	RepoId       uuid.UUID
+	TargetRepoId *uuid.UUID
+	Balance      *big.Int
+	Currency     string
+	Day          time.Time
+	Depth        int
+	CreatedAt    time.Time
+}
+
+type Earning struct {
+	RepoId   uuid.UUID
+	Balance  *big.Int
+	Currency string
+}
+
+func (db *DB) InsertForwardRule(fr ForwardRule) error {
+	_, err := db.Exec(`
+		INSERT INTO forward_rule(id, user_id, target_repo_id, target_user_id, percent, created_at)
+		VALUES($1, $2, $3, $4, $5, $6)`,
+		fr.Id, fr.UserId, fr.TargetRepoId, fr.TargetUserId, fr.Percent, fr.CreatedAt)
+	return err
+}
+
+func (db *DB) DeleteForwardRule(id uuid.UUID, userId uuid.UUID) (int64, error) {
+	res, err := db.Exec(`DELETE FROM forward_rule WHERE id = $1 AND user_id = $2`, id, userId)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (db *DB) FindForwardRulesByUserId(userId uuid.UUID) ([]ForwardRule, error) {
+	rules, err := db.findForwardRules(`
+		SELECT id, user_id, target_repo_id, target_user_id, percent, created_at
+		FROM forward_rule
+		WHERE user_id = $1
+		ORDER BY created_at`, userId)
+	if err != nil {
+		return nil, err
+	}
+	return rules[userId], nil
+}
+
+// FindAllForwardRules returns the rules of all users, grouped by the user who forwards
+func (db *DB) FindAllForwardRules() (map[uuid.UUID][]ForwardRule, error) {
+	return db.findForwardRules(`
+		SELECT id, user_id, target_repo_id, target_user_id, percent, created_at
+		FROM forward_rule
+		ORDER BY user_id, created_at`)
+}
+
+func (db *DB) findForwardRules(query string, args ...any) (map[uuid.UUID][]ForwardRule, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	m := map[uuid.UUID][]ForwardRule{}
+	for rows.Next() {
+		var fr ForwardRule
+		err = rows.Scan(&fr.Id, &fr.UserId, &fr.TargetRepoId, &fr.TargetUserId, &fr.Percent, &fr.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		m[fr.UserId] = append(m[fr.UserId], fr)
+	}
+	return m, nil
+}
+
+// FindEarningsByDay returns what the contributor received from sponsors on that day, per repo and currency
+func (db *DB) FindEarningsByDay(userContributorId uuid.UUID, day time.Time) ([]Earning, error) {
+	rows, err := db.Query(`
+		SELECT repo_id, currency, COALESCE(SUM(balance), 0)
+		FROM daily_contribution
+		WHERE user_contributor_id = $1 AND day = $2
+		GROUP BY repo_id, currency
+		ORDER BY repo_id, currency`, userContributorId, day)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	var es []Earning
+	for rows.Next() {
+		var e Earning
+		var b string
+		err = rows.Scan(&e.RepoId, &e.Currency, &b)
+		if err != nil {
+			return nil, err
+		}
+		b1, ok := new(big.Int).SetString(b, 10)
+		if !ok {
+			return nil, fmt.Errorf("not a big.int %v", b)
+		}
+		e.Balance = b1
+		es = append(es, e)
+	}
+	return es, nil
+}
+
+// InsertForwardContributions books all forwarded amounts of the day in one transaction, so a day is
+// either forwarded completely or not at all. It returns false if the current generation of the day was
+// forwarded already.
+func (db *DB) InsertForwardContributions(day time.Time, fcs []ForwardContribution) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM forward_contribution WHERE day = $1 AND generation = day_generation($1))`,
+		day).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		return false, nil
+	}
+
+	n := len(fcs)
+	ids, fromIds, toIds, repoIds := make([]uuid.UUID, n), make([]uuid.UUID, n), make([]uuid.UUID, n), make([]uuid.UUID, n)
+	targetRepoIds := make([]*string, n)
+	balances, currencies := make([]string, n), make([]string, n)
+	days, depths, createdAts := make([]string, n), make([]int64, n), make([]string, n)
+	for i, fc := range fcs {
+		ids[i], fromIds[i], toIds[i], repoIds[i] = fc.Id, fc.UserFromId, fc.UserToId, fc.RepoId
+		if fc.TargetRepoId != nil {
+			s := fc.TargetRepoId.String()
+			targetRepoIds[i] = &s
+		}
+		balances[i], currencies[i] = fc.Balance.String(), fc.Currency
+		days[i], depths[i], createdAts[i] = batchDay(fc.Day), int64(fc.Depth), batchTime(fc.CreatedAt)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO forward_contribution(id, user_from_id, user_to_id, repo_id, target_repo_id,
+		                                 balance, currency, day, depth, created_at, generation)
+		SELECT t.id, t.f, t.t, t.r, t.tr, t.b, t.cur, t.d, t.dep, t.ca, day_generation(t.d)
+		FROM unnest($1::uuid[], $2::uuid[], $3::uuid[], $4::uuid[], $5::uuid[], $6::numeric[], $7::varchar[],
+		            $8::date[], $9::int[], $10::timestamptz[]) AS t(id, f, t, r, tr, b, cur, d, dep, ca)`,
+		pq.Array(ids), pq.Array(fromIds), pq.Array(toIds), pq.Array(repoIds), pq.Array(targetRepoIds),
+		pq.Array(balances), pq.Array(currencies), pq.Array(days), pq.Array(depths), pq.Array(createdAts))
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// HasForwardContributions checks the current generation of the day only, after a day was reversed its
+// earnings can be forwarded again
+func (db *DB) HasForwardContributions(day time.Time) (bool, error) {
+	var exists bool
+	err := db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM forward_contribution WHERE day = $1 AND generation = day_generation($1))`,
+		day).Scan(&exists)
+	return exists, err
+}
+
+// FindSumForwardBalance returns per currency what the user received through forwarding minus what
+// the user forwarded to others.
+func (db *DB) FindSumForwardBalance(userId uuid.UUID) (map[string]*big.Int, error) {
+	rows, err := db.Query(`
+		SELECT currency, COALESCE(SUM(CASE WHEN user_to_id = $1 THEN balance ELSE -balance END), 0)
+		FROM forward_contribution
+		WHERE user_to_id = $1 OR user_from_id = $1
+		GROUP BY currency`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	m := make(map[string]*big.Int)
+	for rows.Next() {
+		var c, b string
+		err = rows.Scan(&c, &b)
+		if err != nil {
+			return nil, err
+		}
+		b1, ok := new(big.Int).SetString(b, 10)
+		if !ok {
+			return nil, fmt.Errorf("not a big.int %v", b)
+		}
+		m[c] = b1
+	}
+	return m, nil
+}
+
+// FindForwardContributions returns the forwarded amounts in the format of the contribution summary. The
+// forwarding user is shown as sponsor, and what the user forwarded to others has a negative balance.
+func (db *DB) FindForwardContributions(userId uuid.UUID) ([]Contribution, error) {
+	rows, err := db.Query(`
+		SELECT r.name, r.url, fr.name, fr.email, t.name, t.email,
+		       CASE WHEN f.user_to_id = $1 THEN f.balance ELSE -f.balance END, f.currency, f.day
+		FROM forward_contribution f
+		    INNER JOIN users fr ON f.user_from_id = fr.id
+		    INNER JOIN users t ON f.user_to_id = t.id
+		    INNER JOIN repo r ON COALESCE(f.target_repo_id, f.repo_id) = r.id
+		WHERE f.user_to_id = $1 OR f.user_from_id = $1
+		ORDER BY f.day`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	cs := []Contribution{}
+	for rows.Next() {
+		var c Contribution
+		var b string
+		err = rows.Scan(&c.RepoName, &c.RepoUrl, &c.SponsorName, &c.SponsorEmail, &c.ContributorName,
+			&c.ContributorEmail, &b, &c.Currency, &c.Day)
+		if err != nil {
+			return nil, err
+		}
+		b1, ok := new(big.Int).SetString(b, 10)
+		if !ok {
+			return nil, fmt.Errorf("not a big.int %v", b)
+		}
+		c.Balance = b1
+		c.Forwarded = true
+		cs = append(cs, c)
+	}
+	return cs, nil
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForwardRules(t *testing.T) {
+	TruncateAll(db, t)
+
+	from := createTestUser(t, db, "from@example.com")
+	to := createTestUser(t, db, "to@example.com")
+	repo := createTestRepo(t, db, "https://github.com/test/repo")
+
+	fr1 := ForwardRule{Id: uuid.New(), UserId: from.Id, TargetUserId: &to.Id, Percent: 30, CreatedAt: time.Now()}
+	fr2 := ForwardRule{Id: uuid.New(), UserId: from.Id, TargetRepoId: &repo.Id, Percent: 20, CreatedAt: time.Now()}
+	require.NoError(t, db.InsertForwardRule(fr1))
+	require.NoError(t, db.InsertForwardRule(fr2))
+
+	rules, err := db.FindForwardRulesByUserId(from.Id)
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	assert.Equal(t, to.Id, *rules[0].TargetUserId)
+	assert.Equal(t, repo.Id, *rules[1].TargetRepoId)
+
+	all, err := db.FindAllForwardRules()
+	require.NoError(t, err)
+	assert.Len(t, all[from.Id], 2)
+
+	nr, err := db.DeleteForwardRule(fr1.Id, to.Id)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), nr)
+	nr, err = db.DeleteForwardRule(fr1.Id, from.Id)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), nr)
+}
+
+func TestForwardContributions(t *testing.T) {
+	TruncateAll(db, t)
+
+	sponsor := createTestUser(t, db, "sponsor@example.com")
+	from := createTestUser(t, db, "from@example.com")
+	to := createTestUser(t, db, "to@example.com")
+	repo := createTestRepo(t, db, "https://github.com/test/repo")
+
+	day := time.Now().Truncate(24 * time.Hour)
+	require.NoError(t, db.InsertContribution(sponsor.Id, from.Id, repo.Id, big.NewInt(1000), "USD", day, time.Now(), false))
+
+	es, err := db.FindEarningsByDay(from.Id, day)
+	require.NoError(t, err)
+	require.Len(t, es, 1)
+	assert.Equal(t, big.NewInt(1000), es[0].Balance)
+
+	done, err := db.HasForwardContributions(day)
+	require.NoError(t, err)
+	assert.False(t, done)
+
+	fcs := []ForwardContribution{
+		{Id: uuid.New(), UserFromId: from.Id, UserToId: to.Id, RepoId: repo.Id,
+			Balance: big.NewInt(400), Currency: "USD", Day: day, Depth: 1, CreatedAt: time.Now()},
+		{Id: uuid.New(), UserFromId: to.Id, UserToId: sponsor.Id, RepoId: repo.Id, TargetRepoId: &repo.Id,
+			Balance: big.NewInt(100), Currency: "USD", Day: day, Depth: 2, CreatedAt: time.Now()},
+	}
+	ok, err := db.InsertForwardContributions(day, fcs)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	done, err = db.HasForwardContributions(day)
+	require.NoError(t, err)
+	assert.True(t, done)
+
+	//a second run of the day books nothing
+	ok, err = db.InsertForwardContributions(day, fcs)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	mFrom, err := db.FindSumForwardBalance(from.Id)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(-400), mFrom["USD"])
+	mTo, err := db.FindSumForwardBalance(to.Id)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(300), mTo["USD"])
+
+	cs, err := db.FindForwardContributions(from.Id)
+	require.NoError(t, err)
+	require.Len(t, cs, 1)
+	assert.Equal(t, big.NewInt(-400), cs[0].Balance)
+	assert.Equal(t, "to@example.com", cs[0].ContributorEmail)
+	assert.True(t, cs[0].Forwarded)
+}
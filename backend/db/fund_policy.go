@@ -0,0 +1,255 @@
+package db
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// string mapping
+const (
+	FundPolicyRefund       = "REFUND"
+	FundPolicyRedistribute = "REDISTRIBUTE"
+	FundPolicyDonate       = "DONATE"
+)
+
+var FundPolicies = []string{FundPolicyRefund, FundPolicyRedistribute, FundPolicyDonate}
+
+type ExpiredFund struct {
+	UserSponsorId uuid.UUID
+	RepoId        uuid.UUID
+	Balance       *big.Int
+	Currency      string
+}
+
+type FundPolicyEvent struct {
+	Id            uuid.UUID  `json:"id"`
+	UserSponsorId uuid.UUID  `json:"userSponsorId"`
+	RepoId        uuid.UUID  `json:"repoId"`
+	Policy        string     `json:"policy"`
+	TargetRepoId  *uuid.UUID `json:"targetRepoId,omitempty"`
+	TargetUserId  *uuid.UUID `json:"targetUserId,omitempty"`
+	Balance       *big.Int   `json:"balance"`
+	Currency      string     `json:"currency"`
+	Day           time.Time  `json:"day"`
+	CreatedAt     time.Time  `json:"createdAt"`
+}
+
+func IsValidFundPolicy(policy string) bool {
+	for _, v := range FundPolicies {
+		if v == policy {
+			return true
+		}
+	}
+	return false
+}
+
+// FindExpiredFutureContributions returns per sponsor, repo and currency the part of the parked balance
+// that is older than cutoff. Recent deductions are taken from the oldest funds first, so the result is
+// the total balance minus everything that was parked on or after cutoff. The result can be negative
+// for repos where the parked money of other repos was distributed.
+func (db *DB) FindExpiredFutureContributions(cutoff time.Time) ([]ExpiredFund, error) {
+	rows, err := db.Query(`
+		SELECT user_sponsor_id, repo_id, currency,
+		       COALESCE(SUM(balance), 0) - COALESCE(SUM(CASE WHEN day >= $1 AND balance > 0 THEN balance ELSE 0 END), 0)
+		FROM future_contribution
+		WHERE foundation_payment = FALSE
+		GROUP BY user_sponsor_id, repo_id, currency
+		HAVING MIN(day) < $1
+		ORDER BY user_sponsor_id, currency, repo_id`, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	var efs []ExpiredFund
+	for rows.Next() {
+		var ef ExpiredFund
+		var b string
+		err = rows.Scan(&ef.UserSponsorId, &ef.RepoId, &ef.Currency, &b)
+		if err != nil {
+			return nil, err
+		}
+		b1, ok := new(big.Int).SetString(b, 10)
+		if !ok {
+			return nil, fmt.Errorf("not a big.int %v", b)
+		}
+		ef.Balance = b1
+		efs = append(efs, ef)
+	}
+	return efs, nil
+}
+
+func (db *DB) InsertFundPolicyEvent(e FundPolicyEvent) error {
+	_, err := db.Exec(`
+		INSERT INTO fund_policy_event(id, user_sponsor_id, repo_id, policy, target_repo_id, target_user_id,
+		                              balance, currency, day, created_at)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		e.Id, e.UserSponsorId, e.RepoId, e.Policy, e.TargetRepoId, e.TargetUserId,
+		e.Balance.String(), e.Currency, e.Day, e.CreatedAt)
+	return err
+}
+
+// FundPolicyBooking is what one application of the fund policy to an expired fund books: the contributions
+// to the targets, what is taken from the parked funds and the events
+type FundPolicyBooking struct {
+	Contributions       []BatchContribution
+	FutureContributions []BatchFutureContribution
+	Events              []FundPolicyEvent
+}
+
+// BookFundPolicy books the application in one transaction, so a failed run neither leaves distributed funds
+// parked nor takes parked funds without an event. It books on the day of the DailyRunner, so the
+// contributions are added to existing rows of the day.
+func (db *DB) BookFundPolicy(b FundPolicyBooking) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, c := range b.Contributions {
+		_, err = tx.Exec(`
+			INSERT INTO daily_contribution(id, user_sponsor_id, user_contributor_id, repo_id,
+			                               balance, currency, day, created_at, foundation_payment, generation)
+			VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, day_generation($7))
+			ON CONFLICT (user_sponsor_id, user_contributor_id, repo_id, currency, day, generation)
+			DO UPDATE SET
+			    balance = daily_contribution.balance + EXCLUDED.balance,
+			    created_at = EXCLUDED.created_at`,
+			uuid.New(), c.UserSponsorId, c.UserContributorId, c.RepoId, c.Balance.String(), c.Currency, c.Day,
+			c.CreatedAt, c.FoundationPayment)
+		if err != nil {
+			return err
+		}
+	}
+	for _, f := range b.FutureContributions {
+		_, err = tx.Exec(`
+			INSERT INTO future_contribution(id, user_sponsor_id, repo_id, balance, currency, day, created_at,
+			                                foundation_payment, generation)
+			VALUES($1, $2, $3, $4, $5, $6, $7, $8, day_generation($6))
+			ON CONFLICT (user_sponsor_id, repo_id, currency, day, generation)
+			DO UPDATE SET
+			    balance = future_contribution.balance + EXCLUDED.balance,
+			    created_at = EXCLUDED.created_at,
+			    foundation_payment = EXCLUDED.foundation_payment`,
+			uuid.New(), f.UserSponsorId, f.RepoId, f.Balance.String(), f.Currency, f.Day, f.CreatedAt,
+			f.FoundationPayment)
+		if err != nil {
+			return err
+		}
+	}
+	for _, e := range b.Events {
+		_, err = tx.Exec(`
+			INSERT INTO fund_policy_event(id, user_sponsor_id, repo_id, policy, target_repo_id, target_user_id,
+			                              balance, currency, day, created_at)
+			VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+			e.Id, e.UserSponsorId, e.RepoId, e.Policy, e.TargetRepoId, e.TargetUserId,
+			e.Balance.String(), e.Currency, e.Day, e.CreatedAt)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (db *DB) FindFundPolicyEventsBySponsor(userSponsorId uuid.UUID) ([]FundPolicyEvent, error) {
+	rows, err := db.Query(`
+		SELECT id, user_sponsor_id, repo_id, policy, target_repo_id, target_user_id,
+		       balance, currency, day, created_at
+		FROM fund_policy_event
+		WHERE user_sponsor_id = $1
+		ORDER BY day, created_at`, userSponsorId)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	es := []FundPolicyEvent{}
+	for rows.Next() {
+		var e FundPolicyEvent
+		var b string
+		err = rows.Scan(&e.Id, &e.UserSponsorId, &e.RepoId, &e.Policy, &e.TargetRepoId, &e.TargetUserId,
+			&b, &e.Currency, &e.Day, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		b1, ok := new(big.Int).SetString(b, 10)
+		if !ok {
+			return nil, fmt.Errorf("not a big.int %v", b)
+		}
+		e.Balance = b1
+		es = append(es, e)
+	}
+	return es, nil
+}
+
+func (db *DB) UpdateFundPolicy(uid uuid.UUID, policy *string) error {
+	_, err := db.Exec(
+		`UPDATE users SET fund_policy=$1 WHERE id=$2`,
+		policy, uid)
+	return err
+}
+
+// InsertOrUpdateContribution adds the balance to an existing contribution of the same day. The
+// daily runner uses InsertContribution, this is for bookings that run after it on the same day.
+func (db *DB) InsertOrUpdateContribution(userSponsorId uuid.UUID, userContributorId uuid.UUID, repoId uuid.UUID, balance *big.Int, currency string, day time.Time, createdAt time.Time, foundationPayment bool) error {
+	_, err := db.Exec(
+		`INSERT INTO daily_contribution(id, user_sponsor_id, user_contributor_id, repo_id,
+		                                balance, currency, day, created_at, foundation_payment, generation)
+		 VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, day_generation($7))
+		 ON CONFLICT (user_sponsor_id, user_contributor_id, repo_id, currency, day, generation)
+		 DO UPDATE SET
+		     balance = daily_contribution.balance + EXCLUDED.balance,
+		     created_at = EXCLUDED.created_at`,
+		uuid.New(), userSponsorId, userContributorId, repoId, balance.String(), currency, day, createdAt, foundationPayment)
+	return err
+}
+
+// FindExpiredUnclaimed returns per sponsor, repo and currency the unclaimed shares older than cutoff that
+// did not expire yet. Shares without a sponsor are from the foundation, or were booked before the sponsor
+// was stored, no policy applies to them.
+func (db *DB) FindExpiredUnclaimed(cutoff time.Time) ([]ExpiredFund, error) {
+	rows, err := db.Query(`
+		SELECT user_sponsor_id, repo_id, currency, SUM(balance)
+		FROM unclaimed
+		WHERE day < $1 AND expired_at IS NULL AND user_sponsor_id IS NOT NULL
+		GROUP BY user_sponsor_id, repo_id, currency
+		HAVING SUM(balance) > 0
+		ORDER BY user_sponsor_id, currency, repo_id`, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	var efs []ExpiredFund
+	for rows.Next() {
+		var ef ExpiredFund
+		var b string
+		err = rows.Scan(&ef.UserSponsorId, &ef.RepoId, &ef.Currency, &b)
+		if err != nil {
+			return nil, err
+		}
+		b1, ok := new(big.Int).SetString(b, 10)
+		if !ok {
+			return nil, fmt.Errorf("not a big.int %v", b)
+		}
+		ef.Balance = b1
+		efs = append(efs, ef)
+	}
+	return efs, nil
+}
+
+// ExpireUnclaimed marks the unclaimed shares older than cutoff as expired, after the policy was applied
+// to them
+func (db *DB) ExpireUnclaimed(cutoff time.Time, now time.Time) (int64, error) {
+	res, err := db.Exec(
+		`UPDATE unclaimed SET expired_at=$1 WHERE day < $2 AND expired_at IS NULL`,
+		now, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
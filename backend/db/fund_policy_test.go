@@ -0,0 +1,222 @@
+package db
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindExpiredFutureContributions(t *testing.T) {
+	TruncateAll(db, t)
+
+	sponsor := createTestUser(t, db, "sponsor@example.com")
+	repo := createTestRepo(t, db, "https://github.com/test/repo")
+
+	cutoff := time.Now().AddDate(0, -3, 0).Truncate(24 * time.Hour)
+	require.NoError(t, db.InsertFutureContribution(
+		sponsor.Id, repo.Id, big.NewInt(1000), "USD", cutoff.AddDate(0, 0, -2), time.Now(), false))
+	require.NoError(t, db.InsertFutureContribution(
+		sponsor.Id, repo.Id, big.NewInt(500), "USD", cutoff.AddDate(0, 0, 2), time.Now(), false))
+
+	efs, err := db.FindExpiredFutureContributions(cutoff)
+	require.NoError(t, err)
+	require.Len(t, efs, 1)
+	assert.Equal(t, sponsor.Id, efs[0].UserSponsorId)
+	assert.Equal(t, repo.Id, efs[0].RepoId)
+	assert.Equal(t, big.NewInt(1000), efs[0].Balance)
+}
+
+func TestFindExpiredFutureContributions_DeductOldestFirst(t *testing.T) {
+	TruncateAll(db, t)
+
+	sponsor := createTestUser(t, db, "sponsor@example.com")
+	repo := createTestRepo(t, db, "https://github.com/test/repo")
+
+	cutoff := time.Now().AddDate(0, -3, 0).Truncate(24 * time.Hour)
+	require.NoError(t, db.InsertFutureContribution(
+		sponsor.Id, repo.Id, big.NewInt(1000), "USD", cutoff.AddDate(0, 0, -2), time.Now(), false))
+	require.NoError(t, db.InsertFutureContribution(
+		sponsor.Id, repo.Id, big.NewInt(-800), "USD", cutoff.AddDate(0, 0, 1), time.Now(), false))
+
+	efs, err := db.FindExpiredFutureContributions(cutoff)
+	require.NoError(t, err)
+	require.Len(t, efs, 1)
+	assert.Equal(t, big.NewInt(200), efs[0].Balance)
+}
+
+func TestFindExpiredFutureContributions_NothingOld(t *testing.T) {
+	TruncateAll(db, t)
+
+	sponsor := createTestUser(t, db, "sponsor@example.com")
+	repo := createTestRepo(t, db, "https://github.com/test/repo")
+
+	cutoff := time.Now().AddDate(0, -3, 0).Truncate(24 * time.Hour)
+	require.NoError(t, db.InsertFutureContribution(
+		sponsor.Id, repo.Id, big.NewInt(1000), "USD", cutoff.AddDate(0, 0, 1), time.Now(), false))
+
+	efs, err := db.FindExpiredFutureContributions(cutoff)
+	require.NoError(t, err)
+	assert.Len(t, efs, 0)
+}
+
+func TestInsertFundPolicyEvent(t *testing.T) {
+	TruncateAll(db, t)
+
+	sponsor := createTestUser(t, db, "sponsor@example.com")
+	repo := createTestRepo(t, db, "https://github.com/test/repo")
+
+	day := time.Now().Truncate(24 * time.Hour)
+	require.NoError(t, db.InsertFundPolicyEvent(FundPolicyEvent{
+		Id:            uuid.New(),
+		UserSponsorId: sponsor.Id,
+		RepoId:        repo.Id,
+		Policy:        FundPolicyRefund,
+		TargetUserId:  &sponsor.Id,
+		Balance:       big.NewInt(1000),
+		Currency:      "USD",
+		Day:           day,
+		CreatedAt:     time.Now(),
+	}))
+
+	es, err := db.FindFundPolicyEventsBySponsor(sponsor.Id)
+	require.NoError(t, err)
+	require.Len(t, es, 1)
+	assert.Equal(t, FundPolicyRefund, es[0].Policy)
+	assert.Equal(t, big.NewInt(1000), es[0].Balance)
+	assert.Nil(t, es[0].TargetRepoId)
+	assert.Equal(t, sponsor.Id, *es[0].TargetUserId)
+}
+
+func TestBookFundPolicy(t *testing.T) {
+	TruncateAll(db, t)
+
+	sponsor := createTestUser(t, db, "sponsor@example.com")
+	contributor := createTestUser(t, db, "contributor@example.com")
+	repo := createTestRepo(t, db, "https://github.com/test/repo")
+	target := createTestRepo(t, db, "https://github.com/test/target")
+
+	day := time.Now().Truncate(24 * time.Hour)
+	require.NoError(t, db.InsertFutureContribution(sponsor.Id, repo.Id, big.NewInt(1000), "USD", day.AddDate(0, -4, 0), time.Now(), false))
+	require.NoError(t, db.InsertContribution(sponsor.Id, contributor.Id, target.Id, big.NewInt(100), "USD", day, time.Now(), false))
+
+	booking := func(eventRepoId uuid.UUID) FundPolicyBooking {
+		return FundPolicyBooking{
+			Contributions: []BatchContribution{{UserSponsorId: sponsor.Id, UserContributorId: contributor.Id,
+				RepoId: target.Id, Balance: big.NewInt(600), Currency: "USD", Day: day, CreatedAt: time.Now()}},
+			FutureContributions: []BatchFutureContribution{{UserSponsorId: sponsor.Id, RepoId: repo.Id,
+				Balance: big.NewInt(-600), Currency: "USD", Day: day, CreatedAt: time.Now()}},
+			Events: []FundPolicyEvent{{Id: uuid.New(), UserSponsorId: sponsor.Id, RepoId: eventRepoId,
+				Policy: FundPolicyRedistribute, TargetRepoId: &target.Id, Balance: big.NewInt(600), Currency: "USD",
+				Day: day, CreatedAt: time.Now()}},
+		}
+	}
+
+	//the event cannot be stored, nothing of the booking is left
+	require.Error(t, db.BookFundPolicy(booking(uuid.New())))
+	m, err := db.FindSumFutureSponsors(sponsor.Id)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(1000), m["USD"])
+	m, err = db.FindSumDailyContributors(contributor.Id)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(100), m["USD"])
+
+	require.NoError(t, db.BookFundPolicy(booking(repo.Id)))
+	m, err = db.FindSumFutureSponsors(sponsor.Id)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(400), m["USD"])
+	m, err = db.FindSumDailyContributors(contributor.Id)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(700), m["USD"])
+	es, err := db.FindFundPolicyEventsBySponsor(sponsor.Id)
+	require.NoError(t, err)
+	require.Len(t, es, 1)
+	assert.Equal(t, target.Id, *es[0].TargetRepoId)
+}
+
+func TestUpdateFundPolicy(t *testing.T) {
+	TruncateAll(db, t)
+
+	sponsor := createTestUser(t, db, "sponsor@example.com")
+
+	policy := FundPolicyDonate
+	require.NoError(t, db.UpdateFundPolicy(sponsor.Id, &policy))
+	u, err := db.FindUserById(sponsor.Id)
+	require.NoError(t, err)
+	require.NotNil(t, u.FundPolicy)
+	assert.Equal(t, FundPolicyDonate, *u.FundPolicy)
+
+	require.NoError(t, db.UpdateFundPolicy(sponsor.Id, nil))
+	u, err = db.FindUserById(sponsor.Id)
+	require.NoError(t, err)
+	assert.Nil(t, u.FundPolicy)
+}
+
+func TestInsertOrUpdateContribution(t *testing.T) {
+	TruncateAll(db, t)
+
+	sponsor := createTestUser(t, db, "sponsor@example.com")
+	contributor := createTestUser(t, db, "contributor@example.com")
+	repo := createTestRepo(t, db, "https://github.com/test/repo")
+
+	day := time.Now().Truncate(24 * time.Hour)
+	require.NoError(t, db.InsertContribution(
+		sponsor.Id, contributor.Id, repo.Id, big.NewInt(1000), "USD", day, time.Now(), false))
+	require.NoError(t, db.InsertOrUpdateContribution(
+		sponsor.Id, contributor.Id, repo.Id, big.NewInt(500), "USD", day, time.Now(), false))
+
+	m, err := db.FindSumDailyContributors(contributor.Id)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(1500), m["USD"])
+}
+
+func TestExpireUnclaimed(t *testing.T) {
+	TruncateAll(db, t)
+
+	repo := createTestRepo(t, db, "https://github.com/test/repo")
+
+	cutoff := time.Now().AddDate(0, -3, 0).Truncate(24 * time.Hour)
+	require.NoError(t, db.InsertUnclaimed(uuid.New(), "old@example.com", repo.Id, big.NewInt(100), "USD", cutoff.AddDate(0, 0, -1), time.Now()))
+	require.NoError(t, db.InsertUnclaimed(uuid.New(), "new@example.com", repo.Id, big.NewInt(100), "USD", cutoff.AddDate(0, 0, 1), time.Now()))
+
+	nr, err := db.ExpireUnclaimed(cutoff, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), nr)
+
+	ms, err := db.FindMarketingEmails()
+	require.NoError(t, err)
+	require.Len(t, ms, 1)
+	assert.Equal(t, "new@example.com", ms[0].Email)
+}
+
+func TestFindExpiredUnclaimed(t *testing.T) {
+	TruncateAll(db, t)
+
+	sponsor := createTestUser(t, db, "sponsor@example.com")
+	repo := createTestRepo(t, db, "https://github.com/test/repo")
+	cutoff := time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, db.InsertContributionBatch(&ContributionBatch{Unclaimed: []BatchUnclaimed{
+		{UserSponsorId: sponsor.Id, Email: "a@example.com", RepoId: repo.Id, Balance: big.NewInt(100), Currency: "USD", Day: cutoff.AddDate(0, 0, -2), CreatedAt: time.Now()},
+		{UserSponsorId: sponsor.Id, Email: "b@example.com", RepoId: repo.Id, Balance: big.NewInt(50), Currency: "USD", Day: cutoff.AddDate(0, 0, -1), CreatedAt: time.Now()},
+		{UserSponsorId: sponsor.Id, Email: "a@example.com", RepoId: repo.Id, Balance: big.NewInt(70), Currency: "USD", Day: cutoff, CreatedAt: time.Now()},
+	}}))
+	//without a sponsor no policy applies
+	require.NoError(t, db.InsertUnclaimed(uuid.New(), "c@example.com", repo.Id, big.NewInt(30), "USD", cutoff.AddDate(0, 0, -1), time.Now()))
+
+	efs, err := db.FindExpiredUnclaimed(cutoff)
+	require.NoError(t, err)
+	require.Len(t, efs, 1)
+	assert.Equal(t, sponsor.Id, efs[0].UserSponsorId)
+	assert.Equal(t, repo.Id, efs[0].RepoId)
+	assert.Equal(t, "150", efs[0].Balance.String())
+
+	nr, err := db.ExpireUnclaimed(cutoff, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), nr)
+	efs, err = db.FindExpiredUnclaimed(cutoff)
+	require.NoError(t, err)
+	assert.Len(t, efs, 0)
+}
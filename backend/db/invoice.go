@@ -0,0 +1,206 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BillingProfile is what a sponsor wants to see on the invoices, all fields are optional
+type BillingProfile struct {
+	Company *string `json:"company"`
+	VatId   *string `json:"vatId"`
+	Address *string `json:"address"`
+	Country *string `json:"country"`
+}
+
+// Invoice is issued for every successful pay-in. The billing profile is copied, so changing the
+// profile later does not change invoices that were already sent.
+type Invoice struct {
+	Id               uuid.UUID  `json:"id"`
+	Nr               string     `json:"nr"`
+	PaymentInEventId uuid.UUID  `json:"paymentInEventId"`
+	ExternalId       uuid.UUID  `json:"externalId"`
+	UserId           *uuid.UUID `json:"userId"`
+	Email            string     `json:"email"`
+	BillingProfile
+	Currency  string    `json:"currency"`
+	Gross     *big.Int  `json:"gross"`
+	Fee       *big.Int  `json:"fee"`
+	Net       *big.Int  `json:"net"`
+	FeePrm    int64     `json:"feePrm"`
+	Seats     int64     `json:"seats"`
+	Freq      int64     `json:"freq"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (db *DB) FindBillingProfile(uid uuid.UUID) (*BillingProfile, error) {
+	var b BillingProfile
+	err := db.QueryRow(`
+		SELECT billing_company, billing_vat_id, billing_address, billing_country
+		FROM users
+		WHERE id=$1`, uid).
+		Scan(&b.Company, &b.VatId, &b.Address, &b.Country)
+
+	switch err {
+	case sql.ErrNoRows:
+		return nil, nil
+	case nil:
+		return &b, nil
+	default:
+		return nil, err
+	}
+}
+
+func (db *DB) UpdateBillingProfile(uid uuid.UUID, b BillingProfile) error {
+	_, err := db.Exec(`
+		UPDATE users SET billing_company=$1, billing_vat_id=$2, billing_address=$3, billing_country=$4
+		WHERE id=$5`,
+		b.Company, b.VatId, b.Address, b.Country, uid)
+	return err
+}
+
+// CreateInvoice issues the invoice for the successful pay-in with the external id. The numbers are
+// sequential per year without gaps, as the counter is updated in the same transaction. If the pay-in
+// has an invoice already, that one is returned, so webhooks can be retried.
+func (db *DB) CreateInvoice(externalId uuid.UUID, feePrm int64, now time.Time) (*Invoice, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	inv := Invoice{ExternalId: externalId, FeePrm: feePrm, CreatedAt: now}
+	var userId uuid.UUID
+	var net string
+	err = tx.QueryRow(`
+		SELECT id, user_id, balance, currency, seats, freq
+		FROM payment_in_event
+		WHERE external_id = $1 AND status = $2
+		FOR UPDATE`, externalId, PayInSuccess).
+		Scan(&inv.PaymentInEventId, &userId, &net, &inv.Currency, &inv.Seats, &inv.Freq)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("no successful payment for external_id: %v", externalId)
+	}
+	if err != nil {
+		return nil, err
+	}
+	inv.UserId = &userId
+
+	var id uuid.UUID
+	err = tx.QueryRow(`SELECT id FROM invoice WHERE payment_in_event_id = $1`, inv.PaymentInEventId).Scan(&id)
+	switch err {
+	case sql.ErrNoRows:
+	case nil:
+		return db.FindInvoiceById(id)
+	default:
+		return nil, err
+	}
+
+	var fee string
+	err = tx.QueryRow(`
+		SELECT COALESCE(SUM(balance), 0)
+		FROM payment_in_event
+		WHERE external_id = $1 AND status = $2`, externalId, PayInFee).Scan(&fee)
+	if err != nil {
+		return nil, err
+	}
+	var ok bool
+	if inv.Net, ok = new(big.Int).SetString(net, 10); !ok {
+		return nil, fmt.Errorf("not a big.int %v", net)
+	}
+	if inv.Fee, ok = new(big.Int).SetString(fee, 10); !ok {
+		return nil, fmt.Errorf("not a big.int %v", fee)
+	}
+	inv.Gross = new(big.Int).Add(inv.Net, inv.Fee)
+
+	err = tx.QueryRow(`
+		SELECT email, billing_company, billing_vat_id, billing_address, billing_country
+		FROM users
+		WHERE id = $1`, userId).
+		Scan(&inv.Email, &inv.Company, &inv.VatId, &inv.Address, &inv.Country)
+	if err != nil {
+		return nil, err
+	}
+
+	var nr int64
+	err = tx.QueryRow(`
+		INSERT INTO invoice_counter(year, nr) VALUES ($1, 1)
+		ON CONFLICT (year) DO UPDATE SET nr = invoice_counter.nr + 1
+		RETURNING nr`, now.Year()).Scan(&nr)
+	if err != nil {
+		return nil, err
+	}
+	inv.Id = uuid.New()
+	inv.Nr = fmt.Sprintf("%d-%06d", now.Year(), nr)
+
+	_, err = tx.Exec(`
+		INSERT INTO invoice(id, nr, payment_in_event_id, external_id, user_id, email, billing_company, billing_vat_id,
+		                    billing_address, billing_country, currency, gross, fee, net, fee_prm, seats, freq, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)`,
+		inv.Id, inv.Nr, inv.PaymentInEventId, inv.ExternalId, inv.UserId, inv.Email, inv.Company, inv.VatId,
+		inv.Address, inv.Country, inv.Currency, inv.Gross.String(), inv.Fee.String(), inv.Net.String(),
+		inv.FeePrm, inv.Seats, inv.Freq, inv.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &inv, tx.Commit()
+}
+
+const invoiceColumns = `id, nr, payment_in_event_id, external_id, user_id, email, billing_company, billing_vat_id,
+		       billing_address, billing_country, currency, gross, fee, net, fee_prm, seats, freq, created_at`
+
+func scanInvoice(row interface{ Scan(...any) error }) (*Invoice, error) {
+	var inv Invoice
+	var gross, fee, net string
+	err := row.Scan(&inv.Id, &inv.Nr, &inv.PaymentInEventId, &inv.ExternalId, &inv.UserId, &inv.Email,
+		&inv.Company, &inv.VatId, &inv.Address, &inv.Country, &inv.Currency, &gross, &fee, &net,
+		&inv.FeePrm, &inv.Seats, &inv.Freq, &inv.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	var ok bool
+	if inv.Gross, ok = new(big.Int).SetString(gross, 10); !ok {
+		return nil, fmt.Errorf("not a big.int %v", gross)
+	}
+	if inv.Fee, ok = new(big.Int).SetString(fee, 10); !ok {
+		return nil, fmt.Errorf("not a big.int %v", fee)
+	}
+	if inv.Net, ok = new(big.Int).SetString(net, 10); !ok {
+		return nil, fmt.Errorf("not a big.int %v", net)
+	}
+	return &inv, nil
+}
+
+func (db *DB) FindInvoiceById(id uuid.UUID) (*Invoice, error) {
+	inv, err := scanInvoice(db.QueryRow(`SELECT `+invoiceColumns+` FROM invoice WHERE id = $1`, id))
+	switch err {
+	case sql.ErrNoRows:
+		return nil, nil
+	case nil:
+		return inv, nil
+	default:
+		return nil, err
+	}
+}
+
+func (db *DB) FindInvoicesByUserId(uid uuid.UUID) ([]Invoice, error) {
+	rows, err := db.Query(`SELECT `+invoiceColumns+` FROM invoice WHERE user_id = $1 ORDER BY created_at DESC, nr DESC`, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	invs := []Invoice{}
+	for rows.Next() {
+		inv, err := scanInvoice(rows)
+		if err != nil {
+			return nil, err
+		}
+		invs = append(invs, *inv)
+	}
+	return invs, nil
+}
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func insertTestPayment(t *testing.T, userId uuid.UUID, balance int64) uuid.UUID {
+	externalId := uuid.New()
+	require.NoError(t, db.InsertPayInEvent(PayInEvent{
+		Id:         uuid.New(),
+		ExternalId: externalId,
+		UserId:     userId,
+		Balance:    big.NewInt(balance),
+		Currency:   "USD",
+		Status:     PayInRequest,
+		Seats:      1,
+		Freq:       365,
+		CreatedAt:  time.Now(),
+	}))
+	require.NoError(t, db.PaymentSuccess(externalId, big.NewInt(balance*40/1000+1), nil))
+	return externalId
+}
+
+func TestCreateInvoice(t *testing.T) {
+	TruncateAll(db, t)
+
+	sponsor := createTestUser(t, db, "sponsor@example.com")
+	company := "ACME Inc."
+	vatId := "CHE-123.456.789"
+	require.NoError(t, db.UpdateBillingProfile(sponsor.Id, BillingProfile{Company: &company, VatId: &vatId}))
+
+	e1 := insertTestPayment(t, sponsor.Id, 125470000)
+	e2 := insertTestPayment(t, sponsor.Id, 10310000)
+	now := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+
+	inv1, err := db.CreateInvoice(e1, 40, now)
+	require.NoError(t, err)
+	assert.Equal(t, "2026-000001", inv1.Nr)
+	assert.Equal(t, big.NewInt(125470000), inv1.Gross)
+	assert.Equal(t, big.NewInt(5018801), inv1.Fee)
+	assert.Equal(t, new(big.Int).Sub(inv1.Gross, inv1.Fee), inv1.Net)
+	assert.Equal(t, company, *inv1.Company)
+
+	//the profile changes, the invoice that was issued keeps the old one
+	other := "Other Ltd."
+	require.NoError(t, db.UpdateBillingProfile(sponsor.Id, BillingProfile{Company: &other}))
+	inv2, err := db.CreateInvoice(e2, 40, now)
+	require.NoError(t, err)
+	assert.Equal(t, "2026-000002", inv2.Nr)
+	assert.Equal(t, other, *inv2.Company)
+	assert.Nil(t, inv2.VatId)
+
+	//a retried webhook gets the same invoice
+	again, err := db.CreateInvoice(e1, 40, now)
+	require.NoError(t, err)
+	assert.Equal(t, inv1.Id, again.Id)
+	assert.Equal(t, "2026-000001", again.Nr)
+
+	invs, err := db.FindInvoicesByUserId(sponsor.Id)
+	require.NoError(t, err)
+	require.Len(t, invs, 2)
+	assert.Equal(t, inv2.Id, invs[0].Id)
+
+	_, err = db.CreateInvoice(uuid.New(), 40, now)
+	assert.Error(t, err)
+}
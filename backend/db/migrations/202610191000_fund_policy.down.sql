@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS fund_policy_event CASCADE;
+ALTER TABLE unclaimed DROP COLUMN IF EXISTS expired_at;
+ALTER TABLE users DROP COLUMN IF EXISTS fund_policy;
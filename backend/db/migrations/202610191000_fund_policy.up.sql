@@ -0,0 +1,20 @@
+-- Expiry policies for escrowed (future_contribution) and unclaimed funds
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS fund_policy VARCHAR(16);
+
+ALTER TABLE unclaimed ADD COLUMN IF NOT EXISTS expired_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS fund_policy_event (
+    id              UUID PRIMARY KEY,
+    user_sponsor_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    repo_id         UUID REFERENCES repo(id) ON DELETE CASCADE,
+    policy          VARCHAR(16) NOT NULL,
+    target_repo_id  UUID REFERENCES repo(id) ON DELETE SET NULL,
+    target_user_id  UUID REFERENCES users(id) ON DELETE SET NULL,
+    balance         NUMERIC(78),
+    currency        VARCHAR(8) NOT NULL,
+    day             DATE NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS fund_policy_event_user_sponsor_id_idx ON fund_policy_event(user_sponsor_id);
+CREATE INDEX IF NOT EXISTS fund_policy_event_repo_id_idx ON fund_policy_event(repo_id);
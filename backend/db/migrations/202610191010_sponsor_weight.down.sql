@@ -0,0 +1 @@
+DROP TABLE IF EXISTS sponsor_weight CASCADE;
@@ -0,0 +1,11 @@
+-- Per repo allocation weights of a sponsor in percent, repos without a weight share the rest equally
+
+CREATE TABLE IF NOT EXISTS sponsor_weight (
+    id         UUID PRIMARY KEY,
+    user_id    UUID REFERENCES users(id) ON DELETE CASCADE,
+    repo_id    UUID REFERENCES repo(id) ON DELETE CASCADE,
+    weight     INTEGER NOT NULL CHECK (weight > 0 AND weight <= 100),
+    created_at TIMESTAMPTZ NOT NULL,
+    UNIQUE(user_id, repo_id)
+);
+CREATE INDEX IF NOT EXISTS sponsor_weight_user_id_idx ON sponsor_weight(user_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS forward_contribution CASCADE;
+DROP TABLE IF EXISTS forward_rule CASCADE;
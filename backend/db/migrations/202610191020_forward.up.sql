@@ -0,0 +1,28 @@
+-- Contributors can forward a percentage of their earnings to a repo or to another user
+
+CREATE TABLE IF NOT EXISTS forward_rule (
+    id             UUID PRIMARY KEY,
+    user_id        UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    target_repo_id UUID REFERENCES repo(id) ON DELETE CASCADE,
+    target_user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    percent        INTEGER NOT NULL CHECK (percent > 0 AND percent <= 100),
+    created_at     TIMESTAMPTZ NOT NULL,
+    CHECK ((target_repo_id IS NULL) <> (target_user_id IS NULL))
+);
+CREATE INDEX IF NOT EXISTS forward_rule_user_id_idx ON forward_rule(user_id);
+
+CREATE TABLE IF NOT EXISTS forward_contribution (
+    id             UUID PRIMARY KEY,
+    user_from_id   UUID REFERENCES users(id) ON DELETE CASCADE,
+    user_to_id     UUID REFERENCES users(id) ON DELETE CASCADE,
+    repo_id        UUID REFERENCES repo(id) ON DELETE CASCADE,
+    target_repo_id UUID REFERENCES repo(id) ON DELETE CASCADE,
+    balance        NUMERIC(78),
+    currency       VARCHAR(8) NOT NULL,
+    day            DATE NOT NULL,
+    depth          INTEGER NOT NULL,
+    created_at     TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS forward_contribution_user_from_id_idx ON forward_contribution(user_from_id);
+CREATE INDEX IF NOT EXISTS forward_contribution_user_to_id_idx ON forward_contribution(user_to_id);
+CREATE INDEX IF NOT EXISTS forward_contribution_day_idx ON forward_contribution(day);
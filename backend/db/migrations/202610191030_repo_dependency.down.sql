@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS dependency_flow CASCADE;
+DROP TABLE IF EXISTS repo_dependency CASCADE;
@@ -0,0 +1,26 @@
+-- Dependencies of a repo from its manifest files, and how much of a sponsor's daily amount flowed to them
+
+CREATE TABLE IF NOT EXISTS repo_dependency (
+    id          UUID PRIMARY KEY,
+    repo_id     UUID NOT NULL REFERENCES repo(id) ON DELETE CASCADE,
+    ecosystem   VARCHAR(16) NOT NULL,
+    name        VARCHAR(255) NOT NULL,
+    dep_repo_id UUID REFERENCES repo(id) ON DELETE SET NULL,
+    created_at  TIMESTAMPTZ NOT NULL,
+    UNIQUE(repo_id, ecosystem, name)
+);
+CREATE INDEX IF NOT EXISTS repo_dependency_repo_id_idx ON repo_dependency(repo_id);
+
+CREATE TABLE IF NOT EXISTS dependency_flow (
+    id              UUID PRIMARY KEY,
+    user_sponsor_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    root_repo_id    UUID REFERENCES repo(id) ON DELETE CASCADE,
+    repo_id         UUID REFERENCES repo(id) ON DELETE CASCADE,
+    dep_repo_id     UUID REFERENCES repo(id) ON DELETE CASCADE,
+    depth           INTEGER NOT NULL,
+    balance         NUMERIC(78),
+    currency        VARCHAR(8) NOT NULL,
+    day             DATE NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS dependency_flow_user_sponsor_id_idx ON dependency_flow(user_sponsor_id);
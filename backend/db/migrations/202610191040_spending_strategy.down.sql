@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN IF EXISTS spending_order;
+ALTER TABLE users DROP COLUMN IF EXISTS spending_strategy;
@@ -0,0 +1,4 @@
+-- How a sponsor with balances in several currencies spends them, NULL uses the default of the deployment
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS spending_strategy VARCHAR(16);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS spending_order VARCHAR(255);
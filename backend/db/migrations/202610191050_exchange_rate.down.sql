@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN IF EXISTS display_currency;
+DROP TABLE IF EXISTS payout_request CASCADE;
+DROP TABLE IF EXISTS exchange_rate CASCADE;
@@ -0,0 +1,28 @@
+-- Daily exchange rates, one whole unit of currency_from is worth rate whole units of currency_to
+
+CREATE TABLE IF NOT EXISTS exchange_rate (
+    id            UUID PRIMARY KEY,
+    currency_from VARCHAR(8) NOT NULL,
+    currency_to   VARCHAR(8) NOT NULL,
+    rate          NUMERIC(38, 18) NOT NULL CHECK (rate > 0),
+    day           DATE NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL,
+    UNIQUE (currency_from, currency_to, day)
+);
+CREATE INDEX IF NOT EXISTS exchange_rate_day_idx ON exchange_rate(day);
+
+-- Every payout signature that was handed out, with the rate of the payout currency at that time
+CREATE TABLE IF NOT EXISTS payout_request (
+    id            UUID PRIMARY KEY,
+    user_id       UUID REFERENCES users(id) ON DELETE CASCADE,
+    batch_id      UUID,
+    currency      VARCHAR(8) NOT NULL,
+    amount        NUMERIC(78) NOT NULL,
+    exchange_rate NUMERIC(38, 18),
+    rate_currency VARCHAR(8) NOT NULL,
+    address       VARCHAR(255),
+    created_at    TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS payout_request_user_id_idx ON payout_request(user_id);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS display_currency VARCHAR(8);
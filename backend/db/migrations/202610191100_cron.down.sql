@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS cron_lease CASCADE;
+DROP TABLE IF EXISTS cron_run CASCADE;
+DROP TABLE IF EXISTS cron_job CASCADE;
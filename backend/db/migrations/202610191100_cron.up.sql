@@ -0,0 +1,25 @@
+-- State of the scheduled jobs, so a restart does not run them again and only one instance runs them
+
+CREATE TABLE IF NOT EXISTS cron_job (
+    name         VARCHAR(64) PRIMARY KEY,
+    schedule     VARCHAR(64) NOT NULL,
+    next_exec_at TIMESTAMPTZ NOT NULL,
+    updated_at   TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS cron_run (
+    id           UUID PRIMARY KEY,
+    name         VARCHAR(64) NOT NULL,
+    owner        VARCHAR(255) NOT NULL,
+    scheduled_at TIMESTAMPTZ NOT NULL,
+    started_at   TIMESTAMPTZ NOT NULL,
+    finished_at  TIMESTAMPTZ NOT NULL,
+    error        TEXT
+);
+CREATE INDEX IF NOT EXISTS cron_run_name_idx ON cron_run(name, scheduled_at);
+
+CREATE TABLE IF NOT EXISTS cron_lease (
+    name       VARCHAR(64) PRIMARY KEY,
+    owner      VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,24 @@
+ALTER TABLE unclaimed DROP CONSTRAINT IF EXISTS unclaimed_day_generation_key;
+ALTER TABLE future_contribution DROP CONSTRAINT IF EXISTS future_contribution_day_generation_key;
+ALTER TABLE daily_contribution DROP CONSTRAINT IF EXISTS daily_contribution_day_generation_key;
+
+-- compensating entries cannot be kept with the old constraints
+DELETE FROM unclaimed WHERE generation > 0;
+DELETE FROM future_contribution WHERE generation > 0;
+DELETE FROM daily_contribution WHERE generation > 0;
+DELETE FROM forward_contribution WHERE generation > 0;
+DELETE FROM dependency_flow WHERE generation > 0;
+
+ALTER TABLE daily_contribution ADD UNIQUE (user_sponsor_id, user_contributor_id, repo_id, day);
+ALTER TABLE future_contribution ADD UNIQUE (user_sponsor_id, repo_id, currency, day);
+ALTER TABLE unclaimed ADD UNIQUE (email, repo_id, currency, day);
+
+ALTER TABLE dependency_flow DROP COLUMN IF EXISTS generation;
+ALTER TABLE forward_contribution DROP COLUMN IF EXISTS generation;
+ALTER TABLE unclaimed DROP COLUMN IF EXISTS generation;
+ALTER TABLE future_contribution DROP COLUMN IF EXISTS generation;
+ALTER TABLE daily_contribution DROP COLUMN IF EXISTS generation;
+
+DROP FUNCTION IF EXISTS day_generation(DATE);
+DROP TABLE IF EXISTS distribution_event CASCADE;
+DROP TABLE IF EXISTS distribution_day CASCADE;
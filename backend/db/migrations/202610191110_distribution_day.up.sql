@@ -0,0 +1,49 @@
+-- Bookings of a day can be reversed with compensating entries and booked again. Every booking of a day
+-- gets its own generation, so the unique constraints only apply within one generation.
+
+CREATE TABLE IF NOT EXISTS distribution_day (
+    day        DATE PRIMARY KEY,
+    status     VARCHAR(16) NOT NULL,
+    generation INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS distribution_event (
+    id         UUID PRIMARY KEY,
+    day        DATE NOT NULL,
+    action     VARCHAR(16) NOT NULL,
+    generation INTEGER NOT NULL,
+    user_id    UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS distribution_event_day_idx ON distribution_event(day);
+
+CREATE OR REPLACE FUNCTION day_generation(d DATE) RETURNS INTEGER AS $$
+    SELECT COALESCE((SELECT generation FROM distribution_day WHERE day = d), 0)
+$$ LANGUAGE SQL STABLE;
+
+ALTER TABLE daily_contribution ADD COLUMN IF NOT EXISTS generation INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE future_contribution ADD COLUMN IF NOT EXISTS generation INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE unclaimed ADD COLUMN IF NOT EXISTS generation INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE forward_contribution ADD COLUMN IF NOT EXISTS generation INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE dependency_flow ADD COLUMN IF NOT EXISTS generation INTEGER NOT NULL DEFAULT 0;
+
+-- the unique constraints of the init script have generated names
+DO $$
+DECLARE
+    t TEXT;
+    c TEXT;
+BEGIN
+    FOREACH t IN ARRAY ARRAY['daily_contribution', 'future_contribution', 'unclaimed'] LOOP
+        FOR c IN SELECT conname FROM pg_constraint WHERE conrelid = t::regclass AND contype = 'u' LOOP
+            EXECUTE format('ALTER TABLE %I DROP CONSTRAINT %I', t, c);
+        END LOOP;
+    END LOOP;
+END $$;
+
+ALTER TABLE daily_contribution ADD CONSTRAINT daily_contribution_day_generation_key
+    UNIQUE (user_sponsor_id, user_contributor_id, repo_id, day, generation);
+ALTER TABLE future_contribution ADD CONSTRAINT future_contribution_day_generation_key
+    UNIQUE (user_sponsor_id, repo_id, currency, day, generation);
+ALTER TABLE unclaimed ADD CONSTRAINT unclaimed_day_generation_key
+    UNIQUE (email, repo_id, currency, day, generation);
@@ -0,0 +1,14 @@
+-- the archived rows are moved back without the trigger, the rollups are dropped anyway
+DROP TRIGGER IF EXISTS daily_contribution_rollup ON daily_contribution;
+DROP FUNCTION IF EXISTS rollup_daily_contribution();
+
+INSERT INTO daily_contribution(id, user_sponsor_id, user_contributor_id, repo_id, balance, currency, day, created_at,
+                               claimed_at, foundation_payment, generation)
+SELECT id, user_sponsor_id, user_contributor_id, repo_id, balance, currency, day, created_at,
+       claimed_at, foundation_payment, generation
+FROM daily_contribution_archive;
+
+DROP TABLE IF EXISTS contribution_archive;
+DROP TABLE IF EXISTS daily_contribution_archive;
+DROP TABLE IF EXISTS contribution_month_sponsor;
+DROP TABLE IF EXISTS contribution_month_contributor;
@@ -0,0 +1,88 @@
+-- Monthly sums of daily_contribution for the summaries, kept up to date by a trigger on every insert.
+-- Rows of daily_contribution are only deleted when they are archived, so the sums stay complete.
+
+CREATE TABLE IF NOT EXISTS contribution_month_contributor (
+    user_contributor_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    repo_id             UUID REFERENCES repo(id) ON DELETE CASCADE,
+    currency            VARCHAR(8) NOT NULL,
+    month               DATE NOT NULL,
+    balance             NUMERIC(78) NOT NULL,
+    nr                  INTEGER NOT NULL,
+    updated_at          TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_contributor_id, repo_id, currency, month)
+);
+CREATE INDEX IF NOT EXISTS contribution_month_contributor_repo_id_idx ON contribution_month_contributor(repo_id);
+
+CREATE TABLE IF NOT EXISTS contribution_month_sponsor (
+    user_sponsor_id    UUID REFERENCES users(id) ON DELETE CASCADE,
+    repo_id            UUID REFERENCES repo(id) ON DELETE CASCADE,
+    currency           VARCHAR(8) NOT NULL,
+    month              DATE NOT NULL,
+    foundation_payment BOOLEAN NOT NULL,
+    balance            NUMERIC(78) NOT NULL,
+    nr                 INTEGER NOT NULL,
+    first_created_at   TIMESTAMPTZ NOT NULL,
+    updated_at         TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_sponsor_id, repo_id, currency, month, foundation_payment)
+);
+
+CREATE OR REPLACE FUNCTION rollup_daily_contribution() RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO contribution_month_contributor(user_contributor_id, repo_id, currency, month, balance, nr, updated_at)
+    VALUES (NEW.user_contributor_id, NEW.repo_id, NEW.currency, date_trunc('month', NEW.day)::date, NEW.balance, 1, now())
+    ON CONFLICT (user_contributor_id, repo_id, currency, month) DO UPDATE
+        SET balance    = contribution_month_contributor.balance + EXCLUDED.balance,
+            nr         = contribution_month_contributor.nr + 1,
+            updated_at = EXCLUDED.updated_at;
+
+    INSERT INTO contribution_month_sponsor(user_sponsor_id, repo_id, currency, month, foundation_payment, balance, nr,
+                                           first_created_at, updated_at)
+    VALUES (NEW.user_sponsor_id, NEW.repo_id, NEW.currency, date_trunc('month', NEW.day)::date,
+            COALESCE(NEW.foundation_payment, FALSE), NEW.balance, 1, NEW.created_at, now())
+    ON CONFLICT (user_sponsor_id, repo_id, currency, month, foundation_payment) DO UPDATE
+        SET balance          = contribution_month_sponsor.balance + EXCLUDED.balance,
+            nr               = contribution_month_sponsor.nr + 1,
+            first_created_at = LEAST(contribution_month_sponsor.first_created_at, EXCLUDED.first_created_at),
+            updated_at       = EXCLUDED.updated_at;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER daily_contribution_rollup AFTER INSERT ON daily_contribution
+    FOR EACH ROW EXECUTE FUNCTION rollup_daily_contribution();
+
+INSERT INTO contribution_month_contributor(user_contributor_id, repo_id, currency, month, balance, nr, updated_at)
+SELECT user_contributor_id, repo_id, currency, date_trunc('month', day)::date, SUM(balance), COUNT(*), now()
+FROM daily_contribution
+GROUP BY user_contributor_id, repo_id, currency, date_trunc('month', day)::date;
+
+INSERT INTO contribution_month_sponsor(user_sponsor_id, repo_id, currency, month, foundation_payment, balance, nr,
+                                       first_created_at, updated_at)
+SELECT user_sponsor_id, repo_id, currency, date_trunc('month', day)::date, COALESCE(foundation_payment, FALSE),
+       SUM(balance), COUNT(*), MIN(created_at), now()
+FROM daily_contribution
+GROUP BY user_sponsor_id, repo_id, currency, date_trunc('month', day)::date, COALESCE(foundation_payment, FALSE);
+
+-- Old rows of daily_contribution are moved here by month. The table is partitioned by month, the
+-- partitions are created when a month is archived.
+CREATE TABLE IF NOT EXISTS daily_contribution_archive (
+    id                  UUID NOT NULL,
+    user_sponsor_id     UUID,
+    user_contributor_id UUID,
+    repo_id             UUID,
+    balance             NUMERIC(78),
+    currency            VARCHAR(8) NOT NULL,
+    day                 DATE NOT NULL,
+    created_at          TIMESTAMPTZ NOT NULL,
+    claimed_at          TIMESTAMPTZ,
+    foundation_payment  BOOLEAN,
+    generation          INTEGER NOT NULL,
+    archived_at         TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (id, day)
+) PARTITION BY RANGE (day);
+
+CREATE TABLE IF NOT EXISTS contribution_archive (
+    month       DATE PRIMARY KEY,
+    nr          INTEGER NOT NULL,
+    archived_at TIMESTAMPTZ NOT NULL
+);
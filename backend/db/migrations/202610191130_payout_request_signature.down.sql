@@ -0,0 +1 @@
+ALTER TABLE payout_request DROP COLUMN IF EXISTS signature;
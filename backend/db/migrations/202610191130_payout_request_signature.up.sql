@@ -0,0 +1,2 @@
+-- the signature a payout was requested with, so statements can show it
+ALTER TABLE payout_request ADD COLUMN IF NOT EXISTS signature TEXT;
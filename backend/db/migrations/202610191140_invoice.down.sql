@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS invoice CASCADE;
+DROP TABLE IF EXISTS invoice_counter CASCADE;
+ALTER TABLE users DROP COLUMN IF EXISTS billing_country;
+ALTER TABLE users DROP COLUMN IF EXISTS billing_address;
+ALTER TABLE users DROP COLUMN IF EXISTS billing_vat_id;
+ALTER TABLE users DROP COLUMN IF EXISTS billing_company;
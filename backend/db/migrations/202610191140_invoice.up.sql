@@ -0,0 +1,35 @@
+-- Billing profile of sponsors and invoices for successful pay-ins
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS billing_company VARCHAR(255);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS billing_vat_id VARCHAR(32);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS billing_address TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS billing_country VARCHAR(2);
+
+-- invoice numbers must not have gaps, a sequence would skip numbers on rollback, so the counter is
+-- a row per year that is updated in the transaction that creates the invoice
+CREATE TABLE IF NOT EXISTS invoice_counter (
+    year INTEGER PRIMARY KEY,
+    nr   BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS invoice (
+    id                  UUID PRIMARY KEY,
+    nr                  VARCHAR(16) UNIQUE NOT NULL,
+    payment_in_event_id UUID UNIQUE NOT NULL REFERENCES payment_in_event(id) ON DELETE RESTRICT,
+    external_id         UUID NOT NULL,
+    user_id             UUID REFERENCES users(id) ON DELETE SET NULL,
+    email               VARCHAR(64) NOT NULL,
+    billing_company     VARCHAR(255),
+    billing_vat_id      VARCHAR(32),
+    billing_address     TEXT,
+    billing_country     VARCHAR(2),
+    currency            VARCHAR(8) NOT NULL,
+    gross               NUMERIC(78) NOT NULL,
+    fee                 NUMERIC(78) NOT NULL,
+    net                 NUMERIC(78) NOT NULL,
+    fee_prm             BIGINT NOT NULL,
+    seats               INTEGER NOT NULL,
+    freq                INTEGER NOT NULL,
+    created_at          TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS invoice_user_id_idx ON invoice(user_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS organization_member CASCADE;
+DROP TABLE IF EXISTS organization CASCADE;
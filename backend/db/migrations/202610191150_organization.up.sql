@@ -0,0 +1,35 @@
+-- Organizations with members and a shared balance, replacing the team sponsoring through invite
+
+CREATE TABLE IF NOT EXISTS organization (
+    id         UUID PRIMARY KEY,
+    name       VARCHAR(255) NOT NULL,
+    payer_id   UUID NOT NULL REFERENCES users(id) ON DELETE RESTRICT,
+    created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS organization_payer_id_idx ON organization(payer_id);
+
+-- a user is in at most one organization, as the organization pays for the repos of its members
+CREATE TABLE IF NOT EXISTS organization_member (
+    organization_id UUID NOT NULL REFERENCES organization(id) ON DELETE CASCADE,
+    user_id         UUID UNIQUE NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role            VARCHAR(16) NOT NULL CHECK (role IN ('OWNER', 'BILLING', 'MEMBER')),
+    created_at      TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (organization_id, user_id)
+);
+
+-- every user who invited others and was not invited becomes the owner and payer of an organization,
+-- the invited users become its members. Invited users who invited others keep their invite, so they
+-- pay for their invitees as before.
+INSERT INTO organization(id, name, payer_id, created_at)
+SELECT gen_random_uuid(), COALESCE(NULLIF(i.name, ''), i.email), i.id, now()
+FROM users i
+WHERE i.invited_id IS NULL AND EXISTS (SELECT 1 FROM users u WHERE u.invited_id = i.id);
+
+INSERT INTO organization_member(organization_id, user_id, role, created_at)
+SELECT o.id, o.payer_id, 'OWNER', now() FROM organization o;
+
+INSERT INTO organization_member(organization_id, user_id, role, created_at)
+SELECT o.id, u.id, 'MEMBER', now()
+FROM users u
+    INNER JOIN organization o ON u.invited_id = o.payer_id
+ON CONFLICT (user_id) DO NOTHING;
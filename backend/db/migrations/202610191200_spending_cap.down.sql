@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS spending_cap CASCADE;
+ALTER TABLE users DROP COLUMN IF EXISTS spending_stop_at;
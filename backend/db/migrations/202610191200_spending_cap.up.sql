@@ -0,0 +1,13 @@
+-- Spending caps of sponsors and a date after which nothing is spent anymore
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS spending_stop_at DATE;
+
+CREATE TABLE IF NOT EXISTS spending_cap (
+    user_id            UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    currency           VARCHAR(8) NOT NULL,
+    daily_limit        NUMERIC(78),
+    monthly_limit      NUMERIC(78),
+    repo_monthly_limit NUMERIC(78),
+    updated_at         TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_id, currency)
+);
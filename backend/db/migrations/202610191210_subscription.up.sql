@@ -0,0 +1,20 @@
+-- Subscription of a sponsor that renews the balance with the stored card before it runs out
+
+CREATE TABLE IF NOT EXISTS subscription (
+    user_id     UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    status      VARCHAR(16) NOT NULL CHECK (status IN ('ACTIVE', 'PAST_DUE', 'GRACE', 'CANCELED')),
+    renew_at    TIMESTAMPTZ,
+    retries     INT NOT NULL DEFAULT 0,
+    grace_until TIMESTAMPTZ,
+    external_id UUID,
+    updated_at  TIMESTAMPTZ NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS subscription_renew_at_idx ON subscription(renew_at);
+
+-- sponsors with a stored card renewed with the top-up reminder so far
+INSERT INTO subscription(user_id, status, updated_at, created_at)
+SELECT id, 'ACTIVE', now(), now()
+FROM users
+WHERE stripe_id IS NOT NULL AND stripe_payment_method IS NOT NULL
+ON CONFLICT (user_id) DO NOTHING;
@@ -0,0 +1,15 @@
+-- Refunds and disputes of stripe payments, with what was clawed back from the allocations of the sponsor
+
+CREATE TABLE IF NOT EXISTS chargeback (
+    id          UUID PRIMARY KEY,
+    external_id UUID NOT NULL,
+    user_id     UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind        VARCHAR(16) NOT NULL,
+    balance     NUMERIC(78) NOT NULL,
+    clawed_back NUMERIC(78) NOT NULL,
+    unrecovered NUMERIC(78) NOT NULL,
+    currency    VARCHAR(8) NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS chargeback_user_id_idx ON chargeback(user_id);
+CREATE INDEX IF NOT EXISTS chargeback_created_at_idx ON chargeback(created_at);
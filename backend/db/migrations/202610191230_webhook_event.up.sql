@@ -0,0 +1,17 @@
+-- Inbox of the verified webhook deliveries of the payment providers, processed once per provider event id
+
+CREATE TABLE IF NOT EXISTS webhook_event (
+    id              UUID PRIMARY KEY,
+    provider        VARCHAR(16) NOT NULL,
+    event_id        VARCHAR(255) NOT NULL,
+    event_type      VARCHAR(64) NOT NULL,
+    payload         BYTEA NOT NULL,
+    status          VARCHAR(16) NOT NULL CHECK (status IN ('PENDING', 'PROCESSED', 'FAILED')),
+    attempts        INT NOT NULL DEFAULT 0,
+    last_error      TEXT,
+    next_attempt_at TIMESTAMPTZ NOT NULL,
+    processed_at    TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ NOT NULL,
+    UNIQUE (provider, event_id)
+);
+CREATE INDEX IF NOT EXISTS webhook_event_status_idx ON webhook_event(status, next_attempt_at);
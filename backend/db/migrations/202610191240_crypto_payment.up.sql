@@ -0,0 +1,14 @@
+-- Crypto payments of NOWPayments, so a partially paid payment can be completed on the same address
+
+CREATE TABLE IF NOT EXISTS crypto_payment (
+    external_id   UUID PRIMARY KEY,
+    user_id       UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    payment_id    VARCHAR(64) NOT NULL,
+    pay_address   VARCHAR(255) NOT NULL,
+    pay_currency  VARCHAR(16) NOT NULL,
+    pay_amount    NUMERIC(78) NOT NULL,
+    actually_paid NUMERIC(78) NOT NULL DEFAULT 0,
+    updated_at    TIMESTAMPTZ NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS crypto_payment_user_id_idx ON crypto_payment(user_id);
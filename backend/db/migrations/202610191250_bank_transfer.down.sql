@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS bank_statement_line CASCADE;
+DROP TABLE IF EXISTS bank_transfer CASCADE;
@@ -0,0 +1,28 @@
+-- Bank transfers of the sponsors, the reference of the transfer identifies the payment request
+
+CREATE TABLE IF NOT EXISTS bank_transfer (
+    reference   VARCHAR(32) PRIMARY KEY,
+    external_id UUID NOT NULL UNIQUE,
+    user_id     UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    balance     NUMERIC(78) NOT NULL,
+    currency    VARCHAR(16) NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS bank_transfer_user_id_idx ON bank_transfer(user_id);
+
+-- Credits of the imported bank statements, a line is imported once and matched to at most one transfer
+CREATE TABLE IF NOT EXISTS bank_statement_line (
+    id          UUID PRIMARY KEY,
+    line_id     VARCHAR(128) NOT NULL UNIQUE,
+    booked_at   DATE NOT NULL,
+    cents       BIGINT NOT NULL,
+    currency    VARCHAR(16) NOT NULL,
+    remittance  TEXT NOT NULL,
+    debtor      VARCHAR(255) NOT NULL,
+    status      VARCHAR(16) NOT NULL CHECK (status IN ('MATCHED', 'UNMATCHED', 'IGNORED')),
+    external_id UUID,
+    resolved_at TIMESTAMPTZ,
+    created_at  TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS bank_statement_line_status_idx ON bank_statement_line(status, created_at);
+CREATE UNIQUE INDEX IF NOT EXISTS bank_statement_line_external_id_idx ON bank_statement_line(external_id) WHERE status = 'MATCHED';
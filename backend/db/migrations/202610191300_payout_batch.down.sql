@@ -0,0 +1,8 @@
+UPDATE payout_request p SET amount = l.total
+FROM (SELECT id, SUM(amount) OVER (PARTITION BY user_id, currency ORDER BY created_at) AS total
+      FROM payout_request) AS l
+WHERE p.id = l.id;
+DROP INDEX IF EXISTS payout_request_status_idx;
+ALTER TABLE payout_request DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE payout_request DROP COLUMN IF EXISTS status;
+DROP TABLE IF EXISTS payout_batch CASCADE;
@@ -0,0 +1,28 @@
+-- Payouts are queued and signed in batches per currency and chain, a request tracks its batch until the
+-- transfer is confirmed. The requests signed before the queue are signed already.
+
+CREATE TABLE IF NOT EXISTS payout_batch (
+    id           UUID PRIMARY KEY,
+    currency     VARCHAR(8) NOT NULL,
+    chain        VARCHAR(16) NOT NULL,
+    status       VARCHAR(16) NOT NULL CHECK (status IN ('SIGNED', 'SUBMITTED', 'CONFIRMED')),
+    total        NUMERIC(78) NOT NULL,
+    requests     INT NOT NULL,
+    tx_hash      VARCHAR(255),
+    created_at   TIMESTAMPTZ NOT NULL,
+    submitted_at TIMESTAMPTZ,
+    confirmed_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS payout_batch_created_at_idx ON payout_batch(created_at);
+
+ALTER TABLE payout_request ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'REQUESTED'
+    CHECK (status IN ('REQUESTED', 'SIGNED', 'SUBMITTED', 'CONFIRMED'));
+ALTER TABLE payout_request ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ;
+UPDATE payout_request SET status = 'SIGNED' WHERE signature IS NOT NULL;
+CREATE INDEX IF NOT EXISTS payout_request_status_idx ON payout_request(status, currency);
+
+-- a request was the lifetime total, now it is what was added since the previous request
+UPDATE payout_request p SET amount = p.amount - l.prev
+FROM (SELECT id, LAG(amount) OVER (PARTITION BY user_id, currency ORDER BY created_at) AS prev
+      FROM payout_request) AS l
+WHERE p.id = l.id AND l.prev IS NOT NULL;
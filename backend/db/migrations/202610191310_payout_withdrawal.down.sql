@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS payout_withdrawal CASCADE;
+DROP INDEX IF EXISTS payout_request_owner_id_idx;
+ALTER TABLE payout_request DROP COLUMN IF EXISTS owner_id;
+DROP TABLE IF EXISTS chain_cursor CASCADE;
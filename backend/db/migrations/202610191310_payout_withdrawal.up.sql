@@ -0,0 +1,28 @@
+-- The withdrawals of the payout contracts are read from the chain, the cursor is the last block a watcher
+-- has read, so it resumes there after a restart.
+
+CREATE TABLE IF NOT EXISTS chain_cursor (
+    name       VARCHAR(64) PRIMARY KEY,
+    block      BIGINT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+-- the id the contract knows the user by, stored when the request is signed
+ALTER TABLE payout_request ADD COLUMN IF NOT EXISTS owner_id VARCHAR(255);
+CREATE INDEX IF NOT EXISTS payout_request_owner_id_idx ON payout_request(owner_id);
+
+CREATE TABLE IF NOT EXISTS payout_withdrawal (
+    tx_hash           VARCHAR(255) PRIMARY KEY,
+    chain             VARCHAR(16) NOT NULL,
+    currency          VARCHAR(8) NOT NULL,
+    block             BIGINT NOT NULL,
+    owner_id          VARCHAR(255) NOT NULL,
+    user_id           UUID REFERENCES users(id) ON DELETE SET NULL,
+    payout_request_id UUID REFERENCES payout_request(id) ON DELETE SET NULL,
+    address           VARCHAR(255) NOT NULL,
+    total             NUMERIC(78) NOT NULL,
+    amount            NUMERIC(78) NOT NULL,
+    created_at        TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS payout_withdrawal_user_id_idx ON payout_withdrawal(user_id);
+CREATE INDEX IF NOT EXISTS payout_withdrawal_owner_id_idx ON payout_withdrawal(owner_id, currency);
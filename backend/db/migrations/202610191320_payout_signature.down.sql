@@ -0,0 +1,2 @@
+ALTER TABLE payout_request DROP COLUMN IF EXISTS expires_at;
+ALTER TABLE payout_request DROP COLUMN IF EXISTS nonce;
@@ -0,0 +1,5 @@
+-- The payouts on Ethereum are signed as EIP-712 typed data with a nonce the contract accepts once and a
+-- deadline after which the signature is void, both are stored with the signature.
+
+ALTER TABLE payout_request ADD COLUMN IF NOT EXISTS nonce NUMERIC(78);
+ALTER TABLE payout_request ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS payout_address_default CASCADE;
+DROP TABLE IF EXISTS payout_address CASCADE;
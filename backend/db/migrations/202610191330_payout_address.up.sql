@@ -0,0 +1,26 @@
+-- The addresses a user pays out to. An address is registered with a challenge the user signs with its key,
+-- confirmed by email and can be paid out to from active_at, after a cooldown if the user had another
+-- address on the chain.
+
+CREATE TABLE IF NOT EXISTS payout_address (
+    id           UUID PRIMARY KEY,
+    user_id      UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    chain        VARCHAR(16) NOT NULL,
+    address      VARCHAR(255) NOT NULL,
+    message      TEXT NOT NULL,
+    token        VARCHAR(255),
+    verified_at  TIMESTAMPTZ,
+    confirmed_at TIMESTAMPTZ,
+    active_at    TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS payout_address_user_id_address_idx ON payout_address(user_id, chain, address);
+
+-- the address a currency is paid out to if the payout request names none
+CREATE TABLE IF NOT EXISTS payout_address_default (
+    user_id           UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    currency          VARCHAR(8) NOT NULL,
+    payout_address_id UUID NOT NULL REFERENCES payout_address(id) ON DELETE CASCADE,
+    updated_at        TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_id, currency)
+);
@@ -0,0 +1,3 @@
+ALTER TABLE daily_contribution DROP CONSTRAINT IF EXISTS daily_contribution_day_generation_key;
+ALTER TABLE daily_contribution ADD CONSTRAINT daily_contribution_day_generation_key
+    UNIQUE (user_sponsor_id, user_contributor_id, repo_id, day, generation);
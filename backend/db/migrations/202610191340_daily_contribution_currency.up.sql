@@ -0,0 +1,5 @@
+-- A sponsor can pay a contributor in several currencies on the same day, so the currency is part of the key.
+
+ALTER TABLE daily_contribution DROP CONSTRAINT IF EXISTS daily_contribution_day_generation_key;
+ALTER TABLE daily_contribution ADD CONSTRAINT daily_contribution_day_generation_key
+    UNIQUE (user_sponsor_id, user_contributor_id, repo_id, currency, day, generation);
@@ -0,0 +1,5 @@
+ALTER TABLE unclaimed DROP CONSTRAINT IF EXISTS unclaimed_day_generation_key;
+DROP INDEX IF EXISTS unclaimed_user_sponsor_id_idx;
+ALTER TABLE unclaimed DROP COLUMN IF EXISTS user_sponsor_id;
+ALTER TABLE unclaimed ADD CONSTRAINT unclaimed_day_generation_key
+    UNIQUE (email, repo_id, currency, day, generation);
@@ -0,0 +1,9 @@
+-- The share of a contributor who did not register yet is paid from the parked funds of the sponsor, the
+-- sponsor is stored with it, so the fund policy of the sponsor applies once it expires.
+
+ALTER TABLE unclaimed ADD COLUMN IF NOT EXISTS user_sponsor_id UUID REFERENCES users(id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS unclaimed_user_sponsor_id_idx ON unclaimed(user_sponsor_id);
+
+ALTER TABLE unclaimed DROP CONSTRAINT IF EXISTS unclaimed_day_generation_key;
+ALTER TABLE unclaimed ADD CONSTRAINT unclaimed_day_generation_key
+    UNIQUE (email, repo_id, user_sponsor_id, currency, day, generation);
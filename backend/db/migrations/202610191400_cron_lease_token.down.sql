@@ -0,0 +1 @@
+ALTER TABLE cron_lease DROP COLUMN IF EXISTS token;
@@ -0,0 +1,4 @@
+-- The fencing token of the lease changes with every new owner, a run is only recorded with the token of
+-- the current lease, so an instance that lost the lease during a long job cannot record it.
+
+ALTER TABLE cron_lease ADD COLUMN IF NOT EXISTS token BIGINT NOT NULL DEFAULT 0;
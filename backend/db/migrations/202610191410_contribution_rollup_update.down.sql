@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS daily_contribution_rollup_update ON daily_contribution;
+DROP FUNCTION IF EXISTS rollup_daily_contribution_update();
@@ -0,0 +1,24 @@
+-- A clawback of a chargeback adds to the row of daily_contribution of the booked day, the rollups follow
+-- the change of the balance, so they still match the daily rows when the month is archived.
+
+CREATE OR REPLACE FUNCTION rollup_daily_contribution_update() RETURNS TRIGGER AS $$
+BEGIN
+    UPDATE contribution_month_contributor
+    SET balance    = balance + NEW.balance - OLD.balance,
+        updated_at = now()
+    WHERE user_contributor_id = NEW.user_contributor_id AND repo_id = NEW.repo_id AND currency = NEW.currency
+      AND month = date_trunc('month', NEW.day)::date;
+
+    UPDATE contribution_month_sponsor
+    SET balance    = balance + NEW.balance - OLD.balance,
+        updated_at = now()
+    WHERE user_sponsor_id = NEW.user_sponsor_id AND repo_id = NEW.repo_id AND currency = NEW.currency
+      AND month = date_trunc('month', NEW.day)::date
+      AND foundation_payment = COALESCE(NEW.foundation_payment, FALSE);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER daily_contribution_rollup_update AFTER UPDATE OF balance ON daily_contribution
+    FOR EACH ROW WHEN (OLD.balance IS DISTINCT FROM NEW.balance)
+    EXECUTE FUNCTION rollup_daily_contribution_update();
@@ -0,0 +1,29 @@
+DROP TRIGGER IF EXISTS daily_contribution_rollup ON daily_contribution;
+
+CREATE OR REPLACE FUNCTION rollup_daily_contribution() RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO contribution_month_contributor(user_contributor_id, repo_id, currency, month, balance, nr, updated_at)
+    VALUES (NEW.user_contributor_id, NEW.repo_id, NEW.currency, date_trunc('month', NEW.day)::date, NEW.balance, 1, now())
+    ON CONFLICT (user_contributor_id, repo_id, currency, month) DO UPDATE
+        SET balance    = contribution_month_contributor.balance + EXCLUDED.balance,
+            nr         = contribution_month_contributor.nr + 1,
+            updated_at = EXCLUDED.updated_at;
+
+    INSERT INTO contribution_month_sponsor(user_sponsor_id, repo_id, currency, month, foundation_payment, balance, nr,
+                                           first_created_at, updated_at)
+    VALUES (NEW.user_sponsor_id, NEW.repo_id, NEW.currency, date_trunc('month', NEW.day)::date,
+            COALESCE(NEW.foundation_payment, FALSE), NEW.balance, 1, NEW.created_at, now())
+    ON CONFLICT (user_sponsor_id, repo_id, currency, month, foundation_payment) DO UPDATE
+        SET balance          = contribution_month_sponsor.balance + EXCLUDED.balance,
+            nr               = contribution_month_sponsor.nr + 1,
+            first_created_at = LEAST(contribution_month_sponsor.first_created_at, EXCLUDED.first_created_at),
+            updated_at       = EXCLUDED.updated_at;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER daily_contribution_rollup AFTER INSERT ON daily_contribution
+    FOR EACH ROW EXECUTE FUNCTION rollup_daily_contribution();
+
+ALTER TABLE contribution_month_sponsor DROP COLUMN IF EXISTS days;
+ALTER TABLE contribution_month_contributor DROP COLUMN IF EXISTS days;
@@ -0,0 +1,82 @@
+-- nr counts the rows of a month, which includes reversals, rebookings and clawbacks of a day. days counts
+-- the distinct days instead. The rollup runs once per statement, so a day is counted only if no other row
+-- of it exists before the statement, also if a batch inserts several rows of the same day.
+
+ALTER TABLE contribution_month_contributor ADD COLUMN IF NOT EXISTS days INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE contribution_month_sponsor ADD COLUMN IF NOT EXISTS days INTEGER NOT NULL DEFAULT 0;
+
+UPDATE contribution_month_contributor m SET days = s.days
+FROM (
+    SELECT user_contributor_id, repo_id, currency, date_trunc('month', day)::date AS month, COUNT(DISTINCT day) AS days
+    FROM (
+        SELECT user_contributor_id, repo_id, currency, day FROM daily_contribution
+        UNION ALL
+        SELECT user_contributor_id, repo_id, currency, day FROM daily_contribution_archive
+    ) AS x
+    GROUP BY user_contributor_id, repo_id, currency, date_trunc('month', day)::date
+) AS s
+WHERE m.user_contributor_id = s.user_contributor_id AND m.repo_id = s.repo_id AND m.currency = s.currency
+  AND m.month = s.month;
+
+UPDATE contribution_month_sponsor m SET days = s.days
+FROM (
+    SELECT user_sponsor_id, repo_id, currency, date_trunc('month', day)::date AS month,
+           COALESCE(foundation_payment, FALSE) AS foundation_payment, COUNT(DISTINCT day) AS days
+    FROM (
+        SELECT user_sponsor_id, repo_id, currency, day, foundation_payment FROM daily_contribution
+        UNION ALL
+        SELECT user_sponsor_id, repo_id, currency, day, foundation_payment FROM daily_contribution_archive
+    ) AS x
+    GROUP BY user_sponsor_id, repo_id, currency, date_trunc('month', day)::date, COALESCE(foundation_payment, FALSE)
+) AS s
+WHERE m.user_sponsor_id = s.user_sponsor_id AND m.repo_id = s.repo_id AND m.currency = s.currency
+  AND m.month = s.month AND m.foundation_payment = s.foundation_payment;
+
+DROP TRIGGER IF EXISTS daily_contribution_rollup ON daily_contribution;
+
+CREATE OR REPLACE FUNCTION rollup_daily_contribution() RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO contribution_month_contributor(user_contributor_id, repo_id, currency, month, balance, nr, days,
+                                               updated_at)
+    SELECT n.user_contributor_id, n.repo_id, n.currency, date_trunc('month', n.day)::date, SUM(n.balance), COUNT(*),
+           COUNT(DISTINCT n.day) FILTER (WHERE NOT EXISTS (
+               SELECT 1 FROM daily_contribution d
+               WHERE d.user_contributor_id = n.user_contributor_id AND d.repo_id = n.repo_id
+                 AND d.currency = n.currency AND d.day = n.day
+                 AND NOT EXISTS (SELECT 1 FROM new_rows o WHERE o.id = d.id))),
+           now()
+    FROM new_rows n
+    GROUP BY n.user_contributor_id, n.repo_id, n.currency, date_trunc('month', n.day)::date
+    ON CONFLICT (user_contributor_id, repo_id, currency, month) DO UPDATE
+        SET balance    = contribution_month_contributor.balance + EXCLUDED.balance,
+            nr         = contribution_month_contributor.nr + EXCLUDED.nr,
+            days       = contribution_month_contributor.days + EXCLUDED.days,
+            updated_at = EXCLUDED.updated_at;
+
+    INSERT INTO contribution_month_sponsor(user_sponsor_id, repo_id, currency, month, foundation_payment, balance, nr,
+                                           days, first_created_at, updated_at)
+    SELECT n.user_sponsor_id, n.repo_id, n.currency, date_trunc('month', n.day)::date,
+           COALESCE(n.foundation_payment, FALSE), SUM(n.balance), COUNT(*),
+           COUNT(DISTINCT n.day) FILTER (WHERE NOT EXISTS (
+               SELECT 1 FROM daily_contribution d
+               WHERE d.user_sponsor_id = n.user_sponsor_id AND d.repo_id = n.repo_id
+                 AND d.currency = n.currency AND d.day = n.day
+                 AND COALESCE(d.foundation_payment, FALSE) = COALESCE(n.foundation_payment, FALSE)
+                 AND NOT EXISTS (SELECT 1 FROM new_rows o WHERE o.id = d.id))),
+           MIN(n.created_at), now()
+    FROM new_rows n
+    GROUP BY n.user_sponsor_id, n.repo_id, n.currency, date_trunc('month', n.day)::date,
+             COALESCE(n.foundation_payment, FALSE)
+    ON CONFLICT (user_sponsor_id, repo_id, currency, month, foundation_payment) DO UPDATE
+        SET balance          = contribution_month_sponsor.balance + EXCLUDED.balance,
+            nr               = contribution_month_sponsor.nr + EXCLUDED.nr,
+            days             = contribution_month_sponsor.days + EXCLUDED.days,
+            first_created_at = LEAST(contribution_month_sponsor.first_created_at, EXCLUDED.first_created_at),
+            updated_at       = EXCLUDED.updated_at;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER daily_contribution_rollup AFTER INSERT ON daily_contribution
+    REFERENCING NEW TABLE AS new_rows
+    FOR EACH STATEMENT EXECUTE FUNCTION rollup_daily_contribution();
@@ -0,0 +1 @@
+-- the balances and the prorated freqs of the rewritten events are not kept, there is nothing to revert
@@ -0,0 +1,14 @@
+-- Partially paid events were a copy of the payment request with its full balance, and they were not
+-- credited. They are credited now, so the ones without a crypto payment, which were written before the
+-- paid amount was tracked, are set to nothing credited so far. A payment that finished later is credited
+-- with its success event only.
+
+UPDATE payment_in_event e SET balance = 0
+WHERE e.status = 'PARTIALLY'
+  AND NOT EXISTS (SELECT 1 FROM crypto_payment c WHERE c.external_id = e.external_id);
+
+-- the credited events keep the freq of the plan, a prorated freq has no plan to renew with
+UPDATE payment_in_event e SET freq = r.freq
+FROM payment_in_event r
+WHERE r.external_id = e.external_id AND r.status = 'REQUEST'
+  AND e.status IN ('PARTIALLY', 'SUCCESS', 'FEE') AND e.freq <> r.freq;
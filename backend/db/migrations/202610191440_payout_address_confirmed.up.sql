@@ -0,0 +1,16 @@
+-- The chains a user ever confirmed a payout address on. A deleted address does not reset it, so an
+-- address added after deleting the old one waits for the cooldown as well.
+
+CREATE TABLE IF NOT EXISTS payout_address_confirmed (
+    user_id      UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    chain        VARCHAR(16) NOT NULL,
+    confirmed_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_id, chain)
+);
+
+INSERT INTO payout_address_confirmed(user_id, chain, confirmed_at)
+SELECT user_id, chain, MIN(confirmed_at)
+FROM payout_address
+WHERE confirmed_at IS NOT NULL
+GROUP BY user_id, chain
+ON CONFLICT DO NOTHING;
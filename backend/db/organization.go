@@ -0,0 +1,251 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	OrgRoleOwner   = "OWNER"
+	OrgRoleBilling = "BILLING"
+	OrgRoleMember  = "MEMBER"
+)
+
+var OrgRoles = []string{OrgRoleOwner, OrgRoleBilling, OrgRoleMember}
+
+// Organization sponsors with the balance of its payer, who is an owner or a billing member. The repos
+// the members select are rolled up into one daily distribution of the organization.
+type Organization struct {
+	Id        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	PayerId   uuid.UUID `json:"payerId"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type OrganizationMember struct {
+	OrganizationId uuid.UUID `json:"organizationId"`
+	UserId         uuid.UUID `json:"userId"`
+	Email          string    `json:"email"`
+	Name           *string   `json:"name"`
+	Role           string    `json:"role"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// OrganizationRepo is what the organization spent on a repo, and how many members selected it
+type OrganizationRepo struct {
+	RepoId   uuid.UUID `json:"repoId"`
+	RepoName string    `json:"repoName"`
+	Currency string    `json:"currency"`
+	Balance  *big.Int  `json:"balance"`
+	Members  int       `json:"members"`
+}
+
+func IsValidOrgRole(role string) bool {
+	for _, r := range OrgRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// InsertOrganization creates the organization with its payer as the first owner
+func (db *DB) InsertOrganization(o Organization) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO organization(id, name, payer_id, created_at)
+		VALUES ($1, $2, $3, $4)`, o.Id, o.Name, o.PayerId, o.CreatedAt)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO organization_member(organization_id, user_id, role, created_at)
+		VALUES ($1, $2, $3, $4)`, o.Id, o.PayerId, OrgRoleOwner, o.CreatedAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (db *DB) FindOrganizationById(id uuid.UUID) (*Organization, error) {
+	var o Organization
+	err := db.QueryRow(`
+		SELECT id, name, payer_id, created_at
+		FROM organization
+		WHERE id = $1`, id).
+		Scan(&o.Id, &o.Name, &o.PayerId, &o.CreatedAt)
+
+	switch err {
+	case sql.ErrNoRows:
+		return nil, nil
+	case nil:
+		return &o, nil
+	default:
+		return nil, err
+	}
+}
+
+// FindOrganizationMember returns the membership of the user, or nil if the user is in no organization
+func (db *DB) FindOrganizationMember(userId uuid.UUID) (*OrganizationMember, error) {
+	var m OrganizationMember
+	err := db.QueryRow(`
+		SELECT m.organization_id, m.user_id, u.email, u.name, m.role, m.created_at
+		FROM organization_member m
+		    INNER JOIN users u ON m.user_id = u.id
+		WHERE m.user_id = $1`, userId).
+		Scan(&m.OrganizationId, &m.UserId, &m.Email, &m.Name, &m.Role, &m.CreatedAt)
+
+	switch err {
+	case sql.ErrNoRows:
+		return nil, nil
+	case nil:
+		return &m, nil
+	default:
+		return nil, err
+	}
+}
+
+func (db *DB) FindOrganizationMembers(orgId uuid.UUID) ([]OrganizationMember, error) {
+	rows, err := db.Query(`
+		SELECT m.organization_id, m.user_id, u.email, u.name, m.role, m.created_at
+		FROM organization_member m
+		    INNER JOIN users u ON m.user_id = u.id
+		WHERE m.organization_id = $1
+		ORDER BY m.created_at, u.email`, orgId)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	ms := []OrganizationMember{}
+	for rows.Next() {
+		var m OrganizationMember
+		err = rows.Scan(&m.OrganizationId, &m.UserId, &m.Email, &m.Name, &m.Role, &m.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+	return ms, nil
+}
+
+// InsertOrganizationMember adds the user to the organization. A user who is a member of another
+// organization moves, unless the user owns it.
+func (db *DB) InsertOrganizationMember(orgId uuid.UUID, userId uuid.UUID, role string, createdAt time.Time) error {
+	res, err := db.Exec(`
+		INSERT INTO organization_member(organization_id, user_id, role, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE SET organization_id = EXCLUDED.organization_id, role = EXCLUDED.role,
+		                                    created_at = EXCLUDED.created_at
+		WHERE organization_member.role <> $5 OR organization_member.organization_id = EXCLUDED.organization_id`,
+		orgId, userId, role, createdAt, OrgRoleOwner)
+	if err != nil {
+		return err
+	}
+	nr, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if nr == 0 {
+		return fmt.Errorf("user %v owns another organization", userId)
+	}
+	return nil
+}
+
+func (db *DB) UpdateOrganizationMemberRole(orgId uuid.UUID, userId uuid.UUID, role string) error {
+	_, err := db.Exec(`
+		UPDATE organization_member SET role = $1
+		WHERE organization_id = $2 AND user_id = $3`, role, orgId, userId)
+	return err
+}
+
+func (db *DB) DeleteOrganizationMember(orgId uuid.UUID, userId uuid.UUID) error {
+	_, err := db.Exec(`
+		DELETE FROM organization_member
+		WHERE organization_id = $1 AND user_id = $2`, orgId, userId)
+	return err
+}
+
+func (db *DB) UpdateOrganizationPayer(orgId uuid.UUID, payerId uuid.UUID) error {
+	_, err := db.Exec(`UPDATE organization SET payer_id = $1 WHERE id = $2`, payerId, orgId)
+	return err
+}
+
+// FindOrganizationPayers returns for the users that pay for an organization the id of the organization
+func (db *DB) FindOrganizationPayers(userIds []uuid.UUID) (map[uuid.UUID]uuid.UUID, error) {
+	rows, err := db.Query(`
+		SELECT payer_id, id
+		FROM organization
+		WHERE payer_id = ANY($1)`, pq.Array(userIds))
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	m := map[uuid.UUID]uuid.UUID{}
+	for rows.Next() {
+		var payerId, orgId uuid.UUID
+		err = rows.Scan(&payerId, &orgId)
+		if err != nil {
+			return nil, err
+		}
+		m[payerId] = orgId
+	}
+	return m, nil
+}
+
+// FindOrganizationRepos sums what the members of the organization spent per repo and currency, with
+// the number of members that sponsor the repo now
+func (db *DB) FindOrganizationRepos(orgId uuid.UUID, now time.Time) ([]OrganizationRepo, error) {
+	rows, err := db.Query(`
+		WITH members AS (
+		    SELECT user_id FROM organization_member WHERE organization_id = $1
+		), spent AS (
+		    SELECT s.repo_id, s.currency, SUM(s.balance) AS balance
+		    FROM contribution_month_sponsor s
+		    WHERE s.user_sponsor_id IN (SELECT user_id FROM members) AND s.foundation_payment = FALSE
+		    GROUP BY s.repo_id, s.currency
+		), selected AS (
+		    SELECT e.repo_id, COUNT(DISTINCT e.user_id) AS nr
+		    FROM sponsor_event e
+		    WHERE e.user_id IN (SELECT user_id FROM members)
+		      AND e.sponsor_at <= $2 AND (e.un_sponsor_at IS NULL OR e.un_sponsor_at > $2)
+		    GROUP BY e.repo_id
+		)
+		SELECT r.id, r.name, COALESCE(sp.currency, ''), COALESCE(sp.balance, 0), COALESCE(se.nr, 0)
+		FROM spent sp
+		    FULL JOIN selected se ON sp.repo_id = se.repo_id
+		    INNER JOIN repo r ON r.id = COALESCE(sp.repo_id, se.repo_id)
+		ORDER BY r.name, sp.currency`, orgId, now)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	ors := []OrganizationRepo{}
+	for rows.Next() {
+		var or OrganizationRepo
+		var b string
+		err = rows.Scan(&or.RepoId, &or.RepoName, &or.Currency, &b, &or.Members)
+		if err != nil {
+			return nil, err
+		}
+		b1, ok := new(big.Int).SetString(b, 10)
+		if !ok {
+			return nil, fmt.Errorf("not a big.int %v", b)
+		}
+		or.Balance = b1
+		ors = append(ors, or)
+	}
+	return ors, nil
+}
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrganizationMembers(t *testing.T) {
+	TruncateAll(db, t)
+
+	owner := createTestUser(t, db, "owner@example.com")
+	member := createTestUser(t, db, "member@example.com")
+	other := createTestUser(t, db, "other@example.com")
+
+	o := Organization{Id: uuid.New(), Name: "ACME", PayerId: owner.Id, CreatedAt: time.Now()}
+	require.NoError(t, db.InsertOrganization(o))
+	require.NoError(t, db.InsertOrganizationMember(o.Id, member.Id, OrgRoleMember, time.Now()))
+
+	m, err := db.FindOrganizationMember(owner.Id)
+	require.NoError(t, err)
+	require.NotNil(t, m)
+	assert.Equal(t, OrgRoleOwner, m.Role)
+	m, err = db.FindOrganizationMember(other.Id)
+	require.NoError(t, err)
+	assert.Nil(t, m)
+
+	ms, err := db.FindOrganizationMembers(o.Id)
+	require.NoError(t, err)
+	assert.Len(t, ms, 2)
+
+	payers, err := db.FindPayerIds([]uuid.UUID{owner.Id, member.Id, other.Id})
+	require.NoError(t, err)
+	assert.Equal(t, owner.Id, payers[member.Id])
+	assert.Equal(t, owner.Id, payers[owner.Id])
+	assert.Equal(t, other.Id, payers[other.Id])
+
+	orgIds, err := db.FindOrganizationPayers([]uuid.UUID{owner.Id, other.Id})
+	require.NoError(t, err)
+	assert.Equal(t, map[uuid.UUID]uuid.UUID{owner.Id: o.Id}, orgIds)
+
+	//the owner of another organization cannot be moved, a member can
+	o2 := Organization{Id: uuid.New(), Name: "Other", PayerId: other.Id, CreatedAt: time.Now()}
+	require.NoError(t, db.InsertOrganization(o2))
+	assert.Error(t, db.InsertOrganizationMember(o.Id, other.Id, OrgRoleMember, time.Now()))
+	require.NoError(t, db.InsertOrganizationMember(o2.Id, member.Id, OrgRoleBilling, time.Now()))
+	m, err = db.FindOrganizationMember(member.Id)
+	require.NoError(t, err)
+	assert.Equal(t, o2.Id, m.OrganizationId)
+	assert.Equal(t, OrgRoleBilling, m.Role)
+
+	require.NoError(t, db.UpdateOrganizationPayer(o2.Id, member.Id))
+	payers, err = db.FindPayerIds([]uuid.UUID{other.Id})
+	require.NoError(t, err)
+	assert.Equal(t, member.Id, payers[other.Id])
+
+	require.NoError(t, db.DeleteOrganizationMember(o.Id, owner.Id))
+	payers, err = db.FindPayerIds([]uuid.UUID{owner.Id})
+	require.NoError(t, err)
+	assert.Equal(t, owner.Id, payers[owner.Id])
+}
+
+func TestFindOrganizationRepos(t *testing.T) {
+	TruncateAll(db, t)
+
+	owner := createTestUser(t, db, "owner@example.com")
+	member := createTestUser(t, db, "member@example.com")
+	contributor := createTestUser(t, db, "contributor@example.com")
+	repo1 := createTestRepo(t, db, "https://github.com/test/repo1")
+	repo2 := createTestRepo(t, db, "https://github.com/test/repo2")
+
+	o := Organization{Id: uuid.New(), Name: "ACME", PayerId: owner.Id, CreatedAt: time.Now()}
+	require.NoError(t, db.InsertOrganization(o))
+	require.NoError(t, db.InsertOrganizationMember(o.Id, member.Id, OrgRoleMember, time.Now()))
+
+	sponsorAt := time.Now().Add(-time.Hour)
+	for _, s := range []struct{ uid, rid uuid.UUID }{{owner.Id, repo1.Id}, {member.Id, repo1.Id}, {member.Id, repo2.Id}} {
+		require.NoError(t, db.InsertOrUpdateSponsor(&SponsorEvent{
+			Id: uuid.New(), Uid: s.uid, RepoId: s.rid, EventType: Active, SponsorAt: &sponsorAt,
+		}))
+	}
+	day := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, db.InsertContribution(owner.Id, contributor.Id, repo1.Id, big.NewInt(300), "USD", day, time.Now(), false))
+
+	ors, err := db.FindOrganizationRepos(o.Id, time.Now())
+	require.NoError(t, err)
+	require.Len(t, ors, 2)
+	m := map[uuid.UUID]OrganizationRepo{}
+	for _, or := range ors {
+		m[or.RepoId] = or
+	}
+	assert.Equal(t, 2, m[repo1.Id].Members)
+	assert.Equal(t, big.NewInt(300), m[repo1.Id].Balance)
+	assert.Equal(t, "USD", m[repo1.Id].Currency)
+	assert.Equal(t, 1, m[repo2.Id].Members)
+	assert.Equal(t, big.NewInt(0), m[repo2.Id].Balance)
+}
@@ -22,8 +22,24 @@ const (
 	PayInExpired   = "EXPIRED"
 	PayInFailed    = "FAILED"
 	PayInRefunded  = "REFUNDED"
+	//a refund or dispute of a successful payment, with a negative balance. A won dispute gives it back.
+	PayInRefund     = "CHARGE_REFUND"
+	PayInDispute    = "DISPUTE"
+	PayInDisputeWon = "DISPUTE_WON"
 )
 
+// PayInBalanceStatuses are the events the balance of a user is summed from
+var PayInBalanceStatuses = []string{PayInSuccess, PayInPartially, PayInRefund, PayInDispute, PayInDisputeWon}
+
+// payInStatuses returns the statuses that are summed for the status, a partially paid crypto payment is
+// credited with what was paid so far
+func payInStatuses(status string) []string {
+	if status == PayInSuccess {
+		return []string{PayInSuccess, PayInPartially}
+	}
+	return []string{status}
+}
+
 type PayInEvent struct {
 	Id         uuid.UUID `json:"id"`
 	ExternalId uuid.UUID `json:"externalId"`
@@ -58,6 +74,34 @@ func (db *DB) InsertPayInEvent(payInEvent PayInEvent) error {
 	return err
 }
 
+// BookPayInEvent inserts the event of a payment provider and marks its inbox event processed with it
+func (db *DB) BookPayInEvent(payInEvent PayInEvent, in *Inbox) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = processInbox(tx, in)
+	if err != nil {
+		return err
+	}
+	err = insertPayInEvent(tx, payInEvent)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertPayInEvent(tx *sql.Tx, payInEvent PayInEvent) error {
+	_, err := tx.Exec(`
+		INSERT INTO payment_in_event(id, external_id, user_id, balance, currency, status, seats, freq, created_at)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		payInEvent.Id, payInEvent.ExternalId, payInEvent.UserId, payInEvent.Balance.String(),
+		payInEvent.Currency, payInEvent.Status, payInEvent.Seats, payInEvent.Freq, payInEvent.CreatedAt)
+	return err
+}
+
 func (db *DB) FindPayInUser(userId uuid.UUID) ([]PayInEvent, error) {
 	rows, err := db.Query(`
 		SELECT balance, currency, status, seats, freq, created_at
@@ -115,8 +159,8 @@ func (db *DB) FindSumPaymentByCurrency(userId uuid.UUID, status string) (map[str
 	rows, err := db.Query(`
 		SELECT currency, COALESCE(sum(balance), 0)
 		FROM payment_in_event
-		WHERE user_id = $1 AND status = $2
-		GROUP BY currency`, userId, status)
+		WHERE user_id = $1 AND status = ANY($2)
+		GROUP BY currency`, userId, pq.Array(payInStatuses(status)))
 
 	if err != nil {
 		return nil, err
@@ -144,12 +188,53 @@ func (db *DB) FindSumPaymentByCurrency(userId uuid.UUID, status string) (map[str
 	return m, nil
 }
 
+// FindPayInBalanceByCurrency sums the successful payments of the user minus the refunds and disputes
+func (db *DB) FindPayInBalanceByCurrency(userId uuid.UUID) (map[string]*big.Int, error) {
+	rows, err := db.Query(`
+		SELECT currency, COALESCE(sum(balance), 0)
+		FROM payment_in_event
+		WHERE user_id = $1 AND status = ANY($2)
+		GROUP BY currency`, userId, pq.Array(PayInBalanceStatuses))
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	m := make(map[string]*big.Int)
+	for rows.Next() {
+		var c, b string
+		err = rows.Scan(&c, &b)
+		if err != nil {
+			return nil, err
+		}
+		b1, ok := new(big.Int).SetString(b, 10)
+		if !ok {
+			return nil, fmt.Errorf("not a big.int %v", b)
+		}
+		m[c] = b1
+	}
+	return m, nil
+}
+
+// UpsertPayInEvent stores an event that the provider reports in total, e.g. the refunded amount of a
+// payment or the amount paid so far of a crypto payment, so a later report replaces the previous one.
+func (db *DB) UpsertPayInEvent(payInEvent PayInEvent) error {
+	_, err := db.Exec(`
+		INSERT INTO payment_in_event(id, external_id, user_id, balance, currency, status, seats, freq, created_at)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (status, external_id) DO UPDATE SET balance = EXCLUDED.balance, freq = EXCLUDED.freq,
+		                                                created_at = EXCLUDED.created_at`,
+		payInEvent.Id, payInEvent.ExternalId, payInEvent.UserId, payInEvent.Balance.String(),
+		payInEvent.Currency, payInEvent.Status, payInEvent.Seats, payInEvent.Freq, payInEvent.CreatedAt)
+	return err
+}
+
 func (db *DB) FindSumPaymentByCurrencyWithDate(userId uuid.UUID, status string) (map[string]*PaymentInfo, error) {
 	rows, err := db.Query(`
 		SELECT currency, COALESCE(sum(balance * seats), 0), MIN(created_at)
 		FROM payment_in_event
-		WHERE user_id = $1 AND status = $2
-		GROUP BY currency`, userId, status)
+		WHERE user_id = $1 AND status = ANY($2)
+		GROUP BY currency`, userId, pq.Array(payInStatuses(status)))
 	if err != nil {
 		return nil, err
 	}
@@ -244,17 +329,24 @@ func (db *DB) FindSumPaymentFromFoundation(userId uuid.UUID, status string, curr
 	return balance, nil
 }
 
+// FindLatestDailyPayment returns the daily spending of the last payment, with the seats and the freq of
+// its plan. The daily spending is what the whole payment is worth divided by its days, for a partially
+// paid crypto payment that is the requested balance, once it is paid, the partial credit and the rest.
 func (db *DB) FindLatestDailyPayment(userId uuid.UUID, currency string) (*big.Int, int64, int64, *time.Time, error) {
 	var d string
 	var seats int64
 	var freq int64
 	var c time.Time
 	err := db.QueryRow(`
-		SELECT balance, seats, freq, created_at
-		FROM payment_in_event
-		WHERE user_id = $1 AND currency = $2 AND status = $3
-		ORDER BY created_at DESC
-		LIMIT 1`, userId, currency, PayInSuccess).
+		SELECT CASE WHEN e.status = $4 THEN COALESCE(r.balance, e.balance)
+		            ELSE e.balance + COALESCE(p.balance, 0) END,
+		       e.seats, e.freq, e.created_at
+		FROM payment_in_event e
+		    LEFT JOIN payment_in_event r ON r.external_id = e.external_id AND r.status = $5
+		    LEFT JOIN payment_in_event p ON p.external_id = e.external_id AND p.status = $4
+		WHERE e.user_id = $1 AND e.currency = $2 AND e.status = ANY($3) AND e.balance > 0
+		ORDER BY e.created_at DESC
+		LIMIT 1`, userId, currency, pq.Array(payInStatuses(PayInSuccess)), PayInPartially, PayInRequest).
 		Scan(&d, &seats, &freq, &c)
 
 	switch err {
@@ -286,7 +378,32 @@ func (db *DB) FindLatestDailyPayment(userId uuid.UUID, currency string) (*big.In
 	}
 }
 
-func (db *DB) PaymentSuccess(externalId uuid.UUID, fee *big.Int) error {
+// FindLatestPayInCurrency returns the currency of the last pay-in of the user, nil if the user never paid in
+func (db *DB) FindLatestPayInCurrency(userId uuid.UUID) (*string, error) {
+	var currency string
+	err := db.QueryRow(`
+		SELECT currency
+		FROM payment_in_event
+		WHERE user_id = $1 AND status = ANY($2) AND balance > 0
+		ORDER BY created_at DESC
+		LIMIT 1`, userId, pq.Array(payInStatuses(PayInSuccess))).
+		Scan(&currency)
+
+	switch err {
+	case sql.ErrNoRows:
+		return nil, nil
+	case nil:
+		return &currency, nil
+	default:
+		return nil, err
+	}
+}
+
+// PaymentSuccess books the payment request as paid. What was credited already for a partially paid
+// crypto payment is not credited again. The event keeps the freq of the plan, so the subscription can be
+// renewed with it. The payment and its fee are booked in one transaction, with the inbox event if there
+// is one.
+func (db *DB) PaymentSuccess(externalId uuid.UUID, fee *big.Int, in *Inbox) error {
 	payInEvent, err := db.FindPayInExternal(externalId, PayInRequest)
 	if err != nil {
 		return err
@@ -294,11 +411,29 @@ func (db *DB) PaymentSuccess(externalId uuid.UUID, fee *big.Int) error {
 	if payInEvent == nil {
 		return fmt.Errorf("payment request not found for external_id: %v", externalId)
 	}
+	partial, err := db.FindPayInExternal(externalId, PayInPartially)
+	if err != nil {
+		return err
+	}
 
 	payInEvent.Id = uuid.New()
 	payInEvent.Status = PayInSuccess
 	payInEvent.Balance = new(big.Int).Sub(payInEvent.Balance, fee)
-	err = db.InsertPayInEvent(*payInEvent)
+	if partial != nil {
+		payInEvent.Balance = new(big.Int).Sub(payInEvent.Balance, partial.Balance)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = processInbox(tx, in)
+	if err != nil {
+		return err
+	}
+	err = insertPayInEvent(tx, *payInEvent)
 	if err != nil {
 		return err
 	}
@@ -307,7 +442,64 @@ func (db *DB) PaymentSuccess(externalId uuid.UUID, fee *big.Int) error {
 	payInEvent.Id = uuid.New()
 	payInEvent.Status = PayInFee
 	payInEvent.Balance = fee
-	return db.InsertPayInEvent(*payInEvent)
+	err = insertPayInEvent(tx, *payInEvent)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PaymentPartial credits what was paid so far of a crypto payment request. The event keeps the freq of
+// the plan, FindLatestDailyPayment spends it at the daily amount of the full payment. The crypto paid so
+// far is stored with it. It returns false if the amount was credited already.
+func (db *DB) PaymentPartial(externalId uuid.UUID, credited *big.Int, actuallyPaid *big.Int, now time.Time, in *Inbox) (bool, error) {
+	payInEvent, err := db.FindPayInExternal(externalId, PayInRequest)
+	if err != nil {
+		return false, err
+	}
+	if payInEvent == nil {
+		return false, fmt.Errorf("payment request not found for external_id: %v", externalId)
+	}
+	partial, err := db.FindPayInExternal(externalId, PayInPartially)
+	if err != nil {
+		return false, err
+	}
+	if partial != nil && partial.Balance.Cmp(credited) >= 0 {
+		return false, nil
+	}
+
+	payInEvent.Id = uuid.New()
+	payInEvent.Status = PayInPartially
+	payInEvent.Balance = credited
+	payInEvent.CreatedAt = now
+
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	err = processInbox(tx, in)
+	if err != nil {
+		return false, err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO payment_in_event(id, external_id, user_id, balance, currency, status, seats, freq, created_at)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (status, external_id) DO UPDATE SET balance = EXCLUDED.balance, freq = EXCLUDED.freq,
+		                                                created_at = EXCLUDED.created_at`,
+		payInEvent.Id, payInEvent.ExternalId, payInEvent.UserId, payInEvent.Balance.String(),
+		payInEvent.Currency, payInEvent.Status, payInEvent.Seats, payInEvent.Freq, payInEvent.CreatedAt)
+	if err != nil {
+		return false, err
+	}
+	_, err = tx.Exec(`
+		UPDATE crypto_payment SET actually_paid = GREATEST(actually_paid, $2), updated_at = $3
+		WHERE external_id = $1`, externalId, actuallyPaid.String(), now)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
 }
 
 func (db *DB) sumTotalEarnedAmountForContributionIds(contributionIds []uuid.UUID) (*big.Int, error) {
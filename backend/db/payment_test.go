@@ -152,6 +152,58 @@ func TestFindSumPaymentByCurrency(t *testing.T) {
 	assert.Equal(t, big.NewInt(2000), balances["EUR"])
 }
 
+func TestPaymentPartialThenSuccess(t *testing.T) {
+	TruncateAll(db, t)
+
+	user := createTestUser(t, db, "payment@example.com")
+	request := PayInEvent{
+		Id:         uuid.New(),
+		ExternalId: uuid.New(),
+		UserId:     user.Id,
+		Balance:    big.NewInt(36500),
+		Currency:   "USD",
+		Status:     PayInRequest,
+		Seats:      1,
+		Freq:       365,
+		CreatedAt:  time.Now(),
+	}
+	require.NoError(t, db.InsertPayInEvent(request))
+
+	ok, err := db.PaymentPartial(request.ExternalId, big.NewInt(10000), big.NewInt(0), time.Now(), nil)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	//the same notification again, and a later one with more paid
+	ok, err = db.PaymentPartial(request.ExternalId, big.NewInt(10000), big.NewInt(0), time.Now(), nil)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = db.PaymentPartial(request.ExternalId, big.NewInt(18250), big.NewInt(0), time.Now(), nil)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	balances, err := db.FindSumPaymentByCurrency(user.Id, PayInSuccess)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(18250), balances["USD"])
+	//half of the payment is spent at the daily amount of the whole, with the freq of the plan
+	daily, _, freq, _, err := db.FindLatestDailyPayment(user.Id, "USD")
+	require.NoError(t, err)
+	assert.Equal(t, int64(365), freq)
+	assert.Equal(t, big.NewInt(100), daily)
+
+	//the rest is paid, the partial credit is not credited twice
+	require.NoError(t, db.PaymentSuccess(request.ExternalId, big.NewInt(0), nil))
+	balances, err = db.FindSumPaymentByCurrency(user.Id, PayInSuccess)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(36500), balances["USD"])
+	m, err := db.FindPayInBalanceByCurrency(user.Id)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(36500), m["USD"])
+	//the success of the rest renews with the plan and spends the same daily amount
+	daily, _, freq, _, err = db.FindLatestDailyPayment(user.Id, "USD")
+	require.NoError(t, err)
+	assert.Equal(t, int64(365), freq)
+	assert.Equal(t, big.NewInt(100), daily)
+}
+
 func TestFindSumPaymentByCurrency_NoCurrency(t *testing.T) {
 	TruncateAll(db, t)
 
@@ -323,6 +375,34 @@ func TestFindLatestDailyPayment_NotFound(t *testing.T) {
 	assert.Nil(t, createdAt)
 }
 
+func TestFindLatestPayInCurrency(t *testing.T) {
+	TruncateAll(db, t)
+
+	user := createTestUser(t, db, "payment@example.com")
+	currency, err := db.FindLatestPayInCurrency(user.Id)
+	require.NoError(t, err)
+	assert.Nil(t, currency)
+
+	for i, c := range []string{"USD", "EUR"} {
+		require.NoError(t, db.InsertPayInEvent(PayInEvent{
+			Id:         uuid.New(),
+			ExternalId: uuid.New(),
+			UserId:     user.Id,
+			Balance:    big.NewInt(3000),
+			Currency:   c,
+			Status:     PayInSuccess,
+			Seats:      1,
+			Freq:       30,
+			CreatedAt:  time.Now().AddDate(0, 0, i-5),
+		}))
+	}
+
+	currency, err = db.FindLatestPayInCurrency(user.Id)
+	require.NoError(t, err)
+	require.NotNil(t, currency)
+	assert.Equal(t, "EUR", *currency)
+}
+
 func TestPaymentSuccess(t *testing.T) {
 	TruncateAll(db, t)
 
@@ -343,7 +423,7 @@ func TestPaymentSuccess(t *testing.T) {
 	require.NoError(t, db.InsertPayInEvent(requestEvent))
 
 	fee := big.NewInt(500)
-	err := db.PaymentSuccess(externalId, fee)
+	err := db.PaymentSuccess(externalId, fee, nil)
 	require.NoError(t, err)
 
 	successEvent, err := db.FindPayInExternal(externalId, PayInSuccess)
@@ -360,7 +440,7 @@ func TestPaymentSuccess(t *testing.T) {
 func TestPaymentSuccess_RequestNotFound(t *testing.T) {
 	TruncateAll(db, t)
 
-	err := db.PaymentSuccess(uuid.New(), big.NewInt(100))
+	err := db.PaymentSuccess(uuid.New(), big.NewInt(100), nil)
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "payment request not found")
 }
\ No newline at end of file
@@ -0,0 +1,261 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	PayoutRequested = "REQUESTED"
+	PayoutSigned    = "SIGNED"
+	PayoutSubmitted = "SUBMITTED"
+	PayoutConfirmed = "CONFIRMED"
+)
+
+// PayoutBatch are the signed payout requests of a currency that are paid out with one transaction
+type PayoutBatch struct {
+	Id          uuid.UUID  `json:"id"`
+	Currency    string     `json:"currency"`
+	Chain       string     `json:"chain"`
+	Status      string     `json:"status"`
+	Total       *big.Int   `json:"total"`
+	Requests    int        `json:"requests"`
+	TxHash      *string    `json:"txHash,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	SubmittedAt *time.Time `json:"submittedAt,omitempty"`
+	ConfirmedAt *time.Time `json:"confirmedAt,omitempty"`
+}
+
+// RequestPayout queues a payout of what the user earned in the currency since the last request, and
+// claims the contributions of the user, so they are neither requested again nor clawed back. It returns
+// nil if there is nothing to pay out. The user is locked, so two requests do not pay out the same.
+func (db *DB) RequestPayout(p PayoutRequest, earned *big.Int, now time.Time) (*PayoutRequest, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`SELECT id FROM users WHERE id = $1 FOR UPDATE`, p.UserId)
+	if err != nil {
+		return nil, err
+	}
+	var r string
+	err = tx.QueryRow(`
+		SELECT COALESCE(SUM(amount), 0) FROM payout_request
+		WHERE user_id = $1 AND currency = $2`, p.UserId, p.Currency).Scan(&r)
+	if err != nil {
+		return nil, err
+	}
+	requested, ok := new(big.Int).SetString(r, 10)
+	if !ok {
+		return nil, fmt.Errorf("not a big.int %v", r)
+	}
+	p.Amount = new(big.Int).Sub(earned, requested)
+	if p.Amount.Sign() <= 0 {
+		return nil, nil
+	}
+
+	var rate *string
+	if p.ExchangeRate != nil {
+		s := p.ExchangeRate.Text('f', 18)
+		rate = &s
+	}
+	p.Status = PayoutRequested
+	p.CreatedAt = now
+	_, err = tx.Exec(`
+		INSERT INTO payout_request(id, user_id, currency, amount, exchange_rate, rate_currency, address, status,
+		                           created_at)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		p.Id, p.UserId, p.Currency, p.Amount.String(), rate, p.RateCurrency, p.Address, p.Status, p.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, table := range []string{"daily_contribution", "daily_contribution_archive"} {
+		_, err = tx.Exec(`
+			UPDATE `+table+` SET claimed_at = $3
+			WHERE user_contributor_id = $1 AND currency = $2 AND claimed_at IS NULL AND created_at <= $3`,
+			p.UserId, p.Currency, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &p, tx.Commit()
+}
+
+// FindPayoutTotal returns what was requested in the currency up to the time, the contracts pay out the
+// difference of the signed total to what they paid out before
+func (db *DB) FindPayoutTotal(userId uuid.UUID, currency string, until time.Time) (*big.Int, error) {
+	var t string
+	err := db.QueryRow(`
+		SELECT COALESCE(SUM(amount), 0) FROM payout_request
+		WHERE user_id = $1 AND currency = $2 AND created_at <= $3`, userId, currency, until).Scan(&t)
+	if err != nil {
+		return nil, err
+	}
+	t1, ok := new(big.Int).SetString(t, 10)
+	if !ok {
+		return nil, fmt.Errorf("not a big.int %v", t)
+	}
+	return t1, nil
+}
+
+// FindPayoutRequests returns the oldest requests with the status, of all currencies if it is empty
+func (db *DB) FindPayoutRequests(status string, currency string, limit int) ([]PayoutRequest, error) {
+	return db.findPayoutRequests(`
+		SELECT id, user_id, batch_id, currency, amount, exchange_rate, rate_currency, COALESCE(address, ''),
+		       COALESCE(signature, ''), COALESCE(owner_id, ''), nonce, expires_at, status, updated_at,
+		       created_at
+		FROM payout_request
+		WHERE status = $1 AND ($2 = '' OR currency = $2)
+		ORDER BY created_at
+		LIMIT $3`, status, currency, limit)
+}
+
+func (db *DB) FindPayoutRequestsByBatch(batchId uuid.UUID) ([]PayoutRequest, error) {
+	return db.findPayoutRequests(`
+		SELECT id, user_id, batch_id, currency, amount, exchange_rate, rate_currency, COALESCE(address, ''),
+		       COALESCE(signature, ''), COALESCE(owner_id, ''), nonce, expires_at, status, updated_at,
+		       created_at
+		FROM payout_request
+		WHERE batch_id = $1
+		ORDER BY created_at`, batchId)
+}
+
+// InsertPayoutBatch stores the batch and the signatures of its requests. If a request is in another batch
+// already, nothing is stored.
+func (db *DB) InsertPayoutBatch(b PayoutBatch, ps []PayoutRequest) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO payout_batch(id, currency, chain, status, total, requests, created_at)
+		VALUES($1, $2, $3, $4, $5, $6, $7)`,
+		b.Id, b.Currency, b.Chain, PayoutSigned, b.Total.String(), b.Requests, b.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range ps {
+		var nonce *string
+		if p.Nonce != nil {
+			n := p.Nonce.String()
+			nonce = &n
+		}
+		res, err := tx.Exec(`
+			UPDATE payout_request SET batch_id = $2, signature = $3, owner_id = $4, nonce = $5, expires_at = $6,
+			                          status = $7, updated_at = $8
+			WHERE id = $1 AND status = $9`,
+			p.Id, b.Id, p.Signature, p.OwnerId, nonce, p.ExpiresAt, PayoutSigned, b.CreatedAt, PayoutRequested)
+		if err != nil {
+			return err
+		}
+		nr, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if nr != 1 {
+			return fmt.Errorf("payout request %v is not requested anymore", p.Id)
+		}
+	}
+	return tx.Commit()
+}
+
+func (db *DB) FindPayoutBatch(id uuid.UUID) (*PayoutBatch, error) {
+	var b PayoutBatch
+	var t string
+	err := db.QueryRow(`
+		SELECT id, currency, chain, status, total, requests, tx_hash, created_at, submitted_at, confirmed_at
+		FROM payout_batch
+		WHERE id = $1`, id).
+		Scan(&b.Id, &b.Currency, &b.Chain, &b.Status, &t, &b.Requests, &b.TxHash, &b.CreatedAt, &b.SubmittedAt,
+			&b.ConfirmedAt)
+
+	switch err {
+	case sql.ErrNoRows:
+		return nil, nil
+	case nil:
+		t1, ok := new(big.Int).SetString(t, 10)
+		if !ok {
+			return nil, fmt.Errorf("not a big.int %v", t)
+		}
+		b.Total = t1
+		return &b, nil
+	default:
+		return nil, err
+	}
+}
+
+// FindPayoutBatches returns the latest batches
+func (db *DB) FindPayoutBatches(limit int) ([]PayoutBatch, error) {
+	rows, err := db.Query(`
+		SELECT id, currency, chain, status, total, requests, tx_hash, created_at, submitted_at, confirmed_at
+		FROM payout_batch
+		ORDER BY created_at DESC
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	bs := []PayoutBatch{}
+	for rows.Next() {
+		var b PayoutBatch
+		var t string
+		err = rows.Scan(&b.Id, &b.Currency, &b.Chain, &b.Status, &t, &b.Requests, &b.TxHash, &b.CreatedAt,
+			&b.SubmittedAt, &b.ConfirmedAt)
+		if err != nil {
+			return nil, err
+		}
+		t1, ok := new(big.Int).SetString(t, 10)
+		if !ok {
+			return nil, fmt.Errorf("not a big.int %v", t)
+		}
+		b.Total = t1
+		bs = append(bs, b)
+	}
+	return bs, nil
+}
+
+// UpdatePayoutBatchStatus moves the batch and its requests from one status to the next, it returns false
+// if the batch is not in the status from. The transaction hash is stored when the batch is submitted.
+func (db *DB) UpdatePayoutBatchStatus(id uuid.UUID, from string, to string, txHash *string, now time.Time) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		UPDATE payout_batch SET status = $3, tx_hash = COALESCE($4, tx_hash),
+		       submitted_at = CASE WHEN $3 = $6 THEN $5 ELSE submitted_at END,
+		       confirmed_at = CASE WHEN $3 = $7 THEN $5 ELSE confirmed_at END
+		WHERE id = $1 AND status = $2`,
+		id, from, to, txHash, now, PayoutSubmitted, PayoutConfirmed)
+	if err != nil {
+		return false, err
+	}
+	nr, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if nr != 1 {
+		return false, nil
+	}
+
+	_, err = tx.Exec(`
+		UPDATE payout_request SET status = $2, updated_at = $3
+		WHERE batch_id = $1`, id, to, now)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
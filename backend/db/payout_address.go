@@ -0,0 +1,254 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// PayoutAddress is an address of a user on a chain. It is verified once the user signed the challenge
+// message with the key of the address, confirmed by email and can be paid out to from ActiveAt. Currencies
+// are the currencies it is the default address of.
+type PayoutAddress struct {
+	Id          uuid.UUID  `json:"id"`
+	UserId      uuid.UUID  `json:"userId"`
+	Chain       string     `json:"chain"`
+	Address     string     `json:"address"`
+	Message     string     `json:"message"`
+	Currencies  []string   `json:"currencies"`
+	VerifiedAt  *time.Time `json:"verifiedAt,omitempty"`
+	ConfirmedAt *time.Time `json:"confirmedAt,omitempty"`
+	ActiveAt    *time.Time `json:"activeAt,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+// Active returns true if the address can be paid out to
+func (a *PayoutAddress) Active(now time.Time) bool {
+	return a.ActiveAt != nil && !a.ActiveAt.After(now)
+}
+
+// InsertPayoutAddressChallenge stores the challenge of an address. A new challenge of an address that is
+// not verified yet replaces the old one and keeps its id. It returns nil if the address is verified already.
+func (db *DB) InsertPayoutAddressChallenge(a PayoutAddress) (*PayoutAddress, error) {
+	err := db.QueryRow(`
+		INSERT INTO payout_address(id, user_id, chain, address, message, created_at)
+		VALUES($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, chain, address) DO UPDATE SET message = $5, created_at = $6
+		WHERE payout_address.verified_at IS NULL
+		RETURNING id`, a.Id, a.UserId, a.Chain, a.Address, a.Message, a.CreatedAt).Scan(&a.Id)
+	switch err {
+	case sql.ErrNoRows:
+		return nil, nil
+	case nil:
+		a.Currencies = []string{}
+		return &a, nil
+	default:
+		return nil, err
+	}
+}
+
+// VerifyPayoutAddress marks the address as verified and stores the token of the confirmation email, it
+// returns false if it is verified already
+func (db *DB) VerifyPayoutAddress(id uuid.UUID, token string, now time.Time) (bool, error) {
+	res, err := db.Exec(`
+		UPDATE payout_address SET verified_at = $2, token = $3
+		WHERE id = $1 AND verified_at IS NULL`, id, token, now)
+	if err != nil {
+		return false, err
+	}
+	nr, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return nr == 1, nil
+}
+
+// ConfirmPayoutAddress confirms a verified address of the user with the token of the email. The address is
+// active at once if the user never confirmed an address on the chain before, after the cooldown otherwise,
+// even if the old address was deleted, so a changed address cannot be paid out to right away. It becomes
+// the default of the currencies that have none. It returns nil if the token does not match.
+func (db *DB) ConfirmPayoutAddress(userId uuid.UUID, id uuid.UUID, token string, currencies []string,
+	cooldown time.Duration, now time.Time) (*time.Time, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var chain string
+	err = tx.QueryRow(`
+		SELECT chain FROM payout_address
+		WHERE id = $1 AND user_id = $2 AND token = $3 AND verified_at IS NOT NULL AND confirmed_at IS NULL
+		FOR UPDATE`, id, userId, token).Scan(&chain)
+	switch err {
+	case sql.ErrNoRows:
+		return nil, nil
+	case nil:
+	default:
+		return nil, err
+	}
+
+	res, err := tx.Exec(`
+		INSERT INTO payout_address_confirmed(user_id, chain, confirmed_at)
+		VALUES($1, $2, $3)
+		ON CONFLICT (user_id, chain) DO NOTHING`, userId, chain, now)
+	if err != nil {
+		return nil, err
+	}
+	nr, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	activeAt := now
+	if nr == 0 {
+		activeAt = now.Add(cooldown)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE payout_address SET token = NULL, confirmed_at = $2, active_at = $3
+		WHERE id = $1`, id, now, activeAt)
+	if err != nil {
+		return nil, err
+	}
+	for _, currency := range currencies {
+		_, err = tx.Exec(`
+			INSERT INTO payout_address_default(user_id, currency, payout_address_id, updated_at)
+			VALUES($1, $2, $3, $4)
+			ON CONFLICT (user_id, currency) DO NOTHING`, userId, currency, id, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &activeAt, tx.Commit()
+}
+
+// UpdatePayoutAddressDefault makes the address the default of the currency, the caller checks that it is
+// confirmed and on the chain of the currency. A changed default moves the payouts to another address, so
+// the address cannot be paid out to before the cooldown, for none of its currencies. It returns when the
+// address is active, nil if it is the default already.
+func (db *DB) UpdatePayoutAddressDefault(userId uuid.UUID, currency string, id uuid.UUID, cooldown time.Duration,
+	now time.Time) (*time.Time, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var current uuid.UUID
+	err = tx.QueryRow(`
+		SELECT payout_address_id FROM payout_address_default
+		WHERE user_id = $1 AND currency = $2
+		FOR UPDATE`, userId, currency).Scan(&current)
+	switch err {
+	case sql.ErrNoRows:
+	case nil:
+		if current == id {
+			return nil, nil
+		}
+	default:
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO payout_address_default(user_id, currency, payout_address_id, updated_at)
+		VALUES($1, $2, $3, $4)
+		ON CONFLICT (user_id, currency) DO UPDATE SET payout_address_id = $3, updated_at = $4`,
+		userId, currency, id, now)
+	if err != nil {
+		return nil, err
+	}
+	var activeAt time.Time
+	err = tx.QueryRow(`
+		UPDATE payout_address SET active_at = GREATEST(active_at, $2)
+		WHERE id = $1
+		RETURNING active_at`, id, now.Add(cooldown)).Scan(&activeAt)
+	if err != nil {
+		return nil, err
+	}
+	return &activeAt, tx.Commit()
+}
+
+// DeletePayoutAddress removes the address and its defaults, it returns false if the user has no such address.
+// The chain stays in payout_address_confirmed, so the next address waits for the cooldown.
+func (db *DB) DeletePayoutAddress(userId uuid.UUID, id uuid.UUID) (bool, error) {
+	res, err := db.Exec(`DELETE FROM payout_address WHERE id = $1 AND user_id = $2`, id, userId)
+	if err != nil {
+		return false, err
+	}
+	nr, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return nr == 1, nil
+}
+
+func (db *DB) FindPayoutAddress(id uuid.UUID) (*PayoutAddress, error) {
+	return db.findPayoutAddress(`
+		SELECT a.id, a.user_id, a.chain, a.address, a.message,
+		       ARRAY(SELECT d.currency FROM payout_address_default d WHERE d.payout_address_id = a.id ORDER BY d.currency),
+		       a.verified_at, a.confirmed_at, a.active_at, a.created_at
+		FROM payout_address a
+		WHERE a.id = $1`, id)
+}
+
+func (db *DB) FindPayoutAddressByAddress(userId uuid.UUID, chain string, address string) (*PayoutAddress, error) {
+	return db.findPayoutAddress(`
+		SELECT a.id, a.user_id, a.chain, a.address, a.message,
+		       ARRAY(SELECT d.currency FROM payout_address_default d WHERE d.payout_address_id = a.id ORDER BY d.currency),
+		       a.verified_at, a.confirmed_at, a.active_at, a.created_at
+		FROM payout_address a
+		WHERE a.user_id = $1 AND a.chain = $2 AND a.address = $3`, userId, chain, address)
+}
+
+// FindDefaultPayoutAddress returns the address the currency is paid out to, nil if the user has none
+func (db *DB) FindDefaultPayoutAddress(userId uuid.UUID, currency string) (*PayoutAddress, error) {
+	return db.findPayoutAddress(`
+		SELECT a.id, a.user_id, a.chain, a.address, a.message,
+		       ARRAY(SELECT d.currency FROM payout_address_default d WHERE d.payout_address_id = a.id ORDER BY d.currency),
+		       a.verified_at, a.confirmed_at, a.active_at, a.created_at
+		FROM payout_address a
+		JOIN payout_address_default d ON d.payout_address_id = a.id
+		WHERE d.user_id = $1 AND d.currency = $2`, userId, currency)
+}
+
+func (db *DB) FindPayoutAddressesByUserId(userId uuid.UUID) ([]PayoutAddress, error) {
+	rows, err := db.Query(`
+		SELECT a.id, a.user_id, a.chain, a.address, a.message,
+		       ARRAY(SELECT d.currency FROM payout_address_default d WHERE d.payout_address_id = a.id ORDER BY d.currency),
+		       a.verified_at, a.confirmed_at, a.active_at, a.created_at
+		FROM payout_address a
+		WHERE a.user_id = $1
+		ORDER BY a.created_at`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	as := []PayoutAddress{}
+	for rows.Next() {
+		var a PayoutAddress
+		err = rows.Scan(&a.Id, &a.UserId, &a.Chain, &a.Address, &a.Message, pq.Array(&a.Currencies),
+			&a.VerifiedAt, &a.ConfirmedAt, &a.ActiveAt, &a.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		as = append(as, a)
+	}
+	return as, nil
+}
+
+func (db *DB) findPayoutAddress(query string, args ...any) (*PayoutAddress, error) {
+	var a PayoutAddress
+	err := db.QueryRow(query, args...).Scan(&a.Id, &a.UserId, &a.Chain, &a.Address, &a.Message,
+		pq.Array(&a.Currencies), &a.VerifiedAt, &a.ConfirmedAt, &a.ActiveAt, &a.CreatedAt)
+	switch err {
+	case sql.ErrNoRows:
+		return nil, nil
+	case nil:
+		return &a, nil
+	default:
+		return nil, err
+	}
+}
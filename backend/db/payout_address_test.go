@@ -0,0 +1,147 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPayoutAddressChallenge(t *testing.T) {
+	TruncateAll(db, t)
+
+	u := createTestUser(t, db, "contributor@example.com")
+	now := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	a, err := db.InsertPayoutAddressChallenge(PayoutAddress{Id: uuid.New(), UserId: u.Id, Chain: "ETH",
+		Address: "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", Message: "challenge 1", CreatedAt: now})
+	require.NoError(t, err)
+	require.NotNil(t, a)
+
+	//a new challenge replaces the old one
+	a2, err := db.InsertPayoutAddressChallenge(PayoutAddress{Id: uuid.New(), UserId: u.Id, Chain: "ETH",
+		Address: "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", Message: "challenge 2", CreatedAt: now.Add(time.Minute)})
+	require.NoError(t, err)
+	require.NotNil(t, a2)
+	assert.Equal(t, a.Id, a2.Id)
+	a3, err := db.FindPayoutAddress(a.Id)
+	require.NoError(t, err)
+	require.NotNil(t, a3)
+	assert.Equal(t, "challenge 2", a3.Message)
+	assert.Nil(t, a3.VerifiedAt)
+
+	ok, err := db.VerifyPayoutAddress(a.Id, "token", now)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = db.VerifyPayoutAddress(a.Id, "token", now)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	//a verified address keeps its challenge
+	a2, err = db.InsertPayoutAddressChallenge(PayoutAddress{Id: uuid.New(), UserId: u.Id, Chain: "ETH",
+		Address: "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", Message: "challenge 3", CreatedAt: now})
+	require.NoError(t, err)
+	assert.Nil(t, a2)
+}
+
+func TestConfirmPayoutAddress(t *testing.T) {
+	TruncateAll(db, t)
+
+	u := createTestUser(t, db, "contributor@example.com")
+	now := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	cooldown := 48 * time.Hour
+	register := func(address string, createdAt time.Time) uuid.UUID {
+		a, err := db.InsertPayoutAddressChallenge(PayoutAddress{Id: uuid.New(), UserId: u.Id, Chain: "ETH",
+			Address: address, Message: "challenge", CreatedAt: createdAt})
+		require.NoError(t, err)
+		require.NotNil(t, a)
+		ok, err := db.VerifyPayoutAddress(a.Id, "token-"+address, now)
+		require.NoError(t, err)
+		require.True(t, ok)
+		return a.Id
+	}
+
+	id1 := register("0x01", now)
+	activeAt, err := db.ConfirmPayoutAddress(u.Id, id1, "wrong", []string{"ETH", "USD"}, cooldown, now)
+	require.NoError(t, err)
+	assert.Nil(t, activeAt)
+	activeAt, err = db.ConfirmPayoutAddress(uuid.New(), id1, "token-0x01", []string{"ETH", "USD"}, cooldown, now)
+	require.NoError(t, err)
+	assert.Nil(t, activeAt)
+
+	//the first address is active at once and the default of the currencies of the chain
+	activeAt, err = db.ConfirmPayoutAddress(u.Id, id1, "token-0x01", []string{"ETH", "USD"}, cooldown, now)
+	require.NoError(t, err)
+	require.NotNil(t, activeAt)
+	assert.Equal(t, now, activeAt.UTC())
+	a, err := db.FindDefaultPayoutAddress(u.Id, "USD")
+	require.NoError(t, err)
+	require.NotNil(t, a)
+	assert.Equal(t, id1, a.Id)
+	assert.Equal(t, []string{"ETH", "USD"}, a.Currencies)
+	assert.True(t, a.Active(now))
+	activeAt, err = db.ConfirmPayoutAddress(u.Id, id1, "token-0x01", []string{"ETH", "USD"}, cooldown, now)
+	require.NoError(t, err)
+	assert.Nil(t, activeAt)
+
+	//a second address waits for the cooldown and does not replace the defaults
+	id2 := register("0x02", now.Add(time.Minute))
+	activeAt, err = db.ConfirmPayoutAddress(u.Id, id2, "token-0x02", []string{"ETH", "USD"}, cooldown, now)
+	require.NoError(t, err)
+	require.NotNil(t, activeAt)
+	assert.Equal(t, now.Add(cooldown), activeAt.UTC())
+	a, err = db.FindPayoutAddressByAddress(u.Id, "ETH", "0x02")
+	require.NoError(t, err)
+	require.NotNil(t, a)
+	assert.False(t, a.Active(now))
+	assert.True(t, a.Active(now.Add(cooldown)))
+	assert.Empty(t, a.Currencies)
+
+	//changing the default to an active address starts the cooldown again
+	later := now.Add(3 * cooldown)
+	activeAt, err = db.UpdatePayoutAddressDefault(u.Id, "USD", id2, cooldown, later)
+	require.NoError(t, err)
+	require.NotNil(t, activeAt)
+	assert.Equal(t, later.Add(cooldown), activeAt.UTC())
+	a, err = db.FindDefaultPayoutAddress(u.Id, "USD")
+	require.NoError(t, err)
+	require.NotNil(t, a)
+	assert.Equal(t, id2, a.Id)
+	assert.False(t, a.Active(later))
+	activeAt, err = db.UpdatePayoutAddressDefault(u.Id, "USD", id2, cooldown, later)
+	require.NoError(t, err)
+	assert.Nil(t, activeAt)
+
+	as, err := db.FindPayoutAddressesByUserId(u.Id)
+	require.NoError(t, err)
+	require.Len(t, as, 2)
+	assert.Equal(t, []string{"ETH"}, as[0].Currencies)
+	assert.Equal(t, []string{"USD"}, as[1].Currencies)
+
+	//deleting the address removes its defaults
+	ok, err := db.DeletePayoutAddress(uuid.New(), id2)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = db.DeletePayoutAddress(u.Id, id2)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	a, err = db.FindDefaultPayoutAddress(u.Id, "USD")
+	require.NoError(t, err)
+	assert.Nil(t, a)
+
+	//deleting all addresses does not skip the cooldown of the next one
+	ok, err = db.DeletePayoutAddress(u.Id, id1)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	id3 := register("0x03", now.Add(2*time.Minute))
+	activeAt, err = db.ConfirmPayoutAddress(u.Id, id3, "token-0x03", []string{"ETH", "USD"}, cooldown, later)
+	require.NoError(t, err)
+	require.NotNil(t, activeAt)
+	assert.Equal(t, later.Add(cooldown), activeAt.UTC())
+	a, err = db.FindDefaultPayoutAddress(u.Id, "USD")
+	require.NoError(t, err)
+	require.NotNil(t, a)
+	assert.Equal(t, id3, a.Id)
+	assert.False(t, a.Active(later))
+}
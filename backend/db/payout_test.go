@@ -0,0 +1,110 @@
+package db
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestPayout(t *testing.T) {
+	TruncateAll(db, t)
+
+	sponsor := createTestUser(t, db, "sponsor@example.com")
+	contributor := createTestUser(t, db, "contributor@example.com")
+	r := createTestRepo(t, db, "https://github.com/flatfeestack/r1")
+	day := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	now := day.AddDate(0, 0, 1)
+	require.NoError(t, db.InsertContribution(sponsor.Id, contributor.Id, r.Id, big.NewInt(500), "USD", day, now, false))
+
+	p, err := db.RequestPayout(PayoutRequest{Id: uuid.New(), UserId: contributor.Id, Currency: "USD"}, big.NewInt(500), now)
+	require.NoError(t, err)
+	require.NotNil(t, p)
+	assert.Equal(t, "500", p.Amount.String())
+	assert.Equal(t, PayoutRequested, p.Status)
+
+	var unclaimed int
+	err = db.QueryRow(`SELECT COUNT(*) FROM daily_contribution WHERE claimed_at IS NULL`).Scan(&unclaimed)
+	require.NoError(t, err)
+	assert.Equal(t, 0, unclaimed)
+
+	//nothing was earned since the last request
+	p2, err := db.RequestPayout(PayoutRequest{Id: uuid.New(), UserId: contributor.Id, Currency: "USD"}, big.NewInt(500), now)
+	require.NoError(t, err)
+	assert.Nil(t, p2)
+
+	//only what was earned since the last request is requested, the total covers both
+	later := now.AddDate(0, 0, 1)
+	p2, err = db.RequestPayout(PayoutRequest{Id: uuid.New(), UserId: contributor.Id, Currency: "USD"}, big.NewInt(800), later)
+	require.NoError(t, err)
+	require.NotNil(t, p2)
+	assert.Equal(t, "300", p2.Amount.String())
+
+	total, err := db.FindPayoutTotal(contributor.Id, "USD", now)
+	require.NoError(t, err)
+	assert.Equal(t, "500", total.String())
+	total, err = db.FindPayoutTotal(contributor.Id, "USD", later)
+	require.NoError(t, err)
+	assert.Equal(t, "800", total.String())
+}
+
+func TestPayoutBatch(t *testing.T) {
+	TruncateAll(db, t)
+
+	u := createTestUser(t, db, "contributor@example.com")
+	now := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	p, err := db.RequestPayout(PayoutRequest{Id: uuid.New(), UserId: u.Id, Currency: "ETH"}, big.NewInt(100), now)
+	require.NoError(t, err)
+	require.NotNil(t, p)
+
+	ps, err := db.FindPayoutRequests(PayoutRequested, "ETH", 10)
+	require.NoError(t, err)
+	require.Len(t, ps, 1)
+	ps[0].Signature = "0x01"
+	//the nonce is the request id, more than 64 bits
+	ps[0].Nonce = new(big.Int).SetBytes(ps[0].Id[:])
+	expiresAt := now.Add(30 * 24 * time.Hour)
+	ps[0].ExpiresAt = &expiresAt
+
+	b := PayoutBatch{Id: uuid.New(), Currency: "ETH", Chain: "ETH", Total: big.NewInt(100), Requests: 1, CreatedAt: now}
+	require.NoError(t, db.InsertPayoutBatch(b, ps))
+	//a request is in one batch only
+	b2 := b
+	b2.Id = uuid.New()
+	assert.Error(t, db.InsertPayoutBatch(b2, ps))
+
+	ps, err = db.FindPayoutRequestsByBatch(b.Id)
+	require.NoError(t, err)
+	require.Len(t, ps, 1)
+	assert.Equal(t, PayoutSigned, ps[0].Status)
+	assert.Equal(t, "0x01", ps[0].Signature)
+	assert.Equal(t, new(big.Int).SetBytes(ps[0].Id[:]).String(), ps[0].Nonce.String())
+	require.NotNil(t, ps[0].ExpiresAt)
+	assert.Equal(t, expiresAt.Unix(), ps[0].ExpiresAt.Unix())
+
+	ok, err := db.UpdatePayoutBatchStatus(b.Id, PayoutSubmitted, PayoutConfirmed, nil, now)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	txHash := "0xabc"
+	ok, err = db.UpdatePayoutBatchStatus(b.Id, PayoutSigned, PayoutSubmitted, &txHash, now)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = db.UpdatePayoutBatchStatus(b.Id, PayoutSubmitted, PayoutConfirmed, nil, now)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	r, err := db.FindPayoutBatch(b.Id)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, PayoutConfirmed, r.Status)
+	assert.Equal(t, txHash, *r.TxHash)
+	assert.NotNil(t, r.SubmittedAt)
+	assert.NotNil(t, r.ConfirmedAt)
+
+	ps, err = db.FindPayoutRequests(PayoutConfirmed, "", 10)
+	require.NoError(t, err)
+	assert.Len(t, ps, 1)
+}
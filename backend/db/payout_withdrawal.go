@@ -0,0 +1,176 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PayoutWithdrawal is a withdraw of a payout contract seen on chain. It is reconciled if the withdrawn total
+// is the total of a signed request of the user.
+type PayoutWithdrawal struct {
+	TxHash          string     `json:"txHash"`
+	Chain           string     `json:"chain"`
+	Currency        string     `json:"currency"`
+	Block           int64      `json:"block"`
+	OwnerId         string     `json:"ownerId"`
+	UserId          *uuid.UUID `json:"userId,omitempty"`
+	PayoutRequestId *uuid.UUID `json:"payoutRequestId,omitempty"`
+	Address         string     `json:"address"`
+	Total           *big.Int   `json:"total"`
+	Amount          *big.Int   `json:"amount"`
+	CreatedAt       time.Time  `json:"createdAt"`
+}
+
+// FindChainCursor returns the last block the watcher with the name has read, nil if it never ran
+func (db *DB) FindChainCursor(name string) (*int64, error) {
+	var block int64
+	err := db.QueryRow(`SELECT block FROM chain_cursor WHERE name = $1`, name).Scan(&block)
+	switch err {
+	case sql.ErrNoRows:
+		return nil, nil
+	case nil:
+		return &block, nil
+	default:
+		return nil, err
+	}
+}
+
+func (db *DB) UpdateChainCursor(name string, block int64, now time.Time) error {
+	_, err := db.Exec(`
+		INSERT INTO chain_cursor(name, block, updated_at)
+		VALUES($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET block = $2, updated_at = $3`, name, block, now)
+	return err
+}
+
+// RecordPayoutWithdrawal stores a withdrawal and reconciles it. The user is found by the owner id of its
+// signed requests, the amount is what the total adds to the previous withdrawal, as the contract pays
+// out the difference. If the total is the total of a signed request, that request and the ones before are
+// confirmed. It returns nil if the withdrawal is stored already.
+func (db *DB) RecordPayoutWithdrawal(w PayoutWithdrawal, now time.Time) (*PayoutWithdrawal, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		SELECT user_id FROM payout_request
+		WHERE owner_id = $1 AND currency = $2
+		LIMIT 1`, w.OwnerId, w.Currency).Scan(&w.UserId)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	var prev string
+	err = tx.QueryRow(`
+		SELECT COALESCE(MAX(total), 0) FROM payout_withdrawal
+		WHERE owner_id = $1 AND currency = $2`, w.OwnerId, w.Currency).Scan(&prev)
+	if err != nil {
+		return nil, err
+	}
+	p, ok := new(big.Int).SetString(prev, 10)
+	if !ok {
+		return nil, fmt.Errorf("not a big.int %v", prev)
+	}
+	w.Amount = new(big.Int).Sub(w.Total, p)
+
+	if w.UserId != nil {
+		var createdAt time.Time
+		err = tx.QueryRow(`
+			SELECT id, created_at FROM (
+			    SELECT id, status, created_at, SUM(amount) OVER (ORDER BY created_at) AS total
+			    FROM payout_request
+			    WHERE user_id = $1 AND currency = $2) AS r
+			WHERE total = $3 AND status <> $4`, w.UserId, w.Currency, w.Total.String(), PayoutRequested).
+			Scan(&w.PayoutRequestId, &createdAt)
+		switch err {
+		case sql.ErrNoRows:
+		case nil:
+			_, err = tx.Exec(`
+				UPDATE payout_request SET status = $4, updated_at = $5
+				WHERE user_id = $1 AND currency = $2 AND created_at <= $3 AND status IN ($6, $7)`,
+				w.UserId, w.Currency, createdAt, PayoutConfirmed, now, PayoutSigned, PayoutSubmitted)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return nil, err
+		}
+	}
+
+	res, err := tx.Exec(`
+		INSERT INTO payout_withdrawal(tx_hash, chain, currency, block, owner_id, user_id, payout_request_id, address,
+		                              total, amount, created_at)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (tx_hash) DO NOTHING`,
+		w.TxHash, w.Chain, w.Currency, w.Block, w.OwnerId, w.UserId, w.PayoutRequestId, w.Address,
+		w.Total.String(), w.Amount.String(), w.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	nr, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if nr == 0 {
+		return nil, nil
+	}
+	return &w, tx.Commit()
+}
+
+func (db *DB) FindPayoutWithdrawalsByUserId(userId uuid.UUID) ([]PayoutWithdrawal, error) {
+	return db.findPayoutWithdrawals(`
+		SELECT tx_hash, chain, currency, block, owner_id, user_id, payout_request_id, address, total, amount,
+		       created_at
+		FROM payout_withdrawal
+		WHERE user_id = $1
+		ORDER BY block DESC`, userId)
+}
+
+// FindUnreconciledPayoutWithdrawals returns the latest withdrawals that match no signed request, e.g. of
+// a request signed before the owner ids were stored
+func (db *DB) FindUnreconciledPayoutWithdrawals(limit int) ([]PayoutWithdrawal, error) {
+	return db.findPayoutWithdrawals(`
+		SELECT tx_hash, chain, currency, block, owner_id, user_id, payout_request_id, address, total, amount,
+		       created_at
+		FROM payout_withdrawal
+		WHERE payout_request_id IS NULL
+		ORDER BY block DESC
+		LIMIT $1`, limit)
+}
+
+func (db *DB) findPayoutWithdrawals(query string, args ...any) ([]PayoutWithdrawal, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	ws := []PayoutWithdrawal{}
+	for rows.Next() {
+		var w PayoutWithdrawal
+		var t, a string
+		err = rows.Scan(&w.TxHash, &w.Chain, &w.Currency, &w.Block, &w.OwnerId, &w.UserId, &w.PayoutRequestId,
+			&w.Address, &t, &a, &w.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		t1, ok := new(big.Int).SetString(t, 10)
+		if !ok {
+			return nil, fmt.Errorf("not a big.int %v", t)
+		}
+		a1, ok := new(big.Int).SetString(a, 10)
+		if !ok {
+			return nil, fmt.Errorf("not a big.int %v", a)
+		}
+		w.Total = t1
+		w.Amount = a1
+		ws = append(ws, w)
+	}
+	return ws, nil
+}
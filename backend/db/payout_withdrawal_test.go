@@ -0,0 +1,94 @@
+package db
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChainCursor(t *testing.T) {
+	TruncateAll(db, t)
+
+	now := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	c, err := db.FindChainCursor("payout-0x01")
+	require.NoError(t, err)
+	assert.Nil(t, c)
+
+	require.NoError(t, db.UpdateChainCursor("payout-0x01", 10, now))
+	require.NoError(t, db.UpdateChainCursor("payout-0x01", 20, now))
+	c, err = db.FindChainCursor("payout-0x01")
+	require.NoError(t, err)
+	require.NotNil(t, c)
+	assert.Equal(t, int64(20), *c)
+}
+
+func TestRecordPayoutWithdrawal(t *testing.T) {
+	TruncateAll(db, t)
+
+	u := createTestUser(t, db, "contributor@example.com")
+	now := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	var ps []PayoutRequest
+	for i, earned := range []int64{100, 300} {
+		p, err := db.RequestPayout(PayoutRequest{Id: uuid.New(), UserId: u.Id, Currency: "ETH"}, big.NewInt(earned),
+			now.Add(time.Duration(i)*time.Hour))
+		require.NoError(t, err)
+		p.OwnerId = "0x01"
+		p.Signature = "0x02"
+		ps = append(ps, *p)
+	}
+	b := PayoutBatch{Id: uuid.New(), Currency: "ETH", Chain: "ETH", Total: big.NewInt(300), Requests: 2, CreatedAt: now}
+	require.NoError(t, db.InsertPayoutBatch(b, ps))
+
+	//the user withdraws with the signature of the first request
+	w := PayoutWithdrawal{TxHash: "0xa1", Chain: "ETH", Currency: "ETH", Block: 1, OwnerId: "0x01", Address: "0xd1",
+		Total: big.NewInt(100), CreatedAt: now}
+	r, err := db.RecordPayoutWithdrawal(w, now)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, u.Id, *r.UserId)
+	assert.Equal(t, ps[0].Id, *r.PayoutRequestId)
+	assert.Equal(t, "100", r.Amount.String())
+
+	//the watcher reads the block again
+	r, err = db.RecordPayoutWithdrawal(w, now)
+	require.NoError(t, err)
+	assert.Nil(t, r)
+
+	confirmed, err := db.FindPayoutRequests(PayoutConfirmed, "ETH", 10)
+	require.NoError(t, err)
+	require.Len(t, confirmed, 1)
+	assert.Equal(t, ps[0].Id, confirmed[0].Id)
+	assert.Equal(t, "0x01", confirmed[0].OwnerId)
+
+	//a total no request was signed for is not reconciled, the amount is what it adds to the last withdrawal
+	r, err = db.RecordPayoutWithdrawal(PayoutWithdrawal{TxHash: "0xa2", Chain: "ETH", Currency: "ETH", Block: 2,
+		OwnerId: "0x01", Address: "0xd1", Total: big.NewInt(250), CreatedAt: now}, now)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Nil(t, r.PayoutRequestId)
+	assert.Equal(t, "150", r.Amount.String())
+
+	r, err = db.RecordPayoutWithdrawal(PayoutWithdrawal{TxHash: "0xa3", Chain: "ETH", Currency: "ETH", Block: 3,
+		OwnerId: "0x01", Address: "0xd1", Total: big.NewInt(300), CreatedAt: now}, now)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, ps[1].Id, *r.PayoutRequestId)
+	assert.Equal(t, "50", r.Amount.String())
+
+	ws, err := db.FindPayoutWithdrawalsByUserId(u.Id)
+	require.NoError(t, err)
+	require.Len(t, ws, 3)
+	assert.Equal(t, "0xa3", ws[0].TxHash)
+	ws, err = db.FindUnreconciledPayoutWithdrawals(10)
+	require.NoError(t, err)
+	require.Len(t, ws, 1)
+	assert.Equal(t, "0xa2", ws[0].TxHash)
+
+	confirmed, err = db.FindPayoutRequests(PayoutConfirmed, "ETH", 10)
+	require.NoError(t, err)
+	assert.Len(t, confirmed, 2)
+}
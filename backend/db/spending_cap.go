@@ -0,0 +1,132 @@
+package db
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SpendingCap limits what a sponsor spends in one currency. A nil limit is no limit, the repo limit
+// is per repo and month.
+type SpendingCap struct {
+	Currency    string    `json:"currency"`
+	Daily       *big.Int  `json:"daily"`
+	Monthly     *big.Int  `json:"monthly"`
+	RepoMonthly *big.Int  `json:"repoMonthly"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+func (db *DB) FindSpendingCaps(uid uuid.UUID) (map[string]SpendingCap, error) {
+	rows, err := db.Query(`
+		SELECT currency, daily_limit, monthly_limit, repo_monthly_limit, updated_at
+		FROM spending_cap
+		WHERE user_id = $1`, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	m := map[string]SpendingCap{}
+	for rows.Next() {
+		var c SpendingCap
+		var daily, monthly, repoMonthly *string
+		err = rows.Scan(&c.Currency, &daily, &monthly, &repoMonthly, &c.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if c.Daily, err = parseLimit(daily); err != nil {
+			return nil, err
+		}
+		if c.Monthly, err = parseLimit(monthly); err != nil {
+			return nil, err
+		}
+		if c.RepoMonthly, err = parseLimit(repoMonthly); err != nil {
+			return nil, err
+		}
+		m[c.Currency] = c
+	}
+	return m, nil
+}
+
+func (db *DB) UpsertSpendingCap(uid uuid.UUID, c SpendingCap) error {
+	_, err := db.Exec(`
+		INSERT INTO spending_cap(user_id, currency, daily_limit, monthly_limit, repo_monthly_limit, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, currency) DO UPDATE SET daily_limit = EXCLUDED.daily_limit,
+		    monthly_limit = EXCLUDED.monthly_limit, repo_monthly_limit = EXCLUDED.repo_monthly_limit,
+		    updated_at = EXCLUDED.updated_at`,
+		uid, c.Currency, limitString(c.Daily), limitString(c.Monthly), limitString(c.RepoMonthly), c.UpdatedAt)
+	return err
+}
+
+func (db *DB) DeleteSpendingCap(uid uuid.UUID, currency string) error {
+	_, err := db.Exec(`DELETE FROM spending_cap WHERE user_id = $1 AND currency = $2`, uid, currency)
+	return err
+}
+
+func (db *DB) UpdateSpendingStopAt(uid uuid.UUID, stopAt *time.Time) error {
+	_, err := db.Exec(`UPDATE users SET spending_stop_at=$1 WHERE id=$2`, stopAt, uid)
+	return err
+}
+
+// FindSpentInMonth returns what the sponsor spent in the currency in the month of the day, in total and
+// per repo. Money parked for repos without contributors counts, moving it to a contributor later does not.
+func (db *DB) FindSpentInMonth(uid uuid.UUID, currency string, day time.Time) (*big.Int, map[uuid.UUID]*big.Int, error) {
+	month := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+	rows, err := db.Query(`
+		SELECT repo_id, SUM(balance)
+		FROM (
+		    SELECT repo_id, balance
+		    FROM contribution_month_sponsor
+		    WHERE user_sponsor_id = $1 AND currency = $2 AND month = $3 AND foundation_payment = FALSE
+		    UNION ALL
+		    SELECT repo_id, balance
+		    FROM future_contribution
+		    WHERE user_sponsor_id = $1 AND currency = $2 AND day >= $3 AND day < $4
+		      AND COALESCE(foundation_payment, FALSE) = FALSE
+		) AS s
+		GROUP BY repo_id`, uid, currency, month, month.AddDate(0, 1, 0))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer CloseAndLog(rows)
+
+	total := new(big.Int)
+	m := map[uuid.UUID]*big.Int{}
+	for rows.Next() {
+		var rid uuid.UUID
+		var b string
+		err = rows.Scan(&rid, &b)
+		if err != nil {
+			return nil, nil, err
+		}
+		b1, ok := new(big.Int).SetString(b, 10)
+		if !ok {
+			return nil, nil, fmt.Errorf("not a big.int %v", b)
+		}
+		m[rid] = b1
+		total.Add(total, b1)
+	}
+	return total, m, nil
+}
+
+func parseLimit(s *string) (*big.Int, error) {
+	if s == nil {
+		return nil, nil
+	}
+	b, ok := new(big.Int).SetString(*s, 10)
+	if !ok {
+		return nil, fmt.Errorf("not a big.int %v", *s)
+	}
+	return b, nil
+}
+
+func limitString(b *big.Int) *string {
+	if b == nil {
+		return nil
+	}
+	s := b.String()
+	return &s
+}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpendingCaps(t *testing.T) {
+	TruncateAll(db, t)
+
+	u := createTestUser(t, db, "sponsor@example.com")
+
+	require.NoError(t, db.UpsertSpendingCap(u.Id, SpendingCap{Currency: "USD", Daily: big.NewInt(100), UpdatedAt: time.Now()}))
+	require.NoError(t, db.UpsertSpendingCap(u.Id, SpendingCap{Currency: "USD", Monthly: big.NewInt(2000), UpdatedAt: time.Now()}))
+	caps, err := db.FindSpendingCaps(u.Id)
+	require.NoError(t, err)
+	require.Len(t, caps, 1)
+	assert.Nil(t, caps["USD"].Daily)
+	assert.Equal(t, big.NewInt(2000), caps["USD"].Monthly)
+	assert.Nil(t, caps["USD"].RepoMonthly)
+
+	require.NoError(t, db.DeleteSpendingCap(u.Id, "USD"))
+	caps, err = db.FindSpendingCaps(u.Id)
+	require.NoError(t, err)
+	assert.Len(t, caps, 0)
+
+	stopAt := time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, db.UpdateSpendingStopAt(u.Id, &stopAt))
+	u2, err := db.FindUserById(u.Id)
+	require.NoError(t, err)
+	require.NotNil(t, u2.SpendingStopAt)
+	assert.True(t, stopAt.Equal(*u2.SpendingStopAt))
+}
+
+func TestFindSpentInMonth(t *testing.T) {
+	TruncateAll(db, t)
+
+	sponsor := createTestUser(t, db, "sponsor@example.com")
+	contributor := createTestUser(t, db, "contributor@example.com")
+	repo1 := createTestRepo(t, db, "https://github.com/test/repo1")
+	repo2 := createTestRepo(t, db, "https://github.com/test/repo2")
+
+	day := time.Date(2026, 10, 5, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, db.InsertContribution(sponsor.Id, contributor.Id, repo1.Id, big.NewInt(100), "USD", day, time.Now(), false))
+	require.NoError(t, db.InsertContribution(sponsor.Id, contributor.Id, repo1.Id, big.NewInt(50), "USD", day.AddDate(0, 0, 1), time.Now(), false))
+	require.NoError(t, db.InsertFutureContribution(sponsor.Id, repo2.Id, big.NewInt(30), "USD", day, time.Now(), false))
+	//other months, currencies and foundation payments do not count
+	require.NoError(t, db.InsertContribution(sponsor.Id, contributor.Id, repo1.Id, big.NewInt(1000), "USD", day.AddDate(0, -1, 0), time.Now(), false))
+	require.NoError(t, db.InsertContribution(sponsor.Id, contributor.Id, repo1.Id, big.NewInt(1000), "EUR", day, time.Now(), false))
+	require.NoError(t, db.InsertFutureContribution(sponsor.Id, repo2.Id, big.NewInt(1000), "USD", day, time.Now(), true))
+
+	total, perRepo, err := db.FindSpentInMonth(sponsor.Id, "USD", time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(180), total)
+	assert.Equal(t, big.NewInt(150), perRepo[repo1.Id])
+	assert.Equal(t, big.NewInt(30), perRepo[repo2.Id])
+}
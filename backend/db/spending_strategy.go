@@ -0,0 +1,31 @@
+package db
+
+import (
+	"github.com/google/uuid"
+)
+
+// string mapping
+const (
+	SpendingMax          = "MAX"
+	SpendingProportional = "PROPORTIONAL"
+	SpendingCheapest     = "CHEAPEST"
+	SpendingPreferred    = "PREFERRED"
+)
+
+var SpendingStrategies = []string{SpendingMax, SpendingProportional, SpendingCheapest, SpendingPreferred}
+
+func IsValidSpendingStrategy(strategy string) bool {
+	for _, v := range SpendingStrategies {
+		if v == strategy {
+			return true
+		}
+	}
+	return false
+}
+
+func (db *DB) UpdateSpendingStrategy(uid uuid.UUID, strategy *string, order *string) error {
+	_, err := db.Exec(
+		`UPDATE users SET spending_strategy=$1, spending_order=$2 WHERE id=$3`,
+		strategy, order, uid)
+	return err
+}
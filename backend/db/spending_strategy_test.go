@@ -0,0 +1,29 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateSpendingStrategy(t *testing.T) {
+	TruncateAll(db, t)
+
+	sponsor := createTestUser(t, db, "sponsor@example.com")
+
+	strategy := SpendingPreferred
+	order := "GAS,USD"
+	require.NoError(t, db.UpdateSpendingStrategy(sponsor.Id, &strategy, &order))
+	u, err := db.FindUserById(sponsor.Id)
+	require.NoError(t, err)
+	require.NotNil(t, u.SpendingStrategy)
+	assert.Equal(t, SpendingPreferred, *u.SpendingStrategy)
+	assert.Equal(t, "GAS,USD", *u.SpendingOrder)
+
+	require.NoError(t, db.UpdateSpendingStrategy(sponsor.Id, nil, nil))
+	u, err = db.FindUserByEmail("sponsor@example.com")
+	require.NoError(t, err)
+	assert.Nil(t, u.SpendingStrategy)
+	assert.Nil(t, u.SpendingOrder)
+}
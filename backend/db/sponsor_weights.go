@@ -0,0 +1,87 @@
+package db
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const MaxSponsorWeight = 100
+
+type SponsorWeight struct {
+	RepoId    uuid.UUID `json:"repoId"`
+	Weight    int64     `json:"weight"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (db *DB) FindSponsorWeights(userId uuid.UUID) (map[uuid.UUID]int64, error) {
+	rows, err := db.Query(`
+		SELECT repo_id, weight
+		FROM sponsor_weight
+		WHERE user_id = $1`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	m := make(map[uuid.UUID]int64)
+	for rows.Next() {
+		var repoId uuid.UUID
+		var weight int64
+		err = rows.Scan(&repoId, &weight)
+		if err != nil {
+			return nil, err
+		}
+		m[repoId] = weight
+	}
+	return m, nil
+}
+
+func (db *DB) FindSponsorWeightsByUserId(userId uuid.UUID) ([]SponsorWeight, error) {
+	rows, err := db.Query(`
+		SELECT repo_id, weight, created_at
+		FROM sponsor_weight
+		WHERE user_id = $1
+		ORDER BY weight DESC, created_at`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	sws := []SponsorWeight{}
+	for rows.Next() {
+		var sw SponsorWeight
+		err = rows.Scan(&sw.RepoId, &sw.Weight, &sw.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		sws = append(sws, sw)
+	}
+	return sws, nil
+}
+
+// ReplaceSponsorWeights removes all weights of the user and stores the new ones. An empty
+// slice resets the user to the equal split.
+func (db *DB) ReplaceSponsorWeights(userId uuid.UUID, weights []SponsorWeight, now time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM sponsor_weight WHERE user_id = $1`, userId)
+	if err != nil {
+		return err
+	}
+
+	for _, sw := range weights {
+		_, err = tx.Exec(`
+			INSERT INTO sponsor_weight(id, user_id, repo_id, weight, created_at)
+			VALUES($1, $2, $3, $4, $5)`,
+			uuid.New(), userId, sw.RepoId, sw.Weight, now)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,44 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplaceSponsorWeights(t *testing.T) {
+	TruncateAll(db, t)
+
+	sponsor := createTestUser(t, db, "sponsor@example.com")
+	repo1 := createTestRepo(t, db, "https://github.com/test/repo1")
+	repo2 := createTestRepo(t, db, "https://github.com/test/repo2")
+
+	err := db.ReplaceSponsorWeights(sponsor.Id, []SponsorWeight{
+		{RepoId: repo1.Id, Weight: 60},
+		{RepoId: repo2.Id, Weight: 40},
+	}, time.Now())
+	require.NoError(t, err)
+
+	m, err := db.FindSponsorWeights(sponsor.Id)
+	require.NoError(t, err)
+	assert.Equal(t, map[uuid.UUID]int64{repo1.Id: 60, repo2.Id: 40}, m)
+
+	err = db.ReplaceSponsorWeights(sponsor.Id, []SponsorWeight{{RepoId: repo2.Id, Weight: 50}}, time.Now())
+	require.NoError(t, err)
+
+	sws, err := db.FindSponsorWeightsByUserId(sponsor.Id)
+	require.NoError(t, err)
+	require.Len(t, sws, 1)
+	assert.Equal(t, repo2.Id, sws[0].RepoId)
+	assert.Equal(t, int64(50), sws[0].Weight)
+
+	err = db.ReplaceSponsorWeights(sponsor.Id, nil, time.Now())
+	require.NoError(t, err)
+
+	sws, err = db.FindSponsorWeightsByUserId(sponsor.Id)
+	require.NoError(t, err)
+	assert.Len(t, sws, 0)
+}
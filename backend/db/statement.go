@@ -0,0 +1,75 @@
+package db
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// StatementLine is what a contributor earned from one sponsor for one repo in one currency
+type StatementLine struct {
+	RepoId      uuid.UUID `json:"repoId"`
+	RepoName    string    `json:"repoName"`
+	SponsorId   uuid.UUID `json:"sponsorId"`
+	SponsorName string    `json:"sponsorName"`
+	Foundation  bool      `json:"foundation"`
+	Currency    string    `json:"currency"`
+	Earned      *big.Int  `json:"earned"`
+	Claimed     *big.Int  `json:"claimed"`
+	Unclaimed   *big.Int  `json:"unclaimed"`
+	Days        int       `json:"days"`
+}
+
+// FindStatementLines sums the contributions of the contributor between from and to, the archived ones
+// included
+func (db *DB) FindStatementLines(userContributorId uuid.UUID, from time.Time, to time.Time) ([]StatementLine, error) {
+	rows, err := db.Query(`
+		SELECT c.repo_id, COALESCE(r.name, ''), c.user_sponsor_id, COALESCE(sp.name, ''),
+		       COALESCE(c.foundation_payment, FALSE), c.currency,
+		       SUM(c.balance),
+		       COALESCE(SUM(c.balance) FILTER (WHERE c.claimed_at IS NOT NULL), 0),
+		       COALESCE(SUM(c.balance) FILTER (WHERE c.claimed_at IS NULL), 0),
+		       COUNT(DISTINCT c.day)
+		FROM (
+		    SELECT repo_id, user_sponsor_id, foundation_payment, currency, balance, claimed_at, day
+		    FROM daily_contribution
+		    WHERE user_contributor_id = $1 AND day >= $2 AND day < $3
+		    UNION ALL
+		    SELECT repo_id, user_sponsor_id, foundation_payment, currency, balance, claimed_at, day
+		    FROM daily_contribution_archive
+		    WHERE user_contributor_id = $1 AND day >= $2 AND day < $3
+		) AS c
+		    INNER JOIN repo r ON c.repo_id = r.id
+		    LEFT JOIN users sp ON c.user_sponsor_id = sp.id
+		GROUP BY c.repo_id, r.name, c.user_sponsor_id, sp.name, COALESCE(c.foundation_payment, FALSE), c.currency
+		ORDER BY c.currency, r.name, sp.name`, userContributorId, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	ls := []StatementLine{}
+	for rows.Next() {
+		var l StatementLine
+		var earned, claimed, unclaimed string
+		err = rows.Scan(&l.RepoId, &l.RepoName, &l.SponsorId, &l.SponsorName, &l.Foundation, &l.Currency,
+			&earned, &claimed, &unclaimed, &l.Days)
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		if l.Earned, ok = new(big.Int).SetString(earned, 10); !ok {
+			return nil, fmt.Errorf("not a big.int %v", earned)
+		}
+		if l.Claimed, ok = new(big.Int).SetString(claimed, 10); !ok {
+			return nil, fmt.Errorf("not a big.int %v", claimed)
+		}
+		if l.Unclaimed, ok = new(big.Int).SetString(unclaimed, 10); !ok {
+			return nil, fmt.Errorf("not a big.int %v", unclaimed)
+		}
+		ls = append(ls, l)
+	}
+	return ls, nil
+}
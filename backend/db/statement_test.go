@@ -0,0 +1,50 @@
+package db
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindStatementLines(t *testing.T) {
+	TruncateAll(db, t)
+
+	sponsor := createTestUser(t, db, "sponsor@example.com")
+	contributor := createTestUser(t, db, "contributor@example.com")
+	repo := createTestRepo(t, db, "https://github.com/test/repo")
+
+	day1 := time.Date(2026, 8, 30, 0, 0, 0, 0, time.UTC)
+	day2 := time.Date(2026, 8, 31, 0, 0, 0, 0, time.UTC)
+	day3 := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, db.InsertContribution(sponsor.Id, contributor.Id, repo.Id, big.NewInt(100), "USD", day1, time.Now(), false))
+	require.NoError(t, db.InsertContribution(sponsor.Id, contributor.Id, repo.Id, big.NewInt(200), "USD", day2, time.Now(), false))
+	require.NoError(t, db.InsertContribution(sponsor.Id, contributor.Id, repo.Id, big.NewInt(400), "USD", day3, time.Now(), false))
+
+	//the first day is paid out, then august is archived
+	_, err := db.Exec(`UPDATE daily_contribution SET claimed_at = $1 WHERE day = $2`, time.Now(), day1)
+	require.NoError(t, err)
+	_, err = db.ArchiveContributionMonth(day1, time.Now())
+	require.NoError(t, err)
+
+	ls, err := db.FindStatementLines(contributor.Id, day1, day3)
+	require.NoError(t, err)
+	require.Len(t, ls, 1)
+	assert.Equal(t, repo.Id, ls[0].RepoId)
+	assert.Equal(t, sponsor.Id, ls[0].SponsorId)
+	assert.Equal(t, big.NewInt(300), ls[0].Earned)
+	assert.Equal(t, big.NewInt(100), ls[0].Claimed)
+	assert.Equal(t, big.NewInt(200), ls[0].Unclaimed)
+	assert.Equal(t, 2, ls[0].Days)
+
+	ls, err = db.FindStatementLines(contributor.Id, day1, day3.AddDate(0, 1, 0))
+	require.NoError(t, err)
+	require.Len(t, ls, 1)
+	assert.Equal(t, big.NewInt(700), ls[0].Earned)
+
+	ls, err = db.FindStatementLines(sponsor.Id, day1, day3)
+	require.NoError(t, err)
+	assert.Len(t, ls, 0)
+}
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SubscriptionActive   = "ACTIVE"
+	SubscriptionPastDue  = "PAST_DUE"
+	SubscriptionGrace    = "GRACE"
+	SubscriptionCanceled = "CANCELED"
+)
+
+// Subscription renews the balance of a sponsor with the stored card. RenewAt is when the next renewal
+// is charged, ExternalId is the pay-in of the last renewal, it is cleared once the renewal succeeded.
+type Subscription struct {
+	UserId     uuid.UUID  `json:"-"`
+	Status     string     `json:"status"`
+	RenewAt    *time.Time `json:"renewAt"`
+	Retries    int        `json:"retries"`
+	GraceUntil *time.Time `json:"graceUntil"`
+	ExternalId *uuid.UUID `json:"-"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// Pending is true if the renewal with the externalId was charged and neither succeeded nor failed yet
+func (s *Subscription) Pending(externalId uuid.UUID) bool {
+	return s.ExternalId != nil && *s.ExternalId == externalId && s.RenewAt == nil &&
+		(s.Status == SubscriptionActive || s.Status == SubscriptionPastDue)
+}
+
+func (db *DB) FindSubscription(uid uuid.UUID) (*Subscription, error) {
+	var s Subscription
+	err := db.QueryRow(`
+		SELECT user_id, status, renew_at, retries, grace_until, external_id, updated_at, created_at
+		FROM subscription
+		WHERE user_id = $1`, uid).
+		Scan(&s.UserId, &s.Status, &s.RenewAt, &s.Retries, &s.GraceUntil, &s.ExternalId, &s.UpdatedAt, &s.CreatedAt)
+
+	switch err {
+	case sql.ErrNoRows:
+		return nil, nil
+	case nil:
+		return &s, nil
+	default:
+		return nil, err
+	}
+}
+
+func (db *DB) UpsertSubscription(s Subscription) error {
+	_, err := db.Exec(`
+		INSERT INTO subscription(user_id, status, renew_at, retries, grace_until, external_id, updated_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (user_id) DO UPDATE SET status = EXCLUDED.status, renew_at = EXCLUDED.renew_at,
+		    retries = EXCLUDED.retries, grace_until = EXCLUDED.grace_until, external_id = EXCLUDED.external_id,
+		    updated_at = EXCLUDED.updated_at`,
+		s.UserId, s.Status, s.RenewAt, s.Retries, s.GraceUntil, s.ExternalId, s.UpdatedAt, s.CreatedAt)
+	return err
+}
+
+// ScheduleRenewal sets the renewal of an active subscription, unless one is scheduled or pending already
+func (db *DB) ScheduleRenewal(uid uuid.UUID, renewAt time.Time, now time.Time) error {
+	_, err := db.Exec(`
+		UPDATE subscription SET renew_at = $2, updated_at = $3
+		WHERE user_id = $1 AND status = $4 AND renew_at IS NULL AND external_id IS NULL`,
+		uid, renewAt, now, SubscriptionActive)
+	return err
+}
+
+// CancelSubscription stops the renewals and the dunning, the last pay-in is kept so a renewal that
+// succeeds after the cancel does not activate it again
+func (db *DB) CancelSubscription(uid uuid.UUID, now time.Time) error {
+	_, err := db.Exec(`
+		UPDATE subscription SET status = $2, renew_at = NULL, grace_until = NULL, updated_at = $3
+		WHERE user_id = $1`, uid, SubscriptionCanceled, now)
+	return err
+}
+
+// FindDueSubscriptions returns the subscriptions with a renewal or retry that is due, and the ones
+// whose grace period is over
+func (db *DB) FindDueSubscriptions(now time.Time) ([]Subscription, error) {
+	rows, err := db.Query(`
+		SELECT user_id, status, renew_at, retries, grace_until, external_id, updated_at, created_at
+		FROM subscription
+		WHERE (status IN ($2, $3) AND renew_at <= $1) OR (status = $4 AND grace_until <= $1)
+		ORDER BY user_id`, now, SubscriptionActive, SubscriptionPastDue, SubscriptionGrace)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	var ss []Subscription
+	for rows.Next() {
+		var s Subscription
+		err = rows.Scan(&s.UserId, &s.Status, &s.RenewAt, &s.Retries, &s.GraceUntil, &s.ExternalId, &s.UpdatedAt, &s.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		ss = append(ss, s)
+	}
+	return ss, nil
+}
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriptionRenewal(t *testing.T) {
+	TruncateAll(db, t)
+
+	u := createTestUser(t, db, "sponsor@example.com")
+	now := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+
+	s, err := db.FindSubscription(u.Id)
+	require.NoError(t, err)
+	assert.Nil(t, s)
+
+	require.NoError(t, db.UpsertSubscription(Subscription{UserId: u.Id, Status: SubscriptionActive, UpdatedAt: now, CreatedAt: now}))
+	ss, err := db.FindDueSubscriptions(now)
+	require.NoError(t, err)
+	assert.Len(t, ss, 0)
+
+	//a scheduled renewal is not moved
+	require.NoError(t, db.ScheduleRenewal(u.Id, now, now))
+	require.NoError(t, db.ScheduleRenewal(u.Id, now.AddDate(0, 0, 1), now))
+	ss, err = db.FindDueSubscriptions(now)
+	require.NoError(t, err)
+	require.Len(t, ss, 1)
+	assert.True(t, now.Equal(*ss[0].RenewAt))
+
+	//a pending renewal is not scheduled again
+	e := uuid.New()
+	s = &ss[0]
+	s.ExternalId = &e
+	s.RenewAt = nil
+	require.NoError(t, db.UpsertSubscription(*s))
+	require.NoError(t, db.ScheduleRenewal(u.Id, now, now))
+	s, err = db.FindSubscription(u.Id)
+	require.NoError(t, err)
+	assert.Nil(t, s.RenewAt)
+	assert.True(t, s.Pending(e))
+
+	//the grace period is over
+	graceUntil := now.AddDate(0, 0, -1)
+	s.Status = SubscriptionGrace
+	s.GraceUntil = &graceUntil
+	require.NoError(t, db.UpsertSubscription(*s))
+	ss, err = db.FindDueSubscriptions(now)
+	require.NoError(t, err)
+	assert.Len(t, ss, 1)
+
+	require.NoError(t, db.CancelSubscription(u.Id, now))
+	s, err = db.FindSubscription(u.Id)
+	require.NoError(t, err)
+	assert.Equal(t, SubscriptionCanceled, s.Status)
+	assert.Nil(t, s.GraceUntil)
+	assert.Equal(t, e, *s.ExternalId)
+	ss, err = db.FindDueSubscriptions(now)
+	require.NoError(t, err)
+	assert.Len(t, ss, 0)
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/go-jose/go-jose/v3/jwt"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 type PublicUser struct {
@@ -40,9 +41,14 @@ type UserDetail struct {
 	Seats                int     `json:"seats"`
 	Freq                 int     `json:"freq"`
 	Claims               *jwt.Claims
-	Role                 string `json:"role,omitempty"`
-	Multiplier           bool   `json:"multiplier"`
-	MultiplierDailyLimit int    `json:"multiplierDailyLimit"`
+	Role                 string     `json:"role,omitempty"`
+	Multiplier           bool       `json:"multiplier"`
+	MultiplierDailyLimit int        `json:"multiplierDailyLimit"`
+	FundPolicy           *string    `json:"fundPolicy"`
+	SpendingStrategy     *string    `json:"spendingStrategy"`
+	SpendingOrder        *string    `json:"spendingOrder"`
+	DisplayCurrency      *string    `json:"displayCurrency"`
+	SpendingStopAt       *time.Time `json:"spendingStopAt"`
 }
 
 func (db *DB) FindAllEmails() ([]string, error) {
@@ -68,12 +74,14 @@ func (db *DB) FindUserByEmail(email string) (*UserDetail, error) {
 	var u UserDetail
 	err := db.QueryRow(`
 		SELECT id, stripe_id, invited_id, stripe_payment_method, stripe_last4, 
-		       email, name, image, seats, freq, created_at, multiplier, multiplier_daily_limit
+		       email, name, image, seats, freq, created_at, multiplier, multiplier_daily_limit,
+		       fund_policy, spending_strategy, spending_order, display_currency, spending_stop_at
 		FROM users 
 		WHERE email=$1`, email).
 		Scan(&u.Id, &u.StripeId, &u.InvitedId, &u.PaymentMethod, &u.Last4,
 			&u.Email, &u.Name, &u.Image, &u.Seats, &u.Freq, &u.CreatedAt,
-			&u.Multiplier, &u.MultiplierDailyLimit)
+			&u.Multiplier, &u.MultiplierDailyLimit, &u.FundPolicy, &u.SpendingStrategy, &u.SpendingOrder,
+			&u.DisplayCurrency, &u.SpendingStopAt)
 	
 	switch err {
 	case sql.ErrNoRows:
@@ -90,12 +98,14 @@ func (db *DB) FindUserById(uid uuid.UUID) (*UserDetail, error) {
 	err := db.QueryRow(`
 		SELECT id, stripe_id, invited_id, stripe_payment_method, stripe_last4, 
 		       stripe_client_secret, email, name, image, seats, freq, created_at,
-		       multiplier, multiplier_daily_limit                        
+		       multiplier, multiplier_daily_limit, fund_policy, spending_strategy, spending_order,
+		       display_currency, spending_stop_at
 		FROM users 
 		WHERE id=$1`, uid).
 		Scan(&u.Id, &u.StripeId, &u.InvitedId, &u.PaymentMethod, &u.Last4,
 			&u.StripeClientSecret, &u.Email, &u.Name, &u.Image, &u.Seats, &u.Freq, &u.CreatedAt,
-			&u.Multiplier, &u.MultiplierDailyLimit)
+			&u.Multiplier, &u.MultiplierDailyLimit, &u.FundPolicy, &u.SpendingStrategy, &u.SpendingOrder,
+			&u.DisplayCurrency, &u.SpendingStopAt)
 	
 	switch err {
 	case sql.ErrNoRows:
@@ -291,4 +301,29 @@ func (db *DB) CheckFondsAmountEnough(foundation *Foundation, amount *big.Int, cu
 	}
 
 	return restrictedAmountToPay, nil
-}
\ No newline at end of file
+}
+// FindPayerIds returns for each user the user whose balance is spent, the payer of the organization,
+// the inviting user or the user itself
+func (db *DB) FindPayerIds(userIds []uuid.UUID) (map[uuid.UUID]uuid.UUID, error) {
+	rows, err := db.Query(`
+		SELECT u.id, COALESCE(o.payer_id, u.invited_id, u.id)
+		FROM users u
+		    LEFT JOIN organization_member m ON m.user_id = u.id
+		    LEFT JOIN organization o ON o.id = m.organization_id
+		WHERE u.id = ANY($1)`, pq.Array(userIds))
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	m := map[uuid.UUID]uuid.UUID{}
+	for rows.Next() {
+		var id, payerId uuid.UUID
+		err = rows.Scan(&id, &payerId)
+		if err != nil {
+			return nil, err
+		}
+		m[id] = payerId
+	}
+	return m, nil
+}
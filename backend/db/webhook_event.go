@@ -0,0 +1,205 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	WebhookStripe = "STRIPE"
+	WebhookNow    = "NOWPAYMENTS"
+	WebhookMock   = "MOCK"
+	WebhookBank   = "BANK"
+)
+
+const (
+	WebhookPending   = "PENDING"
+	WebhookProcessed = "PROCESSED"
+	WebhookFailed    = "FAILED"
+)
+
+// ErrWebhookEventProcessed is returned by the booking of an inbox event that was booked before
+var ErrWebhookEventProcessed = errors.New("webhook event was processed already")
+
+// Inbox is the event of the webhook inbox a booking is made for, bookings outside the inbox have none
+type Inbox struct {
+	EventId uuid.UUID
+	Now     time.Time
+}
+
+// WebhookEvent is a verified delivery of a payment provider. Providers deliver an event more than once,
+// the event id of the provider makes sure it is stored and processed only once.
+type WebhookEvent struct {
+	Id            uuid.UUID       `json:"id"`
+	Provider      string          `json:"provider"`
+	EventId       string          `json:"eventId"`
+	EventType     string          `json:"eventType"`
+	Payload       json.RawMessage `json:"payload"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	LastError     *string         `json:"lastError,omitempty"`
+	NextAttemptAt time.Time       `json:"nextAttemptAt"`
+	ProcessedAt   *time.Time      `json:"processedAt,omitempty"`
+	CreatedAt     time.Time       `json:"createdAt"`
+}
+
+// InsertWebhookEvent stores the event as pending, it returns false if the event was delivered before
+func (db *DB) InsertWebhookEvent(e WebhookEvent) (bool, error) {
+	res, err := db.Exec(`
+		INSERT INTO webhook_event(id, provider, event_id, event_type, payload, status, next_attempt_at, created_at)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (provider, event_id) DO NOTHING`,
+		e.Id, e.Provider, e.EventId, e.EventType, []byte(e.Payload), WebhookPending, e.NextAttemptAt, e.CreatedAt)
+	if err != nil {
+		return false, err
+	}
+	nr, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return nr == 1, nil
+}
+
+func (db *DB) FindWebhookEvent(id uuid.UUID) (*WebhookEvent, error) {
+	var e WebhookEvent
+	err := db.QueryRow(`
+		SELECT id, provider, event_id, event_type, payload, status, attempts, last_error, next_attempt_at,
+		       processed_at, created_at
+		FROM webhook_event
+		WHERE id = $1`, id).
+		Scan(&e.Id, &e.Provider, &e.EventId, &e.EventType, (*[]byte)(&e.Payload), &e.Status, &e.Attempts, &e.LastError,
+			&e.NextAttemptAt, &e.ProcessedAt, &e.CreatedAt)
+
+	switch err {
+	case sql.ErrNoRows:
+		return nil, nil
+	case nil:
+		return &e, nil
+	default:
+		return nil, err
+	}
+}
+
+// FindWebhookEvents returns the latest events with the status, or of all statuses if it is empty
+func (db *DB) FindWebhookEvents(status string, limit int) ([]WebhookEvent, error) {
+	return db.findWebhookEvents(`
+		SELECT id, provider, event_id, event_type, payload, status, attempts, last_error, next_attempt_at,
+		       processed_at, created_at
+		FROM webhook_event
+		WHERE $1 = '' OR status = $1
+		ORDER BY created_at DESC
+		LIMIT $2`, status, limit)
+}
+
+// FindDueWebhookEvents returns the pending events whose next attempt is due, the oldest first
+func (db *DB) FindDueWebhookEvents(now time.Time, limit int) ([]WebhookEvent, error) {
+	return db.findWebhookEvents(`
+		SELECT id, provider, event_id, event_type, payload, status, attempts, last_error, next_attempt_at,
+		       processed_at, created_at
+		FROM webhook_event
+		WHERE status = $1 AND next_attempt_at <= $2
+		ORDER BY created_at
+		LIMIT $3`, WebhookPending, now, limit)
+}
+
+func (db *DB) findWebhookEvents(query string, args ...any) ([]WebhookEvent, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseAndLog(rows)
+
+	es := []WebhookEvent{}
+	for rows.Next() {
+		var e WebhookEvent
+		err = rows.Scan(&e.Id, &e.Provider, &e.EventId, &e.EventType, (*[]byte)(&e.Payload), &e.Status, &e.Attempts, &e.LastError,
+			&e.NextAttemptAt, &e.ProcessedAt, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		es = append(es, e)
+	}
+	return es, nil
+}
+
+// ClaimWebhookEvent takes a due event for processing until the given time, so no one else processes it
+// at the same time. If the processing neither succeeds nor fails until then, the event is due again.
+func (db *DB) ClaimWebhookEvent(id uuid.UUID, now time.Time, until time.Time) (bool, error) {
+	res, err := db.Exec(`
+		UPDATE webhook_event SET attempts = attempts + 1, next_attempt_at = $3
+		WHERE id = $1 AND status = $4 AND next_attempt_at <= $2`,
+		id, now, until, WebhookPending)
+	if err != nil {
+		return false, err
+	}
+	nr, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return nr == 1, nil
+}
+
+// WebhookEventProcessed marks an event processed that was not marked by its booking, e.g. an event that
+// books nothing
+func (db *DB) WebhookEventProcessed(id uuid.UUID, now time.Time) error {
+	_, err := db.Exec(`
+		UPDATE webhook_event SET status = $2, last_error = NULL, processed_at = $3
+		WHERE id = $1 AND status = $4`, id, WebhookProcessed, now, WebhookPending)
+	return err
+}
+
+// processInbox marks the inbox event processed in the transaction of its booking. The row stays locked
+// until the booking commits, so an event that is processed again, e.g. after its lease expired, is not
+// booked twice, its booking is rolled back with ErrWebhookEventProcessed.
+func processInbox(tx *sql.Tx, in *Inbox) error {
+	if in == nil {
+		return nil
+	}
+	var status string
+	err := tx.QueryRow(`SELECT status FROM webhook_event WHERE id = $1 FOR UPDATE`, in.EventId).Scan(&status)
+	if err != nil {
+		return err
+	}
+	if status != WebhookPending {
+		return ErrWebhookEventProcessed
+	}
+	_, err = tx.Exec(`
+		UPDATE webhook_event SET status = $2, last_error = NULL, processed_at = $3
+		WHERE id = $1`, in.EventId, WebhookProcessed, in.Now)
+	return err
+}
+
+// WebhookEventFailed retries the event at nextAttemptAt, or gives up if it is nil. An event that was
+// booked meanwhile stays processed.
+func (db *DB) WebhookEventFailed(id uuid.UUID, errMsg string, nextAttemptAt *time.Time) error {
+	var err error
+	if nextAttemptAt == nil {
+		_, err = db.Exec(`
+			UPDATE webhook_event SET status = $2, last_error = $3
+			WHERE id = $1 AND status = $4`, id, WebhookFailed, errMsg, WebhookPending)
+	} else {
+		_, err = db.Exec(`
+			UPDATE webhook_event SET last_error = $2, next_attempt_at = $3
+			WHERE id = $1 AND status = $4`, id, errMsg, *nextAttemptAt, WebhookPending)
+	}
+	return err
+}
+
+// ReplayWebhookEvent makes a failed event due again, with all its attempts
+func (db *DB) ReplayWebhookEvent(id uuid.UUID, now time.Time) (bool, error) {
+	res, err := db.Exec(`
+		UPDATE webhook_event SET status = $2, attempts = 0, next_attempt_at = $3
+		WHERE id = $1 AND status = $4`, id, WebhookPending, now, WebhookFailed)
+	if err != nil {
+		return false, err
+	}
+	nr, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return nr == 1, nil
+}
@@ -0,0 +1,180 @@
+package db
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func insertTestWebhookEvent(t *testing.T, eventId string, now time.Time) WebhookEvent {
+	e := WebhookEvent{
+		Id:            uuid.New(),
+		Provider:      WebhookMock,
+		EventId:       eventId,
+		EventType:     "succeeded",
+		Payload:       json.RawMessage(`{"type":"succeeded"}`),
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+	ok, err := db.InsertWebhookEvent(e)
+	require.NoError(t, err)
+	require.True(t, ok)
+	return e
+}
+
+func TestWebhookEventDuplicate(t *testing.T) {
+	TruncateAll(db, t)
+
+	now := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	e := insertTestWebhookEvent(t, "evt_1", now)
+
+	//the provider delivers the same event again
+	e2 := e
+	e2.Id = uuid.New()
+	ok, err := db.InsertWebhookEvent(e2)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	//the same event id of another provider is another event
+	e2.Provider = WebhookStripe
+	ok, err = db.InsertWebhookEvent(e2)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	es, err := db.FindWebhookEvents(WebhookPending, 10)
+	require.NoError(t, err)
+	assert.Len(t, es, 2)
+}
+
+func TestWebhookEventClaimLease(t *testing.T) {
+	TruncateAll(db, t)
+
+	now := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	e := insertTestWebhookEvent(t, "evt_1", now)
+	until := now.Add(5 * time.Minute)
+
+	ok, err := db.ClaimWebhookEvent(e.Id, now, until)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	//claimed, it is neither due nor can it be claimed again
+	es, err := db.FindDueWebhookEvents(now.Add(time.Minute), 10)
+	require.NoError(t, err)
+	assert.Len(t, es, 0)
+	ok, err = db.ClaimWebhookEvent(e.Id, now.Add(time.Minute), now.Add(6*time.Minute))
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	//the lease expired, the event is due again
+	es, err = db.FindDueWebhookEvents(until, 10)
+	require.NoError(t, err)
+	assert.Len(t, es, 1)
+	ok, err = db.ClaimWebhookEvent(e.Id, until, until.Add(5*time.Minute))
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	r, err := db.FindWebhookEvent(e.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 2, r.Attempts)
+	assert.Equal(t, WebhookPending, r.Status)
+
+	//a processed event cannot be claimed
+	require.NoError(t, db.WebhookEventProcessed(e.Id, until))
+	ok, err = db.ClaimWebhookEvent(e.Id, until.Add(time.Hour), until.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestWebhookEventFailedAndReplay(t *testing.T) {
+	TruncateAll(db, t)
+
+	now := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	e := insertTestWebhookEvent(t, "evt_1", now)
+
+	//a pending event cannot be replayed
+	ok, err := db.ReplayWebhookEvent(e.Id, now)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = db.ClaimWebhookEvent(e.Id, now, now.Add(5*time.Minute))
+	require.NoError(t, err)
+	require.True(t, ok)
+	retryAt := now.Add(time.Minute)
+	require.NoError(t, db.WebhookEventFailed(e.Id, "timeout", &retryAt))
+
+	r, err := db.FindWebhookEvent(e.Id)
+	require.NoError(t, err)
+	assert.Equal(t, WebhookPending, r.Status)
+	assert.Equal(t, "timeout", *r.LastError)
+	assert.True(t, retryAt.Equal(r.NextAttemptAt))
+
+	//out of attempts
+	require.NoError(t, db.WebhookEventFailed(e.Id, "timeout again", nil))
+	r, err = db.FindWebhookEvent(e.Id)
+	require.NoError(t, err)
+	assert.Equal(t, WebhookFailed, r.Status)
+	es, err := db.FindDueWebhookEvents(now.Add(time.Hour), 10)
+	require.NoError(t, err)
+	assert.Len(t, es, 0)
+
+	later := now.Add(24 * time.Hour)
+	ok, err = db.ReplayWebhookEvent(e.Id, later)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	r, err = db.FindWebhookEvent(e.Id)
+	require.NoError(t, err)
+	assert.Equal(t, WebhookPending, r.Status)
+	assert.Equal(t, 0, r.Attempts)
+	es, err = db.FindDueWebhookEvents(later, 10)
+	require.NoError(t, err)
+	assert.Len(t, es, 1)
+
+	//a processed event is neither failed nor replayed
+	require.NoError(t, db.WebhookEventProcessed(e.Id, later))
+	require.NoError(t, db.WebhookEventFailed(e.Id, "late", nil))
+	ok, err = db.ReplayWebhookEvent(e.Id, later)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	r, err = db.FindWebhookEvent(e.Id)
+	require.NoError(t, err)
+	assert.Equal(t, WebhookProcessed, r.Status)
+}
+
+func TestWebhookEventBookedOnce(t *testing.T) {
+	TruncateAll(db, t)
+
+	now := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	user := createTestUser(t, db, "webhook@example.com")
+	request := PayInEvent{
+		Id:         uuid.New(),
+		ExternalId: uuid.New(),
+		UserId:     user.Id,
+		Balance:    big.NewInt(36500),
+		Currency:   "USD",
+		Status:     PayInRequest,
+		Seats:      1,
+		Freq:       365,
+		CreatedAt:  now,
+	}
+	require.NoError(t, db.InsertPayInEvent(request))
+	e := insertTestWebhookEvent(t, "evt_1", now)
+
+	//the lease of the first run expired, a second run books the same event
+	in := &Inbox{EventId: e.Id, Now: now}
+	require.NoError(t, db.PaymentSuccess(request.ExternalId, big.NewInt(1461), in))
+	err := db.PaymentSuccess(request.ExternalId, big.NewInt(1461), in)
+	assert.ErrorIs(t, err, ErrWebhookEventProcessed)
+
+	balances, err := db.FindSumPaymentByCurrency(user.Id, PayInSuccess)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(36500), balances["USD"])
+	r, err := db.FindWebhookEvent(e.Id)
+	require.NoError(t, err)
+	assert.Equal(t, WebhookProcessed, r.Status)
+	assert.NotNil(t, r.ProcessedAt)
+}
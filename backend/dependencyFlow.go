@@ -0,0 +1,146 @@
+package main
+
+import (
+	"backend/db"
+	"backend/util"
+	"math/big"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// flowToDependencies moves a share of the amount of every sponsored repo down to its dependencies. The
+// dependencies of a dependency get the share reduced by the decay, and so on until maxDepth. It returns
+// the repos to book, including the dependencies, and the new amounts per repo.
+func (c *CalcHandler) flowToDependencies(rids []uuid.UUID, distributeDeduct map[uuid.UUID]*big.Int, distributeAdd map[uuid.UUID]*big.Int, deductFutureContribution map[uuid.UUID]*big.Int) ([]uuid.UUID, map[uuid.UUID]*big.Int, map[uuid.UUID]*big.Int, map[uuid.UUID]*big.Int, []db.DependencyFlow, error) {
+	if c.cfg.DependencyShare <= 0 || c.cfg.DependencyMaxDepth <= 0 {
+		return rids, distributeDeduct, distributeAdd, deductFutureContribution, nil, nil
+	}
+
+	graph, err := loadDependencyGraph(rids, c.cfg.DependencyMaxDepth)
+	if err != nil {
+		return nil, nil, nil, nil, nil, err
+	}
+	if len(graph) == 0 {
+		return rids, distributeDeduct, distributeAdd, deductFutureContribution, nil, nil
+	}
+
+	newDeduct, flows := flowDependencies(distributeDeduct, rids, graph, c.cfg.DependencyShare, c.cfg.DependencyDecay, c.cfg.DependencyMaxDepth)
+	newAdd := newDeduct
+	var newDeductFuture map[uuid.UUID]*big.Int
+	if deductFutureContribution != nil {
+		//the parked money flows the same way as the daily amount
+		newAdd, _ = flowDependencies(distributeAdd, rids, graph, c.cfg.DependencyShare, c.cfg.DependencyDecay, c.cfg.DependencyMaxDepth)
+		newDeductFuture = map[uuid.UUID]*big.Int{}
+		for rid, v := range newAdd {
+			newDeductFuture[rid] = new(big.Int).Neg(v)
+		}
+	}
+
+	allRids := slices.Clone(rids)
+	for _, f := range flows {
+		if !slices.Contains(allRids, f.DepRepoId) {
+			allRids = append(allRids, f.DepRepoId)
+		}
+	}
+	return allRids, newDeduct, newAdd, newDeductFuture, flows, nil
+}
+
+// addDependencyFlows adds the flows to the batch, so they are booked together with the contributions
+// they explain
+func addDependencyFlows(b *db.ContributionBatch, uid uuid.UUID, currency string, yesterdayStart time.Time, flows []db.DependencyFlow) {
+	for _, f := range flows {
+		f.UserSponsorId = uid
+		f.Currency = currency
+		f.Day = yesterdayStart
+		f.CreatedAt = util.TimeNow()
+		b.DependencyFlows = append(b.DependencyFlows, f)
+	}
+}
+
+// loadDependencyGraph loads the dependencies of the repos level by level, up to maxDepth
+func loadDependencyGraph(rids []uuid.UUID, maxDepth int) (map[uuid.UUID][]uuid.UUID, error) {
+	graph := map[uuid.UUID][]uuid.UUID{}
+	seen := map[uuid.UUID]bool{}
+	level := rids
+	for depth := 0; depth < maxDepth && len(level) > 0; depth++ {
+		for _, rid := range level {
+			seen[rid] = true
+		}
+		m, err := db.FindDependencyRepoIds(level)
+		if err != nil {
+			return nil, err
+		}
+		var next []uuid.UUID
+		for rid, deps := range m {
+			graph[rid] = deps
+			for _, dep := range deps {
+				if !seen[dep] && !slices.Contains(next, dep) {
+					next = append(next, dep)
+				}
+			}
+		}
+		level = next
+	}
+	return graph, nil
+}
+
+// flowDependencies passes sharePercent of the amount of each repo in rids equally to its dependencies.
+// A dependency passes on sharePercent * decayPercent of what it received, and so on. A repo never passes
+// money back to a repo on its own path, so cycles in the graph end there. What cannot be split without
+// rounding to zero stays with the repo.
+func flowDependencies(amounts map[uuid.UUID]*big.Int, rids []uuid.UUID, graph map[uuid.UUID][]uuid.UUID, sharePercent int, decayPercent int, maxDepth int) (map[uuid.UUID]*big.Int, []db.DependencyFlow) {
+	res := map[uuid.UUID]*big.Int{}
+	for rid, v := range amounts {
+		res[rid] = new(big.Int).Set(v)
+	}
+
+	var flows []db.DependencyFlow
+	var pass func(root uuid.UUID, from uuid.UUID, amount *big.Int, percent int, path []uuid.UUID)
+	pass = func(root uuid.UUID, from uuid.UUID, amount *big.Int, percent int, path []uuid.UUID) {
+		if len(path) > maxDepth || percent <= 0 {
+			return
+		}
+		var targets []uuid.UUID
+		for _, dep := range graph[from] {
+			if !slices.Contains(path, dep) {
+				targets = append(targets, dep)
+			}
+		}
+		if len(targets) == 0 {
+			return
+		}
+
+		down := new(big.Int).Mul(amount, big.NewInt(int64(percent)))
+		down = down.Div(down, big.NewInt(100))
+		perDep := down.Div(down, big.NewInt(int64(len(targets))))
+		if perDep.Sign() <= 0 {
+			return
+		}
+
+		for _, dep := range targets {
+			res[from] = new(big.Int).Sub(res[from], perDep)
+			if res[dep] == nil {
+				res[dep] = big.NewInt(0)
+			}
+			res[dep] = new(big.Int).Add(res[dep], perDep)
+			flows = append(flows, db.DependencyFlow{
+				RootRepoId: root,
+				RepoId:     from,
+				DepRepoId:  dep,
+				Depth:      len(path),
+				Balance:    perDep,
+			})
+			pass(root, dep, perDep, percent*decayPercent/100, append(slices.Clone(path), dep))
+		}
+	}
+
+	for _, rid := range rids {
+		if amounts[rid] == nil || amounts[rid].Sign() <= 0 {
+			continue
+		}
+		pass(rid, rid, amounts[rid], sharePercent, []uuid.UUID{rid})
+	}
+	return res, flows
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlowDependencies(t *testing.T) {
+	root, dep1, dep2, dep3 := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+
+	t.Run("no dependencies", func(t *testing.T) {
+		res, flows := flowDependencies(map[uuid.UUID]*big.Int{root: big.NewInt(1000)}, []uuid.UUID{root}, nil, 20, 50, 3)
+		assert.Equal(t, big.NewInt(1000), res[root])
+		assert.Len(t, flows, 0)
+	})
+
+	t.Run("share with decay", func(t *testing.T) {
+		graph := map[uuid.UUID][]uuid.UUID{
+			root: {dep1, dep2},
+			dep1: {dep3},
+		}
+		res, flows := flowDependencies(map[uuid.UUID]*big.Int{root: big.NewInt(1000)}, []uuid.UUID{root}, graph, 20, 50, 3)
+		//root passes 20% = 200, 100 each, dep1 passes 10% of 100 to dep3
+		assert.Equal(t, big.NewInt(800), res[root])
+		assert.Equal(t, big.NewInt(90), res[dep1])
+		assert.Equal(t, big.NewInt(100), res[dep2])
+		assert.Equal(t, big.NewInt(10), res[dep3])
+		require.Len(t, flows, 3)
+		assert.Equal(t, 2, flows[1].Depth)
+		assert.Equal(t, root, flows[1].RootRepoId)
+		assert.Equal(t, dep1, flows[1].RepoId)
+	})
+
+	t.Run("cycles and depth limit", func(t *testing.T) {
+		graph := map[uuid.UUID][]uuid.UUID{
+			root: {dep1},
+			dep1: {root, dep2},
+			dep2: {dep3},
+		}
+		res, flows := flowDependencies(map[uuid.UUID]*big.Int{root: big.NewInt(1000)}, []uuid.UUID{root}, graph, 50, 100, 2)
+		assert.Equal(t, big.NewInt(500), res[root])
+		assert.Equal(t, big.NewInt(250), res[dep1])
+		assert.Equal(t, big.NewInt(250), res[dep2])
+		assert.Nil(t, res[dep3])
+		assert.Len(t, flows, 2)
+	})
+
+	t.Run("total stays the same", func(t *testing.T) {
+		graph := map[uuid.UUID][]uuid.UUID{
+			root: {dep1, dep2, dep3},
+			dep1: {dep2},
+		}
+		res, _ := flowDependencies(map[uuid.UUID]*big.Int{root: big.NewInt(997), dep2: big.NewInt(13)}, []uuid.UUID{root, dep2}, graph, 33, 70, 3)
+		total := big.NewInt(0)
+		for _, v := range res {
+			total.Add(total, v)
+		}
+		assert.Equal(t, big.NewInt(1010), total)
+	})
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"backend/client"
+	"backend/db"
+	"backend/util"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ExchangeRateHandler struct {
+	provider client.RateProvider
+}
+
+func NewExchangeRateHandler(provider client.RateProvider) *ExchangeRateHandler {
+	return &ExchangeRateHandler{provider}
+}
+
+// ExchangeRateRunner stores the rates of the day, so balances and payouts can be valued with the rate
+// that was valid on that day. It runs before the DailyRunner.
+func (e *ExchangeRateHandler) ExchangeRateRunner(now time.Time) error {
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	rs, err := e.provider.Rates(day)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range rs {
+		r.Id = uuid.New()
+		r.Day = day
+		r.CreatedAt = util.TimeNow()
+		err = db.InsertExchangeRate(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	slog.Info("Exchange rates stored",
+		slog.Any("day", day),
+		slog.Int("rates", len(rs)))
+	return nil
+}
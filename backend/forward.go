@@ -0,0 +1,151 @@
+package main
+
+import (
+	"backend/db"
+	"backend/util"
+	"log/slog"
+	"math/big"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ForwardHandler struct {
+	maxDepth int
+}
+
+func NewForwardHandler(maxDepth int) *ForwardHandler {
+	return &ForwardHandler{maxDepth}
+}
+
+// ForwardRunner moves the configured percentage of what contributors earned yesterday to other users,
+// or to the contributors of other repos. Forwarded money can be forwarded again up to maxDepth times,
+// and it never goes back to a user that already had it on the way. All forwarded amounts of the day are
+// booked at once, so a failed run leaves nothing behind and the next run forwards the whole day.
+func (f *ForwardHandler) ForwardRunner(now time.Time) error {
+	yesterdayStop := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	yesterdayStart := yesterdayStop.AddDate(0, 0, -1)
+
+	slog.Info("Start forward runner",
+		slog.Any("time-start", yesterdayStart))
+
+	done, err := db.HasForwardContributions(yesterdayStart)
+	if err != nil {
+		return err
+	}
+	if done {
+		slog.Info("Forwarding already done",
+			slog.Any("day", yesterdayStart))
+		return nil
+	}
+
+	rules, err := db.FindAllForwardRules()
+	if err != nil {
+		return err
+	}
+
+	var fcs []db.ForwardContribution
+	for uid := range rules {
+		es, err := db.FindEarningsByDay(uid, yesterdayStart)
+		if err != nil {
+			return err
+		}
+		for _, e := range es {
+			fcs, err = f.forward(fcs, rules, uid, e.RepoId, e.Currency, e.Balance, yesterdayStart, []uuid.UUID{uid})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if len(fcs) == 0 {
+		slog.Info("Nothing to forward",
+			slog.Any("day", yesterdayStart))
+		return nil
+	}
+
+	ok, err := db.InsertForwardContributions(yesterdayStart, fcs)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		slog.Info("Forwarding already done",
+			slog.Any("day", yesterdayStart))
+		return nil
+	}
+
+	slog.Info("Forward runner processed",
+		slog.Int("nr", len(fcs)))
+	return nil
+}
+
+// forward appends the shares of amount according to the rules of uid to fcs. The path contains all
+// users the amount already passed, its length is the depth of the forwarding.
+func (f *ForwardHandler) forward(fcs []db.ForwardContribution, rules map[uuid.UUID][]db.ForwardRule, uid uuid.UUID, repoId uuid.UUID, currency string, amount *big.Int, day time.Time, path []uuid.UUID) ([]db.ForwardContribution, error) {
+	depth := len(path)
+	if depth > f.maxDepth {
+		return fcs, nil
+	}
+
+	for _, r := range rules[uid] {
+		part := new(big.Int).Mul(amount, big.NewInt(r.Percent))
+		part = part.Div(part, big.NewInt(db.MaxForwardPercent))
+		if part.Sign() <= 0 {
+			continue
+		}
+
+		targets, err := forwardTargets(r, part)
+		if err != nil {
+			return nil, err
+		}
+		for to, a := range targets {
+			if slices.Contains(path, to) {
+				slog.Info("Forward cycle detected, keep the amount",
+					slog.String("userId", uid.String()),
+					slog.String("to", to.String()))
+				continue
+			}
+			if a.Sign() <= 0 {
+				continue
+			}
+
+			fcs = append(fcs, db.ForwardContribution{
+				Id:           uuid.New(),
+				UserFromId:   uid,
+				UserToId:     to,
+				RepoId:       repoId,
+				TargetRepoId: r.TargetRepoId,
+				Balance:      a,
+				Currency:     currency,
+				Day:          day,
+				Depth:        depth,
+				CreatedAt:    util.TimeNow(),
+			})
+
+			fcs, err = f.forward(fcs, rules, to, repoId, currency, a, day, append(slices.Clone(path), to))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return fcs, nil
+}
+
+// forwardTargets returns who gets what of the amount. A repo enters the normal distribution and the
+// amount is split among its registered contributors. Without registered contributors nothing is
+// forwarded and the amount stays with the user.
+func forwardTargets(r db.ForwardRule, amount *big.Int) (map[uuid.UUID]*big.Int, error) {
+	if r.TargetUserId != nil {
+		return map[uuid.UUID]*big.Int{*r.TargetUserId: amount}, nil
+	}
+
+	uidInMap, _, total, err := getContributorWeights(*r.TargetRepoId)
+	if err != nil {
+		return nil, err
+	}
+	m := map[uuid.UUID]*big.Int{}
+	for contributorUserId, w := range uidInMap {
+		m[contributorUserId] = calcSharePerUser(amount, w, total)
+	}
+	return m, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"backend/api"
+	"backend/db"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupForwardRule(t *testing.T, userId uuid.UUID, targetUserId *uuid.UUID, targetRepoId *uuid.UUID, percent int64) {
+	err := db.InsertForwardRule(db.ForwardRule{
+		Id:           uuid.New(),
+		UserId:       userId,
+		TargetUserId: targetUserId,
+		TargetRepoId: targetRepoId,
+		Percent:      percent,
+		CreatedAt:    time.Now(),
+	})
+	require.Nil(t, err)
+}
+
+func TestForwardToUser(t *testing.T) {
+	db.SetupTestData()
+	defer db.TeardownTestData()
+
+	sponsors := setupUsers(t, "tom@tom.tom s1")
+	setupFunds(t, *sponsors[0], "USD", 1, 365, api.Plans[1].PriceBase, day1)
+
+	contributors := setupUsers(t, "ste@ste.ste c1", "pea@pea.pea c2")
+	setupGitEmail(t, *contributors[0], "ste@ste.ste")
+
+	repos := setupRepos(t, "tomp2p r1")
+	setupContributor(t, *repos[0], day1, day3, []string{"ste@ste.ste"}, []float64{0.5})
+	err := setupSponsor(t, sponsors[0], repos[0], day1)
+	assert.Nil(t, err)
+
+	setupForwardRule(t, *contributors[0], contributors[1], nil, 50)
+	//pea sends everything back, this must not end in a loop
+	setupForwardRule(t, *contributors[1], contributors[0], nil, 100)
+
+	err = c.DailyRunner(day3)
+	assert.Nil(t, err)
+	fw := NewForwardHandler(3)
+	err = fw.ForwardRunner(day3)
+	assert.Nil(t, err)
+
+	m1, err := db.FindSumDailyContributors(*contributors[0])
+	assert.Nil(t, err)
+	half := new(big.Int).Div(m1["USD"], big.NewInt(2))
+
+	f1, err := db.FindSumForwardBalance(*contributors[0])
+	assert.Nil(t, err)
+	assert.Equal(t, new(big.Int).Neg(half), f1["USD"])
+
+	f2, err := db.FindSumForwardBalance(*contributors[1])
+	assert.Nil(t, err)
+	assert.Equal(t, half, f2["USD"])
+
+	//running twice does not forward twice
+	err = fw.ForwardRunner(day3)
+	assert.Nil(t, err)
+	f2, err = db.FindSumForwardBalance(*contributors[1])
+	assert.Nil(t, err)
+	assert.Equal(t, half, f2["USD"])
+
+	cs, err := db.FindForwardContributions(*contributors[1])
+	assert.Nil(t, err)
+	require.Len(t, cs, 1)
+	assert.True(t, cs[0].Forwarded)
+	assert.Equal(t, "ste@ste.ste c1", cs[0].SponsorEmail)
+}
+
+func TestForwardToRepo(t *testing.T) {
+	db.SetupTestData()
+	defer db.TeardownTestData()
+
+	sponsors := setupUsers(t, "tom@tom.tom s1")
+	setupFunds(t, *sponsors[0], "USD", 1, 365, api.Plans[1].PriceBase, day1)
+
+	contributors := setupUsers(t, "ste@ste.ste c1", "pea@pea.pea c2", "luc@luc.luc c3")
+	setupGitEmail(t, *contributors[0], "ste@ste.ste")
+	setupGitEmail(t, *contributors[1], "pea@pea.pea")
+	setupGitEmail(t, *contributors[2], "luc@luc.luc")
+
+	repos := setupRepos(t, "tomp2p r1", "neow3j r2")
+	setupContributor(t, *repos[0], day1, day3, []string{"ste@ste.ste"}, []float64{0.5})
+	setupContributor(t, *repos[1], day1, day3, []string{"pea@pea.pea", "luc@luc.luc"}, []float64{0.5, 0.5})
+	err := setupSponsor(t, sponsors[0], repos[0], day1)
+	assert.Nil(t, err)
+
+	setupForwardRule(t, *contributors[0], nil, repos[1], 100)
+
+	err = c.DailyRunner(day3)
+	assert.Nil(t, err)
+	err = NewForwardHandler(3).ForwardRunner(day3)
+	assert.Nil(t, err)
+
+	m1, err := db.FindSumDailyContributors(*contributors[0])
+	assert.Nil(t, err)
+	half := new(big.Int).Div(m1["USD"], big.NewInt(2))
+
+	f2, err := db.FindSumForwardBalance(*contributors[1])
+	assert.Nil(t, err)
+	assert.Equal(t, half, f2["USD"])
+
+	f3, err := db.FindSumForwardBalance(*contributors[2])
+	assert.Nil(t, err)
+	assert.Equal(t, half, f3["USD"])
+}
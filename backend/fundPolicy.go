@@ -0,0 +1,408 @@
+package main
+
+import (
+	"backend/client"
+	"backend/db"
+	"backend/util"
+	"log/slog"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type FundPolicyHandler struct {
+	ec         *client.EmailClient
+	policy     string
+	months     int
+	noticeDays int
+	poolEmail  string
+}
+
+type fundPolicyTarget struct {
+	repoId  uuid.UUID
+	weights map[uuid.UUID]float64
+	total   float64
+}
+
+func NewFundPolicyHandler(ec *client.EmailClient, policy string, months int, noticeDays int, poolEmail string) *FundPolicyHandler {
+	return &FundPolicyHandler{ec, policy, months, noticeDays, poolEmail}
+}
+
+// FundPolicyRunner applies the fund policy to money that was parked in future_contribution for longer
+// than the configured months, because nobody of the sponsored repo registered. The expired unclaimed
+// shares of the invited contributors are applied first, then what is left of the parked money. It is
+// scheduled after the DailyRunner and books on the same day, that's why it uses the upsert variants of
+// the inserts.
+func (f *FundPolicyHandler) FundPolicyRunner(now time.Time) error {
+	yesterdayStop := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	yesterdayStart := yesterdayStop.AddDate(0, 0, -1)
+	cutoff := yesterdayStart.AddDate(0, -f.months, 0)
+
+	slog.Info("Start fund policy runner",
+		slog.Any("time-start", yesterdayStart),
+		slog.Any("cutoff", cutoff))
+
+	err := f.notify(yesterdayStart)
+	if err != nil {
+		return err
+	}
+
+	efs, err := db.FindExpiredFutureContributions(cutoff)
+	if err != nil {
+		return err
+	}
+	eus, err := db.FindExpiredUnclaimed(cutoff)
+	if err != nil {
+		return err
+	}
+	nrUnclaimed := 0
+	for _, eu := range capUnclaimed(efs, eus) {
+		u, err := db.FindUserById(eu.UserSponsorId)
+		if err != nil {
+			return err
+		}
+		if u == nil {
+			continue
+		}
+		err = f.apply(f.policyFor(u), eu, yesterdayStart)
+		if err != nil {
+			return err
+		}
+		nrUnclaimed++
+	}
+	_, err = db.ExpireUnclaimed(cutoff, util.TimeNow())
+	if err != nil {
+		return err
+	}
+
+	//what the unclaimed shares did not take
+	efs, err = db.FindExpiredFutureContributions(cutoff)
+	if err != nil {
+		return err
+	}
+
+	nr := 0
+	for uid, currencies := range groupExpired(efs) {
+		u, err := db.FindUserById(uid)
+		if err != nil {
+			return err
+		}
+		if u == nil {
+			continue
+		}
+		policy := f.policyFor(u)
+		for _, ef := range currencies {
+			for _, a := range allocateExpired(ef) {
+				err = f.apply(policy, a, yesterdayStart)
+				if err != nil {
+					return err
+				}
+				nr++
+			}
+		}
+	}
+
+	slog.Info("Fund policy runner processed",
+		slog.Int("nr", nr),
+		slog.Int("unclaimed", nrUnclaimed))
+	return nil
+}
+
+// notify sends one email per notice period to every sponsor with funds that expire until the end of
+// the current period, with the part of it that are unclaimed shares of invited contributors.
+func (f *FundPolicyHandler) notify(yesterdayStart time.Time) error {
+	if f.noticeDays <= 0 {
+		return nil
+	}
+	epochDay := yesterdayStart.Unix() / (24 * 60 * 60)
+	periodStart := epochDay - epochDay%int64(f.noticeDays)
+	runAt := time.Unix((periodStart+int64(f.noticeDays))*24*60*60, 0).UTC()
+
+	efs, err := db.FindExpiredFutureContributions(runAt.AddDate(0, -f.months, 0))
+	if err != nil {
+		return err
+	}
+	eus, err := db.FindExpiredUnclaimed(runAt.AddDate(0, -f.months, 0))
+	if err != nil {
+		return err
+	}
+	unclaimed := map[uuid.UUID]map[string]*big.Int{}
+	for _, eu := range capUnclaimed(efs, eus) {
+		if unclaimed[eu.UserSponsorId] == nil {
+			unclaimed[eu.UserSponsorId] = map[string]*big.Int{}
+		}
+		if unclaimed[eu.UserSponsorId][eu.Currency] == nil {
+			unclaimed[eu.UserSponsorId][eu.Currency] = big.NewInt(0)
+		}
+		unclaimed[eu.UserSponsorId][eu.Currency] = new(big.Int).Add(unclaimed[eu.UserSponsorId][eu.Currency], eu.Balance)
+	}
+
+	for uid, currencies := range groupExpired(efs) {
+		balances := map[string]*big.Int{}
+		for currency, ef := range currencies {
+			for _, a := range allocateExpired(ef) {
+				if balances[currency] == nil {
+					balances[currency] = big.NewInt(0)
+				}
+				balances[currency] = new(big.Int).Add(balances[currency], a.Balance)
+			}
+		}
+		if len(balances) == 0 {
+			continue
+		}
+
+		u, err := db.FindUserById(uid)
+		if err != nil {
+			return err
+		}
+		if u == nil {
+			continue
+		}
+		err = f.ec.SendFundPolicyNotice(*u, f.policyFor(u), balances, unclaimed[uid], runAt)
+		if err != nil {
+			slog.Warn("Could not send fund policy notice",
+				slog.String("userId", uid.String()),
+				slog.Any("error", err))
+		}
+	}
+	return nil
+}
+
+func (f *FundPolicyHandler) policyFor(u *db.UserDetail) string {
+	if u.FundPolicy != nil && db.IsValidFundPolicy(*u.FundPolicy) {
+		return *u.FundPolicy
+	}
+	return f.policy
+}
+
+// apply books the policy for the expired fund in one transaction
+func (f *FundPolicyHandler) apply(policy string, ef db.ExpiredFund, day time.Time) error {
+	var b db.FundPolicyBooking
+	var ok bool
+	var err error
+	switch policy {
+	case db.FundPolicyRedistribute:
+		ok, err = f.redistribute(&b, ef, day)
+	case db.FundPolicyDonate:
+		ok, err = f.donate(&b, ef, day)
+	}
+	if err != nil {
+		return err
+	}
+	if !ok {
+		//the default, and the fallback if no target could be found
+		f.refund(&b, ef, day)
+	}
+	return db.BookFundPolicy(b)
+}
+
+func (f *FundPolicyHandler) refund(b *db.FundPolicyBooking, ef db.ExpiredFund, day time.Time) {
+	slog.Info("Fund policy refund",
+		slog.String("userId", ef.UserSponsorId.String()),
+		slog.String("rid", ef.RepoId.String()),
+		slog.String("amount", ef.Balance.String()))
+	b.FutureContributions = append(b.FutureContributions, parkedDeduction(ef, ef.Balance, day))
+	b.Events = append(b.Events, fundPolicyEvent(ef, db.FundPolicyRefund, nil, &ef.UserSponsorId, ef.Balance, day))
+}
+
+// redistribute splits the expired funds equally among the other sponsored repos of the sponsor
+// that have registered contributors, and within a repo according to the contributor weights.
+func (f *FundPolicyHandler) redistribute(b *db.FundPolicyBooking, ef db.ExpiredFund, day time.Time) (bool, error) {
+	repos, err := db.FindSponsoredReposByUserId(ef.UserSponsorId)
+	if err != nil {
+		return false, err
+	}
+	var rids []uuid.UUID
+	for _, r := range repos {
+		if r.Id != ef.RepoId {
+			rids = append(rids, r.Id)
+		}
+	}
+	ok, err := f.distribute(b, ef, rids, db.FundPolicyRedistribute, day)
+	if err == nil && !ok {
+		slog.Info("No repo to redistribute to, refund instead",
+			slog.String("userId", ef.UserSponsorId.String()))
+	}
+	return ok, err
+}
+
+// distribute splits the expired funds equally among the repos that have registered contributors, and
+// within a repo according to the contributor weights. It returns false if no repo has contributors.
+func (f *FundPolicyHandler) distribute(b *db.FundPolicyBooking, ef db.ExpiredFund, rids []uuid.UUID, policy string, day time.Time) (bool, error) {
+	var targets []fundPolicyTarget
+	for _, rid := range rids {
+		if rid == ef.RepoId {
+			continue
+		}
+		uidInMap, _, total, err := getContributorWeights(rid)
+		if err != nil {
+			return false, err
+		}
+		if len(uidInMap) > 0 {
+			targets = append(targets, fundPolicyTarget{repoId: rid, weights: uidInMap, total: total})
+		}
+	}
+	if len(targets) == 0 {
+		return false, nil
+	}
+
+	perRepo := new(big.Int).Div(ef.Balance, big.NewInt(int64(len(targets))))
+	distributed := big.NewInt(0)
+	for _, t := range targets {
+		repoSum := big.NewInt(0)
+		for contributorUserId, w := range t.weights {
+			amount := calcSharePerUser(perRepo, w, t.total)
+			b.Contributions = append(b.Contributions, fundPolicyContribution(ef, contributorUserId, t.repoId, amount, day))
+			repoSum = new(big.Int).Add(repoSum, amount)
+		}
+		b.Events = append(b.Events, fundPolicyEvent(ef, policy, &t.repoId, nil, repoSum, day))
+		distributed = new(big.Int).Add(distributed, repoSum)
+	}
+
+	//only deduct what was distributed, the rounding rest stays parked
+	b.FutureContributions = append(b.FutureContributions, parkedDeduction(ef, distributed, day))
+	return true, nil
+}
+
+// donate gives the expired funds to the dependencies of the repo that have registered contributors, the
+// same way as redistribute does. If there are none, they go to the foundation pool.
+func (f *FundPolicyHandler) donate(b *db.FundPolicyBooking, ef db.ExpiredFund, day time.Time) (bool, error) {
+	deps, err := db.FindDependencyRepoIds([]uuid.UUID{ef.RepoId})
+	if err != nil {
+		return false, err
+	}
+	ok, err := f.distribute(b, ef, deps[ef.RepoId], db.FundPolicyDonate, day)
+	if err != nil || ok {
+		return ok, err
+	}
+
+	if f.poolEmail == "" {
+		slog.Info("No foundation pool configured, refund instead",
+			slog.String("userId", ef.UserSponsorId.String()))
+		return false, nil
+	}
+	pool, err := db.FindUserByEmail(f.poolEmail)
+	if err != nil {
+		return false, err
+	}
+	if pool == nil {
+		slog.Warn("Foundation pool user not found, refund instead",
+			slog.String("email", f.poolEmail))
+		return false, nil
+	}
+
+	b.Contributions = append(b.Contributions, fundPolicyContribution(ef, pool.Id, ef.RepoId, ef.Balance, day))
+	b.FutureContributions = append(b.FutureContributions, parkedDeduction(ef, ef.Balance, day))
+	b.Events = append(b.Events, fundPolicyEvent(ef, db.FundPolicyDonate, nil, &pool.Id, ef.Balance, day))
+	return true, nil
+}
+
+func fundPolicyContribution(ef db.ExpiredFund, contributorUserId uuid.UUID, repoId uuid.UUID, balance *big.Int, day time.Time) db.BatchContribution {
+	return db.BatchContribution{
+		UserSponsorId:     ef.UserSponsorId,
+		UserContributorId: contributorUserId,
+		RepoId:            repoId,
+		Balance:           balance,
+		Currency:          ef.Currency,
+		Day:               day,
+		CreatedAt:         util.TimeNow(),
+	}
+}
+
+// parkedDeduction takes the balance from the parked funds of the expired fund
+func parkedDeduction(ef db.ExpiredFund, balance *big.Int, day time.Time) db.BatchFutureContribution {
+	return db.BatchFutureContribution{
+		UserSponsorId: ef.UserSponsorId,
+		RepoId:        ef.RepoId,
+		Balance:       new(big.Int).Neg(balance),
+		Currency:      ef.Currency,
+		Day:           day,
+		CreatedAt:     util.TimeNow(),
+	}
+}
+
+func fundPolicyEvent(ef db.ExpiredFund, policy string, targetRepoId *uuid.UUID, targetUserId *uuid.UUID, balance *big.Int, day time.Time) db.FundPolicyEvent {
+	return db.FundPolicyEvent{
+		Id:            uuid.New(),
+		UserSponsorId: ef.UserSponsorId,
+		RepoId:        ef.RepoId,
+		Policy:        policy,
+		TargetRepoId:  targetRepoId,
+		TargetUserId:  targetUserId,
+		Balance:       balance,
+		Currency:      ef.Currency,
+		Day:           day,
+		CreatedAt:     util.TimeNow(),
+	}
+}
+
+func groupExpired(efs []db.ExpiredFund) map[uuid.UUID]map[string][]db.ExpiredFund {
+	m := map[uuid.UUID]map[string][]db.ExpiredFund{}
+	for _, ef := range efs {
+		if m[ef.UserSponsorId] == nil {
+			m[ef.UserSponsorId] = map[string][]db.ExpiredFund{}
+		}
+		m[ef.UserSponsorId][ef.Currency] = append(m[ef.UserSponsorId][ef.Currency], ef)
+	}
+	return m
+}
+
+// capUnclaimed returns the expired unclaimed shares the policy applies to. The shares are paid from the
+// parked funds of the repo, so each one is at most what is expired of the parked funds of its repo.
+func capUnclaimed(efs []db.ExpiredFund, eus []db.ExpiredFund) []db.ExpiredFund {
+	type key struct {
+		userSponsorId uuid.UUID
+		repoId        uuid.UUID
+		currency      string
+	}
+	parked := map[key]*big.Int{}
+	for _, currencies := range groupExpired(efs) {
+		for _, ef := range currencies {
+			for _, a := range allocateExpired(ef) {
+				parked[key{a.UserSponsorId, a.RepoId, a.Currency}] = a.Balance
+			}
+		}
+	}
+
+	var res []db.ExpiredFund
+	for _, eu := range eus {
+		p := parked[key{eu.UserSponsorId, eu.RepoId, eu.Currency}]
+		if p == nil || p.Sign() <= 0 || eu.Balance.Sign() <= 0 {
+			continue
+		}
+		if eu.Balance.Cmp(p) > 0 {
+			eu.Balance = new(big.Int).Set(p)
+		}
+		res = append(res, eu)
+	}
+	return res
+}
+
+// allocateExpired takes the expired funds of one sponsor in one currency. Repos can have a negative
+// value if parked money was distributed to them, so only the sum over all repos is expired, and this
+// sum is taken from the repos with a positive value.
+func allocateExpired(efs []db.ExpiredFund) []db.ExpiredFund {
+	total := big.NewInt(0)
+	for _, ef := range efs {
+		total = new(big.Int).Add(total, ef.Balance)
+	}
+
+	var res []db.ExpiredFund
+	for _, ef := range efs {
+		if total.Sign() <= 0 {
+			break
+		}
+		if ef.Balance.Sign() <= 0 {
+			continue
+		}
+		amount := ef.Balance
+		if amount.Cmp(total) > 0 {
+			amount = total
+		}
+		ef.Balance = new(big.Int).Set(amount)
+		res = append(res, ef)
+		total = new(big.Int).Sub(total, amount)
+	}
+	return res
+}
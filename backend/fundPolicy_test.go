@@ -0,0 +1,86 @@
+package main
+
+import (
+	"backend/db"
+	"math/big"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllocateExpired(t *testing.T) {
+	sponsor := uuid.New()
+	r1 := uuid.New()
+	r2 := uuid.New()
+	r3 := uuid.New()
+
+	t.Run("all positive", func(t *testing.T) {
+		res := allocateExpired([]db.ExpiredFund{
+			{UserSponsorId: sponsor, RepoId: r1, Balance: big.NewInt(100), Currency: "USD"},
+			{UserSponsorId: sponsor, RepoId: r2, Balance: big.NewInt(50), Currency: "USD"},
+		})
+		require.Len(t, res, 2)
+		assert.Equal(t, big.NewInt(100), res[0].Balance)
+		assert.Equal(t, big.NewInt(50), res[1].Balance)
+	})
+
+	t.Run("parked money already distributed to another repo", func(t *testing.T) {
+		res := allocateExpired([]db.ExpiredFund{
+			{UserSponsorId: sponsor, RepoId: r1, Balance: big.NewInt(100), Currency: "USD"},
+			{UserSponsorId: sponsor, RepoId: r2, Balance: big.NewInt(-60), Currency: "USD"},
+			{UserSponsorId: sponsor, RepoId: r3, Balance: big.NewInt(30), Currency: "USD"},
+		})
+		require.Len(t, res, 1)
+		assert.Equal(t, r1, res[0].RepoId)
+		assert.Equal(t, big.NewInt(70), res[0].Balance)
+	})
+
+	t.Run("nothing left", func(t *testing.T) {
+		res := allocateExpired([]db.ExpiredFund{
+			{UserSponsorId: sponsor, RepoId: r1, Balance: big.NewInt(100), Currency: "USD"},
+			{UserSponsorId: sponsor, RepoId: r2, Balance: big.NewInt(-100), Currency: "USD"},
+		})
+		assert.Len(t, res, 0)
+	})
+}
+
+func TestGroupExpired(t *testing.T) {
+	s1 := uuid.New()
+	s2 := uuid.New()
+	m := groupExpired([]db.ExpiredFund{
+		{UserSponsorId: s1, RepoId: uuid.New(), Balance: big.NewInt(1), Currency: "USD"},
+		{UserSponsorId: s1, RepoId: uuid.New(), Balance: big.NewInt(2), Currency: "ETH"},
+		{UserSponsorId: s1, RepoId: uuid.New(), Balance: big.NewInt(3), Currency: "USD"},
+		{UserSponsorId: s2, RepoId: uuid.New(), Balance: big.NewInt(4), Currency: "USD"},
+	})
+	assert.Len(t, m, 2)
+	assert.Len(t, m[s1]["USD"], 2)
+	assert.Len(t, m[s1]["ETH"], 1)
+	assert.Len(t, m[s2]["USD"], 1)
+}
+
+func TestCapUnclaimed(t *testing.T) {
+	sponsor := uuid.New()
+	r1 := uuid.New()
+	r2 := uuid.New()
+	r3 := uuid.New()
+	efs := []db.ExpiredFund{
+		{UserSponsorId: sponsor, RepoId: r1, Balance: big.NewInt(100), Currency: "USD"},
+		{UserSponsorId: sponsor, RepoId: r2, Balance: big.NewInt(40), Currency: "USD"},
+	}
+
+	//every invited contributor sees a share of the parked funds, together at most what is parked
+	res := capUnclaimed(efs, []db.ExpiredFund{
+		{UserSponsorId: sponsor, RepoId: r1, Balance: big.NewInt(150), Currency: "USD"},
+		{UserSponsorId: sponsor, RepoId: r2, Balance: big.NewInt(30), Currency: "USD"},
+		{UserSponsorId: sponsor, RepoId: r2, Balance: big.NewInt(30), Currency: "ETH"},
+		{UserSponsorId: sponsor, RepoId: r3, Balance: big.NewInt(30), Currency: "USD"},
+	})
+	require.Len(t, res, 2)
+	assert.Equal(t, r1, res[0].RepoId)
+	assert.Equal(t, big.NewInt(100), res[0].Balance)
+	assert.Equal(t, r2, res[1].RepoId)
+	assert.Equal(t, big.NewInt(30), res[1].Balance)
+}
@@ -18,10 +18,13 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/MatusOllah/slogcolor"
 	"github.com/dimiro1/banner"
+	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/fatih/color"
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
@@ -85,9 +88,77 @@ func parseFlags() {
 	flag.StringVar(&cfg.AnalyzerUsername, "analyzer-username", util.LookupEnv("ANALYZER_USERNAME"), "Username to analysis engine")
 	flag.StringVar(&cfg.AnalyzerPassword, "analyzer-password", util.LookupEnv("ANALYZER_PASSWORD"), "Password to analysis engine")
 
-	flag.StringVar(&cfg.NEOPrivateKey, "neo-private-key", util.LookupEnv("NEO_PRIVATE_KEY"), "NEO private key")
+	flag.StringVar(&cfg.NEOPrivateKey, "neo-private-key", util.LookupEnv("NEO_PRIVATE_KEY"), "NEO private key in WIF, signs the GAS payouts")
 	flag.StringVar(&cfg.ETHPrivateKey, "eth-private-key", util.LookupEnv("ETH_PRIVATE_KEY"), "Ethereum private key")
 	flag.StringVar(&cfg.ETHContractAddress, "eth-contract-address", util.LookupEnv("ETH_CONTRACT_ADDRESS"), "Ethereum contract address")
+	flag.StringVar(&cfg.USDCContractAddress, "usdc-contract-address", util.LookupEnv("USDC_CONTRACT_ADDRESS"), "Address of the payout contract of USDC")
+	flag.IntVar(&cfg.EthChainId, "eth-chain-id", util.LookupEnvInt("ETH_CHAIN_ID",
+		1), "Chain id of the payout contracts, part of the EIP-712 domain of the signatures")
+	flag.IntVar(&cfg.PayoutSignatureDays, "payout-signature-days", util.LookupEnvInt("PAYOUT_SIGNATURE_DAYS",
+		30), "Days a payout signature on Ethereum can be withdrawn with")
+	flag.IntVar(&cfg.PayoutAddressCooldownDays, "payout-address-cooldown-days", util.LookupEnvInt("PAYOUT_ADDRESS_COOLDOWN_DAYS",
+		2), "Days until a payout address added next to a confirmed one can be paid out to")
+	flag.StringVar(&cfg.EthRpcUrl, "eth-rpc-url", util.LookupEnv("ETH_RPC_URL"), "Ethereum RPC the withdrawals of the payout contracts are read from, none are read if empty")
+	flag.IntVar(&cfg.EthStartBlock, "eth-start-block", util.LookupEnvInt("ETH_START_BLOCK",
+		0), "Block the withdrawals are read from on the first run, 0 to start at the current block")
+	flag.IntVar(&cfg.PayoutConfirmations, "payout-confirmations", util.LookupEnvInt("PAYOUT_CONFIRMATIONS",
+		12), "Blocks on top of a withdrawal before it is recorded")
+
+	flag.StringVar(&cfg.FundPolicy, "fund-policy", util.LookupEnv("FUND_POLICY",
+		db.FundPolicyRefund), "Policy for expired escrowed and unclaimed funds: REFUND, REDISTRIBUTE or DONATE to the dependencies of the repo, or the foundation pool if it has none")
+	flag.IntVar(&cfg.FundPolicyMonths, "fund-policy-months", util.LookupEnvInt("FUND_POLICY_MONTHS",
+		3), "Months until escrowed funds of a repo without registered contributors expire")
+	flag.IntVar(&cfg.FundPolicyNoticeDays, "fund-policy-notice-days", util.LookupEnvInt("FUND_POLICY_NOTICE_DAYS",
+		14), "Days sponsors are notified before the fund policy runs")
+	flag.StringVar(&cfg.FundPolicyPoolEmail, "fund-policy-pool-email", util.LookupEnv("FUND_POLICY_POOL_EMAIL"), "Email of the foundation pool account that receives donated funds")
+	flag.IntVar(&cfg.ForwardMaxDepth, "forward-max-depth", util.LookupEnvInt("FORWARD_MAX_DEPTH",
+		3), "How many times earnings can be passed on by forward rules")
+	flag.IntVar(&cfg.DependencyShare, "dependency-share", util.LookupEnvInt("DEPENDENCY_SHARE",
+		0), "Percent of the daily amount of a repo that flows to its dependencies, 0 to disable")
+	flag.IntVar(&cfg.DependencyDecay, "dependency-decay", util.LookupEnvInt("DEPENDENCY_DECAY",
+		50), "Percent of the share a dependency passes on to its own dependencies")
+	flag.IntVar(&cfg.DependencyMaxDepth, "dependency-max-depth", util.LookupEnvInt("DEPENDENCY_MAX_DEPTH",
+		3), "How deep the daily amount flows down the dependency graph")
+
+	flag.StringVar(&cfg.SpendingStrategy, "spending-strategy", util.LookupEnv("SPENDING_STRATEGY",
+		db.SpendingMax), "How balances in several currencies are spent: MAX, PROPORTIONAL, CHEAPEST or PREFERRED")
+	flag.StringVar(&cfg.SpendingCostOrder, "spending-cost-order", util.LookupEnv("SPENDING_COST_ORDER",
+		"USD,USDC,ETH,GAS,NEO"), "Currencies from the cheapest to the most expensive, used by the CHEAPEST strategy")
+
+	flag.StringVar(&cfg.ExchangeRateFile, "exchange-rate-file", util.LookupEnv("EXCHANGE_RATE_FILE"), "JSON file with exchange rates for tests and development, no rates are fetched if empty")
+	flag.StringVar(&cfg.ExchangeRateBase, "exchange-rate-base", util.LookupEnv("EXCHANGE_RATE_BASE",
+		"USD"), "Currency that rates are converted over and that payouts record their rate to")
+
+	flag.StringVar(&cfg.CronDaily, "cron-daily", util.LookupEnv("CRON_DAILY",
+		"@daily"), "Cron expression of the daily jobs, e.g. 0 0 * * * or @daily")
+	flag.StringVar(&cfg.CronHourly, "cron-hourly", util.LookupEnv("CRON_HOURLY",
+		"@hourly"), "Cron expression of the hourly jobs, e.g. 0 * * * * or @hourly")
+	flag.StringVar(&cfg.CronWebhook, "cron-webhook", util.LookupEnv("CRON_WEBHOOK",
+		"* * * * *"), "Cron expression of the webhook runner that processes the stored webhook events")
+	flag.IntVar(&cfg.WebhookMaxAttempts, "webhook-max-attempts", util.LookupEnvInt("WEBHOOK_MAX_ATTEMPTS",
+		10), "How often a webhook event is processed before it fails and needs a replay")
+	flag.StringVar(&cfg.CronPayoutBatch, "cron-payout-batch", util.LookupEnv("CRON_PAYOUT_BATCH"),
+		"Cron expression of the runner that signs the requested payouts in batches, only admins batch them if empty")
+	flag.StringVar(&cfg.CronPayoutWatch, "cron-payout-watch", util.LookupEnv("CRON_PAYOUT_WATCH",
+		"* * * * *"), "Cron expression of the runner that reads the withdrawals of the payout contracts")
+	flag.IntVar(&cfg.DailyWorkers, "daily-workers", util.LookupEnvInt("DAILY_WORKERS",
+		4), "How many sponsors the daily runner books at the same time")
+	flag.IntVar(&cfg.ArchiveMonths, "archive-months", util.LookupEnvInt("ARCHIVE_MONTHS",
+		0), "Months the daily contributions are kept before they are moved to the archive, 0 to never archive")
+
+	flag.IntVar(&cfg.SubscriptionRenewDays, "subscription-renew-days", util.LookupEnvInt("SUBSCRIPTION_RENEW_DAYS",
+		7), "Days before the balance runs out that the subscription is renewed")
+	flag.StringVar(&cfg.SubscriptionRetryDays, "subscription-retry-days", util.LookupEnv("SUBSCRIPTION_RETRY_DAYS",
+		"1,3,5"), "Days after a failed renewal that it is retried, one entry per retry")
+	flag.IntVar(&cfg.SubscriptionGraceDays, "subscription-grace-days", util.LookupEnvInt("SUBSCRIPTION_GRACE_DAYS",
+		7), "Days the sponsoring continues after the last retry failed, before the subscription is canceled")
+	flag.StringVar(&cfg.ChargebackClawback, "chargeback-clawback", util.LookupEnv("CHARGEBACK_CLAWBACK",
+		db.ClawbackParked), "What is taken back after a refund or dispute: NONE, PARKED or UNCLAIMED")
+	flag.StringVar(&cfg.PaymentProvider, "payment-provider", util.LookupEnv("PAYMENT_PROVIDER",
+		db.WebhookStripe), "Provider that renews the subscriptions: STRIPE, or MOCK to run payments without stripe in local and dev")
+	flag.StringVar(&cfg.BankIban, "bank-iban", util.LookupEnv("BANK_IBAN"), "IBAN that sponsors pay bank transfers to, bank transfers are disabled if empty")
+	flag.StringVar(&cfg.BankBic, "bank-bic", util.LookupEnv("BANK_BIC"), "BIC of the bank account")
+	flag.StringVar(&cfg.BankAccountHolder, "bank-account-holder", util.LookupEnv("BANK_ACCOUNT_HOLDER"), "Holder of the bank account")
 
 	flag.Usage = func() {
 		fmt.Printf("Usage of %s:\n", os.Args[0])
@@ -121,6 +192,24 @@ func parseFlags() {
 	if cfg.EmailFrom == "" {
 		cfg.EmailFrom = "info@flatfeestack.io"
 	}
+
+	if !db.IsValidFundPolicy(cfg.FundPolicy) {
+		slog.Error("Unknown fund policy, falling back to refund",
+			slog.String("policy", cfg.FundPolicy))
+		cfg.FundPolicy = db.FundPolicyRefund
+	}
+
+	if !db.IsValidClawback(cfg.ChargebackClawback) {
+		slog.Error("Unknown chargeback clawback, falling back to parked",
+			slog.String("clawback", cfg.ChargebackClawback))
+		cfg.ChargebackClawback = db.ClawbackParked
+	}
+
+	if cfg.PaymentProvider != db.WebhookStripe && (cfg.PaymentProvider != db.WebhookMock || !debug) {
+		slog.Error("Unknown payment provider, falling back to stripe",
+			slog.String("provider", cfg.PaymentProvider))
+		cfg.PaymentProvider = db.WebhookStripe
+	}
 }
 
 func middlewareJwtAuthUserLog(handlerFunc func(http.ResponseWriter, *http.Request, *db.UserDetail)) func(w http.ResponseWriter, r *http.Request) {
@@ -149,6 +238,25 @@ func middlewareJwtAuthAdminLog(handlerFunc func(http.ResponseWriter, *http.Reque
 	return middlewareJwtAuthUserLog(fn)
 }
 
+func scheduleJob(name string, expr string, job func(now time.Time) error) {
+	err := cron.CronJob(name, expr, job, util.TimeNow())
+	if err != nil {
+		slog.Error("Could not schedule job",
+			slog.String("name", name),
+			slog.Any("error", err))
+		os.Exit(1)
+	}
+}
+
+// cronOwner identifies this instance in the leader lease of the scheduler
+func cronOwner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "backend"
+	}
+	return host + "-" + uuid.NewString()
+}
+
 // @title To run locally, set these ENV vars=LD_PRELOAD=/usr/local/lib/faketime/libfaketime.so.1;FAKETIME_NO_CACHE=1
 // @version 0.0.1
 // @host localhost:8080
@@ -168,10 +276,33 @@ func main() {
 
 	ah := api2.NewApiHandler(cfg.StripeAPIPublicKey, cfg.Env)
 	nh := api2.NewPaymentNowHandler(ec, cfg.NowpaymentsApiUrl, cfg.NowpaymentsToken, cfg.NowpaymentsIpnCallbackUrl, cfg.NowpaymentsIpnKey)
-	sh := api2.NewPaymentHandler(ec, cfg.StripeAPISecretKey, cfg.StripeWebhookSecretKey)
+	sp := api2.NewSubscriptionPolicy(cfg.SubscriptionRetryDays, cfg.SubscriptionGraceDays)
+	cp := api2.NewChargebackPolicy(cfg.ChargebackClawback, cfg.AdminsParsed)
+	sh := api2.NewPaymentHandler(ec, cfg.StripeAPISecretKey, cfg.StripeWebhookSecretKey, sp, cp)
+	mh := api2.NewPaymentMockHandler(ec, sp, cp)
+	ps := []api2.PaymentProvider{sh, nh}
+	if cfg.BankIban != "" {
+		ps = append(ps, api2.NewPaymentBankHandler(ec, sp, cfg.BankIban, cfg.BankBic, cfg.BankAccountHolder))
+	}
+	if debug {
+		ps = append(ps, mh)
+	}
+	pp := api2.NewPaymentProviders(ps...)
 	rh := api2.NewRepoHandler(ac, gc)
 	eh := api2.NewEmailHandler(ec)
+	st := api2.NewStatementHandler(ec)
 	rr := api2.NewResourceHandler(cfg)
+	payoutContracts := map[string]string{"ETH": cfg.ETHContractAddress, "USD": cfg.USDCContractAddress}
+	var signers []api2.PayoutSigner
+	if cfg.ETHPrivateKey != "" {
+		signers = append(signers, api2.NewEthSigner(cfg.ETHPrivateKey, int64(cfg.EthChainId), payoutContracts))
+	}
+	if cfg.NEOPrivateKey != "" {
+		signers = append(signers, api2.NewNeoSigner(cfg.NEOPrivateKey))
+	}
+	pa := api2.NewPayoutAddressHandler(ec, cfg.EmailLinkPrefix, int64(cfg.EthChainId),
+		time.Duration(cfg.PayoutAddressCooldownDays)*24*time.Hour)
+	ph := api2.NewPayoutHandler(cfg.ExchangeRateBase, time.Duration(cfg.PayoutSignatureDays)*24*time.Hour, signers...)
 
 	f, err := os.Open("banner.txt")
 	if err == nil {
@@ -194,6 +325,20 @@ func main() {
 		os.Exit(1)
 	}
 
+	c := NewCalcHandler(ac, ec, cfg)
+	fw := NewForwardHandler(cfg.ForwardMaxDepth)
+	rp := NewReplayHandler(c, fw)
+	//commands after the flags run once and exit, e.g. backend replay -from 2026-10-01 -to 2026-10-05
+	if flag.NArg() > 0 {
+		err = runReplayCommand(rp, flag.Args())
+		if err != nil {
+			slog.Error("Command failed", slog.String("command", flag.Arg(0)), slog.Any("error", err))
+			os.Exit(1)
+		}
+		return
+	}
+	rph := api2.NewReplayHandler(rp)
+
 	//stripe.Key = cfg.StripeAPISecretKey
 
 	credentials := util.Credentials{
@@ -212,23 +357,48 @@ func main() {
 	router.HandleFunc("PUT /users/me/method/{method}", middlewareJwtAuthUserLog(api2.UpdateMethod))
 	router.HandleFunc("DELETE /users/me/method", middlewareJwtAuthUserLog(api2.DeleteMethod))
 	router.HandleFunc("GET /users/me/sponsored", middlewareJwtAuthUserLog(api2.GetSponsoredRepos))
+	router.HandleFunc("GET /users/me/sponsored-weights", middlewareJwtAuthUserLog(api2.GetSponsorWeights))
+	router.HandleFunc("PUT /users/me/sponsored-weights", middlewareJwtAuthUserLog(api2.UpdateSponsorWeights))
+	router.HandleFunc("DELETE /users/me/sponsored-weights", middlewareJwtAuthUserLog(api2.DeleteSponsorWeights))
 	router.HandleFunc("GET /users/me/multiplied", middlewareJwtAuthUserLog(api2.GetMultipliedRepos))
 	router.HandleFunc("PUT /users/me/name/{name}", middlewareJwtAuthUserLog(api2.UpdateName))
 	router.HandleFunc("PUT /users/me/multiplier/{isSet}", middlewareJwtAuthUserLog(api2.UpdateMultiplierApi))
 	router.HandleFunc("PUT /users/me/multiplierDailyLimit/{amount}", middlewareJwtAuthUserLog(api2.UpdateMultiplierDailyLimitApi))
 	router.HandleFunc("POST /users/me/image", util2.MaxBytes(middlewareJwtAuthUserLog(api2.UpdateImage), 256*1024))
 	router.HandleFunc("DELETE /users/me/image", middlewareJwtAuthUserLog(api2.DeleteImage))
-	router.HandleFunc("POST /users/me/request-payout/{targetCurrency}", middlewareJwtAuthUserLog(rr.RequestPayout))
+	router.HandleFunc("POST /users/me/request-payout/{targetCurrency}", middlewareJwtAuthUserLog(ph.RequestPayout))
+	router.HandleFunc("GET /users/me/payouts/withdrawals", middlewareJwtAuthUserLog(api2.PayoutWithdrawals))
+	router.HandleFunc("GET /users/me/payout-addresses", middlewareJwtAuthUserLog(api2.PayoutAddresses))
+	router.HandleFunc("POST /users/me/payout-addresses/confirm", middlewareJwtAuthUserLog(pa.ConfirmPayoutAddress))
+	router.HandleFunc("POST /users/me/payout-addresses/{chain}/challenge", middlewareJwtAuthUserLog(pa.PayoutAddressChallenge))
+	router.HandleFunc("POST /users/me/payout-addresses/{id}/verify", middlewareJwtAuthUserLog(pa.VerifyPayoutAddress))
+	router.HandleFunc("PUT /users/me/payout-addresses/{id}/default/{currency}", middlewareJwtAuthUserLog(pa.UpdatePayoutAddressDefault))
+	router.HandleFunc("DELETE /users/me/payout-addresses/{id}", middlewareJwtAuthUserLog(api2.DeletePayoutAddress))
 	router.HandleFunc("GET /users/me/balance", middlewareJwtAuthUserLog(api2.UserBalance))
+	router.HandleFunc("GET /users/me/balance/summary", middlewareJwtAuthUserLog(rr.UserBalanceSummary))
+	router.HandleFunc("PUT /users/me/spending-strategy/{strategy}", middlewareJwtAuthUserLog(api2.UpdateSpendingStrategy))
+	router.HandleFunc("DELETE /users/me/spending-strategy", middlewareJwtAuthUserLog(api2.DeleteSpendingStrategy))
+	router.HandleFunc("PUT /users/me/display-currency/{currency}", middlewareJwtAuthUserLog(api2.UpdateDisplayCurrency))
+	router.HandleFunc("DELETE /users/me/display-currency", middlewareJwtAuthUserLog(api2.DeleteDisplayCurrency))
+	router.HandleFunc("GET /users/me/payouts", middlewareJwtAuthUserLog(rr.PayoutRequests))
 	router.HandleFunc("GET /users/me/balanceFoundation", middlewareJwtAuthUserLog(api2.FoundationBalance))
+	router.HandleFunc("GET /users/me/fund-policy", middlewareJwtAuthUserLog(api2.FundPolicyEvents))
+	router.HandleFunc("PUT /users/me/fund-policy/{policy}", middlewareJwtAuthUserLog(api2.UpdateFundPolicy))
+	router.HandleFunc("DELETE /users/me/fund-policy", middlewareJwtAuthUserLog(api2.DeleteFundPolicy))
+	router.HandleFunc("GET /users/me/dependency-flows", middlewareJwtAuthUserLog(api2.GetDependencyFlows))
+	router.HandleFunc("GET /users/me/forward-rules", middlewareJwtAuthUserLog(api2.GetForwardRules))
+	router.HandleFunc("POST /users/me/forward-rules", middlewareJwtAuthUserLog(api2.AddForwardRule))
+	router.HandleFunc("DELETE /users/me/forward-rules/{id}", middlewareJwtAuthUserLog(api2.DeleteForwardRule))
 	router.HandleFunc("GET /users/summary/{uuid}", api2.UserSummary2)
 	router.HandleFunc("GET /users/by/{email}", util.BasicAuth(credentials, api2.GetUserByEmail))
 
 	//payment
 	router.HandleFunc("POST /users/me/stripe", middlewareJwtAuthUserLog(sh.SetupStripe))
 	router.HandleFunc("DELETE /users/me/stripe", middlewareJwtAuthUserLog(api2.CancelSub))
-	router.HandleFunc("PUT /user s/me/stripe/{freq}/{seats}", middlewareJwtAuthUserLog(api2.StripePaymentInitial))
-	router.HandleFunc("POST /users/me/nowPayment/{freq}/{seats}", middlewareJwtAuthUserLog(api2.NowPayment))
+	router.HandleFunc("PUT /user s/me/stripe/{freq}/{seats}", middlewareJwtAuthUserLog(pp.CheckoutWith(sh.Name())))
+	router.HandleFunc("POST /users/me/nowPayment/{freq}/{seats}", middlewareJwtAuthUserLog(pp.CheckoutWith(nh.Name())))
+	router.HandleFunc("POST /users/me/payment/{provider}/{freq}/{seats}", middlewareJwtAuthUserLog(pp.Checkout))
+	router.HandleFunc("GET /users/me/nowPayment/{externalId}", middlewareJwtAuthUserLog(api2.NowPaymentRemainder))
 	router.HandleFunc("POST /users/me/sponsored-users", middlewareJwtAuthUserLog(api2.StatusSponsoredUsers))
 	router.HandleFunc("GET /users/me/payment", middlewareJwtAuthUserLog(api2.PaymentEvent))
 
@@ -238,9 +408,40 @@ func main() {
 	//contributions
 	router.HandleFunc("POST /users/contrib-snd", middlewareJwtAuthUserLog(api2.ContributionsSend))
 	router.HandleFunc("POST /users/contrib-rcv", middlewareJwtAuthUserLog(api2.ContributionsRcv))
+	router.HandleFunc("GET /users/contrib-snd/monthly", middlewareJwtAuthUserLog(api2.ContributionMonthsSend))
+	router.HandleFunc("GET /users/contrib-rcv/monthly", middlewareJwtAuthUserLog(api2.ContributionMonthsRcv))
 	router.HandleFunc("POST /users/me/contributions-summary", middlewareJwtAuthUserLog(api2.ContributionsSum))
 	router.HandleFunc("GET /users/contributions-summary/{uuid}", api2.ContributionsSum2)
 
+	//spending caps
+	router.HandleFunc("GET /users/me/spending-caps", middlewareJwtAuthUserLog(api2.GetSpendingCaps))
+	router.HandleFunc("PUT /users/me/spending-caps/{currency}", middlewareJwtAuthUserLog(api2.UpdateSpendingCap))
+	router.HandleFunc("DELETE /users/me/spending-caps/{currency}", middlewareJwtAuthUserLog(api2.DeleteSpendingCap))
+	router.HandleFunc("PUT /users/me/spending-stop/{date}", middlewareJwtAuthUserLog(api2.UpdateSpendingStop))
+	router.HandleFunc("DELETE /users/me/spending-stop", middlewareJwtAuthUserLog(api2.DeleteSpendingStop))
+	router.HandleFunc("PUT /users/me/subscription", middlewareJwtAuthUserLog(sp.ResumeSubscription))
+	router.HandleFunc("DELETE /users/me/subscription", middlewareJwtAuthUserLog(api2.CancelSubscription))
+
+	//organizations
+	router.HandleFunc("POST /orgs", middlewareJwtAuthUserLog(api2.CreateOrganization))
+	router.HandleFunc("GET /orgs/me", middlewareJwtAuthUserLog(api2.GetMyOrganization))
+	router.HandleFunc("GET /orgs/me/report", middlewareJwtAuthUserLog(api2.GetOrganizationReport))
+	router.HandleFunc("POST /orgs/me/members", middlewareJwtAuthUserLog(api2.AddOrganizationMember))
+	router.HandleFunc("PUT /orgs/me/members/{userId}/role/{role}", middlewareJwtAuthUserLog(api2.UpdateOrganizationMemberRole))
+	router.HandleFunc("DELETE /orgs/me/members/{userId}", middlewareJwtAuthUserLog(api2.RemoveOrganizationMember))
+	router.HandleFunc("PUT /orgs/me/payer/{userId}", middlewareJwtAuthUserLog(api2.UpdateOrganizationPayer))
+
+	//billing and invoices
+	router.HandleFunc("GET /users/me/billing-profile", middlewareJwtAuthUserLog(api2.GetBillingProfile))
+	router.HandleFunc("PUT /users/me/billing-profile", middlewareJwtAuthUserLog(api2.UpdateBillingProfile))
+	router.HandleFunc("GET /users/me/invoices", middlewareJwtAuthUserLog(api2.Invoices))
+	router.HandleFunc("GET /users/me/invoices/{id}", middlewareJwtAuthUserLog(api2.GetInvoice))
+
+	//statements
+	router.HandleFunc("GET /users/me/statements", middlewareJwtAuthUserLog(api2.Statements))
+	router.HandleFunc("GET /users/me/statements/{period}", middlewareJwtAuthUserLog(api2.GetStatement))
+	router.HandleFunc("POST /users/me/statements/{period}/email", middlewareJwtAuthUserLog(st.EmailStatement))
+
 	//github
 	router.HandleFunc("GET /repos/search", middlewareJwtAuthUserLog(rh.SearchRepoGitHub))
 
@@ -255,6 +456,7 @@ func main() {
 	router.HandleFunc("POST /repos/{id}/trust", middlewareJwtAuthAdminLog(rh.TrustRepo))
 	router.HandleFunc("POST /repos/{id}/untrust", middlewareJwtAuthAdminLog(rh.UnTrustRepo))
 	router.HandleFunc("GET /repos/{id}/{offset}/graph", middlewareJwtAuthUserLog(api2.Graph))
+	router.HandleFunc("GET /repos/{id}/dependencies", middlewareJwtAuthUserLog(api2.GetRepoDependencies))
 	router.HandleFunc("GET /repos/{id}/healthvalue", middlewareJwtAuthUserLog(api2.GetRepoHealthValueByRepoId))
 	router.HandleFunc("GET /repos/{id}/healthvalue/metrics", middlewareJwtAuthAdminLog(api2.GetRepoMetricsById))
 	router.HandleFunc("GET /repos/{id}/healthvalue/partial", middlewareJwtAuthAdminLog(api2.GetPartialHealthValuesById))
@@ -264,15 +466,37 @@ func main() {
 	//payment
 
 	//hooks
-	router.HandleFunc("POST /hooks/stripe", util2.MaxBytes(sh.StripeWebhook, 64*1024))
-	router.HandleFunc("POST /hooks/nowpayments", nh.NowWebhook)
+	router.HandleFunc("POST /hooks/stripe", util2.MaxBytes(pp.Webhook(sh.Name()), 64*1024))
+	router.HandleFunc("POST /hooks/nowpayments", pp.Webhook(nh.Name()))
 	router.HandleFunc("POST /hooks/analyzer", util.BasicAuth(credentials, api2.AnalysisEngineHook))
 
 	//admin
 	router.HandleFunc("GET /admin/time", middlewareJwtAuthAdminLog(api2.ServerTime))
 	router.HandleFunc("POST /admin/users", middlewareJwtAuthAdminLog(api2.Users))
+	router.HandleFunc("GET /admin/cron", middlewareJwtAuthAdminLog(api2.CronStatus))
+	router.HandleFunc("GET /admin/distribution", middlewareJwtAuthAdminLog(api2.DistributionStatus))
+	router.HandleFunc("GET /admin/contribution-archive", middlewareJwtAuthAdminLog(api2.ContributionArchives))
+	router.HandleFunc("GET /admin/chargebacks", middlewareJwtAuthAdminLog(api2.Chargebacks))
+	router.HandleFunc("GET /admin/webhooks", middlewareJwtAuthAdminLog(api2.WebhookEvents))
+	router.HandleFunc("POST /admin/webhooks/{id}/replay", middlewareJwtAuthAdminLog(api2.ReplayWebhookEvent))
+	router.HandleFunc("POST /admin/payments/{provider}/{externalId}/refund", middlewareJwtAuthAdminLog(pp.Refund))
+	router.HandleFunc("POST /admin/bank/statements", util2.MaxBytes(middlewareJwtAuthAdminLog(api2.ImportBankStatement), 10*1024*1024))
+	router.HandleFunc("GET /admin/bank/lines", middlewareJwtAuthAdminLog(api2.BankStatementLines))
+	router.HandleFunc("POST /admin/bank/lines/{id}/match/{externalId}", middlewareJwtAuthAdminLog(api2.MatchBankStatementLine))
+	router.HandleFunc("POST /admin/bank/lines/{id}/ignore", middlewareJwtAuthAdminLog(api2.IgnoreBankStatementLine))
+	router.HandleFunc("GET /admin/payouts", middlewareJwtAuthAdminLog(api2.PayoutRequests))
+	router.HandleFunc("GET /admin/payouts/batches", middlewareJwtAuthAdminLog(api2.PayoutBatches))
+	router.HandleFunc("POST /admin/payouts/batches/{currency}", middlewareJwtAuthAdminLog(ph.CreatePayoutBatch))
+	router.HandleFunc("GET /admin/payouts/batches/{id}/export", middlewareJwtAuthAdminLog(ph.ExportPayoutBatch))
+	router.HandleFunc("POST /admin/payouts/batches/{id}/submit", middlewareJwtAuthAdminLog(api2.SubmitPayoutBatch))
+	router.HandleFunc("POST /admin/payouts/batches/{id}/confirm", middlewareJwtAuthAdminLog(api2.ConfirmPayoutBatch))
+	router.HandleFunc("GET /admin/payouts/withdrawals", middlewareJwtAuthAdminLog(api2.UnreconciledPayoutWithdrawals))
+	router.HandleFunc("POST /admin/distribution/replay", middlewareJwtAuthAdminLog(rph.Replay))
+	router.HandleFunc("POST /admin/distribution/{day}/reverse", middlewareJwtAuthAdminLog(rph.Reverse))
+	router.HandleFunc("POST /admin/distribution/{day}/rebook", middlewareJwtAuthAdminLog(rph.Rebook))
 
 	router.HandleFunc("GET /config", ah.Config)
+	router.HandleFunc("GET /exchange-rates", middlewareJwtAuthUserLog(api2.GetExchangeRates))
 
 	//dev settings
 	if debug {
@@ -280,6 +504,8 @@ func main() {
 		router.HandleFunc("POST /admin/fake/payment/{email}/{seats}", middlewareJwtAuthAdminLog(api2.FakePayment))
 		router.HandleFunc("POST /admin/fake/contribution", middlewareJwtAuthAdminLog(api2.FakeContribution))
 		router.HandleFunc("POST /admin/timewarp/{hours}", middlewareJwtAuthAdminLog(api2.TimeWarp))
+		router.HandleFunc("POST /users/me/mock/{externalId}/{outcome}", middlewareJwtAuthUserLog(mh.Simulate))
+		router.HandleFunc("POST /hooks/mock", util2.MaxBytes(pp.Webhook(mh.Name()), 64*1024))
 	}
 
 	//invite
@@ -294,10 +520,44 @@ func main() {
 		w.WriteHeader(http.StatusNotFound)
 	})
 
-	c := NewCalcHandler(ac, ec)
-	//scheduler
-	cron.CronJobDay(c.DailyRunner, util.TimeNow())
-	cron.CronJobHour(c.HourlyRunner, util.TimeNow())
+	fp := NewFundPolicyHandler(ec, cfg.FundPolicy, cfg.FundPolicyMonths, cfg.FundPolicyNoticeDays, cfg.FundPolicyPoolEmail)
+	//scheduler, the rates of the day are stored first, the subscriptions, the fund policy and the
+	//forwarding need to run after the daily runner of the same day
+	cron.SetStore(db, cronOwner())
+	if cfg.ExchangeRateFile != "" {
+		er := NewExchangeRateHandler(client.NewFileRateProvider(cfg.ExchangeRateFile))
+		scheduleJob("exchange-rate", cfg.CronDaily, er.ExchangeRateRunner)
+	}
+	scheduleJob("daily", cfg.CronDaily, c.DailyRunner)
+	scheduleJob("subscription", cfg.CronDaily, NewSubscriptionHandler(ec, sp, pp[cfg.PaymentProvider]).SubscriptionRunner)
+	scheduleJob("fund-policy", cfg.CronDaily, fp.FundPolicyRunner)
+	scheduleJob("forward", cfg.CronDaily, fw.ForwardRunner)
+	if cfg.ArchiveMonths > 0 {
+		scheduleJob("archive", cfg.CronDaily, NewArchiveHandler(cfg.ArchiveMonths).ArchiveRunner)
+	}
+	scheduleJob("hourly", cfg.CronHourly, c.HourlyRunner)
+	scheduleJob("webhook", cfg.CronWebhook, NewWebhookHandler(pp, cfg.WebhookMaxAttempts).WebhookRunner)
+	if cfg.CronPayoutBatch != "" {
+		scheduleJob("payout-batch", cfg.CronPayoutBatch, NewPayoutBatchHandler(ph).PayoutBatchRunner)
+	}
+	if cfg.EthRpcUrl != "" {
+		eth, err := ethclient.Dial(cfg.EthRpcUrl)
+		if err != nil {
+			slog.Error("Could not connect to the Ethereum RPC", slog.Any("error", err))
+			os.Exit(1)
+		}
+		for currency, contract := range payoutContracts {
+			if contract == "" {
+				continue
+			}
+			pw, err := NewPayoutWatchHandler(eth, currency, contract, cfg.PayoutConfirmations, cfg.EthStartBlock)
+			if err != nil {
+				slog.Error("Could not watch payout contract", slog.Any("error", err))
+				os.Exit(1)
+			}
+			scheduleJob("payout-watch-"+strings.ToLower(currency), cfg.CronPayoutWatch, pw.PayoutWatchRunner)
+		}
+	}
 
 	slog.Info("Starting FlatFeeStack Backend", "port", cfg.Port)
 	err = http.ListenAndServe(":"+strconv.Itoa(cfg.Port), router)
@@ -0,0 +1,41 @@
+package main
+
+import (
+	api2 "backend/api"
+	"backend/util"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+)
+
+type PayoutBatchHandler struct {
+	ph *api2.PayoutHandler
+}
+
+func NewPayoutBatchHandler(ph *api2.PayoutHandler) *PayoutBatchHandler {
+	return &PayoutBatchHandler{ph}
+}
+
+// PayoutBatchRunner signs the requested payouts of each currency in a batch, the batches are exported and
+// sent by an admin. Currencies of a chain without key are skipped.
+func (p *PayoutBatchHandler) PayoutBatchRunner(now time.Time) error {
+	for _, currency := range slices.Sorted(maps.Keys(util.SupportedCurrencies)) {
+		if p.ph.Signer(currency) == nil {
+			continue
+		}
+		b, err := p.ph.CreateBatch(currency, now)
+		if err != nil {
+			return err
+		}
+		if b == nil {
+			continue
+		}
+		slog.Info("Created payout batch",
+			slog.String("id", b.Id.String()),
+			slog.String("currency", b.Currency),
+			slog.Int("requests", b.Requests),
+			slog.String("total", b.Total.String()))
+	}
+	return nil
+}
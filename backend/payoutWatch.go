@@ -0,0 +1,101 @@
+package main
+
+import (
+	api2 "backend/api"
+	"backend/chain"
+	"backend/db"
+	"backend/util"
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	// blocks read per run, the rest is read with the next runs
+	payoutWatchBlocks  = 1000
+	payoutWatchTimeout = 5 * time.Minute
+)
+
+type PayoutWatchHandler struct {
+	w          *chain.PayoutWatcher
+	currency   string
+	cursor     string
+	startBlock int
+}
+
+func NewPayoutWatchHandler(backend chain.Backend, currency string, contract string, confirmations int, startBlock int) (*PayoutWatchHandler, error) {
+	a := common.HexToAddress(contract)
+	w, err := chain.NewPayoutWatcher(backend, a, uint64(confirmations))
+	if err != nil {
+		return nil, err
+	}
+	return &PayoutWatchHandler{w, currency, "payout-" + a.Hex(), startBlock}, nil
+}
+
+// PayoutWatchRunner records the withdrawals of the payout contract in the blocks after the cursor. The
+// cursor is moved after the withdrawals are recorded, so a failed run reads the same blocks again and the
+// withdrawals recorded already are skipped. Without cursor, the runner starts at the start block or at
+// the current block.
+func (h *PayoutWatchHandler) PayoutWatchRunner(now time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), payoutWatchTimeout)
+	defer cancel()
+
+	head, ok, err := h.w.Head(ctx)
+	if err != nil || !ok {
+		return err
+	}
+	cursor, err := db.FindChainCursor(h.cursor)
+	if err != nil {
+		return err
+	}
+	var from uint64
+	switch {
+	case cursor != nil:
+		from = uint64(*cursor) + 1
+	case h.startBlock > 0:
+		from = uint64(h.startBlock)
+	default:
+		return db.UpdateChainCursor(h.cursor, int64(head), now)
+	}
+	if from > head {
+		return nil
+	}
+	to := min(head, from+payoutWatchBlocks-1)
+
+	ws, err := h.w.Withdrawals(ctx, from, to)
+	if err != nil {
+		return err
+	}
+	for _, w := range ws {
+		r, err := db.RecordPayoutWithdrawal(db.PayoutWithdrawal{
+			TxHash:    w.TxHash.Hex(),
+			Chain:     api2.ChainEth,
+			Currency:  h.currency,
+			Block:     int64(w.Block),
+			OwnerId:   w.OwnerId(),
+			Address:   w.Dev.Hex(),
+			Total:     w.TotalPayOut,
+			CreatedAt: w.Time,
+		}, util.TimeNow())
+		if err != nil {
+			return err
+		}
+		if r == nil {
+			continue
+		}
+		if r.PayoutRequestId == nil {
+			slog.Warn("Withdrawal matches no signed payout request",
+				slog.String("txHash", r.TxHash),
+				slog.String("ownerId", r.OwnerId),
+				slog.String("total", r.Total.String()))
+			continue
+		}
+		slog.Info("Payout withdrawn",
+			slog.String("txHash", r.TxHash),
+			slog.String("payoutRequestId", r.PayoutRequestId.String()),
+			slog.String("amount", r.Amount.String()))
+	}
+	return db.UpdateChainCursor(h.cursor, int64(to), util.TimeNow())
+}
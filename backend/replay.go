@@ -0,0 +1,226 @@
+package main
+
+import (
+	api2 "backend/api"
+	"backend/db"
+	"backend/util"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// string mapping
+const (
+	ActionBook    = "BOOK"
+	ActionSkip    = "SKIP"
+	ActionRepair  = "REPAIR"
+	ActionReverse = "REVERSE"
+)
+
+type ReplayHandler struct {
+	c  *CalcHandler
+	fw *ForwardHandler
+}
+
+func NewReplayHandler(c *CalcHandler, fw *ForwardHandler) *ReplayHandler {
+	return &ReplayHandler{c, fw}
+}
+
+// Replay books the days from..to in order, like the daily runner would have. Days that are booked
+// already are skipped, and days where the daily runner failed halfway are reversed and booked again.
+// It stops at the first day that fails, the days before stay booked.
+func (h *ReplayHandler) Replay(from time.Time, to time.Time, dryRun bool, userId *uuid.UUID) ([]api2.ReplayResult, error) {
+	rs := []api2.ReplayResult{}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		r, err := h.replayDay(day, dryRun, userId)
+		if err != nil {
+			return rs, fmt.Errorf("replay of %v failed: %w", day.Format(time.DateOnly), err)
+		}
+		rs = append(rs, *r)
+	}
+	return rs, nil
+}
+
+func (h *ReplayHandler) replayDay(day time.Time, dryRun bool, userId *uuid.UUID) (*api2.ReplayResult, error) {
+	if dryRun {
+		action, err := plannedAction(day)
+		if err != nil {
+			return nil, err
+		}
+		return &api2.ReplayResult{Day: day, Action: action, DryRun: true}, nil
+	}
+
+	action, err := h.c.bookDay(day, userId)
+	if err != nil {
+		return nil, err
+	}
+	//the forwarding of the day only runs if it did not run for this generation of the day
+	err = h.fw.ForwardRunner(day.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	return result(day, action)
+}
+
+// Reverse books compensating entries for the day, so all balances are as if the day was never booked
+func (h *ReplayHandler) Reverse(day time.Time, dryRun bool, userId *uuid.UUID) (*api2.ReplayResult, error) {
+	d, err := db.FindDistributionDay(day)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		booked, err := db.HasDistribution(day)
+		if err != nil {
+			return nil, err
+		}
+		if !booked {
+			return nil, fmt.Errorf("day %v was never booked", day.Format(time.DateOnly))
+		}
+		if !dryRun {
+			err = db.MarkDistributionDayBooked(day, util.TimeNow())
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else if d.Status == db.DistributionReversed {
+		return nil, fmt.Errorf("day %v is already reversed", day.Format(time.DateOnly))
+	}
+
+	if dryRun {
+		sums, err := db.FindDistributionSums(day)
+		if err != nil {
+			return nil, err
+		}
+		return &api2.ReplayResult{Day: day, Action: ActionReverse, DryRun: true, Sums: sums}, nil
+	}
+
+	generation, err := db.ReverseDistributionDay(day, util.TimeNow())
+	if err != nil {
+		return nil, err
+	}
+	err = insertDistributionEvent(day, ActionReverse, generation, userId)
+	if err != nil {
+		return nil, err
+	}
+	return result(day, ActionReverse)
+}
+
+// Rebook reverses the day and books it again with the current analysis results
+func (h *ReplayHandler) Rebook(day time.Time, dryRun bool, userId *uuid.UUID) ([]api2.ReplayResult, error) {
+	rev, err := h.Reverse(day, dryRun, userId)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return []api2.ReplayResult{*rev, {Day: day, Action: ActionBook, DryRun: true}}, nil
+	}
+	r, err := h.replayDay(day, false, userId)
+	if err != nil {
+		return []api2.ReplayResult{*rev}, err
+	}
+	return []api2.ReplayResult{*rev, *r}, nil
+}
+
+// plannedAction is what bookDay would do with the day
+func plannedAction(day time.Time) (string, error) {
+	d, err := db.FindDistributionDay(day)
+	if err != nil {
+		return "", err
+	}
+	if d == nil {
+		booked, err := db.HasDistribution(day)
+		if err != nil || booked {
+			return ActionSkip, err
+		}
+		return ActionBook, nil
+	}
+	switch d.Status {
+	case db.DistributionBooked:
+		return ActionSkip, nil
+	case db.DistributionBooking:
+		return ActionRepair, nil
+	default:
+		return ActionBook, nil
+	}
+}
+
+func result(day time.Time, action string) (*api2.ReplayResult, error) {
+	d, err := db.FindDistributionDay(day)
+	if err != nil {
+		return nil, err
+	}
+	sums, err := db.FindDistributionSums(day)
+	if err != nil {
+		return nil, err
+	}
+	r := &api2.ReplayResult{Day: day, Action: action, Sums: sums}
+	if d != nil {
+		r.Generation = d.Generation
+	}
+	return r, nil
+}
+
+func insertDistributionEvent(day time.Time, action string, generation int, userId *uuid.UUID) error {
+	return db.InsertDistributionEvent(db.DistributionEvent{
+		Id:         uuid.New(),
+		Day:        day,
+		Action:     action,
+		Generation: generation,
+		UserId:     userId,
+		CreatedAt:  util.TimeNow(),
+	})
+}
+
+// runReplayCommand runs a replay from the command line and prints the result as JSON, e.g.
+// backend replay -from 2026-10-01 -to 2026-10-05 -dry-run, or backend rebook -day 2026-10-03
+func runReplayCommand(h *ReplayHandler, args []string) error {
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	fromStr := fs.String("from", "", "First day to replay, YYYY-MM-DD")
+	toStr := fs.String("to", "", "Last day to replay, YYYY-MM-DD")
+	dayStr := fs.String("day", "", "Day to reverse or rebook, YYYY-MM-DD")
+	dryRun := fs.Bool("dry-run", false, "Only show what would be booked")
+	err := fs.Parse(args[1:])
+	if err != nil {
+		return err
+	}
+
+	var res any
+	switch args[0] {
+	case "replay":
+		from, err := api2.ParseDay(*fromStr)
+		if err != nil {
+			return fmt.Errorf("invalid -from: %w", err)
+		}
+		to, err := api2.ParseDay(*toStr)
+		if err != nil {
+			return fmt.Errorf("invalid -to: %w", err)
+		}
+		res, err = h.Replay(from, to, *dryRun, nil)
+		if err != nil {
+			return err
+		}
+	case "reverse", "rebook":
+		day, err := api2.ParseDay(*dayStr)
+		if err != nil {
+			return fmt.Errorf("invalid -day: %w", err)
+		}
+		if args[0] == "reverse" {
+			res, err = h.Reverse(day, *dryRun, nil)
+		} else {
+			res, err = h.Rebook(day, *dryRun, nil)
+		}
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown command %v, use replay, reverse or rebook", args[0])
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(res)
+}
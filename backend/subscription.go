@@ -0,0 +1,109 @@
+package main
+
+import (
+	api2 "backend/api"
+	"backend/client"
+	"backend/db"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type SubscriptionHandler struct {
+	ec *client.EmailClient
+	sp *api2.SubscriptionPolicy
+	p  api2.PaymentProvider
+}
+
+// NewSubscriptionHandler renews the subscriptions with the saved payment method of the provider p
+func NewSubscriptionHandler(ec *client.EmailClient, sp *api2.SubscriptionPolicy, p api2.PaymentProvider) *SubscriptionHandler {
+	return &SubscriptionHandler{ec, sp, p}
+}
+
+// SubscriptionRunner charges the renewals and retries that are due, and cancels the subscriptions
+// whose grace period is over. It is scheduled after the DailyRunner, which schedules the renewals of
+// the sponsors whose balance runs out soon.
+func (s *SubscriptionHandler) SubscriptionRunner(now time.Time) error {
+	subs, err := db.FindDueSubscriptions(now)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Start subscription runner",
+		slog.Int("len", len(subs)))
+
+	nr := 0
+	for _, sub := range subs {
+		u, err := db.FindUserById(sub.UserId)
+		if err != nil {
+			return err
+		}
+		if u == nil {
+			continue
+		}
+		if sub.Status == db.SubscriptionGrace {
+			err = s.cancel(sub, *u, now)
+		} else {
+			err = s.renew(sub, *u, now)
+		}
+		if err != nil {
+			return err
+		}
+		nr++
+	}
+
+	slog.Info("Subscription runner processed",
+		slog.Int("nr", nr))
+	return nil
+}
+
+// renew charges the saved payment method. The subscription is marked pending first, so a webhook that arrives
+// before the charge returns finds it. A charge that is declined right away is the next dunning step.
+func (s *SubscriptionHandler) renew(sub db.Subscription, u db.UserDetail, now time.Time) error {
+	if s.p.Name() == db.WebhookStripe && (u.StripeId == nil || u.PaymentMethod == nil) {
+		slog.Info("No credit card to renew the subscription",
+			slog.String("userId", u.Id.String()))
+		return api2.SubscriptionFailed(s.ec, s.sp, sub, u, now)
+	}
+
+	sub = s.sp.Charged(sub, uuid.New(), now)
+	err := db.UpsertSubscription(sub)
+	if err != nil {
+		return err
+	}
+	if sub.Retries == 0 {
+		err = s.ec.SendStripeTopUp(u)
+		if err != nil {
+			slog.Warn("Could not send top up email",
+				slog.String("userId", u.Id.String()),
+				slog.Any("error", err))
+		}
+	}
+
+	err = api2.Charge(s.p, u, *sub.ExternalId)
+	if err != nil {
+		slog.Warn("Renewal was declined",
+			slog.String("userId", u.Id.String()),
+			slog.Any("error", err))
+		return api2.SubscriptionFailed(s.ec, s.sp, sub, u, now)
+	}
+	return nil
+}
+
+func (s *SubscriptionHandler) cancel(sub db.Subscription, u db.UserDetail, now time.Time) error {
+	err := db.CancelSubscription(sub.UserId, now)
+	if err != nil {
+		return err
+	}
+	slog.Info("Subscription canceled after grace period",
+		slog.String("userId", u.Id.String()))
+
+	err = s.ec.SendSubscriptionCanceled(u)
+	if err != nil {
+		slog.Warn("Could not send cancel email",
+			slog.String("userId", u.Id.String()),
+			slog.Any("error", err))
+	}
+	return nil
+}
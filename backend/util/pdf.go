@@ -0,0 +1,86 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	pdfLinesPerPage = 64
+	pdfFontSize     = 9
+	pdfLineHeight   = 12
+	pdfMarginLeft   = 40
+	pdfMarginTop    = 800
+)
+
+// WritePdf writes the lines as a plain A4 PDF with a monospaced font, so columns that are aligned with
+// spaces stay aligned. The title is repeated on every page. Characters outside of ASCII are replaced,
+// as only the standard fonts are used.
+func WritePdf(w io.Writer, title string, lines []string) error {
+	var pages [][]string
+	for len(lines) > 0 || len(pages) == 0 {
+		n := min(len(lines), pdfLinesPerPage-2)
+		pages = append(pages, lines[:n])
+		lines = lines[n:]
+	}
+
+	//objects 1 and 2 are the catalog and the page tree, 3 is the font, then each page and its content
+	var objects []string
+	objects = append(objects, "<< /Type /Catalog /Pages 2 0 R >>")
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	objects = append(objects, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	objects = append(objects, "<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+
+	for i, page := range pages {
+		var c bytes.Buffer
+		fmt.Fprintf(&c, "BT /F1 %d Tf %d TL %d %d Td\n", pdfFontSize, pdfLineHeight, pdfMarginLeft, pdfMarginTop)
+		fmt.Fprintf(&c, "(%s) Tj T* T*\n", pdfEscape(fmt.Sprintf("%s - page %d/%d", title, i+1, len(pages))))
+		for _, l := range page {
+			fmt.Fprintf(&c, "(%s) Tj T*\n", pdfEscape(l))
+		}
+		c.WriteString("ET")
+
+		objects = append(objects, fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			5+2*i))
+		objects = append(objects, fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", c.Len(), c.String()))
+	}
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, o := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, o := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", o)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case r < 32 || r > 126:
+			b.WriteRune('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -147,6 +147,22 @@ func PrintMap(balanceMap map[string]*big.Int) string {
 	return s
 }
 
+// FormatAmount prints the amount in the unit of the currency with all its decimals, e.g. 1.500000 for
+// 1500000 USD. Amounts of unknown currencies are printed as they are.
+func FormatAmount(amount *big.Int, currency string) string {
+	c, ok := SupportedCurrencies[strings.ToUpper(currency)]
+	if !ok || c.FactorPow == 0 {
+		return amount.String()
+	}
+	factor := new(big.Int).Exp(big.NewInt(10), big.NewInt(c.FactorPow), nil)
+	q, r := new(big.Int).QuoRem(new(big.Int).Abs(amount), factor, new(big.Int))
+	sign := ""
+	if amount.Sign() < 0 {
+		sign = "-"
+	}
+	return fmt.Sprintf("%s%s.%0*s", sign, q.String(), int(c.FactorPow), r.String())
+}
+
 func UsdBaseToCent(base int64) int64 {
 	return base / 10_000
 }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	api2 "backend/api"
+	"backend/db"
+	"backend/util"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+const (
+	// events processed per run, the rest is processed with the next run
+	webhookBatch = 100
+	// an event that is neither processed nor failed after this time is due again
+	webhookLease    = 5 * time.Minute
+	webhookRetryMax = 6 * time.Hour
+)
+
+type WebhookHandler struct {
+	pp          api2.PaymentProviders
+	maxAttempts int
+}
+
+func NewWebhookHandler(pp api2.PaymentProviders, maxAttempts int) *WebhookHandler {
+	return &WebhookHandler{pp, maxAttempts}
+}
+
+// WebhookRunner processes the due events of the webhook inbox. An event is claimed before it is
+// processed, but a lease can run out while the event is still processed. The booking marks the event
+// processed in its transaction, so a second run of the same event books nothing. The emails of a booking
+// are sent after its commit. A failed event is retried with a growing delay until it ran out of attempts,
+// an admin can replay it afterwards.
+func (h *WebhookHandler) WebhookRunner(now time.Time) error {
+	es, err := db.FindDueWebhookEvents(now, webhookBatch)
+	if err != nil {
+		return err
+	}
+
+	nr := 0
+	for _, e := range es {
+		ok, err := db.ClaimWebhookEvent(e.Id, now, util.TimeNow().Add(webhookLease))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		e.Attempts++
+
+		err = h.pp.ProcessEvent(e.Provider, e.Payload, &db.Inbox{EventId: e.Id, Now: util.TimeNow()})
+		if err == nil || errors.Is(err, db.ErrWebhookEventProcessed) {
+			//an event that books nothing is marked processed here, a booked one is left as it is
+			err = db.WebhookEventProcessed(e.Id, util.TimeNow())
+			if err != nil {
+				return err
+			}
+			nr++
+			continue
+		}
+
+		var retryAt *time.Time
+		if e.Attempts < h.maxAttempts {
+			t := webhookRetryAt(e.Attempts, util.TimeNow())
+			retryAt = &t
+		}
+		slog.Warn("Webhook event failed",
+			slog.String("provider", e.Provider),
+			slog.String("eventId", e.EventId),
+			slog.Int("attempts", e.Attempts),
+			slog.Bool("retry", retryAt != nil),
+			slog.Any("error", err))
+		err = db.WebhookEventFailed(e.Id, err.Error(), retryAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(es) > 0 {
+		slog.Info("Webhook runner processed",
+			slog.Int("len", len(es)),
+			slog.Int("nr", nr))
+	}
+	return nil
+}
+
+// webhookRetryAt doubles the delay with every attempt, starting with one minute
+func webhookRetryAt(attempts int, now time.Time) time.Time {
+	d := webhookRetryMax
+	if attempts <= 10 {
+		d = min(time.Minute<<(attempts-1), webhookRetryMax)
+	}
+	return now.Add(d)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	api2 "backend/api"
+	"backend/db"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookRetryAt(t *testing.T) {
+	now := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, now.Add(time.Minute), webhookRetryAt(1, now))
+	assert.Equal(t, now.Add(4*time.Minute), webhookRetryAt(3, now))
+	assert.Equal(t, now.Add(webhookRetryMax), webhookRetryAt(10, now))
+	assert.Equal(t, now.Add(webhookRetryMax), webhookRetryAt(100, now))
+}
+
+func TestWebhookRunnerRetriesAndFails(t *testing.T) {
+	db.SetupTestData()
+	defer db.TeardownTestData()
+
+	now := time.Now()
+	e := db.WebhookEvent{
+		Id:            uuid.New(),
+		Provider:      db.WebhookNow,
+		EventId:       "1-finished-0",
+		EventType:     "finished",
+		Payload:       []byte(`{"payment_id":1,"payment_status":"finished"}`),
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+	ok, err := db.InsertWebhookEvent(e)
+	require.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = db.InsertWebhookEvent(e)
+	require.Nil(t, err)
+	assert.False(t, ok)
+
+	//the notification has no order, it is retried
+	h := NewWebhookHandler(api2.NewPaymentProviders(&api2.PaymentNowHandler{}), 2)
+	require.Nil(t, h.WebhookRunner(now))
+	r, err := db.FindWebhookEvent(e.Id)
+	require.Nil(t, err)
+	assert.Equal(t, db.WebhookPending, r.Status)
+	assert.Equal(t, 1, r.Attempts)
+	assert.NotNil(t, r.LastError)
+	assert.True(t, r.NextAttemptAt.After(now))
+
+	//not due yet
+	require.Nil(t, h.WebhookRunner(now))
+	r, err = db.FindWebhookEvent(e.Id)
+	require.Nil(t, err)
+	assert.Equal(t, 1, r.Attempts)
+
+	require.Nil(t, h.WebhookRunner(r.NextAttemptAt))
+	r, err = db.FindWebhookEvent(e.Id)
+	require.Nil(t, err)
+	assert.Equal(t, db.WebhookFailed, r.Status)
+	assert.Equal(t, 2, r.Attempts)
+
+	ok, err = db.ReplayWebhookEvent(e.Id, now)
+	require.Nil(t, err)
+	assert.True(t, ok)
+	es, err := db.FindDueWebhookEvents(now, 10)
+	require.Nil(t, err)
+	require.Len(t, es, 1)
+	assert.Equal(t, 0, es[0].Attempts)
+}
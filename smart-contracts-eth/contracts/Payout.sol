@@ -3,17 +3,29 @@ pragma solidity ^0.8.23;
 
 import "@openzeppelin/contracts/access/Ownable.sol";
 import "@openzeppelin/contracts/utils/cryptography/ECDSA.sol";
+import "@openzeppelin/contracts/utils/cryptography/EIP712.sol";
 import "@openzeppelin/contracts/token/ERC20/ERC20.sol";
 import "@openzeppelin/contracts/token/ERC20/utils/SafeERC20.sol";
 
-abstract contract Base is Ownable {
+abstract contract Base is Ownable, EIP712 {
+    /**
+     * @dev The typed data the server signs, wallets show its fields instead of a hash.
+     */
+    bytes32 public constant PAYOUT_TYPEHASH =
+        keccak256("Payout(uint256 userId,address payee,uint256 totalPayOut,uint256 nonce,uint256 deadline)");
+
     /**
      * @dev Maps each userId to its current already payed out amount. The userId never changes. 
      */
     mapping(uint256 => uint256) public payedOut;
+    /**
+     * @dev Maps each userId to the nonces of its used signatures. The nonces are unordered, so a newer
+     * signature can be used before an older one.
+     */
+    mapping(uint256 => mapping(uint256 => bool)) public usedNonces;
     string public symbol;
 
-    constructor(string memory _symbol) Ownable(msg.sender) {
+    constructor(string memory _symbol) Ownable(msg.sender) EIP712("FlatFeeStack Payout", "1") {
         symbol = _symbol;
     }
 
@@ -32,24 +44,37 @@ abstract contract Base is Ownable {
     }
 
     /**
-     * @dev Prepares everything to withdraw the earned amount. The signature has to be created by the contract owner and the signed message
-     * is the hash of the concatenation of the account and tea.
+     * @dev The EIP-712 domain separator of this contract, it binds a signature to the chain and the contract.
+     */
+    function domainSeparator() external view returns (bytes32) {
+        return _domainSeparatorV4();
+    }
+
+    /**
+     * @dev Prepares everything to withdraw the earned amount. The signature has to be created by the contract owner
+     * over the EIP-712 typed data Payout(userId, payee, totalPayOut, nonce, deadline), and only the payee the
+     * server signed for can be paid out to.
      *
+     * @param dev The address to withdraw to.
      * @param userId The user id that never changes
+     * @param payee The address the server signed the payout for.
      * @param totalPayOut The total amount that the user earned.
+     * @param nonce The nonce of the signature, each nonce of a user can be used once.
+     * @param deadline The time in seconds since the epoch after which the signature expires.
      * @param signature The signature of the server.
      */
-    function calculateWithdraw(uint256 userId, uint256 totalPayOut, bytes calldata signature) internal returns (uint256 amount) {
+    function calculateWithdraw(address dev, uint256 userId, address payee, uint256 totalPayOut, uint256 nonce, uint256 deadline, bytes calldata signature) internal returns (uint256 amount) {
+        require(dev == payee, "Payee mismatch");
         require(totalPayOut > payedOut[userId], "Nothing to withdraw");
+        require(block.timestamp <= deadline, "Signature expired");
+        require(!usedNonces[userId][nonce], "Nonce used");
 
-        bytes32 payloadHash = keccak256(
-            abi.encodePacked(address(this), "calculateWithdraw", userId, "#", totalPayOut));
+        bytes32 digest = _hashTypedDataV4(
+            keccak256(abi.encode(PAYOUT_TYPEHASH, userId, payee, totalPayOut, nonce, deadline)));
 
-        bytes32 messageHash = keccak256(
-            abi.encodePacked("\x19Ethereum Signed Message:\n32", payloadHash));
-
-        require(ECDSA.recover(messageHash, signature) == owner(), "Signature mismatch");
+        require(ECDSA.recover(digest, signature) == owner(), "Signature mismatch");
 
+        usedNonces[userId][nonce] = true;
         uint256 old = payedOut[userId];
         payedOut[userId] = totalPayOut;
 
@@ -72,7 +97,7 @@ abstract contract Base is Ownable {
 
     function getBalance(address dev) external view virtual returns (uint256);
 
-    function withdraw(address dev, uint256 userId, uint256 totalPayOut, bytes calldata signature) external virtual;
+    function withdraw(address dev, uint256 userId, address payee, uint256 totalPayOut, uint256 nonce, uint256 deadline, bytes calldata signature) external virtual;
 }
 
 contract PayoutEth is Base {
@@ -86,17 +111,20 @@ contract PayoutEth is Base {
     }
 
     /**
-     * @dev Withdraw the earned amount. The signature has to be created by the contract owner and the signed message
-     * is the hash of the concatenation of the account and tea.
+     * @dev Withdraw the earned amount. The signature has to be created by the contract owner over the EIP-712
+     * typed data Payout(userId, payee, totalPayOut, nonce, deadline).
      *
-     * @param dev The address to withdraw to.
+     * @param dev The address to withdraw to, it has to be the payee.
      * @param userId The user id that never changes
+     * @param payee The address the server signed the payout for.
      * @param totalPayOut The total amount that the user earned.
+     * @param nonce The nonce of the signature.
+     * @param deadline The time after which the signature expires.
      * @param signature The signature of the server.
      */
-    function withdraw(address dev, uint256 userId, uint256 totalPayOut, bytes calldata signature
+    function withdraw(address dev, uint256 userId, address payee, uint256 totalPayOut, uint256 nonce, uint256 deadline, bytes calldata signature
     ) external override {
-        uint256 toBePaid = calculateWithdraw(userId, totalPayOut, signature);
+        uint256 toBePaid = calculateWithdraw(dev, userId, payee, totalPayOut, nonce, deadline, signature);
         (bool success, ) = payable(dev).call{value: toBePaid}("");
         require(success, "ETH Insufficient Balance");
     }
@@ -115,16 +143,19 @@ contract PayoutERC20 is Base {
     }
 
     /**
-     * @dev Withdraw the earned amount. The signature has to be created by the contract owner and the signed message
-     * is the hash of the concatenation of the account and tea.
+     * @dev Withdraw the earned amount. The signature has to be created by the contract owner over the EIP-712
+     * typed data Payout(userId, payee, totalPayOut, nonce, deadline).
      *
-     * @param dev The address to withdraw to.
+     * @param dev The address to withdraw to, it has to be the payee.
      * @param userId The user id that never changes
+     * @param payee The address the server signed the payout for.
      * @param totalPayOut The total amount that the user earned.
+     * @param nonce The nonce of the signature.
+     * @param deadline The time after which the signature expires.
      * @param signature The signature of the server.
      */
-    function withdraw(address dev, uint256 userId, uint256 totalPayOut, bytes calldata signature) external override {
-        uint256 toBePaid = calculateWithdraw(userId, totalPayOut, signature);
+    function withdraw(address dev, uint256 userId, address payee, uint256 totalPayOut, uint256 nonce, uint256 deadline, bytes calldata signature) external override {
+        uint256 toBePaid = calculateWithdraw(dev, userId, payee, totalPayOut, nonce, deadline, signature);
         SafeERC20.safeTransfer(token, dev, toBePaid);
     }
 }
@@ -0,0 +1,14 @@
+import { artifacts } from "hardhat";
+import { writeFileSync } from "fs";
+
+// writes the bytecode of PayoutEth next to the ABI of the backend, the backend tests deploy it on a
+// simulated chain
+async function main() {
+    const artifact = await artifacts.readArtifact("PayoutEth");
+    writeFileSync("../backend/chain/Payout.bin", artifact.bytecode.replace(/^0x/, "") + "\n");
+}
+
+main().catch((error) => {
+    console.error(error);
+    process.exitCode = 1;
+});
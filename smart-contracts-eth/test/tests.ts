@@ -6,23 +6,32 @@ import { Contract, ContractTransactionResponse, TransactionResponse, EventLog }
 let council1: HardhatEthersSigner, council2: HardhatEthersSigner, user1: HardhatEthersSigner, user2: HardhatEthersSigner, user3: HardhatEthersSigner, user4: HardhatEthersSigner;
 let contractNFT: Contract, contractDAO: Contract, contractUSDC: Contract, contractPayoutEth:Contract, contractPayoutUSDC:Contract;
  
-async function sign(signer:HardhatEthersSigner, userId:string, payOut:bigint, contract:Contract) : Promise<string> {
-  const message = ethers.solidityPackedKeccak256(
-    ["address", "string", "uint256", "string", "uint256"], 
-    [contract.target as string, "calculateWithdraw", userId, "#", payOut]);
-    return await signer.signMessage(ethers.getBytes(message));
+const NONCE = BigInt(1);
+const DEADLINE = BigInt(2) ** BigInt(40);
+
+async function sign(signer:HardhatEthersSigner, userId:string, payOut:bigint, contract:Contract, nonce:bigint = NONCE, deadline:bigint = DEADLINE, payee:string = user1.address) : Promise<string> {
+  const { chainId } = await ethers.provider.getNetwork();
+  return await signer.signTypedData(
+    {name: "FlatFeeStack Payout", version: "1", chainId: chainId, verifyingContract: contract.target as string},
+    {Payout: [
+      {name: "userId", type: "uint256"},
+      {name: "payee", type: "address"},
+      {name: "totalPayOut", type: "uint256"},
+      {name: "nonce", type: "uint256"},
+      {name: "deadline", type: "uint256"}]},
+    {userId: userId, payee: payee, totalPayOut: payOut, nonce: nonce, deadline: deadline});
 }
 
-async function withdraw(contract:Contract, user:HardhatEthersSigner, payOut:bigint, signature:string, errorMsg:string|undefined) {
+async function withdraw(contract:Contract, user:HardhatEthersSigner, payOut:bigint, signature:string, errorMsg:string|undefined, nonce:bigint = NONCE, deadline:bigint = DEADLINE) {
   const userBalance = await contract.getBalance(user.address) as bigint;
   if(!errorMsg) {
     // Withdraw funds
-    await contract.withdraw(user.address, ethers.sha256(user.address), payOut, signature);
+    await contract.withdraw(user.address, ethers.sha256(user.address), user.address, payOut, nonce, deadline, signature);
     // Check balance of user
     expect(await contract.getBalance(user.address)).to.equal(payOut + userBalance);
   } else {
     try {
-      await contract.withdraw(user.address, ethers.sha256(user.address), payOut, signature);
+      await contract.withdraw(user.address, ethers.sha256(user.address), user.address, payOut, nonce, deadline, signature);
       expect.fail("The transaction should have failed");
     } catch (error: any) {
       // Check if the error message is as expected
@@ -180,6 +189,59 @@ describe("Withdraw Functionality", function () {
 
     await withdraw(contractPayoutUSDC, user1, payOutUSDC, invalidSignature, "ECDSAInvalidSignature");
   });
+
+  it("should fail for an expired signature", async function () {
+    await fundingEth(contractPayoutEth, 10);
+
+    const payOutEth = ethers.parseEther("1") as bigint;
+    const deadline = BigInt((await ethers.provider.getBlock("latest"))!.timestamp + 60);
+    const signature = await sign(council1, ethers.sha256(user1.address), payOutEth, contractPayoutEth, NONCE, deadline);
+
+    await timeTravel(120);
+    await withdraw(contractPayoutEth, user1, payOutEth, signature, "Signature expired", NONCE, deadline);
+  });
+
+  it("should fail for a used nonce and allow unordered nonces", async function () {
+    await fundingEth(contractPayoutEth, 10);
+
+    const payOut1 = ethers.parseEther("1") as bigint;
+    const payOut2 = ethers.parseEther("2") as bigint;
+    const signature1 = await sign(council1, ethers.sha256(user1.address), payOut1, contractPayoutEth, BigInt(7));
+    const signature2 = await sign(council1, ethers.sha256(user1.address), payOut2, contractPayoutEth, BigInt(7));
+    const signature3 = await sign(council1, ethers.sha256(user1.address), payOut2, contractPayoutEth, BigInt(3));
+
+    await withdraw(contractPayoutEth, user1, payOut1, signature1, undefined, BigInt(7));
+    await withdraw(contractPayoutEth, user1, payOut2, signature2, "Nonce used", BigInt(7));
+    //the contract pays out the difference to the first withdrawal
+    await contractPayoutEth.withdraw(user1.address, ethers.sha256(user1.address), user1.address, payOut2, BigInt(3), DEADLINE, signature3);
+    expect(await contractPayoutEth.payedOut(ethers.sha256(user1.address))).to.equal(payOut2);
+  });
+
+  it("should fail for a withdrawal to another address than the payee", async function () {
+    await fundingEth(contractPayoutEth, 10);
+
+    const payOutEth = ethers.parseEther("1") as bigint;
+    const signature = await sign(council1, ethers.sha256(user1.address), payOutEth, contractPayoutEth);
+
+    try {
+      await contractPayoutEth.withdraw(user2.address, ethers.sha256(user1.address), user1.address, payOutEth, NONCE, DEADLINE, signature);
+      expect.fail("The transaction should have failed");
+    } catch (error: any) {
+      expect(error.message).to.include("Payee mismatch");
+    }
+    //a payee the server did not sign for does not match the signature
+    const signature2 = await sign(council1, ethers.sha256(user1.address), payOutEth, contractPayoutEth, NONCE, DEADLINE, user2.address);
+    await withdraw(contractPayoutEth, user1, payOutEth, signature2, "Signature mismatch");
+  });
+
+  it("should fail for a signature of another contract", async function () {
+    await fundingUSDC(contractPayoutUSDC, 10);
+
+    const payOutUSDC = dollar(1);
+    const signature = await sign(council1, ethers.sha256(user1.address), payOutUSDC, contractPayoutEth);
+
+    await withdraw(contractPayoutUSDC, user1, payOutUSDC, signature, "Signature mismatch");
+  });
 });
 
 describe("Balance and Recovery Functionality", function () {